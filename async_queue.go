@@ -0,0 +1,196 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// QueueFullBehavior defines what happens to new asynchronous requests
+// if MaxQueueLength requests are already waiting
+type QueueFullBehavior int
+
+const (
+	// BlockWhenFull blocks the caller of Visit, Post, etc. until the
+	// queue has room for the request
+	BlockWhenFull QueueFullBehavior = iota
+	// DropWhenFull rejects the request with ErrQueueFull
+	DropWhenFull
+	// SpillWhenFull stores the request in the SpillStorage of the
+	// Collector until the queue has room for it. Requests are rejected
+	// with ErrQueueFull if the Collector has no SpillStorage.
+	SpillWhenFull
+)
+
+// SpillStorage stores the serialized asynchronous requests which do not
+// fit in the queue. Its methods are a subset of queue.Storage, so the
+// storages of the queue package can be used.
+type SpillStorage interface {
+	// AddRequest adds a serialized request to the storage
+	AddRequest([]byte) error
+	// GetRequest pops the next request from the storage
+	// or returns error if the storage is empty
+	GetRequest() ([]byte, error)
+	// QueueSize returns with the number of stored requests
+	QueueSize() (int, error)
+}
+
+// MaxQueueLength limits the number of asynchronous requests waiting for
+// the LimitRules of their domains. Requests of domains without
+// LimitRule are started immediately, so they never wait in the queue,
+// unless MaxConcurrency is set.
+func MaxQueueLength(n int, behavior QueueFullBehavior) CollectorOption {
+	return func(c *Collector) {
+		c.MaxQueueLength = n
+		c.QueueFullBehavior = behavior
+	}
+}
+
+// SetSpillStorage sets the storage of the requests which do not fit in
+// the queue if QueueFullBehavior is SpillWhenFull
+func (c *Collector) SetSpillStorage(s SpillStorage) {
+	c.asyncQueue.lock.Lock()
+	c.asyncQueue.spill = s
+	c.asyncQueue.lock.Unlock()
+}
+
+// asyncQueue counts the asynchronous requests which are scheduled, but
+// not started yet
+type asyncQueue struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	pending int
+	spilled int
+	spill   SpillStorage
+}
+
+func newAsyncQueue() *asyncQueue {
+	q := &asyncQueue{}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// reserve reserves a place for a new checked asynchronous request in
+// the queue. It returns false if the request was spilled or rejected.
+func (c *Collector) reserve(u, method string, depth int, requestData io.Reader, ctx *Context, hdr http.Header) (bool, error) {
+	q := c.asyncQueue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if c.MaxQueueLength <= 0 || q.pending < c.MaxQueueLength {
+		q.pending++
+		return true, nil
+	}
+	switch c.QueueFullBehavior {
+	case BlockWhenFull:
+		for q.pending >= c.MaxQueueLength {
+			q.cond.Wait()
+		}
+		q.pending++
+		return true, nil
+	case SpillWhenFull:
+		if q.spill == nil {
+			return false, ErrQueueFull
+		}
+		r := &serializableRequest{
+			URL:     u,
+			Method:  method,
+			Depth:   depth,
+			Headers: hdr,
+		}
+		if requestData != nil {
+			r.Body = streamToByte(requestData)
+		}
+		if ctx != nil {
+			r.Ctx = make(map[string]interface{})
+			ctx.ForEach(func(k string, v interface{}) interface{} {
+				r.Ctx[k] = v
+				return nil
+			})
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return false, err
+		}
+		if err := q.spill.AddRequest(data); err != nil {
+			return false, err
+		}
+		// Wait returns after the spilled requests are sent
+		q.spilled++
+		c.wg.Add(1)
+		return false, nil
+	default:
+		return false, ErrQueueFull
+	}
+}
+
+// forgetRequest removes a checked request rejected by the queue from
+// the visited requests, so it can be visited later
+func (c *Collector) forgetRequest(u, method string, requestData io.Reader) {
+	s, ok := c.store.(storage.UnvisitStorage)
+	if !ok || c.AllowURLRevisit {
+		return
+	}
+	if method == "GET" {
+		s.Unvisit(requestHash(u, nil))
+	} else if requestData != nil {
+		s.Unvisit(requestHash(u, streamToByte(requestData)))
+	}
+}
+
+// started frees the place of a started request and
+// schedules a spilled request if there is one
+func (c *Collector) started() {
+	q := c.asyncQueue
+	q.lock.Lock()
+	q.pending--
+	q.cond.Broadcast()
+	if q.spilled == 0 {
+		q.lock.Unlock()
+		return
+	}
+	data, err := q.spill.GetRequest()
+	if err != nil {
+		q.lock.Unlock()
+		return
+	}
+	q.spilled--
+	q.lock.Unlock()
+	go c.restore(data)
+}
+
+// restore schedules a spilled request. The request was checked before
+// it was spilled, so it is not rejected as already visited.
+func (c *Collector) restore(data []byte) {
+	defer c.wg.Done()
+	r := &serializableRequest{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return
+	}
+	ctx := NewContext()
+	for k, v := range r.Ctx {
+		ctx.Put(k, v)
+	}
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+	c.scrape(r.URL, r.Method, r.Depth, body, ctx, r.Headers, false)
+}
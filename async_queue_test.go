@@ -0,0 +1,187 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sliceSpillStorage struct {
+	lock     sync.Mutex
+	requests [][]byte
+}
+
+func (s *sliceSpillStorage) AddRequest(r []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+	return nil
+}
+
+func (s *sliceSpillStorage) GetRequest() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests) == 0 {
+		return nil, errors.New("empty")
+	}
+	r := s.requests[0]
+	s.requests = s.requests[1:]
+	return r, nil
+}
+
+func (s *sliceSpillStorage) QueueSize() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.requests), nil
+}
+
+// newBlockingServer returns a server holding the first request until
+// release is closed
+func newBlockingServer() (*httptest.Server, chan struct{}, chan struct{}) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	once := sync.Once{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			close(arrived)
+			<-release
+		})
+		w.Write([]byte("ok"))
+	}))
+	return ts, arrived, release
+}
+
+func TestMaxQueueLengthDrop(t *testing.T) {
+	ts, arrived, release := newBlockingServer()
+	defer ts.Close()
+
+	c := NewCollector(Async(true), MaxQueueLength(2, DropWhenFull))
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1})
+	var responses int32
+	c.OnResponse(func(r *Response) {
+		atomic.AddInt32(&responses, 1)
+	})
+	c.Visit(ts.URL + "/0")
+	<-arrived
+	for i := 1; i <= 2; i++ {
+		if err := c.Visit(fmt.Sprintf("%s/%d", ts.URL, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Visit(ts.URL + "/3"); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	close(release)
+	c.Wait()
+	if responses != 3 {
+		t.Errorf("Expected 3 responses, got %d", responses)
+	}
+	// the dropped URL is not marked as visited
+	if visited, _ := c.HasVisited(ts.URL + "/3"); visited {
+		t.Error("Dropped URL was marked as visited")
+	}
+}
+
+func TestMaxQueueLengthSpill(t *testing.T) {
+	ts, arrived, release := newBlockingServer()
+	defer ts.Close()
+
+	c := NewCollector(Async(true), MaxQueueLength(1, SpillWhenFull))
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1})
+	spill := &sliceSpillStorage{}
+	c.SetSpillStorage(spill)
+	var lock sync.Mutex
+	visited := make(map[string]string)
+	c.OnResponse(func(r *Response) {
+		lock.Lock()
+		visited[r.Request.URL.Path] = r.Ctx.Get("n")
+		lock.Unlock()
+	})
+	c.Visit(ts.URL + "/0")
+	<-arrived
+	for i := 1; i <= 4; i++ {
+		ctx := NewContext()
+		ctx.Put("n", fmt.Sprint(i))
+		if err := c.Request("GET", fmt.Sprintf("%s/%d", ts.URL, i), nil, ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the requests are checked before they are spilled
+	if err := c.Visit(ts.URL + "/1"); err != ErrAlreadyVisited {
+		t.Errorf("Expected ErrAlreadyVisited, got %v", err)
+	}
+	if n, _ := spill.QueueSize(); n != 3 {
+		t.Errorf("Expected 3 spilled requests, got %d", n)
+	}
+	close(release)
+	c.Wait()
+	if len(visited) != 5 {
+		t.Errorf("Expected 5 responses, got %v", visited)
+	}
+	for i := 1; i <= 4; i++ {
+		if n := visited[fmt.Sprintf("/%d", i)]; n != fmt.Sprint(i) {
+			t.Errorf("Context of request %d was not restored: %q", i, n)
+		}
+	}
+}
+
+func TestMaxQueueLengthBlock(t *testing.T) {
+	ts, arrived, release := newBlockingServer()
+	defer ts.Close()
+
+	c := NewCollector(Async(true), MaxQueueLength(1, BlockWhenFull))
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1})
+	c.DisallowedURLFilters = []*regexp.Regexp{regexp.MustCompile("filtered")}
+	c.Visit(ts.URL + "/0")
+	<-arrived
+	c.Visit(ts.URL + "/1")
+	// the rejected requests do not wait for the full queue
+	checked := make(chan error, 3)
+	go func() {
+		checked <- c.Visit(ts.URL + "/1")
+		checked <- c.Visit(ts.URL + "/filtered")
+		checked <- c.Visit("%%invalid")
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-checked:
+			if err == nil {
+				t.Error("Invalid request was accepted")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Visit of a rejected request was blocked by the full queue")
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Visit(ts.URL + "/2")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("Visit was not blocked by the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	c.Wait()
+}
@@ -0,0 +1,361 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxAuthRounds is the maximum number of retries of a request answered
+// with 401 Unauthorized. NTLM needs two of them.
+const maxAuthRounds = 2
+
+// Auth adds credentials to the requests of a domain. Auth is set by
+// Collector.SetAuth and applied to every request of the domain,
+// including the requests of followed redirects.
+type Auth interface {
+	// Authorize adds the credentials to a request before it is sent
+	Authorize(req *http.Request) error
+	// Challenge processes a 401 Unauthorized response. It returns true
+	// if the request should be sent again as retry, whose credentials
+	// are already set by Challenge.
+	Challenge(res *http.Response, retry *http.Request) (bool, error)
+}
+
+// BasicAuth returns an Auth sending the credentials by HTTP Basic
+// authentication
+func BasicAuth(username, password string) Auth {
+	return &basicAuth{username: username, password: password}
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a *basicAuth) Authorize(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+func (a *basicAuth) Challenge(res *http.Response, retry *http.Request) (bool, error) {
+	return false, nil
+}
+
+// BearerAuth sends a static bearer token. If Refresh is set, it is
+// called to get a new token if a request is rejected with 401
+// Unauthorized, and the request is retried with the new token.
+type BearerAuth struct {
+	Token   string
+	Refresh func() (string, error)
+	lock    sync.Mutex
+}
+
+// Authorize implements Auth
+func (a *BearerAuth) Authorize(req *http.Request) error {
+	a.lock.Lock()
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	a.lock.Unlock()
+	return nil
+}
+
+// Challenge implements Auth
+func (a *BearerAuth) Challenge(res *http.Response, retry *http.Request) (bool, error) {
+	if a.Refresh == nil {
+		return false, nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	// the token was refreshed by a concurrent request
+	if res.Request.Header.Get("Authorization") == "Bearer "+a.Token {
+		token, err := a.Refresh()
+		if err != nil {
+			return false, err
+		}
+		a.Token = token
+	}
+	retry.Header.Set("Authorization", "Bearer "+a.Token)
+	return true, nil
+}
+
+// DigestAuth returns an Auth sending the credentials by HTTP Digest
+// authentication (RFC 7616). The MD5, MD5-sess and SHA-256 algorithms
+// with "auth" quality of protection are supported. The first request of
+// a protection space is sent without credentials to get the challenge.
+func DigestAuth(username, password string) Auth {
+	return &digestAuth{username: username, password: password}
+}
+
+type digestAuth struct {
+	username  string
+	password  string
+	challenge map[string]string
+	nc        int
+	lock      sync.Mutex
+}
+
+func (a *digestAuth) Authorize(req *http.Request) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.challenge == nil {
+		return nil
+	}
+	return a.authorize(req)
+}
+
+func (a *digestAuth) Challenge(res *http.Response, retry *http.Request) (bool, error) {
+	challenge := parseAuthChallenge(res.Header, "Digest")
+	if challenge == nil {
+		return false, nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	// rejected credentials are not retried unless the nonce is stale
+	if strings.HasPrefix(res.Request.Header.Get("Authorization"), "Digest ") && !strings.EqualFold(challenge["stale"], "true") {
+		return false, nil
+	}
+	a.challenge = challenge
+	a.nc = 0
+	return true, a.authorize(retry)
+}
+
+// authorize must be called holding the lock
+func (a *digestAuth) authorize(req *http.Request) error {
+	var h func() hash.Hash
+	algorithm := a.challenge["algorithm"]
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5", "MD5-SESS":
+		h = md5.New
+	case "SHA-256", "SHA-256-SESS":
+		h = sha256.New
+	default:
+		return fmt.Errorf("Unsupported digest algorithm %s", algorithm)
+	}
+	hexHash := func(s string) string {
+		d := h()
+		io.WriteString(d, s)
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	cnonceBytes := make([]byte, 8)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	a.nc++
+	nc := fmt.Sprintf("%08x", a.nc)
+	realm, nonce := a.challenge["realm"], a.challenge["nonce"]
+	ha1 := hexHash(a.username + ":" + realm + ":" + a.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = hexHash(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	uri := req.URL.RequestURI()
+	ha2 := hexHash(req.Method + ":" + uri)
+	qop := ""
+	for _, q := range strings.Split(a.challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop == "" {
+		response = hexHash(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = hexHash(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+	v := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`, a.username, realm, nonce, uri, response)
+	if algorithm != "" {
+		v += ", algorithm=" + algorithm
+	}
+	if opaque, ok := a.challenge["opaque"]; ok {
+		v += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	if qop != "" {
+		v += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	req.Header.Set("Authorization", v)
+	return nil
+}
+
+// parseAuthChallenge returns the parameters of the WWW-Authenticate
+// challenge of the scheme or nil if the response has no such challenge
+func parseAuthChallenge(h http.Header, scheme string) map[string]string {
+	for _, v := range h["Www-Authenticate"] {
+		if len(v) < len(scheme) || !strings.EqualFold(v[:len(scheme)], scheme) {
+			continue
+		}
+		params := make(map[string]string)
+		s := strings.TrimSpace(v[len(scheme):])
+		for s != "" {
+			i := strings.IndexByte(s, '=')
+			if i < 0 {
+				break
+			}
+			key := strings.ToLower(strings.TrimSpace(s[:i]))
+			s = strings.TrimSpace(s[i+1:])
+			var value string
+			if strings.HasPrefix(s, `"`) {
+				var b strings.Builder
+				end := 1
+				for ; end < len(s) && s[end] != '"'; end++ {
+					if s[end] == '\\' && end+1 < len(s) {
+						end++
+					}
+					b.WriteByte(s[end])
+				}
+				value = b.String()
+				if end < len(s) {
+					end++
+				}
+				s = s[end:]
+			} else {
+				end := strings.IndexByte(s, ',')
+				if end < 0 {
+					end = len(s)
+				}
+				value = strings.TrimSpace(s[:end])
+				s = s[end:]
+			}
+			params[key] = value
+			s = strings.TrimLeft(s, " ,")
+		}
+		return params
+	}
+	return nil
+}
+
+// SetAuth sets the authentication of a domain. Subdomains are matched
+// by a leading "*.", e.g. "*.example.com". The Auth of the empty domain
+// is used for every domain without Auth. Passing nil removes the Auth
+// of the domain.
+func (c *Collector) SetAuth(domain string, auth Auth) {
+	c.backend.SetAuth(domain, auth)
+}
+
+// SetAuth sets the authentication of a domain
+func (h *httpBackend) SetAuth(domain string, auth Auth) {
+	domain = strings.ToLower(domain)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if auth == nil {
+		delete(h.auths, domain)
+		return
+	}
+	if h.auths == nil {
+		h.auths = make(map[string]Auth)
+	}
+	h.auths[domain] = auth
+}
+
+// auth returns the Auth of a host or nil
+func (h *httpBackend) auth(host string) Auth {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.auths) == 0 {
+		return nil
+	}
+	for _, d := range domainKeys(host) {
+		if a, ok := h.auths[d]; ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// domainKeys returns the keys of the per-domain settings matching a
+// host in the order of precedence: the host itself, the wildcards of
+// its parent domains, e.g. "*.example.com", and the empty default key
+func domainKeys(host string) []string {
+	host = strings.ToLower(host)
+	keys := []string{host}
+	for d := host; strings.Contains(d, "."); {
+		d = d[strings.IndexByte(d, '.')+1:]
+		keys = append(keys, "*."+d)
+	}
+	return append(keys, "")
+}
+
+// authorize adds the credentials of the Auth of the request's host
+func (h *httpBackend) authorize(req *http.Request) error {
+	if a := h.auth(req.URL.Hostname()); a != nil {
+		return a.Authorize(req)
+	}
+	return nil
+}
+
+// doAuthorized sends the request with the credentials of its host and
+// retries it if the Auth accepts the authentication challenge of a 401
+// Unauthorized response
+func (h *httpBackend) doAuthorized(req *http.Request) (*http.Response, error) {
+	if err := h.authorize(req); err != nil {
+		return nil, err
+	}
+	client := h.client()
+	res, err := client.Do(req)
+	for i := 0; i < maxAuthRounds && err == nil && res.StatusCode == http.StatusUnauthorized; i++ {
+		last := res.Request
+		a := h.auth(last.URL.Hostname())
+		if a == nil {
+			break
+		}
+		// the context of the sent request is canceled with its body
+		retry := last.WithContext(req.Context())
+		retry.Header = cloneHeader(last.Header)
+		if last.GetBody != nil {
+			if retry.Body, err = last.GetBody(); err != nil {
+				discardBody(res)
+				return nil, err
+			}
+		} else if last.Body != nil && last.Body != http.NoBody {
+			// the body can not be sent again
+			break
+		}
+		ok, cerr := a.Challenge(res, retry)
+		if cerr != nil {
+			discardBody(res)
+			return nil, cerr
+		}
+		if !ok {
+			break
+		}
+		discardBody(res)
+		res, err = client.Do(retry)
+	}
+	return res, err
+}
+
+// discardBody drains and closes the body of the response to reuse the
+// connection, which is required by connection based schemes like NTLM
+func discardBody(res *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newAuthTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/basic", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+	mux.HandleFunc("/bearer", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/digest", func(w http.ResponseWriter, r *http.Request) {
+		params := parseAuthChallenge(http.Header{"Www-Authenticate": r.Header["Authorization"]}, "Digest")
+		if params == nil {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth,auth-int", nonce="abc123", opaque="xyz"`)
+			w.WriteHeader(401)
+			return
+		}
+		hexMD5 := func(s string) string {
+			h := md5.Sum([]byte(s))
+			return hex.EncodeToString(h[:])
+		}
+		ha1 := hexMD5("user:test:pass")
+		ha2 := hexMD5(r.Method + ":" + r.URL.RequestURI())
+		expected := hexMD5(ha1 + ":abc123:" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["response"] != expected || params["opaque"] != "xyz" || params["uri"] != r.URL.RequestURI() {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/ntlm", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "NTLM ") {
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(401)
+			return
+		}
+		msg, _ := base64.StdEncoding.DecodeString(auth[5:])
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case 1:
+			targetInfo := []byte{2, 0, 8, 0, 'T', 0, 'E', 0, 'S', 0, 'T', 0, 0, 0, 0, 0}
+			challenge := make([]byte, 48)
+			copy(challenge, ntlmSignature)
+			binary.LittleEndian.PutUint32(challenge[8:], 2)
+			binary.LittleEndian.PutUint32(challenge[20:], ntlmNegotiateFlags|ntlmNegotiateTargetInfo)
+			copy(challenge[24:], "12345678")
+			binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint32(challenge[44:], 48)
+			challenge = append(challenge, targetInfo...)
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(challenge))
+			w.WriteHeader(401)
+		case 3:
+			field := func(i int) []byte {
+				l := binary.LittleEndian.Uint16(msg[12+i*8:])
+				o := binary.LittleEndian.Uint32(msg[16+i*8:])
+				return msg[o : o+uint32(l)]
+			}
+			nt := field(1)
+			hash := hmacMD5(md4Sum(utf16LE("pass")), utf16LE("USER"+"DOMAIN"))
+			if !bytes.Equal(hmacMD5(hash, []byte("12345678"), nt[16:]), nt[:16]) || !bytes.Equal(field(3), utf16LE("user")) {
+				w.WriteHeader(401)
+				return
+			}
+			w.Write([]byte("ok"))
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestMD4(t *testing.T) {
+	for in, out := range map[string]string{
+		"":    "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc": "a448017aaf21d8525fc10ae87aa6729d",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	} {
+		if got := hex.EncodeToString(md4Sum([]byte(in))); got != out {
+			t.Errorf("Invalid MD4 of %q: %s", in, got)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ts := newAuthTestServer()
+	defer ts.Close()
+	other := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		path string
+		auth Auth
+	}{
+		{"/basic", BasicAuth("user", "pass")},
+		{"/redirect?to=/basic", BasicAuth("user", "pass")},
+		{"/bearer", &BearerAuth{Token: "old", Refresh: func() (string, error) { return "new", nil }}},
+		{"/digest", DigestAuth("user", "pass")},
+		{"/redirect?to=/digest", DigestAuth("user", "pass")},
+		{"/ntlm", NTLMAuth("DOMAIN", "user", "pass")},
+	}
+	for _, tt := range tests {
+		c := NewCollector()
+		c.SetAuth("127.0.0.1", tt.auth)
+		status := 0
+		c.OnResponse(func(r *Response) {
+			status = r.StatusCode
+		})
+		c.OnError(func(r *Response, err error) {
+			status = r.StatusCode
+		})
+		c.Visit(ts.URL + tt.path)
+		if status != 200 {
+			t.Errorf("Invalid status code %d of %s", status, tt.path)
+		}
+		// the digest challenge is reused by later requests
+		if _, ok := tt.auth.(*digestAuth); ok {
+			status = 0
+			c.Visit(ts.URL + "/digest?second")
+			if status != 200 {
+				t.Errorf("Invalid status code %d of second digest request", status)
+			}
+		}
+	}
+
+	c := NewCollector()
+	c.SetAuth("*.0.0.1", BasicAuth("user", "pass"))
+	var header string
+	c.OnResponse(func(r *Response) {
+		header = string(r.Body)
+	})
+	c.Visit(ts.URL + "/redirect?to=" + other + "/header")
+	if header != "" {
+		t.Errorf("Credentials were sent to another domain: %q", header)
+	}
+	c.SetAuth("", BasicAuth("a", "b"))
+	c.Visit(other + "/header")
+	if header != "Basic "+base64.StdEncoding.EncodeToString([]byte("a:b")) {
+		t.Errorf("Invalid default credentials %q", header)
+	}
+	c.SetAuth("", nil)
+	c.Visit(other + "/header?2")
+	if header != "" {
+		t.Errorf("Removed credentials were sent: %q", header)
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	h := http.Header{"Www-Authenticate": []string{`Basic realm="x"`, `Digest realm="a \"b\", c", nonce=123 , qop="auth"`}}
+	params := parseAuthChallenge(h, "Digest")
+	if fmt.Sprint(params) != `map[nonce:123 qop:auth realm:a "b", c]` {
+		t.Errorf("Invalid challenge %v", params)
+	}
+	if parseAuthChallenge(h, "NTLM") != nil {
+		t.Error("Invalid challenge of missing scheme")
+	}
+}
+
+// closeTrackingTransport records whether the bodies of the responses
+// were closed
+type closeTrackingTransport struct {
+	bodies []*closeTrackingBody
+}
+
+type closeTrackingBody struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return b.ReadCloser.Close()
+}
+
+func (t *closeTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b := &closeTrackingBody{ReadCloser: res.Body}
+	t.bodies = append(t.bodies, b)
+	res.Body = b
+	return res, nil
+}
+
+func TestAuthChallengeError(t *testing.T) {
+	ts := newAuthTestServer()
+	defer ts.Close()
+
+	refreshErr := errors.New("refresh failed")
+	transport := &closeTrackingTransport{}
+	c := NewCollector()
+	c.WithTransport(transport)
+	c.SetAuth("127.0.0.1", &BearerAuth{Token: "old", Refresh: func() (string, error) { return "", refreshErr }})
+	if err := c.Visit(ts.URL + "/bearer"); err != refreshErr {
+		t.Errorf("Expected the error of Refresh, got %v", err)
+	}
+	if len(transport.bodies) != 1 || !transport.bodies[0].closed {
+		t.Error("Body of the challenged response was not closed")
+	}
+}
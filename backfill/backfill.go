@@ -0,0 +1,224 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backfill recrawls the sources of the incomplete records of a
+// previous run. It reads the JSONL or CSV output of the run, selects the
+// records missing some of the required fields and revisits their source
+// URLs:
+//
+//	b := backfill.New("url", "title", "price")
+//	n, err := b.Run(c, "products.jsonl")
+package backfill
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrUnknownFormat is the error returned for files which are neither
+// JSONL nor CSV
+var ErrUnknownFormat = errors.New("Unknown output format")
+
+// ErrMissingURLField is the error returned when the header of a CSV
+// file has no URL column
+var ErrMissingURLField = errors.New("Missing URL field")
+
+// Backfill selects the records to recrawl
+type Backfill struct {
+	// URLField is the name of the field containing the source URL of
+	// the records. Nested JSON fields are separated by dots, e.g.
+	// "meta.url".
+	URLField string
+	// Required are the fields expected in every record. Records with
+	// missing, null or empty required fields are recrawled.
+	Required []string
+}
+
+// New creates a Backfill of the records having the URL field and the
+// required fields
+func New(urlField string, required ...string) *Backfill {
+	return &Backfill{
+		URLField: urlField,
+		Required: required,
+	}
+}
+
+// Run recrawls the source URLs of the incomplete records of an output
+// file by Collector.Revisit and returns the number of the visited URLs.
+// Run waits for the visits of asynchronous collectors. The visits are
+// continued after errors, the first error is returned.
+func (b *Backfill) Run(c *colly.Collector, path string) (int, error) {
+	urls, err := b.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var firstErr error
+	for _, u := range urls {
+		if err := c.Revisit(u); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.Async {
+		c.Wait()
+	}
+	return len(urls), firstErr
+}
+
+// ReadFile returns the source URLs of the incomplete records of a JSONL
+// (.jsonl, .ndjson, .json) or CSV (.csv) file
+func (b *Backfill) ReadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson", ".json":
+		return b.ReadJSONL(f)
+	case ".csv":
+		return b.ReadCSV(f)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ReadJSONL returns the source URLs of the incomplete records of JSON
+// objects separated by newlines
+func (b *Backfill) ReadJSONL(r io.Reader) ([]string, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	urls := newURLSet()
+	for n := 1; ; n++ {
+		var record map[string]interface{}
+		if err := d.Decode(&record); err != nil {
+			if err == io.EOF {
+				return urls.list, nil
+			}
+			return nil, fmt.Errorf("record %d: %v", n, err)
+		}
+		u, _ := lookup(record, b.urlField()).(string)
+		if u == "" {
+			continue
+		}
+		for _, f := range b.Required {
+			if isEmpty(lookup(record, f)) {
+				urls.add(u)
+				break
+			}
+		}
+	}
+}
+
+// ReadCSV returns the source URLs of the incomplete records of a CSV
+// file with a header row
+func (b *Backfill) ReadCSV(r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	urlColumn, ok := columns[b.urlField()]
+	if !ok {
+		return nil, ErrMissingURLField
+	}
+	urls := newURLSet()
+	for {
+		row, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return urls.list, nil
+			}
+			return nil, err
+		}
+		if urlColumn >= len(row) || row[urlColumn] == "" {
+			continue
+		}
+		for _, f := range b.Required {
+			i, ok := columns[f]
+			if !ok || i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				urls.add(row[urlColumn])
+				break
+			}
+		}
+	}
+}
+
+func (b *Backfill) urlField() string {
+	if b.URLField == "" {
+		return "url"
+	}
+	return b.URLField
+}
+
+// lookup returns the value of a dot separated field path of a record
+func lookup(record map[string]interface{}, path string) interface{} {
+	if v, ok := record[path]; ok {
+		return v
+	}
+	var v interface{} = record
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// urlSet is a list of unique URLs
+type urlSet struct {
+	list []string
+	seen map[string]bool
+}
+
+func newURLSet() *urlSet {
+	return &urlSet{seen: make(map[string]bool)}
+}
+
+func (s *urlSet) add(u string) {
+	if !s.seen[u] {
+		s.seen[u] = true
+		s.list = append(s.list, u)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backfill
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const jsonlOutput = `{"url": "http://example.com/1", "title": "One", "price": 1}
+{"url": "http://example.com/2", "title": "", "price": 2}
+{"url": "http://example.com/3", "title": "Three", "price": null}
+{"url": "http://example.com/2", "title": "Two"}
+{"title": "No URL"}
+{"url": "http://example.com/4", "title": "Four", "price": 0}
+`
+
+func TestReadJSONL(t *testing.T) {
+	b := New("url", "title", "price")
+	urls, err := b.ReadJSONL(strings.NewReader(jsonlOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http://example.com/2", "http://example.com/3"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Unexpected URLs: %v", urls)
+	}
+
+	b = New("meta.source", "offers.price")
+	urls, err = b.ReadJSONL(strings.NewReader(`{"meta": {"source": "http://example.com/a"}, "offers": {"price": "1"}}
+{"meta": {"source": "http://example.com/b"}, "offers": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(urls, []string{"http://example.com/b"}) {
+		t.Errorf("Unexpected URLs of nested fields: %v", urls)
+	}
+
+	if _, err := b.ReadJSONL(strings.NewReader("{}\n{invalid")); err == nil || !strings.HasPrefix(err.Error(), "record 2:") {
+		t.Errorf("Invalid error: %v", err)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	b := New("", "title", "price")
+	urls, err := b.ReadCSV(strings.NewReader("url,title,price\nhttp://example.com/1,One,1\nhttp://example.com/2, ,2\nhttp://example.com/3,Three\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(urls, []string{"http://example.com/2", "http://example.com/3"}) {
+		t.Errorf("Unexpected URLs: %v", urls)
+	}
+	if _, err := New("link").ReadCSV(strings.NewReader("url\n")); err != ErrMissingURLField {
+		t.Errorf("Expected ErrMissingURLField, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "colly_backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.jsonl")
+	output := strings.Replace(jsonlOutput, "http://example.com", ts.URL, -1)
+	if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := colly.NewCollector(colly.Async(true))
+	c.Visit(ts.URL + "/2")
+	c.Wait()
+	var lock sync.Mutex
+	var visited []string
+	c.OnResponse(func(r *colly.Response) {
+		lock.Lock()
+		visited = append(visited, r.Request.URL.Path)
+		lock.Unlock()
+	})
+	n, err := New("url", "title", "price").Run(c, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(visited)
+	if n != 2 || !reflect.DeepEqual(visited, []string{"/2", "/3"}) {
+		t.Errorf("Unexpected visits %d: %v", n, visited)
+	}
+	if _, err := New("url").ReadFile(filepath.Join(dir, "out.xml")); err == nil {
+		t.Error("Missing error")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Bandwidth limits the download speed of all the responses of the
+// Collector in bytes per second. See SetBandwidth.
+func Bandwidth(bytesPerSecond int) CollectorOption {
+	return func(c *Collector) {
+		c.SetBandwidth(bytesPerSecond)
+	}
+}
+
+// SetBandwidth limits the download speed of all the responses of the
+// Collector in bytes per second, e.g. to crawl over constrained links.
+// LimitRule.Bandwidth limits the download speed of the hosts separately.
+// The limit is shared with the clones of the Collector. Passing 0
+// removes the limit.
+//
+// The request timeout covers the throttled downloads too, so it may
+// have to be raised.
+func (c *Collector) SetBandwidth(bytesPerSecond int) {
+	c.backend.lock.Lock()
+	defer c.backend.lock.Unlock()
+	if bytesPerSecond <= 0 {
+		c.backend.bandwidth = nil
+		return
+	}
+	c.backend.bandwidth = &bandwidthLimiter{rate: bytesPerSecond}
+}
+
+// bandwidthLimiter limits the download speed of the responses sharing it
+type bandwidthLimiter struct {
+	lock sync.Mutex
+	rate int
+	// next is the time when the bytes received so far are allowed by
+	// the rate
+	next time.Time
+}
+
+// reserve records n received bytes and returns the time to wait to
+// keep the rate. Unused bandwidth of idle periods is not accumulated.
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	return l.next.Sub(now)
+}
+
+// throttledReader reads a response body within the bandwidth of its
+// limiters
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*bandwidthLimiter
+	// chunk is the size of the reads, a tenth of the lowest rate, to
+	// keep the download speed smooth
+	chunk int
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n, err := r.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	wait := time.Duration(0)
+	for _, l := range r.limiters {
+		if d := l.reserve(n); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// throttle limits the download speed of a response body of the URL by
+// the Bandwidth of the LimitRule of the URL and by the bandwidth of
+// the backend
+func (h *httpBackend) throttle(ctx context.Context, u *url.URL, r io.Reader) io.Reader {
+	var limiters []*bandwidthLimiter
+	if rule := h.matchingURLRule(u); rule != nil && rule.Bandwidth > 0 {
+		limiters = append(limiters, h.hostBandwidth(queueKey{host: u.Host, rule: rule}))
+	}
+	h.lock.RLock()
+	if h.bandwidth != nil {
+		limiters = append(limiters, h.bandwidth)
+	}
+	h.lock.RUnlock()
+	if len(limiters) == 0 {
+		return r
+	}
+	t := &throttledReader{ctx: ctx, r: r, limiters: limiters}
+	for _, l := range limiters {
+		if c := l.rate / 10; t.chunk == 0 || c < t.chunk {
+			t.chunk = c
+		}
+	}
+	if t.chunk < 1 {
+		t.chunk = 1
+	}
+	return t
+}
+
+// hostBandwidth returns the limiter of the host and the rule, which is
+// shared by the concurrent responses of the host matching the rule
+func (h *httpBackend) hostBandwidth(key queueKey) *bandwidthLimiter {
+	rate := key.rule.Bandwidth
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.hostBandwidths == nil {
+		h.hostBandwidths = make(map[queueKey]*bandwidthLimiter)
+	}
+	l, ok := h.hostBandwidths[key]
+	if !ok {
+		l = &bandwidthLimiter{rate: rate}
+		h.hostBandwidths[key] = l
+	}
+	l.lock.Lock()
+	l.rate = rate
+	l.lock.Unlock()
+	return l
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newBandwidthTestServer(size int) *httptest.Server {
+	body := bytes.Repeat([]byte("x"), size)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	l := &bandwidthLimiter{rate: 1000}
+	if d := l.reserve(500); d < 490*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("Invalid wait: %v", d)
+	}
+	if d := l.reserve(500); d < 990*time.Millisecond || d > time.Second {
+		t.Errorf("Invalid wait of the second reservation: %v", d)
+	}
+}
+
+func TestLimitRuleBandwidth(t *testing.T) {
+	ts := newBandwidthTestServer(10000)
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit())
+	c.Limit(&LimitRule{DomainGlob: "*", Bandwidth: 50000})
+	var size int
+	c.OnResponse(func(r *Response) {
+		size = len(r.Body)
+	})
+	start := time.Now()
+	if err := c.Visit(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Download was not throttled: %v", elapsed)
+	}
+	if size != 10000 {
+		t.Errorf("Invalid body size: %d", size)
+	}
+
+	c.SetRequestTimeout(50 * time.Millisecond)
+	if err := c.Visit(ts.URL); err == nil {
+		t.Error("Throttled download did not time out")
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	ts := newBandwidthTestServer(5000)
+	defer ts.Close()
+
+	c := NewCollector(Async(), AllowURLRevisit(), Bandwidth(50000))
+	responses := 0
+	c.OnResponse(func(r *Response) {
+		responses++
+	})
+	start := time.Now()
+	// the concurrent responses share the bandwidth
+	c.Visit(ts.URL)
+	c.Clone().Visit(ts.URL)
+	c.Wait()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Downloads were not throttled: %v", elapsed)
+	}
+
+	c.SetBandwidth(0)
+	start = time.Now()
+	c.Visit(ts.URL)
+	c.Wait()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Bandwidth limit was not removed: %v", elapsed)
+	}
+	if responses != 2 {
+		t.Errorf("Invalid number of responses: %d", responses)
+	}
+}
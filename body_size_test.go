@@ -0,0 +1,97 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newBodySizeServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	})
+	mux.HandleFunc("/exact", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 10)))
+	})
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		for i := 0; i < 100; i++ {
+			gw.Write([]byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", i)))
+		}
+		gw.Close()
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	ts := newBodySizeServer()
+	defer ts.Close()
+
+	c := NewCollector(MaxBodySize(10))
+	var errResponse *Response
+	c.OnError(func(r *Response, err error) {
+		errResponse = r
+	})
+	responses := 0
+	c.OnResponse(func(r *Response) {
+		responses++
+	})
+	for _, path := range []string{"/plain", "/gzip"} {
+		errResponse = nil
+		if err := c.Visit(ts.URL + path); err != ErrBodyTooLarge {
+			t.Errorf("Expected ErrBodyTooLarge for %s, got %v", path, err)
+		}
+		if errResponse == nil || !errResponse.Truncated {
+			t.Errorf("Truncated response of %s was not passed to OnError", path)
+		}
+	}
+	if err := c.Visit(ts.URL + "/exact"); err != nil {
+		t.Errorf("Body of the size limit failed: %v", err)
+	}
+	if responses != 1 {
+		t.Errorf("Unexpected number of processed responses: %d", responses)
+	}
+}
+
+func TestAllowTruncatedBody(t *testing.T) {
+	ts := newBodySizeServer()
+	defer ts.Close()
+
+	c := NewCollector(MaxBodySize(10), AllowTruncatedBody())
+	bodies := map[string]*Response{}
+	c.OnResponse(func(r *Response) {
+		bodies[r.Request.URL.Path] = r
+	})
+	for _, path := range []string{"/plain", "/exact", "/gzip"} {
+		if err := c.Visit(ts.URL + path); err != nil {
+			t.Errorf("Visiting %s failed: %v", path, err)
+		}
+	}
+	if r := bodies["/plain"]; r == nil || !r.Truncated || string(r.Body) != strings.Repeat("a", 10) {
+		t.Errorf("Invalid truncated response: %+v", r)
+	}
+	if r := bodies["/exact"]; r == nil || r.Truncated {
+		t.Errorf("Complete response was truncated: %+v", r)
+	}
+	if r := bodies["/gzip"]; r == nil || !r.Truncated {
+		t.Errorf("Compressed response was not truncated: %+v", r)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Capture selects the captures of the rendered page of a request. See
+// Request.Capture.
+type Capture int
+
+const (
+	// CaptureScreenshot captures a full-page PNG screenshot
+	CaptureScreenshot Capture = 1 << iota
+	// CapturePDF captures the page printed to PDF
+	CapturePDF
+)
+
+// SaveCaptures writes the captures of the response to the files named
+// by the template. The "{id}", "{host}" and "{name}" placeholders of
+// the template are replaced by the ID of the request, the host name of
+// its URL and the FileName of the response without extension, and the
+// ".png" or ".pdf" extension is appended, e.g. "captures/{host}-{name}"
+// saves the screenshot of https://example.com/page.html as
+// captures/example.com-page.png. Responses without captures are not
+// saved.
+func (r *Response) SaveCaptures(template string) error {
+	fileName := r.FileName()
+	name := strings.NewReplacer(
+		"{id}", fmt.Sprint(r.Request.ID),
+		"{host}", r.Request.URL.Hostname(),
+		"{name}", strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+	).Replace(template)
+	if r.Screenshot != nil {
+		if err := ioutil.WriteFile(name+".png", r.Screenshot, 0644); err != nil {
+			return err
+		}
+	}
+	if r.PDF != nil {
+		if err := ioutil.WriteFile(name+".pdf", r.PDF, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
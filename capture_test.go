@@ -0,0 +1,74 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colly-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewCollector()
+	// the Fetcher stands in for a headless browser
+	c.SetFetcher(FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		res := &Response{
+			StatusCode: 200,
+			Headers:    &http.Header{"Content-Type": []string{"text/html"}},
+			Body:       []byte("<p>page</p>"),
+		}
+		if r.Capture&CaptureScreenshot != 0 {
+			res.Screenshot = []byte("png")
+		}
+		if r.Capture&CapturePDF != 0 {
+			res.PDF = []byte("pdf")
+		}
+		return res, nil
+	}))
+	c.OnRequest(func(r *Request) {
+		if r.URL.Path == "/shot.html" {
+			r.Capture = CaptureScreenshot
+		}
+	})
+	captured := map[string]bool{}
+	c.OnResponse(func(r *Response) {
+		captured[r.Request.URL.Path] = r.Screenshot != nil || r.PDF != nil
+		if err := r.SaveCaptures(filepath.Join(dir, "{host}-{name}")); err != nil {
+			t.Error(err)
+		}
+	})
+	c.Visit("http://example.com/shot.html")
+	c.Visit("http://example.com/plain")
+
+	if !captured["/shot.html"] || captured["/plain"] {
+		t.Errorf("Unexpected captures: %v", captured)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "example.com-shot.png")); err != nil || string(b) != "png" {
+		t.Errorf("Screenshot was not saved: %q, %v", b, err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Unexpected saved captures: %d files", len(files))
+	}
+}
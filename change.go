@@ -0,0 +1,103 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// ChangeCallback is a type alias for OnChange callback functions.
+// oldHash and newHash are the previous and the current content hashes
+// of the page.
+type ChangeCallback func(r *Response, oldHash, newHash string)
+
+// WatchChanges enables the change detection of the visited pages. The
+// content hash of every response is stored in the storage of the
+// Collector if it implements storage.ContentHashStorage, and the
+// OnChange callbacks are called if the hash of a revisited URL differs.
+// If selector is not empty, only the text of the matching elements of
+// HTML pages is hashed, so changes of ads or timestamps outside of them
+// are ignored. Use it with AllowURLRevisit or a persistent storage.
+func WatchChanges(selector string) CollectorOption {
+	return func(c *Collector) {
+		c.WatchChanges = true
+		c.ChangeSelector = selector
+	}
+}
+
+// OnChange registers a function. Function will be executed on every
+// response whose content hash differs from the hash of the previous
+// visit of its URL. See WatchChanges.
+func (c *Collector) OnChange(f ChangeCallback) {
+	c.lock.Lock()
+	if c.changeCallbacks == nil {
+		c.changeCallbacks = make([]ChangeCallback, 0, 4)
+	}
+	c.changeCallbacks = append(c.changeCallbacks, f)
+	c.lock.Unlock()
+}
+
+// ContentHash returns the SHA-256 hash of the body of the response, or
+// of the whitespace normalized text of the elements matching the
+// selector if the response is a HTML page and selector is not empty
+func ContentHash(r *Response, selector string) string {
+	content := r.Body
+	if selector != "" && r.Headers != nil && strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body)); err == nil {
+			texts := doc.Find(selector).Map(func(_ int, s *goquery.Selection) string {
+				return strings.Join(strings.Fields(s.Text()), " ")
+			})
+			content = []byte(strings.Join(texts, "\n"))
+		}
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkChange stores the content hash of the response and calls the
+// OnChange callbacks if it differs from the stored hash
+func (c *Collector) checkChange(r *Response) {
+	s, ok := c.store.(storage.ContentHashStorage)
+	if !ok {
+		return
+	}
+	u := r.Request.URL.String()
+	newHash := ContentHash(r, c.ChangeSelector)
+	oldHash, err := s.GetContentHash(u)
+	if err != nil || oldHash == newHash {
+		return
+	}
+	if err := s.SetContentHash(u, newHash); err != nil {
+		return
+	}
+	if oldHash == "" {
+		return
+	}
+	if c.debugger != nil {
+		c.debugger.Event(createEvent("change", r.Request.ID, c.ID, map[string]string{
+			"url": u,
+		}))
+	}
+	for _, f := range c.changeCallbacks {
+		f(r, oldHash, newHash)
+	}
+}
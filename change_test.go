@@ -0,0 +1,81 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type changingPage struct {
+	lock    sync.Mutex
+	price   string
+	visitor string
+}
+
+func (p *changingPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(`<html><body><p>Visitor ` + p.visitor + `</p><span class="price">` + p.price + `</span></body></html>`))
+}
+
+func (p *changingPage) set(price, visitor string) {
+	p.lock.Lock()
+	p.price, p.visitor = price, visitor
+	p.lock.Unlock()
+}
+
+func TestWatchChanges(t *testing.T) {
+	page := &changingPage{price: "10", visitor: "1"}
+	ts := httptest.NewServer(page)
+	defer ts.Close()
+
+	for _, selector := range []string{"", ".price"} {
+		c := NewCollector(AllowURLRevisit(), WatchChanges(selector))
+		changes := 0
+		var oldHash, newHash string
+		c.OnChange(func(r *Response, o, n string) {
+			changes++
+			oldHash, newHash = o, n
+		})
+		page.set("10", "1")
+		c.Visit(ts.URL)
+		if changes != 0 {
+			t.Errorf("First visit was reported as change")
+		}
+		// the visitor counter is ignored by the selector
+		page.set("10", "2")
+		c.Visit(ts.URL)
+		expected := 1
+		if selector != "" {
+			expected = 0
+		}
+		if changes != expected {
+			t.Errorf("Unexpected changes %d with selector %q", changes, selector)
+		}
+		page.set("12", "2")
+		c.Visit(ts.URL)
+		c.Visit(ts.URL)
+		if changes != expected+1 {
+			t.Errorf("Price change was not reported with selector %q", selector)
+		}
+		if oldHash == newHash || len(newHash) != 64 {
+			t.Errorf("Invalid hashes %q %q", oldHash, newHash)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// maxSelectorCandidates limits the number of repeating element
+// selectors emitted into the generated scraper
+const maxSelectorCandidates = 8
+
+var cssIdentRe = regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*$`)
+
+var paginationTexts = map[string]bool{
+	"next":      true,
+	"next page": true,
+	"next »":    true,
+	"»":         true,
+	"›":         true,
+	">":         true,
+	"more":      true,
+	"older":     true,
+}
+
+type pageAnalysis struct {
+	URL        string
+	Host       string
+	Title      string
+	Selectors  []*selectorCandidate
+	Forms      []*formCandidate
+	Pagination []string
+}
+
+type selectorCandidate struct {
+	Selector string
+	Count    int
+	Sample   string
+}
+
+type formCandidate struct {
+	Action string
+	Method string
+	Fields []string
+}
+
+// analyzePage downloads a page and collects the selectors of repeating
+// elements, forms and pagination links found on it
+func analyzePage(u string) (*pageAnalysis, error) {
+	c := colly.NewCollector()
+	var a *pageAnalysis
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		a = analyzeDocument(e)
+	})
+	if err := c.Visit(u); err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("%s did not return an HTML document", u)
+	}
+	return a, nil
+}
+
+func analyzeDocument(e *colly.HTMLElement) *pageAnalysis {
+	a := &pageAnalysis{
+		URL:   e.Request.URL.String(),
+		Host:  e.Request.URL.Hostname(),
+		Title: strings.TrimSpace(e.DOM.Find("title").First().Text()),
+	}
+
+	counts := map[string]*selectorCandidate{}
+	e.DOM.Find("body [class]").Each(func(_ int, s *goquery.Selection) {
+		tag := goquery.NodeName(s)
+		if tag == "script" || tag == "style" || tag == "noscript" {
+			return
+		}
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" {
+			return
+		}
+		for _, class := range strings.Fields(s.AttrOr("class", "")) {
+			if !cssIdentRe.MatchString(class) {
+				continue
+			}
+			sel := tag + "." + class
+			if sc, ok := counts[sel]; ok {
+				sc.Count++
+				continue
+			}
+			counts[sel] = &selectorCandidate{Selector: sel, Count: 1, Sample: sampleText(text, 60)}
+		}
+	})
+	for _, sc := range counts {
+		if sc.Count >= 3 {
+			a.Selectors = append(a.Selectors, sc)
+		}
+	}
+	sort.Slice(a.Selectors, func(i, j int) bool {
+		if a.Selectors[i].Count == a.Selectors[j].Count {
+			return a.Selectors[i].Selector < a.Selectors[j].Selector
+		}
+		return a.Selectors[i].Count > a.Selectors[j].Count
+	})
+	if len(a.Selectors) > maxSelectorCandidates {
+		a.Selectors = a.Selectors[:maxSelectorCandidates]
+	}
+
+	e.DOM.Find("form").Each(func(_ int, s *goquery.Selection) {
+		f := &formCandidate{
+			Action: e.Request.AbsoluteURL(s.AttrOr("action", "")),
+			Method: strings.ToUpper(s.AttrOr("method", "GET")),
+		}
+		if f.Action == "" {
+			f.Action = a.URL
+		}
+		s.Find("input[name], select[name], textarea[name]").Each(func(_ int, i *goquery.Selection) {
+			f.Fields = append(f.Fields, i.AttrOr("name", ""))
+		})
+		a.Forms = append(a.Forms, f)
+	})
+
+	pagination := map[string]bool{}
+	addPagination := func(sel string) {
+		if !pagination[sel] {
+			pagination[sel] = true
+			a.Pagination = append(a.Pagination, sel)
+		}
+	}
+	if e.DOM.Find("link[rel=next][href]").Length() > 0 {
+		addPagination("link[rel=next]")
+	}
+	if e.DOM.Find("a[rel=next][href]").Length() > 0 {
+		addPagination("a[rel=next]")
+	}
+	e.DOM.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		for _, class := range strings.Fields(s.AttrOr("class", "")) {
+			if cssIdentRe.MatchString(class) && strings.Contains(strings.ToLower(class), "next") {
+				addPagination("a." + class)
+				return
+			}
+		}
+		if paginationTexts[strings.ToLower(strings.TrimSpace(s.Text()))] {
+			if p := s.Closest("[class]"); p.Length() > 0 {
+				for _, class := range strings.Fields(p.AttrOr("class", "")) {
+					if cssIdentRe.MatchString(class) {
+						addPagination(goquery.NodeName(p) + "." + class + " a")
+						return
+					}
+				}
+			}
+		}
+	})
+	return a
+}
+
+// sampleText shortens the text to n characters
+func sampleText(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n]) + "..."
+}
+
+// writeReport prints the detected candidates in a human readable format
+func (a *pageAnalysis) writeReport(w io.Writer) {
+	fmt.Fprintf(w, "Analyzed %s (%q)\n", a.URL, a.Title)
+	fmt.Fprintf(w, "Repeating elements:\n")
+	for _, s := range a.Selectors {
+		fmt.Fprintf(w, "  %-40s %4d  %q\n", s.Selector, s.Count, s.Sample)
+	}
+	fmt.Fprintf(w, "Forms:\n")
+	for _, f := range a.Forms {
+		fmt.Fprintf(w, "  %s %s %v\n", f.Method, f.Action, f.Fields)
+	}
+	fmt.Fprintf(w, "Pagination:\n")
+	for _, p := range a.Pagination {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+}
+
+// writeCallbacks appends OnHTML callbacks and commented form submissions
+// based on the analysis to the generated scraper
+func (a *pageAnalysis) writeCallbacks(scraper *bytes.Buffer) {
+	for _, s := range a.Selectors {
+		scraper.WriteString(fmt.Sprintf(`
+	// %d matches, e.g. %q
+	c.OnHTML(%q, func(e *colly.HTMLElement) {
+		log.Println(e.Text)
+	})
+`, s.Count, s.Sample, s.Selector))
+	}
+	for _, p := range a.Pagination {
+		scraper.WriteString(fmt.Sprintf(`
+	// pagination
+	c.OnHTML(%q, func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+`, p+"[href]"))
+	}
+	for _, f := range a.Forms {
+		scraper.WriteString(fmt.Sprintf("\n\t// form: %s %s\n", f.Method, f.Action))
+		if f.Method != "POST" {
+			continue
+		}
+		scraper.WriteString(fmt.Sprintf("\t// c.Post(%q, map[string]string{\n", f.Action))
+		for _, field := range f.Fields {
+			scraper.WriteString(fmt.Sprintf("\t// \t%q: \"\",\n", field))
+		}
+		scraper.WriteString("\t// })\n")
+	}
+}
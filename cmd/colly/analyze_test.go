@@ -0,0 +1,85 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const analyzePageHTML = `<html><head><title>Products</title></head><body>
+<ul>
+<li class="product"><span class="price">1</span> First</li>
+<li class="product"><span class="price">2</span> Second</li>
+<li class="product"><span class="price">3</span> Third</li>
+<li class="product"><span class="price">4</span> Fourth</li>
+</ul>
+<div class="banner">Sale</div>
+<div class="banner">Sale</div>
+<form action="/search" method="post"><input name="q"><select name="sort"></select></form>
+<div class="pager"><a href="/2">Next</a></div>
+</body></html>`
+
+func TestAnalyzePage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(analyzePageHTML))
+	}))
+	defer ts.Close()
+
+	a, err := analyzePage(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Products" {
+		t.Errorf("Invalid title: %q", a.Title)
+	}
+	var selectors []string
+	for _, s := range a.Selectors {
+		selectors = append(selectors, s.Selector)
+	}
+	// the banners do not repeat enough to be suggested
+	if !reflect.DeepEqual(selectors, []string{"li.product", "span.price"}) {
+		t.Errorf("Unexpected selectors: %v", selectors)
+	}
+	if a.Selectors[0].Count != 4 || a.Selectors[0].Sample != "1 First" {
+		t.Errorf("Unexpected selector candidate: %+v", a.Selectors[0])
+	}
+	if len(a.Forms) != 1 || a.Forms[0].Method != "POST" || a.Forms[0].Action != ts.URL+"/search" ||
+		!reflect.DeepEqual(a.Forms[0].Fields, []string{"q", "sort"}) {
+		t.Errorf("Unexpected forms: %+v", a.Forms)
+	}
+	if !reflect.DeepEqual(a.Pagination, []string{"div.pager a"}) {
+		t.Errorf("Unexpected pagination: %v", a.Pagination)
+	}
+}
+
+func TestSampleText(t *testing.T) {
+	if s := sampleText("short", 60); s != "short" {
+		t.Errorf("Short text was changed: %q", s)
+	}
+	text := strings.Repeat("árvíztűrő ", 10)
+	s := sampleText(text, 60)
+	if !utf8.ValidString(s) {
+		t.Errorf("Invalid UTF-8 sample: %q", s)
+	}
+	if !strings.HasSuffix(s, "...") || utf8.RuneCountInString(s) != 63 {
+		t.Errorf("Invalid truncation: %q", s)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/gocolly/colly/v2/har"
 	"github.com/jawher/mow.cli"
 )
 
@@ -37,7 +38,7 @@ func main() {
 `
 
 var scraperEndTemplate = `
-	c.Visit("https://yourdomain.com/")
+	c.Visit(%q)
 }
 `
 
@@ -72,12 +73,31 @@ func main() {
 		var (
 			callbacks = cmd.StringOpt("callbacks", "", "Add callbacks to the template. (E.g. '--callbacks=html,response,error')")
 			hosts     = cmd.StringOpt("hosts", "", "Specify scraper's allowed hosts. (e.g. '--hosts=xy.com,abcd.com')")
-			path      = cmd.StringArg("PATH", "", "Path of the new scraper")
+			pageURL   = cmd.StringOpt("url", "", "Generate callbacks by analyzing the page. (e.g. '--url=https://xy.com/')")
+			path      = cmd.StringArg("PATH", "", "Path of the new scraper. If PATH is an URL, it is analyzed like --url and the scraper is written to STDOUT")
 		)
 
-		cmd.Spec = "[--callbacks] [--hosts] [PATH]"
+		cmd.Spec = "[--callbacks] [--hosts] [--url] [PATH]"
 
 		cmd.Action = func() {
+			if strings.HasPrefix(*path, "http://") || strings.HasPrefix(*path, "https://") {
+				*pageURL = *path
+				*path = ""
+			}
+			startURL := "https://yourdomain.com/"
+			var analysis *pageAnalysis
+			if *pageURL != "" {
+				var err error
+				analysis, err = analyzePage(*pageURL)
+				if err != nil {
+					log.Fatal(err)
+				}
+				analysis.writeReport(os.Stderr)
+				startURL = analysis.URL
+				if *hosts == "" {
+					*hosts = analysis.Host
+				}
+			}
 			scraper := bytes.NewBufferString(scraperHeadTemplate)
 			outfile := os.Stdout
 			if *path != "" {
@@ -112,10 +132,42 @@ func main() {
 					}
 				}
 			}
-			scraper.WriteString(scraperEndTemplate)
+			if analysis != nil {
+				analysis.writeCallbacks(scraper)
+			}
+			scraper.WriteString(fmt.Sprintf(scraperEndTemplate, startURL))
 			outfile.Write(scraper.Bytes())
 		}
 	})
 
+	app.Command("fixtures", "Generate a mock site of a HAR recording for tests", func(cmd *cli.Cmd) {
+		var (
+			pkg      = cmd.StringOpt("package", "main", "Package of the generated file")
+			funcName = cmd.StringOpt("func", "newMockSite", "Name of the generated function")
+			harFile  = cmd.StringArg("HAR", "", "HAR file of the recorded crawl")
+			path     = cmd.StringArg("PATH", "", "Path of the generated Go file. The file is written to STDOUT if PATH is empty")
+		)
+
+		cmd.Spec = "[--package] [--func] HAR [PATH]"
+
+		cmd.Action = func() {
+			h, err := har.Load(*harFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			outfile := os.Stdout
+			if *path != "" {
+				outfile, err = os.Create(*path)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer outfile.Close()
+			}
+			if err := writeFixtures(outfile, h, *pkg, *funcName); err != nil {
+				log.Fatal(err)
+			}
+		}
+	})
+
 	app.Run(os.Args)
 }
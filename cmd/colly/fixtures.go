@@ -0,0 +1,101 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/gocolly/colly/v2/collytest"
+	"github.com/gocolly/colly/v2/har"
+)
+
+var fixturesHeadTemplate = `// Code generated by "colly fixtures"; DO NOT EDIT.
+
+package %s
+
+import (
+%s	"github.com/gocolly/colly/v2/collytest"
+)
+
+// %s starts a test site serving the recorded crawl
+func %s() *collytest.Site {
+	site := collytest.NewSite()
+`
+
+// writeFixtures generates a Go source file containing a function which
+// starts a collytest.Site serving the responses of a HAR recording
+func writeFixtures(w io.Writer, h *har.HAR, pkg, funcName string) error {
+	fixtures, err := collytest.HARFixtures(h)
+	if err != nil {
+		return err
+	}
+	if err := collytest.CheckFixturePaths(fixtures); err != nil {
+		return err
+	}
+	imports := ""
+	for _, f := range fixtures {
+		if f.Page.Delay > 0 {
+			imports = "\t\"time\"\n\n"
+			break
+		}
+	}
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, fixturesHeadTemplate, pkg, imports, funcName, funcName)
+	origins := make(map[string]bool)
+	for _, f := range fixtures {
+		origins[f.Origin()] = true
+		fmt.Fprintf(src, "\tsite.Page(%q)", f.Path())
+		if f.Page.Status != 200 {
+			fmt.Fprintf(src, ".\n\t\tWithStatus(%d)", f.Page.Status)
+		}
+		keys := make([]string, 0, len(f.Page.Headers))
+		for k := range f.Page.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range f.Page.Headers[k] {
+				fmt.Fprintf(src, ".\n\t\tWithHeader(%q, %q)", k, v)
+			}
+		}
+		if f.Page.Delay > 0 {
+			fmt.Fprintf(src, ".\n\t\tWithDelay(%d * time.Millisecond)", f.Page.Delay/time.Millisecond)
+		}
+		if len(f.Page.Body) > 0 {
+			fmt.Fprintf(src, ".\n\t\tWithBody(%q)", f.Page.Body)
+		}
+		src.WriteString("\n")
+	}
+	sortedOrigins := make([]string, 0, len(origins))
+	for o := range origins {
+		sortedOrigins = append(sortedOrigins, o)
+	}
+	sort.Strings(sortedOrigins)
+	for _, o := range sortedOrigins {
+		fmt.Fprintf(src, "\tsite.RewriteOrigin(%q)\n", o)
+	}
+	src.WriteString("\treturn site\n}\n")
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formatted)
+	return err
+}
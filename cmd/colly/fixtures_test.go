@@ -0,0 +1,155 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2/collytest"
+	"github.com/gocolly/colly/v2/har"
+)
+
+func fixtureEntry(u string, status int, headers map[string]string, body string, wait float64) *har.Entry {
+	e := &har.Entry{
+		Request:  &har.Request{Method: "GET", URL: u},
+		Response: &har.Response{Status: status, Content: &har.Content{Text: body}},
+		Timings:  &har.Timings{Wait: wait},
+	}
+	for k, v := range headers {
+		e.Response.Headers = append(e.Response.Headers, &har.NameValue{Name: k, Value: v})
+	}
+	return e
+}
+
+// loadFixtures registers the pages of a source generated by
+// writeFixtures on the site by evaluating its calls
+func loadFixtures(t *testing.T, site *collytest.Site, src []byte) {
+	f, err := parser.ParseFile(token.NewFileSet(), "fixtures.go", src, 0)
+	if err != nil {
+		t.Fatalf("Generated source is invalid: %v\n%s", err, src)
+	}
+	fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+	str := func(e ast.Expr) string {
+		s, err := strconv.Unquote(e.(*ast.BasicLit).Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	num := func(e ast.Expr) int {
+		n, err := strconv.Atoi(e.(*ast.BasicLit).Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	// call evaluates a chain of method calls starting at site
+	var call func(e ast.Expr) *collytest.Page
+	call = func(e ast.Expr) *collytest.Page {
+		c := e.(*ast.CallExpr)
+		sel := c.Fun.(*ast.SelectorExpr)
+		switch sel.Sel.Name {
+		case "Page":
+			return site.Page(str(c.Args[0]))
+		case "RewriteOrigin":
+			site.RewriteOrigin(str(c.Args[0]))
+			return nil
+		case "WithStatus":
+			return call(sel.X).WithStatus(num(c.Args[0]))
+		case "WithHeader":
+			return call(sel.X).WithHeader(str(c.Args[0]), str(c.Args[1]))
+		case "WithBody":
+			return call(sel.X).WithBody(str(c.Args[0]))
+		case "WithDelay":
+			ms := num(c.Args[0].(*ast.BinaryExpr).X)
+			return call(sel.X).WithDelay(time.Duration(ms) * time.Millisecond)
+		}
+		t.Fatalf("Unexpected call: %s", sel.Sel.Name)
+		return nil
+	}
+	for _, stmt := range fn.Body.List {
+		if e, ok := stmt.(*ast.ExprStmt); ok {
+			call(e.X)
+		}
+	}
+}
+
+func TestWriteFixtures(t *testing.T) {
+	h := &har.HAR{Log: &har.Log{Entries: []*har.Entry{
+		fixtureEntry("https://example.com/", 200, map[string]string{"Content-Type": "text/html"},
+			`<a href="https://cdn.example.com/style.css">style</a>`, 0),
+		fixtureEntry("https://cdn.example.com/style.css", 200, map[string]string{"Content-Type": "text/css"}, "body {}", 0),
+		fixtureEntry("https://example.com/old", 301, map[string]string{"Location": "https://example.com/new?q=\"x\""}, "", 0),
+		fixtureEntry("https://example.com/new?q=%22x%22", 200, nil, "new\n\tpage", 40),
+		fixtureEntry("https://example.com/gone", 410, nil, "", 0),
+	}}}
+	src := &bytes.Buffer{}
+	if err := writeFixtures(src, h, "fixtures", "RecordedSite"); err != nil {
+		t.Fatal(err)
+	}
+	site := collytest.NewSite()
+	defer site.Close()
+	loadFixtures(t, site, src.Bytes())
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for _, tc := range []struct {
+		path, body, header, value string
+		status                    int
+		delay                     time.Duration
+	}{
+		{"/", `<a href="` + site.URL("/style.css") + `">style</a>`, "Content-Type", "text/html", 200, 0},
+		{"/style.css", "body {}", "Content-Type", "text/css", 200, 0},
+		{"/old", "", "Location", site.URL(`/new?q="x"`), 301, 0},
+		{"/new?q=%22x%22", "new\n\tpage", "", "", 200, 40 * time.Millisecond},
+		{"/gone", "", "", "", 410, 0},
+	} {
+		start := time.Now()
+		res, err := client.Get(site.URL(tc.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tc.status || string(body) != tc.body {
+			t.Errorf("%s: got %d %q, want %d %q", tc.path, res.StatusCode, body, tc.status, tc.body)
+		}
+		if tc.header != "" && res.Header.Get(tc.header) != tc.value {
+			t.Errorf("%s: %s is %q, want %q", tc.path, tc.header, res.Header.Get(tc.header), tc.value)
+		}
+		if time.Since(start) < tc.delay {
+			t.Errorf("%s: recorded latency was not replayed", tc.path)
+		}
+	}
+}
+
+func TestWriteFixturesConflictingPaths(t *testing.T) {
+	h := &har.HAR{Log: &har.Log{Entries: []*har.Entry{
+		fixtureEntry("https://example.com/", 200, nil, "site", 0),
+		fixtureEntry("https://cdn.example.com/", 200, nil, "cdn", 0),
+	}}}
+	if err := writeFixtures(ioutil.Discard, h, "fixtures", "RecordedSite"); err == nil {
+		t.Error("Conflicting paths of different origins were not reported")
+	}
+}
@@ -44,7 +44,7 @@ import (
 	"github.com/gocolly/colly/v2/debug"
 	"github.com/gocolly/colly/v2/storage"
 	"github.com/kennygrant/sanitize"
-	"github.com/temoto/robotstxt"
+	"golang.org/x/net/html"
 	"google.golang.org/appengine/urlfetch"
 )
 
@@ -55,6 +55,12 @@ type CollectorOption func(*Collector)
 type Collector struct {
 	// UserAgent is the User-Agent string used by HTTP requests
 	UserAgent string
+	// From is the contact address sent in the From header of the
+	// requests. See From.
+	From string
+	// CrawlInfoURL is the URL of the page describing the crawler, which
+	// is appended to the User-Agent of the requests. See CrawlInfoURL.
+	CrawlInfoURL string
 	// MaxDepth limits the recursion depth of visited URLs.
 	// Set it to 0 for infinite recursion (default).
 	MaxDepth int
@@ -63,6 +69,14 @@ type Collector struct {
 	AllowedDomains []string
 	// DisallowedDomains is a domain blacklist.
 	DisallowedDomains []string
+	// DomainMatchMode defines how AllowedDomains and DisallowedDomains
+	// match the domains of the URLs. See DomainMatchMode.
+	DomainMatchMode DomainMatchMode
+	// AllowedSchemes is a URL scheme whitelist. Leave it blank to allow
+	// http, https and the schemes registered by RegisterScheme. URLs
+	// of other schemes, e.g. javascript:, mailto:, data: and tel: links,
+	// are rejected with ErrForbiddenScheme.
+	AllowedSchemes []string
 	// DisallowedURLFilters is a list of regular expressions which restricts
 	// visiting URLs. If any of the rules matches to a URL the
 	// request will be stopped. DisallowedURLFilters will
@@ -82,7 +96,77 @@ type Collector struct {
 	// MaxBodySize is the limit of the retrieved response body in bytes.
 	// 0 means unlimited.
 	// The default value for MaxBodySize is 10MB (10 * 1024 * 1024 bytes).
+	// Responses exceeding it fail with ErrBodyTooLarge, unless
+	// AllowTruncatedBody is enabled.
 	MaxBodySize int
+	// AllowTruncatedBody processes the responses truncated at MaxBodySize
+	// instead of passing them to the OnError callbacks. Their Truncated
+	// field is set.
+	AllowTruncatedBody bool
+	// Fingerprint enables the detection of duplicate responses reached via
+	// different URLs, e.g. mirrors or URLs with session IDs. Duplicates
+	// are passed to the OnDuplicate callbacks instead of the OnResponse,
+	// OnHTML, OnXML and OnScraped callbacks. The fingerprints are kept by
+	// the storage of the Collector if it implements
+	// storage.FingerprintStorage.
+	Fingerprint FingerprintType
+	// SimHashDistance is the maximum number of different bits of the
+	// SimHash fingerprints of near-duplicate responses. The default
+	// value is 3.
+	SimHashDistance int
+	// MaxResumeAttempts is the number of times an interrupted response
+	// body is continued with range requests if the server advertises
+	// "Accept-Ranges: bytes" and sends an ETag or Last-Modified header.
+	// 0 disables resuming.
+	MaxResumeAttempts int
+	// DeterministicOrder makes asynchronous crawls reproducible by
+	// processing the pages level by level in a stable order. See
+	// DeterministicOrder.
+	DeterministicOrder bool
+	// Languages restricts the followed URLs to the language variants
+	// of the languages. See Languages.
+	Languages []string
+	// FollowAlternates visits the language variants of the pages
+	// annotated by hreflang
+	FollowAlternates bool
+	// PacingProfile paces the requests of every identity like a human
+	// visitor. See PacingProfile.
+	PacingProfile *PacingProfile
+	// DetectLanguage enables the language detection of the responses
+	DetectLanguage bool
+	// LanguageFilter skips the callbacks of the pages whose detected
+	// language is not one of the languages. See LanguageFilter.
+	LanguageFilter []string
+	// VariantDetection detects the pages served in different variants.
+	// See DetectVariants.
+	VariantDetection *VariantDetection
+	// WatchChanges enables the change detection of the visited pages.
+	// See WatchChanges.
+	WatchChanges bool
+	// ChangeSelector restricts the change detection of HTML pages to
+	// the text of the matching elements
+	ChangeSelector string
+	// RecordErrorHistory records the failures of the URLs in the
+	// storage if it implements storage.ErrorHistoryStorage
+	RecordErrorHistory bool
+	// ErrorSkipRules skip the URLs which failed repeatedly in the
+	// previous crawls. See SkipFailedURLs.
+	ErrorSkipRules []ErrorSkipRule
+	// HeadOnlyParse downloads and parses only the head section of HTML
+	// responses if the OnHTML callbacks only select elements of the head
+	// section. See HeadOnlyParse.
+	HeadOnlyParse bool
+	// MaxQueueLength is the maximum number of asynchronous requests
+	// waiting for the LimitRules of their domains. 0 means unlimited.
+	MaxQueueLength int
+	// QueueFullBehavior defines what happens to the new asynchronous
+	// requests if the queue is full
+	QueueFullBehavior QueueFullBehavior
+	// MaxParseConcurrency is the maximum number of response bodies
+	// parsed at the same time for the OnHTML and OnXML callbacks,
+	// independently of the number of parallel requests. Only parsing is
+	// limited, the callbacks run concurrently. 0 means unlimited.
+	MaxParseConcurrency int
 	// CacheDir specifies a location where GET requests are cached as files.
 	// When it's not defined, caching is disabled.
 	CacheDir string
@@ -90,6 +174,34 @@ type Collector struct {
 	// the target host's robots.txt file.  See http://www.robotstxt.org/ for more
 	// information.
 	IgnoreRobotsTxt bool
+	// IgnoreRobotsNoIndex disables skipping the OnResponse callbacks of
+	// responses with a "noindex" robots directive. Robots directives are
+	// only respected if IgnoreRobotsTxt is false.
+	IgnoreRobotsNoIndex bool
+	// IgnoreRobotsNoFollow allows following the links of responses with
+	// a "nofollow" robots directive.
+	IgnoreRobotsNoFollow bool
+	// StrictHeaders enables the strict header mode which validates and
+	// normalizes the request headers after the OnRequest callbacks.
+	// Requests with header names or values injecting line breaks or
+	// with ambiguous Transfer-Encoding or Content-Length headers fail
+	// with HeaderError. Use it if headers are built from untrusted
+	// page content.
+	StrictHeaders bool
+	// RequestBodyEncoding compresses the request bodies by the
+	// encoding, "gzip" or "deflate". See CompressRequestBody.
+	RequestBodyEncoding string
+	// WarmUpConnections pre-establishes the connections to every host
+	// before its first request. A failed warm-up does not fail the
+	// requests of the host, it is only reported to the debugger.
+	// See WarmUp.
+	WarmUpConnections bool
+	// RobotsTTL is the duration after which the robots.txt files are
+	// revalidated by conditional requests, so the changed rules are
+	// respected during long crawls. The robots.txt files are kept in
+	// the storage if it implements storage.RobotsStorage, so collectors
+	// using the same storage share them. 0 means the files never expire.
+	RobotsTTL time.Duration
 	// Async turns on asynchronous network communication. Use Collector.Wait() to
 	// be sure all requests have been finished.
 	Async bool
@@ -113,20 +225,45 @@ type Collector struct {
 	// Context is the context that will be used for HTTP requests. You can set this
 	// to support clean cancellation of scraping.
 	Context context.Context
+	// HeaderProfile sets the default headers of the requests and their
+	// order. Use SetHeaderProfile to set it.
+	HeaderProfile *HeaderProfile
+	// CookiePolicy restricts the cookies accepted by the cookie jar.
+	// Use SetCookiePolicy to set it.
+	CookiePolicy *CookiePolicy
+	// RedirectPolicy restricts the targets of the followed redirects.
+	// Redirects are not restricted if it is nil.
+	RedirectPolicy *RedirectPolicy
 
 	store                    storage.Storage
 	debugger                 debug.Debugger
-	robotsMap                map[string]*robotstxt.RobotsData
+	robotsMap                map[string]*robotsEntry
 	htmlCallbacks            []*htmlCallbackContainer
 	xmlCallbacks             []*xmlCallbackContainer
+	jsonCallbacks            []*jsonCallbackContainer
 	requestCallbacks         []RequestCallback
 	responseCallbacks        []ResponseCallback
 	responseHeadersCallbacks []ResponseHeadersCallback
 	errorCallbacks           []ErrorCallback
 	scrapedCallbacks         []ScrapedCallback
+	duplicateCallbacks       []DuplicateCallback
+	changeCallbacks          []ChangeCallback
+	templateBindings         []*TemplateBinding
+	plugins                  []Plugin
 	requestCount             uint32
 	responseCount            uint32
 	backend                  *httpBackend
+	ssrfGuard                *SSRFGuard
+	ssrfTransport            http.RoundTripper
+	stats                    statsCounter
+	parsePool                *parsePool
+	stopRule                 *stopRule
+	asyncQueue               *asyncQueue
+	order                    *crawlOrder
+	urlLanguages             *urlLanguages
+	variants                 *variantURLs
+	warmUps                  *hostWarmUps
+	pacer                    *pacer
 	wg                       *sync.WaitGroup
 	lock                     *sync.RWMutex
 }
@@ -208,24 +345,111 @@ var (
 	ErrAbortedAfterHeaders = errors.New("Aborted after receiving response headers")
 	// ErrQueueFull is the error returned when the queue is full
 	ErrQueueFull = errors.New("Queue MaxSize reached")
+	// ErrInvalidRange is the error type for invalid byte ranges
+	ErrInvalidRange = errors.New("Invalid byte range")
+	// ErrInvalidScheme is the error type for URL schemes which can not
+	// be registered
+	ErrInvalidScheme = errors.New("Invalid URL scheme")
+	// ErrNoResponse is the error returned if a Fetcher returns neither
+	// a response nor an error
+	ErrNoResponse = errors.New("Fetcher returned no response")
+	// ErrUnsupportedEncoding is the error type for unknown request body
+	// encodings
+	ErrUnsupportedEncoding = errors.New("Unsupported request body encoding")
+	// ErrRobotsNoFollow is the error returned when visiting a link of
+	// a page with a "nofollow" robots directive
+	ErrRobotsNoFollow = errors.New("Links of the page are blocked by a nofollow robots directive")
+	// ErrUnknownCookieFormat is the error type for unsupported cookie
+	// export and import formats
+	ErrUnknownCookieFormat = errors.New("Unknown cookie format")
+	// ErrCookiesNotExportable is the error returned by ExportCookies if
+	// the cookie jar was not set by the Collector
+	ErrCookiesNotExportable = errors.New("Cookies of the cookie jar can not be listed")
+	// ErrTLSProfileUnsupported is the error returned for requests of
+	// domains with TLS profile if the transport does not support them
+	ErrTLSProfileUnsupported = errors.New("TLS profiles are not supported by the transport")
+	// ErrECHUnsupported is the error returned for TLS profiles with
+	// Encrypted ClientHello configuration if it is not supported by the
+	// Go version
+	ErrECHUnsupported = errors.New("Encrypted ClientHello requires Go 1.23 or newer")
+	// ErrBlockedAddress is the error type for requests to internal
+	// addresses blocked by the SSRFGuard
+	ErrBlockedAddress = errors.New("Address is blocked by the SSRF guard")
+	// ErrRedirectForbidden is the error type for redirects forbidden by
+	// the RedirectPolicy
+	ErrRedirectForbidden = errors.New("Redirect is forbidden by the redirect policy")
+	// ErrSkippedFailedURL is the error type for URLs skipped because of
+	// their previous failures
+	ErrSkippedFailedURL = errors.New("URL is skipped because of its previous failures")
+	// ErrForbiddenLanguage is the error type for language variants not
+	// allowed by Collector.Languages
+	ErrForbiddenLanguage = errors.New("Language is not allowed")
+	// ErrDialTimeout is the error returned when resolving the host or
+	// connecting to it exceeds the DialTimeout
+	ErrDialTimeout = errors.New("Dial timeout exceeded")
+	// ErrTLSHandshakeTimeout is the error returned when the TLS
+	// handshake exceeds the TLSHandshakeTimeout
+	ErrTLSHandshakeTimeout = errors.New("TLS handshake timeout exceeded")
+	// ErrResponseHeaderTimeout is the error returned when waiting for
+	// the response headers exceeds the ResponseHeaderTimeout
+	ErrResponseHeaderTimeout = errors.New("Response header timeout exceeded")
+	// ErrIdleReadTimeout is the error returned when no data of the
+	// response body is received within the IdleReadTimeout
+	ErrIdleReadTimeout = errors.New("Idle read timeout exceeded")
+	// ErrBodyTooLarge is the error returned for the responses exceeding
+	// MaxBodySize if AllowTruncatedBody is disabled
+	ErrBodyTooLarge = errors.New("Response body exceeds MaxBodySize")
+	// ErrResponseFailed is the error of the responses marked as failed
+	// by Response.Fail without an error
+	ErrResponseFailed = errors.New("Response is marked as failed")
+	// ErrForbiddenScheme is the error thrown if visiting a URL whose
+	// scheme is not allowed in AllowedSchemes
+	ErrForbiddenScheme = errors.New("Forbidden URL scheme")
+	// ErrUnknownLimitRule is the error type for updating or removing a
+	// LimitRule which is not registered
+	ErrUnknownLimitRule = errors.New("LimitRule is not registered")
+	// ErrUnguardedTransport is the error type for requests refused by
+	// the SSRFGuard because their transport can not be guarded
+	ErrUnguardedTransport = errors.New("Transport is not supported by the SSRF guard")
+	// ErrUnsupportedStopSelector is the error type for selectors of
+	// StopParsingAfter depending on the content or the following
+	// siblings of the elements
+	ErrUnsupportedStopSelector = errors.New("Selector can not be matched before the end of the elements")
 )
 
 var envMap = map[string]func(*Collector, string){
 	"ALLOWED_DOMAINS": func(c *Collector, val string) {
 		c.AllowedDomains = strings.Split(val, ",")
 	},
+	"ALLOWED_SCHEMES": func(c *Collector, val string) {
+		c.AllowedSchemes = strings.Split(val, ",")
+	},
 	"CACHE_DIR": func(c *Collector, val string) {
 		c.CacheDir = val
 	},
+	"CRAWL_INFO_URL": func(c *Collector, val string) {
+		c.CrawlInfoURL = val
+	},
 	"DETECT_CHARSET": func(c *Collector, val string) {
 		c.DetectCharset = isYesString(val)
 	},
+	"DETECT_LANGUAGE": func(c *Collector, val string) {
+		c.DetectLanguage = isYesString(val)
+	},
 	"DISABLE_COOKIES": func(c *Collector, _ string) {
 		c.backend.Client.Jar = nil
 	},
 	"DISALLOWED_DOMAINS": func(c *Collector, val string) {
 		c.DisallowedDomains = strings.Split(val, ",")
 	},
+	"DOMAIN_MATCH_MODE": func(c *Collector, val string) {
+		if mode, ok := parseDomainMatchMode(val); ok {
+			c.DomainMatchMode = mode
+		}
+	},
+	"FROM": func(c *Collector, val string) {
+		c.From = val
+	},
 	"IGNORE_ROBOTSTXT": func(c *Collector, val string) {
 		c.IgnoreRobotsTxt = isYesString(val)
 	},
@@ -242,12 +466,33 @@ var envMap = map[string]func(*Collector, string){
 			c.MaxBodySize = size
 		}
 	},
+	"MAX_PARSE_CONCURRENCY": func(c *Collector, val string) {
+		n, err := strconv.Atoi(val)
+		if err == nil {
+			c.MaxParseConcurrency = n
+		}
+	},
+	"MAX_RESUME_ATTEMPTS": func(c *Collector, val string) {
+		attempts, err := strconv.Atoi(val)
+		if err == nil {
+			c.MaxResumeAttempts = attempts
+		}
+	},
 	"MAX_DEPTH": func(c *Collector, val string) {
 		maxDepth, err := strconv.Atoi(val)
 		if err == nil {
 			c.MaxDepth = maxDepth
 		}
 	},
+	"ROBOTS_TTL": func(c *Collector, val string) {
+		ttl, err := time.ParseDuration(val)
+		if err == nil {
+			c.RobotsTTL = ttl
+		}
+	},
+	"STRICT_HEADERS": func(c *Collector, val string) {
+		c.StrictHeaders = isYesString(val)
+	},
 	"PARSE_HTTP_ERROR_RESPONSE": func(c *Collector, val string) {
 		c.ParseHTTPErrorResponse = isYesString(val)
 	},
@@ -294,6 +539,13 @@ func AllowedDomains(domains ...string) CollectorOption {
 	}
 }
 
+// AllowedSchemes sets the URL scheme whitelist used by the Collector.
+func AllowedSchemes(schemes ...string) CollectorOption {
+	return func(c *Collector) {
+		c.AllowedSchemes = schemes
+	}
+}
+
 // ParseHTTPErrorResponse allows parsing responses with HTTP errors
 func ParseHTTPErrorResponse() CollectorOption {
 	return func(c *Collector) {
@@ -338,6 +590,30 @@ func MaxBodySize(sizeInBytes int) CollectorOption {
 	}
 }
 
+// AllowTruncatedBody instructs the Collector to process the partial
+// bodies of the responses exceeding MaxBodySize
+func AllowTruncatedBody() CollectorOption {
+	return func(c *Collector) {
+		c.AllowTruncatedBody = true
+	}
+}
+
+// MaxResumeAttempts sets the number of times an interrupted response
+// body is resumed with range requests.
+func MaxResumeAttempts(attempts int) CollectorOption {
+	return func(c *Collector) {
+		c.MaxResumeAttempts = attempts
+	}
+}
+
+// Fingerprint enables the detection of duplicate responses using the
+// fingerprinting method.
+func Fingerprint(t FingerprintType) CollectorOption {
+	return func(c *Collector) {
+		c.Fingerprint = t
+	}
+}
+
 // CacheDir specifies the location where GET requests are cached as files.
 func CacheDir(path string) CollectorOption {
 	return func(c *Collector) {
@@ -345,6 +621,30 @@ func CacheDir(path string) CollectorOption {
 	}
 }
 
+// IgnoreRobotsNoIndex instructs the Collector to call the OnResponse
+// callbacks of responses with a "noindex" robots directive.
+func IgnoreRobotsNoIndex() CollectorOption {
+	return func(c *Collector) {
+		c.IgnoreRobotsNoIndex = true
+	}
+}
+
+// IgnoreRobotsNoFollow instructs the Collector to follow the links of
+// responses with a "nofollow" robots directive.
+func IgnoreRobotsNoFollow() CollectorOption {
+	return func(c *Collector) {
+		c.IgnoreRobotsNoFollow = true
+	}
+}
+
+// RobotsTTL sets the duration after which the robots.txt files are
+// revalidated by conditional requests.
+func RobotsTTL(ttl time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.RobotsTTL = ttl
+	}
+}
+
 // IgnoreRobotsTxt instructs the Collector to ignore any restrictions
 // set by the target host's robots.txt file.
 func IgnoreRobotsTxt() CollectorOption {
@@ -414,13 +714,21 @@ func (c *Collector) Init() {
 	c.store = &storage.InMemoryStorage{}
 	c.store.Init()
 	c.MaxBodySize = 10 * 1024 * 1024
+	c.SimHashDistance = 3
 	c.backend = &httpBackend{}
 	jar, _ := cookiejar.New(nil)
-	c.backend.Init(jar)
+	c.backend.Init(c.wrapJar(jar))
 	c.backend.Client.CheckRedirect = c.checkRedirectFunc()
 	c.wg = &sync.WaitGroup{}
 	c.lock = &sync.RWMutex{}
-	c.robotsMap = make(map[string]*robotstxt.RobotsData)
+	c.robotsMap = make(map[string]*robotsEntry)
+	c.parsePool = newParsePool()
+	c.asyncQueue = newAsyncQueue()
+	c.order = newCrawlOrder()
+	c.urlLanguages = &urlLanguages{}
+	c.variants = &variantURLs{}
+	c.warmUps = &hostWarmUps{}
+	c.pacer = &pacer{}
 	c.IgnoreRobotsTxt = true
 	c.ID = atomic.AddUint32(&collectorCounter, 1)
 	c.TraceHTTP = false
@@ -459,6 +767,18 @@ func (c *Collector) Visit(URL string) error {
 	return c.scrape(URL, "GET", 1, nil, nil, nil, true)
 }
 
+// Revisit starts Collector's collecting job by creating a request to the
+// URL even if it was visited before. The URLs followed from the page are
+// still checked. Revisit also calls the previously provided callbacks
+func (c *Collector) Revisit(URL string) error {
+	if c.CheckHead {
+		if check := c.scrape(URL, "HEAD", 1, nil, nil, nil, false); check != nil {
+			return check
+		}
+	}
+	return c.scrape(URL, "GET", 1, nil, nil, nil, false)
+}
+
 // HasVisited checks if the provided URL has been visited
 func (c *Collector) HasVisited(URL string) (bool, error) {
 	return c.checkHasVisited(URL, nil)
@@ -512,6 +832,23 @@ func (c *Collector) Request(method, URL string, requestData io.Reader, ctx *Cont
 	return c.scrape(URL, method, 1, requestData, ctx, hdr, true)
 }
 
+// RequestRange fetches the from-to byte range of the URL using a range
+// request. If to is negative, the content is requested from from to its
+// end. Ranges are not marked as visited. Servers supporting range
+// requests respond with status code 206 (Partial Content).
+func (c *Collector) RequestRange(URL string, from, to int64) error {
+	if from < 0 || (to >= 0 && to < from) {
+		return ErrInvalidRange
+	}
+	hdr := http.Header{}
+	if to < 0 {
+		hdr.Set("Range", fmt.Sprintf("bytes=%d-", from))
+	} else {
+		hdr.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	}
+	return c.scrape(URL, "GET", 1, nil, nil, hdr, false)
+}
+
 // SetDebugger attaches a debugger to the collector
 func (c *Collector) SetDebugger(d debug.Debugger) {
 	d.Init()
@@ -549,6 +886,25 @@ func (c *Collector) UnmarshalRequest(r []byte) (*Request, error) {
 }
 
 func (c *Collector) scrape(u, method string, depth int, requestData io.Reader, ctx *Context, hdr http.Header, checkRevisit bool) error {
+	return c.scrapeContext(c.Context, u, method, depth, requestData, ctx, hdr, checkRevisit)
+}
+
+// scrapeContext is like scrape but the HTTP request is created with the
+// context reqCtx, which can carry per request settings like timeouts
+func (c *Collector) scrapeContext(reqCtx context.Context, u, method string, depth int, requestData io.Reader, ctx *Context, hdr http.Header, checkRevisit bool) error {
+	if c.Async && c.DeterministicOrder {
+		// the requests are checked when they are scheduled to mark
+		// the URLs visited in a deterministic order
+		c.wg.Add(1)
+		postponed := c.order.postpone(depth, func() {
+			defer c.wg.Done()
+			c.scrapeContext(reqCtx, u, method, depth, requestData, ctx, hdr, checkRevisit)
+		})
+		if postponed {
+			return nil
+		}
+		c.wg.Done()
+	}
 	parsedURL, err := url.Parse(u)
 	if err != nil {
 		return err
@@ -556,6 +912,17 @@ func (c *Collector) scrape(u, method string, depth int, requestData io.Reader, c
 	if err := c.requestCheck(u, parsedURL, method, requestData, depth, checkRevisit); err != nil {
 		return err
 	}
+	if c.Async {
+		if ok, err := c.reserve(u, method, depth, requestData, ctx, hdr); !ok {
+			if err != nil && checkRevisit {
+				c.forgetRequest(u, method, requestData)
+			}
+			return err
+		}
+	}
+	if j, ok := c.backend.Client.Jar.(*collectorJar); ok && depth == 1 {
+		j.addFirstParty(parsedURL)
+	}
 
 	if hdr == nil {
 		hdr = http.Header{}
@@ -585,14 +952,37 @@ func (c *Collector) scrape(u, method string, depth int, requestData io.Reader, c
 	}
 	// note: once 1.13 is minimum supported Go version,
 	// replace this with http.NewRequestWithContext
-	req = req.WithContext(c.Context)
+	req = req.WithContext(withVisitURL(reqCtx, u))
 	setRequestBody(req, requestData)
 	u = parsedURL.String()
 	c.wg.Add(1)
+	// the host is warmed up before the request takes its slot, because
+	// the warm-up takes the slots of the host too
+	warmUp := c.WarmUpConnections && c.backend.fetcher(parsedURL.Hostname()) == nil
 	if c.Async {
-		go c.fetch(u, method, depth, requestData, ctx, hdr, req)
+		if c.DeterministicOrder {
+			req = req.WithContext(withOrderTurn(req.Context(), c.order.assign(depth)))
+		}
+		push := func() {
+			c.backend.frontier.push(parsedURL, func(s *slot) {
+				defer s.release(false)
+				c.started()
+				c.fetch(u, method, depth, requestData, ctx, hdr, req.WithContext(withSlot(req.Context(), s)))
+			})
+		}
+		if warmUp {
+			go func() {
+				c.warmUp(parsedURL)
+				push()
+			}()
+			return nil
+		}
+		push()
 		return nil
 	}
+	if warmUp {
+		c.warmUp(parsedURL)
+	}
 	return c.fetch(u, method, depth, requestData, ctx, hdr, req)
 }
 
@@ -620,6 +1010,9 @@ func setRequestBody(req *http.Request, body io.Reader) {
 				r := snapshot
 				return ioutil.NopCloser(&r), nil
 			}
+		case *fileUpload:
+			req.ContentLength = v.Len()
+			req.GetBody = v.reopen
 		}
 		if req.GetBody != nil && req.ContentLength == 0 {
 			req.Body = http.NoBody
@@ -630,6 +1023,12 @@ func setRequestBody(req *http.Request, body io.Reader) {
 
 func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ctx *Context, hdr http.Header, req *http.Request) error {
 	defer c.wg.Done()
+	turn := orderTurnFromContext(req.Context())
+	if turn != nil {
+		defer turn.done()
+	}
+	atomic.AddInt32(&c.stats.active, 1)
+	defer atomic.AddInt32(&c.stats.active, -1)
 	if ctx == nil {
 		ctx = NewContext()
 	}
@@ -643,6 +1042,7 @@ func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ct
 		collector: c,
 		ID:        atomic.AddUint32(&c.requestCount, 1),
 	}
+	request.Timeout, _ = requestTimeoutFromContext(req.Context())
 
 	c.handleOnRequest(request)
 
@@ -654,10 +1054,37 @@ func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ct
 		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	}
 
+	if request.Timeout > 0 {
+		req = req.WithContext(withRequestTimeout(req.Context(), request.Timeout))
+	}
+
+	profile := request.HeaderProfile
+	if profile == nil {
+		profile = c.HeaderProfile
+	}
+	if profile != nil {
+		profile.apply(req, c.UserAgent)
+		req = withHeaderProfile(req, profile)
+	}
+
+	c.identify(req.Header)
+
 	if req.Header.Get("Accept") == "" {
 		req.Header.Set("Accept", "*/*")
 	}
 
+	if c.RequestBodyEncoding != "" {
+		if err := compressRequestBody(req, request, c.RequestBodyEncoding); err != nil {
+			return c.handleOnError(nil, err, request, ctx)
+		}
+	}
+
+	if c.StrictHeaders {
+		if err := normalizeHeaders(req); err != nil {
+			return c.handleOnError(nil, err, request, ctx)
+		}
+	}
+
 	var hTrace *HTTPTrace
 	if c.TraceHTTP {
 		hTrace = &HTTPTrace{}
@@ -672,7 +1099,33 @@ func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ct
 		c.handleOnResponseHeaders(&Response{Ctx: ctx, Request: request, StatusCode: statusCode, Headers: &headers})
 		return !request.abort
 	}
-	response, err := c.backend.Cache(req, c.MaxBodySize, checkHeadersFunc, c.CacheDir)
+	if c.HeadOnlyParse && c.headOnly() {
+		req = withHeadOnly(req)
+	}
+	var pace *identityPace
+	if c.PacingProfile != nil {
+		var err error
+		if pace, err = c.beginPace(request, req); err != nil {
+			return c.handleOnError(nil, err, request, ctx)
+		}
+	}
+	c.stats.request(request)
+	start := time.Now()
+	// the body of the original request is kept to unvisit failed
+	// responses, because req is replaced by the last redirect
+	getBody := req.GetBody
+	response, err := c.fetchResponse(req, request, checkHeadersFunc)
+	if err == nil && response.Truncated && !c.AllowTruncatedBody {
+		err = ErrBodyTooLarge
+	}
+	if pace != nil {
+		c.endPace(pace, req, depth, response)
+	}
+	c.stats.response(request, response, time.Since(start))
+	c.recordError(u, response, err)
+	if turn != nil {
+		turn.wait()
+	}
 	if proxyURL, ok := req.Context().Value(ProxyURLKey).(string); ok {
 		request.ProxyURL = proxyURL
 	}
@@ -684,12 +1137,57 @@ func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ct
 	response.Request = request
 	response.Trace = hTrace
 
+	response.fixContentType(request.contentType)
 	err = response.fixCharset(c.DetectCharset, request.ResponseCharacterEncoding)
 	if err != nil {
 		return err
 	}
 
-	c.handleOnResponse(response)
+	// the documents are not parsed again for ignored robots directives
+	if !c.IgnoreRobotsTxt && (!c.IgnoreRobotsNoFollow || !c.IgnoreRobotsNoIndex) {
+		response.Robots = parseRobotsDirectives(response, c.UserAgent)
+		request.noFollow = response.Robots.NoFollow && !c.IgnoreRobotsNoFollow
+	}
+
+	if c.VariantDetection != nil {
+		response.Variant = c.checkVariants(req, response)
+	}
+
+	if c.FollowAlternates || len(c.Languages) > 0 || c.DetectLanguage {
+		response.Alternates = parseAlternates(response)
+	}
+	if len(response.Alternates) > 0 {
+		c.urlLanguages.add(response.Alternates)
+		if c.FollowAlternates {
+			for _, a := range response.Alternates {
+				if a.URL != request.URL.String() {
+					request.Visit(a.URL)
+				}
+			}
+		}
+	}
+
+	if c.WatchChanges {
+		c.checkChange(response)
+	}
+
+	if c.Fingerprint != NoFingerprint {
+		if originalURL, ok := c.isDuplicate(response); ok {
+			c.handleOnDuplicate(response, originalURL)
+			return nil
+		}
+	}
+
+	if c.DetectLanguage {
+		response.Language = detectLanguage(response)
+		if len(c.LanguageFilter) > 0 && response.Language != "" && !matchLanguage(c.LanguageFilter, response.Language) {
+			return nil
+		}
+	}
+
+	if !response.Robots.NoIndex || c.IgnoreRobotsNoIndex {
+		c.handleOnResponse(response)
+	}
 
 	err = c.handleOnHTML(response)
 	if err != nil {
@@ -701,8 +1199,19 @@ func (c *Collector) fetch(u, method string, depth int, requestData io.Reader, ct
 		c.handleOnError(response, err, request, ctx)
 	}
 
+	err = c.handleOnJSON(response)
+	if err != nil {
+		c.handleOnError(response, err, request, ctx)
+	}
+
 	c.handleOnScraped(response)
 
+	if response.failure != nil {
+		c.forgetVisit(req.Context(), method, getBody)
+		c.recordError(u, response, response.failure)
+		return c.handleOnError(response, response.failure, request, ctx)
+	}
+
 	return err
 }
 
@@ -710,6 +1219,9 @@ func (c *Collector) requestCheck(u string, parsedURL *url.URL, method string, re
 	if u == "" {
 		return ErrMissingURL
 	}
+	if !c.isSchemeAllowed(parsedURL.Scheme) {
+		return ErrForbiddenScheme
+	}
 	if c.MaxDepth > 0 && c.MaxDepth < depth {
 		return ErrMaxDepth
 	}
@@ -726,21 +1238,26 @@ func (c *Collector) requestCheck(u string, parsedURL *url.URL, method string, re
 	if !c.isDomainAllowed(parsedURL.Hostname()) {
 		return ErrForbiddenDomain
 	}
-	if method != "HEAD" && !c.IgnoreRobotsTxt {
+	if err := c.checkErrorHistory(parsedURL.String()); err != nil {
+		return err
+	}
+	if !c.languageAllowed(parsedURL.String()) {
+		return ErrForbiddenLanguage
+	}
+	if err := c.checkSSRF(parsedURL); err != nil {
+		return err
+	}
+	if method != "HEAD" && !c.IgnoreRobotsTxt && c.backend.schemeHandler(parsedURL.Scheme) == nil {
 		if err := c.checkRobots(parsedURL); err != nil {
 			return err
 		}
 	}
 	if checkRevisit && !c.AllowURLRevisit {
-		h := fnv.New64a()
-		h.Write([]byte(u))
-
 		var uHash uint64
 		if method == "GET" {
-			uHash = h.Sum64()
+			uHash = requestHash(u, nil)
 		} else if requestData != nil {
-			h.Write(streamToByte(requestData))
-			uHash = h.Sum64()
+			uHash = requestHash(u, streamToByte(requestData))
 		} else {
 			return nil
 		}
@@ -759,7 +1276,7 @@ func (c *Collector) requestCheck(u string, parsedURL *url.URL, method string, re
 
 func (c *Collector) isDomainAllowed(domain string) bool {
 	for _, d2 := range c.DisallowedDomains {
-		if d2 == domain {
+		if matchDomain(d2, domain, c.DomainMatchMode) {
 			return false
 		}
 	}
@@ -767,33 +1284,30 @@ func (c *Collector) isDomainAllowed(domain string) bool {
 		return true
 	}
 	for _, d2 := range c.AllowedDomains {
-		if d2 == domain {
+		if matchDomain(d2, domain, c.DomainMatchMode) {
 			return true
 		}
 	}
 	return false
 }
 
-func (c *Collector) checkRobots(u *url.URL) error {
-	c.lock.RLock()
-	robot, ok := c.robotsMap[u.Host]
-	c.lock.RUnlock()
-
-	if !ok {
-		// no robots file cached
-		resp, err := c.backend.Client.Get(u.Scheme + "://" + u.Host + "/robots.txt")
-		if err != nil {
-			return err
+func (c *Collector) isSchemeAllowed(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	if len(c.AllowedSchemes) == 0 {
+		return scheme == "http" || scheme == "https" || c.backend.schemeHandler(scheme) != nil
+	}
+	for _, s := range c.AllowedSchemes {
+		if strings.ToLower(s) == scheme {
+			return true
 		}
-		defer resp.Body.Close()
+	}
+	return false
+}
 
-		robot, err = robotstxt.FromResponse(resp)
-		if err != nil {
-			return err
-		}
-		c.lock.Lock()
-		c.robotsMap[u.Host] = robot
-		c.lock.Unlock()
+func (c *Collector) checkRobots(u *url.URL) error {
+	robot, err := c.robots(u)
+	if err != nil {
+		return err
 	}
 
 	uaGroup := robot.FindGroup(c.UserAgent)
@@ -952,6 +1466,37 @@ func (c *Collector) OnScraped(f ScrapedCallback) {
 	c.lock.Unlock()
 }
 
+// OnDuplicate registers a function. Function will be executed instead of
+// the OnResponse, OnHTML, OnXML and OnScraped callbacks if the content of
+// a response is a duplicate of an already received response.
+// See Collector.Fingerprint.
+func (c *Collector) OnDuplicate(f DuplicateCallback) {
+	c.lock.Lock()
+	if c.duplicateCallbacks == nil {
+		c.duplicateCallbacks = make([]DuplicateCallback, 0, 4)
+	}
+	c.duplicateCallbacks = append(c.duplicateCallbacks, f)
+	c.lock.Unlock()
+}
+
+// OnHTTPExchange registers a function. Function will be executed after
+// every HTTP round trip of the backend with the details of the request,
+// the response and the timings, even if the request failed.
+// The HTTP backend is shared between cloned collectors, so the function
+// is executed for the requests of the clones too.
+func (c *Collector) OnHTTPExchange(f HTTPExchangeCallback) {
+	c.backend.OnExchange(f)
+}
+
+// RegisterScheme registers a handler fetching the URLs of a non-HTTP
+// scheme, e.g. "s3", "git" or "ipfs". The responses of the handler are
+// processed by the same callbacks as HTTP responses.
+//
+// The handler is shared with the clones of the collector.
+func (c *Collector) RegisterScheme(scheme string, handler SchemeHandler) error {
+	return c.backend.RegisterScheme(scheme, handler)
+}
+
 // SetClient will override the previously set http.Client
 func (c *Collector) SetClient(client *http.Client) {
 	c.backend.Client = client
@@ -969,10 +1514,11 @@ func (c *Collector) DisableCookies() {
 
 // SetCookieJar overrides the previously set cookie jar
 func (c *Collector) SetCookieJar(j http.CookieJar) {
-	c.backend.Client.Jar = j
+	c.backend.Client.Jar = c.wrapJar(j)
 }
 
-// SetRequestTimeout overrides the default timeout (10 seconds) for this collector
+// SetRequestTimeout overrides the default timeout (10 seconds) for this collector.
+// Request.Timeout overrides it for individual requests.
 func (c *Collector) SetRequestTimeout(timeout time.Duration) {
 	c.backend.Client.Timeout = timeout
 }
@@ -984,7 +1530,7 @@ func (c *Collector) SetStorage(s storage.Storage) error {
 		return err
 	}
 	c.store = s
-	c.backend.Client.Jar = createJar(s)
+	c.backend.Client.Jar = c.wrapJar(createJar(s))
 	return nil
 }
 
@@ -1072,7 +1618,11 @@ func (c *Collector) handleOnHTML(resp *Response) error {
 	if len(c.htmlCallbacks) == 0 || !strings.Contains(strings.ToLower(resp.Headers.Get("Content-Type")), "html") {
 		return nil
 	}
-	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(resp.Body))
+	var doc *goquery.Document
+	err := c.parse(func() (err error) {
+		doc, err = goquery.NewDocumentFromReader(bytes.NewBuffer(c.htmlBody(resp)))
+		return
+	})
 	if err != nil {
 		return err
 	}
@@ -1112,7 +1662,11 @@ func (c *Collector) handleOnXML(resp *Response) error {
 	}
 
 	if strings.Contains(contentType, "html") {
-		doc, err := htmlquery.Parse(bytes.NewBuffer(resp.Body))
+		var doc *html.Node
+		err := c.parse(func() (err error) {
+			doc, err = htmlquery.Parse(bytes.NewBuffer(c.htmlBody(resp)))
+			return
+		})
 		if err != nil {
 			return err
 		}
@@ -1141,7 +1695,11 @@ func (c *Collector) handleOnXML(resp *Response) error {
 			}
 		}
 	} else if strings.Contains(contentType, "xml") || isXMLFile {
-		doc, err := xmlquery.Parse(bytes.NewBuffer(resp.Body))
+		var doc *xmlquery.Node
+		err := c.parse(func() (err error) {
+			doc, err = xmlquery.Parse(bytes.NewBuffer(resp.Body))
+			return
+		})
 		if err != nil {
 			return err
 		}
@@ -1163,12 +1721,14 @@ func (c *Collector) handleOnXML(resp *Response) error {
 }
 
 func (c *Collector) handleOnError(response *Response, err error, request *Request, ctx *Context) error {
-	if err == nil && (c.ParseHTTPErrorResponse || response.StatusCode < 203) {
+	// partial content is the successful response of range requests
+	if err == nil && (c.ParseHTTPErrorResponse || response.StatusCode < 203 || response.StatusCode == http.StatusPartialContent) {
 		return nil
 	}
 	if err == nil && response.StatusCode >= 203 {
 		err = errors.New(http.StatusText(response.StatusCode))
 	}
+	c.stats.error(request)
 	if response == nil {
 		response = &Response{
 			Request: request,
@@ -1204,6 +1764,18 @@ func (c *Collector) handleOnScraped(r *Response) {
 	}
 }
 
+func (c *Collector) handleOnDuplicate(r *Response, originalURL string) {
+	if c.debugger != nil {
+		c.debugger.Event(createEvent("duplicate", r.Request.ID, c.ID, map[string]string{
+			"url":      r.Request.URL.String(),
+			"original": originalURL,
+		}))
+	}
+	for _, f := range c.duplicateCallbacks {
+		f(r, originalURL)
+	}
+}
+
 // Limit adds a new LimitRule to the collector
 func (c *Collector) Limit(rule *LimitRule) error {
 	return c.backend.Limit(rule)
@@ -1214,6 +1786,57 @@ func (c *Collector) Limits(rules []*LimitRule) error {
 	return c.backend.Limits(rules)
 }
 
+// LimitRules returns the LimitRules of the collector in the order of
+// their registration
+func (c *Collector) LimitRules() []*LimitRule {
+	c.backend.lock.RLock()
+	defer c.backend.lock.RUnlock()
+	return append([]*LimitRule(nil), c.backend.LimitRules...)
+}
+
+// UpdateLimitRule replaces a LimitRule of the collector, e.g. to slow
+// down a running crawl which triggers rate limits. The waiting requests
+// of the old rule are limited by the new rule, and its running requests
+// count towards the Parallelism of the new rule. The registered rules
+// must not be modified, update a copy of them instead:
+//
+//	slower := *rule
+//	slower.Delay = 5 * time.Second
+//	c.UpdateLimitRule(rule, &slower)
+//
+// It is safe to call while the collector is running.
+func (c *Collector) UpdateLimitRule(old, rule *LimitRule) error {
+	return c.backend.UpdateLimit(old, rule)
+}
+
+// RemoveLimitRule removes a LimitRule of the collector. The waiting
+// requests of the rule are limited by the remaining rules, while its
+// running requests are finished without counting towards them. It is
+// safe to call while the collector is running.
+func (c *Collector) RemoveLimitRule(rule *LimitRule) error {
+	return c.backend.RemoveLimit(rule)
+}
+
+// LimitRuleStats contains the requests limited by a LimitRule
+type LimitRuleStats struct {
+	Rule *LimitRule
+	// Waiting is the number of the requests waiting for a slot
+	Waiting int
+	// Running is the number of the requests holding a slot, including
+	// the slots kept for the Delay after the responses
+	Running int
+	// Hosts is the number of the hosts having waiting or running
+	// requests
+	Hosts int
+}
+
+// LimitRuleStats returns the waiting and running requests of the
+// LimitRules in the order of their registration. It is safe to call
+// while the collector is running.
+func (c *Collector) LimitRuleStats() []LimitRuleStats {
+	return c.backend.limitStats()
+}
+
 // SetRedirectHandler instructs the Collector to allow multiple downloads of the same URL
 func (c *Collector) SetRedirectHandler(f func(req *http.Request, via []*http.Request) error) {
 	c.redirectHandler = f
@@ -1251,23 +1874,65 @@ func (c *Collector) Cookies(URL string) []*http.Cookie {
 func (c *Collector) Clone() *Collector {
 	return &Collector{
 		AllowedDomains:         c.AllowedDomains,
+		AllowedSchemes:         c.AllowedSchemes,
 		AllowURLRevisit:        c.AllowURLRevisit,
 		CacheDir:               c.CacheDir,
 		DetectCharset:          c.DetectCharset,
 		DisallowedDomains:      c.DisallowedDomains,
+		DomainMatchMode:        c.DomainMatchMode,
 		ID:                     atomic.AddUint32(&collectorCounter, 1),
 		IgnoreRobotsTxt:        c.IgnoreRobotsTxt,
+		IgnoreRobotsNoIndex:    c.IgnoreRobotsNoIndex,
+		IgnoreRobotsNoFollow:   c.IgnoreRobotsNoFollow,
+		StrictHeaders:          c.StrictHeaders,
+		RequestBodyEncoding:    c.RequestBodyEncoding,
+		WarmUpConnections:      c.WarmUpConnections,
 		MaxBodySize:            c.MaxBodySize,
+		AllowTruncatedBody:     c.AllowTruncatedBody,
+		MaxResumeAttempts:      c.MaxResumeAttempts,
+		MaxParseConcurrency:    c.MaxParseConcurrency,
+		MaxQueueLength:         c.MaxQueueLength,
+		QueueFullBehavior:      c.QueueFullBehavior,
+		DeterministicOrder:     c.DeterministicOrder,
+		HeadOnlyParse:          c.HeadOnlyParse,
+		RecordErrorHistory:     c.RecordErrorHistory,
+		WatchChanges:           c.WatchChanges,
+		ChangeSelector:         c.ChangeSelector,
+		VariantDetection:       c.VariantDetection,
+		Languages:              c.Languages,
+		FollowAlternates:       c.FollowAlternates,
+		DetectLanguage:         c.DetectLanguage,
+		PacingProfile:          c.PacingProfile,
+		LanguageFilter:         c.LanguageFilter,
+		ErrorSkipRules:         c.ErrorSkipRules,
+		RobotsTTL:              c.RobotsTTL,
+		Fingerprint:            c.Fingerprint,
+		SimHashDistance:        c.SimHashDistance,
 		MaxDepth:               c.MaxDepth,
 		DisallowedURLFilters:   c.DisallowedURLFilters,
 		URLFilters:             c.URLFilters,
 		CheckHead:              c.CheckHead,
 		ParseHTTPErrorResponse: c.ParseHTTPErrorResponse,
 		UserAgent:              c.UserAgent,
+		From:                   c.From,
+		CrawlInfoURL:           c.CrawlInfoURL,
 		TraceHTTP:              c.TraceHTTP,
 		Context:                c.Context,
+		HeaderProfile:          c.HeaderProfile,
+		CookiePolicy:           c.CookiePolicy,
+		RedirectPolicy:         c.RedirectPolicy,
 		store:                  c.store,
 		backend:                c.backend,
+		ssrfGuard:              c.ssrfGuard,
+		ssrfTransport:          c.ssrfTransport,
+		parsePool:              c.parsePool,
+		stopRule:               c.stopRule,
+		asyncQueue:             newAsyncQueue(),
+		order:                  newCrawlOrder(),
+		urlLanguages:           c.urlLanguages,
+		variants:               c.variants,
+		warmUps:                c.warmUps,
+		pacer:                  c.pacer,
 		debugger:               c.debugger,
 		Async:                  c.Async,
 		redirectHandler:        c.redirectHandler,
@@ -1288,9 +1953,20 @@ func (c *Collector) checkRedirectFunc() func(req *http.Request, via []*http.Requ
 		if !c.isDomainAllowed(req.URL.Hostname()) {
 			return fmt.Errorf("Not following redirect to %s because its not in AllowedDomains", req.URL.Host)
 		}
+		if !c.isSchemeAllowed(req.URL.Scheme) {
+			return ErrForbiddenScheme
+		}
+		if c.RedirectPolicy != nil {
+			if err := c.RedirectPolicy.Check(req, via); err != nil {
+				return err
+			}
+		}
 
 		if c.redirectHandler != nil {
-			return c.redirectHandler(req, via)
+			if err := c.redirectHandler(req, via); err != nil {
+				return err
+			}
+			return c.backend.authorize(req)
 		}
 
 		// Honor golangs default of maximum of 10 redirects
@@ -1305,7 +1981,7 @@ func (c *Collector) checkRedirectFunc() func(req *http.Request, via []*http.Requ
 			req.Header.Del("Authorization")
 		}
 
-		return nil
+		return c.backend.authorize(req)
 	}
 }
 
@@ -1324,14 +2000,19 @@ func (c *Collector) parseSettingsFromEnv() {
 }
 
 func (c *Collector) checkHasVisited(URL string, requestData map[string]string) (bool, error) {
-	h := fnv.New64a()
-	h.Write([]byte(URL))
-
+	var body []byte
 	if requestData != nil {
-		h.Write(streamToByte(createFormReader(requestData)))
+		body = streamToByte(createFormReader(requestData))
 	}
+	return c.store.IsVisited(requestHash(URL, body))
+}
 
-	return c.store.IsVisited(h.Sum64())
+// requestHash returns the ID of a request stored as visited
+func requestHash(u string, body []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(u))
+	h.Write(body)
+	return h.Sum64()
 }
 
 // SanitizeFileName replaces dangerous characters in a string
@@ -1357,24 +2038,6 @@ func createFormReader(data map[string]string) io.Reader {
 	return strings.NewReader(form.Encode())
 }
 
-func createMultipartReader(boundary string, data map[string][]byte) io.Reader {
-	dashBoundary := "--" + boundary
-
-	body := []byte{}
-	buffer := bytes.NewBuffer(body)
-
-	buffer.WriteString("Content-type: multipart/form-data; boundary=" + boundary + "\n\n")
-	for contentType, content := range data {
-		buffer.WriteString(dashBoundary + "\n")
-		buffer.WriteString("Content-Disposition: form-data; name=" + contentType + "\n")
-		buffer.WriteString(fmt.Sprintf("Content-Length: %d \n\n", len(content)))
-		buffer.Write(content)
-		buffer.WriteString("\n")
-	}
-	buffer.WriteString(dashBoundary + "--\n\n")
-	return buffer
-}
-
 // randomBoundary was borrowed from
 // github.com/golang/go/mime/multipart/writer.go#randomBoundary
 func randomBoundary() string {
@@ -17,21 +17,30 @@ package colly
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/gocolly/colly/v2/debug"
+	"github.com/gocolly/colly/v2/storage"
 )
 
 var serverIndexResponse = []byte("hello world\n")
@@ -447,6 +456,43 @@ func TestCollectorVisitWithAllowedDomains(t *testing.T) {
 	}
 }
 
+func TestCollectorVisitWithAllowedSchemes(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := NewCollector()
+	var requested []string
+	c.OnRequest(func(r *Request) {
+		requested = append(requested, r.URL.String())
+	})
+	for _, u := range []string{"javascript:void(0)", "mailto:info@example.com", "data:text/html,<p>x</p>", "tel:+3612345678", "ftp://example.com/"} {
+		if err := c.Visit(u); err != ErrForbiddenScheme {
+			t.Errorf("Visit(%q) should return ErrForbiddenScheme, but got %v", u, err)
+		}
+	}
+	if err := c.Visit(ts.URL); err != nil {
+		t.Errorf("Failed to visit url %s: %v", ts.URL, err)
+	}
+	if len(requested) != 1 {
+		t.Errorf("Forbidden schemes were requested: %v", requested)
+	}
+
+	c.RegisterScheme("test", SchemeHandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("test")), Header: http.Header{}}, nil
+	}))
+	if err := c.Visit("test://example.com/"); err != nil {
+		t.Errorf("Registered scheme was not allowed: %v", err)
+	}
+
+	c = NewCollector(AllowedSchemes("HTTPS"))
+	if err := c.Visit(ts.URL); err != ErrForbiddenScheme {
+		t.Errorf("c.Visit should return ErrForbiddenScheme, but got %v", err)
+	}
+	if c2 := c.Clone(); len(c2.AllowedSchemes) != 1 {
+		t.Error("AllowedSchemes was not cloned")
+	}
+}
+
 func TestCollectorVisitWithDisallowedDomains(t *testing.T) {
 	ts := newTestServer()
 	defer ts.Close()
@@ -921,6 +967,178 @@ func TestRobotsWhenDisallowedWithQueryParameter(t *testing.T) {
 	}
 }
 
+func TestRobotsTTLAndSharedStorage(t *testing.T) {
+	var fetches int32
+	disallowed := int32(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&fetches, 1)
+			if atomic.LoadInt32(&disallowed) == 1 {
+				w.Write([]byte("User-agent: *\nDisallow: /page\n"))
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	s := &storage.InMemoryStorage{}
+	c1 := NewCollector(AllowURLRevisit(), RobotsTTL(50*time.Millisecond))
+	c1.IgnoreRobotsTxt = false
+	c1.SetStorage(s)
+	c2 := NewCollector(AllowURLRevisit())
+	c2.IgnoreRobotsTxt = false
+	c2.SetStorage(s)
+
+	if err := c1.Visit(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Visit(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("robots.txt was fetched %d times, want 1", n)
+	}
+
+	atomic.StoreInt32(&disallowed, 1)
+	if err := c1.Visit(ts.URL + "/page"); err != nil {
+		t.Errorf("Cached robots.txt was not used: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := c1.Visit(ts.URL + "/page"); err != ErrRobotsTxtBlocked {
+		t.Errorf("Invalid error %v, want %v", err, ErrRobotsTxtBlocked)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("robots.txt was fetched %d times, want 2", n)
+	}
+}
+
+func TestRobotsRevalidation(t *testing.T) {
+	var fetches, notModified int32
+	var disallowed int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			w.Write([]byte("ok"))
+			return
+		}
+		atomic.AddInt32(&fetches, 1)
+		etag := `"v1"`
+		if atomic.LoadInt32(&disallowed) == 1 {
+			etag = `"v2"`
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if etag == `"v2"` {
+			w.Write([]byte("User-agent: *\nDisallow: /page\n"))
+			return
+		}
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer ts.Close()
+
+	s := &storage.InMemoryStorage{}
+	c := NewCollector(AllowURLRevisit(), RobotsTTL(20*time.Millisecond))
+	c.IgnoreRobotsTxt = false
+	c.SetStorage(s)
+	if err := c.Visit(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := c.Visit(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Visit(ts.URL + "/private"); err != ErrRobotsTxtBlocked {
+		t.Errorf("Rules of the revalidated robots.txt were not kept: %v", err)
+	}
+	if n := atomic.LoadInt32(&notModified); n != 1 {
+		t.Errorf("robots.txt was not revalidated: %d", n)
+	}
+	host := strings.TrimPrefix(ts.URL, "http://")
+	if r, _ := s.GetRobots(host); r == nil || r.ETag != `"v1"` || len(r.Body) == 0 {
+		t.Errorf("Invalid stored robots.txt: %+v", r)
+	}
+
+	atomic.StoreInt32(&disallowed, 1)
+	time.Sleep(30 * time.Millisecond)
+	if err := c.Visit(ts.URL + "/page"); err != ErrRobotsTxtBlocked {
+		t.Errorf("Changed robots.txt was not respected: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 3 {
+		t.Errorf("robots.txt was fetched %d times, want 3", n)
+	}
+}
+
+func TestRobotsDirectives(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nAllow: /\n"))
+	})
+	page := func(path, header, head, link string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if header != "" {
+				w.Header().Set("X-Robots-Tag", header)
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<html><head>%s</head><body><a href="%s">link</a></body></html>`, head, link)
+		})
+	}
+	page("/", "", "", "/nofollow")
+	page("/nofollow", "", `<meta name="robots" content="index, nofollow">`, "/hidden")
+	page("/hidden", "", "", "/noindex")
+	page("/noindex", "noindex", "", "/other")
+	page("/other", "otherbot: none", `<meta name="colly" content="noindex">`, "/mybot")
+	page("/mybot", "mybot: noindex", "", "")
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	crawl := func(options ...CollectorOption) (visited, responses []string) {
+		c := NewCollector(append(options, UserAgent("Mozilla/5.0 (compatible; mybot/1.0)"))...)
+		c.IgnoreRobotsTxt = false
+		c.OnHTML("a[href]", func(e *HTMLElement) {
+			e.Request.Visit(e.Attr("href"))
+		})
+		c.OnResponse(func(r *Response) {
+			responses = append(responses, r.Request.URL.Path)
+		})
+		c.OnRequest(func(r *Request) {
+			visited = append(visited, r.URL.Path)
+		})
+		c.Visit(ts.URL + "/")
+		return
+	}
+
+	visited, responses := crawl()
+	if !reflect.DeepEqual(visited, []string{"/", "/nofollow"}) {
+		t.Errorf("Invalid visited pages %v", visited)
+	}
+	visited, responses = crawl(IgnoreRobotsNoFollow())
+	if !reflect.DeepEqual(visited, []string{"/", "/nofollow", "/hidden", "/noindex", "/other", "/mybot"}) {
+		t.Errorf("Invalid visited pages %v", visited)
+	}
+	if !reflect.DeepEqual(responses, []string{"/", "/nofollow", "/hidden", "/other"}) {
+		t.Errorf("Invalid responses %v", responses)
+	}
+	_, responses = crawl(IgnoreRobotsNoFollow(), IgnoreRobotsNoIndex())
+	if len(responses) != 6 {
+		t.Errorf("Invalid responses %v", responses)
+	}
+
+	// ignored directives are not parsed
+	c := NewCollector()
+	var robots RobotsDirectives
+	c.OnResponse(func(r *Response) {
+		robots = r.Robots
+	})
+	c.Visit(ts.URL + "/noindex")
+	if robots.NoIndex {
+		t.Error("Robots directives were parsed with IgnoreRobotsTxt")
+	}
+}
+
 func TestIgnoreRobotsWhenDisallowed(t *testing.T) {
 	ts := newTestServer()
 	defer ts.Close()
@@ -1253,6 +1471,574 @@ func TestCollectorVisitWithCheckHead(t *testing.T) {
 	}
 }
 
+func TestContentEncodings(t *testing.T) {
+	body := strings.Repeat("<p>compressed</p>", 100)
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+			t.Errorf("%s is not accepted: %q", encoding, r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Query().Get("empty") != "" {
+			return
+		}
+		enc := encoders[encoding](w)
+		enc.Write([]byte(body))
+		enc.Close()
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	for encoding := range encoders {
+		var got string
+		c.OnResponse(func(r *Response) {
+			got = string(r.Body)
+		})
+		if err := c.Visit(ts.URL + "/" + encoding); err != nil {
+			t.Fatal(err)
+		}
+		if got != body {
+			t.Errorf("Invalid %s decoded body: %q", encoding, got)
+		}
+		if err := c.Visit(ts.URL + "/" + encoding + "?empty=1"); err != nil {
+			t.Errorf("Failed to visit empty %s response: %v", encoding, err)
+		}
+		c.responseCallbacks = nil
+	}
+}
+
+func TestXMLCharset(t *testing.T) {
+	latin1 := func(s string) []byte {
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/declaration.xml":
+			w.Header().Set("Content-Type", "application/xml")
+		case "/header.xml":
+			w.Header().Set("Content-Type", "text/xml; charset=ISO-8859-1")
+		case "/override.xml":
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.Write(latin1(`<?xml version="1.0" encoding="ISO-8859-1"?><feed><title>café</title></feed>`))
+	}))
+	defer ts.Close()
+
+	for _, p := range []string{"/declaration.xml", "/header.xml", "/override.xml"} {
+		c := NewCollector()
+		title := ""
+		c.OnRequest(func(r *Request) {
+			if r.URL.Path == "/override.xml" {
+				r.ResponseCharacterEncoding = "ISO-8859-1"
+			}
+		})
+		c.OnResponse(func(r *Response) {
+			if !bytes.Contains(r.Body, []byte(`encoding="UTF-8"`)) {
+				t.Errorf("%s: XML declaration was not updated: %q", p, r.Body)
+			}
+		})
+		c.OnXML("//title", func(e *XMLElement) {
+			title = e.Text
+		})
+		if err := c.Visit(ts.URL + p); err != nil {
+			t.Fatal(err)
+		}
+		if title != "café" {
+			t.Errorf("%s: invalid title %q", p, title)
+		}
+	}
+}
+
+func TestContentTypeSniffing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.Header()["Content-Type"] = nil
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		case "/forced":
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Sniffed</title></head></html>`))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit())
+	c.OnRequest(func(r *Request) {
+		if r.URL.Path == "/forced" {
+			r.ForceContentType("text/html")
+		}
+	})
+	for _, p := range []string{"/missing", "/plain", "/forced"} {
+		title := ""
+		c.OnHTML("title", func(e *HTMLElement) {
+			title = e.Text
+		})
+		if err := c.Visit(ts.URL + p); err != nil {
+			t.Fatal(err)
+		}
+		if title != "Sniffed" {
+			t.Errorf("OnHTML was not called for %s", p)
+		}
+		c.OnHTMLDetach("title")
+	}
+
+	r := &Response{Body: []byte("plain <html> text"), Headers: &http.Header{"Content-Type": []string{"text/plain; charset=latin1"}}}
+	r.fixContentType("")
+	if ct := r.Headers.Get("Content-Type"); ct != "text/plain; charset=latin1" {
+		t.Errorf("Plain text was sniffed as %s", ct)
+	}
+}
+
+func TestRequestRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	var parts []string
+	c.OnResponse(func(r *Response) {
+		if r.StatusCode != http.StatusPartialContent {
+			t.Errorf("Invalid status code %d", r.StatusCode)
+		}
+		parts = append(parts, string(r.Body))
+	})
+	if err := c.RequestRange(ts.URL, 2, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RequestRange(ts.URL, 15, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RequestRange(ts.URL, 5, 2); err != ErrInvalidRange {
+		t.Errorf("Invalid error %v, want %v", err, ErrInvalidRange)
+	}
+	if !reflect.DeepEqual(parts, []string{"2345", "fghij"}) {
+		t.Errorf("Invalid parts %q", parts)
+	}
+	if visited, _ := c.HasVisited(ts.URL); visited {
+		t.Error("Range request was marked as visited")
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	objects := map[string]string{
+		"/index.html": `<a href="page.html">page</a>`,
+		"/page.html":  `<p>page</p>`,
+	}
+	c := NewCollector()
+	err := c.RegisterScheme("mem", SchemeHandlerFunc(func(req *http.Request) (*http.Response, error) {
+		body, ok := objects[req.URL.Path]
+		res := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}
+		if !ok {
+			res.StatusCode = http.StatusNotFound
+		}
+		return res, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterScheme("http", nil); err != ErrInvalidScheme {
+		t.Errorf("Invalid error %v, want %v", err, ErrInvalidScheme)
+	}
+
+	var visited []string
+	c.OnHTML("a[href]", func(e *HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnResponse(func(r *Response) {
+		visited = append(visited, r.Request.URL.String())
+	})
+	var failed []string
+	c.OnError(func(r *Response, err error) {
+		failed = append(failed, r.Request.URL.String())
+	})
+	c.Visit("mem://bucket/index.html")
+	c.Visit("mem://bucket/missing.html")
+
+	if !reflect.DeepEqual(visited, []string{"mem://bucket/index.html", "mem://bucket/page.html"}) {
+		t.Errorf("Invalid visited URLs %v", visited)
+	}
+	if !reflect.DeepEqual(failed, []string{"mem://bucket/missing.html"}) {
+		t.Errorf("Invalid failed URLs %v", failed)
+	}
+}
+
+func TestResumeInterruptedResponse(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, "data.txt", time.Time{}, bytes.NewReader(content))
+			return
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write(content[:3000])
+		// close the connection in the middle of the body
+		panic(http.ErrAbortHandler)
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	if err := c.Visit(ts.URL + "/first"); err == nil {
+		t.Error("Interrupted response did not fail")
+	}
+
+	c = NewCollector(MaxResumeAttempts(2))
+	var body []byte
+	c.OnResponse(func(r *Response) {
+		body = r.Body
+	})
+	if err := c.Visit(ts.URL + "/second"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("Invalid resumed body of %d bytes", len(body))
+	}
+	if requests[len(requests)-1] != "bytes=3000-" {
+		t.Errorf("Invalid resume requests %q", requests)
+	}
+}
+
+func TestCollectorFingerprint(t *testing.T) {
+	article := `<html><head><title>Release notes</title><script>var session = "%s";</script></head><body>
+<h1>Release notes</h1>
+<p>This release improves the performance of the scheduler, adds support for
+compressed responses and fixes a number of bugs reported by the community.
+Upgrading is recommended for every user. The configuration format did not
+change, existing projects keep working without modifications.</p>
+<p>Generated at %s</p>
+</body></html>`
+	other := `<html><body><p>A completely different page about cooking pasta with tomatoes,
+garlic, olive oil and fresh basil leaves from the garden.</p></body></html>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/other":
+			w.Write([]byte(other))
+		case "/near":
+			fmt.Fprintf(w, article, r.URL.Query().Get("sid"), "2020-01-02")
+		default:
+			fmt.Fprintf(w, article, "", "2020-01-01")
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		fingerprint FingerprintType
+		duplicates  []string
+	}{
+		{NoFingerprint, nil},
+		{MD5Fingerprint, []string{"/article?sid=1"}},
+		{SimHashFingerprint, []string{"/article?sid=1", "/near?sid=2"}},
+	} {
+		c := NewCollector(Fingerprint(tc.fingerprint))
+		var responses int
+		var duplicates []string
+		c.OnResponse(func(r *Response) {
+			responses++
+		})
+		c.OnDuplicate(func(r *Response, originalURL string) {
+			if originalURL != ts.URL+"/article" {
+				t.Errorf("Invalid original URL %q", originalURL)
+			}
+			duplicates = append(duplicates, r.Request.URL.RequestURI())
+		})
+		for _, p := range []string{"/article", "/article?sid=1", "/near?sid=2", "/other"} {
+			c.Visit(ts.URL + p)
+		}
+		if !reflect.DeepEqual(duplicates, tc.duplicates) {
+			t.Errorf("Invalid duplicates %v of fingerprint %d, want %v", duplicates, tc.fingerprint, tc.duplicates)
+		}
+		if responses+len(duplicates) != 4 {
+			t.Errorf("Duplicates were processed")
+		}
+	}
+}
+
+func TestFrontierLimits(t *testing.T) {
+	var lock sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	var fastDone, slowDone time.Time
+	handler := func(name string, d time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			running[name]++
+			if running[name] > maxRunning[name] {
+				maxRunning[name] = running[name]
+			}
+			lock.Unlock()
+			time.Sleep(d)
+			lock.Lock()
+			running[name]--
+			if name == "fast" {
+				fastDone = time.Now()
+			} else {
+				slowDone = time.Now()
+			}
+			lock.Unlock()
+		}
+	}
+	slow := httptest.NewServer(handler("slow", 5*time.Millisecond))
+	defer slow.Close()
+	fast := httptest.NewServer(handler("fast", 0))
+	defer fast.Close()
+
+	c := NewCollector(Async(), AllowURLRevisit())
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 2})
+	for i := 0; i < 200; i++ {
+		c.Visit(fmt.Sprintf("%s/%d", slow.URL, i%10))
+	}
+	// waiting requests do not occupy goroutines
+	if n := runtime.NumGoroutine(); n > 100 {
+		t.Errorf("%d goroutines are running", n)
+	}
+	for i := 0; i < 5; i++ {
+		c.Visit(fmt.Sprintf("%s/%d", fast.URL, i))
+	}
+	c.Wait()
+
+	if maxRunning["slow"] != 2 || maxRunning["fast"] > 2 {
+		t.Errorf("Invalid parallelism %v", maxRunning)
+	}
+	if !fastDone.Before(slowDone) {
+		t.Error("Requests of the fast host waited for the slow host")
+	}
+}
+
+func TestLimitRulePerHost(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+	})
+	ts1 := httptest.NewServer(handler)
+	defer ts1.Close()
+	ts2 := httptest.NewServer(handler)
+	defer ts2.Close()
+
+	for _, perHost := range []bool{false, true} {
+		maxRunning = 0
+		c := NewCollector(Async())
+		c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1, PerHost: perHost})
+		for i := 0; i < 5; i++ {
+			c.Visit(fmt.Sprintf("%s/%d", ts1.URL, i))
+			c.Visit(fmt.Sprintf("%s/%d", ts2.URL, i))
+		}
+		c.Wait()
+		expected := 1
+		if perHost {
+			expected = 2
+		}
+		if maxRunning != expected {
+			t.Errorf("Invalid parallelism of the hosts with PerHost %v: %d", perHost, maxRunning)
+		}
+	}
+}
+
+func TestLimitRuleURLPatterns(t *testing.T) {
+	rules := []*LimitRule{
+		{DomainGlob: "*", Parallelism: 4},
+		{PathPrefix: "/search", Parallelism: 1, Priority: 1},
+		{DomainGlob: "*example.com*", URLRegexp: `\.(css|js)$`, Parallelism: 8, Priority: 2},
+		{URLRegexp: `\?page=`, Parallelism: 2, Priority: 1},
+	}
+	c := NewCollector()
+	if err := c.Limits(rules); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]*LimitRule{
+		"http://example.com/":                 rules[0],
+		"http://example.com/search?q=1":       rules[1],
+		"http://example.com/search?page=2":    rules[1],
+		"http://example.com/list?page=2":      rules[3],
+		"http://example.com/search/style.css": rules[2],
+		"http://example.org/style.css":        rules[0],
+		"http://example.org/search":           rules[1],
+	}
+	for u, rule := range tests {
+		parsed, _ := url.Parse(u)
+		if r := c.backend.matchingURLRule(parsed); r != rule {
+			t.Errorf("Invalid rule of %s: %+v", u, r)
+		}
+	}
+	if r := c.backend.GetMatchingRule("example.com"); r != rules[0] {
+		t.Errorf("Rule with URL pattern was returned for a domain: %+v", r)
+	}
+	if err := c.Limit(&LimitRule{URLRegexp: "("}); err == nil {
+		t.Error("Invalid URLRegexp was accepted")
+	}
+
+	var lock sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(r.URL.Path, "/")[1]
+		lock.Lock()
+		running[name]++
+		if running[name] > maxRunning[name] {
+			maxRunning[name] = running[name]
+		}
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		running[name]--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c = NewCollector(Async())
+	c.Limits([]*LimitRule{
+		{DomainGlob: "*", Parallelism: 4},
+		{PathPrefix: "/search", Parallelism: 1, Priority: 1},
+	})
+	for i := 0; i < 20; i++ {
+		c.Visit(fmt.Sprintf("%s/search/%d", ts.URL, i))
+		c.Visit(fmt.Sprintf("%s/static/%d", ts.URL, i))
+	}
+	c.Wait()
+	if maxRunning["search"] != 1 || maxRunning["static"] != 4 {
+		t.Errorf("Invalid parallelism %v", maxRunning)
+	}
+}
+
+func TestUpdateLimitRule(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCollector(Async())
+	rule := &LimitRule{DomainGlob: "*", Parallelism: 1}
+	if err := c.Limit(rule); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		c.Visit(fmt.Sprintf("%s/%d", ts.URL, i))
+	}
+	time.Sleep(5 * time.Millisecond)
+	stats := c.LimitRuleStats()
+	if len(stats) != 1 || stats[0].Rule != rule || stats[0].Running != 1 || stats[0].Waiting != 9 || stats[0].Hosts != 1 {
+		t.Errorf("Invalid stats: %+v", stats)
+	}
+
+	faster := *rule
+	faster.Parallelism = 5
+	if err := c.UpdateLimitRule(rule, &faster); err != nil {
+		t.Fatal(err)
+	}
+	if rules := c.LimitRules(); len(rules) != 1 || rules[0] != &faster {
+		t.Errorf("Rule was not replaced: %v", rules)
+	}
+	c.Wait()
+	if maxRunning != 5 {
+		t.Errorf("Invalid parallelism after the update: %d", maxRunning)
+	}
+	if stats := c.LimitRuleStats(); stats[0].Waiting != 0 || stats[0].Running != 0 {
+		t.Errorf("Invalid stats: %+v", stats)
+	}
+
+	if err := c.UpdateLimitRule(rule, &faster); err != ErrUnknownLimitRule {
+		t.Errorf("Expected ErrUnknownLimitRule, got %v", err)
+	}
+	if err := c.Limit(&LimitRule{}); err != ErrNoPattern {
+		t.Errorf("Expected ErrNoPattern, got %v", err)
+	}
+	if len(c.LimitRules()) != 1 {
+		t.Error("Invalid rule was registered")
+	}
+}
+
+func TestRemoveLimitRule(t *testing.T) {
+	var lock sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(r.URL.Path, "/")[1]
+		lock.Lock()
+		running[name]++
+		if running[name] > maxRunning[name] {
+			maxRunning[name] = running[name]
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		running[name]--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCollector(Async())
+	search := &LimitRule{PathPrefix: "/search", Parallelism: 1, Priority: 1}
+	c.Limits([]*LimitRule{
+		{DomainGlob: "*", Parallelism: 3},
+		search,
+	})
+	for i := 0; i < 10; i++ {
+		c.Visit(fmt.Sprintf("%s/search/%d", ts.URL, i))
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := c.RemoveLimitRule(search); err != nil {
+		t.Fatal(err)
+	}
+	// the waiting requests are limited by the remaining rule, the
+	// running request of the removed rule is not counted
+	c.Wait()
+	if maxRunning["search"] != 4 {
+		t.Errorf("Invalid parallelism after the removal: %v", maxRunning)
+	}
+	if stats := c.LimitRuleStats(); len(stats) != 1 || stats[0].Rule.DomainGlob != "*" {
+		t.Errorf("Invalid stats: %+v", stats)
+	}
+	if err := c.RemoveLimitRule(search); err != ErrUnknownLimitRule {
+		t.Errorf("Expected ErrUnknownLimitRule, got %v", err)
+	}
+}
+
 func TestCollectorDepth(t *testing.T) {
 	ts := newTestServer()
 	defer ts.Close()
@@ -1370,3 +2156,24 @@ func BenchmarkOnResponse(b *testing.B) {
 		c.Visit(ts.URL)
 	}
 }
+
+func TestRevisit(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := NewCollector()
+	visits := 0
+	c.OnResponse(func(r *Response) {
+		visits++
+	})
+	c.Visit(ts.URL + "/")
+	if err := c.Visit(ts.URL + "/"); err != ErrAlreadyVisited {
+		t.Errorf("Expected ErrAlreadyVisited, got %v", err)
+	}
+	if err := c.Revisit(ts.URL + "/"); err != nil {
+		t.Error(err)
+	}
+	if visits != 2 {
+		t.Errorf("Expected 2 visits, got %d", visits)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collytest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/har"
+)
+
+func TestSiteAndRecorder(t *testing.T) {
+	site := NewSite()
+	defer site.Close()
+	site.HTML("/", `<a href="/item/1">1</a><a href="/item/2">2</a><a href="/slow">slow</a>`)
+	site.HTML("/item/1", `<h1>Item 1</h1>`)
+	site.Page("/item/2").WithStatus(500)
+	site.HTML("/slow", `<h1>Slow</h1>`).WithDelay(50 * time.Millisecond)
+
+	c := colly.NewCollector()
+	rec := NewRecorder(c)
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		rec.Emit(e.Text)
+	})
+
+	start := time.Now()
+	c.Visit(site.URL("/"))
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Page delay was not applied")
+	}
+
+	rec.AssertVisited(t, "/", site.URL("/item/1"), "/item/2", "/slow")
+	rec.AssertNotVisited(t, "/item/3")
+	rec.AssertVisitCount(t, 4)
+	rec.AssertItems(t, "Slow", "Item 1")
+	if rec.Err("/item/2") == nil || rec.Err("/item/1") != nil {
+		t.Error("Invalid recorded errors")
+	}
+	if site.Hits("/item/1") != 1 {
+		t.Errorf("Hits(/item/1) = %d, want 1", site.Hits("/item/1"))
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	site := NewSite()
+	defer site.Close()
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		site.HTML(p, `<h1>ok</h1>`)
+	}
+
+	ft := NewFaultTransport(1)
+	ft.Latency = 10 * time.Millisecond
+	ft.Next(ResetFault, ServerErrorFault, TruncateFault)
+	c := colly.NewCollector()
+	c.WithTransport(ft)
+	rec := NewRecorder(c)
+	start := time.Now()
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		c.Visit(site.URL(p))
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Error("Latency was not injected")
+	}
+	for p, failed := range map[string]bool{"/1": true, "/2": true, "/3": true, "/4": false} {
+		if (rec.Err(p) != nil) != failed {
+			t.Errorf("Invalid error of %s: %v", p, rec.Err(p))
+		}
+	}
+	if site.Hits("/1") != 0 || site.Hits("/3") != 1 {
+		t.Error("Invalid hits of the faulty requests")
+	}
+	for _, f := range []Fault{ResetFault, ServerErrorFault, TruncateFault} {
+		if n := ft.Injected(f); n != 1 {
+			t.Errorf("%s fault was injected %d times", f, n)
+		}
+	}
+
+	faults := func() []int {
+		ft := NewFaultTransport(7)
+		ft.ErrorRate = 0.5
+		c := colly.NewCollector(colly.AllowURLRevisit())
+		c.WithTransport(ft)
+		var statuses []int
+		c.OnError(func(r *colly.Response, err error) {
+			statuses = append(statuses, r.StatusCode)
+		})
+		c.OnResponse(func(r *colly.Response) {
+			statuses = append(statuses, r.StatusCode)
+		})
+		for i := 0; i < 20; i++ {
+			c.Visit(site.URL("/1"))
+		}
+		return statuses
+	}
+	first, second := faults(), faults()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Faults are not deterministic: %v != %v", first, second)
+	}
+}
+
+func TestNewSiteFromHAR(t *testing.T) {
+	live := NewSite()
+	live.HTML("/", `<a href="/item?id=1">1</a><a href="`+live.URL("/gone")+`">gone</a>`)
+	live.HTML("/item?id=1", `<h1>Item 1</h1>`).WithDelay(30 * time.Millisecond)
+	live.Page("/gone").WithStatus(410)
+
+	c := colly.NewCollector()
+	recorder := har.NewRecorder(c)
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.Visit(live.URL("/"))
+	live.Close()
+
+	site, err := NewSiteFromHAR(recorder.HAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer site.Close()
+	c = colly.NewCollector()
+	rec := NewRecorder(c)
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		rec.Emit(e.Text)
+	})
+	start := time.Now()
+	c.Visit(site.URL("/"))
+
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("Recorded latency was not replayed")
+	}
+	rec.AssertVisited(t, "/", "/item?id=1", "/gone")
+	rec.AssertItems(t, "Item 1")
+	if site.Hits("/gone") != 1 {
+		t.Error("Absolute links were not rewritten to the mock site")
+	}
+	if rec.Err("/gone") == nil {
+		t.Error("Recorded status code was not replayed")
+	}
+}
+
+func harEntry(u string, status int, body string) *har.Entry {
+	return &har.Entry{
+		Request: &har.Request{Method: "GET", URL: u},
+		Response: &har.Response{
+			Status:  status,
+			Headers: []*har.NameValue{{Name: "Content-Type", Value: "text/html"}},
+			Content: &har.Content{Text: body},
+		},
+	}
+}
+
+func TestHARFixtures(t *testing.T) {
+	h := &har.HAR{Log: &har.Log{Entries: []*har.Entry{
+		harEntry("https://example.com/", 200, "first"),
+		harEntry("https://cdn.example.com/", 200, "cdn"),
+		harEntry("http://example.com/", 200, "plain"),
+		harEntry("https://example.com/", 500, "second"),
+		harEntry("https://example.com/?page=2", 404, "page 2"),
+	}}}
+	fixtures, err := HARFixtures(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range fixtures {
+		got = append(got, f.Origin()+f.Path()+" "+string(f.Page.Body))
+	}
+	expected := []string{
+		"https://example.com/ first",
+		"https://cdn.example.com/ cdn",
+		"http://example.com/ plain",
+		"https://example.com/?page=2 page 2",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected fixtures: %v", got)
+	}
+	if _, err := NewSiteFromHAR(h); err == nil {
+		t.Error("Conflicting paths of different origins were not reported")
+	}
+}
+
+func TestNewSiteFromMultiOriginHAR(t *testing.T) {
+	h := &har.HAR{Log: &har.Log{Entries: []*har.Entry{
+		harEntry("https://example.com/", 200, `<a href="https://cdn.example.com/item">item</a>`),
+		harEntry("https://cdn.example.com/item", 200, `<h1>Item</h1>`),
+		harEntry("https://example.com/missing", 404, ""),
+	}}}
+	site, err := NewSiteFromHAR(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer site.Close()
+
+	c := colly.NewCollector()
+	rec := NewRecorder(c)
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		rec.Emit(e.Text)
+	})
+	c.Visit(site.URL("/"))
+	c.Visit(site.URL("/missing"))
+
+	rec.AssertVisited(t, "/", "/item", "/missing")
+	rec.AssertItems(t, "Item")
+	if rec.Err("/missing") == nil {
+		t.Error("Recorded status code was not replayed")
+	}
+}
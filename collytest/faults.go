@@ -0,0 +1,218 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collytest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault is a failure injected by FaultTransport
+type Fault int
+
+const (
+	// NoFault passes the response through unchanged
+	NoFault Fault = iota
+	// ResetFault fails the request with a connection reset error
+	ResetFault
+	// ServerErrorFault replaces the response with a 5xx response
+	ServerErrorFault
+	// TruncateFault cuts the response body in half. Reading the rest of
+	// the body returns io.ErrUnexpectedEOF.
+	TruncateFault
+)
+
+// String returns the name of the fault
+func (f Fault) String() string {
+	switch f {
+	case ResetFault:
+		return "reset"
+	case ServerErrorFault:
+		return "server error"
+	case TruncateFault:
+		return "truncate"
+	}
+	return "none"
+}
+
+// FaultTransport is a http.RoundTripper injecting latency and failures
+// into the responses of the wrapped transport to test the retry,
+// circuit breaker and pipeline behavior of scrapers:
+//
+//	ft := collytest.NewFaultTransport(42)
+//	ft.ErrorRate = 0.2
+//	ft.Next(collytest.ResetFault, collytest.TruncateFault)
+//	c.WithTransport(ft)
+//
+// The faults are chosen by a random generator with a fixed seed, so the
+// same sequence of requests gets the same faults in every run.
+type FaultTransport struct {
+	// Transport is the wrapped transport. http.DefaultTransport is used
+	// if it is nil.
+	Transport http.RoundTripper
+	// Latency delays every request
+	Latency time.Duration
+	// LatencyJitter is the maximum random latency added to Latency
+	LatencyJitter time.Duration
+	// ResetRate is the probability of a ResetFault
+	ResetRate float64
+	// ErrorRate is the probability of a ServerErrorFault
+	ErrorRate float64
+	// ErrorStatus is the status code of the injected server errors.
+	// Default is 503.
+	ErrorStatus int
+	// TruncateRate is the probability of a TruncateFault
+	TruncateRate float64
+	// Match restricts the faults to the matching requests if it is set
+	Match    func(req *http.Request) bool
+	rng      *rand.Rand
+	script   []Fault
+	injected map[Fault]int
+	lock     sync.Mutex
+}
+
+// NewFaultTransport creates a FaultTransport using the seed for its
+// random decisions
+func NewFaultTransport(seed int64) *FaultTransport {
+	return &FaultTransport{
+		rng:      rand.New(rand.NewSource(seed)),
+		injected: make(map[Fault]int),
+	}
+}
+
+// Next schedules faults for the next matching requests. Scheduled faults
+// take precedence over the random ones.
+func (t *FaultTransport) Next(faults ...Fault) {
+	t.lock.Lock()
+	t.script = append(t.script, faults...)
+	t.lock.Unlock()
+}
+
+// Injected returns the number of times the fault was injected
+func (t *FaultTransport) Injected(f Fault) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.injected[f]
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, delay := t.next(req)
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	switch fault {
+	case ResetFault:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case ServerErrorFault:
+		status := t.ErrorStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		body := http.StatusText(status)
+		return &http.Response{
+			Status:        strconv.Itoa(status) + " " + body,
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain"}},
+			Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil || fault != TruncateFault {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &truncatedBody{r: bytes.NewReader(body[:len(body)/2])}
+	return res, nil
+}
+
+// next chooses the fault and the latency of a request
+func (t *FaultTransport) next(req *http.Request) (Fault, time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.rng == nil {
+		t.rng = rand.New(rand.NewSource(1))
+		t.injected = make(map[Fault]int)
+	}
+	delay := t.Latency
+	if t.LatencyJitter > 0 {
+		delay += time.Duration(t.rng.Int63n(int64(t.LatencyJitter)))
+	}
+	if t.Match != nil && !t.Match(req) {
+		return NoFault, delay
+	}
+	fault := NoFault
+	if len(t.script) > 0 {
+		fault = t.script[0]
+		t.script = t.script[1:]
+	} else {
+		p := t.rng.Float64()
+		switch {
+		case p < t.ResetRate:
+			fault = ResetFault
+		case p < t.ResetRate+t.ErrorRate:
+			fault = ServerErrorFault
+		case p < t.ResetRate+t.ErrorRate+t.TruncateRate:
+			fault = TruncateFault
+		}
+	}
+	if fault != NoFault {
+		t.injected[fault]++
+	}
+	return fault, delay
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF at the end of its content
+type truncatedBody struct {
+	r *bytes.Reader
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return nil
+}
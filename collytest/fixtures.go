@@ -0,0 +1,171 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collytest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gocolly/colly/v2/har"
+)
+
+// Fixture is a page of a recorded crawl
+type Fixture struct {
+	// URL is the original URL of the page
+	URL *url.URL
+	// Page is the recorded response
+	Page *Page
+}
+
+// Path returns the path of the fixture including the query string
+func (f *Fixture) Path() string {
+	return f.URL.RequestURI()
+}
+
+// Origin returns the scheme and host of the original URL
+func (f *Fixture) Origin() string {
+	return f.URL.Scheme + "://" + f.URL.Host
+}
+
+// skippedHARHeaders are not replayed because the recorded bodies are
+// already decoded or the headers are set by the test server
+var skippedHARHeaders = map[string]bool{
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Date":              true,
+}
+
+// HARFixtures converts the responses of a HAR recording, e.g. of
+// har.Recorder, to fixtures preserving their paths, status codes,
+// headers, bodies and latencies. Failed round trips are skipped.
+// If a URL was requested multiple times the first response is kept.
+// Redirects followed by the Collector are recorded as the response of
+// the final URL only.
+func HARFixtures(h *har.HAR) ([]*Fixture, error) {
+	var fixtures []*Fixture
+	seen := make(map[string]bool)
+	if h.Log == nil {
+		return nil, nil
+	}
+	for _, e := range h.Log.Entries {
+		if e.Error != "" || e.Request == nil || e.Response == nil || e.Response.Status == 0 {
+			continue
+		}
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+		key := u.Scheme + "://" + u.Host + u.RequestURI()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		p := &Page{
+			Status:  e.Response.Status,
+			Headers: http.Header{},
+		}
+		for _, h := range e.Response.Headers {
+			k := http.CanonicalHeaderKey(h.Name)
+			if !skippedHARHeaders[k] {
+				p.Headers.Add(k, h.Value)
+			}
+		}
+		if c := e.Response.Content; c != nil {
+			if c.Encoding == "base64" {
+				if p.Body, err = base64.StdEncoding.DecodeString(c.Text); err != nil {
+					return nil, err
+				}
+			} else {
+				p.Body = []byte(c.Text)
+			}
+		}
+		if e.Timings != nil && e.Timings.Wait > 0 {
+			p.Delay = time.Duration(e.Timings.Wait * float64(time.Millisecond))
+		}
+		fixtures = append(fixtures, &Fixture{URL: u, Page: p})
+	}
+	return fixtures, nil
+}
+
+// CheckFixturePaths returns an error if fixtures of different origins
+// have the same path, because a Site serves the pages of every origin
+// by their paths.
+func CheckFixturePaths(fixtures []*Fixture) error {
+	origins := make(map[string]string)
+	for _, f := range fixtures {
+		if o, ok := origins[f.Path()]; ok && o != f.Origin() {
+			return fmt.Errorf("Path %s is recorded for both %s and %s", f.Path(), o, f.Origin())
+		}
+		origins[f.Path()] = f.Origin()
+	}
+	return nil
+}
+
+// NewSiteFromHAR starts a test site serving the responses of a HAR
+// recording. The absolute URLs of the recorded hosts in the bodies and
+// Location headers are rewritten to the URL of the site. The recording
+// can contain multiple hosts, e.g. a CDN, if their paths do not
+// conflict. See CheckFixturePaths.
+func NewSiteFromHAR(h *har.HAR) (*Site, error) {
+	fixtures, err := HARFixtures(h)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckFixturePaths(fixtures); err != nil {
+		return nil, err
+	}
+	s := NewSite()
+	origins := make(map[string]bool)
+	for _, f := range fixtures {
+		s.lock.Lock()
+		s.pages[f.Path()] = f.Page
+		s.lock.Unlock()
+		origins[f.Origin()] = true
+	}
+	for origin := range origins {
+		s.RewriteOrigin(origin)
+	}
+	return s, nil
+}
+
+// LoadSite starts a test site serving the responses of a HAR file
+func LoadSite(fileName string) (*Site, error) {
+	h, err := har.Load(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewSiteFromHAR(h)
+}
+
+// RewriteOrigin replaces the origin (e.g. "https://example.com") in
+// the bodies and Location headers of the registered fixtures with the
+// URL of the site, so the links of recorded pages point to the site
+func (s *Site) RewriteOrigin(origin string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	from, to := []byte(origin), []byte(s.Server.URL)
+	for _, p := range s.pages {
+		p.Body = bytes.Replace(p.Body, from, to, -1)
+		if l := p.Headers.Get("Location"); l != "" {
+			p.Headers.Set("Location", string(bytes.Replace([]byte(l), from, to, -1)))
+		}
+	}
+}
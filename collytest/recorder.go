@@ -0,0 +1,165 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collytest
+
+import (
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Recorder records the URLs visited by a Collector, the errors and the
+// items emitted by the callbacks under test
+type Recorder struct {
+	visited []*url.URL
+	failed  map[string]error
+	items   []interface{}
+	lock    *sync.RWMutex
+}
+
+// NewRecorder creates a Recorder and attaches it to the Collector
+func NewRecorder(c *colly.Collector) *Recorder {
+	r := &Recorder{
+		failed: make(map[string]error),
+		lock:   &sync.RWMutex{},
+	}
+	c.OnResponse(func(resp *colly.Response) {
+		r.lock.Lock()
+		r.visited = append(r.visited, resp.Request.URL)
+		r.lock.Unlock()
+	})
+	c.OnError(func(resp *colly.Response, err error) {
+		r.lock.Lock()
+		r.visited = append(r.visited, resp.Request.URL)
+		r.failed[resp.Request.URL.String()] = err
+		r.lock.Unlock()
+	})
+	return r
+}
+
+// Emit records an extracted item. Call it from the callbacks under test.
+func (r *Recorder) Emit(item interface{}) {
+	r.lock.Lock()
+	r.items = append(r.items, item)
+	r.lock.Unlock()
+}
+
+// Visited returns the absolute URLs of the visited pages in the order of
+// the responses
+func (r *Recorder) Visited() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := make([]string, len(r.visited))
+	for i, u := range r.visited {
+		res[i] = u.String()
+	}
+	return res
+}
+
+// Items returns the emitted items in the order of emission
+func (r *Recorder) Items() []interface{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]interface{}(nil), r.items...)
+}
+
+// Err returns the error of a visited URL or nil if it succeeded
+func (r *Recorder) Err(URL string) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, u := range r.visited {
+		if matchURL(u, URL) {
+			return r.failed[u.String()]
+		}
+	}
+	return nil
+}
+
+// HasVisited checks whether the URL has been visited. URL can be either
+// absolute or a path with optional query string like "/items?page=2".
+func (r *Recorder) HasVisited(URL string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, u := range r.visited {
+		if matchURL(u, URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertVisited reports an error if any of the URLs has not been visited
+func (r *Recorder) AssertVisited(t testing.TB, URLs ...string) {
+	t.Helper()
+	for _, u := range URLs {
+		if !r.HasVisited(u) {
+			t.Errorf("%s was not visited, visited URLs: %v", u, r.Visited())
+		}
+	}
+}
+
+// AssertNotVisited reports an error if any of the URLs has been visited
+func (r *Recorder) AssertNotVisited(t testing.TB, URLs ...string) {
+	t.Helper()
+	for _, u := range URLs {
+		if r.HasVisited(u) {
+			t.Errorf("%s should not have been visited", u)
+		}
+	}
+}
+
+// AssertVisitCount reports an error if the number of visited URLs differs
+func (r *Recorder) AssertVisitCount(t testing.TB, n int) {
+	t.Helper()
+	if visited := r.Visited(); len(visited) != n {
+		t.Errorf("%d URLs visited, want %d: %v", len(visited), n, visited)
+	}
+}
+
+// AssertItems reports an error if the emitted items are not deeply equal
+// to the expected ones. The order of the items is not checked, because it
+// is not deterministic in async mode.
+func (r *Recorder) AssertItems(t testing.TB, want ...interface{}) {
+	t.Helper()
+	got := r.Items()
+	if len(got) != len(want) {
+		t.Errorf("%d items emitted, want %d: %v", len(got), len(want), got)
+		return
+	}
+	used := make([]bool, len(got))
+	for _, w := range want {
+		found := false
+		for i, g := range got {
+			if !used[i] && reflect.DeepEqual(g, w) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Item %#v was not emitted, emitted items: %v", w, got)
+		}
+	}
+}
+
+func matchURL(u *url.URL, URL string) bool {
+	if u.String() == URL {
+		return true
+	}
+	return len(URL) > 0 && URL[0] == '/' && u.RequestURI() == URL
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collytest implements utilities to unit test scrapers built
+// with colly: a fixture based test site and a recorder with assertions
+// for visited URLs and extracted items.
+//
+//	site := collytest.NewSite()
+//	defer site.Close()
+//	site.HTML("/", `<a href="/item/1">item</a>`)
+//	site.HTML("/item/1", `<h1>Item 1</h1>`)
+//	site.Page("/item/2").WithStatus(404)
+//
+//	c := colly.NewCollector()
+//	rec := collytest.NewRecorder(c)
+//	c.OnHTML("a[href]", func(e *colly.HTMLElement) { e.Request.Visit(e.Attr("href")) })
+//	c.OnHTML("h1", func(e *colly.HTMLElement) { rec.Emit(e.Text) })
+//	c.Visit(site.URL("/"))
+//
+//	rec.AssertVisited(t, "/", "/item/1")
+//	rec.AssertItems(t, "Item 1")
+//
+// NewSiteFromHAR creates a Site replaying a crawl recorded by har.Recorder.
+// The "colly fixtures" command generates the Go code of such a Site.
+//
+// FaultTransport injects deterministic network faults into the requests
+// of a Collector.
+package collytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Site is a test HTTP server serving registered fixtures.
+// Unregistered paths return 404.
+type Site struct {
+	*httptest.Server
+	pages map[string]*Page
+	hits  map[string]int
+	lock  *sync.RWMutex
+}
+
+// Page is a fixture served by a Site
+type Page struct {
+	// Status is the status code of the response. Default is 200.
+	Status int
+	// Headers are the response headers
+	Headers http.Header
+	// Body is the response body
+	Body []byte
+	// Delay is the latency of the response
+	Delay time.Duration
+	// Handler overrides the static fixture if it is set
+	Handler http.HandlerFunc
+}
+
+// NewSite starts a new test site
+func NewSite() *Site {
+	s := &Site{
+		pages: make(map[string]*Page),
+		hits:  make(map[string]int),
+		lock:  &sync.RWMutex{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URL returns the absolute URL of a path of the site
+func (s *Site) URL(path string) string {
+	return s.Server.URL + path
+}
+
+// Page registers an empty fixture for the path and returns it for
+// further configuration. Path can contain a query string.
+func (s *Site) Page(path string) *Page {
+	p := &Page{
+		Status:  http.StatusOK,
+		Headers: http.Header{},
+	}
+	s.lock.Lock()
+	s.pages[path] = p
+	s.lock.Unlock()
+	return p
+}
+
+// HTML registers a HTML fixture for the path
+func (s *Site) HTML(path, body string) *Page {
+	return s.Page(path).WithContentType("text/html; charset=utf-8").WithBody(body)
+}
+
+// XML registers a XML fixture for the path
+func (s *Site) XML(path, body string) *Page {
+	return s.Page(path).WithContentType("application/xml").WithBody(body)
+}
+
+// Redirect registers a redirect from path to target
+func (s *Site) Redirect(path, target string, status int) *Page {
+	return s.Page(path).WithStatus(status).WithHeader("Location", target)
+}
+
+// Hits returns the number of requests received for the path
+func (s *Site) Hits(path string) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.hits[path]
+}
+
+// WithStatus sets the status code of the fixture
+func (p *Page) WithStatus(status int) *Page {
+	p.Status = status
+	return p
+}
+
+// WithBody sets the body of the fixture
+func (p *Page) WithBody(body string) *Page {
+	p.Body = []byte(body)
+	return p
+}
+
+// WithContentType sets the Content-Type header of the fixture
+func (p *Page) WithContentType(contentType string) *Page {
+	return p.WithHeader("Content-Type", contentType)
+}
+
+// WithHeader adds a response header to the fixture
+func (p *Page) WithHeader(key, value string) *Page {
+	p.Headers.Add(key, value)
+	return p
+}
+
+// WithDelay sets the latency of the fixture
+func (p *Page) WithDelay(d time.Duration) *Page {
+	p.Delay = d
+	return p
+}
+
+// WithHandler replaces the static fixture with a custom handler
+func (p *Page) WithHandler(h http.HandlerFunc) *Page {
+	p.Handler = h
+	return p
+}
+
+func (s *Site) serve(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	path := r.URL.RequestURI()
+	p, ok := s.pages[path]
+	if !ok {
+		path = r.URL.Path
+		p, ok = s.pages[path]
+	}
+	s.hits[path]++
+	s.lock.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if p.Delay > 0 {
+		select {
+		case <-time.After(p.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if p.Handler != nil {
+		p.Handler(w, r)
+		return
+	}
+	for k, vs := range p.Headers {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(p.Status)
+	w.Write(p.Body)
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commoncrawl discovers the URLs of a domain from the URL index
+// of Common Crawl to seed a crawl without discovering the site by
+// following its links:
+//
+//	i := &commoncrawl.Index{Limit: 10000}
+//	if err := i.Seed(c, "example.com"); err != nil {
+//		log.Fatal(err)
+//	}
+//	c.Wait()
+//
+// The index is queried by a clone of the Collector, so the Collector
+// does not have to allow the domain of the index.
+package commoncrawl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// DefaultURL is the address of the Common Crawl index server
+const DefaultURL = "https://index.commoncrawl.org"
+
+// ErrNoCollection is returned if the index server lists no collection
+var ErrNoCollection = errors.New("No Common Crawl collection found")
+
+// Index queries the URL index of a Common Crawl collection
+type Index struct {
+	// URL is the address of the index server. DefaultURL is used if it
+	// is empty.
+	URL string
+	// Collection is the crawl to query, e.g. "CC-MAIN-2024-10". The
+	// latest crawl is queried if it is empty.
+	Collection string
+	// Subdomains includes the URLs of the subdomains of the domain
+	Subdomains bool
+	// MimeTypes restricts the URLs to captures of these content types,
+	// e.g. "text/html", if it is not empty
+	MimeTypes []string
+	// AllStatusCodes includes the URLs of redirects and errors. Only the
+	// URLs of successful captures are listed by default.
+	AllStatusCodes bool
+	// Limit is the maximum number of URLs. Zero means no limit.
+	Limit int
+}
+
+// capture is a line of the JSON output of the index
+type capture struct {
+	URL    string `json:"url"`
+	Mime   string `json:"mime"`
+	Status string `json:"status"`
+}
+
+// collection is an entry of the collection list of the index server
+type collection struct {
+	ID     string `json:"id"`
+	CDXAPI string `json:"cdx-api"`
+}
+
+// URLs returns the unique URLs of a domain captured by the collection
+// in the order of the index
+func (i *Index) URLs(c *colly.Collector, domain string) ([]string, error) {
+	sc := c.Clone()
+	sc.Async = false
+	sc.AllowURLRevisit = true
+	sc.AllowedDomains = nil
+	sc.URLFilters = nil
+	sc.DisallowedURLFilters = nil
+	sc.MaxDepth = 0
+	// the index answers 404 if the domain has no captures
+	sc.ParseHTTPErrorResponse = true
+	var body []byte
+	var status int
+	sc.OnResponse(func(r *colly.Response) {
+		body, status = r.Body, r.StatusCode
+	})
+	get := func(u string) ([]byte, error) {
+		body, status = nil, 0
+		if err := sc.Visit(u); err != nil {
+			return nil, err
+		}
+		if status == http.StatusNotFound {
+			return nil, nil
+		}
+		if status >= 300 {
+			return nil, fmt.Errorf("Common Crawl index returned %d", status)
+		}
+		return body, nil
+	}
+	api, err := i.api(get)
+	if err != nil {
+		return nil, err
+	}
+	base := api + "?url=" + url.QueryEscape(i.pattern(domain))
+	pageInfo, err := get(i.query(base, -1))
+	if err != nil {
+		return nil, err
+	}
+	pages := 1
+	if pageInfo != nil {
+		var info struct {
+			Pages int `json:"pages"`
+		}
+		if err := json.Unmarshal(pageInfo, &info); err == nil && info.Pages > 0 {
+			pages = info.Pages
+		}
+	}
+	var urls []string
+	seen := make(map[string]bool)
+	for page := 0; page < pages; page++ {
+		b, err := get(i.query(base, page))
+		if err != nil {
+			return urls, err
+		}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for s.Scan() {
+			var cp capture
+			if json.Unmarshal(s.Bytes(), &cp) != nil || cp.URL == "" || seen[cp.URL] || !i.accepts(cp) {
+				continue
+			}
+			seen[cp.URL] = true
+			urls = append(urls, cp.URL)
+			if i.Limit > 0 && len(urls) >= i.Limit {
+				return urls, nil
+			}
+		}
+	}
+	return urls, nil
+}
+
+// Seed visits the URLs of a domain captured by the collection by the
+// Collector
+func (i *Index) Seed(c *colly.Collector, domain string) error {
+	urls, err := i.URLs(c, domain)
+	for _, u := range urls {
+		c.Visit(u)
+	}
+	return err
+}
+
+func (i *Index) baseURL() string {
+	if i.URL != "" {
+		return strings.TrimSuffix(i.URL, "/")
+	}
+	return DefaultURL
+}
+
+// api returns the address of the CDX API of the collection
+func (i *Index) api(get func(string) ([]byte, error)) (string, error) {
+	if i.Collection != "" {
+		return i.baseURL() + "/" + i.Collection + "-index", nil
+	}
+	b, err := get(i.baseURL() + "/collinfo.json")
+	if err != nil {
+		return "", err
+	}
+	var collections []collection
+	if err := json.Unmarshal(b, &collections); err != nil {
+		return "", err
+	}
+	// the latest collection is the first
+	if len(collections) == 0 || collections[0].CDXAPI == "" {
+		return "", ErrNoCollection
+	}
+	return collections[0].CDXAPI, nil
+}
+
+// pattern returns the URL pattern of the domain
+func (i *Index) pattern(domain string) string {
+	if i.Subdomains {
+		return "*." + domain
+	}
+	return domain + "/*"
+}
+
+// query returns the address of a page of the results of the base query.
+// The page -1 requests the number of pages.
+func (i *Index) query(base string, page int) string {
+	q := url.Values{}
+	q.Set("output", "json")
+	if page < 0 {
+		q.Set("showNumPages", "true")
+	} else {
+		q.Set("page", strconv.Itoa(page))
+	}
+	if !i.AllStatusCodes {
+		q.Set("filter", "=status:200")
+	}
+	return base + "&" + q.Encode()
+}
+
+// accepts returns true if the capture has one of the MimeTypes
+func (i *Index) accepts(c capture) bool {
+	if len(i.MimeTypes) == 0 {
+		return true
+	}
+	for _, m := range i.MimeTypes {
+		if strings.EqualFold(m, c.Mime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commoncrawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newIndexServer(t *testing.T, site string) *httptest.Server {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+	mux.HandleFunc("/collinfo.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":"CC-MAIN-2024-10","cdx-api":"%[1]s/CC-MAIN-2024-10-index"},{"id":"CC-MAIN-2023-50","cdx-api":"%[1]s/CC-MAIN-2023-50-index"}]`, ts.URL)
+	})
+	mux.HandleFunc("/CC-MAIN-2024-10-index", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("filter") != "=status:200" {
+			t.Errorf("Unexpected filter: %q", q.Get("filter"))
+		}
+		if q.Get("url") != "empty.example/*" && q.Get("url") != "example.com/*" {
+			t.Errorf("Unexpected URL pattern: %q", q.Get("url"))
+		}
+		if q.Get("url") == "empty.example/*" {
+			http.NotFound(w, r)
+			return
+		}
+		if q.Get("showNumPages") == "true" {
+			w.Write([]byte(`{"pages": 2, "pageSize": 5, "blocks": 7}`))
+			return
+		}
+		switch q.Get("page") {
+		case "0":
+			fmt.Fprintf(w, "{\"url\": \"%[1]s/\", \"mime\": \"text/html\", \"status\": \"200\"}\n{\"url\": \"%[1]s/a\", \"mime\": \"text/html\", \"status\": \"200\"}\n{\"url\": \"%[1]s/\", \"mime\": \"text/html\", \"status\": \"200\"}\n", site)
+		case "1":
+			fmt.Fprintf(w, "{\"url\": \"%[1]s/b.pdf\", \"mime\": \"application/pdf\", \"status\": \"200\"}\n{\"url\": \"%[1]s/c\", \"mime\": \"text/html\", \"status\": \"200\"}\n", site)
+		}
+	})
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func TestURLs(t *testing.T) {
+	ts := newIndexServer(t, "http://example.com")
+	defer ts.Close()
+
+	i := &Index{URL: ts.URL}
+	urls, err := i.URLs(colly.NewCollector(colly.AllowedDomains("example.com")), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http://example.com/", "http://example.com/a", "http://example.com/b.pdf", "http://example.com/c"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Unexpected URLs: %v", urls)
+	}
+
+	i = &Index{URL: ts.URL, Collection: "CC-MAIN-2024-10", MimeTypes: []string{"text/html"}, Limit: 2}
+	urls, err = i.URLs(colly.NewCollector(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"http://example.com/", "http://example.com/a"}; !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Unexpected URLs with limit: %v", urls)
+	}
+
+	urls, err = i.URLs(colly.NewCollector(), "empty.example")
+	if err != nil || len(urls) != 0 {
+		t.Errorf("Unexpected result of domain without captures: %v %v", urls, err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer site.Close()
+	ts := newIndexServer(t, site.URL)
+	defer ts.Close()
+
+	c := colly.NewCollector(colly.Async(true))
+	var visited []string
+	lock := sync.Mutex{}
+	c.OnResponse(func(r *colly.Response) {
+		lock.Lock()
+		visited = append(visited, r.Request.URL.Path)
+		lock.Unlock()
+	})
+	i := &Index{URL: ts.URL}
+	if err := i.Seed(c, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	c.Wait()
+	sort.Strings(visited)
+	if expected := []string{"/", "/a", "/b.pdf", "/c"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Unexpected visited URLs: %v", visited)
+	}
+}
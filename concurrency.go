@@ -0,0 +1,38 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+// MaxConcurrency limits the number of concurrent requests of the
+// Collector. See SetMaxConcurrency.
+func MaxConcurrency(n int) CollectorOption {
+	return func(c *Collector) {
+		c.SetMaxConcurrency(n)
+	}
+}
+
+// SetMaxConcurrency limits the number of concurrent requests of all the
+// hosts. The requests waiting for a free slot are started in proportion
+// to the Weight of their LimitRules instead of in the order of their
+// arrival, e.g. a rule of Weight 7 of the primary target gets 70% of
+// the slots and a rule of Weight 3 of the enrichment sources gets 30%
+// while both have waiting requests. The slots unused by a rule are
+// given to the others. Requests without LimitRule wait for a slot too
+// and share the weight 1. The Parallelism of the rules still applies.
+//
+// The limit is shared with the clones of the Collector. Passing 0
+// removes the limit.
+func (c *Collector) SetMaxConcurrency(n int) {
+	c.backend.frontier.setLimit(n)
+}
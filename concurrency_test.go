@@ -0,0 +1,130 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrencyWeights(t *testing.T) {
+	var lock sync.Mutex
+	running := map[string]int{}
+	total, maxTotal := 0, 0
+	arrived := make(chan struct{}, 40)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := strings.Split(r.URL.Path, "/")[1]
+		lock.Lock()
+		running[kind]++
+		total++
+		if total > maxTotal {
+			maxTotal = total
+		}
+		lock.Unlock()
+		arrived <- struct{}{}
+		<-release
+		lock.Lock()
+		running[kind]--
+		total--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCollector(Async(), MaxConcurrency(1))
+	c.Limits([]*LimitRule{
+		{PathPrefix: "/primary", Parallelism: 10, Weight: 7},
+		{PathPrefix: "/enrichment", Parallelism: 10, Weight: 3},
+	})
+	c.Visit(ts.URL + "/primary/0")
+	<-arrived
+	for i := 1; i < 20; i++ {
+		c.Visit(fmt.Sprintf("%s/primary/%d", ts.URL, i))
+	}
+	for i := 0; i < 20; i++ {
+		c.Visit(fmt.Sprintf("%s/enrichment/%d", ts.URL, i))
+	}
+	time.Sleep(10 * time.Millisecond)
+	lock.Lock()
+	if total != 1 {
+		t.Errorf("Invalid number of requests with concurrency 1: %d", total)
+	}
+	lock.Unlock()
+
+	c.SetMaxConcurrency(10)
+	for i := 0; i < 9; i++ {
+		<-arrived
+	}
+	time.Sleep(10 * time.Millisecond)
+	lock.Lock()
+	if running["primary"] != 7 || running["enrichment"] != 3 {
+		t.Errorf("Invalid shares of the concurrency: %v", running)
+	}
+	lock.Unlock()
+
+	close(release)
+	c.Wait()
+	if maxTotal != 10 {
+		t.Errorf("Invalid max concurrency: %d", maxTotal)
+	}
+}
+
+func TestMaxConcurrencyWithoutLimitRule(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCollector(Async(), MaxConcurrency(2))
+	responses := 0
+	c.OnResponse(func(r *Response) {
+		lock.Lock()
+		responses++
+		lock.Unlock()
+	})
+	for i := 0; i < 10; i++ {
+		c.Visit(fmt.Sprintf("%s/%d", ts.URL, i))
+	}
+	c.Wait()
+	if maxRunning != 2 || responses != 10 {
+		t.Errorf("Invalid concurrency %d of %d responses", maxRunning, responses)
+	}
+
+	c.SetMaxConcurrency(0)
+	maxRunning = 0
+	for i := 10; i < 20; i++ {
+		c.Visit(fmt.Sprintf("%s/%d", ts.URL, i))
+	}
+	c.Wait()
+	if maxRunning <= 2 {
+		t.Errorf("Concurrency was not unlimited: %d", maxRunning)
+	}
+}
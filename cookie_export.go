@@ -0,0 +1,254 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieFormat is a file format of ExportCookies and ImportCookies
+type CookieFormat string
+
+const (
+	// NetscapeCookies is the cookies.txt format of curl, wget and the
+	// cookie export extensions of browsers
+	NetscapeCookies CookieFormat = "netscape"
+	// JSONCookies is a JSON list of cookie objects with the fields of the
+	// cookie export extensions of browsers, e.g. "domain", "hostOnly",
+	// "path", "secure", "httpOnly", "expirationDate", "name" and "value"
+	JSONCookies CookieFormat = "json"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in cookies.txt files
+const httpOnlyPrefix = "#HttpOnly_"
+
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	HostOnly       bool    `json:"hostOnly"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	SameSite       string  `json:"sameSite,omitempty"`
+	Session        bool    `json:"session"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+}
+
+// ExportCookies writes the cookies of the Collector to w. Only the
+// cookies received or imported by the Collector since its cookie jar was
+// set are exported.
+func (c *Collector) ExportCookies(w io.Writer, format CookieFormat) error {
+	if c.backend.Client.Jar == nil {
+		return ErrNoCookieJar
+	}
+	j, ok := c.backend.Client.Jar.(*collectorJar)
+	if !ok {
+		return ErrCookiesNotExportable
+	}
+	cookies := j.all()
+	switch format {
+	case NetscapeCookies:
+		return writeNetscapeCookies(w, cookies)
+	case JSONCookies:
+		res := make([]*jsonCookie, len(cookies))
+		for i, ck := range cookies {
+			res[i] = &jsonCookie{
+				Domain:   ck.Domain,
+				HostOnly: !strings.HasPrefix(ck.Domain, "."),
+				Path:     ck.Path,
+				Secure:   ck.Secure,
+				HTTPOnly: ck.HttpOnly,
+				Session:  ck.Expires.IsZero(),
+				Name:     ck.Name,
+				Value:    ck.Value,
+			}
+			if !ck.Expires.IsZero() {
+				res[i].ExpirationDate = float64(ck.Expires.Unix())
+			}
+			switch ck.SameSite {
+			case http.SameSiteLaxMode:
+				res[i].SameSite = "lax"
+			case http.SameSiteStrictMode:
+				res[i].SameSite = "strict"
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	return ErrUnknownCookieFormat
+}
+
+// ImportCookies loads cookies from r into the cookie jar of the
+// Collector, e.g. to reuse a session captured in a browser or by curl.
+// Expired cookies are skipped.
+func (c *Collector) ImportCookies(r io.Reader, format CookieFormat) error {
+	if c.backend.Client.Jar == nil {
+		return ErrNoCookieJar
+	}
+	var cookies []*http.Cookie
+	var err error
+	switch format {
+	case NetscapeCookies:
+		cookies, err = readNetscapeCookies(r)
+	case JSONCookies:
+		cookies, err = readJSONCookies(r)
+	default:
+		return ErrUnknownCookieFormat
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, ck := range cookies {
+		if !ck.Expires.IsZero() && ck.Expires.Before(now) {
+			continue
+		}
+		u := &url.URL{
+			Scheme: "http",
+			Host:   strings.TrimPrefix(ck.Domain, "."),
+			Path:   ck.Path,
+		}
+		if ck.Secure {
+			u.Scheme = "https"
+		}
+		if !strings.HasPrefix(ck.Domain, ".") {
+			// host-only cookie
+			ck.Domain = ""
+		}
+		c.backend.Client.Jar.SetCookies(u, []*http.Cookie{ck})
+	}
+	return nil
+}
+
+func writeNetscapeCookies(w io.Writer, cookies []*http.Cookie) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Netscape HTTP Cookie File\n\n")
+	for _, ck := range cookies {
+		domain := ck.Domain
+		if ck.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !ck.Expires.IsZero() {
+			expires = ck.Expires.Unix()
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain,
+			netscapeBool(strings.HasPrefix(ck.Domain, ".")),
+			ck.Path,
+			netscapeBool(ck.Secure),
+			expires,
+			ck.Name,
+			ck.Value)
+	}
+	return bw.Flush()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func readNetscapeCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = line[len(httpOnlyPrefix):]
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			// cookie without value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("Invalid cookie in line %d", n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cookie expiration in line %d", n)
+		}
+		ck := &http.Cookie{
+			Domain:   strings.ToLower(fields[0]),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if strings.EqualFold(fields[1], "TRUE") && !strings.HasPrefix(ck.Domain, ".") {
+			ck.Domain = "." + ck.Domain
+		} else if strings.EqualFold(fields[1], "FALSE") {
+			ck.Domain = strings.TrimPrefix(ck.Domain, ".")
+		}
+		if expires > 0 {
+			ck.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, ck)
+	}
+	return cookies, scanner.Err()
+}
+
+func readJSONCookies(r io.Reader) ([]*http.Cookie, error) {
+	var list []*jsonCookie
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, 0, len(list))
+	for _, jc := range list {
+		ck := &http.Cookie{
+			Domain:   strings.ToLower(strings.TrimPrefix(jc.Domain, ".")),
+			Path:     jc.Path,
+			Secure:   jc.Secure,
+			HttpOnly: jc.HTTPOnly,
+			Name:     jc.Name,
+			Value:    jc.Value,
+		}
+		if !jc.HostOnly {
+			ck.Domain = "." + ck.Domain
+		}
+		if ck.Path == "" {
+			ck.Path = "/"
+		}
+		if !jc.Session && jc.ExpirationDate > 0 {
+			ck.Expires = time.Unix(int64(jc.ExpirationDate), 0)
+		}
+		switch strings.ToLower(jc.SameSite) {
+		case "lax":
+			ck.SameSite = http.SameSiteLaxMode
+		case "strict":
+			ck.SameSite = http.SameSiteStrictMode
+		}
+		cookies = append(cookies, ck)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func cookieNames(c *Collector, u string) string {
+	var names []string
+	for _, ck := range c.Cookies(u) {
+		names = append(names, ck.Name+"="+ck.Value)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestExportImportCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "pref", Value: "p1", Path: "/", MaxAge: 3600})
+		http.SetCookie(w, &http.Cookie{Name: "gone", Value: "x", MaxAge: -1})
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	if err := c.Visit(ts.URL + "/dir/page"); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []CookieFormat{NetscapeCookies, JSONCookies} {
+		buf := &bytes.Buffer{}
+		if err := c.ExportCookies(buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if format == NetscapeCookies && !strings.Contains(buf.String(), "#HttpOnly_127.0.0.1\tFALSE\t/dir\tFALSE\t0\tsession\ts1\n") {
+			t.Errorf("Invalid cookies.txt:\n%s", buf.String())
+		}
+		c2 := NewCollector()
+		if err := c2.ImportCookies(buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if got := cookieNames(c2, ts.URL+"/dir/x"); got != "pref=p1 session=s1" {
+			t.Errorf("Invalid imported %s cookies %q", format, got)
+		}
+		if got := cookieNames(c2, ts.URL+"/"); got != "pref=p1" {
+			t.Errorf("Invalid imported %s cookies of root path %q", format, got)
+		}
+	}
+
+	curl := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tid\t42\n" +
+		"example.com\tFALSE\t/\tTRUE\t4102444800\tsecure\t1\n" +
+		"example.com\tFALSE\t/\tFALSE\t1\texpired\t1\n"
+	c = NewCollector()
+	if err := c.ImportCookies(strings.NewReader(curl), NetscapeCookies); err != nil {
+		t.Fatal(err)
+	}
+	if got := cookieNames(c, "http://www.example.com/"); got != "id=42" {
+		t.Errorf("Invalid domain cookies %q", got)
+	}
+	if got := cookieNames(c, "https://example.com/"); got != "id=42 secure=1" {
+		t.Errorf("Invalid host cookies %q", got)
+	}
+	if err := c.ImportCookies(strings.NewReader("invalid line"), NetscapeCookies); err == nil {
+		t.Error("Invalid cookies.txt was imported")
+	}
+	if err := c.ExportCookies(&bytes.Buffer{}, "xml"); err != ErrUnknownCookieFormat {
+		t.Errorf("Invalid error for unknown format: %v", err)
+	}
+}
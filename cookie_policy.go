@@ -0,0 +1,275 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookiePolicy restricts the cookies accepted by the cookie jar of a
+// Collector. Rejected cookies are dropped before they reach the jar, so
+// they are neither sent nor kept in storage.
+type CookiePolicy struct {
+	// BlockThirdParty rejects the cookies of sites (registrable domains,
+	// e.g. "example.co.uk") other than the first-party sites
+	BlockThirdParty bool
+	// FirstPartyDomains lists the first-party sites. If it is empty, the
+	// sites of the URLs visited directly by Collector.Visit, Post, etc.
+	// are the first-party sites.
+	FirstPartyDomains []string
+	// AllowedDomains accepts cookies only from these domains and their
+	// subdomains if it is not empty
+	AllowedDomains []string
+	// DisallowedDomains rejects the cookies of these domains and their
+	// subdomains
+	DisallowedDomains []string
+	// MaxCookieSize rejects cookies whose name and value are longer than
+	// MaxCookieSize bytes. Zero means no limit.
+	MaxCookieSize int
+}
+
+// allows returns true if the policy accepts the cookie set by the URL
+func (p *CookiePolicy) allows(u *url.URL, cookie *http.Cookie, firstParty func(site string) bool) bool {
+	if p.MaxCookieSize > 0 && len(cookie.Name)+len(cookie.Value) > p.MaxCookieSize {
+		return false
+	}
+	domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+	if domain == "" {
+		domain = strings.ToLower(u.Hostname())
+	}
+	if matchesDomain(domain, p.DisallowedDomains) {
+		return false
+	}
+	if len(p.AllowedDomains) > 0 && !matchesDomain(domain, p.AllowedDomains) {
+		return false
+	}
+	if p.BlockThirdParty && !firstParty(cookieSite(u.Hostname())) {
+		return false
+	}
+	return true
+}
+
+// matchesDomain returns true if the domain equals to or is a subdomain of
+// one of the domains
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(d), ".")
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// cookieSite returns the registrable domain of a host
+func cookieSite(host string) string {
+	host = strings.ToLower(host)
+	if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return site
+	}
+	return host
+}
+
+// collectorJar wraps the cookie jar of a Collector. It filters the
+// cookies by the CookiePolicy and keeps a copy of the accepted cookies
+// with their attributes for ExportCookies, because http.CookieJar cannot
+// list its cookies.
+type collectorJar struct {
+	jar     http.CookieJar
+	policy  *CookiePolicy
+	sites   map[string]bool
+	cookies map[cookieKey]*http.Cookie
+	lock    sync.RWMutex
+}
+
+// cookieKey identifies a cookie in a jar
+type cookieKey struct {
+	domain string
+	path   string
+	name   string
+}
+
+func newCollectorJar(jar http.CookieJar, p *CookiePolicy) *collectorJar {
+	j := &collectorJar{
+		jar:     jar,
+		cookies: make(map[cookieKey]*http.Cookie),
+	}
+	j.setPolicy(p)
+	return j
+}
+
+func (j *collectorJar) setPolicy(p *CookiePolicy) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.policy = p
+	j.sites = make(map[string]bool)
+	if p == nil {
+		return
+	}
+	for _, d := range p.FirstPartyDomains {
+		j.sites[cookieSite(strings.TrimPrefix(d, "."))] = true
+	}
+}
+
+// addFirstParty registers the site of a directly visited URL as
+// first-party site
+func (j *collectorJar) addFirstParty(u *url.URL) {
+	j.lock.Lock()
+	if j.policy != nil && len(j.policy.FirstPartyDomains) == 0 {
+		j.sites[cookieSite(u.Hostname())] = true
+	}
+	j.lock.Unlock()
+}
+
+// isFirstParty must be called holding the lock
+func (j *collectorJar) isFirstParty(site string) bool {
+	return j.sites[site]
+}
+
+// SetCookies implements http.CookieJar
+func (j *collectorJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.lock.Lock()
+	accepted := make([]*http.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		if j.policy == nil || j.policy.allows(u, c, j.isFirstParty) {
+			accepted = append(accepted, c)
+			j.keep(u, c)
+		}
+	}
+	j.lock.Unlock()
+	if len(accepted) > 0 {
+		j.jar.SetCookies(u, accepted)
+	}
+}
+
+// keep stores a copy of the cookie with its effective domain, path and
+// expiration. It must be called holding the lock.
+func (j *collectorJar) keep(u *url.URL, c *http.Cookie) {
+	kept := *c
+	kept.Domain = strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+	if kept.Domain == "" {
+		// host-only cookies are kept without leading dot
+		kept.Domain = strings.ToLower(u.Hostname())
+	} else {
+		kept.Domain = "." + kept.Domain
+	}
+	if kept.Path == "" || kept.Path[0] != '/' {
+		kept.Path = defaultCookiePath(u.Path)
+	}
+	if c.MaxAge > 0 {
+		kept.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+	}
+	kept.MaxAge = 0
+	kept.Raw = ""
+	kept.Unparsed = nil
+	key := cookieKey{kept.Domain, kept.Path, kept.Name}
+	if c.MaxAge < 0 || (!kept.Expires.IsZero() && kept.Expires.Before(time.Now())) {
+		delete(j.cookies, key)
+		return
+	}
+	j.cookies[key] = &kept
+}
+
+// all returns the kept cookies which are not expired
+func (j *collectorJar) all() []*http.Cookie {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	now := time.Now()
+	cookies := make([]*http.Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if c.Expires.IsZero() || c.Expires.After(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	sort.Slice(cookies, func(a, b int) bool {
+		if cookies[a].Domain != cookies[b].Domain {
+			return cookies[a].Domain < cookies[b].Domain
+		}
+		if cookies[a].Path != cookies[b].Path {
+			return cookies[a].Path < cookies[b].Path
+		}
+		return cookies[a].Name < cookies[b].Name
+	})
+	return cookies
+}
+
+// Cookies implements http.CookieJar
+func (j *collectorJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// defaultCookiePath returns the default path of a cookie as defined by
+// RFC 6265 section 5.1.4
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// UseCookiePolicy restricts the cookies accepted by the Collector
+func UseCookiePolicy(p *CookiePolicy) CollectorOption {
+	return func(c *Collector) {
+		c.SetCookiePolicy(p)
+	}
+}
+
+// BlockThirdPartyCookies rejects the cookies of sites other than the
+// sites of the directly visited URLs
+func BlockThirdPartyCookies() CollectorOption {
+	return func(c *Collector) {
+		p := &CookiePolicy{}
+		if c.CookiePolicy != nil {
+			*p = *c.CookiePolicy
+		}
+		p.BlockThirdParty = true
+		c.SetCookiePolicy(p)
+	}
+}
+
+// SetCookiePolicy restricts the cookies accepted by the cookie jar of the
+// Collector. The policy is kept if the jar is replaced by SetCookieJar or
+// SetStorage. Passing nil removes the policy.
+func (c *Collector) SetCookiePolicy(p *CookiePolicy) {
+	c.CookiePolicy = p
+	if j, ok := c.backend.Client.Jar.(*collectorJar); ok {
+		j.setPolicy(p)
+		return
+	}
+	c.backend.Client.Jar = c.wrapJar(c.backend.Client.Jar)
+}
+
+// wrapJar wraps the jar to apply the cookie policy of the Collector and
+// to keep the cookies for ExportCookies
+func (c *Collector) wrapJar(jar http.CookieJar) http.CookieJar {
+	if j, ok := jar.(*collectorJar); ok {
+		jar = j.jar
+	}
+	if jar == nil {
+		return nil
+	}
+	return newCollectorJar(jar, c.CookiePolicy)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCookiePolicy(t *testing.T) {
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "1"})
+	}))
+	defer tracker.Close()
+	trackerURL := strings.Replace(tracker.URL, "127.0.0.1", "localhost", 1)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "huge", Value: strings.Repeat("x", 200)})
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="` + trackerURL + `/pixel">pixel</a>`))
+	}))
+	defer site.Close()
+
+	c := NewCollector(BlockThirdPartyCookies())
+	c.CookiePolicy.MaxCookieSize = 100
+	c.OnHTML("a[href]", func(e *HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	var visited int
+	c.OnResponse(func(r *Response) {
+		visited++
+	})
+	if err := c.Visit(site.URL); err != nil {
+		t.Fatal(err)
+	}
+	if visited != 2 {
+		t.Fatalf("Invalid number of responses %d", visited)
+	}
+	names := func(u string) []string {
+		var res []string
+		for _, c := range c.Cookies(u) {
+			res = append(res, c.Name)
+		}
+		return res
+	}
+	if got := names(site.URL); len(got) != 1 || got[0] != "session" {
+		t.Errorf("Invalid first-party cookies %v", got)
+	}
+	if got := names(trackerURL); len(got) != 0 {
+		t.Errorf("Third-party cookies were not blocked: %v", got)
+	}
+
+	c.SetCookiePolicy(&CookiePolicy{DisallowedDomains: []string{"127.0.0.1"}})
+	c.SetCookieJar(nil)
+	if c.backend.Client.Jar != nil {
+		t.Error("Nil jar was wrapped")
+	}
+	p := &CookiePolicy{AllowedDomains: []string{"example.com"}, DisallowedDomains: []string{"ads.example.com"}}
+	isFirstParty := func(string) bool { return true }
+	for u, allowed := range map[string]bool{
+		"https://example.com/":       true,
+		"https://www.example.com/":   true,
+		"https://ads.example.com/":   false,
+		"https://x.ads.example.com/": false,
+		"https://example.org/":       false,
+		"https://notexample.com/":    false,
+	} {
+		parsed, _ := url.Parse(u)
+		if p.allows(parsed, &http.Cookie{Name: "a", Value: "b"}, isFirstParty) != allowed {
+			t.Errorf("Invalid policy decision for %s", u)
+		}
+	}
+}
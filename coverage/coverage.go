@@ -0,0 +1,237 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package coverage compares the pages reached by a crawl with the
+// entries of the sitemaps of the site:
+//
+//	t := coverage.New(c)
+//	c.Visit("https://example.com/")
+//	c.Wait()
+//	report := t.Report("https://example.com/sitemap.xml")
+//
+// The report lists the sitemap entries which are not linked from the
+// crawled pages (orphan pages) and the crawled pages missing from the
+// sitemaps (coverage gaps).
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Tracker records the pages crawled by a Collector
+type Tracker struct {
+	// Filter selects the recorded responses. Successful HTML responses
+	// are recorded if it is nil.
+	Filter    func(r *colly.Response) bool
+	collector *colly.Collector
+	lock      sync.Mutex
+	crawled   map[string]bool
+}
+
+// Report is the result of the comparison of a crawl and the sitemaps
+type Report struct {
+	// SitemapURLs is the number of the unique sitemap entries
+	SitemapURLs int
+	// CrawledURLs is the number of the unique crawled pages
+	CrawledURLs int
+	// Covered are the sitemap entries reached by the crawl
+	Covered []string
+	// Orphans are the sitemap entries not reached by the crawl
+	Orphans []string
+	// Gaps are the crawled pages missing from the sitemaps
+	Gaps []string
+	// SitemapErrors contains the errors of the unavailable sitemaps by
+	// their URLs
+	SitemapErrors map[string]error
+}
+
+// Coverage returns the ratio of the sitemap entries reached by the crawl
+func (r *Report) Coverage() float64 {
+	if r.SitemapURLs == 0 {
+		return 0
+	}
+	return float64(len(r.Covered)) / float64(r.SitemapURLs)
+}
+
+// New creates a Tracker recording the responses of the Collector
+func New(c *colly.Collector) *Tracker {
+	t := &Tracker{
+		collector: c,
+		crawled:   make(map[string]bool),
+	}
+	c.OnResponse(t.record)
+	return t
+}
+
+func (t *Tracker) record(r *colly.Response) {
+	if t.Filter != nil {
+		if !t.Filter(r) {
+			return
+		}
+	} else if r.StatusCode < 200 || r.StatusCode >= 300 || !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		return
+	}
+	t.lock.Lock()
+	t.crawled[Normalize(r.Request.URL.String())] = true
+	t.lock.Unlock()
+}
+
+// Crawled returns the normalized URLs of the recorded pages
+func (t *Tracker) Crawled() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	urls := make([]string, 0, len(t.crawled))
+	for u := range t.crawled {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Report downloads the sitemaps, including the sitemaps of sitemap
+// indexes, and compares their entries with the crawled pages. The
+// sitemaps are downloaded by a clone of the Collector.
+func (t *Tracker) Report(sitemapURLs ...string) *Report {
+	entries, errs := FetchSitemaps(t.collector, sitemapURLs...)
+	r := &Report{SitemapErrors: errs}
+	inSitemap := make(map[string]bool, len(entries))
+	for _, u := range entries {
+		inSitemap[Normalize(u)] = true
+	}
+	crawled := t.Crawled()
+	r.SitemapURLs, r.CrawledURLs = len(inSitemap), len(crawled)
+	for _, u := range crawled {
+		if !inSitemap[u] {
+			r.Gaps = append(r.Gaps, u)
+		}
+	}
+	t.lock.Lock()
+	for u := range inSitemap {
+		if t.crawled[u] {
+			r.Covered = append(r.Covered, u)
+		} else {
+			r.Orphans = append(r.Orphans, u)
+		}
+	}
+	t.lock.Unlock()
+	sort.Strings(r.Covered)
+	sort.Strings(r.Orphans)
+	return r
+}
+
+type sitemap struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// FetchSitemaps returns the page URLs of XML and text sitemaps. The
+// sitemaps of sitemap indexes are followed. The sitemaps are downloaded
+// synchronously by a clone of the Collector which does not mark them
+// visited. The errors of the unavailable sitemaps are returned by their
+// URLs.
+func FetchSitemaps(c *colly.Collector, sitemapURLs ...string) ([]string, map[string]error) {
+	sc := c.Clone()
+	sc.Async = false
+	sc.AllowURLRevisit = true
+	sc.URLFilters = nil
+	sc.DisallowedURLFilters = nil
+	sc.MaxDepth = 0
+	var entries []string
+	errs := make(map[string]error)
+	fetched := make(map[string]bool)
+	queue := append([]string(nil), sitemapURLs...)
+	sc.OnResponse(func(r *colly.Response) {
+		urls, sitemaps := parseSitemap(r.Body)
+		for _, u := range urls {
+			if u = r.Request.AbsoluteURL(u); u != "" {
+				entries = append(entries, u)
+			}
+		}
+		for _, u := range sitemaps {
+			if u = r.Request.AbsoluteURL(u); u != "" {
+				queue = append(queue, u)
+			}
+		}
+	})
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if fetched[u] {
+			continue
+		}
+		fetched[u] = true
+		if err := sc.Visit(u); err != nil {
+			errs[u] = err
+		}
+	}
+	return entries, errs
+}
+
+// parseSitemap returns the page URLs and the sitemap URLs of a sitemap
+func parseSitemap(body []byte) ([]string, []string) {
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("<")) {
+		var urls []string
+		s := bufio.NewScanner(bytes.NewReader(body))
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" {
+				urls = append(urls, line)
+			}
+		}
+		return urls, nil
+	}
+	sm := &sitemap{}
+	if err := xml.Unmarshal(body, sm); err != nil {
+		return nil, nil
+	}
+	var urls, sitemaps []string
+	for _, u := range sm.URLs {
+		urls = append(urls, strings.TrimSpace(u.Loc))
+	}
+	for _, s := range sm.Sitemaps {
+		sitemaps = append(sitemaps, strings.TrimSpace(s.Loc))
+	}
+	return urls, sitemaps
+}
+
+// Normalize returns the comparable form of a URL: the scheme and host
+// are lowercased and the default port and the fragment are removed
+func Normalize(u string) string {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return u
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if (parsed.Scheme == "http" && strings.HasSuffix(parsed.Host, ":80")) || (parsed.Scheme == "https" && strings.HasSuffix(parsed.Host, ":443")) {
+		parsed.Host = parsed.Host[:strings.LastIndexByte(parsed.Host, ':')]
+	}
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	parsed.Fragment = ""
+	return parsed.String()
+}
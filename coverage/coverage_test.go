@@ -0,0 +1,112 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/", page(`<a href="/a">a</a><a href="/b#top">b</a>`))
+	mux.HandleFunc("/a", page(`<a href="/">home</a>`))
+	mux.HandleFunc("/b", page(`<a href="/c">c</a>`))
+	mux.HandleFunc("/c", page(`c`))
+	mux.HandleFunc("/orphan", page(`orphan`))
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>http://%[1]s/sitemap1.xml</loc></sitemap>
+<sitemap><loc>/sitemap2.txt</loc></sitemap>
+<sitemap><loc>/missing.xml</loc></sitemap>
+</sitemapindex>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap1.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>http://%[1]s/</loc></url>
+<url><loc> http://%[1]s/a </loc></url>
+</urlset>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap2.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "http://%[1]s/b\n\nhttp://%[1]s/orphan\n", r.Host)
+	})
+	mux.HandleFunc("/missing.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestReport(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	tracker := New(c)
+	c.Visit(ts.URL + "/")
+
+	r := tracker.Report(ts.URL + "/sitemap_index.xml")
+	if r.SitemapURLs != 4 || r.CrawledURLs != 4 {
+		t.Errorf("Unexpected counts: %d sitemap URLs, %d crawled URLs", r.SitemapURLs, r.CrawledURLs)
+	}
+	if expected := []string{ts.URL + "/", ts.URL + "/a", ts.URL + "/b"}; !reflect.DeepEqual(r.Covered, expected) {
+		t.Errorf("Unexpected covered URLs: %v", r.Covered)
+	}
+	if expected := []string{ts.URL + "/orphan"}; !reflect.DeepEqual(r.Orphans, expected) {
+		t.Errorf("Unexpected orphans: %v", r.Orphans)
+	}
+	if expected := []string{ts.URL + "/c"}; !reflect.DeepEqual(r.Gaps, expected) {
+		t.Errorf("Unexpected gaps: %v", r.Gaps)
+	}
+	if len(r.SitemapErrors) != 1 || r.SitemapErrors[ts.URL+"/missing.xml"] == nil {
+		t.Errorf("Unexpected sitemap errors: %v", r.SitemapErrors)
+	}
+	if r.Coverage() != 0.75 {
+		t.Errorf("Unexpected coverage: %f", r.Coverage())
+	}
+	// the sitemaps are not marked visited
+	if visited, _ := c.HasVisited(ts.URL + "/sitemap1.xml"); visited {
+		t.Error("Sitemap was marked visited")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"HTTP://Example.com:80":          "http://example.com/",
+		"https://example.com:443/a#frag": "https://example.com/a",
+		"https://example.com:8443/a?b=c": "https://example.com:8443/a?b=c",
+	}
+	for u, expected := range tests {
+		if n := Normalize(u); n != expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", u, n, expected)
+		}
+	}
+}
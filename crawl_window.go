@@ -0,0 +1,109 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"time"
+)
+
+// CrawlWindow is a daily time range in which requests are allowed
+type CrawlWindow struct {
+	// Start is the time of day when the window opens, e.g. 1*time.Hour
+	// for 01:00
+	Start time.Duration
+	// End is the time of day when the window closes. Windows ending
+	// before their Start close on the next day, e.g. 22:00-02:00.
+	End time.Duration
+	// Days are the weekdays when the window opens. The window opens
+	// every day if it is empty.
+	Days []time.Weekday
+}
+
+// CrawlSchedule restricts the requests of the domains of a LimitRule to
+// time windows, e.g. to the nights of the working days agreed with the
+// site owner. Requests waiting for a window are queued by the Collector.
+// Requests already sent when a window closes are not canceled.
+type CrawlSchedule struct {
+	// Windows are the time windows in which requests are allowed.
+	// Requests are always allowed if it is empty.
+	Windows []CrawlWindow
+	// Location is the time zone of the windows. time.Local is used if
+	// it is nil.
+	Location *time.Location
+}
+
+// Weekdays are the days from Monday to Friday
+var Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// Next returns t if requests are allowed at t, or the time when the
+// next window opens
+func (s *CrawlSchedule) Next(t time.Time) time.Time {
+	if len(s.Windows) == 0 {
+		return t
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	var next time.Time
+	// windows opened on the previous day may still be open
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, loc)
+		for _, w := range s.Windows {
+			if !w.opensOn(day.Weekday()) {
+				continue
+			}
+			start := timeOfDay(day, w.Start)
+			end := timeOfDay(day, w.End)
+			if !end.After(start) {
+				end = timeOfDay(day.AddDate(0, 0, 1), w.End)
+			}
+			if !t.Before(start) && t.Before(end) {
+				return t
+			}
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	if next.IsZero() {
+		return t
+	}
+	return next
+}
+
+// Wait returns the duration until requests are allowed after t
+func (s *CrawlSchedule) Wait(t time.Time) time.Duration {
+	return s.Next(t).Sub(t)
+}
+
+func (w CrawlWindow) opensOn(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// timeOfDay returns the wall clock time of the day, which is correct on
+// the days of daylight saving time changes too
+func timeOfDay(day time.Time, d time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second), int(d%time.Second), day.Location())
+}
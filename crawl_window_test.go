@@ -0,0 +1,86 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrawlScheduleNext(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s := &CrawlSchedule{
+		Windows: []CrawlWindow{
+			{Start: 1 * time.Hour, End: 5 * time.Hour, Days: Weekdays},
+			{Start: 22 * time.Hour, End: 2 * time.Hour, Days: []time.Weekday{time.Saturday}},
+		},
+		Location: loc,
+	}
+	// 2024-01-01 is a Monday
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, loc)
+	}
+	tests := []struct {
+		t, next time.Time
+	}{
+		{date(1, 2, 0), date(1, 2, 0)},
+		{date(1, 0, 30), date(1, 1, 0)},
+		{date(1, 5, 0), date(2, 1, 0)},
+		{date(5, 6, 0), date(6, 22, 0)},
+		{date(7, 1, 30), date(7, 1, 30)},
+		{date(7, 3, 0), date(8, 1, 0)},
+		// the time zone of the argument does not matter
+		{date(1, 2, 0).UTC(), date(1, 2, 0)},
+	}
+	for _, tc := range tests {
+		if next := s.Next(tc.t); !next.Equal(tc.next) {
+			t.Errorf("Next(%v) = %v, expected %v", tc.t, next, tc.next)
+		}
+	}
+	if wait := s.Wait(date(1, 0, 30)); wait != 30*time.Minute {
+		t.Errorf("Invalid wait %v", wait)
+	}
+	if next := (&CrawlSchedule{}).Next(date(1, 0, 0)); !next.Equal(date(1, 0, 0)) {
+		t.Error("Empty schedule must allow every time")
+	}
+}
+
+func TestCrawlSchedulePausesRequests(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	now := time.Now()
+	start := now.Add(300 * time.Millisecond)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	window := CrawlWindow{Start: start.Sub(midnight), End: start.Add(time.Hour).Sub(midnight)}
+	if window.Start >= 24*time.Hour {
+		window.Start -= 24 * time.Hour
+	}
+	if window.End >= 24*time.Hour {
+		window.End -= 24 * time.Hour
+	}
+
+	c := NewCollector(Async(true))
+	c.Limit(&LimitRule{DomainGlob: "*", Schedule: &CrawlSchedule{Windows: []CrawlWindow{window}}})
+	var sent []time.Time
+	c.OnResponse(func(r *Response) {
+		sent = append(sent, time.Now())
+	})
+	c.Visit(ts.URL)
+	c.Wait()
+	if len(sent) != 1 || sent[0].Before(start) {
+		t.Errorf("Request was sent outside the window: %v", sent)
+	}
+}
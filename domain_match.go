@@ -0,0 +1,101 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DomainMatchMode defines how AllowedDomains and DisallowedDomains match
+// the domains of the URLs. In every mode the domains are compared case
+// insensitively and without ports, and patterns starting with "*.",
+// e.g. "*.example.com", match the subdomains of the domain.
+type DomainMatchMode int
+
+const (
+	// DomainMatchExact matches the domains themselves (default)
+	DomainMatchExact DomainMatchMode = iota
+	// DomainMatchSubdomains matches the domains and their subdomains,
+	// e.g. "example.com" matches "www.example.com"
+	DomainMatchSubdomains
+	// DomainMatchRegistrable matches the domains registered under the
+	// same public suffix (eTLD+1), e.g. "www.example.co.uk" matches
+	// "shop.example.co.uk" and "example.co.uk"
+	DomainMatchRegistrable
+)
+
+// DomainMatching sets how AllowedDomains and DisallowedDomains match the
+// domains of the URLs
+func DomainMatching(mode DomainMatchMode) CollectorOption {
+	return func(c *Collector) {
+		c.DomainMatchMode = mode
+	}
+}
+
+// parseDomainMatchMode parses the DOMAIN_MATCH_MODE environment variable
+func parseDomainMatchMode(s string) (DomainMatchMode, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "exact":
+		return DomainMatchExact, true
+	case "subdomains":
+		return DomainMatchSubdomains, true
+	case "registrable", "etld+1":
+		return DomainMatchRegistrable, true
+	}
+	return DomainMatchExact, false
+}
+
+// matchDomain returns true if the host matches the domain pattern
+func matchDomain(pattern, host string, mode DomainMatchMode) bool {
+	pattern, host = normalizeDomain(pattern), normalizeDomain(host)
+	if pattern == "" || host == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	if pattern == host {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	switch mode {
+	case DomainMatchSubdomains:
+		return strings.HasSuffix(host, "."+pattern)
+	case DomainMatchRegistrable:
+		hostDomain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil {
+			return false
+		}
+		patternDomain, err := publicsuffix.EffectiveTLDPlusOne(pattern)
+		return err == nil && hostDomain == patternDomain
+	}
+	return false
+}
+
+// normalizeDomain lowercases the domain and removes its port and
+// trailing dot
+func normalizeDomain(d string) string {
+	d = strings.ToLower(strings.TrimSpace(d))
+	if h, _, err := net.SplitHostPort(d); err == nil {
+		d = h
+	}
+	d = strings.TrimPrefix(strings.TrimSuffix(d, "]"), "[")
+	return strings.TrimSuffix(d, ".")
+}
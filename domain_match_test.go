@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		mode          DomainMatchMode
+		match         bool
+	}{
+		{"example.com", "example.com", DomainMatchExact, true},
+		{"Example.com:8080", "example.COM", DomainMatchExact, true},
+		{"example.com.", "example.com", DomainMatchExact, true},
+		{"example.com", "www.example.com", DomainMatchExact, false},
+		{"*.example.com", "www.example.com", DomainMatchExact, true},
+		{"*.example.com", "a.b.example.com", DomainMatchExact, true},
+		{"*.example.com", "example.com", DomainMatchExact, false},
+		{"*.example.com", "badexample.com", DomainMatchExact, false},
+		{"example.com", "www.example.com", DomainMatchSubdomains, true},
+		{"example.com", "badexample.com", DomainMatchSubdomains, false},
+		{"www.example.com", "example.com", DomainMatchSubdomains, false},
+		{"www.example.co.uk", "shop.example.co.uk", DomainMatchRegistrable, true},
+		{"www.example.co.uk", "example.co.uk", DomainMatchRegistrable, true},
+		{"example.co.uk", "other.co.uk", DomainMatchRegistrable, false},
+		{"a.github.io", "b.github.io", DomainMatchRegistrable, false},
+		{"127.0.0.1", "127.0.0.1", DomainMatchSubdomains, true},
+		{"0.0.1", "127.0.0.1", DomainMatchSubdomains, false},
+		{"[::1]:80", "::1", DomainMatchExact, true},
+	}
+	for _, tt := range tests {
+		if match := matchDomain(tt.pattern, tt.host, tt.mode); match != tt.match {
+			t.Errorf("matchDomain(%q, %q, %d) = %v, expected %v", tt.pattern, tt.host, tt.mode, match, tt.match)
+		}
+	}
+}
+
+func TestDomainMatching(t *testing.T) {
+	c := NewCollector(AllowedDomains("example.com"), DisallowedDomains("private.example.com"), DomainMatching(DomainMatchSubdomains))
+	for host, allowed := range map[string]bool{
+		"example.com":           true,
+		"www.example.com":       true,
+		"private.example.com":   false,
+		"a.private.example.com": false,
+		"example.org":           false,
+	} {
+		if c.isDomainAllowed(host) != allowed {
+			t.Errorf("Invalid result for %s", host)
+		}
+	}
+	if c.Clone().DomainMatchMode != DomainMatchSubdomains {
+		t.Error("DomainMatchMode was not cloned")
+	}
+
+	os.Setenv("COLLY_DOMAIN_MATCH_MODE", "registrable")
+	defer os.Unsetenv("COLLY_DOMAIN_MATCH_MODE")
+	if c := NewCollector(); c.DomainMatchMode != DomainMatchRegistrable {
+		t.Errorf("DomainMatchMode was not set by the environment: %d", c.DomainMatchMode)
+	}
+}
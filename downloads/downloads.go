@@ -0,0 +1,459 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package downloads implements a downloader which stores the media and
+// other binary assets referenced by crawled pages.
+//
+// Assets are deduplicated: identical files and visually identical images
+// served from different URLs are stored once and the index maps every
+// URL to the stored file.
+//
+//	d, err := downloads.New(c, "assets")
+//	d.MaxSizes = map[string]int64{"image/": 5 << 20, "application/pdf": 50 << 20}
+//	d.Attach(c)
+//	c.Visit("https://example.com/")
+//	c.Wait()
+//	err = d.Wait()
+//
+// Governor limits the disk usage of the download directories and caches.
+package downloads
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	// register the image formats which can be perceptually hashed
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// IndexFile is the name of the alias index in the download directory
+const IndexFile = "index.json"
+
+// ErrAssetTooLarge is the error returned if an asset exceeds the size
+// limit of its type
+var ErrAssetTooLarge = errors.New("Asset exceeds the size limit")
+
+// AssetSelector selects the elements and the attribute containing the
+// URLs of the assets referenced by a page
+type AssetSelector struct {
+	// Selector is a goquery selector
+	Selector string
+	// Attr is the attribute containing the URL. "srcset" attributes
+	// are parsed as lists of image candidates.
+	Attr string
+}
+
+// DefaultAssetSelectors select the images and PDF documents of a page
+var DefaultAssetSelectors = []AssetSelector{
+	{"img[src]", "src"},
+	{"img[srcset]", "srcset"},
+	{"picture source[srcset]", "srcset"},
+	{`a[href$=".pdf"]`, "href"},
+	{`a[href$=".PDF"]`, "href"},
+}
+
+// Asset is a stored file and the URLs it was downloaded from
+type Asset struct {
+	// File is the path of the stored file relative to the download directory
+	File string `json:"file"`
+	// SHA1 is the checksum of the content
+	SHA1 string `json:"sha1"`
+	// PHash is the perceptual hash of images
+	PHash uint64 `json:"phash,omitempty"`
+	// ContentType is the media type of the first response
+	ContentType string `json:"content_type"`
+	// Size is the size of the file in bytes
+	Size int `json:"size"`
+	// URLs are the aliases of the asset
+	URLs []string `json:"urls"`
+}
+
+// Downloader downloads and stores assets concurrently using an
+// asynchronous clone of a Collector
+type Downloader struct {
+	// Dir is the download directory
+	Dir string
+	// PHashThreshold is the maximum Hamming distance of the perceptual
+	// hashes of images considered to be identical. Negative value
+	// disables perceptual deduplication. Default is 4.
+	PHashThreshold int
+	// ChunkSize enables parallel range requests for files larger than
+	// ChunkSize bytes if the server supports them. Zero disables ranged
+	// downloads.
+	ChunkSize int64
+	// ChunkParallelism is the number of concurrently fetched chunks of
+	// a file. Default is 4.
+	ChunkParallelism int
+	// MaxSizes limits the size of the assets by media type. Keys are
+	// media types like "application/pdf" or type prefixes like "image/".
+	MaxSizes map[string]int64
+	// FileName returns the path of a new asset relative to Dir.
+	// The default file name is the SHA1 checksum of the content with
+	// the extension of the URL or the content type. TemplateFileName
+	// creates a FileName function from a colly.FileNameTemplate.
+	FileName func(u *url.URL, a *Asset) string
+	// AssetSelectors are the assets downloaded by Attach.
+	// Default is DefaultAssetSelectors.
+	AssetSelectors []AssetSelector
+	// Collector performs the downloads. Register OnError and OnRequest
+	// callbacks on it to observe the downloads.
+	Collector *colly.Collector
+	assets    []*Asset
+	aliases   map[string]*Asset
+	err       error
+	lock      *sync.RWMutex
+	wg        *sync.WaitGroup
+}
+
+// New creates a Downloader storing the assets in dir. The existing
+// index of dir is loaded, so interrupted downloads can be continued.
+func New(c *colly.Collector, dir string) (*Downloader, error) {
+	d := &Downloader{
+		Dir:              dir,
+		PHashThreshold:   4,
+		ChunkParallelism: 4,
+		AssetSelectors:   DefaultAssetSelectors,
+		Collector:        c.Clone(),
+		aliases:          make(map[string]*Asset),
+		lock:             &sync.RWMutex{},
+		wg:               &sync.WaitGroup{},
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	if err := d.loadIndex(); err != nil {
+		return nil, err
+	}
+	d.Collector.Async = true
+	d.Collector.OnResponseHeaders(func(r *colly.Response) {
+		size, err := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64)
+		if err == nil && d.tooLarge(r.Headers.Get("Content-Type"), size) {
+			d.setErr(ErrAssetTooLarge)
+			r.Request.Abort()
+		}
+	})
+	d.Collector.OnResponse(func(r *colly.Response) {
+		if r.StatusCode >= 400 {
+			return
+		}
+		if _, err := d.Store(r); err != nil {
+			d.setErr(err)
+		}
+	})
+	return d, nil
+}
+
+// Attach downloads the assets referenced by the HTML pages visited
+// by the Collector
+func (d *Downloader) Attach(c *colly.Collector) {
+	for _, s := range d.AssetSelectors {
+		attr := s.Attr
+		c.OnHTML(s.Selector, func(e *colly.HTMLElement) {
+			for _, u := range assetURLs(e.Attr(attr), attr == "srcset") {
+				if u = e.Request.AbsoluteURL(u); u != "" {
+					d.Download(u)
+				}
+			}
+		})
+	}
+}
+
+// Download fetches and stores the asset of the URL unless it has
+// already been downloaded
+func (d *Downloader) Download(URL string) error {
+	if d.Lookup(URL) != nil {
+		return nil
+	}
+	if d.ChunkSize > 0 {
+		if !d.Collector.Async {
+			return d.downloadRanges(URL)
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			if err := d.downloadRanges(URL); err != nil {
+				d.setErr(err)
+			}
+		}()
+		return nil
+	}
+	return d.Collector.Visit(URL)
+}
+
+// Wait blocks until the pending downloads finish and writes the index.
+// It returns the first error of storing the assets.
+func (d *Downloader) Wait() error {
+	d.Collector.Wait()
+	d.wg.Wait()
+	if err := d.SaveIndex(); err != nil {
+		return err
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.err
+}
+
+// Store saves the body of a response or registers its URL as an alias
+// of an already stored duplicate. The body is verified using the Digest
+// and Content-MD5 headers of the response.
+func (d *Downloader) Store(r *colly.Response) (*Asset, error) {
+	contentType := r.Headers.Get("Content-Type")
+	if d.tooLarge(contentType, int64(len(r.Body))) {
+		return nil, ErrAssetTooLarge
+	}
+	// digests of encoded responses belong to the encoded content
+	if r.Headers.Get("Content-Encoding") == "" {
+		if err := verifyDigest(*r.Headers, bytes.NewReader(r.Body), r.StatusCode != http.StatusPartialContent); err != nil {
+			return nil, err
+		}
+	}
+	return d.storeBody(r.Request.URL, contentType, r.Body)
+}
+
+func (d *Downloader) storeBody(u *url.URL, contentType string, body []byte) (*Asset, error) {
+	URL := u.String()
+	sum := sha1.Sum(body)
+	a := &Asset{
+		SHA1:        hex.EncodeToString(sum[:]),
+		ContentType: contentType,
+		Size:        len(body),
+		URLs:        []string{URL},
+	}
+	hashed := false
+	if strings.HasPrefix(a.ContentType, "image/") && d.PHashThreshold >= 0 {
+		if img, _, err := image.Decode(bytes.NewReader(body)); err == nil {
+			a.PHash = PHash(img)
+			hashed = true
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if dup := d.duplicate(a, hashed); dup != nil {
+		d.alias(dup, URL)
+		return dup, nil
+	}
+	a.File = d.fileName(u, a)
+	if err := writeFile(filepath.Join(d.Dir, a.File), body); err != nil {
+		return nil, err
+	}
+	d.assets = append(d.assets, a)
+	d.aliases[URL] = a
+	return a, nil
+}
+
+// Lookup returns the stored asset of a URL or nil
+func (d *Downloader) Lookup(URL string) *Asset {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.aliases[URL]
+}
+
+// Assets returns the stored assets
+func (d *Downloader) Assets() []*Asset {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return append([]*Asset(nil), d.assets...)
+}
+
+// SaveIndex writes the alias index to the download directory
+func (d *Downloader) SaveIndex() error {
+	d.lock.RLock()
+	b, err := json.MarshalIndent(d.assets, "", "  ")
+	d.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(d.Dir, IndexFile), b)
+}
+
+// TemplateFileName returns a Downloader.FileName function generating the
+// file names using the template. The Hash of the template data is the
+// SHA1 checksum of the asset.
+func TemplateFileName(t *colly.FileNameTemplate) func(u *url.URL, a *Asset) string {
+	return func(u *url.URL, a *Asset) string {
+		data := colly.NewFileNameData(u, a.ContentType, nil)
+		data.Hash = a.SHA1
+		name, err := t.Execute(data)
+		if err != nil {
+			return ""
+		}
+		return name
+	}
+}
+
+func (d *Downloader) fileName(u *url.URL, a *Asset) string {
+	if d.FileName != nil {
+		if name := d.FileName(u, a); name != "" {
+			return filepath.FromSlash(name)
+		}
+	}
+	return a.SHA1 + extension(u.Path, a.ContentType)
+}
+
+// tooLarge checks the size limit of the content type. Limits of media
+// types take precedence over type prefixes.
+func (d *Downloader) tooLarge(contentType string, size int64) bool {
+	if len(d.MaxSizes) == 0 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if limit, ok := d.MaxSizes[mediaType]; ok {
+		return size > limit
+	}
+	for prefix, limit := range d.MaxSizes {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix) {
+			return size > limit
+		}
+	}
+	return false
+}
+
+func (d *Downloader) alias(a *Asset, URL string) {
+	if _, ok := d.aliases[URL]; !ok {
+		a.URLs = append(a.URLs, URL)
+		d.aliases[URL] = a
+	}
+}
+
+// remove deletes pruned assets from the index
+func (d *Downloader) remove(assets []*Asset) {
+	removed := map[*Asset]bool{}
+	for _, a := range assets {
+		removed[a] = true
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	kept := d.assets[:0]
+	for _, a := range d.assets {
+		if !removed[a] {
+			kept = append(kept, a)
+			continue
+		}
+		for _, u := range a.URLs {
+			delete(d.aliases, u)
+		}
+	}
+	d.assets = kept
+}
+
+func (d *Downloader) setErr(err error) {
+	d.lock.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.lock.Unlock()
+}
+
+func (d *Downloader) duplicate(a *Asset, hashed bool) *Asset {
+	for _, s := range d.assets {
+		if s.SHA1 == a.SHA1 {
+			return s
+		}
+	}
+	if !hashed {
+		return nil
+	}
+	for _, s := range d.assets {
+		if s.PHash != 0 && HammingDistance(s.PHash, a.PHash) <= d.PHashThreshold {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) loadIndex() error {
+	f, err := os.Open(filepath.Join(d.Dir, IndexFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&d.assets); err != nil {
+		return err
+	}
+	for _, a := range d.assets {
+		for _, u := range a.URLs {
+			d.aliases[u] = a
+		}
+	}
+	return nil
+}
+
+// assetURLs returns the URL of an attribute or the URLs of a srcset
+func assetURLs(value string, srcset bool) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if !srcset {
+		return []string{value}
+	}
+	var URLs []string
+	for _, candidate := range strings.Split(value, ",") {
+		if f := strings.Fields(candidate); len(f) > 0 {
+			URLs = append(URLs, f[0])
+		}
+	}
+	return URLs
+}
+
+func extension(urlPath, contentType string) string {
+	if ext := path.Ext(urlPath); ext != "" && len(ext) <= 6 {
+		return strings.ToLower(ext)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// writeFile writes the file atomically, so interrupted downloads
+// do not leave partial files behind
+func writeFile(fileName string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0750); err != nil {
+		return err
+	}
+	f, err := os.Create(fileName + "~")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fileName+"~", fileName)
+}
@@ -0,0 +1,412 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloads
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/collytest"
+)
+
+func testImage(w, h int, f func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: f(x*64/w, y*64/h)})
+		}
+	}
+	return img
+}
+
+func waves(x, y int) uint8 {
+	return uint8(128 + 120*math.Sin(float64(x)/7)*math.Cos(float64(y)/11))
+}
+
+func checkerboard(x, y int) uint8 {
+	if (x/8+y/8)%2 == 0 {
+		return 255
+	}
+	return 0
+}
+
+func encode(t *testing.T, img image.Image, format string) string {
+	buf := &bytes.Buffer{}
+	var err error
+	if format == "png" {
+		err = png.Encode(buf, img)
+	} else {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 80})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestPHash(t *testing.T) {
+	a := PHash(testImage(64, 64, waves))
+	b := PHash(testImage(200, 150, waves))
+	c := PHash(testImage(64, 64, checkerboard))
+	if d := HammingDistance(a, b); d > 4 {
+		t.Errorf("Distance of scaled images is %d", d)
+	}
+	if d := HammingDistance(a, c); d < 10 {
+		t.Errorf("Distance of different images is %d", d)
+	}
+}
+
+func TestDownloaderDeduplication(t *testing.T) {
+	site := collytest.NewSite()
+	defer site.Close()
+	site.Page("/a.png").WithContentType("image/png").WithBody(encode(t, testImage(64, 64, waves), "png"))
+	site.Page("/copy.png").WithContentType("image/png").WithBody(encode(t, testImage(64, 64, waves), "png"))
+	site.Page("/large.jpg").WithContentType("image/jpeg").WithBody(encode(t, testImage(256, 256, waves), "jpeg"))
+	site.Page("/other.png").WithContentType("image/png").WithBody(encode(t, testImage(64, 64, checkerboard), "png"))
+	site.Page("/doc").WithContentType("application/pdf").WithBody("%PDF-1.4")
+
+	dir, err := ioutil.TempDir("", "colly-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := New(colly.NewCollector(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/a.png", "/copy.png", "/large.jpg", "/other.png", "/doc"} {
+		if err := d.Download(site.URL(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	assets := d.Assets()
+	if len(assets) != 3 {
+		t.Fatalf("%d assets stored, want 3", len(assets))
+	}
+	if a := d.Lookup(site.URL("/large.jpg")); a == nil || a != d.Lookup(site.URL("/a.png")) || len(a.URLs) != 3 {
+		t.Errorf("Invalid alias %v", a)
+	}
+	if a := d.Lookup(site.URL("/doc")); a == nil || filepath.Ext(a.File) != ".pdf" {
+		t.Errorf("Invalid asset %v", a)
+	}
+	if err := d.Download(site.URL("/copy.png")); err != nil || site.Hits("/copy.png") != 1 {
+		t.Errorf("Downloaded asset was fetched again")
+	}
+
+	d, err = New(colly.NewCollector(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Assets()) != 3 || d.Lookup(site.URL("/copy.png")) == nil {
+		t.Error("Index was not loaded")
+	}
+	for _, a := range d.Assets() {
+		if _, err := os.Stat(filepath.Join(dir, a.File)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRangedDownload(t *testing.T) {
+	content := make([]byte, 100*1024+17)
+	rand.New(rand.NewSource(1)).Read(content)
+	sum := sha256.Sum256(content)
+	digest := "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+
+	var ranges int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Digest", digest)
+		switch r.URL.Path {
+		case "/ranges.bin":
+			if r.Header.Get("Range") != "" {
+				atomic.AddInt32(&ranges, 1)
+			}
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "ranges.bin", time.Time{}, bytes.NewReader(content))
+		case "/plain.bin":
+			w.Write(content)
+		case "/corrupt.bin":
+			http.ServeContent(w, r, "corrupt.bin", time.Time{}, bytes.NewReader(content[1:]))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "colly-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := New(colly.NewCollector(colly.Async()), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.ChunkSize = 16 * 1024
+	d.ChunkParallelism = 3
+	d.Download(ts.URL + "/ranges.bin")
+	d.Download(ts.URL + "/plain.bin")
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if ranges != 7 {
+		t.Errorf("%d range requests, want 7", ranges)
+	}
+	a := d.Lookup(ts.URL + "/ranges.bin")
+	if a == nil || a != d.Lookup(ts.URL+"/plain.bin") {
+		t.Fatalf("Invalid assets %v", d.Assets())
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(dir, a.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, content) || a.Size != len(content) {
+		t.Error("Invalid assembled file")
+	}
+
+	d.Collector.Async = false
+	if err := d.Download(ts.URL + "/corrupt.bin"); err != ErrChecksumMismatch {
+		t.Errorf("Invalid error %v, want %v", err, ErrChecksumMismatch)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("%d files in download directory, want 2", len(files))
+	}
+}
+
+func TestDownloaderAttach(t *testing.T) {
+	site := collytest.NewSite()
+	defer site.Close()
+	site.Page("/").WithBody(`<html><body>
+<img src="/img/a.png">
+<picture><source srcset="/img/other.png 1x, /img/large.jpg 2x"></picture>
+<a href="/files/doc.pdf">Document</a>
+<a href="/files/big.pdf">Large document</a>
+</body></html>`)
+	site.Page("/img/a.png").WithContentType("image/png").WithBody(encode(t, testImage(64, 64, waves), "png"))
+	site.Page("/img/other.png").WithContentType("image/png").WithBody(encode(t, testImage(64, 64, checkerboard), "png"))
+	noise := rand.New(rand.NewSource(3))
+	site.Page("/img/large.jpg").WithContentType("image/jpeg").WithBody(encode(t, testImage(256, 256, func(x, y int) uint8 {
+		return uint8(noise.Intn(256))
+	}), "jpeg"))
+	site.Page("/files/doc.pdf").WithContentType("application/pdf").WithBody("%PDF-1.4")
+	site.Page("/files/big.pdf").WithContentType("application/pdf").WithBody("%PDF-1.4" + strings.Repeat(" ", 1024))
+
+	dir, err := ioutil.TempDir("", "colly-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := colly.NewCollector()
+	d, err := New(c, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MaxSizes = map[string]int64{"image/": 10 * 1024, "application/pdf": 512}
+	d.FileName = func(u *url.URL, a *Asset) string {
+		return path.Join(strings.Trim(path.Dir(u.Path), "/"), a.SHA1[:8]+path.Ext(u.Path))
+	}
+	d.Attach(c)
+	c.Visit(site.URL("/"))
+	if err := d.Wait(); err != ErrAssetTooLarge {
+		t.Errorf("Invalid error %v, want %v", err, ErrAssetTooLarge)
+	}
+
+	if len(d.Assets()) != 3 {
+		t.Fatalf("%d assets stored, want 3", len(d.Assets()))
+	}
+	for _, p := range []string{"/img/a.png", "/img/other.png", "/files/doc.pdf"} {
+		a := d.Lookup(site.URL(p))
+		if a == nil {
+			t.Errorf("%s was not stored", p)
+			continue
+		}
+		if filepath.Dir(a.File) != filepath.FromSlash(path.Dir(p)[1:]) {
+			t.Errorf("Invalid file name %q of %s", a.File, p)
+		}
+		if _, err := os.Stat(filepath.Join(dir, a.File)); err != nil {
+			t.Error(err)
+		}
+	}
+	if d.Lookup(site.URL("/img/large.jpg")) != nil || d.Lookup(site.URL("/files/big.pdf")) != nil {
+		t.Error("Too large asset was stored")
+	}
+}
+
+func TestResumedDownload(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(2)).Read(content)
+
+	var fail, ranges int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		if rng == "bytes=49152-65535" && atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		atomic.AddInt32(&ranges, 1)
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "colly-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := New(colly.NewCollector(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Collector.Async = false
+	d.ChunkSize = 16 * 1024
+	d.ChunkParallelism = 1
+	fail = 1
+	if err := d.Download(ts.URL + "/file.bin"); err == nil {
+		t.Fatal("Interrupted download succeeded")
+	}
+	if ranges != 3 {
+		t.Errorf("%d range requests, want 3", ranges)
+	}
+
+	fail, ranges = 0, 0
+	if err := d.Download(ts.URL + "/file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	// the first part is fetched again to validate the ETag
+	if ranges != 2 {
+		t.Errorf("%d range requests, want 2", ranges)
+	}
+	a := d.Lookup(ts.URL + "/file.bin")
+	if a == nil {
+		t.Fatal("File was not stored")
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(dir, a.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Error("Invalid resumed file")
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("%d files in download directory, want 1", len(files))
+	}
+}
+
+func TestGovernor(t *testing.T) {
+	site := collytest.NewSite()
+	defer site.Close()
+	site.Page("/a.pdf").WithContentType("application/pdf").WithBody("%PDF-1.4 a" + strings.Repeat(" ", 90))
+	site.Page("/b.pdf").WithContentType("application/pdf").WithBody("%PDF-1.4 b" + strings.Repeat(" ", 90))
+	site.Page("/c.pdf").WithContentType("application/pdf").WithBody("%PDF-1.4 c" + strings.Repeat(" ", 90))
+
+	dir, err := ioutil.TempDir("", "colly-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	d, err := New(colly.NewCollector(), filepath.Join(dir, "assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/a.pdf", "/b.pdf", "/c.pdf"} {
+		d.Download(site.URL(p))
+	}
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, p := range []string{"/a.pdf", "/b.pdf", "/c.pdf"} {
+		modTime := now.Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(filepath.Join(d.Dir, d.Lookup(site.URL(p)).File), modTime, modTime)
+	}
+	for i, name := range []string{"old", "new"} {
+		fileName := filepath.Join(cacheDir, "00", name)
+		if err := writeFile(fileName, make([]byte, 50)); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-1) * 48 * time.Hour)
+		os.Chtimes(fileName, modTime, modTime)
+	}
+
+	var events []PruneEvent
+	g := &Governor{
+		Dirs:          []string{cacheDir},
+		Downloader:    d,
+		MaxAge:        24 * time.Hour,
+		MaxDomainSize: 250,
+		MaxSize:       200,
+		OnPrune: func(e PruneEvent) {
+			events = append(events, e)
+		},
+	}
+	if err := g.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	reasons := []PruneReason{Expired, DomainSizeExceeded, SizeExceeded}
+	if len(events) != len(reasons) {
+		t.Fatalf("%d files pruned, want %d: %v", len(events), len(reasons), events)
+	}
+	for i, e := range events {
+		if e.Reason != reasons[i] {
+			t.Errorf("Invalid prune reason %v, want %v", e.Reason, reasons[i])
+		}
+	}
+	if filepath.Base(events[0].File) != "old" || events[1].Domain != "127.0.0.1" {
+		t.Errorf("Invalid prune events %v", events)
+	}
+	if len(d.Assets()) != 1 || d.Lookup(site.URL("/c.pdf")) == nil {
+		t.Errorf("Pruned assets were not removed from the index")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "00", "new")); err != nil {
+		t.Error(err)
+	}
+
+	d, err = New(colly.NewCollector(), d.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Assets()) != 1 {
+		t.Errorf("Pruned assets were not removed from the saved index")
+	}
+}
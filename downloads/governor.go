@@ -0,0 +1,297 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloads
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PruneReason tells which limit caused the removal of a file
+type PruneReason int
+
+const (
+	// Expired files are older than Governor.MaxAge
+	Expired PruneReason = iota
+	// DomainSizeExceeded files are removed because the files of their
+	// domain exceed Governor.MaxDomainSize
+	DomainSizeExceeded
+	// SizeExceeded files are removed because the governed directories
+	// exceed Governor.MaxSize
+	SizeExceeded
+)
+
+// String returns the name of the reason
+func (r PruneReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case DomainSizeExceeded:
+		return "domain size exceeded"
+	}
+	return "size exceeded"
+}
+
+// PruneEvent describes a file removed by a Governor
+type PruneEvent struct {
+	// File is the path of the removed file
+	File string
+	// Domain is the domain of the file or empty if it is unknown
+	Domain  string
+	Size    int64
+	ModTime time.Time
+	Reason  PruneReason
+}
+
+// Governor limits the disk usage of download directories and caches.
+// Files are removed oldest first until the limits are satisfied.
+//
+//	g := &downloads.Governor{
+//		Dirs:       []string{c.CacheDir},
+//		Downloader: d,
+//		MaxSize:    10 << 30,
+//		MaxAge:     30 * 24 * time.Hour,
+//	}
+//	g.Start(time.Hour)
+//	defer g.Stop()
+type Governor struct {
+	// Dirs are the governed directories, e.g. Collector.CacheDir
+	Dirs []string
+	// Downloader's directory is governed as well. The pruned assets are
+	// removed from its index and the domains of the files are taken from
+	// the URLs of the assets.
+	Downloader *Downloader
+	// Domain returns the domain of a file if it is not an asset of
+	// Downloader. MaxDomainSize does not apply to files without domain.
+	Domain func(fileName string) string
+	// MaxSize limits the total size of the governed files in bytes
+	MaxSize int64
+	// MaxDomainSize limits the total size of the files of a domain in bytes
+	MaxDomainSize int64
+	// MaxAge is the retention time of the files
+	MaxAge time.Duration
+	// OnPrune is called after a file has been removed
+	OnPrune func(PruneEvent)
+	// OnError is called if a periodic pruning started by Start fails
+	OnError func(error)
+	lock    sync.Mutex
+	stop    chan struct{}
+}
+
+type governedFile struct {
+	path    string
+	domain  string
+	size    int64
+	modTime time.Time
+	asset   *Asset
+}
+
+// Prune removes the expired files and the oldest files exceeding the
+// size limits
+func (g *Governor) Prune() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	files, err := g.files()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	var removed []*governedFile
+	remove := func(f *governedFile, reason PruneReason) error {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed = append(removed, f)
+		if g.OnPrune != nil {
+			g.OnPrune(PruneEvent{
+				File:    f.path,
+				Domain:  f.domain,
+				Size:    f.size,
+				ModTime: f.modTime,
+				Reason:  reason,
+			})
+		}
+		return nil
+	}
+	// the removed files are marked with negative size
+	prune := func(limit int64, match func(f *governedFile) bool, reason PruneReason) error {
+		var total int64
+		for _, f := range files {
+			if f.size >= 0 && match(f) {
+				total += f.size
+			}
+		}
+		for _, f := range files {
+			if total <= limit {
+				return nil
+			}
+			if f.size < 0 || !match(f) {
+				continue
+			}
+			if err := remove(f, reason); err != nil {
+				return err
+			}
+			total -= f.size
+			f.size = -1
+		}
+		return nil
+	}
+
+	if g.MaxAge > 0 {
+		deadline := time.Now().Add(-g.MaxAge)
+		for _, f := range files {
+			if !f.modTime.Before(deadline) {
+				break
+			}
+			if err = remove(f, Expired); err != nil {
+				break
+			}
+			f.size = -1
+		}
+	}
+	if err == nil && g.MaxDomainSize > 0 {
+		domains := map[string]bool{}
+		for _, f := range files {
+			if f.size >= 0 && f.domain != "" && !domains[f.domain] {
+				domains[f.domain] = true
+				domain := f.domain
+				err = prune(g.MaxDomainSize, func(f *governedFile) bool {
+					return f.domain == domain
+				}, DomainSizeExceeded)
+				if err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == nil && g.MaxSize > 0 {
+		err = prune(g.MaxSize, func(*governedFile) bool { return true }, SizeExceeded)
+	}
+
+	if g.Downloader != nil && len(removed) > 0 {
+		var assets []*Asset
+		for _, f := range removed {
+			if f.asset != nil {
+				assets = append(assets, f.asset)
+			}
+		}
+		if len(assets) > 0 {
+			g.Downloader.remove(assets)
+			if saveErr := g.Downloader.SaveIndex(); err == nil {
+				err = saveErr
+			}
+		}
+	}
+	return err
+}
+
+// Start prunes the governed directories periodically until Stop is called
+func (g *Governor) Start(interval time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	g.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := g.Prune(); err != nil && g.OnError != nil {
+					g.OnError(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic pruning
+func (g *Governor) Stop() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+}
+
+// files lists the governed files. Indexes and files being written
+// are skipped.
+func (g *Governor) files() ([]*governedFile, error) {
+	assets := map[string]*Asset{}
+	dirs := g.Dirs
+	if d := g.Downloader; d != nil {
+		dirs = append([]string{d.Dir}, dirs...)
+		d.lock.RLock()
+		for _, a := range d.assets {
+			assets[filepath.Clean(filepath.Join(d.Dir, a.File))] = a
+		}
+		d.lock.RUnlock()
+	}
+	var files []*governedFile
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			p = filepath.Clean(p)
+			if info.IsDir() || seen[p] || info.Name() == IndexFile || strings.HasSuffix(p, "~") {
+				return nil
+			}
+			seen[p] = true
+			f := &governedFile{
+				path:    p,
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				asset:   assets[p],
+			}
+			if f.asset != nil {
+				if len(f.asset.URLs) > 0 {
+					if u, err := url.Parse(f.asset.URLs[0]); err == nil {
+						f.domain = u.Hostname()
+					}
+				}
+			} else if g.Domain != nil {
+				f.domain = g.Domain(p)
+			}
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
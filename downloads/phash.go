@@ -0,0 +1,120 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloads
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	phashSize    = 32
+	phashLowFreq = 8
+)
+
+// PHash returns the 64 bit perceptual hash of an image. Visually similar
+// images have hashes with small Hamming distance regardless of their
+// resolution, format and compression artifacts.
+func PHash(img image.Image) uint64 {
+	pixels := grayscale(img, phashSize)
+	coeffs := dct2D(pixels)
+	low := make([]float64, 0, phashLowFreq*phashLowFreq)
+	for y := 0; y < phashLowFreq; y++ {
+		for x := 0; x < phashLowFreq; x++ {
+			low = append(low, coeffs[y][x])
+		}
+	}
+	// the DC coefficient is the average brightness, it is excluded
+	// from the median to make the hash independent of it
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash uint64
+	for i, c := range low {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of different bits of two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale scales the image to size x size luminance values
+// by averaging the pixels of each cell
+func grayscale(img image.Image, size int) [][]float64 {
+	b := img.Bounds()
+	res := make([][]float64, size)
+	for y := 0; y < size; y++ {
+		res[y] = make([]float64, size)
+		y0 := b.Min.Y + y*b.Dy()/size
+		y1 := b.Min.Y + (y+1)*b.Dy()/size
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < size; x++ {
+			x0 := b.Min.X + x*b.Dx()/size
+			x1 := b.Min.X + (x+1)*b.Dx()/size
+			if x1 == x0 {
+				x1++
+			}
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			res[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return res
+}
+
+// dct2D calculates the two dimensional DCT-II of a square matrix
+func dct2D(m [][]float64) [][]float64 {
+	n := len(m)
+	cos := make([][]float64, n)
+	for k := 0; k < n; k++ {
+		cos[k] = make([]float64, n)
+		for i := 0; i < n; i++ {
+			cos[k][i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+	rows := make([][]float64, n)
+	for y := 0; y < n; y++ {
+		rows[y] = make([]float64, n)
+		for k := 0; k < n; k++ {
+			for i := 0; i < n; i++ {
+				rows[y][k] += m[y][i] * cos[k][i]
+			}
+		}
+	}
+	res := make([][]float64, n)
+	for k := 0; k < n; k++ {
+		res[k] = make([]float64, n)
+		for x := 0; x < n; x++ {
+			for i := 0; i < n; i++ {
+				res[k][x] += rows[i][x] * cos[k][i]
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,360 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloads
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+var (
+	// ErrChecksumMismatch is the error returned if the checksum of a
+	// downloaded file differs from the digest sent by the server
+	ErrChecksumMismatch = errors.New("Checksum mismatch")
+	// ErrInvalidRange is the error returned if the server responds
+	// to a range request with an unexpected part
+	ErrInvalidRange = errors.New("Invalid range response")
+)
+
+// digestHashes are the supported algorithms of the Digest header
+var digestHashes = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// rangeState is saved next to the partial file of a ranged download,
+// so interrupted downloads can be resumed
+type rangeState struct {
+	URL       string `json:"url"`
+	ETag      string `json:"etag"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Done      []bool `json:"done"`
+}
+
+// downloadRanges fetches the file in ChunkSize parts using
+// ChunkParallelism concurrent range requests. The first part tells
+// whether the server supports range requests and the size of the file.
+// The fetched parts of interrupted downloads are reused if the server
+// sends the same strong ETag.
+func (d *Downloader) downloadRanges(URL string) error {
+	c := d.Collector.Clone()
+	c.AllowURLRevisit = true
+	c.Async = false
+	// cached responses ignore the Range header
+	c.CacheDir = ""
+	if c.MaxBodySize > 0 && int64(c.MaxBodySize) < d.ChunkSize {
+		c.MaxBodySize = int(d.ChunkSize)
+	}
+	c.OnResponse(func(r *colly.Response) {
+		r.Ctx.Put("response", r)
+	})
+
+	first, err := fetchRange(c, URL, 0, d.ChunkSize-1, "")
+	if err != nil {
+		return err
+	}
+	if first.StatusCode != http.StatusPartialContent {
+		// range requests are not supported, the whole file was received
+		_, err := d.Store(first)
+		return err
+	}
+	start, end, size, err := contentRange(first)
+	if err != nil {
+		return err
+	}
+	contentType := first.Headers.Get("Content-Type")
+	if d.tooLarge(contentType, size) {
+		return ErrAssetTooLarge
+	}
+	if size <= int64(len(first.Body)) {
+		if start != 0 || int64(len(first.Body)) != size {
+			return ErrInvalidRange
+		}
+		if err := verifyDigest(*first.Headers, bytes.NewReader(first.Body), false); err != nil {
+			return err
+		}
+		_, err := d.storeBody(first.Request.URL, contentType, first.Body)
+		return err
+	}
+	if start != 0 || end != d.ChunkSize-1 || int64(len(first.Body)) != d.ChunkSize {
+		return ErrInvalidRange
+	}
+
+	// If-Range ensures that every part belongs to the same version
+	etag := first.Headers.Get("ETag")
+	if strings.HasPrefix(etag, "W/") {
+		etag = ""
+	}
+	sum := sha1.Sum([]byte(URL))
+	partName := filepath.Join(d.Dir, hex.EncodeToString(sum[:])+".part")
+	stateName := partName + ".json"
+	chunks := int((size + d.ChunkSize - 1) / d.ChunkSize)
+	state := &rangeState{}
+	if b, err := ioutil.ReadFile(stateName); err == nil {
+		json.Unmarshal(b, state)
+	}
+	if etag == "" || state.URL != URL || state.ETag != etag || state.Size != size || state.ChunkSize != d.ChunkSize || len(state.Done) != chunks {
+		state = &rangeState{
+			URL:       URL,
+			ETag:      etag,
+			Size:      size,
+			ChunkSize: d.ChunkSize,
+			Done:      make([]bool, chunks),
+		}
+		os.Remove(partName)
+	}
+	f, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(first.Body, 0); err != nil {
+		f.Close()
+		return err
+	}
+	state.Done[0] = true
+	stateLock := &sync.Mutex{}
+
+	indexes := make(chan int)
+	errs := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+	parallelism := d.ChunkParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				from := int64(i) * d.ChunkSize
+				to := from + d.ChunkSize - 1
+				if to >= size {
+					to = size - 1
+				}
+				err := fetchPart(c, URL, f, from, to, etag)
+				if err == nil && etag != "" {
+					stateLock.Lock()
+					state.Done[i] = true
+					err = saveState(stateName, state)
+					stateLock.Unlock()
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	for i := 1; i < chunks; i++ {
+		select {
+		case err = <-errs:
+		default:
+		}
+		if err != nil {
+			break
+		}
+		if !state.Done[i] {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if etag == "" {
+			// the parts can not be reused without ETag
+			os.Remove(partName)
+		}
+		return err
+	}
+	os.Remove(stateName)
+	defer os.Remove(partName)
+	_, err = d.storeFile(first.Request.URL, contentType, *first.Headers, partName, size)
+	return err
+}
+
+func saveState(fileName string, state *rangeState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFile(fileName, b)
+}
+
+func fetchRange(c *colly.Collector, URL string, from, to int64, etag string) (*colly.Response, error) {
+	hdr := http.Header{}
+	hdr.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	if etag != "" {
+		hdr.Set("If-Range", etag)
+	}
+	ctx := colly.NewContext()
+	if err := c.Request("GET", URL, nil, ctx, hdr); err != nil {
+		return nil, err
+	}
+	r, ok := ctx.GetAny("response").(*colly.Response)
+	if !ok {
+		return nil, ErrInvalidRange
+	}
+	return r, nil
+}
+
+func fetchPart(c *colly.Collector, URL string, f *os.File, from, to int64, etag string) error {
+	r, err := fetchRange(c, URL, from, to, etag)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusPartialContent {
+		// the file has been changed since the first part
+		return ErrInvalidRange
+	}
+	start, end, _, err := contentRange(r)
+	if err != nil {
+		return err
+	}
+	if start != from || end != to || int64(len(r.Body)) != to-from+1 {
+		return ErrInvalidRange
+	}
+	_, err = f.WriteAt(r.Body, from)
+	return err
+}
+
+// contentRange parses the Content-Range header of a partial response
+func contentRange(r *colly.Response) (start, end, size int64, err error) {
+	v := strings.TrimPrefix(r.Headers.Get("Content-Range"), "bytes ")
+	slash := strings.IndexByte(v, '/')
+	dash := strings.IndexByte(v, '-')
+	if slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	if start, err = strconv.ParseInt(v[:dash], 10, 64); err != nil {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	if end, err = strconv.ParseInt(v[dash+1:slash], 10, 64); err != nil {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	if size, err = strconv.ParseInt(v[slash+1:], 10, 64); err != nil {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	return start, end, size, nil
+}
+
+// storeFile moves an assembled file to the download directory after
+// verifying its checksum
+func (d *Downloader) storeFile(u *url.URL, contentType string, headers http.Header, partName string, size int64) (*Asset, error) {
+	f, err := os.Open(partName)
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.New()
+	err = verifyDigest(headers, io.TeeReader(f, h), false)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	URL := u.String()
+	a := &Asset{
+		SHA1:        hex.EncodeToString(h.Sum(nil)),
+		ContentType: contentType,
+		Size:        int(size),
+		URLs:        []string{URL},
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if dup := d.duplicate(a, false); dup != nil {
+		d.alias(dup, URL)
+		return dup, nil
+	}
+	a.File = d.fileName(u, a)
+	fileName := filepath.Join(d.Dir, a.File)
+	if err := os.MkdirAll(filepath.Dir(fileName), 0750); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(partName, fileName); err != nil {
+		return nil, err
+	}
+	d.assets = append(d.assets, a)
+	d.aliases[URL] = a
+	return a, nil
+}
+
+// verifyDigest checks the content against the Digest (RFC 3230) and
+// Content-MD5 headers. Content-MD5 of partial responses belongs to the
+// part, so it is only checked if complete is true.
+// The content is always read to the end.
+func verifyDigest(headers http.Header, content io.Reader, complete bool) error {
+	expected := map[string]string{}
+	for _, d := range strings.Split(headers.Get("Digest"), ",") {
+		i := strings.IndexByte(d, '=')
+		if i < 0 {
+			continue
+		}
+		alg := strings.ToLower(strings.TrimSpace(d[:i]))
+		if _, ok := digestHashes[alg]; ok {
+			expected[alg] = strings.TrimSpace(d[i+1:])
+		}
+	}
+	if md5sum := headers.Get("Content-MD5"); md5sum != "" && complete {
+		expected["md5"] = md5sum
+	}
+	hashes := map[string]hash.Hash{}
+	writers := []io.Writer{ioutil.Discard}
+	for alg := range expected {
+		hashes[alg] = digestHashes[alg]()
+		writers = append(writers, hashes[alg])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), content); err != nil {
+		return err
+	}
+	for alg, h := range hashes {
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != expected[alg] {
+			return ErrChecksumMismatch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// stopRule ends the parsing of HTML documents after the nth element
+// matching the selector
+type stopRule struct {
+	selector cascadia.Selector
+	n        int
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// lateStopPseudoClasses matches the pseudo-classes which depend on the
+// content or the following siblings of the elements
+var lateStopPseudoClasses = regexp.MustCompile(`(?i):(contains|containsown|matches|matchesown|has|haschild|empty|last-child|last-of-type|only-child|only-of-type|nth-last-child|nth-last-of-type)\b`)
+
+// quotedSelectorStrings matches the quoted strings of selectors, e.g.
+// attribute values
+var quotedSelectorStrings = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+
+// StopParsingAfter ends the parsing of HTML responses after the end of
+// the nth element matching the CSS selector, e.g. StopParsingAfter("table", 1)
+// if only the first table of the pages is processed. The elements after
+// it are not passed to the OnHTML and OnXML callbacks.
+// The body is tokenized up to the end of the element to find it, so the
+// rule pays off only if the element is near the start of the pages.
+// The elements are matched when their start tags are read, knowing only
+// their attributes, ancestors and preceding siblings. Selectors with
+// pseudo-classes depending on the content or the following siblings of
+// the elements, e.g. :contains(), :has(), :empty or :last-child, are
+// rejected with ErrUnsupportedStopSelector.
+// Passing a non-positive n removes the rule.
+func (c *Collector) StopParsingAfter(selector string, n int) error {
+	var rule *stopRule
+	if n > 0 {
+		sel, err := cascadia.Compile(selector)
+		if err != nil {
+			return err
+		}
+		if lateStopPseudoClasses.MatchString(quotedSelectorStrings.ReplaceAllString(selector, "")) {
+			return ErrUnsupportedStopSelector
+		}
+		rule = &stopRule{selector: sel, n: n}
+	}
+	c.lock.Lock()
+	c.stopRule = rule
+	c.lock.Unlock()
+	return nil
+}
+
+// htmlBody returns the part of the body of a HTML response to parse
+func (c *Collector) htmlBody(resp *Response) []byte {
+	c.lock.RLock()
+	rule := c.stopRule
+	c.lock.RUnlock()
+	if rule == nil {
+		return resp.Body
+	}
+	return rule.cut(resp.Body)
+}
+
+// cut returns the prefix of the body ending with the nth matching
+// element. The elements of the prefix are matched against the selector
+// with their ancestors and preceding siblings, so the whole document
+// is returned if the markup relies on implicitly closed elements.
+func (r *stopRule) cut(body []byte) []byte {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	root := &html.Node{Type: html.DocumentNode}
+	stack := []*html.Node{root}
+	matches := 0
+	var last *html.Node
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return body
+		}
+		offset += len(z.Raw())
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			n := &html.Node{
+				Type:     html.ElementNode,
+				Data:     t.Data,
+				DataAtom: t.DataAtom,
+				Attr:     t.Attr,
+			}
+			stack[len(stack)-1].AppendChild(n)
+			if r.selector.Match(n) {
+				matches++
+				if matches == r.n {
+					last = n
+				}
+			}
+			if tt == html.SelfClosingTagToken || voidElements[t.Data] {
+				if last == n {
+					return body[:offset]
+				}
+				continue
+			}
+			stack = append(stack, n)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].Data != string(name) {
+					continue
+				}
+				for _, n := range stack[i:] {
+					if n == last {
+						return body[:offset]
+					}
+				}
+				stack = stack[:i]
+				break
+			}
+		}
+	}
+}
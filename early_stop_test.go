@@ -0,0 +1,127 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const earlyStopPage = `<html><head><title>T</title><meta name="a" content="1"></head><body>
+<div class="x"><table><tr><td>1</td></tr></table></div>
+<table><tr><td>2</td></tr></table>
+<table><tr><td>3</td></tr></table>
+</body></html>`
+
+func TestStopRuleCut(t *testing.T) {
+	c := NewCollector()
+	tests := []struct {
+		selector string
+		n        int
+		suffix   string
+	}{
+		{"table", 1, "<td>1</td></tr></table>"},
+		{"table", 2, "<td>2</td></tr></table>"},
+		{"div.x td", 1, "<td>1</td>"},
+		{"meta", 1, `<meta name="a" content="1">`},
+		{"head", 1, "</head>"},
+	}
+	for _, tt := range tests {
+		if err := c.StopParsingAfter(tt.selector, tt.n); err != nil {
+			t.Fatal(err)
+		}
+		body := string(c.stopRule.cut([]byte(earlyStopPage)))
+		if len(body) < len(tt.suffix) || body[len(body)-len(tt.suffix):] != tt.suffix {
+			t.Errorf("Unexpected cut of %s %d: %q", tt.selector, tt.n, body)
+		}
+	}
+	c.StopParsingAfter("table", 4)
+	if body := c.stopRule.cut([]byte(earlyStopPage)); string(body) != earlyStopPage {
+		t.Error("Body was cut without enough matches")
+	}
+	if err := c.StopParsingAfter("table[", 1); err == nil {
+		t.Error("Invalid selector was accepted")
+	}
+	if err := c.StopParsingAfter("h1 + p", 1); err != nil {
+		t.Fatal(err)
+	}
+	if body := string(c.stopRule.cut([]byte("<h1>a</h1><p>x</p><p>y</p>"))); body != "<h1>a</h1><p>x</p>" {
+		t.Errorf("Unexpected cut of a sibling selector: %q", body)
+	}
+}
+
+func TestStopParsingAfterUnsupportedSelector(t *testing.T) {
+	c := NewCollector()
+	for _, selector := range []string{
+		"td:contains('2')",
+		"div:has(table)",
+		"p:empty",
+		"tr:last-child",
+		"li:not(:only-child)",
+		"td:NTH-LAST-CHILD(2)",
+	} {
+		if err := c.StopParsingAfter(selector, 1); err != ErrUnsupportedStopSelector {
+			t.Errorf("Unexpected error of %s: %v", selector, err)
+		}
+	}
+	if c.stopRule != nil {
+		t.Error("Unsupported selector was set")
+	}
+	for _, selector := range []string{`a[title=":empty"]`, "tr:first-child", "td:nth-child(2)"} {
+		if err := c.StopParsingAfter(selector, 1); err != nil {
+			t.Errorf("Unexpected error of %s: %v", selector, err)
+		}
+	}
+}
+
+func TestStopParsingAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(earlyStopPage))
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	if err := c.StopParsingAfter("table", 2); err != nil {
+		t.Fatal(err)
+	}
+	var cells []string
+	c.OnHTML("td", func(e *HTMLElement) {
+		cells = append(cells, e.Text)
+	})
+	c.Visit(ts.URL)
+	if len(cells) != 2 || cells[0] != "1" || cells[1] != "2" {
+		t.Errorf("Unexpected cells: %v", cells)
+	}
+}
+
+func TestStopParsingAfterDuringCrawl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(earlyStopPage))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(Async(), AllowURLRevisit())
+	c.OnHTML("td", func(e *HTMLElement) {})
+	for i := 0; i < 10; i++ {
+		c.Visit(ts.URL)
+		if err := c.StopParsingAfter("table", i%3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Wait()
+}
@@ -0,0 +1,292 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package enrich passes the text of extracted items to external
+// enrichment services, e.g. embedding, classification or summarization
+// APIs, and writes the results back onto the items:
+//
+//	p := enrich.NewPipeline("embedding", enrich.StageFunc(embed))
+//	c.OnHTML("article", func(e *colly.HTMLElement) {
+//		p.Add(&enrich.Record{Text: e.Text})
+//	})
+//	c.Visit("https://example.com/")
+//	c.Wait()
+//	p.Close()
+//
+// Items are sent to the service in batches by a limited number of
+// concurrent workers and failed batches are retried with exponential
+// backoff.
+package enrich
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Stage is an enrichment service processing a batch of texts. It returns
+// one result for every text in the same order.
+type Stage interface {
+	Enrich(ctx context.Context, texts []string) ([]interface{}, error)
+}
+
+// StageFunc is an adapter to use ordinary functions as Stage
+type StageFunc func(ctx context.Context, texts []string) ([]interface{}, error)
+
+// Enrich calls f(ctx, texts)
+func (f StageFunc) Enrich(ctx context.Context, texts []string) ([]interface{}, error) {
+	return f(ctx, texts)
+}
+
+// Item is an extracted item passed through a Pipeline
+type Item interface {
+	// EnrichText returns the text sent to the enrichment service
+	EnrichText() string
+	// SetEnrichment stores the result of the named pipeline
+	SetEnrichment(name string, result interface{})
+}
+
+// Record is a simple Item keeping the results in a map
+type Record struct {
+	Text        string
+	Enrichments map[string]interface{}
+	lock        sync.Mutex
+}
+
+// EnrichText implements Item
+func (r *Record) EnrichText() string {
+	return r.Text
+}
+
+// SetEnrichment implements Item
+func (r *Record) SetEnrichment(name string, result interface{}) {
+	r.lock.Lock()
+	if r.Enrichments == nil {
+		r.Enrichments = make(map[string]interface{})
+	}
+	r.Enrichments[name] = result
+	r.lock.Unlock()
+}
+
+// Enrichment returns the result of the named pipeline
+func (r *Record) Enrichment(name string) interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.Enrichments[name]
+}
+
+var (
+	// ErrPipelineClosed is returned by Add if the pipeline is closed
+	ErrPipelineClosed = errors.New("Pipeline is closed")
+	// ErrResultCount is the error of batches whose number of results
+	// differs from the number of texts
+	ErrResultCount = errors.New("Number of enrichment results does not match the number of texts")
+)
+
+// Pipeline sends the text of the added items in batches to a Stage
+type Pipeline struct {
+	// Name is the name of the results set on the items
+	Name string
+	// Stage is the enrichment service
+	Stage Stage
+	// BatchSize is the maximum number of items sent in one batch
+	BatchSize int
+	// FlushInterval is the maximum time an item waits for its batch to
+	// fill up. Zero means the items wait until the batch is full or
+	// Flush is called.
+	FlushInterval time.Duration
+	// Concurrency is the maximum number of batches processed in parallel
+	Concurrency int
+	// MaxRetries is the number of retries of a failed batch
+	MaxRetries int
+	// RetryDelay is the delay before the first retry. It is doubled
+	// after every retry.
+	RetryDelay time.Duration
+	// Retryable decides if an error of the Stage is temporary. All the
+	// errors are retried if it is nil.
+	Retryable func(err error) bool
+	// Context is passed to the Stage. Pending batches are dropped if it
+	// is canceled.
+	Context context.Context
+	// OnEnriched is called after the result is set on an item
+	OnEnriched func(item Item)
+	// OnError is called with the items of a batch which failed after
+	// all the retries
+	OnError func(items []Item, err error)
+	pending []Item
+	batches chan []Item
+	timer   *time.Timer
+	sending sync.WaitGroup
+	wg      sync.WaitGroup
+	closed  bool
+	lock    sync.Mutex
+}
+
+// NewPipeline creates a Pipeline with batches of 16 items, 4 concurrent
+// workers and 3 retries
+func NewPipeline(name string, stage Stage) *Pipeline {
+	return &Pipeline{
+		Name:        name,
+		Stage:       stage,
+		BatchSize:   16,
+		Concurrency: 4,
+		MaxRetries:  3,
+		RetryDelay:  time.Second,
+	}
+}
+
+// Add queues an item for enrichment. Add blocks if all the workers are
+// busy and a full batch is waiting.
+func (p *Pipeline) Add(item Item) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return ErrPipelineClosed
+	}
+	p.start()
+	p.pending = append(p.pending, item)
+	var batch []Item
+	if len(p.pending) >= p.batchSize() {
+		batch = p.takeBatch()
+	} else if len(p.pending) == 1 && p.FlushInterval > 0 {
+		p.timer = time.AfterFunc(p.FlushInterval, p.Flush)
+	}
+	if batch != nil {
+		p.sending.Add(1)
+	}
+	p.lock.Unlock()
+	if batch != nil {
+		p.batches <- batch
+		p.sending.Done()
+	}
+	return nil
+}
+
+// Flush sends the pending items without waiting for the batch to fill up
+func (p *Pipeline) Flush() {
+	p.lock.Lock()
+	if p.closed || len(p.pending) == 0 {
+		p.lock.Unlock()
+		return
+	}
+	batch := p.takeBatch()
+	p.sending.Add(1)
+	p.lock.Unlock()
+	p.batches <- batch
+	p.sending.Done()
+}
+
+// Close flushes the pending items and waits until every batch is
+// processed
+func (p *Pipeline) Close() {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.closed = true
+	batch := p.takeBatch()
+	p.lock.Unlock()
+	if len(batch) > 0 {
+		p.batches <- batch
+	}
+	p.sending.Wait()
+	if p.batches != nil {
+		close(p.batches)
+	}
+	p.wg.Wait()
+}
+
+func (p *Pipeline) batchSize() int {
+	if p.BatchSize < 1 {
+		return 1
+	}
+	return p.BatchSize
+}
+
+// start launches the workers on the first call. It must be called
+// holding the lock.
+func (p *Pipeline) start() {
+	if p.batches != nil {
+		return
+	}
+	n := p.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	p.batches = make(chan []Item)
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer p.wg.Done()
+			for batch := range p.batches {
+				p.process(batch)
+			}
+		}()
+	}
+}
+
+// takeBatch removes the pending items. It must be called holding the
+// lock.
+func (p *Pipeline) takeBatch() []Item {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	batch := p.pending
+	p.pending = nil
+	return batch
+}
+
+func (p *Pipeline) process(batch []Item) {
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	texts := make([]string, len(batch))
+	for i, item := range batch {
+		texts[i] = item.EnrichText()
+	}
+	delay := p.RetryDelay
+	for retries := 0; ; retries++ {
+		results, err := p.Stage.Enrich(ctx, texts)
+		if err == nil && len(results) != len(batch) {
+			err = ErrResultCount
+		}
+		if err == nil {
+			for i, item := range batch {
+				item.SetEnrichment(p.Name, results[i])
+				if p.OnEnriched != nil {
+					p.OnEnriched(item)
+				}
+			}
+			return
+		}
+		retryable := err != ErrResultCount && (p.Retryable == nil || p.Retryable(err))
+		if retries < p.MaxRetries && retryable && ctx.Err() == nil {
+			select {
+			case <-time.After(delay):
+				delay *= 2
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		if p.OnError != nil {
+			p.OnError(batch, err)
+		}
+		return
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrich
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	var calls, running, maxRunning int32
+	var lock sync.Mutex
+	var sizes []int
+	stage := StageFunc(func(ctx context.Context, texts []string) ([]interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		lock.Lock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		lock.Unlock()
+		// every third call fails temporarily
+		if atomic.AddInt32(&calls, 1)%3 == 0 {
+			return nil, errors.New("temporary failure")
+		}
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		sizes = append(sizes, len(texts))
+		lock.Unlock()
+		results := make([]interface{}, len(texts))
+		for i, t := range texts {
+			results[i] = strings.ToUpper(t)
+		}
+		return results, nil
+	})
+	p := NewPipeline("upper", stage)
+	p.BatchSize = 4
+	p.Concurrency = 2
+	p.RetryDelay = time.Millisecond
+	var enriched int32
+	p.OnEnriched = func(Item) {
+		atomic.AddInt32(&enriched, 1)
+	}
+	p.OnError = func(items []Item, err error) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	records := make([]*Record, 10)
+	for i := range records {
+		records[i] = &Record{Text: string(rune('a' + i))}
+		if err := p.Add(records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	for i, r := range records {
+		if r.Enrichment("upper") != string(rune('A'+i)) {
+			t.Errorf("Invalid enrichment of item %d: %v", i, r.Enrichment("upper"))
+		}
+	}
+	if enriched != 10 {
+		t.Errorf("Invalid number of enriched items %d", enriched)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Concurrency limit exceeded: %d", maxRunning)
+	}
+	if len(sizes) != 3 {
+		t.Errorf("Invalid batches %v", sizes)
+	}
+	if err := p.Add(&Record{}); err != ErrPipelineClosed {
+		t.Errorf("Invalid error after Close: %v", err)
+	}
+}
+
+func TestPipelineFailure(t *testing.T) {
+	var calls int32
+	stage := StageFunc(func(ctx context.Context, texts []string) ([]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("failure")
+	})
+	p := NewPipeline("x", stage)
+	p.MaxRetries = 2
+	p.RetryDelay = time.Millisecond
+	p.FlushInterval = 10 * time.Millisecond
+	failed := make(chan int, 1)
+	p.OnError = func(items []Item, err error) {
+		failed <- len(items)
+	}
+	p.Add(&Record{Text: "a"})
+	p.Add(&Record{Text: "b"})
+	select {
+	case n := <-failed:
+		if n != 2 {
+			t.Errorf("Invalid number of failed items %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Batch was not flushed")
+	}
+	p.Close()
+	if calls != 3 {
+		t.Errorf("Invalid number of calls %d", calls)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// ErrorSkipRule skips the URLs which failed repeatedly in the previous
+// crawls, e.g. ErrorSkipRule{Class: "404", Count: 2} skips the URLs
+// which responded with 404 Not Found twice
+type ErrorSkipRule struct {
+	// Class is the error class counted by the rule. See ErrorClass.
+	// Every failure is counted if it is empty.
+	Class string
+	// Count is the number of failures after which the URL is skipped
+	Count int
+	// MaxAge ends skipping the URL if its last failure is older.
+	// 0 means forever.
+	MaxAge time.Duration
+}
+
+// RecordErrorHistory records the failures of the URLs in the storage of
+// the Collector if it implements storage.ErrorHistoryStorage. The
+// history of a URL is cleared if it is downloaded successfully.
+func RecordErrorHistory() CollectorOption {
+	return func(c *Collector) {
+		c.RecordErrorHistory = true
+	}
+}
+
+// SkipFailedURLs skips the URLs whose recorded failures match any of the
+// rules. It enables RecordErrorHistory.
+func SkipFailedURLs(rules ...ErrorSkipRule) CollectorOption {
+	return func(c *Collector) {
+		c.RecordErrorHistory = true
+		c.ErrorSkipRules = rules
+	}
+}
+
+// ErrorClass returns the class of a failed request as recorded by
+// RecordErrorHistory: the status code of HTTP errors (e.g. "404"),
+// "timeout", "dns", "connection", "tls" or "other". It returns an empty
+// string if the request succeeded or was canceled.
+func ErrorClass(r *Response, err error) string {
+	if err == nil {
+		if r != nil && r.StatusCode >= 400 {
+			return strconv.Itoa(r.StatusCode)
+		}
+		return ""
+	}
+	if err == ErrAbortedAfterHeaders || err == context.Canceled {
+		return ""
+	}
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	switch err.(type) {
+	case *net.DNSError:
+		return "dns"
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return "tls"
+	}
+	msg := err.Error()
+	switch {
+	case err == context.DeadlineExceeded:
+		return "timeout"
+	case strings.HasPrefix(msg, "tls:") || strings.Contains(msg, "x509:"):
+		return "tls"
+	case strings.Contains(msg, "connection refused") || strings.Contains(msg, "connection reset") || strings.Contains(msg, "EOF"):
+		return "connection"
+	}
+	return "other"
+}
+
+// matches returns true if the failures of a URL match the rule
+func (r ErrorSkipRule) matches(h *storage.ErrorHistory) bool {
+	if r.MaxAge > 0 && time.Since(h.LastAttempt) > r.MaxAge {
+		return false
+	}
+	count := h.Counts[r.Class]
+	if r.Class == "" {
+		count = 0
+		for _, n := range h.Counts {
+			count += n
+		}
+	}
+	return count >= r.Count
+}
+
+// checkErrorHistory returns ErrSkippedFailedURL if the URL is skipped by
+// the ErrorSkipRules
+func (c *Collector) checkErrorHistory(u string) error {
+	if len(c.ErrorSkipRules) == 0 {
+		return nil
+	}
+	s, ok := c.store.(storage.ErrorHistoryStorage)
+	if !ok {
+		return nil
+	}
+	h, err := s.GetErrorHistory(u)
+	if err != nil || h == nil {
+		return err
+	}
+	for _, r := range c.ErrorSkipRules {
+		if r.matches(h) {
+			return ErrSkippedFailedURL
+		}
+	}
+	return nil
+}
+
+// recordError updates the error history of the URL
+func (c *Collector) recordError(u string, r *Response, err error) {
+	if !c.RecordErrorHistory {
+		return
+	}
+	s, ok := c.store.(storage.ErrorHistoryStorage)
+	if !ok {
+		return
+	}
+	if class := ErrorClass(r, err); class != "" {
+		s.AddError(u, class, time.Now())
+	} else if err == nil {
+		s.ClearErrorHistory(u)
+	}
+}
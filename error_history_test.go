@@ -0,0 +1,81 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+func TestErrorHistory(t *testing.T) {
+	failing := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing && r.URL.Path == "/flaky" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	store := &storage.InMemoryStorage{}
+	crawl := func() error {
+		c := NewCollector(AllowURLRevisit(), SkipFailedURLs(ErrorSkipRule{Class: "404", Count: 2}))
+		if err := c.SetStorage(store); err != nil {
+			t.Fatal(err)
+		}
+		return c.Visit(ts.URL + "/flaky")
+	}
+	for i := 0; i < 2; i++ {
+		if err := crawl(); err == nil || err == ErrSkippedFailedURL {
+			t.Fatalf("Unexpected error of crawl %d: %v", i, err)
+		}
+	}
+	h, _ := store.GetErrorHistory(ts.URL + "/flaky")
+	if h == nil || h.Counts["404"] != 2 || h.LastClass != "404" {
+		t.Fatalf("Unexpected error history: %+v", h)
+	}
+	if err := crawl(); err != ErrSkippedFailedURL {
+		t.Errorf("Expected ErrSkippedFailedURL, got %v", err)
+	}
+
+	// success clears the history
+	failing = false
+	store.ClearErrorHistory(ts.URL + "/flaky")
+	store.AddError(ts.URL+"/flaky", "404", h.LastAttempt)
+	if err := crawl(); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := store.GetErrorHistory(ts.URL + "/flaky"); h != nil {
+		t.Errorf("Error history was not cleared: %+v", h)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	c := NewCollector()
+	var class string
+	c.OnError(func(r *Response, err error) {
+		class = ErrorClass(r, err)
+	})
+	c.Visit("http://127.0.0.1:1/")
+	if class != "connection" {
+		t.Errorf("Expected connection error class, got %q", class)
+	}
+	if ErrorClass(&Response{StatusCode: 200}, nil) != "" {
+		t.Error("Successful response has error class")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// HTMLEnv returns the Env of a HTML element with the variables
+//
+//	name, text, index, url, depth, status
+//
+// and the functions
+//
+//	attr(name), child_text(selector), child_texts(selector),
+//	child_attr(selector, name), has(selector), header(name), ctx(key)
+func HTMLEnv(e *colly.HTMLElement) *Env {
+	env := ResponseEnv(e.Response)
+	env.Vars["name"] = e.Name
+	env.Vars["text"] = strings.TrimSpace(e.Text)
+	env.Vars["index"] = e.Index
+	env.Funcs["attr"] = StringFunc(1, func(a []string) (interface{}, error) {
+		return e.Attr(a[0]), nil
+	})
+	env.Funcs["child_text"] = StringFunc(1, func(a []string) (interface{}, error) {
+		return strings.TrimSpace(e.ChildText(a[0])), nil
+	})
+	env.Funcs["child_texts"] = StringFunc(1, func(a []string) (interface{}, error) {
+		return e.ChildTexts(a[0]), nil
+	})
+	env.Funcs["child_attr"] = StringFunc(2, func(a []string) (interface{}, error) {
+		return e.ChildAttr(a[0], a[1]), nil
+	})
+	env.Funcs["has"] = StringFunc(1, func(a []string) (interface{}, error) {
+		return e.DOM.Find(a[0]).Length() > 0, nil
+	})
+	return env
+}
+
+// ResponseEnv returns the Env of a response with the variables
+//
+//	url, depth, status, content_type, size
+//
+// and the functions
+//
+//	header(name), ctx(key)
+func ResponseEnv(r *colly.Response) *Env {
+	env := &Env{
+		Vars: map[string]interface{}{
+			"url":    r.Request.URL.String(),
+			"depth":  r.Request.Depth,
+			"status": r.StatusCode,
+			"size":   len(r.Body),
+		},
+		Funcs: map[string]Func{
+			"header": StringFunc(1, func(a []string) (interface{}, error) {
+				if r.Headers == nil {
+					return "", nil
+				}
+				return r.Headers.Get(a[0]), nil
+			}),
+			"ctx": StringFunc(1, func(a []string) (interface{}, error) {
+				return r.Ctx.Get(a[0]), nil
+			}),
+		},
+	}
+	env.Vars["content_type"] = ""
+	if r.Headers != nil {
+		env.Vars["content_type"] = r.Headers.Get("Content-Type")
+	}
+	return env
+}
+
+// Rule is an expression which can be replaced at runtime. It is safe
+// for concurrent use.
+type Rule struct {
+	program *Program
+	lock    sync.RWMutex
+}
+
+// NewRule compiles a Rule
+func NewRule(source string) (*Rule, error) {
+	r := &Rule{}
+	return r, r.Set(source)
+}
+
+// Set replaces the expression of the rule. The rule is not changed if
+// the expression is invalid.
+func (r *Rule) Set(source string) error {
+	p, err := Compile(source)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.program = p
+	r.lock.Unlock()
+	return nil
+}
+
+// Program returns the current program of the rule
+func (r *Rule) Program() *Program {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.program
+}
+
+// FollowCondition returns a colly.FollowCondition evaluating the rule
+// on the link elements. Links whose evaluation fails are not followed.
+func (r *Rule) FollowCondition() colly.FollowCondition {
+	return func(link *colly.HTMLElement) bool {
+		ok, err := r.Program().Bool(HTMLEnv(link))
+		return err == nil && ok
+	}
+}
+
+// Match evaluates the rule on a response
+func (r *Rule) Match(res *colly.Response) (bool, error) {
+	return r.Program().Bool(ResponseEnv(res))
+}
+
+// Extractor extracts the fields of HTML elements by expressions, e.g.
+//
+//	x, _ := expr.NewExtractor(map[string]string{
+//		"title": `child_text("h1")`,
+//		"price": `number(replace(child_text(".price"), "$", ""))`,
+//	})
+//	c.OnHTML(".product", func(e *colly.HTMLElement) {
+//		item, err := x.Extract(e)
+//	})
+type Extractor struct {
+	rules map[string]*Rule
+	lock  sync.RWMutex
+}
+
+// NewExtractor compiles the expressions of the fields
+func NewExtractor(fields map[string]string) (*Extractor, error) {
+	x := &Extractor{rules: make(map[string]*Rule)}
+	for name, source := range fields {
+		if err := x.Set(name, source); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// Set adds or replaces the expression of a field
+func (x *Extractor) Set(name, source string) error {
+	r, err := NewRule(source)
+	if err != nil {
+		return err
+	}
+	x.lock.Lock()
+	x.rules[name] = r
+	x.lock.Unlock()
+	return nil
+}
+
+// Remove removes a field
+func (x *Extractor) Remove(name string) {
+	x.lock.Lock()
+	delete(x.rules, name)
+	x.lock.Unlock()
+}
+
+// Extract evaluates the fields on an element. The error of the first
+// failed field is returned with the other fields.
+func (x *Extractor) Extract(e *colly.HTMLElement) (map[string]interface{}, error) {
+	env := HTMLEnv(e)
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	values := make(map[string]interface{}, len(x.rules))
+	var firstErr error
+	for name, r := range x.rules {
+		v, err := r.Program().Eval(env)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		values[name] = v
+	}
+	return values, firstErr
+}
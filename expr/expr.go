@@ -0,0 +1,586 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expr implements a small expression language to define
+// extraction and follow rules as strings, so they can be changed at
+// runtime or loaded from a database without recompiling the scraper:
+//
+//	rule, _ := expr.NewRule(`depth < 3 && starts_with(attr("href"), "/product/")`)
+//	c.FollowLinks("a[href]").FollowIf(rule.FollowCondition())
+//
+// Expressions consist of string ("..." or '...'), number and boolean
+// literals, variables, function calls, parentheses and the operators
+// !, unary -, *, /, +, -, ==, !=, <, <=, >, >=, && and ||, in the order
+// of precedence. + concatenates strings. && and || short-circuit and
+// accept any value: nil, false, 0 and empty strings and lists are false.
+//
+// The variables and functions available for HTML elements and responses
+// are listed at HTMLEnv and ResponseEnv. The built-in functions are:
+//
+//	contains(s, substr), starts_with(s, prefix), ends_with(s, suffix)
+//	matches(s, regexp), lower(s), upper(s), trim(s), replace(s, old, new)
+//	len(s or list), number(s), string(v)
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Func is a function callable from expressions
+type Func func(args ...interface{}) (interface{}, error)
+
+// Env contains the variables and the functions of an evaluation. Values
+// are strings, float64 numbers, booleans, string lists or nil.
+type Env struct {
+	Vars  map[string]interface{}
+	Funcs map[string]Func
+}
+
+// ErrSyntax is the error of invalid expressions
+var ErrSyntax = errors.New("Syntax error")
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression
+func Compile(source string) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("%s: unexpected %q at %d", ErrSyntax, t.text, t.pos)
+	}
+	return &Program{source: source, root: root}, nil
+}
+
+// String returns the source of the program
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the program
+func (p *Program) Eval(env *Env) (interface{}, error) {
+	return p.root.eval(env)
+}
+
+// Bool evaluates the program and returns the truth value of the result
+func (p *Program) Bool(env *Env) (bool, error) {
+	v, err := p.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "!", "(", ")", ","}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					switch s[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(s[j])
+					}
+					continue
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("%s: unterminated string at %d", ErrSyntax, i)
+			}
+			tokens = append(tokens, token{tokenString, b.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j], i})
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{tokenOperator, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("%s: unexpected %q at %d", ErrSyntax, c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+// binaryPrecedence contains the precedence of the binary operators
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokenOperator || t.text != op {
+		return fmt.Errorf("%s: expected %q at %d", ErrSyntax, op, t.pos)
+	}
+	return nil
+}
+
+// parse parses the binary operations whose precedence is above min
+func (p *parser) parse(min int) (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.text]
+		if t.kind != tokenOperator || !ok || prec <= min {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parse(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return literalNode{t.text}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number %q at %d", ErrSyntax, t.text, t.pos)
+		}
+		return literalNode{f}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "nil":
+			return literalNode{nil}, nil
+		}
+		if n := p.peek(); n.kind != tokenOperator || n.text != "(" {
+			return varNode(t.text), nil
+		}
+		p.next()
+		call := &callNode{name: t.text}
+		if n := p.peek(); n.kind == tokenOperator && n.text == ")" {
+			p.next()
+			return call, nil
+		}
+		for {
+			arg, err := p.parse(0)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			n := p.next()
+			if n.kind == tokenOperator && n.text == ")" {
+				return call, nil
+			}
+			if n.kind != tokenOperator || n.text != "," {
+				return nil, fmt.Errorf("%s: expected \",\" or \")\" at %d", ErrSyntax, n.pos)
+			}
+		}
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			n, err := p.parse(0)
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "!", "-":
+			operand, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &unaryNode{op: t.text, operand: operand}, nil
+		}
+	}
+	if t.kind == tokenEOF {
+		return nil, fmt.Errorf("%s: unexpected end of expression", ErrSyntax)
+	}
+	return nil, fmt.Errorf("%s: unexpected %q at %d", ErrSyntax, t.text, t.pos)
+}
+
+type node interface {
+	eval(env *Env) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(*Env) (interface{}, error) {
+	return n.value, nil
+}
+
+type varNode string
+
+func (n varNode) eval(env *Env) (interface{}, error) {
+	if env != nil {
+		if v, ok := env.Vars[string(n)]; ok {
+			return normalize(v), nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown variable %q", string(n))
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(env *Env) (interface{}, error) {
+	f, ok := builtins[n.name]
+	if env != nil {
+		if ef, eok := env.Funcs[n.name]; eok {
+			f, ok = ef, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("Unknown function %q", n.name)
+	}
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := f(args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.name, err)
+	}
+	return normalize(v), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env *Env) (interface{}, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(v), nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("Invalid operand of -: %v", v)
+	}
+	return -f, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env *Env) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := n.right.eval(env)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := n.right.eval(env)
+		return truthy(r), err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "+":
+		if lf, ok := l.(float64); ok {
+			if rf, ok := r.(float64); ok {
+				return lf + rf, nil
+			}
+		}
+		return toString(l) + toString(r), nil
+	}
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch n.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("Invalid operands of %s: %v, %v", n.op, l, r)
+	}
+	switch n.op {
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		return lf / rf, nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	default:
+		return lf >= rf, nil
+	}
+}
+
+// normalize converts the Go values of variables and functions to the
+// types of the language
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case uint32:
+		return float64(t)
+	case float32:
+		return float64(t)
+	}
+	return v
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case float64:
+		return t != 0
+	case []string:
+		return len(t) > 0
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	switch t := a.(type) {
+	case []string:
+		u, ok := b.([]string)
+		if !ok || len(t) != len(u) {
+			return false
+		}
+		for i := range t {
+			if t[i] != u[i] {
+				return false
+			}
+		}
+		return true
+	case nil, string, float64, bool:
+		return a == b
+	}
+	return false
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []string:
+		return strings.Join(t, " ")
+	}
+	return fmt.Sprint(v)
+}
+
+// stringArgs checks the number of the arguments and converts them to
+// strings
+func stringArgs(args []interface{}, n int) ([]string, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	s := make([]string, n)
+	for i, a := range args {
+		s[i] = toString(a)
+	}
+	return s, nil
+}
+
+// StringFunc creates a Func of a Go function with string arguments
+func StringFunc(n int, f func(args []string) (interface{}, error)) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		s, err := stringArgs(args, n)
+		if err != nil {
+			return nil, err
+		}
+		return f(s)
+	}
+}
+
+var builtins = map[string]Func{
+	"contains": StringFunc(2, func(a []string) (interface{}, error) {
+		return strings.Contains(a[0], a[1]), nil
+	}),
+	"starts_with": StringFunc(2, func(a []string) (interface{}, error) {
+		return strings.HasPrefix(a[0], a[1]), nil
+	}),
+	"ends_with": StringFunc(2, func(a []string) (interface{}, error) {
+		return strings.HasSuffix(a[0], a[1]), nil
+	}),
+	"matches": StringFunc(2, func(a []string) (interface{}, error) {
+		return regexp.MatchString(a[1], a[0])
+	}),
+	"lower": StringFunc(1, func(a []string) (interface{}, error) {
+		return strings.ToLower(a[0]), nil
+	}),
+	"upper": StringFunc(1, func(a []string) (interface{}, error) {
+		return strings.ToUpper(a[0]), nil
+	}),
+	"trim": StringFunc(1, func(a []string) (interface{}, error) {
+		return strings.TrimSpace(a[0]), nil
+	}),
+	"replace": StringFunc(3, func(a []string) (interface{}, error) {
+		return strings.Replace(a[0], a[1], a[2], -1), nil
+	}),
+	"number": StringFunc(1, func(a []string) (interface{}, error) {
+		return strconv.ParseFloat(strings.TrimSpace(a[0]), 64)
+	}),
+	"string": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+		return toString(args[0]), nil
+	},
+	"len": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+		if l, ok := args[0].([]string); ok {
+			return float64(len(l)), nil
+		}
+		return float64(len([]rune(toString(args[0])))), nil
+	},
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestEval(t *testing.T) {
+	env := &Env{
+		Vars: map[string]interface{}{"depth": 2, "url": "http://example.com/product/1", "tags": []string{"a", "b"}},
+		Funcs: map[string]Func{
+			"double": func(args ...interface{}) (interface{}, error) {
+				return args[0].(float64) * 2, nil
+			},
+		},
+	}
+	cases := []struct {
+		source   string
+		expected interface{}
+	}{
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`-depth + 10 / 4`, 0.5},
+		{`depth < 3 && contains(url, "/product/")`, true},
+		{`depth >= 3 || !starts_with(url, "https")`, true},
+		{`"a" + 'b' + 1`, "ab1"},
+		{`"a\"b"`, `a"b`},
+		{`lower("ABC") == "abc"`, true},
+		{`len(tags) == 2 && len("héllo") == 5`, true},
+		{`number(" 12.5 ") > 12`, true},
+		{`matches(url, "/product/[0-9]+$")`, true},
+		{`replace(trim(" a-b "), "-", "+")`, "a+b"},
+		{`double(depth)`, 4.0},
+		{`nil == nil && "b" > "a"`, true},
+		{`"" || 0`, false},
+		{`upper(string(1.5))`, "1.5"},
+	}
+	for _, c := range cases {
+		p, err := Compile(c.source)
+		if err != nil {
+			t.Errorf("%s: %s", c.source, err)
+			continue
+		}
+		v, err := p.Eval(env)
+		if err != nil || !reflect.DeepEqual(v, c.expected) {
+			t.Errorf("%s: expected %v, got %v (%v)", c.source, c.expected, v, err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, source := range []string{`1 +`, `"abc`, `(1`, `f(1 2)`, `1 $ 2`, `1 2`} {
+		if _, err := Compile(source); err == nil || !strings.HasPrefix(err.Error(), ErrSyntax.Error()) {
+			t.Errorf("%s: unexpected error %v", source, err)
+		}
+	}
+	for _, source := range []string{`missing`, `missing()`, `1 / 0`, `"a" - 1`, `number("x")`, `contains("a")`} {
+		p, err := Compile(source)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+			continue
+		}
+		if _, err := p.Eval(&Env{}); err == nil {
+			t.Errorf("%s: evaluation succeeded", source)
+		}
+	}
+}
+
+func TestCollectorRules(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/product/1" class="p">One</a><a href="/product/2" class="p">Two</a><a href="/about">About</a>`))
+	})
+	mux.HandleFunc("/product/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<div class="product"><h1>Product ` + r.URL.Path[9:] + `</h1><span class="price">$` + r.URL.Path[9:] + `.50</span></div>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	rule, err := NewRule(`starts_with(attr("href"), "/product/") && text != "Two"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := NewExtractor(map[string]string{
+		"title": `child_text("h1")`,
+		"price": `number(replace(child_text(".price"), "$", ""))`,
+		"url":   `url`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []map[string]interface{}
+	c := colly.NewCollector(colly.AllowURLRevisit())
+	c.FollowLinks("a[href]").FollowIf(rule.FollowCondition())
+	c.OnHTML(".product", func(e *colly.HTMLElement) {
+		item, err := x.Extract(e)
+		if err != nil {
+			t.Error(err)
+		}
+		items = append(items, item)
+	})
+	c.Visit(ts.URL + "/")
+	expected := []map[string]interface{}{
+		{"title": "Product 1", "price": 1.5, "url": ts.URL + "/product/1"},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Unexpected items: %v", items)
+	}
+
+	// the rules are changed at runtime
+	if err := rule.Set(`attr("class") == "p" &&`); err == nil {
+		t.Error("Invalid rule was accepted")
+	}
+	rule.Set(`attr("class") == "p" && text == "Two"`)
+	x.Remove("url")
+	items = nil
+	c.Visit(ts.URL + "/")
+	if expected := []map[string]interface{}{{"title": "Product 2", "price": 2.5}}; !reflect.DeepEqual(items, expected) {
+		t.Errorf("Unexpected items after update: %v", items)
+	}
+
+	var matched []string
+	status, _ := NewRule(`status == 200 && contains(content_type, "html") && depth == 1`)
+	c = colly.NewCollector()
+	c.OnResponse(func(r *colly.Response) {
+		if ok, err := status.Match(r); ok && err == nil {
+			matched = append(matched, r.Request.URL.Path)
+		}
+	})
+	c.Visit(ts.URL + "/")
+	sort.Strings(matched)
+	if !reflect.DeepEqual(matched, []string{"/"}) {
+		t.Errorf("Unexpected matched responses: %v", matched)
+	}
+}
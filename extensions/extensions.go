@@ -1,2 +1,7 @@
-// Package extensions implements various helper addons for Colly
+// Package extensions implements various helper addons for Colly.
+//
+// The addons are functions configuring a Collector. They can be
+// registered as plugins too, e.g.
+//
+//	c.Use(colly.PluginFunc(extensions.Referer))
 package extensions
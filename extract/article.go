@@ -0,0 +1,222 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// ArticleData is the content of a news or blog article
+type ArticleData struct {
+	// Title is the headline of the article
+	Title string
+	// Author is the name of the author. Multiple authors are separated
+	// by commas.
+	Author string
+	// Published is the publication date or the zero time if unknown
+	Published time.Time
+	// Description is the summary of the article
+	Description string
+	// Text is the main text of the article. See colly.Response.MainText.
+	Text string
+	// Image is the absolute URL of the top image
+	Image string
+}
+
+// articleTypes are the schema.org types of articles
+var articleTypes = []string{"Article", "NewsArticle", "BlogPosting", "Report", "ScholarlyArticle", "TechArticle", "WebPage"}
+
+var (
+	titleSuffixRe = regexp.MustCompile(`\s+[|\-–—·»]\s+[^|\-–—·»]{2,40}$`)
+	bylinePrefix  = regexp.MustCompile(`(?i)^(by|von|par|por|di)\s+`)
+)
+
+// Article extracts the title, author, publication date, main text and
+// top image of an article page. The metadata of schema.org JSON-LD
+// annotations is preferred over Open Graph and other meta tags, which
+// are preferred over the markup of the page. The main text is detected
+// by colly.Response.MainText.
+func Article(r *colly.Response) (*ArticleData, error) {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	s := doc.Selection
+	a := &ArticleData{Text: r.MainText()}
+	var ld map[string]interface{}
+	for _, o := range jsonLDObjects(s) {
+		for _, t := range articleTypes {
+			if hasJSONLDType(o, t) {
+				ld = o
+				break
+			}
+		}
+		if ld != nil && !hasJSONLDType(ld, "WebPage") {
+			break
+		}
+	}
+	if ld != nil {
+		a.Title = normalizeSpace(jsonLDString(ld["headline"]))
+		a.Author = jsonLDAuthors(ld["author"])
+		a.Description = normalizeSpace(jsonLDString(ld["description"]))
+		if t, err := ParseDate(jsonLDString(ld["datePublished"]), time.UTC); err == nil {
+			a.Published = t
+		}
+		a.Image = jsonLDImage(ld["image"])
+	}
+	if a.Title == "" {
+		a.Title = first(metaContent(s, "og:title", "twitter:title"), normalizeSpace(s.Find("article h1, h1").First().Text()))
+	}
+	if a.Title == "" {
+		a.Title = titleSuffixRe.ReplaceAllString(normalizeSpace(s.Find("title").First().Text()), "")
+	}
+	if a.Author == "" {
+		a.Author = first(metaContent(s, "author", "article:author", "dc.creator", "parsely-author"), byline(s))
+		// article:author is often the URL of the author's profile
+		if strings.HasPrefix(a.Author, "http://") || strings.HasPrefix(a.Author, "https://") {
+			a.Author = byline(s)
+		}
+	}
+	if a.Description == "" {
+		a.Description = metaContent(s, "og:description", "description", "twitter:description")
+	}
+	if a.Published.IsZero() {
+		a.Published = publishedDate(s)
+	}
+	if a.Image == "" {
+		a.Image = first(metaContent(s, "og:image", "og:image:url", "twitter:image"), contentImage(s))
+	}
+	if a.Image != "" {
+		a.Image = r.Request.AbsoluteURL(a.Image)
+	}
+	return a, nil
+}
+
+// metaContent returns the content of the first meta tag having one of
+// the names or properties
+func metaContent(s *goquery.Selection, names ...string) string {
+	for _, name := range names {
+		for _, attr := range []string{"property", "name", "itemprop"} {
+			sel := s.Find("meta[" + attr + "]").FilterFunction(func(_ int, m *goquery.Selection) bool {
+				return strings.EqualFold(m.AttrOr(attr, ""), name)
+			})
+			if v := normalizeSpace(sel.First().AttrOr("content", "")); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// byline returns the author name of the byline markup
+func byline(s *goquery.Selection) string {
+	sel := s.Find(`[itemprop="author"] [itemprop="name"], [itemprop="author"], [rel="author"], .byline, .author, .author-name`).First()
+	name := normalizeSpace(sel.Text())
+	if len(name) > 100 {
+		return ""
+	}
+	return bylinePrefix.ReplaceAllString(name, "")
+}
+
+func publishedDate(s *goquery.Selection) time.Time {
+	candidates := []string{
+		metaContent(s, "article:published_time", "datePublished", "date", "pubdate", "dc.date", "parsely-pub-date"),
+		s.Find(`[itemprop="datePublished"]`).First().AttrOr("datetime", ""),
+		s.Find(`[itemprop="datePublished"]`).First().AttrOr("content", ""),
+		s.Find("article time[datetime], time[pubdate], time[datetime]").First().AttrOr("datetime", ""),
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if t, err := ParseDate(c, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// contentImage returns the first image of the article content which is
+// not an icon or a tracking pixel
+func contentImage(s *goquery.Selection) string {
+	src := ""
+	s.Find("article img[src], main img[src], img[src]").EachWithBreak(func(_ int, img *goquery.Selection) bool {
+		for _, attr := range []string{"width", "height"} {
+			if v, err := strconv.Atoi(img.AttrOr(attr, "")); err == nil && v < 100 {
+				return true
+			}
+		}
+		src = img.AttrOr("src", "")
+		return strings.HasPrefix(src, "data:")
+	})
+	if strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	return src
+}
+
+func jsonLDAuthors(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return normalizeSpace(t)
+	case map[string]interface{}:
+		if name, ok := t["name"].(string); ok {
+			return normalizeSpace(name)
+		}
+	case []interface{}:
+		var names []string
+		for _, i := range t {
+			if name := jsonLDAuthors(i); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+func jsonLDImage(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case map[string]interface{}:
+		if u, ok := t["url"].(string); ok {
+			return strings.TrimSpace(u)
+		}
+		if u, ok := t["contentUrl"].(string); ok {
+			return strings.TrimSpace(u)
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			return jsonLDImage(t[0])
+		}
+	}
+	return ""
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
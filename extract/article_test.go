@@ -0,0 +1,72 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const articleText = `<p>The city council approved the new budget on Monday after a long debate about
+the funding of public transport, schools and the renovation of the old library building.</p>
+<p>Critics say that the plan does not address the rising costs of housing, which has been the
+main concern of residents in the recent surveys conducted by the local newspaper.</p>`
+
+var articleTests = []struct {
+	name string
+	body string
+}{
+	{"JSON-LD", `<html><head><title>Budget approved | Daily News</title>
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "NewsArticle",
+ "headline": "Budget approved", "datePublished": "2023-05-02T10:00:00Z",
+ "author": [{"@type": "Person", "name": "Jane Doe"}, {"@type": "Person", "name": "John Roe"}],
+ "image": {"@type": "ImageObject", "url": "/img/budget.jpg"}}</script>
+</head><body><nav><a href="/">Home</a></nav><article>` + articleText + `</article></body></html>`},
+	{"Meta tags", `<html><head><title>Budget approved - Daily News</title>
+<meta property="og:title" content="Budget approved">
+<meta name="author" content="Jane Doe, John Roe">
+<meta property="article:published_time" content="2023-05-02T10:00:00Z">
+<meta property="og:image" content="https://example.com/img/budget.jpg">
+</head><body><article>` + articleText + `</article></body></html>`},
+	{"Markup", `<html><head><title>Budget approved | Daily News</title></head><body>
+<article><p class="byline">By Jane Doe, John Roe</p><time datetime="2023-05-02T10:00:00Z">May 2</time>
+<img src="/icon.png" width="16" height="16"><img src="/img/budget.jpg">` + articleText + `</article></body></html>`},
+}
+
+func TestArticle(t *testing.T) {
+	published := time.Date(2023, 5, 2, 10, 0, 0, 0, time.UTC)
+	for _, tt := range articleTests {
+		a, err := Article(newTestResponse("https://example.com/news/budget", tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Title != "Budget approved" {
+			t.Errorf("%s: unexpected title %q", tt.name, a.Title)
+		}
+		if a.Author != "Jane Doe, John Roe" {
+			t.Errorf("%s: unexpected author %q", tt.name, a.Author)
+		}
+		if !a.Published.Equal(published) {
+			t.Errorf("%s: unexpected publication date %v", tt.name, a.Published)
+		}
+		if a.Image != "https://example.com/img/budget.jpg" {
+			t.Errorf("%s: unexpected image %q", tt.name, a.Image)
+		}
+		if !strings.HasPrefix(a.Text, "The city council") || strings.Contains(a.Text, "Home") {
+			t.Errorf("%s: unexpected text %q", tt.name, a.Text)
+		}
+	}
+}
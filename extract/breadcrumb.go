@@ -0,0 +1,236 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// breadcrumbSelectors are the commonly used breadcrumb containers
+// which are checked if no schema.org BreadcrumbList is found
+var breadcrumbSelectors = []string{
+	`nav[aria-label*="readcrumb"]`,
+	`.breadcrumb`,
+	`.breadcrumbs`,
+	`#breadcrumb`,
+	`#breadcrumbs`,
+	`[class*="breadcrumb"]`,
+}
+
+// breadcrumbSeparators are trimmed from the plain text items of a trail
+const breadcrumbSeparators = " \t\n>/|»›-"
+
+// Breadcrumb is an item of a breadcrumb trail
+type Breadcrumb struct {
+	// Name is the label of the item
+	Name string
+	// URL is the absolute URL of the item. It can be empty
+	// for the last item which usually represents the current page
+	URL string
+	// Position is the 1-based position of the item in the trail
+	Position int
+}
+
+// Trail is a breadcrumb trail ordered from the root of the site
+// hierarchy to the current page
+type Trail []*Breadcrumb
+
+// Breadcrumbs extracts the breadcrumb trail of a HTML response.
+// schema.org BreadcrumbList annotations (JSON-LD, microdata and RDFa)
+// are preferred over commonly used breadcrumb markup.
+// Breadcrumbs returns nil if the page has no breadcrumbs.
+func Breadcrumbs(r *colly.Response) (Trail, error) {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return BreadcrumbsFromSelection(r.Request, doc.Selection), nil
+}
+
+// BreadcrumbsFromSelection extracts the breadcrumb trail from an already
+// parsed document, e.g. HTMLElement.DOM of an OnHTML("html") callback.
+// Relative URLs are resolved using the request.
+func BreadcrumbsFromSelection(req *colly.Request, s *goquery.Selection) Trail {
+	if t := jsonLDBreadcrumbs(req, s); len(t) > 0 {
+		return t
+	}
+	if t := microdataBreadcrumbs(req, s, "itemtype", "itemprop"); len(t) > 0 {
+		return t
+	}
+	if t := microdataBreadcrumbs(req, s, "typeof", "property"); len(t) > 0 {
+		return t
+	}
+	return markupBreadcrumbs(req, s)
+}
+
+// Depth returns the depth of the current page in the site hierarchy.
+// The root of the hierarchy has depth 0.
+func (t Trail) Depth() int {
+	if len(t) == 0 {
+		return 0
+	}
+	return len(t) - 1
+}
+
+// Parent returns the closest ancestor of the current page
+// or nil if the trail has less than two items
+func (t Trail) Parent() *Breadcrumb {
+	if len(t) < 2 {
+		return nil
+	}
+	return t[len(t)-2]
+}
+
+// Names returns the labels of the trail's items
+func (t Trail) Names() []string {
+	names := make([]string, len(t))
+	for i, b := range t {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// String returns the labels of the trail joined by " > "
+func (t Trail) String() string {
+	return strings.Join(t.Names(), " > ")
+}
+
+func jsonLDBreadcrumbs(req *colly.Request, s *goquery.Selection) Trail {
+	for _, o := range jsonLDObjects(s) {
+		if !hasJSONLDType(o, "BreadcrumbList") {
+			continue
+		}
+		items, _ := o["itemListElement"].([]interface{})
+		var t Trail
+		for i, v := range items {
+			item, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			b := &Breadcrumb{
+				Name:     normalizeSpace(jsonLDString(item["name"])),
+				URL:      jsonLDString(item["item"]),
+				Position: i + 1,
+			}
+			if nested, ok := item["item"].(map[string]interface{}); ok && b.Name == "" {
+				if name, ok := nested["name"].(string); ok {
+					b.Name = normalizeSpace(name)
+				}
+			}
+			switch p := item["position"].(type) {
+			case float64:
+				b.Position = int(p)
+			case string:
+				if n, err := strconv.Atoi(p); err == nil {
+					b.Position = n
+				}
+			}
+			if b.URL != "" && req != nil {
+				b.URL = req.AbsoluteURL(b.URL)
+			}
+			t = append(t, b)
+		}
+		if len(t) > 0 {
+			sort.SliceStable(t, func(i, j int) bool { return t[i].Position < t[j].Position })
+			return t
+		}
+	}
+	return nil
+}
+
+// microdataBreadcrumbs handles both microdata (itemtype/itemprop)
+// and RDFa (typeof/property) annotations
+func microdataBreadcrumbs(req *colly.Request, s *goquery.Selection, typeAttr, propAttr string) Trail {
+	list := s.Find("[" + typeAttr + `$="BreadcrumbList"]`).First()
+	if list.Length() == 0 {
+		return nil
+	}
+	var t Trail
+	list.Find("[" + propAttr + `="itemListElement"]`).Each(func(i int, item *goquery.Selection) {
+		b := &Breadcrumb{Position: i + 1}
+		name := item.Find("[" + propAttr + `="name"]`).First()
+		if v, ok := name.Attr("content"); ok {
+			b.Name = normalizeSpace(v)
+		} else {
+			b.Name = normalizeSpace(name.Text())
+		}
+		link := item.Find("[" + propAttr + `="item"]`).First()
+		for _, attr := range []string{"href", "resource", "itemid", "content"} {
+			if v, ok := link.Attr(attr); ok && v != "" {
+				b.URL = v
+				break
+			}
+		}
+		if b.Name == "" {
+			b.Name = normalizeSpace(link.Text())
+		}
+		if p, ok := item.Find("[" + propAttr + `="position"]`).Attr("content"); ok {
+			if n, err := strconv.Atoi(p); err == nil {
+				b.Position = n
+			}
+		}
+		if b.URL != "" && req != nil {
+			b.URL = req.AbsoluteURL(b.URL)
+		}
+		t = append(t, b)
+	})
+	sort.SliceStable(t, func(i, j int) bool { return t[i].Position < t[j].Position })
+	return t
+}
+
+func markupBreadcrumbs(req *colly.Request, s *goquery.Selection) Trail {
+	for _, sel := range breadcrumbSelectors {
+		container := s.Find(sel).First()
+		if container.Length() == 0 {
+			continue
+		}
+		items := container.Find("li")
+		if items.Length() == 0 {
+			items = container.Find("a")
+		}
+		var t Trail
+		items.Each(func(_ int, item *goquery.Selection) {
+			name := normalizeSpace(item.Text())
+			if name == "" {
+				return
+			}
+			b := &Breadcrumb{Name: name, Position: len(t) + 1}
+			href, ok := item.Attr("href")
+			if !ok {
+				href, _ = item.Find("a[href]").First().Attr("href")
+			}
+			if href != "" && req != nil {
+				b.URL = req.AbsoluteURL(href)
+			}
+			t = append(t, b)
+		})
+		// the current page is usually a plain text after the last link
+		if items.Is("a") && !container.Contents().Last().Is("a") {
+			last := normalizeSpace(strings.TrimLeft(container.Contents().Last().Text(), breadcrumbSeparators))
+			if last != "" && (len(t) == 0 || t[len(t)-1].Name != last) {
+				t = append(t, &Breadcrumb{Name: last, Position: len(t) + 1})
+			}
+		}
+		if len(t) > 0 {
+			return t
+		}
+	}
+	return nil
+}
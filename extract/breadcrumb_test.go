@@ -0,0 +1,89 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newTestResponse(u, body string) *colly.Response {
+	parsed, _ := url.Parse(u)
+	return &colly.Response{
+		StatusCode: 200,
+		Body:       []byte(body),
+		Headers:    &http.Header{"Content-Type": []string{"text/html"}},
+		Request:    &colly.Request{URL: parsed},
+	}
+}
+
+var breadcrumbTests = map[string]string{
+	"JSON-LD": `<html><head><script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [{"@type": "WebPage"}, {
+  "@type": "BreadcrumbList",
+  "itemListElement": [
+    {"@type": "ListItem", "position": 2, "name": "Shoes", "item": "/shoes"},
+    {"@type": "ListItem", "position": 1, "name": "Home", "item": "https://example.com/"},
+    {"@type": "ListItem", "position": 3, "name": "Red shoe"}
+  ]}]}
+</script></head><body></body></html>`,
+	"Microdata": `<html><body><ol itemscope itemtype="https://schema.org/BreadcrumbList">
+<li itemprop="itemListElement" itemscope itemtype="https://schema.org/ListItem">
+  <a itemprop="item" href="/"><span itemprop="name">Home</span></a><meta itemprop="position" content="1" />
+</li>
+<li itemprop="itemListElement" itemscope itemtype="https://schema.org/ListItem">
+  <a itemprop="item" href="/shoes"><span itemprop="name">Shoes</span></a><meta itemprop="position" content="2" />
+</li>
+<li itemprop="itemListElement" itemscope itemtype="https://schema.org/ListItem">
+  <span itemprop="name">Red   shoe</span><meta itemprop="position" content="3" />
+</li></ol></body></html>`,
+	"Markup": `<html><body><div class="breadcrumbs">
+<a href="/">Home</a> &gt; <a href="shoes">Shoes</a> &gt; Red shoe
+</div></body></html>`,
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	want := Trail{
+		{Name: "Home", URL: "https://example.com/", Position: 1},
+		{Name: "Shoes", URL: "https://example.com/shoes", Position: 2},
+		{Name: "Red shoe", Position: 3},
+	}
+	for name, body := range breadcrumbTests {
+		trail, err := Breadcrumbs(newTestResponse("https://example.com/red-shoe", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(trail, want) {
+			t.Errorf("%s: invalid trail %q", name, trail)
+		}
+		if trail.Depth() != 2 || trail.Parent() == nil || trail.Parent().Name != "Shoes" {
+			t.Errorf("%s: invalid hierarchy position %d", name, trail.Depth())
+		}
+	}
+}
+
+func TestBreadcrumbsMissing(t *testing.T) {
+	trail, err := Breadcrumbs(newTestResponse("https://example.com/", "<html><body><a href='/'>x</a></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trail != nil || trail.Depth() != 0 || trail.Parent() != nil {
+		t.Errorf("Unexpected trail %q", trail)
+	}
+}
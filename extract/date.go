@@ -0,0 +1,156 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownDateFormat is the error returned if a text can not be parsed
+// with any of the DateLayouts
+var ErrUnknownDateFormat = errors.New("Unknown date format")
+
+// DateLayouts is the list of time layouts tried by ParseDate in order.
+// Day-first numeric layouts are tried before month-first ones, so
+// "02/01/2006" is parsed as 2 January. Append or prepend layouts to
+// adjust the behavior.
+var DateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.ANSIC,
+	time.UnixDate,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Monday, January 2, 2006",
+	"Monday, 2 January 2006",
+	"January 2, 2006 15:04",
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006 15:04",
+	"2 January 2006",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006",
+	"January 2006",
+	"Jan 2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	"2.1.2006",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"01/02/2006 3:04 PM",
+	"01/02/2006",
+	"02-01-2006",
+	"20060102",
+}
+
+var (
+	ordinalSuffixRe = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)\b`)
+	relativeDateRe  = regexp.MustCompile(`^(an?|\d+)\s+(second|minute|hour|day|week|month|year)s?\s+ago$`)
+	dateSpaceRe     = regexp.MustCompile(`\s+`)
+)
+
+// ParseDate parses a date from a text using DateLayouts. Dates without
+// time zone information are interpreted in loc, use time.UTC if the
+// location of the site is unknown. Ordinal day suffixes ("1st", "22nd")
+// and relative dates ("today", "yesterday", "3 days ago") are supported,
+// relative dates are calculated from the current time.
+func ParseDate(text string, loc *time.Location) (time.Time, error) {
+	return parseDate(text, loc, time.Now())
+}
+
+func parseDate(text string, loc *time.Location, now time.Time) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	text = strings.TrimSpace(dateSpaceRe.ReplaceAllString(text, " "))
+	text = ordinalSuffixRe.ReplaceAllString(text, "$1")
+	text = strings.TrimSuffix(text, ".")
+
+	if t, ok := parseRelativeDate(strings.ToLower(text), now.In(loc)); ok {
+		return t, nil
+	}
+	for _, layout := range DateLayouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, nil
+		}
+	}
+	if ts, err := strconv.ParseInt(text, 10, 64); err == nil && len(text) >= 9 && len(text) <= 13 {
+		if len(text) > 10 {
+			return time.Unix(0, ts*int64(time.Millisecond)).In(loc), nil
+		}
+		return time.Unix(ts, 0).In(loc), nil
+	}
+	return time.Time{}, ErrUnknownDateFormat
+}
+
+func parseRelativeDate(text string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch text {
+	case "now", "just now":
+		return now, true
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	}
+	m := relativeDateRe.FindStringSubmatch(text)
+	if m == nil {
+		return time.Time{}, false
+	}
+	n := 1
+	if m[1] != "a" && m[1] != "an" {
+		n, _ = strconv.Atoi(m[1])
+	}
+	switch m[2] {
+	case "second":
+		return now.Add(-time.Duration(n) * time.Second), true
+	case "minute":
+		return now.Add(-time.Duration(n) * time.Minute), true
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "day":
+		return now.AddDate(0, 0, -n), true
+	case "week":
+		return now.AddDate(0, 0, -7*n), true
+	case "month":
+		return now.AddDate(0, -n, 0), true
+	}
+	return now.AddDate(-n, 0, 0), true
+}
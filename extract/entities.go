@@ -0,0 +1,241 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// Entities contains the contact information found on a page
+type Entities struct {
+	// Emails are the lowercase email addresses
+	Emails []string
+	// Phones are the valid phone numbers in E.164 format
+	Phones []string
+	// Addresses are the postal addresses
+	Addresses []*Address
+}
+
+// Address is a postal address
+type Address struct {
+	Street     string
+	Locality   string
+	Region     string
+	PostalCode string
+	Country    string
+	// Text is the address as a single line
+	Text string
+}
+
+var (
+	emailRe = regexp.MustCompile(`(?i)[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}`)
+	// emailObfuscationRe matches the commonly used "name [at] example [dot] com"
+	// spam protection
+	emailObfuscationRe = regexp.MustCompile(`(?i)\s*[\[({]\s*(at|dot)\s*[\])}]\s*`)
+)
+
+// ExtractEntities extracts the emails, phone numbers and postal addresses
+// of a HTML response. Phone numbers without international prefix are
+// validated using the numbering plan of defaultRegion (e.g. "US").
+func ExtractEntities(r *colly.Response, defaultRegion string) (*Entities, error) {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return EntitiesFromSelection(doc.Selection, defaultRegion), nil
+}
+
+// EntitiesFromSelection extracts the entities of a page or element,
+// e.g. HTMLElement.DOM of an OnHTML callback
+func EntitiesFromSelection(s *goquery.Selection, defaultRegion string) *Entities {
+	e := &Entities{}
+	emails := map[string]bool{}
+	addEmail := func(email string) {
+		email = strings.ToLower(strings.Trim(email, " ."))
+		if emailRe.MatchString(email) && !emails[email] {
+			emails[email] = true
+			e.Emails = append(e.Emails, email)
+		}
+	}
+	phones := map[string]bool{}
+	addPhone := func(phone string) {
+		if !phones[phone] {
+			phones[phone] = true
+			e.Phones = append(e.Phones, phone)
+		}
+	}
+
+	s.Find(`a[href^="mailto:"]`).Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		addr := strings.TrimPrefix(href, "mailto:")
+		if i := strings.IndexByte(addr, '?'); i >= 0 {
+			addr = addr[:i]
+		}
+		if u, err := url.PathUnescape(addr); err == nil {
+			addr = u
+		}
+		for _, a := range strings.Split(addr, ",") {
+			addEmail(a)
+		}
+	})
+	s.Find(`a[href^="tel:"]`).Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		if n, err := NormalizePhone(href, defaultRegion); err == nil {
+			addPhone(n)
+		}
+	})
+
+	text := textWithSpaces(s)
+	for _, m := range emailRe.FindAllString(Deobfuscate(text), -1) {
+		addEmail(m)
+	}
+	for _, n := range Phones(text, defaultRegion) {
+		addPhone(n)
+	}
+
+	e.Addresses = addresses(s)
+	return e
+}
+
+// Emails returns the email addresses of a text. Obfuscated addresses like
+// "john [at] example [dot] com" are recognized too.
+func Emails(text string) []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, m := range emailRe.FindAllString(Deobfuscate(text), -1) {
+		m = strings.ToLower(strings.Trim(m, "."))
+		if !seen[m] {
+			seen[m] = true
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// Deobfuscate replaces the "[at]" and "[dot]" placeholders of
+// obfuscated email addresses
+func Deobfuscate(text string) string {
+	return emailObfuscationRe.ReplaceAllStringFunc(text, func(m string) string {
+		if strings.Contains(strings.ToLower(m), "at") {
+			return "@"
+		}
+		return "."
+	})
+}
+
+// String returns the address as a single line
+func (a *Address) String() string {
+	if a.Text != "" {
+		return a.Text
+	}
+	var parts []string
+	for _, p := range []string{a.Street, a.Locality, strings.TrimSpace(a.Region + " " + a.PostalCode), a.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addresses collects schema.org PostalAddress annotations (JSON-LD,
+// microdata and RDFa) and falls back to <address> elements
+func addresses(s *goquery.Selection) []*Address {
+	var res []*Address
+	for _, o := range jsonLDObjects(s) {
+		if hasJSONLDType(o, "PostalAddress") {
+			res = append(res, jsonLDAddress(o))
+			continue
+		}
+		if a, ok := o["address"].(map[string]interface{}); ok {
+			res = append(res, jsonLDAddress(a))
+		}
+	}
+	for _, attrs := range [][2]string{{"itemtype", "itemprop"}, {"typeof", "property"}} {
+		s.Find("[" + attrs[0] + `$="PostalAddress"]`).Each(func(_ int, el *goquery.Selection) {
+			prop := func(name string) string {
+				p := el.Find("[" + attrs[1] + `="` + name + `"]`).First()
+				if v, ok := p.Attr("content"); ok {
+					return normalizeSpace(v)
+				}
+				return normalizeSpace(p.Text())
+			}
+			a := &Address{
+				Street:     prop("streetAddress"),
+				Locality:   prop("addressLocality"),
+				Region:     prop("addressRegion"),
+				PostalCode: prop("postalCode"),
+				Country:    prop("addressCountry"),
+			}
+			a.Text = a.String()
+			res = append(res, a)
+		})
+	}
+	if len(res) > 0 {
+		return res
+	}
+	s.Find("address").Each(func(_ int, el *goquery.Selection) {
+		lines := strings.Split(textWithSpaces(el), "\n")
+		var parts []string
+		for _, l := range lines {
+			l = normalizeSpace(l)
+			// contact lines are not part of the postal address
+			if l == "" || emailRe.MatchString(l) || len(phoneCandidateRe.ReplaceAllString(l, "")) < 12 && phoneCandidateRe.MatchString(l) {
+				continue
+			}
+			parts = append(parts, l)
+		}
+		if len(parts) > 0 {
+			res = append(res, &Address{Text: strings.Join(parts, ", ")})
+		}
+	})
+	return res
+}
+
+func jsonLDAddress(o map[string]interface{}) *Address {
+	a := &Address{
+		Street:     normalizeSpace(jsonLDString(o["streetAddress"])),
+		Locality:   normalizeSpace(jsonLDString(o["addressLocality"])),
+		Region:     normalizeSpace(jsonLDString(o["addressRegion"])),
+		PostalCode: normalizeSpace(jsonLDString(o["postalCode"])),
+		Country:    normalizeSpace(jsonLDString(o["addressCountry"])),
+	}
+	a.Text = a.String()
+	return a
+}
+
+// textWithSpaces returns the text of the selection keeping the line breaks
+// of block elements, so the texts of adjacent elements are not merged
+func textWithSpaces(s *goquery.Selection) string {
+	var b strings.Builder
+	s.Contents().Each(func(_ int, n *goquery.Selection) {
+		switch goquery.NodeName(n) {
+		case "#text":
+			b.WriteString(n.Text())
+			return
+		case "script", "style", "#comment":
+			return
+		case "br", "p", "div", "li", "tr", "td", "h1", "h2", "h3", "h4", "h5", "h6", "address":
+			b.WriteString("\n")
+		}
+		b.WriteString(textWithSpaces(n))
+		b.WriteString(" ")
+	})
+	return b.String()
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	for _, c := range []struct {
+		number, region, want string
+	}{
+		{"(415) 555-2671", "US", "+14155552671"},
+		{"1-415-555-2671", "US", "+14155552671"},
+		{"tel:+44 20 7946 0958", "US", "+442079460958"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"0049 30 1234567", "US", "+49301234567"},
+		{"06 1 234 5678", "HU", "+3612345678"},
+		{"(015) 555-2671", "US", ""},
+		{"12345", "US", ""},
+		{"+999 1234 5678", "US", ""},
+	} {
+		got, err := NormalizePhone(c.number, c.region)
+		if got != c.want || (c.want == "") != (err == ErrInvalidPhoneNumber) {
+			t.Errorf("NormalizePhone(%q, %q) = %q, %v, want %q", c.number, c.region, got, err, c.want)
+		}
+	}
+}
+
+func TestEntities(t *testing.T) {
+	r := newTestResponse("http://example.com/contact", `<html><head>
+<script type="application/ld+json">{"@type": "Organization", "address": {"@type": "PostalAddress",
+ "streetAddress": "1600 Amphitheatre Pkwy", "addressLocality": "Mountain View", "addressRegion": "CA",
+ "postalCode": "94043", "addressCountry": "US"}}</script>
+</head><body>
+<a href="mailto:Sales@Example.com?subject=Hi">Sales</a>
+<a href="tel:+1-415-555-2671">Call us</a>
+<p>Support: support [at] example [dot] com</p>
+<p>Fax: (650) 253-0001</p>
+<p>Founded 2020-06-09</p>
+</body></html>`)
+	e, err := ExtractEntities(r, "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sales@example.com", "support@example.com"}; !reflect.DeepEqual(e.Emails, want) {
+		t.Errorf("Emails = %v, want %v", e.Emails, want)
+	}
+	if want := []string{"+14155552671", "+16502530001"}; !reflect.DeepEqual(e.Phones, want) {
+		t.Errorf("Phones = %v, want %v", e.Phones, want)
+	}
+	if len(e.Addresses) != 1 || e.Addresses[0].String() != "1600 Amphitheatre Pkwy, Mountain View, CA 94043, US" {
+		t.Errorf("Addresses = %v", e.Addresses)
+	}
+}
+
+func TestAddressElement(t *testing.T) {
+	r := newTestResponse("http://example.com/", `<address>ACME Ltd.<br>
+10 Downing Street<br>London SW1A 2AA<br>Tel: 020 7946 0958<br>info@acme.example</address>`)
+	e, err := ExtractEntities(r, "GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Addresses) != 1 || e.Addresses[0].Text != "ACME Ltd., 10 Downing Street, London SW1A 2AA" {
+		t.Errorf("Addresses = %v", e.Addresses)
+	}
+	if want := []string{"+442079460958"}; !reflect.DeepEqual(e.Phones, want) {
+		t.Errorf("Phones = %v, want %v", e.Phones, want)
+	}
+}
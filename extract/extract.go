@@ -0,0 +1,94 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package extract implements helpers to extract commonly needed
+// structured data from responses
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+func parseDocument(r *colly.Response) (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+}
+
+// jsonLDObjects returns every JSON-LD object of the document including
+// the nested members of "@graph" lists
+func jsonLDObjects(doc *goquery.Selection) []map[string]interface{} {
+	var objects []map[string]interface{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case []interface{}:
+			for _, i := range t {
+				walk(i)
+			}
+		case map[string]interface{}:
+			objects = append(objects, t)
+			if g, ok := t["@graph"]; ok {
+				walk(g)
+			}
+		}
+	}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &v); err == nil {
+			walk(v)
+		}
+	})
+	return objects
+}
+
+// hasJSONLDType checks the "@type" member of a JSON-LD object
+func hasJSONLDType(o map[string]interface{}, typ string) bool {
+	switch t := o["@type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, i := range t {
+			if s, ok := i.(string); ok && s == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonLDString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case map[string]interface{}:
+		for _, k := range []string{"@id", "url", "name"} {
+			if s, ok := t[k].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			return jsonLDString(t[0])
+		}
+	}
+	return ""
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
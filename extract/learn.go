@@ -0,0 +1,347 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// Rule locates a value in a HTML document
+type Rule struct {
+	// Selector is the CSS selector of the element of the value
+	Selector string
+	// Attr is the attribute of the value. The text of the element is
+	// the value if it is empty.
+	Attr string
+}
+
+func (r Rule) String() string {
+	if r.Attr == "" {
+		return r.Selector
+	}
+	return r.Selector + "@" + r.Attr
+}
+
+// extract returns the value of the first element matched by the rule
+func (r Rule) extract(doc *goquery.Selection) (string, bool) {
+	s := doc.Find(r.Selector).First()
+	if s.Length() == 0 {
+		return "", false
+	}
+	if r.Attr != "" {
+		v, ok := s.Attr(r.Attr)
+		return normalizeSpace(v), ok && strings.TrimSpace(v) != ""
+	}
+	v := normalizeSpace(s.Text())
+	return v, v != ""
+}
+
+// Drift reports a field whose primary rule stopped matching and whose
+// value was extracted by a learned rule
+type Drift struct {
+	// Field is the name of the field
+	Field string
+	// URL is the URL of the page
+	URL string
+	// Primary is the rule which did not match
+	Primary Rule
+	// Fallback is the learned rule which extracted the value
+	Fallback Rule
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %q did not match on %s, used %q", d.Field, d.Primary, d.URL, d.Fallback)
+}
+
+// SelectorLearner extracts fields by their primary rules and falls back
+// to rules learned from labeled examples if a primary rule stops
+// matching, e.g. after a redesign of the site. The learned rules are
+// the CSS selectors which extract the labeled values from all the
+// examples.
+type SelectorLearner struct {
+	// Primary contains the primary rules of the fields by field name
+	Primary map[string]Rule
+	// OnDrift is called if a field is extracted by a learned rule
+	OnDrift  func(d Drift)
+	examples []*learnExample
+	learned  map[string][]Rule
+	lock     sync.RWMutex
+}
+
+type learnExample struct {
+	doc    *goquery.Selection
+	values map[string]string
+}
+
+// learnAttrs are the attributes searched for the labeled values which
+// are not the text of an element
+var learnAttrs = []string{"content", "value", "href", "src", "title", "alt", "datetime"}
+
+// cssIdent matches the names usable in CSS selectors without escaping
+var cssIdent = regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*$`)
+
+// AddExample adds a labeled example page, whose values are the expected
+// values of the fields, and learns the rules again
+func (l *SelectorLearner) AddExample(r *colly.Response, values map[string]string) error {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return err
+	}
+	normalized := make(map[string]string, len(values))
+	for k, v := range values {
+		normalized[k] = normalizeSpace(v)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.examples = append(l.examples, &learnExample{doc: doc.Selection, values: normalized})
+	l.learn()
+	return nil
+}
+
+// Example is a labeled example page
+type Example struct {
+	// URL is the address of the page
+	URL string
+	// Values are the expected values of the fields by field name
+	Values map[string]string
+}
+
+// Learn fetches the example pages by a clone of the Collector and adds
+// them by AddExample
+func (l *SelectorLearner) Learn(c *colly.Collector, examples ...Example) error {
+	lc := c.Clone()
+	lc.Async = false
+	lc.AllowURLRevisit = true
+	var err error
+	var values map[string]string
+	lc.OnResponse(func(r *colly.Response) {
+		err = l.AddExample(r, values)
+	})
+	for _, e := range examples {
+		values = e.Values
+		if verr := lc.Visit(e.URL); verr != nil {
+			return verr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Learned returns the learned rules of a field in the order of
+// preference
+func (l *SelectorLearner) Learned(field string) []Rule {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return append([]Rule(nil), l.learned[field]...)
+}
+
+// Extract returns the values of the fields of a page. The fields whose
+// primary rule and learned rules match nothing are missing from the
+// result.
+func (l *SelectorLearner) Extract(r *colly.Response) (map[string]string, error) {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	l.lock.RLock()
+	fields := make(map[string]bool)
+	for f := range l.Primary {
+		fields[f] = true
+	}
+	for f := range l.learned {
+		fields[f] = true
+	}
+	learned := l.learned
+	l.lock.RUnlock()
+	values := make(map[string]string)
+	for f := range fields {
+		primary, hasPrimary := l.Primary[f]
+		if hasPrimary {
+			if v, ok := primary.extract(doc.Selection); ok {
+				values[f] = v
+				continue
+			}
+		}
+		for _, rule := range learned[f] {
+			if rule == primary {
+				continue
+			}
+			if v, ok := rule.extract(doc.Selection); ok {
+				values[f] = v
+				if hasPrimary && l.OnDrift != nil {
+					l.OnDrift(Drift{Field: f, URL: r.Request.URL.String(), Primary: primary, Fallback: rule})
+				}
+				break
+			}
+		}
+	}
+	return values, nil
+}
+
+// learn ranks the candidate rules of the fields by the number of the
+// examples they extract correctly. Only the rules extracting the most
+// examples are kept. It must be called holding the lock.
+func (l *SelectorLearner) learn() {
+	l.learned = make(map[string][]Rule)
+	fields := make(map[string]bool)
+	for _, e := range l.examples {
+		for f := range e.values {
+			fields[f] = true
+		}
+	}
+	for f := range fields {
+		var candidates []Rule
+		seen := make(map[Rule]bool)
+		for _, e := range l.examples {
+			value, ok := e.values[f]
+			if !ok {
+				continue
+			}
+			for _, r := range candidateRules(e.doc, value) {
+				if !seen[r] {
+					seen[r] = true
+					candidates = append(candidates, r)
+				}
+			}
+		}
+		scores := make(map[Rule]int)
+		best := 0
+		for _, r := range candidates {
+			for _, e := range l.examples {
+				value, ok := e.values[f]
+				if !ok {
+					continue
+				}
+				if v, _ := r.extract(e.doc); v == value {
+					scores[r]++
+				}
+			}
+			if scores[r] > best {
+				best = scores[r]
+			}
+		}
+		var rules []Rule
+		for _, r := range candidates {
+			if best > 0 && scores[r] == best {
+				rules = append(rules, r)
+			}
+		}
+		// the candidates are generated from the most to the least
+		// stable selectors, so their order is kept among equal scores
+		sort.SliceStable(rules, func(i, j int) bool {
+			return scores[rules[i]] > scores[rules[j]]
+		})
+		l.learned[f] = rules
+	}
+}
+
+// candidateRules returns the rules of the elements of the document
+// containing the value in the order of their expected stability
+func candidateRules(doc *goquery.Selection, value string) []Rule {
+	var rules []Rule
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		n := s.Get(0)
+		if normalizeSpace(s.Text()) == value && !childHasText(s, value) {
+			rules = append(rules, nodeRules(n, "")...)
+		}
+		for _, a := range learnAttrs {
+			if v, ok := s.Attr(a); ok && normalizeSpace(v) == value {
+				rules = append(rules, nodeRules(n, a)...)
+			}
+		}
+	})
+	return rules
+}
+
+// childHasText returns true if a child element has the same text, so
+// the innermost element is used
+func childHasText(s *goquery.Selection, value string) bool {
+	found := false
+	s.Children().EachWithBreak(func(_ int, c *goquery.Selection) bool {
+		found = normalizeSpace(c.Text()) == value
+		return !found
+	})
+	return found
+}
+
+// nodeRules returns the selectors of an element: by ID, by microdata
+// property, by classes and by position under its parent
+func nodeRules(n *html.Node, attr string) []Rule {
+	var rules []Rule
+	add := func(sel string) {
+		rules = append(rules, Rule{Selector: sel, Attr: attr})
+	}
+	if id := nodeAttr(n, "id"); cssIdent.MatchString(id) {
+		add("#" + id)
+	}
+	if prop := nodeAttr(n, "itemprop"); prop != "" && !strings.ContainsAny(prop, `"\`) {
+		add(fmt.Sprintf(`[itemprop="%s"]`, prop))
+		add(fmt.Sprintf(`%s[itemprop="%s"]`, n.Data, prop))
+	}
+	if classes := classSelector(n); classes != "" {
+		add(n.Data + classes)
+		if p := n.Parent; p != nil && p.Type == html.ElementNode {
+			if pc := classSelector(p); pc != "" {
+				add(p.Data + pc + " " + n.Data + classes)
+			}
+		}
+	}
+	if p := n.Parent; p != nil && p.Type == html.ElementNode && p.Data != "html" {
+		k := 1
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode && s.Data == n.Data {
+				k++
+			}
+		}
+		parent := p.Data
+		if id := nodeAttr(p, "id"); cssIdent.MatchString(id) {
+			parent = "#" + id
+		} else if pc := classSelector(p); pc != "" {
+			parent += pc
+		}
+		add(fmt.Sprintf("%s > %s:nth-of-type(%d)", parent, n.Data, k))
+	}
+	return rules
+}
+
+// classSelector returns the classes of an element in CSS notation
+func classSelector(n *html.Node) string {
+	var b strings.Builder
+	for _, c := range strings.Fields(nodeAttr(n, "class")) {
+		if cssIdent.MatchString(c) {
+			b.WriteString("." + c)
+		}
+	}
+	return b.String()
+}
+
+func nodeAttr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
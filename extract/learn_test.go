@@ -0,0 +1,94 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+var learnPages = map[string]string{
+	"/p/1": `<div class="product"><h1 class="name">Red Shoe</h1>
+<span class="price" itemprop="price">10.00</span><meta itemprop="sku" content="RS-1"></div>`,
+	"/p/2": `<div class="product"><h1 class="name">Blue Hat</h1>
+<span class="price" itemprop="price">12.50</span><meta itemprop="sku" content="BH-2"></div>`,
+	// redesigned page
+	"/p/3": `<section class="item"><h2 class="title">Green Bag</h2>
+<b class="amount" itemprop="price">30.00</b><meta itemprop="sku" content="GB-3"></section>`,
+}
+
+func TestSelectorLearner(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(learnPages[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	var drifts []Drift
+	l := &SelectorLearner{
+		Primary: map[string]Rule{
+			"name":  {Selector: "h1.name"},
+			"price": {Selector: "span.price"},
+		},
+		OnDrift: func(d Drift) {
+			drifts = append(drifts, d)
+		},
+	}
+	c := colly.NewCollector()
+	err := l.Learn(c,
+		Example{URL: ts.URL + "/p/1", Values: map[string]string{"price": "10.00", "sku": "RS-1"}},
+		Example{URL: ts.URL + "/p/2", Values: map[string]string{"price": "12.50", "sku": "BH-2"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := l.Learned("price"); len(rules) == 0 || rules[0] != (Rule{Selector: `[itemprop="price"]`}) {
+		t.Errorf("Unexpected price rules: %v", rules)
+	}
+	if rules := l.Learned("sku"); len(rules) == 0 || rules[0] != (Rule{Selector: `[itemprop="sku"]`, Attr: "content"}) {
+		t.Errorf("Unexpected sku rules: %v", rules)
+	}
+
+	var values []map[string]string
+	c.OnResponse(func(r *colly.Response) {
+		v, err := l.Extract(r)
+		if err != nil {
+			t.Error(err)
+		}
+		values = append(values, v)
+	})
+	c.Visit(ts.URL + "/p/1")
+	c.Visit(ts.URL + "/p/3")
+	expected := []map[string]string{
+		{"name": "Red Shoe", "price": "10.00", "sku": "RS-1"},
+		{"price": "30.00", "sku": "GB-3"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values: %v", values)
+	}
+	expectedDrift := []Drift{{
+		Field:    "price",
+		URL:      ts.URL + "/p/3",
+		Primary:  Rule{Selector: "span.price"},
+		Fallback: Rule{Selector: `[itemprop="price"]`},
+	}}
+	if !reflect.DeepEqual(drifts, expectedDrift) {
+		t.Errorf("Unexpected drifts: %v", drifts)
+	}
+}
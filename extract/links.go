@@ -0,0 +1,252 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+// LinkKind is the class of an outgoing link
+type LinkKind string
+
+const (
+	// InternalLink points to a page of the same site (registrable
+	// domain) including its subdomains
+	InternalLink LinkKind = "internal"
+	// ExternalLink points to a page of another site
+	ExternalLink LinkKind = "external"
+	// SocialLink points to a social network profile or page
+	SocialLink LinkKind = "social"
+	// DocumentLink points to a downloadable document, e.g. a PDF file
+	DocumentLink LinkKind = "document"
+	// AssetLink points to an image, stylesheet, script, font or media file
+	AssetLink LinkKind = "asset"
+	// EmailLink is a mailto: link
+	EmailLink LinkKind = "email"
+	// PhoneLink is a tel: link
+	PhoneLink LinkKind = "phone"
+)
+
+// Link is a classified link of a page
+type Link struct {
+	// URL is the absolute URL of the link
+	URL string
+	// Kind is the class of the link
+	Kind LinkKind
+	// Text is the anchor text or the alt text of images
+	Text string
+	// Element is the name of the HTML element of the link
+	Element string
+	// Rel contains the lowercase values of the rel attribute
+	Rel []string
+	// NoFollow is true if the rel attribute contains "nofollow",
+	// "ugc" or "sponsored"
+	NoFollow bool
+	// Network is the name of the social network of social links
+	Network string
+	// Target is the email address or the phone number of email and
+	// phone links
+	Target string
+}
+
+// SocialNetworks maps the domains of social networks to their names.
+// Subdomains of the domains are matched too.
+var SocialNetworks = map[string]string{
+	"facebook.com":    "facebook",
+	"fb.com":          "facebook",
+	"twitter.com":     "twitter",
+	"x.com":           "twitter",
+	"instagram.com":   "instagram",
+	"linkedin.com":    "linkedin",
+	"youtube.com":     "youtube",
+	"youtu.be":        "youtube",
+	"tiktok.com":      "tiktok",
+	"pinterest.com":   "pinterest",
+	"github.com":      "github",
+	"reddit.com":      "reddit",
+	"t.me":            "telegram",
+	"wa.me":           "whatsapp",
+	"medium.com":      "medium",
+	"threads.net":     "threads",
+	"mastodon.social": "mastodon",
+	"vimeo.com":       "vimeo",
+	"tumblr.com":      "tumblr",
+	"xing.com":        "xing",
+}
+
+// DocumentExtensions are the file extensions of document links
+var DocumentExtensions = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
+	".ppt": true, ".pptx": true, ".odt": true, ".ods": true, ".odp": true,
+	".rtf": true, ".csv": true, ".epub": true, ".zip": true,
+}
+
+// AssetExtensions are the file extensions of asset links
+var AssetExtensions = map[string]bool{
+	".css": true, ".js": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".svg": true, ".webp": true, ".avif": true, ".ico": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".mp3": true,
+	".mp4": true, ".webm": true, ".ogg": true,
+}
+
+// linkSelector selects the elements having links
+const linkSelector = "a[href], area[href], link[href], img[src], script[src], source[src], video[src], audio[src]"
+
+// assetRels are the rel values of link elements loading assets. Other
+// link elements, e.g. canonical and alternate links, point to pages.
+var assetRels = map[string]bool{
+	"stylesheet": true, "icon": true, "apple-touch-icon": true,
+	"preload": true, "prefetch": true, "modulepreload": true, "manifest": true,
+}
+
+// ExtractLinks extracts and classifies the links of a HTML response.
+// Every URL is returned once with the first element linking it.
+func ExtractLinks(r *colly.Response) ([]*Link, error) {
+	doc, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return LinksFromSelection(r.Request, doc.Selection), nil
+}
+
+// LinksFromSelection extracts and classifies the links of an already
+// parsed document. Relative URLs are resolved using the request.
+func LinksFromSelection(req *colly.Request, s *goquery.Selection) []*Link {
+	var links []*Link
+	seen := make(map[string]bool)
+	s.Find(linkSelector).Each(func(_ int, e *goquery.Selection) {
+		element := goquery.NodeName(e)
+		href, ok := e.Attr("href")
+		if !ok {
+			href, _ = e.Attr("src")
+		}
+		href = strings.TrimSpace(href)
+		rel := strings.Fields(strings.ToLower(e.AttrOr("rel", "")))
+		asset := element != "a" && element != "area"
+		if element == "link" {
+			asset = false
+			for _, r := range rel {
+				asset = asset || assetRels[r]
+			}
+		}
+		l := classifyLink(req, href, asset)
+		if l == nil || seen[l.URL] {
+			return
+		}
+		seen[l.URL] = true
+		l.Element = element
+		l.Rel = rel
+		for _, r := range rel {
+			if r == "nofollow" || r == "ugc" || r == "sponsored" {
+				l.NoFollow = true
+			}
+		}
+		if element == "img" {
+			l.Text = normalizeSpace(e.AttrOr("alt", ""))
+		} else {
+			l.Text = normalizeSpace(e.Text())
+		}
+		links = append(links, l)
+	})
+	return links
+}
+
+// ClassifyLink returns the kind of a link of the page of the request.
+// It returns an empty kind for unsupported links, e.g. javascript: URLs.
+func ClassifyLink(req *colly.Request, href string) LinkKind {
+	if l := classifyLink(req, href, false); l != nil {
+		return l.Kind
+	}
+	return ""
+}
+
+func classifyLink(req *colly.Request, href string, asset bool) *Link {
+	lower := strings.ToLower(href)
+	switch {
+	case strings.HasPrefix(lower, "mailto:"):
+		target := href[len("mailto:"):]
+		if i := strings.IndexByte(target, '?'); i >= 0 {
+			target = target[:i]
+		}
+		target, _ = url.PathUnescape(target)
+		return &Link{URL: href, Kind: EmailLink, Target: strings.ToLower(strings.TrimSpace(target))}
+	case strings.HasPrefix(lower, "tel:"):
+		target, _ := url.PathUnescape(href[len("tel:"):])
+		return &Link{URL: href, Kind: PhoneLink, Target: strings.TrimSpace(target)}
+	}
+	abs := req.AbsoluteURL(href)
+	if abs == "" {
+		return nil
+	}
+	u, err := url.Parse(abs)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	l := &Link{URL: abs}
+	ext := strings.ToLower(path.Ext(u.Path))
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch {
+	case asset || AssetExtensions[ext]:
+		l.Kind = AssetLink
+	case DocumentExtensions[ext]:
+		l.Kind = DocumentLink
+	case socialNetwork(host) != "":
+		l.Kind = SocialLink
+		l.Network = socialNetwork(host)
+	case site(host) == site(req.URL.Hostname()):
+		l.Kind = InternalLink
+	default:
+		l.Kind = ExternalLink
+	}
+	return l
+}
+
+// FilterLinks returns the links of the given kinds
+func FilterLinks(links []*Link, kinds ...LinkKind) []*Link {
+	var res []*Link
+	for _, l := range links {
+		for _, k := range kinds {
+			if l.Kind == k {
+				res = append(res, l)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func socialNetwork(host string) string {
+	for d, name := range SocialNetworks {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return name
+		}
+	}
+	return ""
+}
+
+// site returns the registrable domain of a host
+func site(host string) string {
+	host = strings.ToLower(host)
+	if s, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return s
+	}
+	return host
+}
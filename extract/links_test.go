@@ -0,0 +1,79 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	r := newTestResponse("https://www.example.co.uk/about/", `<html><head>
+<link rel="stylesheet" href="/style.css"><link rel="canonical" href="https://www.example.co.uk/about/">
+</head><body>
+<a href="team">Our  team</a>
+<a href="https://shop.example.co.uk/">Shop</a>
+<a href="https://other.com/page" rel="nofollow sponsored">Partner</a>
+<a href="https://twitter.com/example">Twitter</a>
+<a href="https://www.linkedin.com/company/example">LinkedIn</a>
+<a href="/files/report.PDF">Annual report</a>
+<a href="mailto:Info@Example.co.uk?subject=Hi">Mail us</a>
+<a href="tel:+44%2020%207946%200000">Call</a>
+<a href="javascript:void(0)">Nothing</a>
+<a href="team">Duplicate</a>
+<img src="/logo.png" alt="Logo">
+</body></html>`)
+	links, err := ExtractLinks(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		url  string
+		kind LinkKind
+		text string
+	}{
+		{"https://www.example.co.uk/style.css", AssetLink, ""},
+		{"https://www.example.co.uk/about/", InternalLink, ""},
+		{"https://www.example.co.uk/about/team", InternalLink, "Our team"},
+		{"https://shop.example.co.uk/", InternalLink, "Shop"},
+		{"https://other.com/page", ExternalLink, "Partner"},
+		{"https://twitter.com/example", SocialLink, "Twitter"},
+		{"https://www.linkedin.com/company/example", SocialLink, "LinkedIn"},
+		{"https://www.example.co.uk/files/report.PDF", DocumentLink, "Annual report"},
+		{"mailto:Info@Example.co.uk?subject=Hi", EmailLink, "Mail us"},
+		{"tel:+44%2020%207946%200000", PhoneLink, "Call"},
+		{"https://www.example.co.uk/logo.png", AssetLink, "Logo"},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("Invalid number of links %d", len(links))
+	}
+	for i, e := range expected {
+		l := links[i]
+		if l.URL != e.url || l.Kind != e.kind || l.Text != e.text {
+			t.Errorf("Invalid link %d: %+v", i, l)
+		}
+	}
+	if !links[4].NoFollow || links[2].NoFollow {
+		t.Error("Invalid nofollow flags")
+	}
+	if links[5].Network != "twitter" || links[6].Network != "linkedin" {
+		t.Error("Invalid social networks")
+	}
+	if links[8].Target != "info@example.co.uk" || links[9].Target != "+44 20 7946 0000" {
+		t.Errorf("Invalid targets %q %q", links[8].Target, links[9].Target)
+	}
+	if n := len(FilterLinks(links, InternalLink, ExternalLink)); n != 4 {
+		t.Errorf("Invalid number of filtered links %d", n)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNumber(t *testing.T) {
+	for text, want := range map[string]float64{
+		"1,234.56":         1234.56,
+		"1.234,56":         1234.56,
+		"1 234,5":          1234.5,
+		"1'234'567.89 CHF": 1234567.89,
+		"1,234":            1234,
+		"0,5 kg":           0.5,
+		"12.99":            12.99,
+		"1.234.567":        1234567,
+		"-42 points":       -42,
+		"4 of 5 stars":     4,
+	} {
+		got, err := ParseNumber(text)
+		if err != nil || got != want {
+			t.Errorf("ParseNumber(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+	if got, _ := ParseNumberWithDecimal("1.234", ','); got != 1234 {
+		t.Errorf("ParseNumberWithDecimal = %v, want 1234", got)
+	}
+	if got, _ := ParseNumberWithDecimal("1.234", '.'); got != 1.234 {
+		t.Errorf("ParseNumberWithDecimal = %v, want 1.234", got)
+	}
+	if _, err := ParseNumber("sold out"); err != ErrNoNumber {
+		t.Errorf("ParseNumber error = %v, want %v", err, ErrNoNumber)
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	for text, want := range map[string]Price{
+		"$1,299.99":         {1299.99, "USD"},
+		"1.299,00 €":        {1299, "EUR"},
+		"CHF 12.50":         {12.5, "CHF"},
+		"R$ 49,90":          {49.9, "BRL"},
+		"£5":                {5, "GBP"},
+		"Price: 19.99":      {19.99, ""},
+		"1 999 Kč":          {1999, "CZK"},
+		"only 3 left, 9.95": {3, ""},
+	} {
+		got, err := ParsePrice(text)
+		if err != nil || *got != want {
+			t.Errorf("ParsePrice(%q) = %v, %v, want %v", text, got, err, &want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, loc)
+	for text, want := range map[string]time.Time{
+		"2020-06-09T10:30:00Z":          time.Date(2020, 6, 9, 10, 30, 0, 0, time.UTC),
+		"2020-06-09":                    time.Date(2020, 6, 9, 0, 0, 0, 0, loc),
+		"June 9th, 2020":                time.Date(2020, 6, 9, 0, 0, 0, 0, loc),
+		"9 Jun 2020 14:05":              time.Date(2020, 6, 9, 14, 5, 0, 0, loc),
+		"09.06.2020":                    time.Date(2020, 6, 9, 0, 0, 0, 0, loc),
+		"Tue, 09 Jun 2020 10:30:00 GMT": time.Date(2020, 6, 9, 10, 30, 0, 0, time.UTC),
+		"yesterday":                     time.Date(2020, 6, 14, 0, 0, 0, 0, loc),
+		"3 days ago":                    time.Date(2020, 6, 12, 12, 0, 0, 0, loc),
+		"an hour ago":                   time.Date(2020, 6, 15, 11, 0, 0, 0, loc),
+		"  Monday,   June 15, 2020 ":    time.Date(2020, 6, 15, 0, 0, 0, 0, loc),
+		"1591698600":                    time.Date(2020, 6, 9, 10, 30, 0, 0, time.UTC),
+	} {
+		got, err := parseDate(text, loc, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+	if _, err := ParseDate("not a date", nil); err != ErrUnknownDateFormat {
+		t.Errorf("ParseDate error = %v, want %v", err, ErrUnknownDateFormat)
+	}
+}
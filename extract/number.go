@@ -0,0 +1,96 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoNumber is the error returned if a text does not contain a number
+var ErrNoNumber = errors.New("No number found")
+
+// numberRe matches numbers with optional grouping and decimal separators
+// like "1,234.56", "1.234,56", "1 234,56", "1'234.56" or "-12"
+var numberRe = regexp.MustCompile(`[-−]?\d+(?:[.,'’]\d+|[\x{00a0}\x{202f} ]\d{3}\b)*`)
+
+// ParseNumber parses the first number found in a localized text.
+// The decimal separator is detected automatically: if both "." and ","
+// are present the last one is the decimal separator, a single separator
+// followed by exactly three digits is considered a thousands separator.
+// Use ParseNumberWithDecimal if the decimal separator is known.
+func ParseNumber(text string) (float64, error) {
+	return ParseNumberWithDecimal(text, 0)
+}
+
+// ParseNumberWithDecimal parses the first number found in a text using
+// the given decimal separator (e.g. ',' for German or French texts).
+// Every other separator is considered a grouping separator.
+func ParseNumberWithDecimal(text string, decimal rune) (float64, error) {
+	m := numberRe.FindString(text)
+	if m == "" {
+		return 0, ErrNoNumber
+	}
+	negative := strings.HasPrefix(m, "-") || strings.HasPrefix(m, "−")
+	m = strings.TrimLeft(m, "-−")
+	if decimal == 0 {
+		decimal = detectDecimalSeparator(m)
+	}
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for _, r := range m {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == decimal:
+			b.WriteByte('.')
+		}
+	}
+	return strconv.ParseFloat(b.String(), 64)
+}
+
+func detectDecimalSeparator(s string) rune {
+	lastDot := strings.LastIndex(s, ".")
+	lastComma := strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			return '.'
+		}
+		return ','
+	case lastDot < 0 && lastComma < 0:
+		return 0
+	}
+	sep, idx := '.', lastDot
+	if lastComma >= 0 {
+		sep, idx = ',', lastComma
+	}
+	// repeated separators are used for grouping: "1.234.567"
+	if strings.Count(s, string(sep)) > 1 {
+		return 0
+	}
+	// other grouping separators: "1 234,5"
+	if strings.ContainsAny(s, "'’\u00a0\u202f ") {
+		return sep
+	}
+	if len(s)-idx-1 == 3 {
+		return 0
+	}
+	return sep
+}
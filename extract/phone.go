@@ -0,0 +1,146 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidPhoneNumber is the error returned if a phone number is not
+// valid according to the numbering plan of its region
+var ErrInvalidPhoneNumber = errors.New("Invalid phone number")
+
+// NumberingPlan describes the phone numbers of a region
+type NumberingPlan struct {
+	// CountryCode is the international calling code without "+"
+	CountryCode string
+	// TrunkPrefix is removed from nationally formatted numbers
+	TrunkPrefix string
+	// MinLength and MaxLength limit the number of digits of the
+	// national significant number
+	MinLength, MaxLength int
+	// Pattern validates the national significant number if it is set
+	Pattern *regexp.Regexp
+}
+
+// NumberingPlans contains the numbering plans of the supported regions
+// keyed by ISO 3166-1 alpha-2 region codes. Add new regions to extend
+// the validation.
+var NumberingPlans = map[string]*NumberingPlan{
+	"US": {CountryCode: "1", TrunkPrefix: "1", MinLength: 10, MaxLength: 10, Pattern: nanpRe},
+	"CA": {CountryCode: "1", TrunkPrefix: "1", MinLength: 10, MaxLength: 10, Pattern: nanpRe},
+	"GB": {CountryCode: "44", TrunkPrefix: "0", MinLength: 9, MaxLength: 10},
+	"DE": {CountryCode: "49", TrunkPrefix: "0", MinLength: 6, MaxLength: 13},
+	"FR": {CountryCode: "33", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+	"IT": {CountryCode: "39", MinLength: 6, MaxLength: 11},
+	"ES": {CountryCode: "34", MinLength: 9, MaxLength: 9},
+	"NL": {CountryCode: "31", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+	"BE": {CountryCode: "32", TrunkPrefix: "0", MinLength: 8, MaxLength: 9},
+	"CH": {CountryCode: "41", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+	"AT": {CountryCode: "43", TrunkPrefix: "0", MinLength: 4, MaxLength: 13},
+	"PL": {CountryCode: "48", MinLength: 9, MaxLength: 9},
+	"CZ": {CountryCode: "420", MinLength: 9, MaxLength: 9},
+	"HU": {CountryCode: "36", TrunkPrefix: "06", MinLength: 8, MaxLength: 9},
+	"SE": {CountryCode: "46", TrunkPrefix: "0", MinLength: 7, MaxLength: 9},
+	"NO": {CountryCode: "47", MinLength: 8, MaxLength: 8},
+	"DK": {CountryCode: "45", MinLength: 8, MaxLength: 8},
+	"IE": {CountryCode: "353", TrunkPrefix: "0", MinLength: 7, MaxLength: 9},
+	"PT": {CountryCode: "351", MinLength: 9, MaxLength: 9},
+	"RU": {CountryCode: "7", TrunkPrefix: "8", MinLength: 10, MaxLength: 10},
+	"AU": {CountryCode: "61", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+	"NZ": {CountryCode: "64", TrunkPrefix: "0", MinLength: 8, MaxLength: 10},
+	"IN": {CountryCode: "91", TrunkPrefix: "0", MinLength: 10, MaxLength: 10},
+	"CN": {CountryCode: "86", TrunkPrefix: "0", MinLength: 10, MaxLength: 11},
+	"JP": {CountryCode: "81", TrunkPrefix: "0", MinLength: 9, MaxLength: 10},
+	"BR": {CountryCode: "55", TrunkPrefix: "0", MinLength: 10, MaxLength: 11},
+	"MX": {CountryCode: "52", MinLength: 10, MaxLength: 10},
+	"ZA": {CountryCode: "27", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+}
+
+var (
+	// nanpRe validates North American numbers: area codes and
+	// exchanges can not start with 0 or 1
+	nanpRe = regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)
+	// phoneCandidateRe matches phone number like texts
+	phoneCandidateRe = regexp.MustCompile(`(?:\+|\b00|\()?\d[\d\s().\-/]{5,}\d`)
+)
+
+// NormalizePhone validates a phone number and returns it in E.164 format
+// (e.g. "+14155552671"). Numbers without international prefix are parsed
+// using the numbering plan of defaultRegion.
+func NormalizePhone(number, defaultRegion string) (string, error) {
+	number = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(number), "tel:"))
+	if i := strings.IndexAny(number, ";,"); i >= 0 {
+		// strip extensions and parameters of tel: URIs
+		number = number[:i]
+	}
+	international := strings.HasPrefix(number, "+")
+	digits := onlyDigits(number)
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+	if international {
+		for _, p := range NumberingPlans {
+			if strings.HasPrefix(digits, p.CountryCode) && p.valid(digits[len(p.CountryCode):]) {
+				return "+" + digits, nil
+			}
+		}
+		return "", ErrInvalidPhoneNumber
+	}
+	p, ok := NumberingPlans[strings.ToUpper(defaultRegion)]
+	if !ok {
+		return "", ErrInvalidPhoneNumber
+	}
+	if p.TrunkPrefix != "" && strings.HasPrefix(digits, p.TrunkPrefix) && !p.valid(digits) {
+		digits = digits[len(p.TrunkPrefix):]
+	}
+	if !p.valid(digits) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return "+" + p.CountryCode + digits, nil
+}
+
+// Phones returns the valid phone numbers of a text in E.164 format
+func Phones(text, defaultRegion string) []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, c := range phoneCandidateRe.FindAllString(text, -1) {
+		if n, err := NormalizePhone(c, defaultRegion); err == nil && !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func (p *NumberingPlan) valid(national string) bool {
+	if len(national) < p.MinLength || len(national) > p.MaxLength {
+		return false
+	}
+	return p.Pattern == nil || p.Pattern.MatchString(national)
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
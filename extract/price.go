@@ -0,0 +1,127 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CurrencySymbols maps currency symbols to ISO 4217 currency codes.
+// Symbols are matched in the order of their length, so "R$" is
+// preferred over "$". Ambiguous symbols like "kr" are not included.
+var CurrencySymbols = map[string]string{
+	"$":   "USD",
+	"US$": "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"¥":   "JPY",
+	"円":   "JPY",
+	"元":   "CNY",
+	"CN¥": "CNY",
+	"₹":   "INR",
+	"₽":   "RUB",
+	"руб": "RUB",
+	"₩":   "KRW",
+	"R$":  "BRL",
+	"C$":  "CAD",
+	"CA$": "CAD",
+	"A$":  "AUD",
+	"AU$": "AUD",
+	"NZ$": "NZD",
+	"HK$": "HKD",
+	"S$":  "SGD",
+	"MX$": "MXN",
+	"zł":  "PLN",
+	"Kč":  "CZK",
+	"Ft":  "HUF",
+	"₺":   "TRY",
+	"₴":   "UAH",
+	"₪":   "ILS",
+	"₫":   "VND",
+	"฿":   "THB",
+	"₱":   "PHP",
+	"Fr.": "CHF",
+}
+
+var currencyCodeRe = regexp.MustCompile(`\b[A-Z]{3}\b`)
+
+// Price is a monetary amount extracted from a text
+type Price struct {
+	// Amount is the numeric value of the price
+	Amount float64
+	// Currency is the ISO 4217 code of the currency.
+	// It is empty if the text contains no known currency.
+	Currency string
+}
+
+// String returns the amount and the currency code of the price
+func (p *Price) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", p.Amount, p.Currency))
+}
+
+// ParsePrice extracts a price from a localized text like "$1,299.99",
+// "1.299,99 €" or "CHF 12.50". The currency is detected from ISO 4217
+// codes and currency symbols, the decimal separator is detected like
+// in ParseNumber.
+func ParsePrice(text string) (*Price, error) {
+	return parsePrice(text, 0)
+}
+
+// ParsePriceWithDecimal is like ParsePrice, but uses the given decimal
+// separator instead of detecting it
+func ParsePriceWithDecimal(text string, decimal rune) (*Price, error) {
+	return parsePrice(text, decimal)
+}
+
+func parsePrice(text string, decimal rune) (*Price, error) {
+	amount, err := ParseNumberWithDecimal(text, decimal)
+	if err != nil {
+		return nil, err
+	}
+	return &Price{
+		Amount:   amount,
+		Currency: detectCurrency(text),
+	}, nil
+}
+
+func detectCurrency(text string) string {
+	for _, code := range currencyCodeRe.FindAllString(text, -1) {
+		if isCurrencyCode(code) {
+			return code
+		}
+	}
+	symbol := ""
+	for s := range CurrencySymbols {
+		if len(s) > len(symbol) && strings.Contains(text, s) {
+			symbol = s
+		}
+	}
+	return CurrencySymbols[symbol]
+}
+
+func isCurrencyCode(code string) bool {
+	for _, c := range CurrencySymbols {
+		if c == code {
+			return true
+		}
+	}
+	switch code {
+	case "CHF", "SEK", "NOK", "DKK", "ISK", "ZAR", "RON", "BGN", "AED", "SAR":
+		return true
+	}
+	return false
+}
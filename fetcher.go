@@ -0,0 +1,172 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fetcher downloads the resources requested by a Collector. Fetchers
+// replace the built-in HTTP backend, e.g. to render pages in a headless
+// browser, to serve responses from a cache or an archive only, or to
+// delegate the download to a remote fetch service.
+//
+// The returned response must have a StatusCode and the decoded Body.
+// The Request and Ctx fields of the response are set by the Collector.
+// LimitRules, MaxBodySize and the callbacks of the Collector are applied
+// to the responses of Fetchers like to HTTP responses. Fetchers
+// rendering pages can capture screenshots and PDFs of them, see
+// Request.Capture.
+type Fetcher interface {
+	Do(ctx context.Context, r *Request) (*Response, error)
+}
+
+// FetcherFunc is an adapter to use an ordinary function as a Fetcher
+type FetcherFunc func(ctx context.Context, r *Request) (*Response, error)
+
+// Do calls f(ctx, r)
+func (f FetcherFunc) Do(ctx context.Context, r *Request) (*Response, error) {
+	return f(ctx, r)
+}
+
+// SetFetcher sets the Fetcher of every request of the Collector.
+// Fetchers of domains set by SetDomainFetcher take precedence.
+// Passing nil restores the built-in HTTP backend.
+func (c *Collector) SetFetcher(f Fetcher) {
+	c.backend.SetFetcher("", f)
+}
+
+// SetDomainFetcher sets the Fetcher of a domain. Subdomains are matched
+// by a leading "*.", e.g. "*.example.com". Passing nil removes the
+// Fetcher of the domain.
+func (c *Collector) SetDomainFetcher(domain string, f Fetcher) {
+	c.backend.SetFetcher(domain, f)
+}
+
+// HTTPFetcher returns the built-in HTTP backend of the Collector as a
+// Fetcher. Fetchers can use it to fall back to the network, e.g. in case
+// of cache misses. The URL of the request is updated to the URL of the
+// last redirect.
+func (c *Collector) HTTPFetcher() Fetcher {
+	return FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		req, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if r.Headers != nil {
+			req.Header = cloneHeader(*r.Headers)
+		}
+		resp, err := c.backend.Cache(req, c.MaxBodySize, c.MaxResumeAttempts, func(*http.Request, int, http.Header) bool {
+			return true
+		}, c.CacheDir)
+		if err == nil {
+			r.URL = req.URL
+		}
+		return resp, err
+	})
+}
+
+// fetcherRequestKey marks the contexts of the requests of Fetchers. The
+// slot and the health of these requests are handled by doFetcher.
+type fetcherRequestKey struct{}
+
+func isFetcherRequest(ctx context.Context) bool {
+	_, ok := ctx.Value(fetcherRequestKey{}).(bool)
+	return ok
+}
+
+// SetFetcher sets the Fetcher of a domain
+func (h *httpBackend) SetFetcher(domain string, f Fetcher) {
+	domain = strings.ToLower(domain)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if f == nil {
+		delete(h.fetchers, domain)
+		return
+	}
+	if h.fetchers == nil {
+		h.fetchers = make(map[string]Fetcher)
+	}
+	h.fetchers[domain] = f
+}
+
+// fetcher returns the Fetcher of a host or nil
+func (h *httpBackend) fetcher(host string) Fetcher {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.fetchers) == 0 {
+		return nil
+	}
+	for _, d := range domainKeys(host) {
+		if f, ok := h.fetchers[d]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// fetchResponse downloads the request by the Fetcher of its host or by the
+// HTTP backend if the host has no Fetcher
+func (c *Collector) fetchResponse(req *http.Request, request *Request, checkHeadersFunc checkHeadersFunc) (*Response, error) {
+	f := c.backend.fetcher(req.URL.Hostname())
+	if f == nil {
+		return c.backend.Cache(req, c.MaxBodySize, c.MaxResumeAttempts, checkHeadersFunc, c.CacheDir)
+	}
+	return c.backend.doFetcher(f, req, request, c.MaxBodySize, checkHeadersFunc)
+}
+
+// doFetcher downloads the request by a Fetcher within the LimitRule of
+// its host
+func (h *httpBackend) doFetcher(f Fetcher, req *http.Request, request *Request, bodySize int, checkHeadersFunc checkHeadersFunc) (resp *Response, err error) {
+	s, ok := slotFromContext(req.Context())
+	if !ok {
+		if s, err = h.frontier.acquire(req.Context(), req.URL); err != nil {
+			return nil, err
+		}
+	}
+	defer s.release(true)
+	started := time.Now()
+	defer func() {
+		h.health.record(req.URL.Host, resp, err, time.Since(started))
+	}()
+
+	request.Headers = &req.Header
+	timedRequest, cancel := h.withTimeout(req)
+	defer cancel()
+	// the HTTP backend reuses the slot if the Fetcher falls back to it
+	ctx := context.WithValue(withSlot(timedRequest.Context(), s), fetcherRequestKey{}, true)
+	resp, err = f.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, ErrNoResponse
+	}
+	if resp.Headers == nil {
+		resp.Headers = &http.Header{}
+	}
+	if !checkHeadersFunc(req, resp.StatusCode, *resp.Headers) {
+		return nil, ErrAbortedAfterHeaders
+	}
+	if bodySize > 0 && len(resp.Body) > bodySize {
+		resp.Body = resp.Body[:bodySize]
+		resp.Truncated = true
+	}
+	return resp, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func staticFetcher(body string) Fetcher {
+	return FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		return &Response{
+			StatusCode: 200,
+			Body:       []byte(body),
+			Headers:    &http.Header{"Content-Type": []string{"text/html"}},
+		}, nil
+	})
+}
+
+func TestFetcher(t *testing.T) {
+	c := NewCollector()
+	var userAgent string
+	c.SetFetcher(FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		userAgent = r.Headers.Get("User-Agent")
+		return staticFetcher(`<html><title>fetched</title></html>`).Do(ctx, r)
+	}))
+	c.SetDomainFetcher("*.example.org", staticFetcher(`<html><title>domain</title></html>`))
+
+	titles := map[string]string{}
+	c.OnHTML("title", func(e *HTMLElement) {
+		titles[e.Request.URL.Host] = e.Text
+	})
+	if err := c.Visit("http://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Visit("http://www.example.org/"); err != nil {
+		t.Fatal(err)
+	}
+	if titles["example.com"] != "fetched" || titles["www.example.org"] != "domain" {
+		t.Errorf("Unexpected titles: %v", titles)
+	}
+	if userAgent != c.UserAgent {
+		t.Errorf("Invalid User-Agent of the fetched request: %q", userAgent)
+	}
+}
+
+func TestFetcherAbortAfterHeaders(t *testing.T) {
+	c := NewCollector()
+	c.SetFetcher(staticFetcher("<html></html>"))
+	c.OnResponseHeaders(func(r *Response) {
+		r.Request.Abort()
+	})
+	if err := c.Visit("http://example.com/"); err != ErrAbortedAfterHeaders {
+		t.Errorf("Expected ErrAbortedAfterHeaders, got %v", err)
+	}
+
+	c = NewCollector()
+	c.SetFetcher(FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		return nil, nil
+	}))
+	if err := c.Visit("http://example.com/"); err != ErrNoResponse {
+		t.Errorf("Expected ErrNoResponse, got %v", err)
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("network " + r.Header.Get("X-Test")))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit())
+	network := c.HTTPFetcher()
+	c.SetFetcher(FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		if strings.HasSuffix(r.URL.Path, "/cached") {
+			return &Response{StatusCode: 200, Body: []byte("cached")}, nil
+		}
+		return network.Do(ctx, r)
+	}))
+	c.OnRequest(func(r *Request) {
+		r.Headers.Set("X-Test", "1")
+	})
+	var bodies []string
+	c.OnResponse(func(r *Response) {
+		bodies = append(bodies, string(r.Body))
+	})
+	c.Visit(ts.URL + "/cached")
+	c.Visit(ts.URL + "/")
+	if len(bodies) != 2 || bodies[0] != "cached" || bodies[1] != "network 1" {
+		t.Errorf("Unexpected bodies: %q", bodies)
+	}
+
+	c.SetFetcher(nil)
+	bodies = nil
+	c.Visit(ts.URL + "/cached")
+	if len(bodies) != 1 || bodies[0] != "network 1" {
+		t.Errorf("Fetcher was not removed: %q", bodies)
+	}
+}
+
+func TestHTTPFetcherWithLimitRule(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("network"))
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1})
+	network := c.HTTPFetcher()
+	c.SetFetcher(FetcherFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		return network.Do(ctx, r)
+	}))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Visit(ts.URL + "/")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fetcher falling back to the HTTP backend was blocked by the LimitRule")
+	}
+	u, _ := url.Parse(ts.URL)
+	if h := c.HostHealth(u.Host); h.Samples != 1 {
+		t.Errorf("Invalid number of health samples: %d", h.Samples)
+	}
+}
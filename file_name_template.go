@@ -0,0 +1,184 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kennygrant/sanitize"
+)
+
+// DefaultFileNameTemplate stores the files in a directory per host
+// named by the path and the checksum of the content
+const DefaultFileNameTemplate = "{{.Host}}/{{.PathSlug}}/{{.Hash}}.{{.Ext}}"
+
+// FileNameData is the data available in file name templates
+type FileNameData struct {
+	// Host is the host name of the URL without port
+	Host string
+	// Dir is the directory part of the URL path, e.g. "blog/2020"
+	Dir string
+	// Name is the last segment of the URL path without extension
+	Name string
+	// PathSlug is the URL path joined to a single segment,
+	// e.g. "blog_2020_post"
+	PathSlug string
+	// Query is the raw query of the URL
+	Query string
+	// Ext is the file extension without dot. It is taken from the URL
+	// path or from the content type.
+	Ext string
+	// Hash is the hex encoded SHA1 checksum of the content
+	Hash string
+	// URLHash is the hex encoded SHA1 checksum of the URL
+	URLHash string
+	// ContentType is the media type of the content
+	ContentType string
+	// Time is the time of the execution of the template
+	Time time.Time
+}
+
+// FileNameTemplate generates file paths from URLs and contents using
+// text/template syntax, e.g. "{{.Host}}/{{.PathSlug}}/{{.Hash}}.{{.Ext}}".
+// Every path segment of the result is sanitized, so templates can not
+// escape the target directory.
+type FileNameTemplate struct {
+	tmpl *template.Template
+}
+
+// NewFileNameTemplate parses a file name template
+func NewFileNameTemplate(text string) (*FileNameTemplate, error) {
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &FileNameTemplate{tmpl: tmpl}, nil
+}
+
+// NewFileNameData returns the template data of a URL and its content
+func NewFileNameData(u *url.URL, contentType string, body []byte) *FileNameData {
+	d := &FileNameData{
+		Host:  u.Hostname(),
+		Query: u.RawQuery,
+		Time:  time.Now(),
+	}
+	d.ContentType, _, _ = mime.ParseMediaType(contentType)
+	p := strings.Trim(path.Clean("/"+u.Path), "/")
+	if dir := path.Dir(p); dir != "." {
+		d.Dir = dir
+	}
+	ext := path.Ext(p)
+	d.Name = strings.TrimSuffix(path.Base(p), ext)
+	if p == "" {
+		d.Name = "index"
+	}
+	d.PathSlug = strings.Replace(strings.TrimSuffix(p, ext), "/", "_", -1)
+	if d.PathSlug == "" {
+		d.PathSlug = "index"
+	}
+	d.Ext = strings.TrimPrefix(strings.ToLower(ext), ".")
+	if d.Ext == "" {
+		d.Ext = contentTypeExtension(d.ContentType)
+	}
+	sum := sha1.Sum(body)
+	d.Hash = hex.EncodeToString(sum[:])
+	sum = sha1.Sum([]byte(u.String()))
+	d.URLHash = hex.EncodeToString(sum[:])
+	return d
+}
+
+// Execute returns the sanitized relative file path generated from data.
+// The path uses slashes as separator.
+func (t *FileNameTemplate) Execute(data *FileNameData) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	var segments []string
+	for _, s := range strings.Split(buf.String(), "/") {
+		if s = sanitizeSegment(s); s != "" {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		return "", errors.New("Empty file name")
+	}
+	last := len(segments) - 1
+	segments[last] = SanitizeFileName(segments[last])
+	return strings.Join(segments, "/"), nil
+}
+
+// FileName returns the file path of the response generated by the template
+func (t *FileNameTemplate) FileName(r *Response) (string, error) {
+	contentType := ""
+	if r.Headers != nil {
+		contentType = r.Headers.Get("Content-Type")
+	}
+	return t.Execute(NewFileNameData(r.Request.URL, contentType, r.Body))
+}
+
+// SaveAs writes response body to the file generated by the template in
+// dir. Missing directories are created. It returns the path of the file.
+func (r *Response) SaveAs(dir string, t *FileNameTemplate) (string, error) {
+	fileName, err := t.FileName(r)
+	if err != nil {
+		return "", err
+	}
+	fileName = filepath.Join(dir, filepath.FromSlash(fileName))
+	if err := os.MkdirAll(filepath.Dir(fileName), 0750); err != nil {
+		return "", err
+	}
+	return fileName, r.Save(fileName)
+}
+
+// sanitizeSegment sanitizes a path segment keeping its dots, so host
+// names remain readable. Empty, "." and ".." segments are dropped.
+func sanitizeSegment(s string) string {
+	var parts []string
+	for _, p := range strings.Split(s, ".") {
+		if p = sanitize.BaseName(p); p != "" && p != "-" {
+			parts = append(parts, strings.Replace(p, "-", "_", -1))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func contentTypeExtension(mediaType string) string {
+	switch mediaType {
+	case "":
+		return "bin"
+	case "text/html":
+		return "html"
+	case "text/plain":
+		return "txt"
+	case "image/jpeg":
+		return "jpg"
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0][1:]
+	}
+	return "bin"
+}
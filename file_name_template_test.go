@@ -0,0 +1,88 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNameTemplate(t *testing.T) {
+	tmpl, err := NewFileNameTemplate(DefaultFileNameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := "040f06fd774092478d450774f5ba30c5da78acc8"
+	for in, want := range map[string]string{
+		"http://example.com:8080/blog/2020/my post.html": "example.com/blog_2020_my_post/" + hash + ".html",
+		"http://example.com/":                            "example.com/index/" + hash + ".html",
+		"http://example.com/a/../../etc/passwd":          "example.com/etc_passwd/" + hash + ".html",
+		"http://www.example-site.com/files/Report.PDF":   "www.example_site.com/files_Report/" + hash + ".pdf",
+	} {
+		u, _ := url.Parse(in)
+		got, err := tmpl.Execute(NewFileNameData(u, "text/html; charset=utf-8", []byte("content")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("File name of %q is %q, want %q", in, got, want)
+		}
+	}
+
+	tmpl, err = NewFileNameTemplate("../{{.Dir}}/{{.Name}}.{{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://example.com/a/b/data")
+	if got, _ := tmpl.Execute(NewFileNameData(u, "application/json", nil)); got != "a/b/data.json" {
+		t.Errorf("Invalid file name %q", got)
+	}
+	if _, err := NewFileNameTemplate("{{.Missing}"); err == nil {
+		t.Error("Invalid template was parsed")
+	}
+	tmpl, _ = NewFileNameTemplate("{{.Missing}}")
+	if _, err := tmpl.Execute(NewFileNameData(u, "", nil)); err == nil {
+		t.Error("Missing field was executed")
+	}
+}
+
+func TestResponseSaveAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colly-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl, _ := NewFileNameTemplate("{{.Host}}/{{.Name}}.{{.Ext}}")
+	u, _ := url.Parse("http://example.com/page")
+	r := &Response{
+		Body:    []byte("<html></html>"),
+		Request: &Request{URL: u},
+		Headers: &http.Header{"Content-Type": []string{"text/html"}},
+	}
+	fileName, err := r.SaveAs(dir, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileName != filepath.Join(dir, "example.com", "page.html") {
+		t.Errorf("Invalid file name %q", fileName)
+	}
+	if b, err := ioutil.ReadFile(fileName); err != nil || string(b) != "<html></html>" {
+		t.Errorf("Invalid saved file %q %v", b, err)
+	}
+}
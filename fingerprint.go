@@ -0,0 +1,173 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// FingerprintType is the content fingerprinting method used to detect
+// duplicate responses
+type FingerprintType int
+
+const (
+	// NoFingerprint disables the detection of duplicate responses
+	NoFingerprint FingerprintType = iota
+	// MD5Fingerprint detects responses with identical bodies
+	MD5Fingerprint
+	// SimHashFingerprint detects near-duplicate responses by the SimHash
+	// of their text, e.g. pages which only differ in session IDs or dates
+	SimHashFingerprint
+)
+
+// DuplicateCallback is a type alias for OnDuplicate callback functions.
+// originalURL is the URL of the first response having the same content.
+type DuplicateCallback func(r *Response, originalURL string)
+
+// SimHash returns the 64 bit SimHash of the word bigrams of a text.
+// Similar texts have SimHashes differing only in a few bits.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	var weights [64]int
+	h := fnv.New64a()
+	add := func(feature string) {
+		h.Reset()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(words) == 1 {
+		add(words[0])
+	}
+	for i := 1; i < len(words); i++ {
+		add(words[i-1] + " " + words[i])
+	}
+	var fingerprint uint64
+	for i, w := range weights {
+		if w > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+// fingerprint returns the content fingerprint of a response and the
+// number of bits two fingerprints of duplicates can differ in
+func (c *Collector) fingerprint(r *Response) (uint64, int, bool) {
+	if len(r.Body) == 0 || r.StatusCode < 200 || r.StatusCode >= 300 {
+		return 0, 0, false
+	}
+	switch c.Fingerprint {
+	case MD5Fingerprint:
+		sum := md5.Sum(r.Body)
+		return binary.BigEndian.Uint64(sum[:8]), 0, true
+	case SimHashFingerprint:
+		contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+		var text string
+		switch {
+		case strings.Contains(contentType, "html"):
+			text = htmlText(r.Body)
+		case strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "xml") || strings.Contains(contentType, "json"):
+			text = string(r.Body)
+		default:
+			return 0, 0, false
+		}
+		fingerprint := SimHash(text)
+		if fingerprint == 0 {
+			return 0, 0, false
+		}
+		return fingerprint, c.SimHashDistance, true
+	}
+	return 0, 0, false
+}
+
+// isDuplicate stores the fingerprint of the response and returns the
+// URL of the first response with the same fingerprint
+func (c *Collector) isDuplicate(r *Response) (string, bool) {
+	s, ok := c.store.(storage.FingerprintStorage)
+	if !ok {
+		return "", false
+	}
+	fingerprint, distance, ok := c.fingerprint(r)
+	if !ok {
+		return "", false
+	}
+	u := r.Request.URL.String()
+	original, err := s.AddFingerprint(fingerprint, distance, u)
+	if err != nil || original == "" || original == u {
+		return "", false
+	}
+	return original, true
+}
+
+// htmlText returns the text of a HTML document without scripts and styles
+func htmlText(body []byte) string {
+	buf := &bytes.Buffer{}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return buf.String()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isHiddenTag(name) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isHiddenTag(name) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				buf.Write(z.Text())
+				buf.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func isHiddenTag(name []byte) bool {
+	switch string(name) {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// HammingDistance returns the number of different bits of two fingerprints
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,361 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package flow runs scripted multi-step interactions, e.g. visiting a
+// login page, submitting its form, extracting a token and calling an API
+// with it. The steps share the session of the Collector and their
+// values, and they are retried if they fail.
+//
+// Flows are defined in Go or loaded from JSON:
+//
+//	{
+//	  "steps": [
+//	    {"name": "login page", "url": "https://example.com/login"},
+//	    {"name": "login", "submit": "form#login",
+//	     "form": {"user": "${user}", "password": "${password}"}},
+//	    {"name": "token", "url": "/account",
+//	     "extract": {"token": {"selector": "meta[name=csrf]", "attr": "content"}}},
+//	    {"name": "data", "url": "/api/data?token=${token}"}
+//	  ]
+//	}
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrNoValue is the error of extractions which match nothing
+var ErrNoValue = errors.New("Extraction matched nothing")
+
+// ErrNoForm is the error of submit steps whose form is not found on the
+// previous page
+var ErrNoForm = errors.New("Form not found")
+
+// Vars are the values of a flow. Values are referenced as ${name} in the
+// URLs, form values, headers and bodies of the steps.
+type Vars map[string]string
+
+// Extractor extracts a value from the response of a step
+type Extractor struct {
+	// Selector is the CSS selector of the element containing the value
+	Selector string `json:"selector"`
+	// Attr is the attribute containing the value. The text of the
+	// element is extracted if it is empty.
+	Attr string `json:"attr"`
+	// Regexp extracts the first submatch, or the whole match if it has
+	// no groups, from the value or from the body if Selector is empty
+	Regexp string `json:"regexp"`
+}
+
+// Step is a request of a Flow
+type Step struct {
+	// Name identifies the step in errors
+	Name string `json:"name"`
+	// Method is the HTTP method of the request. It defaults to GET, or to
+	// POST if the step has Form values or Body.
+	Method string `json:"method"`
+	// URL is the address of the request. Relative URLs are resolved
+	// against the URL of the previous step.
+	URL string `json:"url"`
+	// Submit is the CSS selector of a form of the previous page. The
+	// form is sent with its current values to its action URL, which
+	// replaces URL and Method. Form overrides the values of the form.
+	Submit string `json:"submit"`
+	// Form contains the form values of the request
+	Form map[string]string `json:"form"`
+	// Body is the raw body of the request
+	Body string `json:"body"`
+	// Headers contains the additional headers of the request
+	Headers map[string]string `json:"headers"`
+	// Extract stores the extracted values in the Vars of the flow by
+	// their names. The step fails if an extraction matches nothing.
+	Extract map[string]Extractor `json:"extract"`
+	// Retries is the number of times the step is repeated if it fails
+	Retries int `json:"retries"`
+	// Check validates the response of the step and can set values. The
+	// responses with 4xx or 5xx status codes fail if it is nil.
+	Check func(r *colly.Response, vars Vars) error `json:"-"`
+}
+
+// Flow is a sequence of steps
+type Flow struct {
+	// Steps are the steps of the flow in the order of execution
+	Steps []Step `json:"steps"`
+	// Restarts is the number of times the flow is started again from the
+	// first step if a step fails after its retries, e.g. because the
+	// session has expired
+	Restarts int `json:"restarts"`
+}
+
+// StepError is the error of a failed step
+type StepError struct {
+	// Step is the name or the index of the failed step
+	Step string
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("Step %s failed: %s", e.Step, e.Err)
+}
+
+// Load reads a Flow from JSON
+func Load(r io.Reader) (*Flow, error) {
+	f := &Flow{}
+	if err := json.NewDecoder(r).Decode(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Run executes the flow by a clone of the Collector, which shares the
+// cookies and the transport of the Collector. It returns the values of
+// the flow including the initial values.
+func (f *Flow) Run(c *colly.Collector, initial Vars) (Vars, error) {
+	sc := c.Clone()
+	sc.Async = false
+	sc.AllowURLRevisit = true
+	sc.ParseHTTPErrorResponse = true
+	sc.MaxDepth = 0
+	r := &runner{collector: sc}
+	sc.OnResponse(func(res *colly.Response) {
+		r.res = res
+	})
+	sc.OnError(func(_ *colly.Response, err error) {
+		r.err = err
+	})
+	var err error
+	for attempt := 0; attempt <= f.Restarts; attempt++ {
+		vars := make(Vars, len(initial))
+		for k, v := range initial {
+			vars[k] = v
+		}
+		if err = f.run(r, vars); err == nil {
+			return vars, nil
+		}
+	}
+	return nil, err
+}
+
+// runner sends the requests of the steps and keeps the result of the
+// last request
+type runner struct {
+	collector *colly.Collector
+	res       *colly.Response
+	err       error
+}
+
+func (r *runner) do(method, u string, body io.Reader, hdr http.Header) (*colly.Response, error) {
+	r.res, r.err = nil, nil
+	if err := r.collector.Request(method, u, body, nil, hdr); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.res == nil {
+		return nil, errors.New("No response")
+	}
+	return r.res, nil
+}
+
+func (f *Flow) run(r *runner, vars Vars) error {
+	var last *colly.Response
+	for i := range f.Steps {
+		s := &f.Steps[i]
+		var res *colly.Response
+		var err error
+		for attempt := 0; attempt <= s.Retries; attempt++ {
+			if res, err = s.run(r, last, vars); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			name := s.Name
+			if name == "" {
+				name = fmt.Sprint(i + 1)
+			}
+			return &StepError{Step: name, Err: err}
+		}
+		last = res
+	}
+	return nil
+}
+
+// run sends the request of the step and processes its response
+func (s *Step) run(r *runner, last *colly.Response, vars Vars) (*colly.Response, error) {
+	expand := func(v string) string {
+		return os.Expand(v, func(k string) string { return vars[k] })
+	}
+	method, u := strings.ToUpper(s.Method), expand(s.URL)
+	form := url.Values{}
+	for k, v := range s.Form {
+		form.Set(k, expand(v))
+	}
+	if s.Submit != "" {
+		if last == nil {
+			return nil, ErrNoForm
+		}
+		action, formMethod, values, err := formValues(last, s.Submit)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range form {
+			values[k] = v
+		}
+		u, method, form = action, formMethod, values
+	}
+	if last != nil {
+		u = last.Request.AbsoluteURL(u)
+	}
+	var body io.Reader
+	hdr := http.Header{}
+	switch {
+	case s.Body != "":
+		body = strings.NewReader(expand(s.Body))
+	case len(form) > 0 && method == "GET":
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + form.Encode()
+	case len(form) > 0:
+		body = strings.NewReader(form.Encode())
+		hdr.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if method == "" {
+		method = "GET"
+		if body != nil {
+			method = "POST"
+		}
+	}
+	for k, v := range s.Headers {
+		hdr.Set(k, expand(v))
+	}
+	res, err := r.do(method, u, body, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.extract(res, vars); err != nil {
+		return nil, err
+	}
+	if s.Check != nil {
+		return res, s.Check(res, vars)
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("Unexpected status code %d", res.StatusCode)
+	}
+	return res, nil
+}
+
+// extract stores the values extracted from the response
+func (s *Step) extract(r *colly.Response, vars Vars) error {
+	if len(s.Extract) == 0 {
+		return nil
+	}
+	var doc *goquery.Document
+	for name, e := range s.Extract {
+		value, found := string(r.Body), true
+		if e.Selector != "" {
+			if doc == nil {
+				var err error
+				if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(r.Body)); err != nil {
+					return err
+				}
+			}
+			sel := doc.Find(e.Selector).First()
+			if e.Attr != "" {
+				value, found = sel.Attr(e.Attr)
+			} else {
+				value, found = strings.TrimSpace(sel.Text()), sel.Length() > 0
+			}
+		}
+		if found && e.Regexp != "" {
+			re, err := regexp.Compile(e.Regexp)
+			if err != nil {
+				return err
+			}
+			m := re.FindStringSubmatch(value)
+			if found = m != nil; found {
+				value = m[len(m)-1]
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %s", name, ErrNoValue)
+		}
+		vars[name] = value
+	}
+	return nil
+}
+
+// formValues returns the action URL, the method and the values of a form
+// of a page like a browser submits it
+func formValues(r *colly.Response, selector string) (string, string, url.Values, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+	if err != nil {
+		return "", "", nil, err
+	}
+	form := doc.Find(selector).First()
+	if form.Length() == 0 {
+		return "", "", nil, ErrNoForm
+	}
+	values := url.Values{}
+	form.Find("input[name], textarea[name], select[name]").Each(func(_ int, e *goquery.Selection) {
+		name, _ := e.Attr("name")
+		switch goquery.NodeName(e) {
+		case "textarea":
+			values.Add(name, e.Text())
+		case "select":
+			option := e.Find("option[selected]").First()
+			if option.Length() == 0 {
+				option = e.Find("option").First()
+			}
+			if v, ok := option.Attr("value"); ok {
+				values.Add(name, v)
+			} else if option.Length() > 0 {
+				values.Add(name, strings.TrimSpace(option.Text()))
+			}
+		default:
+			t := strings.ToLower(e.AttrOr("type", "text"))
+			switch t {
+			case "submit", "button", "image", "reset", "file":
+				return
+			case "checkbox", "radio":
+				if _, checked := e.Attr("checked"); !checked {
+					return
+				}
+				values.Add(name, e.AttrOr("value", "on"))
+				return
+			}
+			values.Add(name, e.AttrOr("value", ""))
+		}
+	})
+	action := r.Request.AbsoluteURL(form.AttrOr("action", ""))
+	if action == "" {
+		action = r.Request.URL.String()
+	}
+	return action, strings.ToUpper(form.AttrOr("method", "GET")), values, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const loginFlow = `{
+	"steps": [
+		{"name": "login page", "url": "${site}/login"},
+		{"name": "login", "submit": "form#login", "form": {"user": "${user}", "password": "secret"}},
+		{"name": "token", "url": "/account",
+		 "extract": {
+			"token": {"selector": "meta[name=csrf]", "attr": "content"},
+			"plan": {"regexp": "plan: (\\w+)"}
+		 }},
+		{"name": "data", "url": "/api/data?token=${token}", "retries": 2,
+		 "extract": {"data": {"selector": "p"}}}
+	]
+}`
+
+func newTestServer() *httptest.Server {
+	apiCalls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`<form id="search"><input name="q"></form>
+<form id="login" method="post" action="/login">
+<input type="hidden" name="csrf" value="abc">
+<input name="user"><input type="password" name="password">
+<input type="checkbox" name="remember" value="yes" checked>
+<input type="checkbox" name="newsletter">
+<select name="lang"><option value="en">English</option><option value="de" selected>Deutsch</option></select>
+<input type="submit" name="go" value="Login">
+</form>`))
+			return
+		}
+		r.ParseForm()
+		if r.Form.Get("csrf") != "abc" || r.Form.Get("user") != "alice" || r.Form.Get("password") != "secret" ||
+			r.Form.Get("remember") != "yes" || r.Form.Get("lang") != "de" || r.Form.Get("newsletter") != "" || r.Form.Get("go") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		w.Write([]byte("welcome"))
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`<meta name="csrf" content="t0k3n"><div>plan: premium</div>`))
+	})
+	mux.HandleFunc("/api/data", func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		if apiCalls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("token") != "t0k3n" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`<p>secret data</p>`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRun(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	f, err := Load(strings.NewReader(loginFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := f.Run(colly.NewCollector(), Vars{"site": ts.URL, "user": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["token"] != "t0k3n" || vars["plan"] != "premium" || vars["data"] != "secret data" || vars["user"] != "alice" {
+		t.Errorf("Unexpected values: %v", vars)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	f, _ := Load(strings.NewReader(loginFlow))
+	_, err := f.Run(colly.NewCollector(), Vars{"site": ts.URL, "user": "bob"})
+	if e, ok := err.(*StepError); !ok || e.Step != "login" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	f = &Flow{Steps: []Step{{URL: ts.URL + "/login", Submit: "form#missing"}}}
+	if _, err = f.Run(colly.NewCollector(), nil); err == nil || !strings.Contains(err.Error(), ErrNoForm.Error()) {
+		t.Errorf("Unexpected error of missing form: %v", err)
+	}
+
+	// the flow is restarted after the session expires
+	attempts := 0
+	f = &Flow{
+		Restarts: 1,
+		Steps: []Step{
+			{Name: "page", URL: ts.URL + "/login"},
+			{Name: "check", URL: ts.URL + "/login", Check: func(r *colly.Response, vars Vars) error {
+				attempts++
+				if attempts == 1 {
+					return errors.New("session expired")
+				}
+				vars["checked"] = "yes"
+				return nil
+			}},
+		},
+	}
+	vars, err := f.Run(colly.NewCollector(), nil)
+	if err != nil || vars["checked"] != "yes" || attempts != 2 {
+		t.Errorf("Flow was not restarted: %v %v %d", vars, err, attempts)
+	}
+}
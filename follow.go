@@ -0,0 +1,111 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FollowCondition decides whether a link is followed. It gets the link
+// element, whose DOM gives access to the whole page.
+type FollowCondition func(link *HTMLElement) bool
+
+// LinkFollower visits the links matched by a selector if all of its
+// conditions are met
+type LinkFollower struct {
+	conditions []FollowCondition
+	lock       *sync.RWMutex
+}
+
+// FollowLinks visits the URLs of the href, or src, attributes of the
+// elements matched by the selector, e.g. "a[href]". The links are visited
+// by Request.Visit, so they inherit the context and the depth of the
+// page. Conditions can be added by FollowIf:
+//
+//	c.FollowLinks("a.product[href]").
+//		FollowIf(PageContains(".breadcrumb", "Books"))
+func (c *Collector) FollowLinks(selector string) *LinkFollower {
+	f := &LinkFollower{lock: &sync.RWMutex{}}
+	c.OnHTML(selector, f.follow)
+	return f
+}
+
+// FollowIf adds a condition to the LinkFollower. It returns the
+// LinkFollower to allow chaining.
+func (f *LinkFollower) FollowIf(cond FollowCondition) *LinkFollower {
+	f.lock.Lock()
+	f.conditions = append(f.conditions, cond)
+	f.lock.Unlock()
+	return f
+}
+
+func (f *LinkFollower) follow(e *HTMLElement) {
+	link := e.Attr("href")
+	if link == "" {
+		link = e.Attr("src")
+	}
+	if link == "" {
+		return
+	}
+	f.lock.RLock()
+	conditions := f.conditions
+	f.lock.RUnlock()
+	for _, cond := range conditions {
+		if !cond(e) {
+			return
+		}
+	}
+	e.Request.Visit(link)
+}
+
+// PageHas returns a FollowCondition which is met on pages having an
+// element matched by the selector
+func PageHas(selector string) FollowCondition {
+	return func(link *HTMLElement) bool {
+		return page(link).Find(selector).Length() > 0
+	}
+}
+
+// PageContains returns a FollowCondition which is met on pages where
+// the text of an element matched by the selector contains the text
+func PageContains(selector, text string) FollowCondition {
+	return func(link *HTMLElement) bool {
+		found := false
+		page(link).Find(selector).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			found = strings.Contains(s.Text(), text)
+			return !found
+		})
+		return found
+	}
+}
+
+// LinkContains returns a FollowCondition which is met by the links whose
+// text contains the text
+func LinkContains(text string) FollowCondition {
+	return func(link *HTMLElement) bool {
+		return strings.Contains(link.Text, text)
+	}
+}
+
+// page returns the root element of the page of an element
+func page(e *HTMLElement) *goquery.Selection {
+	if root := e.DOM.Parents().Last(); root.Length() > 0 {
+		return root
+	}
+	return e.DOM
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFollowIf(t *testing.T) {
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/", page(`<nav class="breadcrumb">Home</nav><a href="/books">Books</a><a href="/music">Music</a>`))
+	mux.HandleFunc("/books", page(`<nav class="breadcrumb">Home / Books</nav><a href="/books/1">Book 1</a><a href="/books/2">Book 2</a><a href="/about">About</a>`))
+	mux.HandleFunc("/music", page(`<nav class="breadcrumb">Home / Music</nav><a href="/music/1">Album 1</a>`))
+	mux.HandleFunc("/books/1", page(`book 1`))
+	mux.HandleFunc("/books/2", page(`book 2`))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewCollector()
+	var visited []string
+	c.OnResponse(func(r *Response) {
+		visited = append(visited, r.Request.URL.Path)
+	})
+	// categories are followed from the home page, books from the books
+	// category only
+	c.FollowLinks("a[href]").FollowIf(func(link *HTMLElement) bool {
+		return link.Request.URL.Path == "/" || PageContains(".breadcrumb", "Books")(link)
+	}).FollowIf(LinkContains("Book"))
+	c.Visit(ts.URL + "/")
+	sort.Strings(visited)
+	if expected := []string{"/", "/books", "/books/1", "/books/2"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Unexpected visited pages: %v", visited)
+	}
+
+	c = NewCollector()
+	visited = nil
+	c.OnResponse(func(r *Response) {
+		visited = append(visited, r.Request.URL.Path)
+	})
+	c.FollowLinks("a[href]").FollowIf(PageHas("nav.breadcrumb:contains('Music')"))
+	c.Visit(ts.URL + "/music")
+	if expected := []string{"/music", "/music/1"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Unexpected visited pages: %v", visited)
+	}
+}
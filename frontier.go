@@ -0,0 +1,426 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// frontier schedules the requests per host and LimitRule. The requests
+// hold one of the Parallelism slots of their LimitRule from sending the
+// request until Delay has elapsed after the response. The slots of a
+// rule are shared by its hosts, which take turns, unless the rule is
+// PerHost. Asynchronous requests waiting for a slot are queued instead
+// of occupying goroutines.
+//
+// If the global concurrency is limited, the requests without LimitRule
+// are queued too, and the free slots are shared by the rules in
+// proportion to their weights.
+type frontier struct {
+	backend *httpBackend
+	hosts   map[queueKey]*hostQueue
+	lock    sync.Mutex
+	// limit is the maximum number of concurrent requests of all the
+	// hosts. 0 means unlimited.
+	limit int
+	// running is the number of the requests in progress
+	running int
+	// ruleRunning is the number of the requests in progress per rule
+	ruleRunning map[*LimitRule]int
+	// ruleSlots is the number of the slots held per rule including the
+	// slots kept for the Delay of the rule
+	ruleSlots map[*LimitRule]int
+}
+
+// queueKey identifies the queue of the requests of a host matching a
+// LimitRule
+type queueKey struct {
+	host string
+	rule *LimitRule
+}
+
+// hostQueue contains the requests of a host matching a LimitRule
+// waiting for a slot
+type hostQueue struct {
+	host    string
+	rule    *LimitRule
+	waiting []queuedTask
+	running int
+	// paused is true while the tasks wait for the next window of the
+	// CrawlSchedule of the LimitRule
+	paused bool
+}
+
+// slot is the permission of a request to be sent to a host
+type slot struct {
+	frontier *frontier
+	queue    *hostQueue
+	rule     *LimitRule
+	once     sync.Once
+}
+
+// queuedTask is a task waiting for a slot to request the URL
+type queuedTask struct {
+	url *url.URL
+	run func(*slot)
+}
+
+type slotKey struct{}
+
+func newFrontier(backend *httpBackend) *frontier {
+	return &frontier{
+		backend:     backend,
+		hosts:       make(map[queueKey]*hostQueue),
+		ruleRunning: make(map[*LimitRule]int),
+		ruleSlots:   make(map[*LimitRule]int),
+	}
+}
+
+// push schedules a task which is started in a new goroutine as soon as
+// the LimitRule of the URL and the global concurrency allow it
+func (f *frontier) push(u *url.URL, task func(*slot)) {
+	rule := f.backend.matchingURLRule(u)
+	f.lock.Lock()
+	if rule == nil && f.limit == 0 {
+		f.lock.Unlock()
+		go task(nil)
+		return
+	}
+	key := queueKey{host: u.Host, rule: rule}
+	q, ok := f.hosts[key]
+	if !ok {
+		q = &hostQueue{host: u.Host, rule: rule}
+		f.hosts[key] = q
+	}
+	q.waiting = append(q.waiting, queuedTask{url: u, run: task})
+	f.dispatch(q)
+	f.lock.Unlock()
+}
+
+// acquire blocks until a slot of the URL is available. It returns nil
+// if the URL has no LimitRule and the global concurrency is unlimited.
+func (f *frontier) acquire(ctx context.Context, u *url.URL) (*slot, error) {
+	if !f.limited(f.backend.matchingURLRule(u)) {
+		return nil, nil
+	}
+	slots := make(chan *slot, 1)
+	f.push(u, func(s *slot) {
+		slots <- s
+	})
+	select {
+	case s := <-slots:
+		return s, nil
+	case <-ctx.Done():
+		go func() {
+			if s := <-slots; s != nil {
+				s.release(false)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// limited reports whether the requests of the rule have to wait for
+// a slot
+func (f *frontier) limited(rule *LimitRule) bool {
+	if rule != nil {
+		return true
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.limit > 0
+}
+
+// dispatch starts the waiting tasks of the queue allowed by its
+// LimitRule. The tasks of the other hosts of the rule are dispatched
+// too unless the rule is PerHost. If the global concurrency is limited,
+// the tasks of every queue are dispatched by their shares. f.lock must
+// be held.
+func (f *frontier) dispatch(q *hostQueue) {
+	if f.limit > 0 {
+		f.dispatchShares()
+		return
+	}
+	if q.rule != nil && !q.rule.PerHost {
+		f.dispatchRule(q.rule)
+		return
+	}
+	for f.ready(q) {
+		f.start(q)
+	}
+	f.cleanup(q)
+}
+
+// dispatchRule starts the waiting tasks of the hosts of the rule. Each
+// free slot goes to the host having the fewest running requests.
+// f.lock must be held.
+func (f *frontier) dispatchRule(rule *LimitRule) {
+	for {
+		var next *hostQueue
+		for key, q := range f.hosts {
+			if key.rule == rule && f.ready(q) && (next == nil || q.running < next.running) {
+				next = q
+			}
+		}
+		if next == nil {
+			break
+		}
+		f.start(next)
+	}
+	for key, q := range f.hosts {
+		if key.rule == rule {
+			f.cleanup(q)
+		}
+	}
+}
+
+// dispatchShares starts the waiting tasks allowed by the global
+// concurrency. Each free slot goes to the rule having the fewest
+// running requests relative to its weight, then to its host having the
+// fewest running requests. Slots unused by a rule are given to the
+// others. f.lock must be held.
+func (f *frontier) dispatchShares() {
+	for f.running < f.limit {
+		var next *hostQueue
+		for _, q := range f.hosts {
+			if f.ready(q) && (next == nil || f.before(q, next)) {
+				next = q
+			}
+		}
+		if next == nil {
+			break
+		}
+		f.start(next)
+	}
+	for _, q := range f.hosts {
+		f.cleanup(q)
+	}
+}
+
+// before reports whether the next slot should be given to the queue a
+// rather than to b
+func (f *frontier) before(a, b *hostQueue) bool {
+	x := (f.ruleRunning[a.rule] + 1) * b.rule.weight()
+	y := (f.ruleRunning[b.rule] + 1) * a.rule.weight()
+	if x != y {
+		return x < y
+	}
+	return a.running < b.running
+}
+
+// ready reports whether a waiting task of the queue can be started. The
+// queue is paused until the next window of the CrawlSchedule of its
+// LimitRule if the schedule does not allow requests now. f.lock must be
+// held.
+func (f *frontier) ready(q *hostQueue) bool {
+	if q.paused || len(q.waiting) == 0 {
+		return false
+	}
+	rule := q.rule
+	if rule != nil && rule.Schedule != nil {
+		if wait := rule.Schedule.Wait(time.Now()); wait > 0 {
+			q.paused = true
+			time.AfterFunc(wait, func() {
+				f.lock.Lock()
+				q.paused = false
+				f.dispatch(q)
+				f.lock.Unlock()
+			})
+			return false
+		}
+	}
+	if rule == nil {
+		return true
+	}
+	if rule.PerHost {
+		return q.running < rule.parallelism()
+	}
+	return f.ruleSlots[rule] < rule.parallelism()
+}
+
+// start starts the first waiting task of the queue. f.lock must be
+// held.
+func (f *frontier) start(q *hostQueue) {
+	task := q.waiting[0]
+	q.waiting[0] = queuedTask{}
+	q.waiting = q.waiting[1:]
+	q.running++
+	f.ruleSlots[q.rule]++
+	f.running++
+	f.ruleRunning[q.rule]++
+	go task.run(&slot{frontier: f, queue: q, rule: q.rule})
+}
+
+// finish frees the place of a request of the queue in the global
+// concurrency. f.lock must be held.
+func (f *frontier) finish(q *hostQueue) {
+	f.running--
+	if f.ruleRunning[q.rule]--; f.ruleRunning[q.rule] <= 0 {
+		delete(f.ruleRunning, q.rule)
+	}
+}
+
+// cleanup removes the queue if it is empty. f.lock must be held.
+func (f *frontier) cleanup(q *hostQueue) {
+	if q.running > 0 || len(q.waiting) > 0 {
+		return
+	}
+	key := queueKey{host: q.host, rule: q.rule}
+	if f.hosts[key] == q {
+		delete(f.hosts, key)
+	}
+}
+
+// setLimit sets the global concurrency and starts the tasks allowed
+// by it
+func (f *frontier) setLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.limit = n
+	if n > 0 {
+		f.dispatchShares()
+		return
+	}
+	for _, q := range f.hosts {
+		f.dispatch(q)
+	}
+}
+
+// replaceRule moves the queues of the old rule to the new rule and
+// starts their tasks allowed by the new rule
+func (f *frontier) replaceRule(old, rule *LimitRule) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var queues []*hostQueue
+	for key, q := range f.hosts {
+		if key.rule == old {
+			delete(f.hosts, key)
+			queues = append(queues, q)
+		}
+	}
+	if n, ok := f.ruleRunning[old]; ok {
+		delete(f.ruleRunning, old)
+		f.ruleRunning[rule] += n
+	}
+	if n, ok := f.ruleSlots[old]; ok {
+		delete(f.ruleSlots, old)
+		f.ruleSlots[rule] += n
+	}
+	for _, q := range queues {
+		q.rule = rule
+		// the schedule of the old rule does not apply anymore
+		q.paused = false
+		f.hosts[queueKey{host: q.host, rule: rule}] = q
+		f.dispatch(q)
+	}
+}
+
+// removeRule schedules the waiting tasks of the queues of the removed
+// rule again. The running tasks release their slots to their queues,
+// which are removed when they become empty.
+func (f *frontier) removeRule(rule *LimitRule) {
+	f.lock.Lock()
+	var tasks []queuedTask
+	for key, q := range f.hosts {
+		if key.rule != rule {
+			continue
+		}
+		tasks = append(tasks, q.waiting...)
+		q.waiting = nil
+		if q.running == 0 {
+			delete(f.hosts, key)
+		}
+	}
+	f.lock.Unlock()
+	for _, t := range tasks {
+		f.push(t.url, t.run)
+	}
+}
+
+// release frees the slot. If delay is true, the slot is kept until the
+// Delay and RandomDelay of the LimitRule have elapsed. Delayed slots do
+// not count towards the global concurrency.
+func (s *slot) release(delay bool) {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		d := time.Duration(0)
+		if delay && s.rule != nil {
+			d = s.rule.Delay
+			if s.rule.DelayFunc != nil {
+				d = s.rule.DelayFunc(s.frontier.backend.health.get(s.queue.host))
+			}
+			if s.rule.RandomDelay != 0 {
+				d += time.Duration(rand.Int63n(int64(s.rule.RandomDelay)))
+			}
+		}
+		if d > 0 {
+			f := s.frontier
+			f.lock.Lock()
+			f.finish(s.queue)
+			f.dispatch(s.queue)
+			f.lock.Unlock()
+			time.AfterFunc(d, func() {
+				s.free(true)
+			})
+			return
+		}
+		s.free(false)
+	})
+}
+
+// free returns the slot to its queue. finished is true if the place of
+// the slot in the global concurrency is already freed.
+func (s *slot) free(finished bool) {
+	f := s.frontier
+	f.lock.Lock()
+	if !finished {
+		f.finish(s.queue)
+	}
+	s.queue.running--
+	if f.ruleSlots[s.queue.rule]--; f.ruleSlots[s.queue.rule] <= 0 {
+		delete(f.ruleSlots, s.queue.rule)
+	}
+	f.dispatch(s.queue)
+	f.lock.Unlock()
+}
+
+// queueDepth returns the number of the waiting tasks
+func (f *frontier) queueDepth() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	n := 0
+	for _, q := range f.hosts {
+		n += len(q.waiting)
+	}
+	return n
+}
+
+func withSlot(ctx context.Context, s *slot) context.Context {
+	return context.WithValue(ctx, slotKey{}, s)
+}
+
+func slotFromContext(ctx context.Context) (*slot, bool) {
+	s, ok := ctx.Value(slotKey{}).(*slot)
+	return s, ok
+}
@@ -4,13 +4,15 @@ go 1.12
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.1
-	github.com/andybalholm/cascadia v1.2.0 // indirect
+	github.com/andybalholm/brotli v1.0.1
+	github.com/andybalholm/cascadia v1.2.0
 	github.com/antchfx/htmlquery v1.2.3
 	github.com/antchfx/xmlquery v1.3.4
 	github.com/gobwas/glob v0.2.3
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/jawher/mow.cli v1.1.0
 	github.com/kennygrant/sanitize v1.2.4
+	github.com/klauspost/compress v1.11.4
 	github.com/saintfish/chardet v0.0.0-20120816061221-3af4cd4741ca
 	github.com/temoto/robotstxt v1.1.1
 	golang.org/x/net v0.0.0-20200813134508-3edf25e44fcc
@@ -0,0 +1,187 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GraphQLRequest is a query of a GraphQL endpoint
+type GraphQLRequest struct {
+	// Endpoint is the URL of the GraphQL endpoint
+	Endpoint string
+	// Query is the GraphQL query document
+	Query string
+	// OperationName selects the operation of the Query if it has more
+	// than one
+	OperationName string
+	// Variables are the variables of the query
+	Variables map[string]interface{}
+	// Persisted sends only the SHA-256 hash of the Query first, as
+	// automatic persisted queries. The Query is sent if the server does
+	// not know the hash.
+	Persisted bool
+	// Headers are added to the request, e.g. an Authorization header
+	Headers http.Header
+}
+
+// GraphQLLocation is a position in a GraphQL query document
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an error of a GraphQL response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLErrors are the errors of a GraphQL response
+type GraphQLErrors []*GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return "GraphQL error: " + strings.Join(messages, "; ")
+}
+
+// GraphQLResult is the response of a GraphQL query
+type GraphQLResult struct {
+	// Data is the raw JSON data of the response
+	Data json.RawMessage `json:"data"`
+	// Errors are the errors of the response. Results can have data and
+	// errors at the same time if the query succeeded partially.
+	Errors GraphQLErrors `json:"errors,omitempty"`
+	// Extensions are the extensions of the response
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+	// Response is the HTTP response of the query
+	Response *Response `json:"-"`
+}
+
+// Decode decodes the data of the result into v
+func (r *GraphQLResult) Decode(v interface{}) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// GraphQL sends a query to a GraphQL endpoint and calls onResult with
+// the result if it has data. The errors of the result are returned as
+// GraphQLErrors. See GraphQLRequest.
+func (c *Collector) GraphQL(endpoint, query string, variables map[string]interface{}, onResult func(*GraphQLResult)) error {
+	return c.GraphQLRequest(&GraphQLRequest{
+		Endpoint:  endpoint,
+		Query:     query,
+		Variables: variables,
+	}, onResult)
+}
+
+// GraphQLRequest sends a GraphQL query and calls onResult with the
+// result if it has data. The errors of the result are returned as
+// GraphQLErrors.
+//
+// The query is sent synchronously by a clone of the Collector, so the
+// callbacks of the Collector are not called. Responses with HTTP error
+// status are parsed too, because GraphQL servers report errors with
+// them.
+func (c *Collector) GraphQLRequest(q *GraphQLRequest, onResult func(*GraphQLResult)) error {
+	res, err := c.graphQL(q, q.Persisted)
+	if err == nil && q.Persisted && persistedQueryNotFound(res.Errors) {
+		res, err = c.graphQL(q, false)
+	}
+	if err != nil {
+		return err
+	}
+	if len(res.Data) > 0 && string(res.Data) != "null" && onResult != nil {
+		onResult(res)
+	}
+	if len(res.Errors) > 0 {
+		return res.Errors
+	}
+	return nil
+}
+
+// graphQL sends the query. Only the hash of the query is sent if
+// hashOnly is true.
+func (c *Collector) graphQL(q *GraphQLRequest, hashOnly bool) (*GraphQLResult, error) {
+	payload := map[string]interface{}{}
+	if !hashOnly {
+		payload["query"] = q.Query
+	}
+	if q.OperationName != "" {
+		payload["operationName"] = q.OperationName
+	}
+	if len(q.Variables) > 0 {
+		payload["variables"] = q.Variables
+	}
+	if q.Persisted {
+		sum := sha256.Sum256([]byte(q.Query))
+		payload["extensions"] = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hex.EncodeToString(sum[:]),
+			},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	hdr := cloneHeader(q.Headers)
+	hdr.Set("Content-Type", "application/json")
+	hdr.Set("Accept", "application/graphql-response+json, application/json")
+	hdr.Set("User-Agent", c.UserAgent)
+
+	sc := c.Clone()
+	sc.Async = false
+	sc.AllowURLRevisit = true
+	sc.ParseHTTPErrorResponse = true
+	// repeated queries can have identical responses
+	sc.Fingerprint = NoFingerprint
+	sc.IgnoreRobotsNoIndex = true
+	sc.LanguageFilter = nil
+	var resp *Response
+	sc.OnResponse(func(r *Response) {
+		resp = r
+	})
+	if err := sc.Request("POST", q.Endpoint, bytes.NewReader(body), nil, hdr); err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, ErrNoResponse
+	}
+	res := &GraphQLResult{Response: resp}
+	if err := json.Unmarshal(resp.Body, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func persistedQueryNotFound(errs GraphQLErrors) bool {
+	for _, e := range errs {
+		if e.Message == "PersistedQueryNotFound" || e.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const productQuery = `query Product($id: ID!) { product(id: $id) { name } }`
+
+// newGraphQLServer serves a GraphQL endpoint supporting automatic
+// persisted queries. It records the number of queries sent with text.
+func newGraphQLServer(fullQueries *int) *httptest.Server {
+	var lock sync.Mutex
+	persisted := map[string]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query      string                 `json:"query"`
+			Variables  map[string]interface{} `json:"variables"`
+			Extensions struct {
+				PersistedQuery struct {
+					Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		lock.Lock()
+		defer lock.Unlock()
+		if req.Query != "" {
+			*fullQueries++
+		}
+		if hash := req.Extensions.PersistedQuery.Hash; hash != "" {
+			if req.Query == "" {
+				if req.Query = persisted[hash]; req.Query == "" {
+					w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+					return
+				}
+			} else {
+				sum := sha256.Sum256([]byte(req.Query))
+				if hex.EncodeToString(sum[:]) != hash {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"errors":[{"message":"invalid hash"}]}`))
+					return
+				}
+				persisted[hash] = req.Query
+			}
+		}
+		if req.Query != productQuery {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"unknown query","locations":[{"line":1,"column":1}]}]}`))
+			return
+		}
+		if req.Variables["id"] == "missing" {
+			w.Write([]byte(`{"data":{"product":null},"errors":[{"message":"not found","path":["product"]}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"product":{"name":"product ` + req.Variables["id"].(string) + `"}}}`))
+	}))
+}
+
+type productData struct {
+	Product struct {
+		Name string `json:"name"`
+	} `json:"product"`
+}
+
+func TestGraphQL(t *testing.T) {
+	var fullQueries int
+	ts := newGraphQLServer(&fullQueries)
+	defer ts.Close()
+
+	c := NewCollector()
+	var name string
+	err := c.GraphQL(ts.URL+"/graphql", productQuery, map[string]interface{}{"id": "1"}, func(r *GraphQLResult) {
+		d := &productData{}
+		if err := r.Decode(d); err != nil {
+			t.Error(err)
+		}
+		name = d.Product.Name
+	})
+	if err != nil || name != "product 1" {
+		t.Errorf("Invalid result %q %v", name, err)
+	}
+
+	called := false
+	err = c.GraphQL(ts.URL+"/graphql", productQuery, map[string]interface{}{"id": "missing"}, func(r *GraphQLResult) {
+		called = true
+	})
+	errs, ok := err.(GraphQLErrors)
+	if !ok || len(errs) != 1 || errs[0].Message != "not found" || errs[0].Path[0] != "product" || !called {
+		t.Errorf("Invalid partial result error %v", err)
+	}
+
+	called = false
+	err = c.GraphQL(ts.URL+"/graphql", "{ unknown }", nil, func(r *GraphQLResult) {
+		called = true
+	})
+	errs, ok = err.(GraphQLErrors)
+	if !ok || errs[0].Locations[0].Line != 1 || called {
+		t.Errorf("Invalid error of failed query %v", err)
+	}
+	if err.Error() != "GraphQL error: unknown query" {
+		t.Errorf("Invalid error message %q", err)
+	}
+}
+
+func TestGraphQLPersistedQuery(t *testing.T) {
+	var fullQueries int
+	ts := newGraphQLServer(&fullQueries)
+	defer ts.Close()
+
+	c := NewCollector()
+	for _, id := range []string{"1", "2", "3"} {
+		var name string
+		q := &GraphQLRequest{
+			Endpoint:  ts.URL + "/graphql",
+			Query:     productQuery,
+			Variables: map[string]interface{}{"id": id},
+			Persisted: true,
+		}
+		err := c.GraphQLRequest(q, func(r *GraphQLResult) {
+			d := &productData{}
+			r.Decode(d)
+			name = d.Product.Name
+		})
+		if err != nil || name != "product "+id {
+			t.Errorf("Invalid persisted query result %q %v", name, err)
+		}
+	}
+	if fullQueries != 1 {
+		t.Errorf("Query text was sent %d times", fullQueries)
+	}
+}
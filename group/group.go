@@ -0,0 +1,250 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package group assembles composite items from the parts extracted by
+// related requests, e.g. a product page, its reviews page and a price
+// API. An item is emitted once, when all of its parts have arrived or
+// when its timeout fires, in which case it is flagged as partial:
+//
+//	a := group.New(save, "product", "reviews")
+//	a.Timeout = time.Minute
+//	a.Attach(c)
+//	c.OnHTML(".product", func(e *colly.HTMLElement) {
+//		sku := e.Attr("data-sku")
+//		a.Add(sku, "product", e.ChildText("h1"))
+//		c.Request("GET", e.Request.AbsoluteURL(e.ChildAttr("a.reviews", "href")), nil, group.Context(sku, "reviews"), nil)
+//	})
+//	c.OnHTML("#reviews", func(e *colly.HTMLElement) {
+//		a.AddResponse(e.Response, e.Text)
+//	})
+package group
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Context keys of the item key and the part name of the requests
+const (
+	KeyKey  = "group_key"
+	PartKey = "group_part"
+)
+
+// Item is a composite item
+type Item struct {
+	// Key identifies the item
+	Key string
+	// Parts contains the values of the arrived parts by name
+	Parts map[string]interface{}
+	// Missing are the names of the parts which did not arrive
+	Missing []string
+	// Errors contains the errors of the failed parts by name
+	Errors map[string]error
+	// Partial is true if the item is incomplete
+	Partial bool
+	// Started is the arrival time of the first part
+	Started time.Time
+}
+
+type pending struct {
+	item  *Item
+	timer *time.Timer
+}
+
+// Assembler assembles the items from their parts
+type Assembler struct {
+	// Required are the names of the parts of every item
+	Required []string
+	// Timeout is the time after the first part of an item when the item
+	// is emitted without the missing parts. 0 means no timeout.
+	Timeout time.Duration
+	// OnItem is called with every emitted item
+	OnItem  func(*Item)
+	lock    sync.Mutex
+	pending map[string]*pending
+	emitted map[string]bool
+	wg      sync.WaitGroup
+}
+
+// New creates an Assembler of the items having the required parts
+func New(onItem func(*Item), required ...string) *Assembler {
+	return &Assembler{
+		Required: required,
+		OnItem:   onItem,
+		pending:  make(map[string]*pending),
+		emitted:  make(map[string]bool),
+	}
+}
+
+// Context creates a request Context of a part of an item, which is
+// used by AddResponse and by the error handler registered by Attach
+func Context(key, part string) *colly.Context {
+	ctx := colly.NewContext()
+	ctx.Put(KeyKey, key)
+	ctx.Put(PartKey, part)
+	return ctx
+}
+
+// Attach registers an error handler in the Collector, which marks the
+// parts of the failed requests having a Context created by Context as
+// failed, so their items are emitted without waiting for the timeout
+func (a *Assembler) Attach(c *colly.Collector) {
+	c.OnError(func(r *colly.Response, err error) {
+		if r.Ctx == nil {
+			return
+		}
+		if key, part := r.Ctx.Get(KeyKey), r.Ctx.Get(PartKey); key != "" && part != "" {
+			a.Fail(key, part, err)
+		}
+	})
+}
+
+// Add adds a part of the item of the key. Parts arriving after their
+// item was emitted are ignored.
+func (a *Assembler) Add(key, part string, value interface{}) {
+	a.update(key, func(item *Item) {
+		item.Parts[part] = value
+		delete(item.Errors, part)
+	})
+}
+
+// AddResponse adds a part of the item of the response, whose key and
+// part name are stored in its Context by Context
+func (a *Assembler) AddResponse(r *colly.Response, value interface{}) {
+	a.Add(r.Ctx.Get(KeyKey), r.Ctx.Get(PartKey), value)
+}
+
+// Fail marks a part of the item of the key as failed
+func (a *Assembler) Fail(key, part string, err error) {
+	a.update(key, func(item *Item) {
+		if _, ok := item.Parts[part]; !ok {
+			item.Errors[part] = err
+		}
+	})
+}
+
+// Flush emits every pending item as partial
+func (a *Assembler) Flush() {
+	a.lock.Lock()
+	items := make([]*Item, 0, len(a.pending))
+	for key, p := range a.pending {
+		if p.timer != nil && p.timer.Stop() {
+			a.wg.Done()
+		}
+		items = append(items, a.finish(key, p))
+	}
+	a.lock.Unlock()
+	for _, item := range items {
+		a.emit(item)
+	}
+}
+
+// Pending returns the number of the items waiting for parts
+func (a *Assembler) Pending() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.pending)
+}
+
+// Wait returns when the items emitted by timeouts have been handled
+func (a *Assembler) Wait() {
+	a.wg.Wait()
+}
+
+func (a *Assembler) update(key string, f func(*Item)) {
+	a.lock.Lock()
+	if a.pending == nil {
+		a.pending = make(map[string]*pending)
+		a.emitted = make(map[string]bool)
+	}
+	if a.emitted[key] {
+		a.lock.Unlock()
+		return
+	}
+	p, ok := a.pending[key]
+	if !ok {
+		p = &pending{item: &Item{
+			Key:     key,
+			Parts:   make(map[string]interface{}),
+			Errors:  make(map[string]error),
+			Started: time.Now(),
+		}}
+		a.pending[key] = p
+		if a.Timeout > 0 {
+			a.wg.Add(1)
+			p.timer = time.AfterFunc(a.Timeout, func() {
+				defer a.wg.Done()
+				a.expire(key, p)
+			})
+		}
+	}
+	f(p.item)
+	if !a.complete(p.item) {
+		a.lock.Unlock()
+		return
+	}
+	if p.timer != nil && p.timer.Stop() {
+		a.wg.Done()
+	}
+	item := a.finish(key, p)
+	a.lock.Unlock()
+	a.emit(item)
+}
+
+// expire emits the item of the timer if it is still pending
+func (a *Assembler) expire(key string, p *pending) {
+	a.lock.Lock()
+	if a.pending[key] != p {
+		a.lock.Unlock()
+		return
+	}
+	item := a.finish(key, p)
+	a.lock.Unlock()
+	a.emit(item)
+}
+
+// complete returns true if every required part arrived or failed
+func (a *Assembler) complete(item *Item) bool {
+	for _, part := range a.Required {
+		_, ok := item.Parts[part]
+		_, failed := item.Errors[part]
+		if !ok && !failed {
+			return false
+		}
+	}
+	return true
+}
+
+// finish removes the pending item and sets its missing parts.
+// a.lock must be held.
+func (a *Assembler) finish(key string, p *pending) *Item {
+	delete(a.pending, key)
+	a.emitted[key] = true
+	item := p.item
+	for _, part := range a.Required {
+		if _, ok := item.Parts[part]; !ok {
+			item.Missing = append(item.Missing, part)
+		}
+	}
+	item.Partial = len(item.Missing) > 0
+	return item
+}
+
+func (a *Assembler) emit(item *Item) {
+	if a.OnItem != nil {
+		a.OnItem(item)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package group
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+type collected struct {
+	lock  sync.Mutex
+	items []*Item
+}
+
+func (c *collected) add(item *Item) {
+	c.lock.Lock()
+	c.items = append(c.items, item)
+	c.lock.Unlock()
+}
+
+func TestAssembler(t *testing.T) {
+	items := &collected{}
+	a := New(items.add, "product", "reviews")
+	a.Add("1", "product", "p1")
+	a.Add("2", "reviews", "r2")
+	if len(items.items) != 0 || a.Pending() != 2 {
+		t.Fatal("Incomplete item was emitted")
+	}
+	a.Add("1", "reviews", "r1")
+	if len(items.items) != 1 || items.items[0].Partial {
+		t.Fatalf("Complete item was not emitted: %+v", items.items)
+	}
+	expected := map[string]interface{}{"product": "p1", "reviews": "r1"}
+	if !reflect.DeepEqual(items.items[0].Parts, expected) {
+		t.Errorf("Invalid parts %v", items.items[0].Parts)
+	}
+	// late parts are ignored
+	a.Add("1", "reviews", "late")
+	if len(items.items) != 1 || a.Pending() != 1 {
+		t.Error("Late part created a new item")
+	}
+
+	a.Fail("2", "product", errors.New("failed"))
+	if len(items.items) != 2 || !items.items[1].Partial || items.items[1].Errors["product"] == nil {
+		t.Errorf("Failed item was not emitted as partial: %+v", items.items)
+	}
+	if !reflect.DeepEqual(items.items[1].Missing, []string{"product"}) {
+		t.Errorf("Invalid missing parts %v", items.items[1].Missing)
+	}
+
+	a.Add("3", "product", "p3")
+	a.Flush()
+	if len(items.items) != 3 || !items.items[2].Partial || a.Pending() != 0 {
+		t.Error("Flush did not emit the pending item")
+	}
+}
+
+func TestAssemblerTimeout(t *testing.T) {
+	items := &collected{}
+	a := New(items.add, "product", "price")
+	a.Timeout = 50 * time.Millisecond
+	a.Add("1", "product", "p1")
+	a.Add("2", "product", "p2")
+	a.Add("2", "price", 10)
+	a.Wait()
+	items.lock.Lock()
+	defer items.lock.Unlock()
+	if len(items.items) != 2 {
+		t.Fatalf("Unexpected items %+v", items.items)
+	}
+	if items.items[0].Key != "2" || items.items[0].Partial {
+		t.Error("Complete item was not emitted first")
+	}
+	if items.items[1].Key != "1" || !items.items[1].Partial || items.items[1].Missing[0] != "price" {
+		t.Errorf("Timed out item was not flagged %+v", items.items[1])
+	}
+}
+
+func TestAttach(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/product/1", "/product/2":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<h1>product</h1>`))
+		case "/reviews/1":
+			w.Write([]byte(`5 stars`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	items := &collected{}
+	a := New(items.add, "product", "reviews")
+	c := colly.NewCollector()
+	a.Attach(c)
+	c.OnResponse(func(r *colly.Response) {
+		a.AddResponse(r, string(r.Body))
+	})
+	for _, id := range []string{"1", "2"} {
+		c.Request("GET", ts.URL+"/product/"+id, nil, Context(id, "product"), nil)
+		c.Request("GET", ts.URL+"/reviews/"+id, nil, Context(id, "reviews"), nil)
+	}
+	sort.Slice(items.items, func(i, j int) bool { return items.items[i].Key < items.items[j].Key })
+	if len(items.items) != 2 {
+		t.Fatalf("Unexpected items %+v", items.items)
+	}
+	if items.items[0].Partial || items.items[0].Parts["reviews"] != "5 stars" {
+		t.Errorf("Invalid complete item %+v", items.items[0])
+	}
+	if !items.items[1].Partial || items.items[1].Errors["reviews"] == nil {
+		t.Errorf("Invalid item with failed part %+v", items.items[1])
+	}
+}
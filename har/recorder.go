@@ -0,0 +1,243 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// timeFormat is the ISO 8601 format of HAR timestamps with fixed
+// millisecond precision, so entries can be sorted as strings
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Recorder records every HTTP round trip of a Collector as a HAR entry
+type Recorder struct {
+	// MaxBodySize limits the number of recorded bytes of request and
+	// response bodies. Set it to 0 to record complete bodies (default)
+	// or to a negative value to omit bodies.
+	MaxBodySize int
+	entries     []*Entry
+	lock        *sync.Mutex
+}
+
+// NewRecorder creates a Recorder and attaches it to the Collector.
+// Responses served from the Collector's CacheDir are not recorded.
+func NewRecorder(c *colly.Collector) *Recorder {
+	r := &Recorder{lock: &sync.Mutex{}}
+	c.OnHTTPExchange(r.record)
+	return r
+}
+
+// HAR returns the recorded entries as a HAR object
+func (r *Recorder) HAR() *HAR {
+	r.lock.Lock()
+	entries := make([]*Entry, len(r.entries))
+	copy(entries, r.entries)
+	r.lock.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime < entries[j].StartedDateTime
+	})
+	return &HAR{
+		Log: &Log{
+			Version: "1.2",
+			Creator: &Creator{Name: "colly", Version: "2"},
+			Entries: entries,
+		},
+	}
+}
+
+// Write writes the recorded HAR as JSON to w
+func (r *Recorder) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.HAR())
+}
+
+// Save writes the recorded HAR to a file
+func (r *Recorder) Save(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Reset removes the recorded entries
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	r.entries = nil
+	r.lock.Unlock()
+}
+
+func (r *Recorder) record(ex *colly.HTTPExchange) {
+	e := &Entry{
+		StartedDateTime: ex.Started.Format(timeFormat),
+		Time:            milliseconds(ex.Wait + ex.Receive),
+		Request:         r.request(ex.Request),
+		Response: &Response{
+			Status:      ex.StatusCode,
+			StatusText:  http.StatusText(ex.StatusCode),
+			HTTPVersion: ex.Proto,
+			Cookies:     []*Cookie{},
+			Headers:     headers(ex.Headers),
+			Content:     r.content(ex),
+			RedirectURL: ex.Headers.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: &Timings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Send:    0,
+			Wait:    milliseconds(ex.Wait),
+			Receive: milliseconds(ex.Receive),
+			SSL:     -1,
+		},
+	}
+	if ex.Err != nil {
+		e.Error = ex.Err.Error()
+	}
+	resp := &http.Response{Header: ex.Headers}
+	for _, c := range resp.Cookies() {
+		e.Response.Cookies = append(e.Response.Cookies, cookie(c))
+	}
+	r.lock.Lock()
+	r.entries = append(r.entries, e)
+	r.lock.Unlock()
+}
+
+func (r *Recorder) request(req *http.Request) *Request {
+	hr := &Request{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     []*Cookie{},
+		Headers:     headers(req.Header),
+		QueryString: []*NameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	for _, c := range req.Cookies() {
+		hr.Cookies = append(hr.Cookies, cookie(c))
+	}
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			hr.QueryString = append(hr.QueryString, &NameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(hr.QueryString, func(i, j int) bool {
+		return hr.QueryString[i].Name < hr.QueryString[j].Name
+	})
+	if req.GetBody == nil {
+		return hr
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return hr
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil || len(b) == 0 {
+		return hr
+	}
+	hr.BodySize = len(b)
+	if r.MaxBodySize >= 0 {
+		text, _ := r.bodyText(b)
+		hr.PostData = &PostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+		}
+	}
+	return hr
+}
+
+func (r *Recorder) content(ex *colly.HTTPExchange) *Content {
+	c := &Content{
+		Size:     len(ex.Body),
+		MimeType: ex.Headers.Get("Content-Type"),
+	}
+	if r.MaxBodySize < 0 || len(ex.Body) == 0 {
+		return c
+	}
+	text, truncated := r.bodyText(ex.Body)
+	if utf8.ValidString(text) {
+		c.Text = text
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString([]byte(text))
+		c.Encoding = "base64"
+	}
+	if truncated {
+		c.Comment = fmt.Sprintf("truncated to %d bytes", r.MaxBodySize)
+	}
+	return c
+}
+
+func (r *Recorder) bodyText(b []byte) (string, bool) {
+	if r.MaxBodySize > 0 && len(b) > r.MaxBodySize {
+		return string(b[:r.MaxBodySize]), true
+	}
+	return string(b), false
+}
+
+func headers(h http.Header) []*NameValue {
+	res := []*NameValue{}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			res = append(res, &NameValue{Name: k, Value: v})
+		}
+	}
+	return res
+}
+
+func cookie(c *http.Cookie) *Cookie {
+	hc := &Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		HTTPOnly: c.HttpOnly,
+		Secure:   c.Secure,
+	}
+	if !c.Expires.IsZero() {
+		hc.Expires = c.Expires.Format(time.RFC3339)
+	}
+	return hc
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestRecorder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "x"})
+		w.Write([]byte("hello world"))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	rec := NewRecorder(c)
+	rec.MaxBodySize = 5
+
+	c.Visit(ts.URL + "/?a=1")
+	c.Post(ts.URL+"/login", map[string]string{"name": "x"})
+
+	buf := &bytes.Buffer{}
+	if err := rec.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	h := &HAR{}
+	if err := json.Unmarshal(buf.Bytes(), h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Log.Version != "1.2" || len(h.Log.Entries) != 2 {
+		t.Fatalf("Invalid HAR log: %s", buf.String())
+	}
+	get, post := h.Log.Entries[0], h.Log.Entries[1]
+	if get.Request.Method != "GET" || len(get.Request.QueryString) != 1 || get.Response.Status != 200 {
+		t.Errorf("Invalid GET entry: %+v", get)
+	}
+	if get.Response.Content.Text != "hello" || get.Response.Content.Size != 11 {
+		t.Errorf("Invalid response content: %+v", get.Response.Content)
+	}
+	if len(get.Response.Cookies) != 1 || get.Response.Cookies[0].Name != "session" {
+		t.Errorf("Invalid response cookies: %+v", get.Response.Cookies)
+	}
+	if post.Request.PostData == nil || post.Request.PostData.Text != "name=" || post.Response.Status != 403 {
+		t.Errorf("Invalid POST entry: %+v", post.Request.PostData)
+	}
+}
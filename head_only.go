@@ -0,0 +1,171 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// headElements are the elements of the head section matched by the
+// selectors of head-only crawls
+var headElements = map[string]bool{
+	"head":  true,
+	"title": true,
+	"meta":  true,
+	"link":  true,
+	"base":  true,
+}
+
+type headOnlyKey struct{}
+
+// HeadOnlyParse downloads and parses HTML responses only up to the end
+// of their head section if every OnHTML callback selects title, meta,
+// link or base elements, e.g. "title" or `meta[property="og:title"]`,
+// and there are no OnXML callbacks. The bodies of such responses end
+// with the head section in the OnResponse callbacks too.
+func HeadOnlyParse() CollectorOption {
+	return func(c *Collector) {
+		c.HeadOnlyParse = true
+	}
+}
+
+// headOnly returns true if the callbacks only need the head section
+func (c *Collector) headOnly() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.xmlCallbacks) > 0 || len(c.htmlCallbacks) == 0 {
+		return false
+	}
+	for _, cc := range c.htmlCallbacks {
+		if !isHeadSelector(cc.Selector) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHeadSelector returns true if the CSS selector only matches elements
+// of the head section
+func isHeadSelector(selector string) bool {
+	for _, sel := range splitSelector(selector, ',') {
+		compounds := splitSelector(sel, ' ', '>', '+', '~')
+		if len(compounds) == 0 {
+			return false
+		}
+		for i, compound := range compounds {
+			tag := strings.ToLower(compound)
+			if j := strings.IndexAny(tag, "[.#:"); j >= 0 {
+				tag = tag[:j]
+			}
+			if i < len(compounds)-1 && (tag == "html" || tag == "head") {
+				continue
+			}
+			if i < len(compounds)-1 || !headElements[tag] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitSelector splits a selector at the separators outside of
+// brackets, parentheses and quotes and drops the empty parts
+func splitSelector(s string, separators ...byte) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '(':
+			depth++
+		case ch == ']' || ch == ')':
+			depth--
+		case depth == 0 && bytes.IndexByte(separators, ch) >= 0:
+			if p := strings.TrimSpace(s[start:i]); p != "" {
+				parts = append(parts, p)
+			}
+			start = i + 1
+		}
+	}
+	if p := strings.TrimSpace(s[start:]); p != "" {
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+func withHeadOnly(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), headOnlyKey{}, true))
+}
+
+func isHeadOnly(req *http.Request) bool {
+	headOnly, _ := req.Context().Value(headOnlyKey{}).(bool)
+	return headOnly
+}
+
+// headReader reads a HTML document until the end of its head section,
+// the </head> end tag or the <body> start tag. The document is
+// tokenized, so the tags in scripts, comments and attribute values do
+// not end the head section.
+type headReader struct {
+	r io.Reader
+	z *html.Tokenizer
+	// read are the bytes read by the tokenizer, but not returned yet
+	read bytes.Buffer
+	out  []byte
+	err  error
+}
+
+func (h *headReader) Read(p []byte) (int, error) {
+	if h.z == nil {
+		h.z = html.NewTokenizer(io.TeeReader(h.r, &h.read))
+	}
+	for len(h.out) == 0 && h.err == nil {
+		tt := h.z.Next()
+		if tt == html.ErrorToken {
+			h.out, h.err = h.read.Bytes(), h.z.Err()
+			break
+		}
+		raw := len(h.z.Raw())
+		name, _ := h.z.TagName()
+		switch {
+		case (tt == html.StartTagToken || tt == html.SelfClosingTagToken) && string(name) == "body":
+			h.err = io.EOF
+		case tt == html.EndTagToken && string(name) == "head":
+			h.out, h.err = h.read.Next(raw), io.EOF
+		default:
+			h.out = h.read.Next(raw)
+		}
+	}
+	n := copy(p, h.out)
+	h.out = h.out[n:]
+	if len(h.out) == 0 {
+		return n, h.err
+	}
+	return n, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestIsHeadSelector(t *testing.T) {
+	tests := map[string]bool{
+		"title":                              true,
+		"head > title":                       true,
+		"html head meta[name=description]":   true,
+		`meta[content="a, b > c"], link`:     true,
+		"link[rel=canonical]":                true,
+		"title, a[href]":                     false,
+		"body title":                         false,
+		".title":                             false,
+		"div":                                false,
+		`script[type="application/ld+json"]`: false,
+	}
+	for sel, expected := range tests {
+		if isHeadSelector(sel) != expected {
+			t.Errorf("isHeadSelector(%q) != %v", sel, expected)
+		}
+	}
+}
+
+func TestHeadReader(t *testing.T) {
+	tests := map[string]string{
+		"<html><HEAD><title>x</title></HEAD><body>text</body>": "<html><HEAD><title>x</title></HEAD>",
+		"<html><title>x</title><body class=a>text":             "<html><title>x</title>",
+		"<html><title>x</title>":                               "<html><title>x</title>",
+		`<html><head><script>var s = "</head><body>";</script><!-- </head> --><meta content="<body>"></head><p>`: `<html><head><script>var s = "</head><body>";</script><!-- </head> --><meta content="<body>"></head>`,
+	}
+	for doc, expected := range tests {
+		body, err := ioutil.ReadAll(&headReader{r: iotest.OneByteReader(strings.NewReader(doc))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("Expected %q, got %q", expected, body)
+		}
+	}
+}
+
+func TestHeadOnlyParse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Title</title></head><body>"))
+		w.Write([]byte(strings.Repeat("<p>text</p>", 10000)))
+		w.Write([]byte("</body></html>"))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(HeadOnlyParse(), AllowURLRevisit())
+	title := ""
+	c.OnHTML("title", func(e *HTMLElement) {
+		title = e.Text
+	})
+	size := 0
+	c.OnResponse(func(r *Response) {
+		size = len(r.Body)
+	})
+	c.Visit(ts.URL)
+	if title != "Title" || size != len("<html><head><title>Title</title></head>") {
+		t.Errorf("Unexpected head-only response: %q, %d bytes", title, size)
+	}
+
+	// the whole body is needed by body selectors
+	c.OnHTML("p", func(e *HTMLElement) {})
+	c.Visit(ts.URL)
+	if size < 10000 {
+		t.Errorf("Body was truncated: %d bytes", size)
+	}
+}
+
+func TestHeadOnlyParseWithCacheDir(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Title</title></head><body><p>text</p></body></html>"))
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "colly-head-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewCollector(HeadOnlyParse(), CacheDir(dir))
+	c.OnHTML("title", func(e *HTMLElement) {})
+	c.Visit(ts.URL)
+
+	c = NewCollector(CacheDir(dir))
+	text := ""
+	c.OnHTML("p", func(e *HTMLElement) {
+		text = e.Text
+	})
+	c.Visit(ts.URL)
+	if text != "text" {
+		t.Error("Truncated head-only response was cached")
+	}
+}
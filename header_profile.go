@@ -0,0 +1,342 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HeaderField is a request header of a HeaderProfile
+type HeaderField struct {
+	// Name is the header name as written on the wire
+	Name string
+	// Value is the default value of the header. Fields without value
+	// only define the position of the header if the request has it,
+	// e.g. Host, Cookie or Referer.
+	Value string
+}
+
+// HeaderProfile is the set of default request headers of a browser in
+// the order the browser sends them. Headers starting with "Sec-" (fetch
+// metadata and client hints) are only sent to HTTPS URLs like browsers
+// do. Headers already set on a request are not overridden.
+//
+// net/http writes headers in its own order, so the order of the profile
+// is only kept if the requests are sent by HeaderOrderTransport, which
+// UseHeaderProfile installs.
+type HeaderProfile struct {
+	// Name identifies the profile, e.g. "chrome-120"
+	Name string
+	// Headers are the headers of the profile in wire order
+	Headers []HeaderField
+}
+
+// HeaderProfiles contains the built-in header profiles
+var HeaderProfiles = map[string]*HeaderProfile{
+	"chrome-120": {
+		Name: "chrome-120",
+		Headers: []HeaderField{
+			{Name: "Host"},
+			{Name: "Connection", Value: "keep-alive"},
+			{Name: "Content-Length"},
+			{Name: "sec-ch-ua", Value: `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`},
+			{Name: "sec-ch-ua-mobile", Value: "?0"},
+			{Name: "sec-ch-ua-platform", Value: `"Windows"`},
+			{Name: "Upgrade-Insecure-Requests", Value: "1"},
+			{Name: "Origin"},
+			{Name: "Content-Type"},
+			{Name: "User-Agent", Value: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+			{Name: "Accept", Value: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{Name: "Sec-Fetch-Site", Value: "none"},
+			{Name: "Sec-Fetch-Mode", Value: "navigate"},
+			{Name: "Sec-Fetch-User", Value: "?1"},
+			{Name: "Sec-Fetch-Dest", Value: "document"},
+			{Name: "Referer"},
+			{Name: "Accept-Encoding", Value: "gzip, deflate, br"},
+			{Name: "Accept-Language", Value: "en-US,en;q=0.9"},
+			{Name: "Cookie"},
+		},
+	},
+	"firefox-esr": {
+		Name: "firefox-esr",
+		Headers: []HeaderField{
+			{Name: "Host"},
+			{Name: "User-Agent", Value: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Firefox/115.0"},
+			{Name: "Accept", Value: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{Name: "Accept-Language", Value: "en-US,en;q=0.5"},
+			{Name: "Accept-Encoding", Value: "gzip, deflate, br"},
+			{Name: "Content-Type"},
+			{Name: "Content-Length"},
+			{Name: "Origin"},
+			{Name: "Connection", Value: "keep-alive"},
+			{Name: "Referer"},
+			{Name: "Cookie"},
+			{Name: "Upgrade-Insecure-Requests", Value: "1"},
+			{Name: "Sec-Fetch-Dest", Value: "document"},
+			{Name: "Sec-Fetch-Mode", Value: "navigate"},
+			{Name: "Sec-Fetch-Site", Value: "none"},
+			{Name: "Sec-Fetch-User", Value: "?1"},
+		},
+	},
+}
+
+type headerProfileKey struct{}
+
+// UserAgent returns the User-Agent header of the profile
+func (p *HeaderProfile) UserAgent() string {
+	for _, f := range p.Headers {
+		if strings.EqualFold(f.Name, "User-Agent") {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// apply sets the missing headers of the profile on the request.
+// The User-Agent is replaced if it is the default User-Agent.
+func (p *HeaderProfile) apply(req *http.Request, defaultUserAgent string) {
+	secure := req.URL.Scheme == "https"
+	for _, f := range p.Headers {
+		if f.Value == "" {
+			continue
+		}
+		if !secure && strings.HasPrefix(strings.ToLower(f.Name), "sec-") {
+			continue
+		}
+		k := http.CanonicalHeaderKey(f.Name)
+		if k == "User-Agent" && req.Header.Get(k) == defaultUserAgent {
+			req.Header.Set(k, f.Value)
+			continue
+		}
+		if _, ok := req.Header[k]; !ok {
+			req.Header.Set(k, f.Value)
+		}
+	}
+}
+
+// UseHeaderProfile sets the default headers of every request to the
+// headers of the profile and installs a HeaderOrderTransport wrapping
+// the current transport of the Collector to keep the header order
+func UseHeaderProfile(p *HeaderProfile) CollectorOption {
+	return func(c *Collector) {
+		c.SetHeaderProfile(p)
+	}
+}
+
+// SetHeaderProfile sets the default headers of every request to the
+// headers of the profile and installs a HeaderOrderTransport wrapping
+// the current transport of the Collector to keep the header order.
+// The profile can be overridden per request by Request.HeaderProfile.
+func (c *Collector) SetHeaderProfile(p *HeaderProfile) {
+	c.HeaderProfile = p
+	if p == nil {
+		return
+	}
+	if ua := p.UserAgent(); ua != "" {
+		c.UserAgent = ua
+	}
+	if _, ok := c.backend.Client.Transport.(*HeaderOrderTransport); !ok {
+		c.backend.Client.Transport = &HeaderOrderTransport{Transport: c.backend.Client.Transport}
+	}
+}
+
+// HeaderOrderTransport is a http.RoundTripper sending the requests
+// having a HeaderProfile over HTTP/1.1 with the headers in the order of
+// the profile. The headers which are not part of the profile follow in
+// alphabetical order. Other requests are passed to Transport.
+//
+// HeaderOrderTransport uses a new connection for every request and
+// it does not support proxies.
+type HeaderOrderTransport struct {
+	// Transport handles the requests without HeaderProfile.
+	// http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+	// TLSClientConfig is the TLS configuration of HTTPS connections
+	TLSClientConfig *tls.Config
+	// Dialer opens the connections. A zero net.Dialer is used if it is nil.
+	Dialer *net.Dialer
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *HeaderOrderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, ok := req.Context().Value(headerProfileKey{}).(*HeaderProfile)
+	if !ok || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		transport := t.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		return transport.RoundTrip(req)
+	}
+	// headers are written as is, so line breaks must be rejected
+	if err := checkHeaders(req.Header); err != nil {
+		return nil, err
+	}
+	if !validHeaderValue(req.Host) || strings.ContainsAny(req.Host, " \t") {
+		return nil, &HeaderError{Name: "Host", Reason: "invalid host"}
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn, err := t.dial(req)
+	if err != nil {
+		return nil, err
+	}
+	// the connection is closed if the request is canceled
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-req.Context().Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	once := sync.Once{}
+	closeConn := func() {
+		once.Do(func() {
+			conn.Close()
+			close(done)
+		})
+	}
+	w := bufio.NewWriter(conn)
+	writeOrderedRequest(w, req, p, body)
+	if err := w.Flush(); err != nil {
+		closeConn()
+		return nil, err
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		closeConn()
+		return nil, err
+	}
+	res.Body = &connBody{ReadCloser: res.Body, close: closeConn}
+	return res, nil
+}
+
+func (t *HeaderOrderTransport) dial(req *http.Request) (net.Conn, error) {
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(req.Context(), "tcp", net.JoinHostPort(host, port))
+	if err != nil || req.URL.Scheme != "https" {
+		return conn, err
+	}
+	cfg := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		cfg = t.TLSClientConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	cfg.NextProtos = []string{"http/1.1"}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// writeOrderedRequest writes a HTTP/1.1 request with the headers in the
+// order of the profile
+func writeOrderedRequest(w io.Writer, req *http.Request, p *HeaderProfile, body []byte) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	written := make(map[string]bool)
+	write := func(name string) {
+		k := http.CanonicalHeaderKey(name)
+		if written[k] {
+			return
+		}
+		written[k] = true
+		switch k {
+		case "Host":
+			fmt.Fprintf(w, "%s: %s\r\n", name, host)
+		case "Content-Length":
+			if len(body) > 0 || (req.Method != "GET" && req.Method != "HEAD") {
+				fmt.Fprintf(w, "%s: %d\r\n", name, len(body))
+			}
+		default:
+			for _, v := range req.Header[k] {
+				fmt.Fprintf(w, "%s: %s\r\n", name, v)
+			}
+		}
+	}
+	hasHost := false
+	for _, f := range p.Headers {
+		if http.CanonicalHeaderKey(f.Name) == "Host" {
+			hasHost = true
+		}
+	}
+	if !hasHost {
+		write("Host")
+	}
+	for _, f := range p.Headers {
+		write(f.Name)
+	}
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write(k)
+	}
+	write("Content-Length")
+	io.WriteString(w, "\r\n")
+	w.Write(body)
+}
+
+// connBody closes the connection of a response with its body
+type connBody struct {
+	io.ReadCloser
+	close func()
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.close()
+	return err
+}
+
+func withHeaderProfile(req *http.Request, p *HeaderProfile) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), headerProfileKey{}, p))
+}
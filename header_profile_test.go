@@ -0,0 +1,118 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newRawServer starts a HTTP server recording the header lines of the
+// requests in wire order
+func newRawServer(t *testing.T, body []byte, headers string) (net.Listener, chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := make(chan []string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := textproto.NewReader(bufio.NewReader(conn))
+			r.ReadLine()
+			var names []string
+			for {
+				line, err := r.ReadLine()
+				if err != nil || line == "" {
+					break
+				}
+				names = append(names, line[:strings.Index(line, ":")])
+			}
+			requests <- names
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n%s\r\n", len(body), headers)
+			conn.Write(body)
+			conn.Close()
+		}
+	}()
+	return l, requests
+}
+
+func TestHeaderProfile(t *testing.T) {
+	l, requests := newRawServer(t, []byte("ok"), "")
+	defer l.Close()
+	u := "http://" + l.Addr().String() + "/"
+
+	c := NewCollector(UseHeaderProfile(HeaderProfiles["chrome-120"]), AllowURLRevisit())
+	if c.UserAgent != HeaderProfiles["chrome-120"].UserAgent() {
+		t.Errorf("Invalid User-Agent %q", c.UserAgent)
+	}
+	if err := c.Visit(u); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Host", "Connection", "Upgrade-Insecure-Requests", "User-Agent", "Accept", "Accept-Encoding", "Accept-Language"}
+	if names := <-requests; !reflect.DeepEqual(names, want) {
+		t.Errorf("Invalid header order %v, want %v", names, want)
+	}
+
+	c.OnRequest(func(r *Request) {
+		r.HeaderProfile = HeaderProfiles["firefox-esr"]
+		r.Headers.Set("X-Custom", "1")
+	})
+	var ua string
+	c.OnResponse(func(r *Response) {
+		ua = r.Request.Headers.Get("User-Agent")
+	})
+	if err := c.Visit(u); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Connection", "Upgrade-Insecure-Requests", "X-Custom"}
+	if names := <-requests; !reflect.DeepEqual(names, want) {
+		t.Errorf("Invalid header order %v, want %v", names, want)
+	}
+	if ua != HeaderProfiles["firefox-esr"].UserAgent() {
+		t.Errorf("Invalid User-Agent of request profile %q", ua)
+	}
+}
+
+func TestDeflateResponse(t *testing.T) {
+	body := &bytes.Buffer{}
+	w := zlib.NewWriter(body)
+	w.Write([]byte("deflated"))
+	w.Close()
+	l, _ := newRawServer(t, body.Bytes(), "Content-Encoding: deflate\r\n")
+	defer l.Close()
+
+	c := NewCollector()
+	var got string
+	c.OnResponse(func(r *Response) {
+		got = string(r.Body)
+	})
+	if err := c.Visit("http://" + l.Addr().String() + "/"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "deflated" {
+		t.Errorf("Invalid body %q", got)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostHealthAlpha is the weight of the latest round trip in the moving
+// averages of HostHealth
+const hostHealthAlpha = 0.2
+
+// HostHealth contains the exponentially weighted moving averages of the
+// latency and the error rate of the round trips to a host. The latest
+// round trip has 0.2 weight. Clones of a Collector share the health of
+// the hosts, so the LimitRules, the prioritization of the requests and
+// the monitoring of a crawl can adapt to the same signal.
+type HostHealth struct {
+	// Host is the host name without port
+	Host string
+	// Latency is the average time of the round trips which received a
+	// response
+	Latency time.Duration
+	// ErrorRate is the average ratio (0-1) of the failed round trips,
+	// i.e. network errors and responses with status code 429 or 5xx
+	ErrorRate float64
+	// Samples is the number of the round trips
+	Samples int
+	// Updated is the time of the last round trip
+	Updated time.Time
+}
+
+// hostHealth tracks the health of the hosts of a backend
+type hostHealth struct {
+	lock  sync.RWMutex
+	hosts map[string]*HostHealth
+}
+
+// HostHealth returns the health of the host. Samples is 0 if the host
+// has not been requested yet.
+func (c *Collector) HostHealth(host string) HostHealth {
+	return c.backend.health.get(host)
+}
+
+// record adds a round trip to the health of the host. res is nil if the
+// round trip failed. Round trips aborted by OnResponseHeaders callbacks
+// are not recorded.
+func (h *hostHealth) record(host string, res *Response, err error, latency time.Duration) {
+	if err == ErrAbortedAfterHeaders {
+		return
+	}
+	host = healthHost(host)
+	failed := 0.0
+	if err != nil || res == nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		failed = 1
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.hosts == nil {
+		h.hosts = make(map[string]*HostHealth)
+	}
+	s, ok := h.hosts[host]
+	if !ok {
+		s = &HostHealth{Host: host, ErrorRate: failed}
+		h.hosts[host] = s
+	} else {
+		s.ErrorRate += hostHealthAlpha * (failed - s.ErrorRate)
+	}
+	if res != nil {
+		if s.Latency == 0 {
+			s.Latency = latency
+		} else {
+			s.Latency += time.Duration(hostHealthAlpha * float64(latency-s.Latency))
+		}
+	}
+	s.Samples++
+	s.Updated = time.Now()
+}
+
+func (h *hostHealth) get(host string) HostHealth {
+	host = healthHost(host)
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if s, ok := h.hosts[host]; ok {
+		return *s
+	}
+	return HostHealth{Host: host}
+}
+
+func (h *hostHealth) snapshot() map[string]HostHealth {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	hosts := make(map[string]HostHealth, len(h.hosts))
+	for host, s := range h.hosts {
+		hosts[host] = *s
+	}
+	return hosts
+}
+
+// healthHost returns the lowercase host name without port
+func healthHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostHealthAverages(t *testing.T) {
+	h := &hostHealth{}
+	ok := &Response{StatusCode: 200}
+	h.record("Example.com:8080", ok, nil, 100*time.Millisecond)
+	h.record("example.com", ok, nil, 200*time.Millisecond)
+	h.record("example.com", &Response{StatusCode: 503}, nil, 100*time.Millisecond)
+	h.record("example.com", nil, errors.New("connection refused"), time.Second)
+	h.record("example.com", nil, ErrAbortedAfterHeaders, time.Second)
+
+	s := h.get("EXAMPLE.COM:80")
+	if s.Host != "example.com" || s.Samples != 4 {
+		t.Fatalf("Invalid health: %+v", s)
+	}
+	// 100ms, then 100 + 0.2*100 = 120ms, then 120 + 0.2*(100-120) = 116ms
+	if s.Latency != 116*time.Millisecond {
+		t.Errorf("Invalid latency: %v", s.Latency)
+	}
+	// 0, 0, 0.2, 0.2 + 0.2*0.8 = 0.36
+	if math.Abs(s.ErrorRate-0.36) > 1e-9 {
+		t.Errorf("Invalid error rate: %v", s.ErrorRate)
+	}
+	if s.Updated.IsZero() {
+		t.Error("Updated was not set")
+	}
+	if s := h.get("other.com"); s.Samples != 0 || s.Host != "other.com" {
+		t.Errorf("Invalid health of an unknown host: %+v", s)
+	}
+}
+
+func TestHostHealth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var lock sync.Mutex
+	var seen []HostHealth
+	c := NewCollector()
+	c.Limit(&LimitRule{
+		DomainGlob: "*",
+		DelayFunc: func(h HostHealth) time.Duration {
+			lock.Lock()
+			seen = append(seen, h)
+			lock.Unlock()
+			return time.Duration(h.ErrorRate * float64(10*time.Millisecond))
+		},
+	})
+	c.Visit(ts.URL + "/")
+	c.Clone().Visit(ts.URL + "/fail")
+
+	h := c.HostHealth("127.0.0.1")
+	if h.Samples != 2 || h.Latency < 15*time.Millisecond || math.Abs(h.ErrorRate-0.2) > 1e-9 {
+		t.Errorf("Invalid health: %+v", h)
+	}
+	if st := c.Stats(); st.Hosts["127.0.0.1"] != h {
+		t.Errorf("Invalid health in stats: %+v", st.Hosts)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	// the delay is computed from the health including the last round trip
+	if len(seen) != 2 || seen[0].Samples != 1 || seen[1].Samples != 2 {
+		t.Errorf("Invalid health passed to DelayFunc: %+v", seen)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Alternate is a language variant of a page annotated by a
+// <link rel="alternate" hreflang="..."> tag or a Link header
+type Alternate struct {
+	// Lang is the language code of the variant, e.g. "en-GB", or
+	// "x-default" for the page of the unmatched languages
+	Lang string
+	// URL is the absolute URL of the variant
+	URL string
+}
+
+// Languages restricts the followed URLs to the language variants of
+// the languages, e.g. Languages("de", "fr-CA"). A language matches its
+// regional variants too, e.g. "en" matches "en-GB". The language of a
+// URL is known from the hreflang annotations of the visited pages,
+// URLs of unknown language are followed.
+func Languages(langs ...string) CollectorOption {
+	return func(c *Collector) {
+		c.Languages = langs
+	}
+}
+
+// FollowAlternates visits the language variants of every visited page.
+// Set MaxDepth if AllowURLRevisit is enabled, because the variants link
+// each other.
+func FollowAlternates() CollectorOption {
+	return func(c *Collector) {
+		c.FollowAlternates = true
+	}
+}
+
+// urlLanguages contains the languages of the URLs learned from the
+// hreflang annotations
+type urlLanguages struct {
+	lock  sync.RWMutex
+	langs map[string]string
+}
+
+func (l *urlLanguages) add(alternates []Alternate) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.langs == nil {
+		l.langs = make(map[string]string)
+	}
+	for _, a := range alternates {
+		if !strings.EqualFold(a.Lang, "x-default") {
+			l.langs[a.URL] = a.Lang
+		}
+	}
+}
+
+func (l *urlLanguages) get(u string) (string, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	lang, ok := l.langs[u]
+	return lang, ok
+}
+
+// languageAllowed returns true if the language of the URL is unknown or
+// allowed by Languages
+func (c *Collector) languageAllowed(u string) bool {
+	if len(c.Languages) == 0 {
+		return true
+	}
+	lang, ok := c.urlLanguages.get(u)
+	if !ok {
+		return true
+	}
+	return matchLanguage(c.Languages, lang)
+}
+
+// matchLanguage returns true if lang is one of the languages or their
+// regional variant
+func matchLanguage(langs []string, lang string) bool {
+	lang = strings.ToLower(strings.Replace(lang, "_", "-", -1))
+	for _, l := range langs {
+		l = strings.ToLower(strings.Replace(l, "_", "-", -1))
+		if lang == l || strings.HasPrefix(lang, l+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAlternates collects the hreflang annotations of the Link headers
+// and of the head section of HTML responses
+func parseAlternates(r *Response) []Alternate {
+	var alternates []Alternate
+	add := func(rel, lang, href string) {
+		if lang == "" || href == "" || !hasRel(rel, "alternate") {
+			return
+		}
+		if u := r.Request.AbsoluteURL(href); u != "" {
+			alternates = append(alternates, Alternate{Lang: strings.TrimSpace(lang), URL: u})
+		}
+	}
+	if r.Headers != nil {
+		for _, h := range (*r.Headers)["Link"] {
+			for _, l := range parseLinkHeader(h) {
+				add(l.params["rel"], l.params["hreflang"], l.url)
+			}
+		}
+		if !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+			return alternates
+		}
+	}
+	z := html.NewTokenizer(bytes.NewReader(r.Body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return alternates
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return alternates
+			case "link":
+				var rel, lang, href string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "rel":
+						rel = string(v)
+					case "hreflang":
+						lang = string(v)
+					case "href":
+						href = strings.TrimSpace(string(v))
+					}
+				}
+				add(rel, lang, href)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				return alternates
+			}
+		}
+	}
+}
+
+func hasRel(rel, value string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type linkValue struct {
+	url    string
+	params map[string]string
+}
+
+// parseLinkHeader parses the links of a Link header (RFC 8288)
+func parseLinkHeader(h string) []linkValue {
+	var links []linkValue
+	for {
+		start := strings.IndexByte(h, '<')
+		if start < 0 {
+			return links
+		}
+		end := strings.IndexByte(h[start:], '>')
+		if end < 0 {
+			return links
+		}
+		l := linkValue{url: h[start+1 : start+end], params: make(map[string]string)}
+		h = h[start+end+1:]
+		// the parameters end at the comma before the next link
+		for {
+			h = strings.TrimLeft(h, " \t")
+			if !strings.HasPrefix(h, ";") {
+				break
+			}
+			h = strings.TrimLeft(h[1:], " \t")
+			i := strings.IndexAny(h, "=;,")
+			if i < 0 {
+				l.params[strings.ToLower(strings.TrimSpace(h))] = ""
+				h = ""
+				break
+			}
+			key := strings.ToLower(strings.TrimSpace(h[:i]))
+			if h[i] != '=' {
+				l.params[key] = ""
+				h = h[i:]
+				continue
+			}
+			h = strings.TrimLeft(h[i+1:], " \t")
+			var value string
+			if strings.HasPrefix(h, `"`) {
+				j := strings.IndexByte(h[1:], '"')
+				if j < 0 {
+					j = len(h) - 1
+				}
+				value = h[1 : j+1]
+				h = h[j+1:]
+				if len(h) > 0 {
+					h = h[1:]
+				}
+			} else {
+				j := strings.IndexAny(h, ";,")
+				if j < 0 {
+					j = len(h)
+				}
+				value = strings.TrimSpace(h[:j])
+				h = h[j:]
+			}
+			l.params[key] = value
+		}
+		links = append(links, l)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const hreflangHead = `<html><head>
+<link rel="alternate" hreflang="en" href="/en/">
+<link rel="alternate" hreflang="de-AT" href="/de-at/">
+<link rel="alternate" hreflang="fr" href="/fr/">
+<link rel="alternate" hreflang="x-default" href="/">
+<link rel="stylesheet" href="/style.css">
+</head><body><link rel="alternate" hreflang="es" href="/es/"></body></html>`
+
+func newHreflangServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/doc.pdf" {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Add("Link", `</en/doc.pdf>; rel="alternate"; hreflang="en", </de/doc.pdf>; rel=alternate; hreflang=de`)
+			w.Write([]byte("%PDF"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(hreflangHead))
+	}))
+}
+
+func TestParseAlternates(t *testing.T) {
+	ts := newHreflangServer()
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit(), DetectLanguage())
+	var alternates []Alternate
+	c.OnResponse(func(r *Response) {
+		alternates = r.Alternates
+	})
+	c.Visit(ts.URL + "/en/")
+	expected := []Alternate{
+		{"en", ts.URL + "/en/"},
+		{"de-AT", ts.URL + "/de-at/"},
+		{"fr", ts.URL + "/fr/"},
+		{"x-default", ts.URL + "/"},
+	}
+	if !reflect.DeepEqual(alternates, expected) {
+		t.Errorf("Unexpected alternates: %v", alternates)
+	}
+	c.Visit(ts.URL + "/doc.pdf")
+	expected = []Alternate{
+		{"en", ts.URL + "/en/doc.pdf"},
+		{"de", ts.URL + "/de/doc.pdf"},
+	}
+	if !reflect.DeepEqual(alternates, expected) {
+		t.Errorf("Unexpected Link header alternates: %v", alternates)
+	}
+
+	// the alternates are not parsed if they are not used
+	c = NewCollector()
+	c.OnResponse(func(r *Response) {
+		alternates = r.Alternates
+	})
+	c.Visit(ts.URL + "/en/")
+	if alternates != nil {
+		t.Errorf("Alternates were parsed: %v", alternates)
+	}
+}
+
+func TestFollowAlternates(t *testing.T) {
+	ts := newHreflangServer()
+	defer ts.Close()
+
+	c := NewCollector(FollowAlternates(), Languages("en", "de"))
+	var visited []string
+	c.OnResponse(func(r *Response) {
+		visited = append(visited, r.Request.URL.Path)
+	})
+	c.Visit(ts.URL + "/en/")
+	sort.Strings(visited)
+	// x-default has no language, so it is followed
+	expected := []string{"/", "/de-at/", "/en/"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Unexpected visited pages: %v", visited)
+	}
+	if err := c.Visit(ts.URL + "/fr/"); err != ErrForbiddenLanguage {
+		t.Errorf("Expected ErrForbiddenLanguage, got %v", err)
+	}
+}
@@ -15,13 +15,16 @@
 package colly
 
 import (
+	"bufio"
 	"crypto/sha1"
 	"encoding/gob"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -29,22 +32,75 @@ import (
 	"sync"
 	"time"
 
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gobwas/glob"
+	"github.com/klauspost/compress/zstd"
 )
 
+// acceptEncoding is sent if a request has no Accept-Encoding header.
+// These content encodings are decoded by the backend.
+const acceptEncoding = "gzip, br, zstd"
+
 type httpBackend struct {
-	LimitRules []*LimitRule
-	Client     *http.Client
-	lock       *sync.RWMutex
+	LimitRules     []*LimitRule
+	Client         *http.Client
+	lock           *sync.RWMutex
+	exchangeHooks  []HTTPExchangeCallback
+	frontier       *frontier
+	schemes        map[string]SchemeHandler
+	auths          map[string]Auth
+	tlsProfiles    map[string]*TLSProfile
+	tlsTransports  map[tlsTransportKey]http.RoundTripper
+	signers        map[string]RequestSigner
+	fetchers       map[string]Fetcher
+	timeouts       Timeouts
+	health         *hostHealth
+	bandwidth      *bandwidthLimiter
+	hostBandwidths map[queueKey]*bandwidthLimiter
 }
 
 type checkHeadersFunc func(req *http.Request, statusCode int, header http.Header) bool
 
+// HTTPExchange contains the details of a request-response round trip
+// performed by the HTTP backend. Responses served from CacheDir are
+// not network round trips, so no HTTPExchange is created for them.
+type HTTPExchange struct {
+	// Request is the HTTP request which was sent. In case of redirects
+	// it is the request of the last hop.
+	Request *http.Request
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Proto is the protocol of the response, e.g. "HTTP/1.1"
+	Proto string
+	// Headers contains the response headers
+	Headers http.Header
+	// Body is the (decompressed) response body. Body is limited by
+	// MaxBodySize and it is nil if the transfer was aborted.
+	Body []byte
+	// Started is the time when the request was sent
+	Started time.Time
+	// Wait is the time elapsed until the response headers were received
+	Wait time.Duration
+	// Receive is the time spent on reading the response body
+	Receive time.Duration
+	// Err is the error of the round trip if any
+	Err error
+}
+
+// HTTPExchangeCallback is a type alias for OnHTTPExchange callback functions
+type HTTPExchangeCallback func(*HTTPExchange)
+
 // LimitRule provides connection restrictions for domains.
 // Both DomainRegexp and DomainGlob can be used to specify
-// the included domains patterns, but at least one is required.
+// the included domains patterns. URLRegexp and PathPrefix restrict the
+// rule to some URLs of the domains, e.g. to throttle the search pages
+// harder than the static assets. At least one pattern is required.
+// The limits of a rule are shared by all the matching hosts unless the
+// rule is PerHost.
 // There can be two kind of limitations:
 //  - Parallelism: Set limit for the number of concurrent requests to matching domains
 //  - Delay: Wait specified amount of time between requests (parallelism is 1 in this case)
@@ -53,24 +109,46 @@ type LimitRule struct {
 	DomainRegexp string
 	// DomainGlob is a glob pattern to match against domains
 	DomainGlob string
+	// URLRegexp is a regular expression to match against the full URLs
+	URLRegexp string
+	// PathPrefix is a prefix to match against the paths of the URLs
+	PathPrefix string
+	// Priority orders the rules matching a request. The rule with the
+	// highest Priority is applied, rules of the same Priority are
+	// applied in the order of their registration.
+	Priority int
 	// Delay is the duration to wait before creating a new request to the matching domains
 	Delay time.Duration
 	// RandomDelay is the extra randomized duration to wait added to Delay before creating a new request
 	RandomDelay time.Duration
 	// Parallelism is the number of the maximum allowed concurrent requests of the matching domains
-	Parallelism    int
-	waitChan       chan bool
-	compiledRegexp *regexp.Regexp
-	compiledGlob   glob.Glob
+	Parallelism int
+	// PerHost applies Parallelism and Delay to every matching host
+	// separately instead of to all the matching hosts together, so the
+	// requests of different hosts proceed in parallel
+	PerHost bool
+	// Schedule restricts the requests of the matching domains to time windows
+	Schedule *CrawlSchedule
+	// DelayFunc computes the delay of the requests of a matching host
+	// from its health, e.g. to back off from slow or failing hosts. It
+	// replaces Delay if set. RandomDelay is added to its result.
+	DelayFunc func(h HostHealth) time.Duration
+	// Bandwidth limits the download speed of every matching host in
+	// bytes per second. The concurrent responses of a host share its
+	// bandwidth.
+	Bandwidth int
+	// Weight is the share of the MaxConcurrency of the Collector
+	// assigned to the requests of the rule relative to the other rules,
+	// e.g. 7 and 3 to split the concurrency 70% to 30%. Requests
+	// without LimitRule have the weight 1. 0 means 1.
+	Weight            int
+	compiledRegexp    *regexp.Regexp
+	compiledGlob      glob.Glob
+	compiledURLRegexp *regexp.Regexp
 }
 
 // Init initializes the private members of LimitRule
 func (r *LimitRule) Init() error {
-	waitChanSize := 1
-	if r.Parallelism > 1 {
-		waitChanSize = r.Parallelism
-	}
-	r.waitChan = make(chan bool, waitChanSize)
 	hasPattern := false
 	if r.DomainRegexp != "" {
 		c, err := regexp.Compile(r.DomainRegexp)
@@ -88,6 +166,17 @@ func (r *LimitRule) Init() error {
 		r.compiledGlob = c
 		hasPattern = true
 	}
+	if r.URLRegexp != "" {
+		c, err := regexp.Compile(r.URLRegexp)
+		if err != nil {
+			return err
+		}
+		r.compiledURLRegexp = c
+		hasPattern = true
+	}
+	if r.PathPrefix != "" {
+		hasPattern = true
+	}
 	if !hasPattern {
 		return ErrNoPattern
 	}
@@ -101,10 +190,32 @@ func (h *httpBackend) Init(jar http.CookieJar) {
 		Timeout: 10 * time.Second,
 	}
 	h.lock = &sync.RWMutex{}
+	h.frontier = newFrontier(h)
+	h.health = &hostHealth{}
+}
+
+// parallelism returns the number of concurrent requests allowed by the rule
+func (r *LimitRule) parallelism() int {
+	if r.Parallelism > 1 {
+		return r.Parallelism
+	}
+	return 1
 }
 
-// Match checks that the domain parameter triggers the rule
+// weight returns the share of the global concurrency of the rule
+func (r *LimitRule) weight() int {
+	if r != nil && r.Weight > 1 {
+		return r.Weight
+	}
+	return 1
+}
+
+// Match checks that the domain parameter triggers the rule. Rules
+// without domain patterns match every domain if they have URL patterns.
 func (r *LimitRule) Match(domain string) bool {
+	if r.DomainRegexp == "" && r.DomainGlob == "" {
+		return r.hasURLPattern()
+	}
 	match := false
 	if r.compiledRegexp != nil && r.compiledRegexp.MatchString(domain) {
 		match = true
@@ -115,23 +226,54 @@ func (r *LimitRule) Match(domain string) bool {
 	return match
 }
 
-func (h *httpBackend) GetMatchingRule(domain string) *LimitRule {
-	if h.LimitRules == nil {
-		return nil
+// MatchURL checks that the URL triggers the rule: its host matches the
+// domain patterns, and the URL matches URLRegexp and PathPrefix
+func (r *LimitRule) MatchURL(u *url.URL) bool {
+	if !r.Match(u.Host) {
+		return false
 	}
+	if r.URLRegexp != "" && (r.compiledURLRegexp == nil || !r.compiledURLRegexp.MatchString(u.String())) {
+		return false
+	}
+	return r.PathPrefix == "" || strings.HasPrefix(u.Path, r.PathPrefix)
+}
+
+func (r *LimitRule) hasURLPattern() bool {
+	return r.URLRegexp != "" || r.PathPrefix != ""
+}
+
+// GetMatchingRule returns the rule of the highest priority matching the
+// domain. The rules with URL patterns are not returned.
+func (h *httpBackend) GetMatchingRule(domain string) *LimitRule {
+	return h.matchingRule(func(r *LimitRule) bool {
+		return !r.hasURLPattern() && r.Match(domain)
+	})
+}
+
+// matchingURLRule returns the rule of the highest priority matching the
+// URL
+func (h *httpBackend) matchingURLRule(u *url.URL) *LimitRule {
+	return h.matchingRule(func(r *LimitRule) bool {
+		return r.MatchURL(u)
+	})
+}
+
+func (h *httpBackend) matchingRule(match func(r *LimitRule) bool) *LimitRule {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
+	var rule *LimitRule
 	for _, r := range h.LimitRules {
-		if r.Match(domain) {
-			return r
+		if (rule == nil || r.Priority > rule.Priority) && match(r) {
+			rule = r
 		}
 	}
-	return nil
+	return rule
 }
 
-func (h *httpBackend) Cache(request *http.Request, bodySize int, checkHeadersFunc checkHeadersFunc, cacheDir string) (*Response, error) {
-	if cacheDir == "" || request.Method != "GET" || request.Header.Get("Cache-Control") == "no-cache" {
-		return h.Do(request, bodySize, checkHeadersFunc)
+func (h *httpBackend) Cache(request *http.Request, bodySize, resumeAttempts int, checkHeadersFunc checkHeadersFunc, cacheDir string) (*Response, error) {
+	// the truncated bodies of head-only requests are not cached
+	if cacheDir == "" || isHeadOnly(request) || request.Method != "GET" || request.Header.Get("Cache-Control") == "no-cache" || request.Header.Get("Range") != "" {
+		return h.Do(request, bodySize, resumeAttempts, checkHeadersFunc)
 	}
 	sum := sha1.Sum([]byte(request.URL.String()))
 	hash := hex.EncodeToString(sum[:])
@@ -146,7 +288,7 @@ func (h *httpBackend) Cache(request *http.Request, bodySize int, checkHeadersFun
 			return resp, err
 		}
 	}
-	resp, err := h.Do(request, bodySize, checkHeadersFunc)
+	resp, err := h.Do(request, bodySize, resumeAttempts, checkHeadersFunc)
 	if err != nil || resp.StatusCode >= 500 {
 		return resp, err
 	}
@@ -167,27 +309,71 @@ func (h *httpBackend) Cache(request *http.Request, bodySize int, checkHeadersFun
 	return resp, os.Rename(filename+"~", filename)
 }
 
-func (h *httpBackend) Do(request *http.Request, bodySize int, checkHeadersFunc checkHeadersFunc) (*Response, error) {
-	r := h.GetMatchingRule(request.URL.Host)
-	if r != nil {
-		r.waitChan <- true
-		defer func(r *LimitRule) {
-			randomDelay := time.Duration(0)
-			if r.RandomDelay != 0 {
-				randomDelay = time.Duration(rand.Int63n(int64(r.RandomDelay)))
+func (h *httpBackend) Do(request *http.Request, bodySize, resumeAttempts int, checkHeadersFunc checkHeadersFunc) (resp *Response, err error) {
+	// asynchronous requests are started by the frontier with a slot
+	s, ok := slotFromContext(request.Context())
+	if !ok {
+		if s, err = h.frontier.acquire(request.Context(), request.URL); err != nil {
+			return nil, err
+		}
+	}
+	// the slot and the health of the requests of Fetchers falling back
+	// to the backend are handled by doFetcher
+	if !isFetcherRequest(request.Context()) {
+		defer s.release(true)
+		// the health is recorded before the slot is released to compute
+		// the delay of the host from the latest round trip
+		host, started := request.URL.Host, time.Now()
+		defer func() {
+			h.health.record(host, resp, err, time.Since(started))
+		}()
+	}
+
+	var ex *HTTPExchange
+	if h.hasExchangeHooks() {
+		ex = &HTTPExchange{Request: request, Started: time.Now()}
+		defer func() {
+			ex.Err = err
+			if ex.Wait != 0 {
+				ex.Receive = time.Since(ex.Started) - ex.Wait
+			}
+			if resp != nil {
+				ex.Body = resp.Body
 			}
-			time.Sleep(r.Delay + randomDelay)
-			<-r.waitChan
-		}(r)
+			h.handleExchange(ex)
+		}()
 	}
 
-	res, err := h.Client.Do(request)
+	// range requests are not compressed to keep the offsets
+	// of the received parts valid
+	if request.Header.Get("Accept-Encoding") == "" && request.Header.Get("Range") == "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	// the timeout is applied by the context of the request instead of
+	// the client to allow per request timeouts
+	timedRequest, cancel := h.withTimeout(request)
+	defer cancel()
+	timedRequest, phases := h.withPhaseTimeouts(timedRequest)
+	defer phases.close()
+	var res *http.Response
+	if handler := h.schemeHandler(request.URL.Scheme); handler != nil {
+		res, err = handler.Fetch(timedRequest)
+	} else {
+		res, err = h.doAuthorized(timedRequest)
+	}
 	if err != nil {
-		return nil, err
+		return nil, phases.err(err)
 	}
 	defer res.Body.Close()
 	if res.Request != nil {
-		*request = *res.Request
+		*request = *res.Request.WithContext(request.Context())
+	}
+	if ex != nil {
+		ex.Request = request
+		ex.Wait = time.Since(ex.Started)
+		ex.StatusCode = res.StatusCode
+		ex.Proto = res.Proto
+		ex.Headers = res.Header
 	}
 	if !checkHeadersFunc(request, res.StatusCode, res.Header) {
 		// closing res.Body (see defer above) without reading it aborts
@@ -195,19 +381,38 @@ func (h *httpBackend) Do(request *http.Request, bodySize int, checkHeadersFunc c
 		return nil, ErrAbortedAfterHeaders
 	}
 
-	var bodyReader io.Reader = res.Body
+	bodyReader := h.throttle(timedRequest.Context(), request.URL, phases.body(res.Body))
+	var limiter *limitedReader
 	if bodySize > 0 {
-		bodyReader = io.LimitReader(bodyReader, int64(bodySize))
+		limiter = &limitedReader{r: bodyReader, n: int64(bodySize)}
+		bodyReader = limiter
 	}
 	contentEncoding := strings.ToLower(res.Header.Get("Content-Encoding"))
-	if !res.Uncompressed && (strings.Contains(contentEncoding, "gzip") || (contentEncoding == "" && strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "gzip")) || strings.HasSuffix(strings.ToLower(request.URL.Path), ".xml.gz")) {
-		bodyReader, err = gzip.NewReader(bodyReader)
+	if (contentEncoding == "" && strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "gzip")) || strings.HasSuffix(strings.ToLower(request.URL.Path), ".xml.gz") {
+		contentEncoding = "gzip"
+	}
+	if !res.Uncompressed && contentEncoding != "" {
+		decodingReader, err := newDecodingReader(bodyReader, contentEncoding)
 		if err != nil {
 			return nil, err
 		}
-		defer bodyReader.(*gzip.Reader).Close()
+		defer decodingReader.Close()
+		bodyReader = decodingReader
+	}
+	if isHeadOnly(request) && strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "html") {
+		// closing res.Body without reading the rest aborts the download
+		bodyReader = &headReader{r: bodyReader}
 	}
 	body, err := ioutil.ReadAll(bodyReader)
+	truncated := limiter != nil && limiter.exceeded
+	if truncated {
+		// the decoders of compressed bodies fail at the end of the
+		// truncated input
+		err = nil
+	}
+	if err != nil && resumeAttempts > 0 && contentEncoding == "" && isResumable(request, res) {
+		body, truncated, err = h.resume(request, res.Header, body, bodySize, resumeAttempts)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -215,17 +420,271 @@ func (h *httpBackend) Do(request *http.Request, bodySize int, checkHeadersFunc c
 		StatusCode: res.StatusCode,
 		Body:       body,
 		Headers:    &res.Header,
+		Truncated:  truncated,
 	}, nil
 }
 
+// limitedReader reads at most n bytes like io.LimitedReader and records
+// whether the underlying reader has more data
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		for !l.exceeded {
+			n, err := l.r.Read(b[:])
+			if n > 0 {
+				l.exceeded = true
+			}
+			if err != nil {
+				break
+			}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// client returns the HTTP client of a request. If TLS profiles or
+// request signers are set, the transport of the client is wrapped to
+// apply them to every round trip, including the redirects.
+func (h *httpBackend) client() *http.Client {
+	h.lock.RLock()
+	hasProfiles, hasSigners := len(h.tlsProfiles) > 0, len(h.signers) > 0
+	h.lock.RUnlock()
+	if !hasProfiles && !hasSigners && h.Client.Timeout == 0 {
+		return h.Client
+	}
+	client := *h.Client
+	// the timeout is applied by the context of the requests
+	client.Timeout = 0
+	if hasProfiles {
+		client.Transport = &tlsProfileTransport{backend: h, base: client.Transport}
+	}
+	if hasSigners {
+		client.Transport = &signingTransport{backend: h, base: client.Transport}
+	}
+	return &client
+}
+
+// isResumable checks whether the body of a response can be continued
+// with a range request
+func isResumable(request *http.Request, res *http.Response) bool {
+	if request.Method != "GET" || res.StatusCode != http.StatusOK {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(res.Header.Get("Accept-Ranges")), "bytes") {
+		return false
+	}
+	return resumeValidator(res.Header) != ""
+}
+
+// resumeValidator returns the validator of the If-Range header which
+// ensures that the resumed parts belong to the same content
+func resumeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// resume continues an interrupted response body using range requests
+func (h *httpBackend) resume(request *http.Request, header http.Header, body []byte, bodySize, attempts int) ([]byte, bool, error) {
+	var err error
+	for i := 0; i < attempts; i++ {
+		req := *request
+		req.Header = make(http.Header, len(request.Header))
+		for k, v := range request.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(body)))
+		req.Header.Set("If-Range", resumeValidator(header))
+		// compressed parts could not be appended to the received content
+		req.Header.Set("Accept-Encoding", "identity")
+		timedRequest, cancel := h.withTimeout(&req)
+		var res *http.Response
+		res, err = h.client().Do(timedRequest)
+		if err != nil {
+			cancel()
+			continue
+		}
+		if res.StatusCode != http.StatusPartialContent || !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", len(body))) {
+			// the content has been changed or the range is not supported
+			res.Body.Close()
+			cancel()
+			return nil, false, ErrInvalidRange
+		}
+		bodyReader := h.throttle(timedRequest.Context(), request.URL, res.Body)
+		var limiter *limitedReader
+		if bodySize > 0 {
+			limiter = &limitedReader{r: bodyReader, n: int64(bodySize - len(body))}
+			bodyReader = limiter
+		}
+		var part []byte
+		part, err = ioutil.ReadAll(bodyReader)
+		res.Body.Close()
+		cancel()
+		body = append(body, part...)
+		if err == nil {
+			return body, limiter != nil && limiter.exceeded, nil
+		}
+	}
+	return nil, false, err
+}
+
+// newDecodingReader returns a reader which decodes the body according
+// to its Content-Encoding. Empty bodies are returned as is.
+func newDecodingReader(r io.Reader, contentEncoding string) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err == io.EOF {
+		return ioutil.NopCloser(br), nil
+	}
+	switch {
+	case strings.Contains(contentEncoding, "gzip"):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return gr, nil
+	case strings.Contains(contentEncoding, "br"):
+		return ioutil.NopCloser(brotli.NewReader(br)), nil
+	case strings.Contains(contentEncoding, "zstd"):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case strings.Contains(contentEncoding, "deflate"):
+		// "deflate" should be zlib wrapped, but some servers send raw
+		// deflate streams
+		if header, err := br.Peek(2); err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+func (h *httpBackend) OnExchange(f HTTPExchangeCallback) {
+	h.lock.Lock()
+	h.exchangeHooks = append(h.exchangeHooks, f)
+	h.lock.Unlock()
+}
+
+func (h *httpBackend) hasExchangeHooks() bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return len(h.exchangeHooks) > 0
+}
+
+func (h *httpBackend) handleExchange(ex *HTTPExchange) {
+	h.lock.RLock()
+	hooks := h.exchangeHooks
+	h.lock.RUnlock()
+	for _, f := range hooks {
+		f(ex)
+	}
+}
+
 func (h *httpBackend) Limit(rule *LimitRule) error {
+	if err := rule.Init(); err != nil {
+		return err
+	}
 	h.lock.Lock()
 	if h.LimitRules == nil {
 		h.LimitRules = make([]*LimitRule, 0, 8)
 	}
 	h.LimitRules = append(h.LimitRules, rule)
 	h.lock.Unlock()
-	return rule.Init()
+	return nil
+}
+
+// UpdateLimit replaces a rule and moves the queues of the old rule to
+// the new one
+func (h *httpBackend) UpdateLimit(old, rule *LimitRule) error {
+	if err := rule.Init(); err != nil {
+		return err
+	}
+	h.lock.Lock()
+	i := h.limitIndex(old)
+	if i < 0 {
+		h.lock.Unlock()
+		return ErrUnknownLimitRule
+	}
+	h.LimitRules[i] = rule
+	h.forgetBandwidths(old)
+	h.lock.Unlock()
+	h.frontier.replaceRule(old, rule)
+	return nil
+}
+
+// RemoveLimit removes a rule. The waiting requests of the rule are
+// scheduled again by the remaining rules.
+func (h *httpBackend) RemoveLimit(rule *LimitRule) error {
+	h.lock.Lock()
+	i := h.limitIndex(rule)
+	if i < 0 {
+		h.lock.Unlock()
+		return ErrUnknownLimitRule
+	}
+	h.LimitRules = append(h.LimitRules[:i:i], h.LimitRules[i+1:]...)
+	h.forgetBandwidths(rule)
+	h.lock.Unlock()
+	h.frontier.removeRule(rule)
+	return nil
+}
+
+// limitIndex returns the index of the rule or -1. h.lock must be held.
+func (h *httpBackend) limitIndex(rule *LimitRule) int {
+	for i, r := range h.LimitRules {
+		if r == rule {
+			return i
+		}
+	}
+	return -1
+}
+
+// forgetBandwidths removes the bandwidth limiters of the rule. h.lock
+// must be held.
+func (h *httpBackend) forgetBandwidths(rule *LimitRule) {
+	for key := range h.hostBandwidths {
+		if key.rule == rule {
+			delete(h.hostBandwidths, key)
+		}
+	}
+}
+
+// limitStats returns the state of the queues of the rules
+func (h *httpBackend) limitStats() []LimitRuleStats {
+	h.lock.RLock()
+	stats := make([]LimitRuleStats, len(h.LimitRules))
+	index := make(map[*LimitRule]int, len(h.LimitRules))
+	for i, r := range h.LimitRules {
+		stats[i].Rule = r
+		index[r] = i
+	}
+	h.lock.RUnlock()
+	h.frontier.lock.Lock()
+	defer h.frontier.lock.Unlock()
+	for key, q := range h.frontier.hosts {
+		i, ok := index[key.rule]
+		if !ok {
+			continue
+		}
+		stats[i].Waiting += len(q.waiting)
+		stats[i].Running += q.running
+		stats[i].Hosts++
+	}
+	return stats
 }
 
 func (h *httpBackend) Limits(rules []*LimitRule) error {
@@ -0,0 +1,50 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"strings"
+)
+
+// From sets the From header of the requests to the contact address of
+// the operator of the crawler, e.g. "crawler@example.com"
+func From(address string) CollectorOption {
+	return func(c *Collector) {
+		c.From = address
+	}
+}
+
+// CrawlInfoURL appends the URL of a page describing the crawler to the
+// User-Agent of the requests, e.g. "colly (+https://example.com/bot)"
+func CrawlInfoURL(u string) CollectorOption {
+	return func(c *Collector) {
+		c.CrawlInfoURL = u
+	}
+}
+
+// identify sets the From header and adds the CrawlInfoURL to the
+// User-Agent of the headers. Headers set by the callbacks are kept.
+func (c *Collector) identify(h http.Header) {
+	if c.From != "" && h.Get("From") == "" {
+		h.Set("From", c.From)
+	}
+	if c.CrawlInfoURL == "" {
+		return
+	}
+	if ua := h.Get("User-Agent"); !strings.Contains(ua, c.CrawlInfoURL) {
+		h.Set("User-Agent", strings.TrimSpace(ua+" (+"+c.CrawlInfoURL+")"))
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestIdentification(t *testing.T) {
+	var lock sync.Mutex
+	seen := map[string][2]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		seen[r.URL.Path] = [2]string{r.Header.Get("From"), r.Header.Get("User-Agent")}
+		lock.Unlock()
+		w.Write([]byte("User-agent: *\nAllow: /\n"))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(
+		UserAgent("examplebot/1.0"),
+		From("crawler@example.com"),
+		CrawlInfoURL("https://example.com/bot"),
+	)
+	c.IgnoreRobotsTxt = false
+	c.OnRequest(func(r *Request) {
+		if r.URL.Path == "/custom" {
+			r.Headers.Set("From", "other@example.com")
+		}
+	})
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/custom")
+
+	ua := "examplebot/1.0 (+https://example.com/bot)"
+	expected := map[string][2]string{
+		"/robots.txt": {"crawler@example.com", ua},
+		"/":           {"crawler@example.com", ua},
+		"/custom":     {"other@example.com", ua},
+	}
+	for path, e := range expected {
+		if seen[path] != e {
+			t.Errorf("Invalid identification of %s: %q", path, seen[path])
+		}
+	}
+}
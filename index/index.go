@@ -0,0 +1,186 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package index feeds the text of crawled pages into a full-text index
+// to build small searchable archives directly from a crawl:
+//
+//	idx, _ := bleve.New("archive.bleve", bleve.NewIndexMapping())
+//	index.Register(c, idx)
+//
+// Any type having the Index method of bleve.Index can be used as
+// Indexer.
+package index
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// Indexer is a full-text index storing documents by ID. bleve.Index
+// implements it.
+type Indexer interface {
+	Index(id string, data interface{}) error
+}
+
+// Document is the indexed representation of a response
+type Document struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Text        string    `json:"text"`
+	ContentType string    `json:"content_type,omitempty"`
+	StatusCode  int       `json:"status_code"`
+	Fetched     time.Time `json:"fetched"`
+	// Fields contains the values stored in the request context under the
+	// keys of Hook.ContextFields, e.g. data extracted by OnHTML callbacks
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Hook indexes the responses of a Collector
+type Hook struct {
+	// Indexer stores the documents
+	Indexer Indexer
+	// Extract converts a response to a document. The response is skipped
+	// if it returns nil. Default is Extract.
+	Extract func(r *colly.Response) (*Document, error)
+	// Filter restricts indexing to the responses it returns true for.
+	// Responses with 2xx status code are indexed by default.
+	Filter func(r *colly.Response) bool
+	// ContextFields lists the request context keys copied to
+	// Document.Fields
+	ContextFields []string
+	// OnError is called if a response cannot be extracted or indexed
+	OnError func(r *colly.Response, err error)
+}
+
+// Register indexes the text of every successful response of the
+// Collector with idx
+func Register(c *colly.Collector, idx Indexer) *Hook {
+	h := &Hook{Indexer: idx}
+	h.Register(c)
+	return h
+}
+
+// Register attaches the hook to the Collector. Responses are indexed in
+// an OnScraped callback, so the values set in the request context by
+// OnHTML and OnXML callbacks are available for ContextFields.
+func (h *Hook) Register(c *colly.Collector) {
+	c.OnScraped(func(r *colly.Response) {
+		if err := h.Index(r); err != nil && h.OnError != nil {
+			h.OnError(r, err)
+		}
+	})
+}
+
+// Index extracts the document of the response and stores it in the
+// Indexer using the URL of the request as ID
+func (h *Hook) Index(r *colly.Response) error {
+	if h.Filter != nil {
+		if !h.Filter(r) {
+			return nil
+		}
+	} else if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return nil
+	}
+	extract := h.Extract
+	if extract == nil {
+		extract = Extract
+	}
+	doc, err := extract(r)
+	if err != nil || doc == nil {
+		return err
+	}
+	for _, k := range h.ContextFields {
+		if v := r.Ctx.GetAny(k); v != nil {
+			if doc.Fields == nil {
+				doc.Fields = make(map[string]interface{})
+			}
+			doc.Fields[k] = v
+		}
+	}
+	return h.Indexer.Index(doc.URL, doc)
+}
+
+// skippedElements do not contain the text of a page
+const skippedElements = "script, style, noscript, template, svg, iframe, nav, header, footer, aside, form"
+
+// Extract returns the document of a HTML or text response. The text of
+// HTML pages excludes scripts, styles and the navigation, header, footer
+// and aside elements. Other content types are skipped.
+func Extract(r *colly.Response) (*Document, error) {
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	doc := &Document{
+		URL:         r.Request.URL.String(),
+		ContentType: contentType,
+		StatusCode:  r.StatusCode,
+		Fetched:     time.Now(),
+	}
+	switch {
+	case strings.Contains(contentType, "html"):
+		d, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+		if err != nil {
+			return nil, err
+		}
+		doc.Title = normalizeSpace(d.Find("title").First().Text())
+		doc.Description, _ = d.Find(`meta[name="description"]`).Attr("content")
+		doc.Description = normalizeSpace(doc.Description)
+		body := d.Find("body")
+		body.Find(skippedElements).Remove()
+		doc.Text = text(body)
+	case strings.HasPrefix(contentType, "text/"):
+		doc.Text = normalizeSpace(string(r.Body))
+	default:
+		return nil, nil
+	}
+	return doc, nil
+}
+
+// blockElements are separated by a space in the extracted text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "td": true, "th": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "blockquote": true, "pre": true, "tr": true,
+}
+
+// text returns the text of the selection separating block elements
+func text(s *goquery.Selection) string {
+	var b strings.Builder
+	var walk func(s *goquery.Selection)
+	walk = func(s *goquery.Selection) {
+		s.Contents().Each(func(_ int, n *goquery.Selection) {
+			if goquery.NodeName(n) == "#text" {
+				b.WriteString(n.Text())
+				return
+			}
+			block := blockElements[goquery.NodeName(n)]
+			if block {
+				b.WriteByte(' ')
+			}
+			walk(n)
+			if block {
+				b.WriteByte(' ')
+			}
+		})
+	}
+	walk(s)
+	return normalizeSpace(b.String())
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
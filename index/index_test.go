@@ -0,0 +1,83 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+type memoryIndex struct {
+	docs map[string]*Document
+	lock sync.Mutex
+}
+
+func (m *memoryIndex) Index(id string, data interface{}) error {
+	m.lock.Lock()
+	m.docs[id] = data.(*Document)
+	m.lock.Unlock()
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Test  page</title><meta name="description" content="About tests"></head>
+<body><nav><a href="/missing">Menu</a><a href="/text">Text</a></nav><h1>Hello</h1><p>First<br>paragraph</p><script>var x;</script><h2 class="price">42</h2></body></html>`))
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("plain\n text"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	idx := &memoryIndex{docs: make(map[string]*Document)}
+	c := colly.NewCollector()
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnHTML(".price", func(e *colly.HTMLElement) {
+		e.Request.Ctx.Put("price", e.Text)
+	})
+	h := Register(c, idx)
+	h.ContextFields = []string{"price"}
+	c.Visit(ts.URL + "/")
+
+	if len(idx.docs) != 2 {
+		t.Fatalf("Invalid number of indexed documents %d", len(idx.docs))
+	}
+	doc := idx.docs[ts.URL+"/"]
+	if doc.Title != "Test page" || doc.Description != "About tests" {
+		t.Errorf("Invalid title %q or description %q", doc.Title, doc.Description)
+	}
+	if doc.Text != "Hello First paragraph 42" {
+		t.Errorf("Invalid text %q", doc.Text)
+	}
+	if doc.Fields["price"] != "42" {
+		t.Errorf("Invalid context fields %v", doc.Fields)
+	}
+	if doc := idx.docs[ts.URL+"/text"]; doc.Text != "plain text" {
+		t.Errorf("Invalid text %q", doc.Text)
+	}
+}
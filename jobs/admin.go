@@ -0,0 +1,321 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// JobSpec is the JSON representation of a job submitted to the admin API
+type JobSpec struct {
+	ID       string            `json:"id"`
+	Tenant   string            `json:"tenant"`
+	Priority int               `json:"priority"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	URLs     []string          `json:"urls"`
+	// Type selects the Setup function of the job from AdminHandler.Setups
+	Type           string   `json:"type,omitempty"`
+	MaxDepth       int      `json:"max_depth,omitempty"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	UserAgent      string   `json:"user_agent,omitempty"`
+	Async          bool     `json:"async,omitempty"`
+}
+
+// AdminHandler is a HTTP handler exposing the jobs of a Manager through
+// an authenticated REST API:
+//
+//	GET    /jobs                  list the jobs and their stats
+//	POST   /jobs                  submit a job described by a JobSpec
+//	GET    /jobs/{id}             stats of a job
+//	DELETE /jobs/{id}             remove a stopped job
+//	POST   /jobs/{id}/cancel      cancel a job
+//	GET    /jobs/{id}/logs        log of a job as JSON lines. The log is
+//	                              streamed until the job stops if the
+//	                              "follow" query parameter is set.
+//	GET    /humans.txt            description of the crawler if
+//	                              Identification is set
+//
+// Requests are authenticated with the "Authorization: Bearer <token>"
+// header, except the requests of /humans.txt.
+type AdminHandler struct {
+	// Manager runs the jobs
+	Manager *Manager
+	// Tokens maps the API tokens to tenants. Tokens of the empty tenant
+	// have access to the jobs of every tenant, other tokens can only
+	// manage the jobs of their tenant.
+	Tokens map[string]string
+	// Setups are the available job types. They register the callbacks of
+	// the Collectors of the submitted jobs.
+	Setups map[string]func(c *colly.Collector) error
+	// NewConfig creates the configuration of a submitted job. By default
+	// the Collector options are set from the JobSpec and the Setup
+	// function is selected by the Type of the JobSpec.
+	NewConfig func(spec *JobSpec) (*Config, error)
+	// Identification describes the crawler to the operators of the
+	// crawled sites. It is served publicly on /humans.txt, and the
+	// submitted jobs send its Contact in the From header and its InfoURL
+	// in the User-Agent.
+	Identification *Identification
+}
+
+// Identification describes a crawler and its operator
+type Identification struct {
+	// Name is the name of the crawler
+	Name string
+	// Operator is the organization running the crawler
+	Operator string
+	// Contact is the e-mail address of the operator
+	Contact string
+	// Purpose explains why the sites are crawled
+	Purpose string
+	// InfoURL is the public URL of the /humans.txt endpoint or of
+	// another page describing the crawler
+	InfoURL string
+	// UserAgent is the User-Agent of the crawler
+	UserAgent string
+}
+
+// Options returns the Collector options identifying the requests of
+// the crawler
+func (i *Identification) Options() []colly.CollectorOption {
+	var options []colly.CollectorOption
+	if i.UserAgent != "" {
+		options = append(options, colly.UserAgent(i.UserAgent))
+	}
+	if i.Contact != "" {
+		options = append(options, colly.From(i.Contact))
+	}
+	if i.InfoURL != "" {
+		options = append(options, colly.CrawlInfoURL(i.InfoURL))
+	}
+	return options
+}
+
+// WriteTo writes the identification in the humans.txt format
+func (i *Identification) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("/* CRAWLER */\n")
+	for _, f := range [][2]string{
+		{"Name", i.Name},
+		{"Operator", i.Operator},
+		{"Contact", i.Contact},
+		{"Purpose", i.Purpose},
+		{"User-Agent", i.UserAgent},
+		{"Info", i.InfoURL},
+	} {
+		if f[1] != "" {
+			fmt.Fprintf(buf, "%s: %s\n", f[0], f[1])
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/humans.txt" && h.Identification != nil {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		h.Identification.WriteTo(w)
+		return
+	}
+	tenant, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("Invalid API token"))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/jobs") || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+		return
+	}
+	if parts[0] == "" {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, h.Manager.Stats(tenant))
+		case "POST":
+			h.submit(w, r, tenant)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+		return
+	}
+	j := h.Manager.Job(parts[0])
+	if j == nil || (tenant != "" && j.Tenant != tenant) {
+		writeError(w, http.StatusNotFound, ErrJobNotFound)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, j.Stats())
+	case action == "" && r.Method == "DELETE":
+		if err := h.Manager.Remove(j.ID); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "cancel" && r.Method == "POST":
+		h.Manager.Cancel(j.ID)
+		writeJSON(w, http.StatusOK, j.Stats())
+	case action == "logs" && r.Method == "GET":
+		h.logs(w, r, j)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+// authenticate returns the tenant of the API token of the request
+func (h *AdminHandler) authenticate(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	token := []byte(strings.TrimSpace(auth[len("Bearer "):]))
+	for t, tenant := range h.Tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(t), token) == 1 {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+func (h *AdminHandler) submit(w http.ResponseWriter, r *http.Request, tenant string) {
+	spec := &JobSpec{}
+	if err := json.NewDecoder(r.Body).Decode(spec); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if tenant != "" {
+		spec.Tenant = tenant
+	}
+	newConfig := h.NewConfig
+	if newConfig == nil {
+		newConfig = h.config
+	}
+	cfg, err := newConfig(spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	j, err := h.Manager.Submit(cfg)
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusCreated, j.Stats())
+	case ErrJobExists:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// config creates the default configuration of a JobSpec
+func (h *AdminHandler) config(spec *JobSpec) (*Config, error) {
+	cfg := &Config{
+		ID:       spec.ID,
+		Tenant:   spec.Tenant,
+		Priority: spec.Priority,
+		Labels:   spec.Labels,
+		URLs:     spec.URLs,
+	}
+	if spec.Type != "" {
+		setup, ok := h.Setups[spec.Type]
+		if !ok {
+			return nil, errors.New("Unknown job type " + spec.Type)
+		}
+		cfg.Setup = setup
+	}
+	if h.Identification != nil {
+		cfg.Options = append(cfg.Options, h.Identification.Options()...)
+	}
+	if spec.MaxDepth > 0 {
+		cfg.Options = append(cfg.Options, colly.MaxDepth(spec.MaxDepth))
+	}
+	if len(spec.AllowedDomains) > 0 {
+		cfg.Options = append(cfg.Options, colly.AllowedDomains(spec.AllowedDomains...))
+	}
+	if spec.UserAgent != "" {
+		cfg.Options = append(cfg.Options, colly.UserAgent(spec.UserAgent))
+	}
+	if spec.Async {
+		cfg.Options = append(cfg.Options, colly.Async())
+	}
+	return cfg, nil
+}
+
+// logs writes the log entries of a job as JSON lines
+func (h *AdminHandler) logs(w http.ResponseWriter, r *http.Request, j *Job) {
+	entries, ch := j.log.subscribe()
+	defer j.log.unsubscribe(ch)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		enc.Encode(e)
+	}
+	if _, follow := r.URL.Query()["follow"]; !follow {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case e := <-ch:
+			enc.Encode(e)
+		case <-j.done:
+			// write the entries logged while stopping the job
+			for {
+				select {
+				case e := <-ch:
+					enc.Encode(e)
+				default:
+					return
+				}
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
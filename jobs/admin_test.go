@@ -0,0 +1,173 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	m := NewManager()
+	h := &AdminHandler{
+		Manager: m,
+		Tokens:  map[string]string{"admin-token": "", "acme-token": "acme"},
+		Setups:  map[string]func(*colly.Collector) error{"follow": follow},
+	}
+	api := httptest.NewServer(h)
+	defer api.Close()
+
+	do := func(method, path, token, body string, v interface{}) int {
+		req, _ := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if v != nil {
+			json.NewDecoder(res.Body).Decode(v)
+		}
+		return res.StatusCode
+	}
+
+	if status := do("GET", "/jobs", "", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Invalid status %d without token", status)
+	}
+	if status := do("GET", "/jobs", "invalid", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Invalid status %d with invalid token", status)
+	}
+
+	s := Stats{}
+	spec := `{"id": "a", "tenant": "other", "type": "follow", "urls": ["` + ts.URL + `/"]}`
+	if status := do("POST", "/jobs", "acme-token", spec, &s); status != http.StatusCreated {
+		t.Fatalf("Invalid status %d of submitted job", status)
+	}
+	if s.JobID != "a" || s.Tenant != "acme" {
+		t.Errorf("Invalid stats of submitted job %+v", s)
+	}
+	if status := do("POST", "/jobs", "acme-token", spec, nil); status != http.StatusConflict {
+		t.Errorf("Invalid status %d of duplicate job", status)
+	}
+	if status := do("POST", "/jobs", "acme-token", `{"id": "b", "type": "missing"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Invalid status %d of unknown job type", status)
+	}
+	if status := do("POST", "/jobs", "admin-token", `{"id": "c", "tenant": "other", "urls": ["`+ts.URL+`/page"]}`, nil); status != http.StatusCreated {
+		t.Errorf("Invalid status %d of job submitted by admin", status)
+	}
+	m.Wait()
+
+	var stats []Stats
+	if status := do("GET", "/jobs", "acme-token", "", &stats); status != http.StatusOK || len(stats) != 1 {
+		t.Errorf("Invalid job list of tenant %d %v", status, stats)
+	}
+	if status := do("GET", "/jobs", "admin-token", "", &stats); status != http.StatusOK || len(stats) != 2 {
+		t.Errorf("Invalid job list of admin %d %v", status, stats)
+	}
+	if status := do("GET", "/jobs/c", "acme-token", "", nil); status != http.StatusNotFound {
+		t.Errorf("Invalid status %d of job of other tenant", status)
+	}
+	if status := do("GET", "/jobs/a", "acme-token", "", &s); status != http.StatusOK || s.State != Finished || s.Responses != 2 {
+		t.Errorf("Invalid stats %d %+v", status, s)
+	}
+
+	req, _ := http.NewRequest("GET", api.URL+"/jobs/a/logs?follow", nil)
+	req.Header.Set("Authorization", "Bearer acme-token")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		e := LogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, e.Message)
+	}
+	res.Body.Close()
+	if len(messages) != 4 || messages[0] != "Job started" || messages[3] != "Job finished" {
+		t.Errorf("Invalid log %v", messages)
+	}
+
+	if status := do("POST", "/jobs/a/cancel", "acme-token", "", nil); status != http.StatusOK {
+		t.Errorf("Invalid status %d of canceled job", status)
+	}
+	if status := do("DELETE", "/jobs/a", "acme-token", "", nil); status != http.StatusNoContent || m.Job("a") != nil {
+		t.Errorf("Invalid status %d of removed job", status)
+	}
+	if status := do("DELETE", "/jobs/a", "acme-token", "", nil); status != http.StatusNotFound {
+		t.Errorf("Invalid status %d of missing job", status)
+	}
+}
+
+func TestAdminIdentification(t *testing.T) {
+	var from, userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, userAgent = r.Header.Get("From"), r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+
+	h := &AdminHandler{
+		Manager: NewManager(),
+		Tokens:  map[string]string{"admin-token": ""},
+		Identification: &Identification{
+			Name:      "examplebot",
+			Contact:   "crawler@example.com",
+			Purpose:   "Research",
+			InfoURL:   "https://example.com/humans.txt",
+			UserAgent: "examplebot/1.0",
+		},
+	}
+	api := httptest.NewServer(h)
+	defer api.Close()
+
+	res, err := http.Get(api.URL + "/humans.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expected := "/* CRAWLER */\nName: examplebot\nContact: crawler@example.com\nPurpose: Research\nUser-Agent: examplebot/1.0\nInfo: https://example.com/humans.txt\n"
+	if res.StatusCode != http.StatusOK || string(body) != expected {
+		t.Errorf("Invalid humans.txt %d %q", res.StatusCode, body)
+	}
+
+	cfg, err := h.config(&JobSpec{ID: "a", URLs: []string{ts.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := h.Manager.Submit(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Wait()
+	if from != "crawler@example.com" || userAgent != "examplebot/1.0 (+https://example.com/humans.txt)" {
+		t.Errorf("Job requests are not identified: %q %q", from, userAgent)
+	}
+}
@@ -0,0 +1,490 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jobs runs many independent crawl jobs of multiple tenants in a
+// single process.
+//
+// Every job has its own Collector configuration, storage namespace,
+// limit rules and metrics labels. The Manager schedules the jobs by
+// priority within the concurrency quotas of the tenants and shares the
+// global request rate budget fairly between the tenants:
+//
+//	m := jobs.NewManager()
+//	m.MaxRunning = 10
+//	m.TenantQuota = 2
+//	m.MaxRPS = 50
+//	job, err := m.Submit(&jobs.Config{
+//		ID:     "shop-prices",
+//		Tenant: "acme",
+//		Labels: map[string]string{"plan": "pro"},
+//		URLs:   []string{"https://example.com/"},
+//		Setup: func(c *colly.Collector) error {
+//			c.OnHTML(".price", func(e *colly.HTMLElement) { ... })
+//			return nil
+//		},
+//	})
+//	m.Wait()
+//
+// The requests, received bytes, processing time and storage used by the
+// jobs are accounted per job and tenant. Jobs are stopped when their
+// Quota or the quota of their tenant in Manager.TenantResourceQuotas is
+// used up.
+//
+// AdminHandler exposes the jobs of a Manager over an authenticated REST API.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/storage"
+)
+
+var (
+	// ErrMissingJobID is the error returned if a job has no ID
+	ErrMissingJobID = errors.New("Missing job ID")
+	// ErrJobExists is the error returned if a job with the same ID
+	// has already been submitted
+	ErrJobExists = errors.New("Job already exists")
+	// ErrJobNotFound is the error returned for unknown job IDs
+	ErrJobNotFound = errors.New("Job not found")
+	// ErrJobRunning is the error returned if a job can not be removed
+	// because it has not finished yet
+	ErrJobRunning = errors.New("Job is running")
+	// ErrQuotaExceeded is the error returned if a job is submitted by
+	// a tenant which has used up its quota
+	ErrQuotaExceeded = errors.New("Quota exceeded")
+)
+
+// State is the state of a job
+type State int
+
+const (
+	// Pending jobs are waiting to be started
+	Pending State = iota
+	// Running jobs are crawling
+	Running
+	// Finished jobs have visited every reachable URL
+	Finished
+	// Canceled jobs were stopped by Manager.Cancel or by a quota
+	Canceled
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Running:
+		return "running"
+	case Finished:
+		return "finished"
+	}
+	return "canceled"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *State) UnmarshalText(text []byte) error {
+	for _, state := range []State{Pending, Running, Finished, Canceled} {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return errors.New("Invalid job state " + string(text))
+}
+
+// Config is the configuration of a job
+type Config struct {
+	// ID is the unique identifier of the job
+	ID string
+	// Tenant is the owner of the job
+	Tenant string
+	// Priority orders the pending jobs. Jobs with higher priority
+	// are started first.
+	Priority int
+	// Labels are attached to the metrics of the job
+	Labels map[string]string
+	// Options configure the Collector of the job
+	Options []colly.CollectorOption
+	// Limits are the LimitRules of the Collector of the job
+	Limits []*colly.LimitRule
+	// Setup registers the callbacks of the Collector
+	Setup func(c *colly.Collector) error
+	// URLs are the start URLs of the job
+	URLs []string
+	// Quota limits the resources used by the job
+	Quota Quota
+}
+
+// Stats contains the metrics of a job
+type Stats struct {
+	JobID    string            `json:"id"`
+	Tenant   string            `json:"tenant"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	State    State             `json:"state"`
+	Priority int               `json:"priority"`
+	// RPS is the request rate share of the job. 0 means unlimited.
+	RPS       float64 `json:"rps"`
+	Requests  uint64  `json:"requests"`
+	Responses uint64  `json:"responses"`
+	Errors    uint64  `json:"errors"`
+	// Bytes is the total size of the received response bodies
+	Bytes   uint64        `json:"bytes"`
+	CPUTime time.Duration `json:"cpu_time"`
+	Storage uint64        `json:"storage"`
+	// QuotaExceeded is the resource whose quota stopped the job
+	QuotaExceeded Resource  `json:"quota_exceeded,omitempty"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+}
+
+// Job is a crawl job run by a Manager
+type Job struct {
+	// ID is the unique identifier of the job
+	ID string
+	// Tenant is the owner of the job
+	Tenant string
+	// Priority orders the pending jobs
+	Priority int
+	// Labels are attached to the metrics of the job
+	Labels map[string]string
+	// Collector is the Collector of the job
+	Collector     *colly.Collector
+	config        *Config
+	seq           uint64
+	state         State
+	started       time.Time
+	finished      time.Time
+	responses     uint64
+	errors        uint64
+	usage         usage
+	tenantUsage   *usage
+	quotaExceeded Resource
+	processing    sync.Map
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+	lock          sync.RWMutex
+	throttle      throttle
+	log           jobLog
+}
+
+// Manager runs crawl jobs concurrently
+type Manager struct {
+	// NewStorage creates the storage of a job. The namespace is
+	// "<tenant>/<job ID>". By default every job gets its own
+	// storage.InMemoryStorage.
+	NewStorage func(namespace string) (storage.Storage, error)
+	// MaxRunning limits the number of concurrently running jobs.
+	// 0 means unlimited.
+	MaxRunning int
+	// TenantQuota limits the number of concurrently running jobs of
+	// a tenant. 0 means unlimited.
+	TenantQuota int
+	// TenantQuotas overrides TenantQuota for the listed tenants
+	TenantQuotas map[string]int
+	// MaxRPS is the global budget of requests per second. It is shared
+	// equally between the tenants having running jobs and between the
+	// running jobs of a tenant. 0 means unlimited.
+	MaxRPS float64
+	// TenantResourceQuotas limits the resources used by the jobs of
+	// the listed tenants
+	TenantResourceQuotas map[string]Quota
+	// OnQuotaExceeded is called when a job is stopped because a quota
+	// of the job or its tenant was used up
+	OnQuotaExceeded func(e QuotaExceeded)
+	jobs            map[string]*Job
+	pending         []*Job
+	running         int
+	tenantRunning   map[string]int
+	tenantUsage     map[string]*usage
+	seq             uint64
+	lock            sync.RWMutex
+	wg              sync.WaitGroup
+}
+
+// NewManager creates a new Manager
+func NewManager() *Manager {
+	return &Manager{
+		jobs:          make(map[string]*Job),
+		tenantRunning: make(map[string]int),
+		tenantUsage:   make(map[string]*usage),
+	}
+}
+
+// Submit creates the Collector of a job and schedules the job. The job
+// starts in the background as soon as the quotas allow it.
+func (m *Manager) Submit(cfg *Config) (*Job, error) {
+	if cfg.ID == "" {
+		return nil, ErrMissingJobID
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		ID:       cfg.ID,
+		Tenant:   cfg.Tenant,
+		Priority: cfg.Priority,
+		Labels:   cfg.Labels,
+		config:   cfg,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	m.lock.Lock()
+	if _, ok := m.jobs[cfg.ID]; ok {
+		m.lock.Unlock()
+		cancel()
+		return nil, ErrJobExists
+	}
+	u, ok := m.tenantUsage[cfg.Tenant]
+	if !ok {
+		u = &usage{}
+		m.tenantUsage[cfg.Tenant] = u
+	}
+	if q, ok := m.TenantResourceQuotas[cfg.Tenant]; ok {
+		if _, _, _, exceeded := q.exceeded(u.get()); exceeded {
+			m.lock.Unlock()
+			cancel()
+			return nil, ErrQuotaExceeded
+		}
+	}
+	j.tenantUsage = u
+	m.jobs[cfg.ID] = j
+	m.lock.Unlock()
+	if err := m.setup(j); err != nil {
+		m.lock.Lock()
+		delete(m.jobs, cfg.ID)
+		m.lock.Unlock()
+		cancel()
+		return nil, err
+	}
+
+	m.wg.Add(1)
+	m.lock.Lock()
+	m.seq++
+	j.seq = m.seq
+	m.pending = append(m.pending, j)
+	m.schedule()
+	m.lock.Unlock()
+	return j, nil
+}
+
+// Job returns the job of the ID or nil if it does not exist
+func (m *Manager) Job(ID string) *Job {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.jobs[ID]
+}
+
+// Jobs returns the jobs of a tenant ordered by ID. Every job is returned
+// if tenant is empty.
+func (m *Manager) Jobs(tenant string) []*Job {
+	m.lock.RLock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if tenant == "" || j.Tenant == tenant {
+			jobs = append(jobs, j)
+		}
+	}
+	m.lock.RUnlock()
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].ID < jobs[k].ID
+	})
+	return jobs
+}
+
+// Cancel stops a job. The requests in progress are aborted.
+func (m *Manager) Cancel(ID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[ID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	j.cancel()
+	for i, p := range m.pending {
+		if p == j {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			j.lock.Lock()
+			j.state = Canceled
+			j.finished = time.Now()
+			j.lock.Unlock()
+			j.Logf("Job canceled")
+			close(j.done)
+			m.wg.Done()
+			break
+		}
+	}
+	return nil
+}
+
+// Remove deletes a stopped job from the Manager
+func (m *Manager) Remove(ID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[ID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if s := j.State(); s == Pending || s == Running {
+		return ErrJobRunning
+	}
+	delete(m.jobs, ID)
+	atomic.AddInt64(&j.tenantUsage.storage, -atomic.LoadInt64(&j.usage.storage))
+	return nil
+}
+
+// Stats returns the metrics of the jobs of a tenant. The metrics of
+// every job are returned if tenant is empty.
+func (m *Manager) Stats(tenant string) []Stats {
+	jobs := m.Jobs(tenant)
+	stats := make([]Stats, len(jobs))
+	for i, j := range jobs {
+		stats[i] = j.Stats()
+	}
+	return stats
+}
+
+// Wait blocks until every job has stopped
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) run(j *Job) {
+	c := j.Collector
+	for _, u := range j.config.URLs {
+		if j.ctx.Err() != nil {
+			break
+		}
+		c.Visit(u)
+	}
+	c.Wait()
+
+	j.lock.Lock()
+	j.finished = time.Now()
+	if j.ctx.Err() != nil {
+		j.state = Canceled
+	} else {
+		j.state = Finished
+	}
+	state := j.state
+	j.lock.Unlock()
+	j.cancel()
+	j.Logf("Job %s", state)
+}
+
+// setup creates the Collector of the job
+func (m *Manager) setup(j *Job) error {
+	c := colly.NewCollector(j.config.Options...)
+	c.Context = j.ctx
+	namespace := j.Tenant + "/" + j.ID
+	var s storage.Storage = &storage.InMemoryStorage{}
+	if m.NewStorage != nil {
+		var err error
+		if s, err = m.NewStorage(namespace); err != nil {
+			return err
+		}
+	}
+	s = &meteredStorage{Storage: s, usage: []*usage{&j.usage, j.tenantUsage}}
+	if err := c.SetStorage(s); err != nil {
+		return err
+	}
+	if len(j.config.Limits) > 0 {
+		if err := c.Limits(j.config.Limits); err != nil {
+			return err
+		}
+	}
+	c.OnRequest(func(r *colly.Request) {
+		j.throttle.wait(j.ctx)
+		if !m.checkQuota(j) {
+			r.Abort()
+			return
+		}
+		atomic.AddUint64(&j.usage.requests, 1)
+		atomic.AddUint64(&j.tenantUsage.requests, 1)
+	})
+	c.OnResponse(func(r *colly.Response) {
+		j.processing.Store(r.Request.ID, time.Now())
+		atomic.AddUint64(&j.responses, 1)
+		atomic.AddUint64(&j.usage.bytes, uint64(len(r.Body)))
+		atomic.AddUint64(&j.tenantUsage.bytes, uint64(len(r.Body)))
+		j.Logf("Visited %s (%d)", r.Request.URL, r.StatusCode)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		atomic.AddUint64(&j.errors, 1)
+		j.Errorf("Request to %s failed: %v", r.Request.URL, err)
+	})
+	j.Collector = c
+	if j.config.Setup != nil {
+		if err := j.config.Setup(c); err != nil {
+			return err
+		}
+	}
+	// registered after the callbacks of Setup to measure their run time
+	c.OnScraped(func(r *colly.Response) {
+		if started, ok := j.processing.Load(r.Request.ID); ok {
+			j.processing.Delete(r.Request.ID)
+			d := int64(time.Since(started.(time.Time)))
+			atomic.AddInt64(&j.usage.cpuTime, d)
+			atomic.AddInt64(&j.tenantUsage.cpuTime, d)
+		}
+	})
+	return nil
+}
+
+// State returns the state of the job
+func (j *Job) State() State {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.state
+}
+
+// Wait blocks until the job stops
+func (j *Job) Wait() {
+	<-j.done
+}
+
+// Stats returns the metrics of the job
+func (j *Job) Stats() Stats {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	u := j.usage.get()
+	return Stats{
+		JobID:         j.ID,
+		Tenant:        j.Tenant,
+		Labels:        j.Labels,
+		State:         j.state,
+		Priority:      j.Priority,
+		RPS:           j.throttle.rate(),
+		Requests:      u.Requests,
+		Responses:     atomic.LoadUint64(&j.responses),
+		Errors:        atomic.LoadUint64(&j.errors),
+		Bytes:         u.Bytes,
+		CPUTime:       u.CPUTime,
+		Storage:       u.Storage,
+		QuotaExceeded: j.quotaExceeded,
+		Started:       j.started,
+		Finished:      j.finished,
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/storage"
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/page">page</a>`))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/">home</a>`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func follow(c *colly.Collector) error {
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	m := NewManager()
+	var namespaces []string
+	lock := sync.Mutex{}
+	m.NewStorage = func(namespace string) (storage.Storage, error) {
+		lock.Lock()
+		namespaces = append(namespaces, namespace)
+		lock.Unlock()
+		return &storage.InMemoryStorage{}, nil
+	}
+	for _, cfg := range []*Config{
+		{ID: "a", Tenant: "acme", Labels: map[string]string{"plan": "pro"}, URLs: []string{ts.URL + "/"}, Setup: follow},
+		{ID: "b", Tenant: "acme", URLs: []string{ts.URL + "/"}, Setup: follow, Options: []colly.CollectorOption{colly.MaxDepth(1)}},
+		{ID: "c", Tenant: "other", URLs: []string{ts.URL + "/page"}, Setup: follow, Options: []colly.CollectorOption{colly.Async()}},
+	} {
+		if _, err := m.Submit(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Submit(&Config{ID: "a"}); err != ErrJobExists {
+		t.Errorf("Invalid error %v, want %v", err, ErrJobExists)
+	}
+	if _, err := m.Submit(&Config{}); err != ErrMissingJobID {
+		t.Errorf("Invalid error %v, want %v", err, ErrMissingJobID)
+	}
+	m.Wait()
+
+	sort.Strings(namespaces)
+	if !reflect.DeepEqual(namespaces, []string{"acme/a", "acme/b", "other/c"}) {
+		t.Errorf("Invalid storage namespaces %v", namespaces)
+	}
+	if jobs := m.Jobs("acme"); len(jobs) != 2 || jobs[0].ID != "a" || jobs[1].ID != "b" {
+		t.Errorf("Invalid jobs of tenant %v", jobs)
+	}
+	stats := m.Stats("")
+	if len(stats) != 3 {
+		t.Fatalf("Invalid stats %v", stats)
+	}
+	for i, responses := range []uint64{2, 1, 2} {
+		s := stats[i]
+		if s.State != Finished || s.Responses != responses || s.Requests != responses || s.Bytes == 0 {
+			t.Errorf("Invalid stats of job %s: %+v", s.JobID, s)
+		}
+	}
+	if stats[0].Labels["plan"] != "pro" {
+		t.Errorf("Invalid labels %v", stats[0].Labels)
+	}
+	if err := m.Remove("a"); err != nil || m.Job("a") != nil {
+		t.Errorf("Job was not removed: %v", err)
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	m := NewManager()
+	j, err := m.Submit(&Config{ID: "slow", URLs: []string{ts.URL + "/slow", ts.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if s := j.State(); s != Running {
+		t.Errorf("Invalid state %v", s)
+	}
+	if err := m.Remove("slow"); err != ErrJobRunning {
+		t.Errorf("Invalid error %v, want %v", err, ErrJobRunning)
+	}
+	if err := m.Cancel("slow"); err != nil {
+		t.Fatal(err)
+	}
+	j.Wait()
+	s := j.Stats()
+	if s.State != Canceled || s.Requests != 1 || s.Errors != 1 {
+		t.Errorf("Invalid stats of canceled job %+v", s)
+	}
+	if err := m.Cancel("missing"); err != ErrJobNotFound {
+		t.Errorf("Invalid error %v, want %v", err, ErrJobNotFound)
+	}
+}
+
+func TestManagerScheduling(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			<-release
+		}
+	}))
+	defer ts.Close()
+
+	m := NewManager()
+	m.MaxRunning = 3
+	m.TenantQuota = 2
+	m.TenantQuotas = map[string]int{"free": 1}
+	m.MaxRPS = 20
+	var started []string
+	lock := sync.Mutex{}
+	submit := func(ID, tenant string, priority int, path string) {
+		_, err := m.Submit(&Config{
+			ID:       ID,
+			Tenant:   tenant,
+			Priority: priority,
+			URLs:     []string{ts.URL + path},
+			Setup: func(c *colly.Collector) error {
+				c.OnRequest(func(*colly.Request) {
+					lock.Lock()
+					started = append(started, ID)
+					lock.Unlock()
+				})
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	submit("pro1", "pro", 0, "/block")
+	submit("pro2", "pro", 0, "/block")
+	submit("free1", "free", 0, "/block")
+	submit("free2", "free", 0, "/")
+	submit("pro3", "pro", 0, "/")
+	submit("low", "other", 0, "/")
+	submit("high", "other", 5, "/")
+	time.Sleep(50 * time.Millisecond)
+
+	for ID, want := range map[string]State{"pro1": Running, "pro2": Running, "free1": Running, "free2": Pending, "pro3": Pending, "high": Pending} {
+		if s := m.Job(ID).State(); s != want {
+			t.Errorf("Invalid state %v of %s, want %v", s, ID, want)
+		}
+	}
+	for ID, want := range map[string]float64{"pro1": 5, "pro2": 5, "free1": 10} {
+		if rps := m.Job(ID).Stats().RPS; rps != want {
+			t.Errorf("Invalid request rate %v of %s, want %v", rps, ID, want)
+		}
+	}
+	if err := m.Cancel("pro3"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	m.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(started) != 6 || !reflect.DeepEqual(started[3:], []string{"high", "low", "free2"}) && !reflect.DeepEqual(started[3:], []string{"high", "free2", "low"}) {
+		t.Errorf("Invalid start order %v", started)
+	}
+	if s := m.Job("pro3").State(); s != Canceled {
+		t.Errorf("Invalid state %v of canceled pending job", s)
+	}
+}
+
+func TestManagerQuota(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	m := NewManager()
+	m.TenantResourceQuotas = map[string]Quota{"free": {MaxBytes: 1}}
+	var events []QuotaExceeded
+	lock := sync.Mutex{}
+	m.OnQuotaExceeded = func(e QuotaExceeded) {
+		lock.Lock()
+		events = append(events, e)
+		lock.Unlock()
+	}
+	for _, cfg := range []*Config{
+		{ID: "limited", Tenant: "pro", URLs: []string{ts.URL + "/"}, Setup: follow, Quota: Quota{MaxRequests: 1}},
+		{ID: "unlimited", Tenant: "pro", URLs: []string{ts.URL + "/"}, Setup: follow},
+		{ID: "free", Tenant: "free", URLs: []string{ts.URL + "/"}, Setup: follow},
+	} {
+		if _, err := m.Submit(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Wait()
+
+	for ID, want := range map[string]Resource{"limited": RequestsResource, "unlimited": "", "free": BytesResource} {
+		s := m.Job(ID).Stats()
+		if s.QuotaExceeded != want {
+			t.Errorf("Invalid exceeded quota %q of %s, want %q", s.QuotaExceeded, ID, want)
+		}
+		if want != "" && (s.State != Canceled || s.Requests != 1) {
+			t.Errorf("Job %s was not stopped by quota: %+v", ID, s)
+		}
+		if s.Storage == 0 {
+			t.Errorf("Storage usage of %s is not counted", ID)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("Invalid quota events %+v", events)
+	}
+	for _, e := range events {
+		if e.ByTenant != (e.Tenant == "free") || e.Used < e.Limit {
+			t.Errorf("Invalid quota event %+v", e)
+		}
+	}
+	if u := m.Usage("pro"); u.Requests != 3 || u.Bytes == 0 {
+		t.Errorf("Invalid usage of tenant %+v", u)
+	}
+	if _, err := m.Submit(&Config{ID: "free2", Tenant: "free"}); err != ErrQuotaExceeded {
+		t.Errorf("Invalid error %v, want %v", err, ErrQuotaExceeded)
+	}
+}
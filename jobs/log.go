@@ -0,0 +1,98 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxLogEntries is the number of the latest log entries kept per job
+const MaxLogEntries = 1000
+
+// LogEntry is a log message of a job
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	// Level is "info" or "error"
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// jobLog keeps the latest log entries of a job and passes the new
+// entries to the subscribers
+type jobLog struct {
+	entries     []LogEntry
+	subscribers map[chan LogEntry]struct{}
+	lock        sync.Mutex
+}
+
+func (l *jobLog) add(level, format string, args ...interface{}) {
+	e := LogEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.entries) >= MaxLogEntries {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:len(l.entries)-1]
+	}
+	l.entries = append(l.entries, e)
+	for ch := range l.subscribers {
+		// slow subscribers miss entries instead of blocking the job
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// subscribe returns the current entries and a channel receiving the
+// new entries until unsubscribe is called
+func (l *jobLog) subscribe() ([]LogEntry, chan LogEntry) {
+	ch := make(chan LogEntry, 64)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = make(map[chan LogEntry]struct{})
+	}
+	l.subscribers[ch] = struct{}{}
+	return append([]LogEntry(nil), l.entries...), ch
+}
+
+func (l *jobLog) unsubscribe(ch chan LogEntry) {
+	l.lock.Lock()
+	delete(l.subscribers, ch)
+	l.lock.Unlock()
+}
+
+// Logf adds an info entry to the log of the job
+func (j *Job) Logf(format string, args ...interface{}) {
+	j.log.add("info", format, args...)
+}
+
+// Errorf adds an error entry to the log of the job
+func (j *Job) Errorf(format string, args ...interface{}) {
+	j.log.add("error", format, args...)
+}
+
+// Logs returns the latest log entries of the job
+func (j *Job) Logs() []LogEntry {
+	j.log.lock.Lock()
+	defer j.log.lock.Unlock()
+	return append([]LogEntry(nil), j.log.entries...)
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// Resource is a resource accounted per job and tenant
+type Resource string
+
+const (
+	// RequestsResource is the number of sent requests
+	RequestsResource Resource = "requests"
+	// BytesResource is the total size of the received response bodies
+	BytesResource Resource = "bytes"
+	// CPUTimeResource is the time spent in the callbacks processing
+	// the responses
+	CPUTimeResource Resource = "cpu_time"
+	// StorageResource is the approximate size of the data kept in the
+	// storage of the jobs
+	StorageResource Resource = "storage"
+)
+
+// Usage contains the resources used by a job or a tenant
+type Usage struct {
+	Requests uint64 `json:"requests"`
+	Bytes    uint64 `json:"bytes"`
+	// CPUTime is the time spent in the callbacks processing the
+	// responses. Go does not measure the CPU time of goroutines, so the
+	// elapsed time from OnResponse to OnScraped is used instead.
+	CPUTime time.Duration `json:"cpu_time"`
+	// Storage is the approximate size of the visited URL hashes, cookies,
+	// fingerprints and robots.txt files kept in storage
+	Storage uint64 `json:"storage"`
+}
+
+// Quota limits the resources used by a job or a tenant. Zero values
+// mean unlimited. A job is stopped as soon as one of the resources of
+// the job or its tenant is used up.
+type Quota struct {
+	MaxRequests uint64
+	MaxBytes    uint64
+	MaxCPUTime  time.Duration
+	MaxStorage  uint64
+}
+
+// QuotaExceeded is the event emitted when a job is stopped because
+// a quota of the job or its tenant was used up
+type QuotaExceeded struct {
+	JobID  string
+	Tenant string
+	// ByTenant is true if the quota of the tenant was used up
+	ByTenant bool
+	Resource Resource
+	Limit    uint64
+	Used     uint64
+}
+
+// exceeded returns the first resource of the usage reaching the quota
+func (q Quota) exceeded(u Usage) (Resource, uint64, uint64, bool) {
+	switch {
+	case q.MaxRequests > 0 && u.Requests >= q.MaxRequests:
+		return RequestsResource, q.MaxRequests, u.Requests, true
+	case q.MaxBytes > 0 && u.Bytes >= q.MaxBytes:
+		return BytesResource, q.MaxBytes, u.Bytes, true
+	case q.MaxCPUTime > 0 && u.CPUTime >= q.MaxCPUTime:
+		return CPUTimeResource, uint64(q.MaxCPUTime), uint64(u.CPUTime), true
+	case q.MaxStorage > 0 && u.Storage >= q.MaxStorage:
+		return StorageResource, q.MaxStorage, u.Storage, true
+	}
+	return "", 0, 0, false
+}
+
+// usage counts the used resources atomically
+type usage struct {
+	requests uint64
+	bytes    uint64
+	cpuTime  int64
+	storage  int64
+}
+
+func (u *usage) get() Usage {
+	return Usage{
+		Requests: atomic.LoadUint64(&u.requests),
+		Bytes:    atomic.LoadUint64(&u.bytes),
+		CPUTime:  time.Duration(atomic.LoadInt64(&u.cpuTime)),
+		Storage:  uint64(atomic.LoadInt64(&u.storage)),
+	}
+}
+
+// meteredStorage measures the size of the data kept in a storage
+type meteredStorage struct {
+	storage.Storage
+	usage   []*usage
+	cookies map[string]int
+	robots  map[string]int
+	lock    sync.Mutex
+}
+
+func (s *meteredStorage) add(n int) {
+	for _, u := range s.usage {
+		atomic.AddInt64(&u.storage, int64(n))
+	}
+}
+
+// Visited implements storage.Storage
+func (s *meteredStorage) Visited(requestID uint64) error {
+	if err := s.Storage.Visited(requestID); err != nil {
+		return err
+	}
+	s.add(8)
+	return nil
+}
+
+// SetCookies implements storage.Storage
+func (s *meteredStorage) SetCookies(u *url.URL, cookies string) {
+	s.Storage.SetCookies(u, cookies)
+	s.lock.Lock()
+	if s.cookies == nil {
+		s.cookies = make(map[string]int)
+	}
+	delta := len(cookies) - s.cookies[u.Host]
+	s.cookies[u.Host] = len(cookies)
+	s.lock.Unlock()
+	s.add(delta)
+}
+
+// AddFingerprint implements storage.FingerprintStorage. Duplicates are
+// not detected if the underlying storage does not keep fingerprints.
+func (s *meteredStorage) AddFingerprint(fingerprint uint64, maxDistance int, URL string) (string, error) {
+	fs, ok := s.Storage.(storage.FingerprintStorage)
+	if !ok {
+		return "", nil
+	}
+	original, err := fs.AddFingerprint(fingerprint, maxDistance, URL)
+	if err == nil && original == "" {
+		s.add(8 + len(URL))
+	}
+	return original, err
+}
+
+// GetRobots implements storage.RobotsStorage
+func (s *meteredStorage) GetRobots(host string) (*storage.Robots, error) {
+	if rs, ok := s.Storage.(storage.RobotsStorage); ok {
+		return rs.GetRobots(host)
+	}
+	return nil, nil
+}
+
+// SetRobots implements storage.RobotsStorage
+func (s *meteredStorage) SetRobots(host string, r *storage.Robots) error {
+	rs, ok := s.Storage.(storage.RobotsStorage)
+	if !ok {
+		return nil
+	}
+	if err := rs.SetRobots(host, r); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	if s.robots == nil {
+		s.robots = make(map[string]int)
+	}
+	delta := len(r.Body) - s.robots[host]
+	s.robots[host] = len(r.Body)
+	s.lock.Unlock()
+	s.add(delta)
+	return nil
+}
+
+// checkQuota stops the job if a quota of the job or its tenant is used
+// up. It returns false if the job has been stopped.
+func (m *Manager) checkQuota(j *Job) bool {
+	if j.ctx.Err() != nil {
+		return false
+	}
+	resource, limit, used, ok := j.config.Quota.exceeded(j.usage.get())
+	byTenant := false
+	if !ok {
+		m.lock.RLock()
+		q, hasQuota := m.TenantResourceQuotas[j.Tenant]
+		m.lock.RUnlock()
+		if hasQuota {
+			resource, limit, used, ok = q.exceeded(j.tenantUsage.get())
+			byTenant = true
+		}
+	}
+	if !ok {
+		return true
+	}
+	j.lock.Lock()
+	first := j.quotaExceeded == ""
+	if first {
+		j.quotaExceeded = resource
+	}
+	j.lock.Unlock()
+	j.cancel()
+	if !first {
+		return false
+	}
+	if byTenant {
+		j.Errorf("Quota of tenant exceeded: %s used %d of %d", resource, used, limit)
+	} else {
+		j.Errorf("Quota exceeded: %s used %d of %d", resource, used, limit)
+	}
+	if m.OnQuotaExceeded != nil {
+		m.OnQuotaExceeded(QuotaExceeded{
+			JobID:    j.ID,
+			Tenant:   j.Tenant,
+			ByTenant: byTenant,
+			Resource: resource,
+			Limit:    limit,
+			Used:     used,
+		})
+	}
+	return false
+}
+
+// Usage returns the resources used by the jobs of a tenant. The storage
+// of removed jobs is not counted.
+func (m *Manager) Usage(tenant string) Usage {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	u, ok := m.tenantUsage[tenant]
+	if !ok {
+		return Usage{}
+	}
+	return u.get()
+}
+
+// Usage returns the resources used by the job
+func (j *Job) Usage() Usage {
+	return j.usage.get()
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// schedule starts the pending jobs allowed by the quotas and
+// rebalances the request rate shares. m.lock must be held.
+func (m *Manager) schedule() {
+	for m.MaxRunning <= 0 || m.running < m.MaxRunning {
+		j := m.next()
+		if j == nil {
+			break
+		}
+		m.running++
+		m.tenantRunning[j.Tenant]++
+		j.lock.Lock()
+		j.state = Running
+		j.started = time.Now()
+		j.lock.Unlock()
+		j.Logf("Job started")
+		go func() {
+			m.run(j)
+			m.lock.Lock()
+			m.running--
+			m.tenantRunning[j.Tenant]--
+			m.schedule()
+			m.lock.Unlock()
+			close(j.done)
+			m.wg.Done()
+		}()
+	}
+	m.rebalance()
+}
+
+// next removes the pending job to start from the queue. Jobs with
+// higher priority are preferred, then the jobs of the tenants having
+// less running jobs, then the earlier submitted jobs.
+func (m *Manager) next() *Job {
+	best := -1
+	for i, j := range m.pending {
+		if q := m.tenantQuota(j.Tenant); q > 0 && m.tenantRunning[j.Tenant] >= q {
+			continue
+		}
+		if best < 0 || m.before(j, m.pending[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	j := m.pending[best]
+	m.pending = append(m.pending[:best], m.pending[best+1:]...)
+	return j
+}
+
+func (m *Manager) before(a, b *Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if ra, rb := m.tenantRunning[a.Tenant], m.tenantRunning[b.Tenant]; ra != rb {
+		return ra < rb
+	}
+	return a.seq < b.seq
+}
+
+func (m *Manager) tenantQuota(tenant string) int {
+	if q, ok := m.TenantQuotas[tenant]; ok {
+		return q
+	}
+	return m.TenantQuota
+}
+
+// rebalance shares MaxRPS equally between the tenants having running
+// jobs and between the running jobs of a tenant. m.lock must be held.
+func (m *Manager) rebalance() {
+	tenants := 0
+	for _, n := range m.tenantRunning {
+		if n > 0 {
+			tenants++
+		}
+	}
+	for _, j := range m.jobs {
+		if j.State() != Running {
+			continue
+		}
+		rps := 0.0
+		if m.MaxRPS > 0 {
+			rps = m.MaxRPS / float64(tenants) / float64(m.tenantRunning[j.Tenant])
+		}
+		j.throttle.setRate(rps)
+	}
+}
+
+// throttle delays the requests of a job to keep its request rate
+type throttle struct {
+	interval time.Duration
+	next     time.Time
+	lock     sync.Mutex
+}
+
+func (t *throttle) setRate(rps float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if rps <= 0 {
+		t.interval = 0
+		return
+	}
+	t.interval = time.Duration(float64(time.Second) / rps)
+}
+
+func (t *throttle) rate() float64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.interval == 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(t.interval)
+}
+
+// wait blocks until the next request of the job can be sent
+func (t *throttle) wait(ctx context.Context) {
+	t.lock.Lock()
+	if t.interval == 0 {
+		t.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.lock.Unlock()
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
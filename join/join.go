@@ -0,0 +1,313 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package join merges the fields of a record scraped by several
+// callbacks and requests, e.g. the fields of a product listed on a
+// category page and the fields of its detail page. The records are
+// identified by a key, e.g. the product ID or the URL of the detail
+// page, and they are emitted when the requests started by Visit for
+// their key have finished:
+//
+//	a := join.New(save, "name", "price", "description")
+//	a.Attach(c)
+//	c.OnHTML(".product", func(e *colly.HTMLElement) {
+//		id := e.Attr("data-id")
+//		a.Merge(id, map[string]interface{}{"name": e.ChildText(".name"), "price": e.ChildText(".price")})
+//		a.Visit(c, id, e.Request.AbsoluteURL(e.ChildAttr("a", "href")))
+//	})
+//	c.OnHTML("#description", func(e *colly.HTMLElement) {
+//		a.SetResponse(e.Response, "description", e.Text)
+//	})
+//	c.Visit("https://example.com/products")
+//	c.Wait()
+//	a.Flush()
+package join
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// KeyKey is the Context key of the record key of the requests
+const KeyKey = "join_key"
+
+// Record is a merged record
+type Record struct {
+	// Key identifies the record
+	Key string
+	// Fields contains the merged fields by name
+	Fields map[string]interface{}
+	// Missing are the required fields which were not set
+	Missing []string
+	// Sources are the URLs of the responses contributing to the record
+	Sources []string
+}
+
+// Complete returns true if every required field of the record is set
+func (r *Record) Complete() bool {
+	return len(r.Missing) == 0
+}
+
+type pending struct {
+	record *Record
+	// requests is the number of the unfinished requests of the record
+	requests int
+}
+
+// Aggregator merges the fields of the records
+type Aggregator struct {
+	// Required are the names of the fields expected in every record.
+	// Records without them are emitted as incomplete.
+	Required []string
+	// OnRecord is called with every emitted record
+	OnRecord func(*Record)
+	lock     sync.Mutex
+	pending  map[string]*pending
+	emitted  map[string]bool
+	// tracked contains the request IDs of the contexts created by Visit,
+	// 0 until the request is started
+	tracked map[*colly.Context]uint32
+}
+
+// New creates an Aggregator of the records having the required fields
+func New(onRecord func(*Record), required ...string) *Aggregator {
+	return &Aggregator{
+		Required: required,
+		OnRecord: onRecord,
+	}
+}
+
+// Attach registers the callbacks tracking the requests started by Visit
+// in the Collector. Attach has to be called before the other callbacks
+// of the Collector are registered.
+func (a *Aggregator) Attach(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		a.lock.Lock()
+		if id, ok := a.tracked[r.Ctx]; ok && id == 0 {
+			a.tracked[r.Ctx] = r.ID
+		}
+		a.lock.Unlock()
+	})
+	c.OnScraped(func(r *colly.Response) {
+		a.done(r.Request)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r.Request != nil {
+			a.done(r.Request)
+		}
+	})
+}
+
+// Key returns the record key of a request started by Visit
+func Key(r *colly.Request) string {
+	if r == nil || r.Ctx == nil {
+		return ""
+	}
+	return r.Ctx.Get(KeyKey)
+}
+
+// Visit starts a GET request contributing to the record of the key. The
+// record is emitted when the requests started by Visit for its key have
+// finished. The requests followed from the visited page share its
+// Context and key, but they are not waited for.
+func (a *Aggregator) Visit(c *colly.Collector, key, URL string) error {
+	ctx := colly.NewContext()
+	ctx.Put(KeyKey, key)
+	a.lock.Lock()
+	p := a.get(key)
+	if p == nil {
+		a.lock.Unlock()
+		return nil
+	}
+	p.requests++
+	a.tracked[ctx] = 0
+	a.lock.Unlock()
+	err := c.Request("GET", URL, nil, ctx, nil)
+	if err != nil {
+		a.finish(ctx, key)
+	}
+	return err
+}
+
+// Set sets a field of the record of the key
+func (a *Aggregator) Set(key, field string, value interface{}) {
+	a.Merge(key, map[string]interface{}{field: value})
+}
+
+// Merge sets the fields of the record of the key. Empty values don't
+// overwrite the fields set before. Fields of emitted records are ignored.
+func (a *Aggregator) Merge(key string, fields map[string]interface{}) {
+	a.merge(key, "", fields)
+}
+
+// SetResponse sets a field of the record of a response started by Visit
+func (a *Aggregator) SetResponse(r *colly.Response, field string, value interface{}) {
+	a.MergeResponse(r, map[string]interface{}{field: value})
+}
+
+// MergeResponse sets the fields of the record of a response started by
+// Visit and adds its URL to the sources of the record
+func (a *Aggregator) MergeResponse(r *colly.Response, fields map[string]interface{}) {
+	if key := Key(r.Request); key != "" {
+		a.merge(key, r.Request.URL.String(), fields)
+	}
+}
+
+// Done emits the record of the key without waiting for its requests
+func (a *Aggregator) Done(key string) {
+	a.lock.Lock()
+	p, ok := a.pending[key]
+	if !ok {
+		a.lock.Unlock()
+		return
+	}
+	record := a.remove(key, p)
+	a.lock.Unlock()
+	a.emit(record)
+}
+
+// Flush emits every pending record, e.g. the records whose requests
+// were aborted. Call it after the crawl has finished.
+func (a *Aggregator) Flush() {
+	a.lock.Lock()
+	records := make([]*Record, 0, len(a.pending))
+	for key, p := range a.pending {
+		records = append(records, a.remove(key, p))
+	}
+	a.tracked = nil
+	a.lock.Unlock()
+	for _, r := range records {
+		a.emit(r)
+	}
+}
+
+// Pending returns the number of the records not emitted yet
+func (a *Aggregator) Pending() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.pending)
+}
+
+func (a *Aggregator) merge(key, source string, fields map[string]interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	p := a.get(key)
+	if p == nil {
+		return
+	}
+	for k, v := range fields {
+		if _, ok := p.record.Fields[k]; ok && isEmpty(v) {
+			continue
+		}
+		p.record.Fields[k] = v
+	}
+	if source != "" {
+		for _, s := range p.record.Sources {
+			if s == source {
+				return
+			}
+		}
+		p.record.Sources = append(p.record.Sources, source)
+	}
+}
+
+// get returns the pending record of the key or nil if it was emitted.
+// a.lock must be held.
+func (a *Aggregator) get(key string) *pending {
+	if a.pending == nil {
+		a.pending = make(map[string]*pending)
+		a.emitted = make(map[string]bool)
+	}
+	if a.tracked == nil {
+		a.tracked = make(map[*colly.Context]uint32)
+	}
+	if a.emitted[key] {
+		return nil
+	}
+	p, ok := a.pending[key]
+	if !ok {
+		p = &pending{record: &Record{Key: key, Fields: make(map[string]interface{})}}
+		a.pending[key] = p
+	}
+	return p
+}
+
+// done finishes a request started by Visit
+func (a *Aggregator) done(r *colly.Request) {
+	a.lock.Lock()
+	id, ok := a.tracked[r.Ctx]
+	a.lock.Unlock()
+	if ok && id == r.ID {
+		a.finish(r.Ctx, Key(r))
+	}
+}
+
+// finish emits the record of the key if it has no more unfinished
+// requests
+func (a *Aggregator) finish(ctx *colly.Context, key string) {
+	a.lock.Lock()
+	if _, ok := a.tracked[ctx]; !ok {
+		a.lock.Unlock()
+		return
+	}
+	delete(a.tracked, ctx)
+	p, ok := a.pending[key]
+	if !ok {
+		a.lock.Unlock()
+		return
+	}
+	p.requests--
+	if p.requests > 0 {
+		a.lock.Unlock()
+		return
+	}
+	record := a.remove(key, p)
+	a.lock.Unlock()
+	a.emit(record)
+}
+
+// remove removes the pending record and sets its missing fields.
+// a.lock must be held.
+func (a *Aggregator) remove(key string, p *pending) *Record {
+	delete(a.pending, key)
+	a.emitted[key] = true
+	record := p.record
+	for _, f := range a.Required {
+		if v, ok := record.Fields[f]; !ok || isEmpty(v) {
+			record.Missing = append(record.Missing, f)
+		}
+	}
+	return record
+}
+
+func (a *Aggregator) emit(r *Record) {
+	if a.OnRecord != nil {
+		a.OnRecord(r)
+	}
+}
+
+// isEmpty returns true if v is nil or the zero value of its type
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
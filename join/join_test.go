@@ -0,0 +1,140 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package join
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const listPage = `<html><body>
+<div class="product" data-id="1"><span class="name">One</span><a href="/p/1">more</a></div>
+<div class="product" data-id="2"><span class="name">Two</span><a href="/p/2">more</a></div>
+<div class="product" data-id="3"><span class="name">Three</span><a href="/p/missing">more</a></div>
+</body></html>`
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(listPage))
+	})
+	mux.HandleFunc("/p/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><p id="price">10</p><a href="/reviews/1">reviews</a></body></html>`))
+	})
+	mux.HandleFunc("/p/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><p id="price">20</p><span class="name"></span></body></html>`))
+	})
+	mux.HandleFunc("/reviews/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><p id="rating">5</p></body></html>`))
+	})
+	return httptest.NewServer(mux)
+}
+
+type collected struct {
+	lock    sync.Mutex
+	records map[string]*Record
+}
+
+func (c *collected) add(r *Record) {
+	c.lock.Lock()
+	c.records[r.Key] = r
+	c.lock.Unlock()
+}
+
+func testJoin(t *testing.T, async bool) {
+	ts := newServer()
+	defer ts.Close()
+
+	records := &collected{records: make(map[string]*Record)}
+	a := New(records.add, "name", "price")
+	c := colly.NewCollector(colly.Async(async))
+	a.Attach(c)
+	c.OnHTML(".product", func(e *colly.HTMLElement) {
+		id := e.Attr("data-id")
+		a.Set(id, "name", e.ChildText(".name"))
+		a.Visit(c, id, e.Request.AbsoluteURL(e.ChildAttr("a", "href")))
+	})
+	c.OnHTML("#price", func(e *colly.HTMLElement) {
+		a.MergeResponse(e.Response, map[string]interface{}{
+			"price": e.Text,
+			"name":  e.DOM.Parent().Find(".name").Text(),
+		})
+		e.Request.Visit(e.Request.AbsoluteURL(e.DOM.Parent().Find("a").AttrOr("href", "")))
+	})
+	c.OnHTML("#rating", func(e *colly.HTMLElement) {
+		a.SetResponse(e.Response, "rating", e.Text)
+	})
+	c.Visit(ts.URL + "/")
+	c.Wait()
+	a.Flush()
+
+	if len(records.records) != 3 || a.Pending() != 0 {
+		t.Fatalf("Unexpected records: %v", records.records)
+	}
+	r := records.records["2"]
+	if !reflect.DeepEqual(r.Fields, map[string]interface{}{"name": "Two", "price": "20"}) || !r.Complete() {
+		t.Errorf("Invalid merged record: %+v", r)
+	}
+	if !reflect.DeepEqual(r.Sources, []string{ts.URL + "/p/2"}) {
+		t.Errorf("Invalid sources: %v", r.Sources)
+	}
+	if r := records.records["3"]; !reflect.DeepEqual(r.Missing, []string{"price"}) {
+		t.Errorf("Invalid missing fields of a failed request: %+v", r)
+	}
+	if r := records.records["1"]; r.Fields["price"] != "10" {
+		t.Errorf("Invalid record: %+v", r)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	testJoin(t, false)
+}
+
+func TestJoinAsync(t *testing.T) {
+	testJoin(t, true)
+}
+
+func TestDone(t *testing.T) {
+	var records []*Record
+	a := New(func(r *Record) {
+		records = append(records, r)
+	}, "a", "b")
+	a.Merge("x", map[string]interface{}{"a": 1, "b": ""})
+	a.Merge("y", map[string]interface{}{"b": []string{"b"}})
+	a.Set("x", "a", 0)
+	a.Done("x")
+	a.Set("x", "b", "late")
+	if len(records) != 1 || records[0].Fields["a"] != 1 || records[0].Fields["b"] != "" {
+		t.Fatalf("Invalid records: %+v", records)
+	}
+	if !reflect.DeepEqual(records[0].Missing, []string{"b"}) {
+		t.Errorf("Invalid missing fields: %v", records[0].Missing)
+	}
+	a.Flush()
+	keys := []string{}
+	for _, r := range records {
+		keys = append(keys, r.Key)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"x", "y"}) {
+		t.Errorf("Invalid emitted keys: %v", keys)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+type jsonCallbackContainer struct {
+	typ      reflect.Type
+	pointer  bool
+	function reflect.Value
+}
+
+var responseType = reflect.TypeOf(&Response{})
+
+// PostJSON starts a collector job by creating a POST request with the
+// JSON encoding of v as body. PostJSON also calls the previously
+// provided callbacks.
+func (c *Collector) PostJSON(URL string, v interface{}) error {
+	return c.requestJSON("POST", URL, 1, v, nil)
+}
+
+// PutJSON starts a collector job by creating a PUT request with the
+// JSON encoding of v as body. PutJSON also calls the previously
+// provided callbacks.
+func (c *Collector) PutJSON(URL string, v interface{}) error {
+	return c.requestJSON("PUT", URL, 1, v, nil)
+}
+
+// PatchJSON starts a collector job by creating a PATCH request with the
+// JSON encoding of v as body. PatchJSON also calls the previously
+// provided callbacks.
+func (c *Collector) PatchJSON(URL string, v interface{}) error {
+	return c.requestJSON("PATCH", URL, 1, v, nil)
+}
+
+// PostJSON continues a collector job by creating a POST request with
+// the JSON encoding of v as body and preserves the Context of the
+// previous request
+func (r *Request) PostJSON(URL string, v interface{}) error {
+	return r.collector.requestJSON("POST", r.AbsoluteURL(URL), r.Depth+1, v, r.Ctx)
+}
+
+// PutJSON continues a collector job by creating a PUT request with the
+// JSON encoding of v as body and preserves the Context of the previous
+// request
+func (r *Request) PutJSON(URL string, v interface{}) error {
+	return r.collector.requestJSON("PUT", r.AbsoluteURL(URL), r.Depth+1, v, r.Ctx)
+}
+
+// PatchJSON continues a collector job by creating a PATCH request with
+// the JSON encoding of v as body and preserves the Context of the
+// previous request
+func (r *Request) PatchJSON(URL string, v interface{}) error {
+	return r.collector.requestJSON("PATCH", r.AbsoluteURL(URL), r.Depth+1, v, r.Ctx)
+}
+
+func (c *Collector) requestJSON(method, URL string, depth int, v interface{}, ctx *Context) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	hdr := http.Header{}
+	hdr.Set("Content-Type", "application/json")
+	hdr.Set("Accept", "application/json")
+	hdr.Set("User-Agent", c.UserAgent)
+	return c.scrape(URL, method, depth, bytes.NewReader(body), ctx, hdr, true)
+}
+
+// DecodeJSON decodes the JSON body of the response into v
+func (r *Response) DecodeJSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// OnJSON registers a typed function. Function will be executed on every
+// response with JSON Content-Type, e.g. "application/json" or
+// "application/ld+json". The function must be a func(*Response, T) or a
+// func(*Response, *T). The response body is decoded into a new T for
+// every call, decoding errors are passed to the OnError callbacks.
+//
+// OnJSON panics if f is not a valid function.
+func (c *Collector) OnJSON(f interface{}) {
+	fn := reflect.ValueOf(f)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 0 || t.In(0) != responseType {
+		panic("colly: OnJSON callback must be a func(*colly.Response, T)")
+	}
+	cc := &jsonCallbackContainer{typ: t.In(1), function: fn}
+	if cc.typ.Kind() == reflect.Ptr {
+		cc.typ = cc.typ.Elem()
+		cc.pointer = true
+	}
+	c.lock.Lock()
+	c.jsonCallbacks = append(c.jsonCallbacks, cc)
+	c.lock.Unlock()
+}
+
+func (c *Collector) handleOnJSON(resp *Response) error {
+	if len(c.jsonCallbacks) == 0 || resp.Headers == nil {
+		return nil
+	}
+	if !strings.Contains(strings.ToLower(resp.Headers.Get("Content-Type")), "json") {
+		return nil
+	}
+	for _, cc := range c.jsonCallbacks {
+		v := reflect.New(cc.typ)
+		if err := json.Unmarshal(resp.Body, v.Interface()); err != nil {
+			return err
+		}
+		if !cc.pointer {
+			v = v.Elem()
+		}
+		cc.function.Call([]reflect.Value{reflect.ValueOf(resp), v})
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type jsonItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type jsonEcho struct {
+	Method      string   `json:"method"`
+	ContentType string   `json:"content_type"`
+	Accept      string   `json:"accept"`
+	Item        jsonItem `json:"item"`
+}
+
+func newJSONServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{"))
+			return
+		}
+		e := jsonEcho{
+			Method:      r.Method,
+			ContentType: r.Header.Get("Content-Type"),
+			Accept:      r.Header.Get("Accept"),
+		}
+		json.NewDecoder(r.Body).Decode(&e.Item)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(e)
+	}))
+}
+
+func TestJSONRequests(t *testing.T) {
+	ts := newJSONServer()
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit())
+	var echoes []*jsonEcho
+	c.OnJSON(func(r *Response, e *jsonEcho) {
+		echoes = append(echoes, e)
+	})
+	var methods []string
+	c.OnJSON(func(r *Response, e jsonEcho) {
+		methods = append(methods, e.Method)
+	})
+	item := jsonItem{Name: "colly", Count: 3}
+	for _, f := range []func(string, interface{}) error{c.PostJSON, c.PutJSON, c.PatchJSON} {
+		if err := f(ts.URL, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(echoes) != 3 || len(methods) != 3 {
+		t.Fatalf("Unexpected callback calls: %d %d", len(echoes), len(methods))
+	}
+	for i, method := range []string{"POST", "PUT", "PATCH"} {
+		e := echoes[i]
+		if e.Method != method || methods[i] != method {
+			t.Errorf("Invalid method %s, expected %s", e.Method, method)
+		}
+		if e.ContentType != "application/json" || e.Accept != "application/json" {
+			t.Errorf("Invalid headers %q %q", e.ContentType, e.Accept)
+		}
+		if e.Item != item {
+			t.Errorf("Invalid body %+v", e.Item)
+		}
+	}
+
+	var decodeErr error
+	c.OnError(func(r *Response, err error) {
+		decodeErr = err
+	})
+	c.Visit(ts.URL + "/invalid")
+	if decodeErr == nil {
+		t.Error("Invalid JSON was not reported")
+	}
+}
+
+func TestOnJSONInvalidCallback(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Invalid callback was accepted")
+		}
+	}()
+	NewCollector().OnJSON(func(r *Response) {})
+}
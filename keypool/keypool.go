@@ -0,0 +1,344 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keypool rotates the API keys of the requests of a collector
+// within their rate limit budgets. The quotas of the keys are tracked
+// locally and by the rate limit headers of the responses. Exhausted
+// keys are parked until their quota resets, and the requests refused
+// by the API are retried with other keys:
+//
+//	p := keypool.New(
+//		keypool.Key{Value: "key1", Limit: 1000, Period: time.Hour},
+//		keypool.Key{Value: "key2", Limit: 1000, Period: time.Hour},
+//	)
+//	p.Header, p.Prefix = "Authorization", "Bearer "
+//	c.Use(p)
+package keypool
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrNoKeys is the error returned when registering a Pool without keys
+var ErrNoKeys = errors.New("Key pool has no keys")
+
+// Key is an API key and its quota
+type Key struct {
+	// Value is sent with the requests
+	Value string
+	// Limit is the number of the requests allowed in a Period. 0 means
+	// that the quota is known from the response headers only.
+	Limit int
+	// Period is the length of the quota periods, e.g. time.Hour
+	Period time.Duration
+}
+
+// Status is the state of a key
+type Status struct {
+	// Key is the value of the key
+	Key string
+	// Used is the number of the requests sent with the key
+	Used int
+	// Remaining is the remaining quota reported by the API or -1 if it
+	// is unknown
+	Remaining int
+	// ParkedUntil is the end of the parking of an exhausted key
+	ParkedUntil time.Time
+}
+
+type keyState struct {
+	Key
+	used        int
+	remaining   int
+	windowStart time.Time
+	windowUsed  int
+	parkedUntil time.Time
+}
+
+// Pool attaches the keys to the requests of a Collector. Register it by
+// Collector.Use. Requests wait for a key if every key is parked.
+type Pool struct {
+	colly.BasePlugin
+	// Header is the request header of the keys. It is "X-API-Key" by
+	// default.
+	Header string
+	// Prefix is prepended to the keys in Header, e.g. "Bearer "
+	Prefix string
+	// Param sends the keys in a query parameter instead of Header if it
+	// is not empty
+	Param string
+	// RemainingHeader is the response header of the remaining quota. It
+	// is "X-RateLimit-Remaining" by default.
+	RemainingHeader string
+	// ResetHeader is the response header of the reset time of the quota
+	// in Unix time or in seconds. It is "X-RateLimit-Reset" by default.
+	ResetHeader string
+	// ParkTime is the parking time of the exhausted keys if the API
+	// does not send their reset time. It is one minute by default.
+	ParkTime time.Duration
+	// Retries is the number of retries of the requests refused by the
+	// API with other keys. New sets it to the number of keys minus one.
+	// The refused requests are retried by an OnError callback, so they
+	// are not retried if ParseHTTPErrorResponse is enabled.
+	Retries   int
+	collector *colly.Collector
+	lock      sync.Mutex
+	keys      []*keyState
+	byValue   map[string]*keyState
+	next      int
+	now       func() time.Time
+}
+
+// retriesKey is the Context key of the number of retries of a request
+const retriesKey = "keypool_retries"
+
+// New creates a Pool of keys
+func New(keys ...Key) *Pool {
+	p := &Pool{
+		Retries: len(keys) - 1,
+		byValue: make(map[string]*keyState, len(keys)),
+		now:     time.Now,
+	}
+	for _, k := range keys {
+		s := &keyState{Key: k, remaining: -1}
+		p.keys = append(p.keys, s)
+		p.byValue[k.Value] = s
+	}
+	return p
+}
+
+// Init registers the callbacks tracking the quotas of the keys
+func (p *Pool) Init(c *colly.Collector) error {
+	if len(p.keys) == 0 {
+		return ErrNoKeys
+	}
+	p.collector = c
+	c.OnResponseHeaders(p.update)
+	c.OnError(p.retry)
+	return nil
+}
+
+// OnRequest attaches a key to the request. It waits for a key if every
+// key is parked and aborts the request if the Context of the Collector
+// is done meanwhile.
+func (p *Pool) OnRequest(r *colly.Request) {
+	k := p.acquire()
+	if k == nil {
+		r.Abort()
+		return
+	}
+	if p.Param != "" {
+		q := r.URL.Query()
+		q.Set(p.Param, k.Value)
+		r.URL.RawQuery = q.Encode()
+		return
+	}
+	r.Headers.Set(p.header(), p.Prefix+k.Value)
+}
+
+// Status returns the state of the keys
+func (p *Pool) Status() []Status {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	status := make([]Status, len(p.keys))
+	for i, k := range p.keys {
+		status[i] = Status{
+			Key:         k.Value,
+			Used:        k.used,
+			Remaining:   k.remaining,
+			ParkedUntil: k.parkedUntil,
+		}
+	}
+	return status
+}
+
+// acquire returns the next available key. It returns nil if the Context
+// of the Collector is done while waiting for a key.
+func (p *Pool) acquire() *keyState {
+	for {
+		p.lock.Lock()
+		now := p.now()
+		var wakeUp time.Time
+		for i := range p.keys {
+			k := p.keys[(p.next+i)%len(p.keys)]
+			if k.Limit > 0 && k.Period > 0 {
+				if now.Sub(k.windowStart) >= k.Period {
+					k.windowStart, k.windowUsed = now, 0
+				}
+				if k.windowUsed >= k.Limit && k.parkedUntil.Before(k.windowStart.Add(k.Period)) {
+					k.parkedUntil = k.windowStart.Add(k.Period)
+				}
+			}
+			if now.Before(k.parkedUntil) {
+				if wakeUp.IsZero() || k.parkedUntil.Before(wakeUp) {
+					wakeUp = k.parkedUntil
+				}
+				continue
+			}
+			k.used++
+			k.windowUsed++
+			if k.remaining > 0 {
+				k.remaining--
+			}
+			p.next = (p.next + i + 1) % len(p.keys)
+			p.lock.Unlock()
+			return k
+		}
+		p.lock.Unlock()
+		t := time.NewTimer(wakeUp.Sub(now))
+		select {
+		case <-t.C:
+		case <-p.collector.Context.Done():
+			t.Stop()
+			return nil
+		}
+	}
+}
+
+// update tracks the quota of the key of a response by its headers
+func (p *Pool) update(r *colly.Response) {
+	k := p.keyOf(r.Request)
+	if k == nil || r.Headers == nil {
+		return
+	}
+	now := p.now()
+	remaining, hasRemaining := -1, false
+	if v := r.Headers.Get(p.remainingHeader()); v != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			remaining, hasRemaining = n, true
+		}
+	}
+	refused := r.StatusCode == http.StatusTooManyRequests || (r.StatusCode == http.StatusForbidden && hasRemaining && remaining <= 0)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if hasRemaining {
+		k.remaining = remaining
+	}
+	if !refused && (!hasRemaining || remaining > 0) {
+		return
+	}
+	until, ok := parseReset(r.Headers.Get(p.resetHeader()), now)
+	if !ok {
+		until, ok = parseRetryAfter(r.Headers.Get("Retry-After"), now)
+	}
+	if !ok {
+		until = now.Add(p.parkTime())
+	}
+	if until.After(k.parkedUntil) {
+		k.parkedUntil = until
+	}
+}
+
+// retry retries the requests refused by the API with other keys
+func (p *Pool) retry(r *colly.Response, err error) {
+	if r.StatusCode != http.StatusTooManyRequests && r.StatusCode != http.StatusForbidden {
+		return
+	}
+	k := p.keyOf(r.Request)
+	if k == nil {
+		return
+	}
+	p.lock.Lock()
+	parked := p.now().Before(k.parkedUntil)
+	p.lock.Unlock()
+	if !parked {
+		return
+	}
+	retries, _ := r.Ctx.GetAny(retriesKey).(int)
+	if retries >= p.Retries {
+		return
+	}
+	r.Ctx.Put(retriesKey, retries+1)
+	r.Request.Retry()
+}
+
+// keyOf returns the key of a request
+func (p *Pool) keyOf(r *colly.Request) *keyState {
+	if r == nil {
+		return nil
+	}
+	var value string
+	if p.Param != "" {
+		value = r.URL.Query().Get(p.Param)
+	} else if r.Headers != nil {
+		value = strings.TrimPrefix(r.Headers.Get(p.header()), p.Prefix)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.byValue[value]
+}
+
+func (p *Pool) header() string {
+	if p.Header == "" {
+		return "X-API-Key"
+	}
+	return p.Header
+}
+
+func (p *Pool) remainingHeader() string {
+	if p.RemainingHeader == "" {
+		return "X-RateLimit-Remaining"
+	}
+	return p.RemainingHeader
+}
+
+func (p *Pool) resetHeader() string {
+	if p.ResetHeader == "" {
+		return "X-RateLimit-Reset"
+	}
+	return p.ResetHeader
+}
+
+func (p *Pool) parkTime() time.Duration {
+	if p.ParkTime <= 0 {
+		return time.Minute
+	}
+	return p.ParkTime
+}
+
+// unixTimeThreshold separates the reset times in Unix time from the
+// reset times in seconds
+const unixTimeThreshold = 1000000000
+
+// parseReset parses a reset time in Unix time or in seconds
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	if n >= unixTimeThreshold {
+		return time.Unix(0, int64(n*float64(time.Second))), true
+	}
+	return now.Add(time.Duration(n * float64(time.Second))), true
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as a date
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return now.Add(time.Duration(n) * time.Second), true
+	}
+	t, err := http.ParseTime(v)
+	return t, err == nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keypool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Authorization")
+		if key == "" {
+			key = r.URL.Query().Get("api_key")
+		}
+		switch key {
+		case "Bearer exhausted":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "Bearer last":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+		}
+		w.Write([]byte(key))
+	}))
+}
+
+func newCollector(t *testing.T, p *Pool) (*colly.Collector, *[]string) {
+	c := colly.NewCollector(colly.AllowURLRevisit())
+	if err := c.Use(p); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	c.OnResponse(func(r *colly.Response) {
+		keys = append(keys, string(r.Body))
+	})
+	return c, &keys
+}
+
+func TestRotation(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+
+	p := New(Key{Value: "a"}, Key{Value: "b"})
+	p.Header, p.Prefix = "Authorization", "Bearer "
+	c, keys := newCollector(t, p)
+	for i := 0; i < 4; i++ {
+		c.Visit(ts.URL)
+	}
+	if !reflect.DeepEqual(*keys, []string{"Bearer a", "Bearer b", "Bearer a", "Bearer b"}) {
+		t.Errorf("Keys were not rotated: %v", *keys)
+	}
+	if s := p.Status(); s[0].Used != 2 || s[1].Used != 2 || s[0].Remaining != -1 {
+		t.Errorf("Invalid status: %+v", s)
+	}
+
+	p = New(Key{Value: "a"})
+	p.Param = "api_key"
+	c, keys = newCollector(t, p)
+	c.Visit(ts.URL + "/?q=1")
+	if !reflect.DeepEqual(*keys, []string{"a"}) {
+		t.Errorf("Key was not sent as parameter: %v", *keys)
+	}
+
+	if err := colly.NewCollector().Use(New()); err != ErrNoKeys {
+		t.Errorf("Expected ErrNoKeys, got %v", err)
+	}
+}
+
+func TestExhaustedKeys(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+
+	p := New(Key{Value: "exhausted"}, Key{Value: "last"}, Key{Value: "ok"})
+	p.Header, p.Prefix = "Authorization", "Bearer "
+	c, keys := newCollector(t, p)
+	start := time.Now()
+	c.Visit(ts.URL)
+	c.Visit(ts.URL)
+	c.Visit(ts.URL)
+	// the refused request is retried with the next key, which is parked
+	// after its last request for ParkTime, so the third key is used by
+	// the following requests
+	if !reflect.DeepEqual(*keys, []string{"Bearer last", "Bearer ok", "Bearer ok"}) {
+		t.Errorf("Unexpected keys: %v", *keys)
+	}
+	s := p.Status()
+	if until := s[0].ParkedUntil.Sub(start); until < 59*time.Second || until > 61*time.Second {
+		t.Errorf("Invalid parking of the refused key: %v", until)
+	}
+	if until := s[1].ParkedUntil.Sub(start); until < 59*time.Second || until > 61*time.Second || s[1].Remaining != 0 {
+		t.Errorf("Invalid parking of the exhausted key: %+v", s[1])
+	}
+}
+
+func TestLocalQuota(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+
+	p := New(Key{Value: "a", Limit: 1, Period: 100 * time.Millisecond}, Key{Value: "b", Limit: 1, Period: 100 * time.Millisecond})
+	p.Header, p.Prefix = "Authorization", "Bearer "
+	c, keys := newCollector(t, p)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c.Visit(ts.URL)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Request did not wait for the quota: %v", d)
+	}
+	if len(*keys) != 3 {
+		t.Errorf("Unexpected responses: %v", *keys)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Context = ctx
+	p.lock.Lock()
+	for _, k := range p.keys {
+		k.parkedUntil = time.Now().Add(time.Hour)
+	}
+	p.lock.Unlock()
+	cancel()
+	*keys = nil
+	c.Visit(ts.URL)
+	if len(*keys) != 0 {
+		t.Error("Request was not aborted")
+	}
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	if r, ok := parseReset("30", now); !ok || !r.Equal(now.Add(30*time.Second)) {
+		t.Errorf("Invalid relative reset: %v", r)
+	}
+	if r, ok := parseReset("1500000100", now); !ok || !r.Equal(now.Add(100*time.Second)) {
+		t.Errorf("Invalid absolute reset: %v", r)
+	}
+	if _, ok := parseReset("soon", now); ok {
+		t.Error("Invalid reset was parsed")
+	}
+	if r, ok := parseRetryAfter("Fri, 14 Jul 2017 02:41:00 GMT", now); !ok || !r.Equal(now.Add(time.Minute)) {
+		t.Errorf("Invalid Retry-After date: %v", r)
+	}
+}
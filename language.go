@@ -0,0 +1,221 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// DetectLanguage enables the language detection of the responses,
+// which sets Response.Language
+func DetectLanguage() CollectorOption {
+	return func(c *Collector) {
+		c.DetectLanguage = true
+	}
+}
+
+// LanguageFilter skips the OnResponse, OnHTML, OnXML and OnScraped
+// callbacks of the pages whose detected language is not one of the
+// languages, e.g. LanguageFilter("en", "de"). Pages of unknown language
+// are processed. It enables DetectLanguage.
+func LanguageFilter(langs ...string) CollectorOption {
+	return func(c *Collector) {
+		c.DetectLanguage = true
+		c.LanguageFilter = langs
+	}
+}
+
+// minLanguageStopwords is the minimum number of stopwords to detect the
+// language of a text
+const minLanguageStopwords = 3
+
+// languageStopwords contains the most frequent words of the detected
+// languages written in Latin script
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "are", "this", "you", "on", "not", "be", "have"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "auf", "für", "ich", "von", "dem", "auch"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "du", "que", "pas", "pour", "dans", "sur", "avec", "ce", "qui", "au"},
+	"es": {"el", "la", "los", "las", "y", "es", "que", "de", "en", "un", "una", "por", "con", "para", "del", "se", "no", "como"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "gli", "le", "nel", "è", "anche"},
+	"pt": {"o", "a", "os", "as", "e", "de", "que", "não", "um", "uma", "para", "com", "do", "da", "em", "é", "por", "mais"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "op", "te", "zijn", "met", "voor", "ook", "maar", "er", "ik", "wordt"},
+	"sv": {"och", "att", "det", "är", "som", "en", "på", "för", "med", "av", "inte", "den", "har", "jag", "till", "om", "ett", "var"},
+	"pl": {"i", "w", "na", "nie", "się", "z", "jest", "to", "że", "do", "jak", "co", "ale", "od", "po", "tak", "dla", "są"},
+}
+
+// stopwordLanguages maps the stopwords to their languages
+var stopwordLanguages = func() map[string][]string {
+	m := make(map[string][]string)
+	for lang, words := range languageStopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// scriptLanguages are the languages detected by their script
+var scriptLanguages = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+	{"th", unicode.Thai},
+	{"hi", unicode.Devanagari},
+}
+
+// detectLanguage returns the ISO 639-1 code of the language of a
+// response. The language is detected from the text of HTML and plain
+// text responses. The language declared by the lang attribute of the
+// html tag or by the Content-Language header is used if the text is too
+// short to detect its language.
+func detectLanguage(r *Response) string {
+	contentType := ""
+	if r.Headers != nil {
+		contentType = strings.ToLower(r.Headers.Get("Content-Type"))
+	}
+	declared := ""
+	var text string
+	switch {
+	case strings.Contains(contentType, "html"):
+		declared = htmlLanguage(r.Body)
+		text = htmlText(r.Body)
+	case strings.HasPrefix(contentType, "text/plain"):
+		text = string(r.Body)
+	}
+	if lang := textLanguage(text); lang != "" {
+		return lang
+	}
+	if declared == "" && r.Headers != nil {
+		declared = strings.Split(r.Headers.Get("Content-Language"), ",")[0]
+	}
+	return primaryLanguage(declared)
+}
+
+// textLanguage returns the language of a text or an empty string if it
+// can not be detected
+func textLanguage(text string) string {
+	scripts := make(map[string]int)
+	latin := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+	// kanji are used in Japanese with kana
+	if scripts["ja"] > 0 && scripts["ja"]*5 >= scripts["zh"] {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+	best, bestCount := "", latin
+	for lang, n := range scripts {
+		if n > bestCount {
+			best, bestCount = lang, n
+		}
+	}
+	if best != "" {
+		if best == "ru" && strings.ContainsAny(text, "їєіґЇЄІҐ") {
+			return "uk"
+		}
+		return best
+	}
+	counts := make(map[string]int)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, lang := range stopwordLanguages[w] {
+			counts[lang]++
+		}
+	}
+	best, bestCount, second := "", 0, 0
+	for lang, n := range counts {
+		if n > bestCount || (n == bestCount && lang < best) {
+			second = bestCount
+			best, bestCount = lang, n
+		} else if n > second {
+			second = n
+		}
+	}
+	if bestCount < minLanguageStopwords || bestCount == second {
+		return ""
+	}
+	return best
+}
+
+// htmlLanguage returns the language declared by the lang attribute of
+// the html tag or by a content-language meta tag
+func htmlLanguage(body []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			switch string(name) {
+			case "html":
+				if attrs["lang"] != "" {
+					return attrs["lang"]
+				}
+			case "meta":
+				if strings.EqualFold(attrs["http-equiv"], "content-language") {
+					return strings.Split(attrs["content"], ",")[0]
+				}
+			case "body":
+				return ""
+			}
+		}
+	}
+}
+
+// primaryLanguage returns the lowercase primary subtag of a language
+// tag, e.g. "en" of "en-US"
+func primaryLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) != 2 {
+		return ""
+	}
+	return tag
+}
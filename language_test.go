@@ -0,0 +1,92 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var languagePages = map[string]string{
+	"/en":       `<html lang="de"><body><p>This is the story of a man and his dog. It was written for the children of the town.</p></body></html>`,
+	"/de":       `<html><body><p>Das ist die Geschichte von einem Mann und seinem Hund, der nicht mit der Katze spielen will.</p><script>var the = "the and of to is"</script></body></html>`,
+	"/fr":       `<html><body><p>Le chat est dans la maison et il ne veut pas sortir avec les enfants pour le moment.</p></body></html>`,
+	"/ja":       `<html><body><p>これは日本語の文章です。東京で書かれました。</p></body></html>`,
+	"/ru":       `<html><body><p>Это простой текст на русском языке.</p></body></html>`,
+	"/declared": `<html lang="es-MX"><body><p>Hola</p></body></html>`,
+	"/unknown":  `<html><body><p>12345</p></body></html>`,
+}
+
+func newLanguageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/header" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Language", "it-IT, en")
+			w.Write([]byte("Ciao"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(languagePages[r.URL.Path]))
+	}))
+}
+
+func TestDetectLanguage(t *testing.T) {
+	ts := newLanguageServer()
+	defer ts.Close()
+
+	c := NewCollector(DetectLanguage())
+	languages := make(map[string]string)
+	c.OnResponse(func(r *Response) {
+		languages[r.Request.URL.Path] = r.Language
+	})
+	for p := range languagePages {
+		c.Visit(ts.URL + p)
+	}
+	c.Visit(ts.URL + "/header")
+	expected := map[string]string{
+		"/en":       "en",
+		"/de":       "de",
+		"/fr":       "fr",
+		"/ja":       "ja",
+		"/ru":       "ru",
+		"/declared": "es",
+		"/unknown":  "",
+		"/header":   "it",
+	}
+	if !reflect.DeepEqual(languages, expected) {
+		t.Errorf("Unexpected languages: %v", languages)
+	}
+}
+
+func TestLanguageFilter(t *testing.T) {
+	ts := newLanguageServer()
+	defer ts.Close()
+
+	c := NewCollector(LanguageFilter("en", "de"))
+	var processed []string
+	c.OnHTML("body", func(e *HTMLElement) {
+		processed = append(processed, e.Request.URL.Path)
+	})
+	for _, p := range []string{"/en", "/de", "/fr", "/ja", "/unknown"} {
+		c.Visit(ts.URL + p)
+	}
+	sort.Strings(processed)
+	if expected := []string{"/de", "/en", "/unknown"}; !reflect.DeepEqual(processed, expected) {
+		t.Errorf("Unexpected processed pages: %v", processed)
+	}
+}
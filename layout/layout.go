@@ -0,0 +1,301 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layout tracks the structure of the pages of every domain and
+// reports sharp changes of it, which usually signal a redesign of the
+// site breaking the selectors of the scraper:
+//
+//	m := layout.New(func(s layout.Shift) {
+//		log.Printf("%s changed its layout (%.2f): %v", s.Domain, s.Distance, s.Changes(5))
+//	})
+//	c.Use(m)
+//
+// The structure of a page is the histogram of the tag paths of its
+// elements. The histograms of the first pages of a domain are averaged
+// to its baseline and the average of the last pages is compared to it.
+package layout
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// Histogram is the structure of a page, the relative frequencies of the
+// tag paths of its elements summing up to 1
+type Histogram map[string]float64
+
+// Change is the change of the frequency of a tag path
+type Change struct {
+	Path     string
+	Baseline float64
+	Current  float64
+}
+
+// Shift is a sharp change of the structure of the pages of a domain
+type Shift struct {
+	Domain string
+	// URL is the page completing the window which differs from the
+	// baseline
+	URL string
+	// Distance is the distance of the baseline and the current
+	// structure, see Distance
+	Distance float64
+	Baseline Histogram
+	Current  Histogram
+}
+
+// Changes returns the n tag paths with the largest changes of their
+// frequencies. All the changed paths are returned if n is not positive.
+func (s Shift) Changes(n int) []Change {
+	var changes []Change
+	for p, f := range s.Baseline {
+		if s.Current[p] != f {
+			changes = append(changes, Change{Path: p, Baseline: f, Current: s.Current[p]})
+		}
+	}
+	for p, f := range s.Current {
+		if _, ok := s.Baseline[p]; !ok {
+			changes = append(changes, Change{Path: p, Current: f})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		di := math.Abs(changes[i].Current - changes[i].Baseline)
+		dj := math.Abs(changes[j].Current - changes[j].Baseline)
+		if di != dj {
+			return di > dj
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	if n > 0 && len(changes) > n {
+		changes = changes[:n]
+	}
+	return changes
+}
+
+// Monitor tracks the structure of the HTML pages of every domain.
+// Register it by Collector.Use.
+type Monitor struct {
+	colly.BasePlugin
+	// Depth is the maximum number of the elements of the tag paths
+	Depth int
+	// BaselinePages is the number of the first pages of a domain
+	// averaged to its baseline
+	BaselinePages int
+	// WindowPages is the number of the last pages of a domain averaged
+	// to its current structure
+	WindowPages int
+	// Threshold is the minimum distance (0-1) of the baseline and the
+	// current structure to report a shift
+	Threshold float64
+	// Filter selects the tracked responses. Successful HTML responses
+	// are tracked if it is nil.
+	Filter func(r *colly.Response) bool
+	// OnShift is called when the structure of a domain shifts. The
+	// current structure becomes the new baseline of the domain, so a
+	// redesign is reported once.
+	OnShift func(s Shift)
+	lock    sync.Mutex
+	domains map[string]*domainState
+}
+
+type domainState struct {
+	baseline Histogram
+	pages    int
+	window   []Histogram
+}
+
+// New creates a Monitor with 3 element paths, 20 baseline pages, 10
+// window pages and 0.3 threshold
+func New(onShift func(s Shift)) *Monitor {
+	return &Monitor{
+		Depth:         3,
+		BaselinePages: 20,
+		WindowPages:   10,
+		Threshold:     0.3,
+		OnShift:       onShift,
+	}
+}
+
+// OnResponse adds the structure of the response to its domain
+func (m *Monitor) OnResponse(r *colly.Response) {
+	if m.Filter != nil {
+		if !m.Filter(r) {
+			return
+		}
+	} else if r.StatusCode < 200 || r.StatusCode >= 300 || r.Headers == nil || !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		return
+	}
+	h, err := Compute(r.Body, m.Depth)
+	if err != nil || len(h) == 0 {
+		return
+	}
+	if s, ok := m.Add(r.Request.URL.Hostname(), h); ok {
+		s.URL = r.Request.URL.String()
+		if m.OnShift != nil {
+			m.OnShift(s)
+		}
+	}
+}
+
+// Add adds the structure of a page to the domain and returns the shift
+// of its structure if the page completes a window which differs from
+// the baseline
+func (m *Monitor) Add(domain string, h Histogram) (Shift, bool) {
+	domain = strings.ToLower(domain)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.domains == nil {
+		m.domains = make(map[string]*domainState)
+	}
+	d, ok := m.domains[domain]
+	if !ok {
+		d = &domainState{baseline: Histogram{}}
+		m.domains[domain] = d
+	}
+	if d.pages < max(m.BaselinePages, 1) {
+		for p, f := range h {
+			d.baseline[p] += f
+		}
+		d.pages++
+		if d.pages == max(m.BaselinePages, 1) {
+			d.baseline = scale(d.baseline, 1/float64(d.pages))
+		}
+		return Shift{}, false
+	}
+	d.window = append(d.window, h)
+	size := max(m.WindowPages, 1)
+	if len(d.window) > size {
+		d.window = d.window[len(d.window)-size:]
+	}
+	if len(d.window) < size {
+		return Shift{}, false
+	}
+	current := average(d.window)
+	distance := Distance(d.baseline, current)
+	if distance < m.Threshold {
+		return Shift{}, false
+	}
+	s := Shift{
+		Domain:   domain,
+		Distance: distance,
+		Baseline: d.baseline,
+		Current:  current,
+	}
+	d.baseline = current
+	d.window = nil
+	return s, true
+}
+
+// Baseline returns the baseline structure of the domain or nil if the
+// domain has less pages than BaselinePages
+func (m *Monitor) Baseline(domain string) Histogram {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	d, ok := m.domains[strings.ToLower(domain)]
+	if !ok || d.pages < max(m.BaselinePages, 1) {
+		return nil
+	}
+	return scale(d.baseline, 1)
+}
+
+// Reset forgets the structure of the domain, e.g. after updating the
+// selectors of a redesigned site
+func (m *Monitor) Reset(domain string) {
+	m.lock.Lock()
+	delete(m.domains, strings.ToLower(domain))
+	m.lock.Unlock()
+}
+
+// Compute returns the structure of a HTML document. The tag paths
+// contain at most depth elements ending with the counted element, e.g.
+// "div>ul>li" if depth is 3. The full paths are used if depth is not
+// positive.
+func Compute(body []byte, depth int) (Histogram, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	h := Histogram{}
+	total := 0
+	var path []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			path = append(path, n.Data)
+			start := 0
+			if depth > 0 && len(path) > depth {
+				start = len(path) - depth
+			}
+			h[strings.Join(path[start:], ">")]++
+			total++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode {
+			path = path[:len(path)-1]
+		}
+	}
+	walk(doc)
+	if total == 0 {
+		return h, nil
+	}
+	return scale(h, 1/float64(total)), nil
+}
+
+// Distance returns the total variation distance of two structures,
+// which is 0 for identical and 1 for disjoint structures
+func Distance(a, b Histogram) float64 {
+	d := 0.0
+	for p, f := range a {
+		d += math.Abs(f - b[p])
+	}
+	for p, f := range b {
+		if _, ok := a[p]; !ok {
+			d += f
+		}
+	}
+	return d / 2
+}
+
+func average(hs []Histogram) Histogram {
+	sum := Histogram{}
+	for _, h := range hs {
+		for p, f := range h {
+			sum[p] += f
+		}
+	}
+	return scale(sum, 1/float64(len(hs)))
+}
+
+func scale(h Histogram, factor float64) Histogram {
+	res := make(Histogram, len(h))
+	for p, f := range h {
+		res[p] = f * factor
+	}
+	return res
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	oldLayout = `<html><body><div class="product"><h1>Item %d</h1><span class="price">%d</span></div></body></html>`
+	newLayout = `<html><body><main><section><article><h2>Item %d</h2><p><b>%d</b></p></article></section></main></body></html>`
+)
+
+func TestCompute(t *testing.T) {
+	h, err := Compute([]byte(`<html><body><ul><li>a</li><li>b</li></ul></body></html>`), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// html, head, body, ul, li, li
+	expected := Histogram{
+		"html":      1.0 / 6,
+		"html>head": 1.0 / 6,
+		"html>body": 1.0 / 6,
+		"body>ul":   1.0 / 6,
+		"ul>li":     2.0 / 6,
+	}
+	if len(h) != len(expected) {
+		t.Fatalf("Unexpected histogram: %v", h)
+	}
+	for p, f := range expected {
+		if math.Abs(h[p]-f) > 1e-9 {
+			t.Errorf("Invalid frequency of %q: %v", p, h[p])
+		}
+	}
+	if d := Distance(h, h); d != 0 {
+		t.Errorf("Distance of identical histograms: %v", d)
+	}
+	if d := Distance(Histogram{"a": 1}, Histogram{"b": 0.5, "c": 0.5}); d != 1 {
+		t.Errorf("Distance of disjoint histograms: %v", d)
+	}
+	if d := Distance(Histogram{"a": 1}, Histogram{"a": 0.5, "b": 0.5}); d != 0.5 {
+		t.Errorf("Invalid distance: %v", d)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	var redesigned int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		layout := oldLayout
+		if atomic.LoadInt32(&redesigned) == 1 {
+			layout = newLayout
+		}
+		fmt.Fprintf(w, layout, len(r.URL.Path), len(r.URL.Path)*10)
+	}))
+	defer ts.Close()
+
+	var shifts []Shift
+	m := New(func(s Shift) {
+		shifts = append(shifts, s)
+	})
+	m.BaselinePages = 5
+	m.WindowPages = 3
+	c := colly.NewCollector()
+	c.Use(m)
+	for i := 0; i < 10; i++ {
+		c.Visit(fmt.Sprintf("%s/old/%d", ts.URL, i))
+	}
+	if len(shifts) != 0 {
+		t.Fatalf("Unexpected shifts: %v", shifts)
+	}
+	if m.Baseline("127.0.0.1")["body>div>h1"] == 0 {
+		t.Errorf("Invalid baseline: %v", m.Baseline("127.0.0.1"))
+	}
+
+	atomic.StoreInt32(&redesigned, 1)
+	for i := 0; i < 10; i++ {
+		c.Visit(fmt.Sprintf("%s/new/%d", ts.URL, i))
+	}
+	if len(shifts) != 1 {
+		t.Fatalf("Expected one shift, got %d", len(shifts))
+	}
+	s := shifts[0]
+	if s.Domain != "127.0.0.1" || s.Distance < 0.3 || s.URL == "" {
+		t.Errorf("Invalid shift: %+v", s)
+	}
+	changes := s.Changes(3)
+	if len(changes) != 3 {
+		t.Fatalf("Invalid changes: %v", changes)
+	}
+	for _, c := range changes {
+		if c.Path == "html" {
+			t.Errorf("Unchanged path was reported: %v", c)
+		}
+	}
+	if m.Baseline("127.0.0.1")["section>article>h2"] == 0 {
+		t.Error("Current structure did not become the baseline")
+	}
+
+	m.Reset("127.0.0.1")
+	if m.Baseline("127.0.0.1") != nil {
+		t.Error("Domain was not reset")
+	}
+}
+
+func TestMonitorGradualWindow(t *testing.T) {
+	m := New(nil)
+	m.BaselinePages = 2
+	m.WindowPages = 4
+	a := Histogram{"a": 1}
+	b := Histogram{"b": 1}
+	m.Add("example.com", a)
+	m.Add("example.com", a)
+	// a single different page is averaged out by the window
+	for _, h := range []Histogram{a, a, a, b} {
+		if s, ok := m.Add("example.com", h); ok {
+			t.Fatalf("Unexpected shift: %+v", s)
+		}
+	}
+	if _, ok := m.Add("other.com", b); ok {
+		t.Error("Domains are not separated")
+	}
+}
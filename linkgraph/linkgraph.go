@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linkgraph records the link graph of a crawl. Every link of the
+// crawled HTML pages is passed to a Sink as an Edge while the crawl runs:
+//
+//	sink := linkgraph.NewMemorySink()
+//	linkgraph.NewRecorder(c, sink)
+//	c.Visit("https://example.com/")
+//	c.Wait()
+//	fmt.Println(sink.Inlinks("https://example.com/about"))
+package linkgraph
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Edge is a link from a page to a URL
+type Edge struct {
+	// Source is the URL of the linking page
+	Source string
+	// Target is the absolute URL of the link without fragment
+	Target string
+	// Anchor is the text of the link with collapsed whitespace
+	Anchor string
+	// Rel is the rel attribute of the link, e.g. "nofollow"
+	Rel string
+}
+
+// Sink stores the edges of a link graph. The edges are passed to the
+// Sink one by one, so it does not have to be safe for concurrent use.
+type Sink interface {
+	AddEdge(e Edge) error
+}
+
+// Recorder passes the links of the pages crawled by a Collector to a
+// Sink
+type Recorder struct {
+	// Filter selects the recorded edges. Every edge is recorded if it is
+	// nil.
+	Filter func(e Edge) bool
+	sink   Sink
+	err    error
+	lock   *sync.Mutex
+}
+
+// NewRecorder creates a Recorder and attaches it to the Collector. The
+// links of a[href] and area[href] elements are recorded.
+func NewRecorder(c *colly.Collector, sink Sink) *Recorder {
+	r := &Recorder{sink: sink, lock: &sync.Mutex{}}
+	c.OnHTML("a[href], area[href]", r.record)
+	return r
+}
+
+// Err returns the first error returned by the Sink
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(e *colly.HTMLElement) {
+	target := e.Request.AbsoluteURL(e.Attr("href"))
+	if target == "" {
+		return
+	}
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		target = target[:i]
+	}
+	edge := Edge{
+		Source: e.Request.URL.String(),
+		Target: target,
+		Anchor: strings.Join(strings.Fields(e.Text), " "),
+		Rel:    strings.TrimSpace(e.Attr("rel")),
+	}
+	// image links and areas are described by their alt text
+	if edge.Anchor == "" {
+		alt := e.Attr("alt")
+		if alt == "" {
+			alt = e.ChildAttr("img", "alt")
+		}
+		edge.Anchor = strings.Join(strings.Fields(alt), " ")
+	}
+	if r.Filter != nil && !r.Filter(edge) {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.sink.AddEdge(edge); err != nil && r.err == nil {
+		r.err = err
+	}
+}
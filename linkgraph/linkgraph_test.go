@@ -0,0 +1,123 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkgraph
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/a#top">First
+		link</a><a href="https://example.com/" rel="nofollow">External</a><a href="/a"><img alt="Logo"></a>`))
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<map><area href="/" alt="home"></map>`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRecorder(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	sink := NewMemorySink()
+	NewRecorder(c, sink)
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/a")
+	expected := []Edge{
+		{ts.URL + "/", ts.URL + "/a", "First link", ""},
+		{ts.URL + "/", "https://example.com/", "External", "nofollow"},
+		{ts.URL + "/", ts.URL + "/a", "Logo", ""},
+		{ts.URL + "/a", ts.URL + "/", "home", ""},
+	}
+	if edges := sink.Edges(); !reflect.DeepEqual(edges, expected) {
+		t.Errorf("Unexpected edges: %v", edges)
+	}
+	if inlinks := sink.Inlinks(ts.URL + "/a"); !reflect.DeepEqual(inlinks, []Edge{expected[0], expected[2]}) {
+		t.Errorf("Unexpected inlinks: %v", inlinks)
+	}
+	if outlinks := sink.Outlinks(ts.URL + "/a"); !reflect.DeepEqual(outlinks, expected[3:]) {
+		t.Errorf("Unexpected outlinks: %v", outlinks)
+	}
+}
+
+func TestCSVSink(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	buf := &bytes.Buffer{}
+	r := NewRecorder(c, NewCSVSink(buf))
+	r.Filter = func(e Edge) bool {
+		return e.Rel != "nofollow"
+	}
+	c.Visit(ts.URL + "/")
+	expected := "source,target,anchor,rel\n" +
+		ts.URL + "/," + ts.URL + "/a,First link,\n" +
+		ts.URL + "/," + ts.URL + "/a,Logo,\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+type cypherRunner struct {
+	params []map[string]interface{}
+	err    error
+}
+
+func (r *cypherRunner) Run(cypher string, params map[string]interface{}) error {
+	if cypher != CypherStatement {
+		return errors.New("unexpected statement")
+	}
+	r.params = append(r.params, params)
+	return r.err
+}
+
+func TestCypherSink(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	runner := &cypherRunner{}
+	r := NewRecorder(c, &CypherSink{Runner: runner})
+	c.Visit(ts.URL + "/a")
+	expected := []map[string]interface{}{
+		{"source": ts.URL + "/a", "target": ts.URL + "/", "anchor": "home", "rel": ""},
+	}
+	if !reflect.DeepEqual(runner.params, expected) {
+		t.Errorf("Unexpected parameters: %v", runner.params)
+	}
+	if r.Err() != nil {
+		t.Error(r.Err())
+	}
+
+	runner.err = errors.New("connection lost")
+	c.Visit(ts.URL + "/")
+	if r.Err() != runner.err {
+		t.Errorf("Unexpected error: %v", r.Err())
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkgraph
+
+import (
+	"encoding/csv"
+	"io"
+	"sync"
+)
+
+// MemorySink keeps the edges in memory
+type MemorySink struct {
+	edges    []Edge
+	outlinks map[string][]int
+	inlinks  map[string][]int
+	lock     sync.RWMutex
+}
+
+// NewMemorySink creates a MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		outlinks: make(map[string][]int),
+		inlinks:  make(map[string][]int),
+	}
+}
+
+// AddEdge implements Sink
+func (s *MemorySink) AddEdge(e Edge) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.outlinks[e.Source] = append(s.outlinks[e.Source], len(s.edges))
+	s.inlinks[e.Target] = append(s.inlinks[e.Target], len(s.edges))
+	s.edges = append(s.edges, e)
+	return nil
+}
+
+// Edges returns the edges in the order of recording
+func (s *MemorySink) Edges() []Edge {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]Edge(nil), s.edges...)
+}
+
+// Outlinks returns the edges starting from a URL
+func (s *MemorySink) Outlinks(u string) []Edge {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.collect(s.outlinks[u])
+}
+
+// Inlinks returns the edges pointing to a URL
+func (s *MemorySink) Inlinks(u string) []Edge {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.collect(s.inlinks[u])
+}
+
+func (s *MemorySink) collect(indexes []int) []Edge {
+	edges := make([]Edge, len(indexes))
+	for i, idx := range indexes {
+		edges[i] = s.edges[idx]
+	}
+	return edges
+}
+
+// CSVSink writes the edges as CSV rows of source, target, anchor and rel
+// columns after a header row
+type CSVSink struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVSink creates a CSVSink writing to w
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{w: csv.NewWriter(w)}
+}
+
+// AddEdge implements Sink
+func (s *CSVSink) AddEdge(e Edge) error {
+	if !s.header {
+		s.header = true
+		if err := s.w.Write([]string{"source", "target", "anchor", "rel"}); err != nil {
+			return err
+		}
+	}
+	if err := s.w.Write([]string{e.Source, e.Target, e.Anchor, e.Rel}); err != nil {
+		return err
+	}
+	// rows are flushed immediately, so the file is complete if the
+	// crawl is interrupted
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// CypherRunner runs a parameterized Cypher statement. A session of a
+// Neo4j driver can be adapted to it in a few lines, so the package does
+// not depend on a driver.
+type CypherRunner interface {
+	Run(cypher string, params map[string]interface{}) error
+}
+
+// CypherStatement merges the pages of an edge as Page nodes and the edge
+// as LINKS_TO relationship
+const CypherStatement = `MERGE (s:Page {url: $source})
+MERGE (t:Page {url: $target})
+MERGE (s)-[l:LINKS_TO {anchor: $anchor}]->(t)
+SET l.rel = $rel`
+
+// CypherSink writes the edges to a graph database by a CypherRunner
+type CypherSink struct {
+	// Runner executes the statements
+	Runner CypherRunner
+	// Statement is the Cypher statement executed for every edge with
+	// the source, target, anchor and rel parameters. CypherStatement is
+	// used if it is empty.
+	Statement string
+}
+
+// AddEdge implements Sink
+func (s *CypherSink) AddEdge(e Edge) error {
+	statement := s.Statement
+	if statement == "" {
+		statement = CypherStatement
+	}
+	return s.Runner.Run(statement, map[string]interface{}{
+		"source": e.Source,
+		"target": e.Target,
+		"anchor": e.Anchor,
+		"rel":    e.Rel,
+	})
+}
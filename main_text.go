@@ -0,0 +1,217 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// MainText returns the main content of a HTML response without the
+// boilerplate, e.g. navigation, footer, sidebars and ads. Paragraphs are
+// separated by empty lines. The text of plain text responses is returned
+// as is and other responses have no main text.
+//
+// The content is detected by the text and link density of the blocks of
+// the page, so no site specific selectors are required.
+func (r *Response) MainText() string {
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	if strings.HasPrefix(contentType, "text/plain") {
+		return strings.TrimSpace(string(r.Body))
+	}
+	if !strings.Contains(contentType, "html") {
+		return ""
+	}
+	doc, err := html.Parse(bytes.NewReader(r.Body))
+	if err != nil {
+		return ""
+	}
+	return mainText(doc)
+}
+
+// minContentWords is the minimum number of words of a content block
+const minContentWords = 10
+
+// maxContentLinkDensity is the maximum ratio of link words of a content
+// block
+const maxContentLinkDensity = 0.33
+
+// boilerplateElements never contain main content
+var boilerplateElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "iframe": true, "nav": true, "header": true, "footer": true,
+	"aside": true, "form": true, "button": true, "select": true, "head": true,
+}
+
+// boilerplateNames are class and id tokens of boilerplate containers
+var boilerplateNames = map[string]bool{
+	"ad": true, "ads": true, "advert": true, "advertisement": true,
+	"banner": true, "breadcrumb": true, "breadcrumbs": true,
+	"comment": true, "comments": true, "cookie": true, "footer": true,
+	"menu": true, "nav": true, "navbar": true, "newsletter": true,
+	"popup": true, "promo": true, "related": true, "share": true,
+	"sidebar": true, "social": true, "sponsor": true, "sponsored": true,
+	"subscribe": true, "widget": true,
+}
+
+// textBlockElements start a new block of text
+var textBlockElements = map[string]bool{
+	"p": true, "div": true, "li": true, "td": true, "th": true, "dd": true,
+	"dt": true, "blockquote": true, "pre": true, "article": true,
+	"section": true, "main": true, "body": true, "figcaption": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "table": true, "tr": true,
+}
+
+// textBlock is a run of text of a block element
+type textBlock struct {
+	node      *html.Node
+	text      strings.Builder
+	words     int
+	linkWords int
+	heading   bool
+	content   bool
+}
+
+func mainText(doc *html.Node) string {
+	var blocks []*textBlock
+	var walk func(n *html.Node, b *textBlock, inLink bool) *textBlock
+	walk = func(n *html.Node, b *textBlock, inLink bool) *textBlock {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Type {
+			case html.TextNode:
+				words := len(strings.Fields(c.Data))
+				if words == 0 {
+					continue
+				}
+				b.text.WriteString(c.Data)
+				b.words += words
+				if inLink {
+					b.linkWords += words
+				}
+			case html.ElementNode:
+				if boilerplateElements[c.Data] || isBoilerplateNode(c) {
+					continue
+				}
+				if c.Data == "br" {
+					b.text.WriteByte(' ')
+					continue
+				}
+				if !textBlockElements[c.Data] {
+					b = walk(c, b, inLink || c.Data == "a")
+					continue
+				}
+				// text after a nested block continues in a new block of
+				// the parent
+				blocks = append(blocks, b)
+				inner := &textBlock{node: c, heading: len(c.Data) == 2 && c.Data[0] == 'h' && c.Data[1] >= '1' && c.Data[1] <= '6'}
+				blocks = append(blocks, walk(c, inner, inLink))
+				b = &textBlock{node: n}
+			}
+		}
+		return b
+	}
+	blocks = append(blocks, walk(doc, &textBlock{node: doc}, false))
+
+	// content blocks contain enough words and few links. The containers
+	// of the content blocks are scored by their words.
+	scores := make(map[*html.Node]int)
+	for _, b := range blocks {
+		if b.words < minContentWords || float64(b.linkWords)/float64(b.words) > maxContentLinkDensity {
+			continue
+		}
+		b.content = true
+		scores[b.node] += b.words
+		if p := b.node.Parent; p != nil {
+			scores[p] += b.words
+			if p.Parent != nil {
+				scores[p.Parent] += b.words / 2
+			}
+		}
+	}
+	var best *html.Node
+	for n, s := range scores {
+		if best == nil || s > scores[best] {
+			best = n
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	// siblings of the best container having a considerable score are
+	// parts of the content too, e.g. sections split by a banner
+	containers := []*html.Node{best}
+	if best.Parent != nil {
+		for n := best.Parent.FirstChild; n != nil; n = n.NextSibling {
+			if n != best && scores[n] >= scores[best]/5 {
+				containers = append(containers, n)
+			}
+		}
+	}
+	var paragraphs []string
+	for i, b := range blocks {
+		if b.words == 0 || !isDescendant(b.node, containers...) {
+			continue
+		}
+		// headings are kept if they introduce content
+		if !b.content && !(b.heading && nextIsContent(blocks[i+1:])) {
+			continue
+		}
+		paragraphs = append(paragraphs, strings.Join(strings.Fields(b.text.String()), " "))
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// isBoilerplateNode returns true if the class or id of the element
+// names a boilerplate container
+func isBoilerplateNode(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key != "class" && a.Key != "id" && a.Key != "role" {
+			continue
+		}
+		tokens := strings.FieldsFunc(strings.ToLower(a.Val), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, t := range tokens {
+			if boilerplateNames[t] || (a.Key == "role" && (t == "navigation" || t == "complementary" || t == "contentinfo")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isDescendant(n *html.Node, ancestors ...*html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		for _, a := range ancestors {
+			if n == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nextIsContent(blocks []*textBlock) bool {
+	for _, b := range blocks {
+		if b.words > 0 {
+			return b.content
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"testing"
+)
+
+const mainTextPage = `<!DOCTYPE html>
+<html><head><title>Article</title><script>var tracking = 1;</script></head>
+<body>
+<div class="top-menu"><a href="/">Home</a> <a href="/news">News</a> <a href="/sport">Sport</a></div>
+<nav><ul><li><a href="/a">Section A</a></li><li><a href="/b">Section B</a></li></ul></nav>
+<div id="wrapper">
+  <div class="content">
+    <h1>The title of the article</h1>
+    <p>The first paragraph of the article contains enough words to be detected as <a href="/x">content</a> of the page.</p>
+    <div class="ad-banner">Buy our product now, it is the best product you can buy for your money today!</div>
+    <p>The second paragraph<br>continues the story with some more words about the topic of the article.</p>
+    <h2>Related</h2>
+    <ul class="links"><li><a href="/1">Another article with a long title about something</a></li><li><a href="/2">Yet another article with a long title</a></li></ul>
+  </div>
+  <div class="sidebar"><p>Subscribe to our newsletter to get the latest news directly into your inbox every morning.</p></div>
+</div>
+<footer><p>Copyright 2018 The Example Company. All rights reserved. Terms of use and privacy policy apply.</p></footer>
+</body></html>`
+
+func TestMainText(t *testing.T) {
+	r := &Response{
+		Body:    []byte(mainTextPage),
+		Headers: &http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+	}
+	expected := "The title of the article\n\n" +
+		"The first paragraph of the article contains enough words to be detected as content of the page.\n\n" +
+		"The second paragraph continues the story with some more words about the topic of the article."
+	if got := r.MainText(); got != expected {
+		t.Errorf("Invalid main text:\n%s", got)
+	}
+
+	r.Headers.Set("Content-Type", "text/plain")
+	r.Body = []byte(" plain text\n")
+	if got := r.MainText(); got != "plain text" {
+		t.Errorf("Invalid main text of plain text %q", got)
+	}
+	r.Headers.Set("Content-Type", "image/png")
+	if got := r.MainText(); got != "" {
+		t.Errorf("Invalid main text of image %q", got)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxTemplateSegments limits the number of segments generated from
+// DASH segment templates
+const maxTemplateSegments = 100000
+
+type mpd struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration        string              `xml:"duration,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	AdaptationSets  []mpdAdaptationSet  `xml:"AdaptationSet"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType        string              `xml:"mimeType,attr"`
+	ContentType     string              `xml:"contentType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	Bandwidth       int                 `xml:"bandwidth,attr"`
+	Width           int                 `xml:"width,attr"`
+	Height          int                 `xml:"height,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+}
+
+type mpdSegmentTemplate struct {
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+	StartNumber    *int   `xml:"startNumber,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timescale      int64  `xml:"timescale,attr"`
+	Timeline       []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int    `xml:"r,attr"`
+	} `xml:"SegmentTimeline>S"`
+}
+
+type mpdSegmentList struct {
+	Duration       int64 `xml:"duration,attr"`
+	Timescale      int64 `xml:"timescale,attr"`
+	Initialization struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// templateIdentifierRe matches the $Identifier$ and $Identifier%0[width]d$
+// placeholders of segment templates
+var templateIdentifierRe = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time)(%0\d+d)?\$`)
+
+// ParseDASH parses a DASH MPD. Segment templates are expanded to segment
+// lists, so the segments of every representation can be enqueued directly.
+func ParseDASH(base *url.URL, body []byte) (*Manifest, error) {
+	doc := &mpd{}
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+	m := &Manifest{Type: DASH, Live: doc.Type == "dynamic"}
+	if base != nil {
+		m.URL = base.String()
+	}
+	base = joinBase(base, doc.BaseURL)
+	for _, p := range doc.Periods {
+		duration := parseDuration(p.Duration)
+		if duration == 0 && len(doc.Periods) == 1 {
+			duration = parseDuration(doc.Duration)
+		}
+		periodBase := joinBase(base, p.BaseURL)
+		for _, as := range p.AdaptationSets {
+			asBase := joinBase(periodBase, as.BaseURL)
+			for _, r := range as.Representations {
+				v := &Variant{
+					ID:        r.ID,
+					MediaType: firstNonEmpty(as.ContentType, mediaType(r.MimeType), mediaType(as.MimeType)),
+					Bandwidth: r.Bandwidth,
+					Codecs:    firstNonEmpty(r.Codecs, as.Codecs),
+				}
+				if r.Width > 0 && r.Height > 0 {
+					v.Resolution = fmt.Sprintf("%dx%d", r.Width, r.Height)
+				}
+				rBase := joinBase(asBase, r.BaseURL)
+				switch {
+				case r.SegmentList != nil || as.SegmentList != nil:
+					l := r.SegmentList
+					if l == nil {
+						l = as.SegmentList
+					}
+					segmentList(v, rBase, l)
+				case r.SegmentTemplate != nil || as.SegmentTemplate != nil || p.SegmentTemplate != nil:
+					t := r.SegmentTemplate
+					if t == nil {
+						t = as.SegmentTemplate
+					}
+					if t == nil {
+						t = p.SegmentTemplate
+					}
+					segmentTemplate(v, rBase, t, duration)
+				case r.BaseURL != "":
+					// single segment representation
+					v.Segments = []*Segment{{URL: resolve(asBase, r.BaseURL), Duration: duration}}
+				}
+				m.Variants = append(m.Variants, v)
+			}
+		}
+	}
+	return m, nil
+}
+
+func segmentList(v *Variant, base *url.URL, l *mpdSegmentList) {
+	if l.Initialization.SourceURL != "" {
+		v.Init = resolve(base, l.Initialization.SourceURL)
+	}
+	d := 0.0
+	if l.Duration > 0 {
+		d = float64(l.Duration) / float64(timescale(l.Timescale))
+	}
+	for _, s := range l.SegmentURLs {
+		v.Segments = append(v.Segments, &Segment{URL: resolve(base, s.Media), Duration: d})
+	}
+}
+
+func segmentTemplate(v *Variant, base *url.URL, t *mpdSegmentTemplate, duration float64) {
+	expand := func(tmpl string, number, time int64) string {
+		return templateIdentifierRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+			parts := templateIdentifierRe.FindStringSubmatch(m)
+			format := "%d"
+			if parts[2] != "" {
+				format = parts[2]
+			}
+			switch parts[1] {
+			case "RepresentationID":
+				return v.ID
+			case "Number":
+				return fmt.Sprintf(format, number)
+			case "Bandwidth":
+				return fmt.Sprintf(format, v.Bandwidth)
+			}
+			return fmt.Sprintf(format, time)
+		})
+	}
+	if t.Initialization != "" {
+		v.Init = resolve(base, expand(t.Initialization, 0, 0))
+	}
+	if t.Media == "" {
+		return
+	}
+	number := int64(1)
+	if t.StartNumber != nil {
+		number = int64(*t.StartNumber)
+	}
+	scale := float64(timescale(t.Timescale))
+	if len(t.Timeline) > 0 {
+		var time int64
+		for _, s := range t.Timeline {
+			if s.T != nil {
+				time = *s.T
+			}
+			for i := 0; i <= s.R && len(v.Segments) < maxTemplateSegments; i++ {
+				v.Segments = append(v.Segments, &Segment{
+					URL:      resolve(base, expand(t.Media, number, time)),
+					Duration: float64(s.D) / scale,
+				})
+				number++
+				time += s.D
+			}
+		}
+		return
+	}
+	if t.Duration <= 0 || duration <= 0 {
+		return
+	}
+	d := float64(t.Duration) / scale
+	n := int(math.Ceil(duration / d))
+	for i := 0; i < n && i < maxTemplateSegments; i++ {
+		v.Segments = append(v.Segments, &Segment{
+			URL:      resolve(base, expand(t.Media, number, int64(i)*t.Duration)),
+			Duration: d,
+		})
+		number++
+	}
+}
+
+func joinBase(base *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base
+	}
+	if base == nil {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return nil
+		}
+		return u
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return base
+	}
+	return u
+}
+
+func timescale(t int64) int64 {
+	if t <= 0 {
+		return 1
+	}
+	return t
+}
+
+func mediaType(mimeType string) string {
+	if i := strings.IndexByte(mimeType, '/'); i > 0 {
+		return mimeType[:i]
+	}
+	return mimeType
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// durationRe matches ISO 8601 durations like PT1H2M3.5S
+var durationRe = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseDuration returns the seconds of an ISO 8601 duration
+func parseDuration(s string) float64 {
+	m := durationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	var seconds float64
+	for i, mul := range []float64{86400, 3600, 60, 1} {
+		if v, err := strconv.ParseFloat(m[i+1], 64); err == nil {
+			seconds += v * mul
+		}
+	}
+	return seconds
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseHLS parses a HLS master or media playlist. Relative URIs are
+// resolved using base.
+func ParseHLS(base *url.URL, body []byte) (*Manifest, error) {
+	m := &Manifest{Type: HLS, Live: true}
+	if base != nil {
+		m.URL = base.String()
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	scanner.Buffer(nil, 1024*1024)
+	var variant *Variant
+	var segment *Segment
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if !strings.HasPrefix(line, "#EXTM3U") {
+				return nil, errors.New("Missing #EXTM3U header")
+			}
+			first = false
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			// URI line
+			switch {
+			case variant != nil:
+				variant.URL = resolve(base, line)
+				m.Variants = append(m.Variants, variant)
+				variant = nil
+			case segment != nil:
+				segment.URL = resolve(base, line)
+				m.Segments = append(m.Segments, segment)
+				segment = nil
+			default:
+				m.Segments = append(m.Segments, &Segment{URL: resolve(base, line)})
+			}
+			continue
+		}
+		tag, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			tag, value = line[:i], line[i+1:]
+		}
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			attrs := parseAttributes(value)
+			variant = &Variant{
+				MediaType:  "video",
+				Resolution: attrs["RESOLUTION"],
+				Codecs:     attrs["CODECS"],
+			}
+			variant.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+		case "#EXT-X-MEDIA":
+			attrs := parseAttributes(value)
+			if attrs["URI"] == "" {
+				continue
+			}
+			m.Variants = append(m.Variants, &Variant{
+				URL:       resolve(base, attrs["URI"]),
+				ID:        attrs["NAME"],
+				MediaType: strings.ToLower(attrs["TYPE"]),
+			})
+		case "#EXTINF":
+			segment = &Segment{}
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value = value[:i]
+			}
+			segment.Duration, _ = strconv.ParseFloat(value, 64)
+		case "#EXT-X-MAP":
+			if uri := parseAttributes(value)["URI"]; uri != "" {
+				m.Init = resolve(base, uri)
+			}
+		case "#EXT-X-ENDLIST":
+			m.Live = false
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value == "VOD" {
+				m.Live = false
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if first {
+		return nil, errors.New("Empty playlist")
+	}
+	// master playlists are not reloaded
+	if len(m.Segments) == 0 {
+		m.Live = false
+	}
+	return m, nil
+}
+
+// parseAttributes parses HLS attribute lists like
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if i := strings.IndexByte(s, ','); i >= 0 {
+			value, s = s[:i], s[i:]
+		} else {
+			value, s = s, ""
+		}
+		attrs[key] = value
+		s = strings.TrimPrefix(s, ",")
+	}
+	return attrs
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest implements detection and parsing of HLS playlists
+// and DASH media presentation descriptions (MPD).
+//
+// Attach a Handler to a Collector to follow the variant playlists of
+// the visited manifests and to enqueue or download their segments:
+//
+//	h := &manifest.Handler{FollowVariants: true, VisitSegments: true}
+//	h.Attach(c)
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Type is the format of a manifest
+type Type int
+
+const (
+	// Unknown is returned by Detect if the response is not a manifest
+	Unknown Type = iota
+	// HLS is a HTTP Live Streaming (m3u8) playlist
+	HLS
+	// DASH is a MPEG-DASH media presentation description
+	DASH
+)
+
+// ErrNotManifest is the error returned if a response is not a manifest
+var ErrNotManifest = errors.New("Not a HLS or DASH manifest")
+
+// Manifest is a parsed HLS playlist or DASH MPD
+type Manifest struct {
+	// Type is the format of the manifest
+	Type Type
+	// URL is the absolute URL of the manifest
+	URL string
+	// Variants are the variant streams and alternative renditions of
+	// a HLS master playlist or the representations of a DASH MPD
+	Variants []*Variant
+	// Segments are the media segments of a HLS media playlist
+	Segments []*Segment
+	// Init is the URL of the initialization segment of a HLS
+	// media playlist
+	Init string
+	// Live is true if the manifest describes a live stream
+	// which has to be reloaded periodically
+	Live bool
+}
+
+// Variant is a variant stream or rendition of the media
+type Variant struct {
+	// URL is the absolute URL of the HLS media playlist. It is empty
+	// for DASH representations which list their segments directly.
+	URL string
+	// ID is the DASH representation id or the HLS rendition name
+	ID string
+	// MediaType is "video", "audio", "subtitles" or the mime type
+	// of the stream
+	MediaType  string
+	Bandwidth  int
+	Resolution string
+	Codecs     string
+	// Init is the URL of the initialization segment
+	Init string
+	// Segments are the media segments of DASH representations
+	Segments []*Segment
+}
+
+// Segment is a media segment
+type Segment struct {
+	// URL is the absolute URL of the segment
+	URL string
+	// Duration is the duration of the segment in seconds
+	Duration float64
+}
+
+// Detect returns the manifest type of a response based on its
+// Content-Type, URL and content
+func Detect(r *colly.Response) Type {
+	contentType := ""
+	if r.Headers != nil {
+		contentType = strings.ToLower(r.Headers.Get("Content-Type"))
+	}
+	p := strings.ToLower(r.Request.URL.Path)
+	switch {
+	case strings.Contains(contentType, "mpegurl") || strings.HasSuffix(p, ".m3u8"):
+		return HLS
+	case strings.Contains(contentType, "dash+xml") || strings.HasSuffix(p, ".mpd"):
+		return DASH
+	}
+	body := bytes.TrimSpace(bytes.TrimPrefix(r.Body, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(body, []byte("#EXTM3U")) {
+		return HLS
+	}
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	if bytes.Contains(body, []byte("<MPD")) {
+		return DASH
+	}
+	return Unknown
+}
+
+// Parse parses a manifest response
+func Parse(r *colly.Response) (*Manifest, error) {
+	switch Detect(r) {
+	case HLS:
+		return ParseHLS(r.Request.URL, r.Body)
+	case DASH:
+		return ParseDASH(r.Request.URL, r.Body)
+	}
+	return nil, ErrNotManifest
+}
+
+// Downloader receives the segments of the manifests. downloads.Downloader
+// implements it.
+type Downloader interface {
+	Download(URL string) error
+}
+
+// Handler processes the manifests received by a Collector
+type Handler struct {
+	// FollowVariants visits the variant playlists of HLS master playlists
+	FollowVariants bool
+	// VisitSegments visits the media segments
+	VisitSegments bool
+	// Downloader receives the media segments instead of the Collector
+	// if VisitSegments is true
+	Downloader Downloader
+	// OnManifest is called with every parsed manifest
+	OnManifest func(*Manifest, *colly.Response)
+	// OnError is called if a manifest can not be parsed
+	OnError func(*colly.Response, error)
+}
+
+// Attach registers the Handler on the Collector
+func (h *Handler) Attach(c *colly.Collector) {
+	c.OnResponse(func(r *colly.Response) {
+		if Detect(r) == Unknown {
+			return
+		}
+		m, err := Parse(r)
+		if err != nil {
+			if h.OnError != nil {
+				h.OnError(r, err)
+			}
+			return
+		}
+		if h.OnManifest != nil {
+			h.OnManifest(m, r)
+		}
+		for _, v := range m.Variants {
+			if h.FollowVariants && v.URL != "" {
+				r.Request.Visit(v.URL)
+			}
+			if v.Init != "" {
+				h.segment(r, v.Init)
+			}
+			for _, s := range v.Segments {
+				h.segment(r, s.URL)
+			}
+		}
+		if m.Init != "" {
+			h.segment(r, m.Init)
+		}
+		for _, s := range m.Segments {
+			h.segment(r, s.URL)
+		}
+	})
+}
+
+func (h *Handler) segment(r *colly.Response, URL string) {
+	if !h.VisitSegments {
+		return
+	}
+	if h.Downloader != nil {
+		h.Downloader.Download(URL)
+		return
+	}
+	r.Request.Visit(URL)
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
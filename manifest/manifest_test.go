@@ -0,0 +1,158 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/collytest"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2",AUDIO="aac"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,RESOLUTION=1280x720
+/hls/high/index.m3u8
+`
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:9.009,
+seg0.ts
+#EXTINF:9.009,
+seg1.ts
+#EXTINF:3.003,
+seg2.ts
+#EXT-X-ENDLIST
+`
+
+const mpdTemplate = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT9.5S">
+  <BaseURL>media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="video/mp4" codecs="avc1.4d401f">
+      <SegmentTemplate media="$RepresentationID$/seg-$Number%05d$.m4s" initialization="$RepresentationID$/init.mp4" startNumber="1" duration="4" timescale="1"/>
+      <Representation id="720p" bandwidth="2000000" width="1280" height="720"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4">
+      <Representation id="aac" bandwidth="128000">
+        <SegmentTemplate media="audio/$Time$.m4s" timescale="1000">
+          <SegmentTimeline><S t="0" d="2000" r="1"/><S d="1000"/></SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestParseHLS(t *testing.T) {
+	base, _ := url.Parse("http://example.com/hls/master.m3u8")
+	m, err := ParseHLS(base, []byte(masterPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Variants) != 3 || m.Live {
+		t.Fatalf("Invalid master playlist %+v", m)
+	}
+	if v := m.Variants[1]; v.URL != "http://example.com/hls/low/index.m3u8" || v.Bandwidth != 1280000 || v.Codecs != "avc1.4d401e,mp4a.40.2" || v.Resolution != "640x360" {
+		t.Errorf("Invalid variant %+v", v)
+	}
+	if v := m.Variants[0]; v.URL != "http://example.com/hls/audio/en.m3u8" || v.MediaType != "audio" {
+		t.Errorf("Invalid rendition %+v", v)
+	}
+
+	m, err = ParseHLS(base, []byte(mediaPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) != 3 || m.Live || m.Init != "http://example.com/hls/init.mp4" {
+		t.Fatalf("Invalid media playlist %+v", m)
+	}
+	if s := m.Segments[2]; s.URL != "http://example.com/hls/seg2.ts" || s.Duration != 3.003 {
+		t.Errorf("Invalid segment %+v", s)
+	}
+	if _, err := ParseHLS(base, []byte("<html>")); err == nil {
+		t.Error("Invalid playlist was parsed")
+	}
+}
+
+func TestParseDASH(t *testing.T) {
+	base, _ := url.Parse("http://example.com/dash/stream.mpd")
+	m, err := ParseDASH(base, []byte(mpdTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Variants) != 2 || m.Live {
+		t.Fatalf("Invalid MPD %+v", m)
+	}
+	v := m.Variants[0]
+	if v.MediaType != "video" || v.Resolution != "1280x720" || v.Init != "http://example.com/dash/media/720p/init.mp4" || len(v.Segments) != 3 {
+		t.Fatalf("Invalid representation %+v", v)
+	}
+	if v.Segments[2].URL != "http://example.com/dash/media/720p/seg-00003.m4s" {
+		t.Errorf("Invalid segment %+v", v.Segments[2])
+	}
+	v = m.Variants[1]
+	if v.MediaType != "audio" || len(v.Segments) != 3 || v.Segments[2].URL != "http://example.com/dash/media/audio/4000.m4s" || v.Segments[2].Duration != 1 {
+		t.Errorf("Invalid timeline representation %+v", v.Segments)
+	}
+}
+
+type testDownloader struct {
+	URLs []string
+	lock sync.Mutex
+}
+
+func (d *testDownloader) Download(URL string) error {
+	d.lock.Lock()
+	d.URLs = append(d.URLs, URL)
+	d.lock.Unlock()
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	site := collytest.NewSite()
+	defer site.Close()
+	site.Page("/hls/master.m3u8").WithContentType("application/vnd.apple.mpegurl").WithBody(masterPlaylist)
+	site.Page("/hls/low/index.m3u8").WithContentType("application/vnd.apple.mpegurl").WithBody(mediaPlaylist)
+	site.Page("/hls/high/index.m3u8").WithContentType("text/plain").WithBody(mediaPlaylist)
+
+	c := colly.NewCollector()
+	rec := collytest.NewRecorder(c)
+	d := &testDownloader{}
+	var manifests []*Manifest
+	h := &Handler{
+		FollowVariants: true,
+		VisitSegments:  true,
+		Downloader:     d,
+		OnManifest: func(m *Manifest, _ *colly.Response) {
+			manifests = append(manifests, m)
+		},
+	}
+	h.Attach(c)
+	c.Visit(site.URL("/hls/master.m3u8"))
+
+	rec.AssertVisited(t, "/hls/master.m3u8", "/hls/low/index.m3u8", "/hls/high/index.m3u8")
+	if len(manifests) != 3 {
+		t.Errorf("%d manifests parsed, want 3", len(manifests))
+	}
+	if len(d.URLs) != 8 {
+		t.Errorf("%d segments downloaded, want 8: %v", len(d.URLs), d.URLs)
+	}
+}
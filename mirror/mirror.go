@@ -0,0 +1,230 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror stores the pages of a crawl in a local directory tree
+// and keeps it up to date cheaply. Repeated mirrors send conditional
+// requests based on the modification times of the local files, serve
+// the unchanged pages from the disk and rewrite only the changed files:
+//
+//	c := colly.NewCollector(colly.AllowedDomains("example.com"))
+//	m := mirror.New(c, "example")
+//	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+//		e.Request.Visit(e.Attr("href"))
+//	})
+//	c.Visit("https://example.com/")
+//	c.Wait()
+//	if err := m.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// StatusKey is the Context key of the mirror status of the responses
+const StatusKey = "mirror_status"
+
+// Mirror statuses of the responses
+const (
+	// Created is the status of the pages stored the first time
+	Created = "created"
+	// Updated is the status of the changed pages
+	Updated = "updated"
+	// Unchanged is the status of the pages which were not modified
+	// since the previous mirror. Their bodies are read from the disk.
+	Unchanged = "unchanged"
+)
+
+// Stats contains the number of the mirrored pages by status
+type Stats struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// Mirror is a colly.Fetcher storing the successful GET responses of a
+// Collector in Dir. The files of a host are stored in the directory of
+// the host, e.g. "example.com/docs/index.html" for
+// https://example.com/docs/.
+type Mirror struct {
+	// Dir is the root directory of the mirror
+	Dir     string
+	network colly.Fetcher
+	lock    sync.Mutex
+	stats   Stats
+	err     error
+}
+
+// New creates a Mirror of the Collector in dir and sets it as the
+// Fetcher of the Collector. The requests are sent by the built-in HTTP
+// backend of the Collector.
+func New(c *colly.Collector, dir string) *Mirror {
+	m := &Mirror{
+		Dir:     dir,
+		network: c.HTTPFetcher(),
+	}
+	c.SetFetcher(m)
+	return m
+}
+
+// Path returns the path of the local file of the URL
+func (m *Mirror) Path(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") || p == "/" {
+		p = path.Join(p, "index.html")
+	}
+	if u.RawQuery != "" {
+		p += "@" + url.QueryEscape(u.RawQuery)
+	}
+	return filepath.Join(m.Dir, strings.ToLower(u.Host), filepath.FromSlash(p))
+}
+
+// Stats returns the number of the mirrored pages by status
+func (m *Mirror) Stats() Stats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.stats
+}
+
+// Err returns the first error of writing the files
+func (m *Mirror) Err() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.err
+}
+
+// Do implements colly.Fetcher
+func (m *Mirror) Do(ctx context.Context, r *colly.Request) (*colly.Response, error) {
+	if r.Method != "GET" {
+		return m.network.Do(ctx, r)
+	}
+	filename := m.Path(r.URL)
+	info, err := os.Stat(filename)
+	local := err == nil && info.Mode().IsRegular()
+	if local && r.Headers.Get("If-Modified-Since") == "" && r.Headers.Get("Range") == "" {
+		r.Headers.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	resp, err := m.network.Do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && local:
+		body, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		resp.StatusCode = http.StatusOK
+		resp.Body = body
+		if resp.Headers.Get("Content-Type") == "" {
+			if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+				resp.Headers.Set("Content-Type", contentType)
+			} else {
+				resp.Headers.Set("Content-Type", http.DetectContentType(body))
+			}
+		}
+		m.done(r, Unchanged, nil)
+	case resp.StatusCode == http.StatusOK:
+		status, err := m.write(filename, local, resp)
+		m.done(r, status, err)
+	}
+	return resp, nil
+}
+
+// write stores the body of the response unless the local file has the
+// same content
+func (m *Mirror) write(filename string, local bool, resp *colly.Response) (string, error) {
+	status := Created
+	if local {
+		status = Updated
+		if same, err := sameContent(filename, resp.Body); err == nil && same {
+			if modified, err := http.ParseTime(resp.Headers.Get("Last-Modified")); err == nil {
+				os.Chtimes(filename, time.Now(), modified)
+			}
+			return Unchanged, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0750); err != nil {
+		return "", err
+	}
+	// the file is replaced atomically, so an interrupted mirror does
+	// not leave truncated files
+	tmp := filename + "~"
+	if err := ioutil.WriteFile(tmp, resp.Body, 0640); err != nil {
+		return "", err
+	}
+	// the modification time follows the clock of the server if it is
+	// known, so the next If-Modified-Since matches its Last-Modified
+	if modified, err := http.ParseTime(resp.Headers.Get("Last-Modified")); err == nil {
+		os.Chtimes(tmp, time.Now(), modified)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return status, nil
+}
+
+func (m *Mirror) done(r *colly.Request, status string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err != nil {
+		if m.err == nil {
+			m.err = err
+		}
+		return
+	}
+	switch status {
+	case Created:
+		m.stats.Created++
+	case Updated:
+		m.stats.Updated++
+	case Unchanged:
+		m.stats.Unchanged++
+	}
+	if r.Ctx != nil {
+		r.Ctx.Put(StatusKey, status)
+	}
+}
+
+// sameContent returns true if the file has the content
+func sameContent(filename string, content []byte) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(content)
+	return bytes.Equal(h.Sum(nil), sum[:]), nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+type site struct {
+	lock        sync.Mutex
+	pages       map[string]string
+	modified    map[string]time.Time
+	notModified int
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	page, ok := s.pages[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "text/html")
+	http.ServeContent(rec, r, r.URL.Path, s.modified[r.URL.Path], strings.NewReader(page))
+	if rec.Code == http.StatusNotModified {
+		s.notModified++
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+func (s *site) set(p, content string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pages[p] = content
+	s.modified[p] = time.Now().Add(time.Hour).Truncate(time.Second)
+}
+
+func mirrorSite(t *testing.T, u, dir string) (Stats, []string) {
+	c := colly.NewCollector()
+	m := New(c, dir)
+	var statuses []string
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.OnScraped(func(r *colly.Response) {
+		statuses = append(statuses, r.Request.URL.Path+" "+r.Ctx.Get(StatusKey))
+	})
+	if err := c.Visit(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return m.Stats(), statuses
+}
+
+func TestMirror(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	s := &site{
+		pages: map[string]string{
+			"/":          `<a href="/docs/page?id=1">page</a>`,
+			"/docs/page": `<a href="/">home</a>`,
+		},
+		modified: map[string]time.Time{"/": old, "/docs/page": old},
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "colly-mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the visit of the page finishes first
+	stats, statuses := mirrorSite(t, ts.URL+"/", dir)
+	if stats != (Stats{Created: 2}) || len(statuses) != 2 || statuses[0] != "/docs/page created" {
+		t.Fatalf("Unexpected first mirror %+v %v", stats, statuses)
+	}
+	host := strings.ToLower(strings.TrimPrefix(ts.URL, "http://"))
+	page := filepath.Join(dir, host, "docs", "page@id%3D1")
+	info, err := os.Stat(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("Modification time %v is not the Last-Modified time %v", info.ModTime(), old)
+	}
+
+	// unchanged pages are served from the disk and their links are
+	// followed
+	stats, statuses = mirrorSite(t, ts.URL+"/", dir)
+	if stats != (Stats{Unchanged: 2}) || len(statuses) != 2 || s.notModified != 2 {
+		t.Fatalf("Unexpected second mirror %+v %v %d", stats, statuses, s.notModified)
+	}
+
+	s.set("/docs/page", `<a href="/">home</a> updated`)
+	stats, _ = mirrorSite(t, ts.URL+"/", dir)
+	if stats != (Stats{Updated: 1, Unchanged: 1}) {
+		t.Errorf("Unexpected third mirror %+v", stats)
+	}
+	content, _ := ioutil.ReadFile(page)
+	if !strings.Contains(string(content), "updated") {
+		t.Errorf("File was not updated: %q", content)
+	}
+}
+
+func TestPath(t *testing.T) {
+	m := &Mirror{Dir: "root"}
+	tests := map[string]string{
+		"http://Example.com":               "root/example.com/index.html",
+		"http://example.com/a/":            "root/example.com/a/index.html",
+		"http://example.com/a/../../b.css": "root/example.com/b.css",
+		"http://example.com/s?q=a b":       "root/example.com/s@q%3Da+b",
+	}
+	for u, expected := range tests {
+		parsed, _ := url.Parse(u)
+		if p := filepath.ToSlash(m.Path(parsed)); p != expected {
+			t.Errorf("Invalid path of %s: %s", u, p)
+		}
+	}
+}
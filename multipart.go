@@ -0,0 +1,173 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PostFile starts a collector job by creating a multipart POST request
+// uploading the file of the path in the field, with the extra form
+// fields. The file is streamed from the disk when the request is sent,
+// so it is not loaded into memory. Uploads are never skipped as
+// revisits. PostFile also calls the previously provided callbacks.
+func (c *Collector) PostFile(URL, field, path string, extraFields map[string]string) error {
+	body, contentType, err := newFileUpload(field, path, extraFields)
+	if err != nil {
+		return err
+	}
+	hdr := http.Header{}
+	hdr.Set("Content-Type", contentType)
+	hdr.Set("User-Agent", c.UserAgent)
+	return c.scrape(URL, "POST", 1, body, nil, hdr, false)
+}
+
+// createMultipartReader encodes the fields as a multipart/form-data body
+// in the order of their names
+func createMultipartReader(boundary string, data map[string][]byte) io.Reader {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	w.SetBoundary(boundary)
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		part, _ := w.CreateFormField(name)
+		part.Write(data[name])
+	}
+	w.Close()
+	// the body must be readable again after the revisit check
+	return bytes.NewReader(buf.Bytes())
+}
+
+// fileUpload is a multipart/form-data body of a file upload. The file is
+// opened by the first Read and closed by Close.
+type fileUpload struct {
+	prefix []byte
+	suffix []byte
+	path   string
+	size   int64
+	r      io.Reader
+	file   *os.File
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func newFileUpload(field, path string, extraFields map[string]string) (*fileUpload, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		return nil, "", fmt.Errorf("%s is a directory", path)
+	}
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	names := make([]string, 0, len(extraFields))
+	for name := range extraFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := w.WriteField(name, extraFields[name]); err != nil {
+			return nil, "", err
+		}
+	}
+	filename := filepath.Base(path)
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(field), quoteEscaper.Replace(filename)))
+	h.Set("Content-Type", contentType)
+	if _, err := w.CreatePart(h); err != nil {
+		return nil, "", err
+	}
+	u := &fileUpload{
+		prefix: append([]byte(nil), buf.Bytes()...),
+		path:   path,
+		size:   info.Size(),
+	}
+	// the closing boundary follows the content of the file
+	buf.Reset()
+	w.Close()
+	u.suffix = append([]byte(nil), buf.Bytes()...)
+	return u, w.FormDataContentType(), nil
+}
+
+// Len returns the length of the body
+func (u *fileUpload) Len() int64 {
+	return int64(len(u.prefix)) + u.size + int64(len(u.suffix))
+}
+
+func (u *fileUpload) Read(p []byte) (int, error) {
+	if u.r == nil {
+		f, err := os.Open(u.path)
+		if err != nil {
+			return 0, err
+		}
+		u.file = f
+		// the file is read up to its size at the time of PostFile to
+		// keep the Content-Length valid
+		u.r = io.MultiReader(bytes.NewReader(u.prefix), &exactReader{r: f, n: u.size}, bytes.NewReader(u.suffix))
+	}
+	return u.r.Read(p)
+}
+
+func (u *fileUpload) Close() error {
+	if u.file == nil {
+		return nil
+	}
+	return u.file.Close()
+}
+
+// reopen returns a new reader of the body
+func (u *fileUpload) reopen() (io.ReadCloser, error) {
+	return &fileUpload{prefix: u.prefix, suffix: u.suffix, path: u.path, size: u.size}, nil
+}
+
+// exactReader reads n bytes of r and fails if r ends earlier
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	if err == io.EOF && e.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newMultipartServer returns the fields and files of multipart requests
+// and the transfer details of the requests
+func newMultipartServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "length=%d chunked=%v\n", r.ContentLength, len(r.TransferEncoding) > 0)
+		for name, values := range r.MultipartForm.Value {
+			fmt.Fprintf(w, "%s=%s\n", name, values[0])
+		}
+		for name, files := range r.MultipartForm.File {
+			f, _ := files[0].Open()
+			content, _ := ioutil.ReadAll(f)
+			f.Close()
+			fmt.Fprintf(w, "%s:%s:%s=%s\n", name, files[0].Filename, files[0].Header.Get("Content-Type"), content)
+		}
+	}))
+}
+
+func TestPostMultipart(t *testing.T) {
+	ts := newMultipartServer()
+	defer ts.Close()
+
+	c := NewCollector()
+	var body string
+	c.OnResponse(func(r *Response) {
+		body = string(r.Body)
+	})
+	if err := c.PostMultipart(ts.URL, map[string][]byte{"name": []byte("colly"), "data": []byte("a\r\nb")}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "name=colly\n") || !strings.Contains(body, "data=a\r\nb\n") || strings.Contains(body, "length=0") {
+		t.Errorf("Invalid multipart body: %q", body)
+	}
+}
+
+func TestPostFile(t *testing.T) {
+	ts := newMultipartServer()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "colly-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, `report "final".json`)
+	content := strings.Repeat(`{"a":1}`, 1000)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCollector()
+	var bodies []string
+	c.OnResponse(func(r *Response) {
+		bodies = append(bodies, string(r.Body))
+	})
+	fields := map[string]string{"title": "report"}
+	if err := c.PostFile(ts.URL, "upload", path, fields); err != nil {
+		t.Fatal(err)
+	}
+	// the file is read again for the redirected request
+	if err := c.PostFile(ts.URL+"/redirect", "upload", path, fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("Unexpected responses: %q", bodies)
+	}
+	for _, body := range bodies {
+		if !strings.Contains(body, "chunked=false") || strings.Contains(body, "length=-1") {
+			t.Errorf("Upload has no Content-Length: %q", body[:40])
+		}
+		if !strings.Contains(body, "title=report\n") {
+			t.Error("Extra field is missing")
+		}
+		if !strings.Contains(body, `upload:report "final".json:application/json=`+content+"\n") {
+			t.Errorf("Invalid file part: %q", body[:80])
+		}
+	}
+
+	if err := c.PostFile(ts.URL, "upload", filepath.Join(dir, "missing"), nil); !os.IsNotExist(err) {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
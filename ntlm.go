@@ -0,0 +1,237 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLM negotiate flags
+const (
+	ntlmNegotiateUnicode    = 0x00000001
+	ntlmRequestTarget       = 0x00000004
+	ntlmNegotiateNTLM       = 0x00000200
+	ntlmNegotiateAlwaysSign = 0x00008000
+	ntlmNegotiateExtended   = 0x00080000
+	ntlmNegotiateTargetInfo = 0x00800000
+	ntlmNegotiate128        = 0x20000000
+	ntlmNegotiate56         = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtended | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// errInvalidNTLMChallenge is returned for malformed NTLM challenges
+var errInvalidNTLMChallenge = errors.New("Invalid NTLM challenge message")
+
+// NTLMAuth returns an Auth sending the credentials by NTLMv2
+// authentication. NTLM authenticates connections instead of requests,
+// so the handshake of every request is completed on the connection of
+// its first round trip. Requests of the domain should not be sent in
+// parallel over HTTP/2.
+func NTLMAuth(domain, username, password string) Auth {
+	return &ntlmAuth{domain: domain, username: username, password: password}
+}
+
+type ntlmAuth struct {
+	domain   string
+	username string
+	password string
+}
+
+func (a *ntlmAuth) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	return nil
+}
+
+func (a *ntlmAuth) Challenge(res *http.Response, retry *http.Request) (bool, error) {
+	var challenge string
+	found := false
+	for _, v := range res.Header["Www-Authenticate"] {
+		if strings.EqualFold(v, "NTLM") {
+			found = true
+		} else if len(v) > 5 && strings.EqualFold(v[:5], "NTLM ") {
+			challenge = strings.TrimSpace(v[5:])
+			found = true
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	sent := res.Request.Header.Get("Authorization")
+	if challenge == "" {
+		// the server does not accept the credentials or lost the
+		// negotiation
+		if strings.HasPrefix(sent, "NTLM ") {
+			return false, nil
+		}
+		return true, a.Authorize(retry)
+	}
+	msg, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		return false, errInvalidNTLMChallenge
+	}
+	auth, err := ntlmAuthenticateMessage(msg, a.domain, a.username, a.password)
+	if err != nil {
+		return false, err
+	}
+	retry.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(auth))
+	return true, nil
+}
+
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	return msg
+}
+
+// ntlmAuthenticateMessage creates the NTLMv2 response of a challenge
+// message
+func ntlmAuthenticateMessage(challenge []byte, domain, username, password string) ([]byte, error) {
+	if len(challenge) < 32 || !bytes.Equal(challenge[:8], ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errInvalidNTLMChallenge
+	}
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	serverChallenge := challenge[24:32]
+	var targetInfo []byte
+	if flags&ntlmNegotiateTargetInfo != 0 && len(challenge) >= 48 {
+		l := int(binary.LittleEndian.Uint16(challenge[40:]))
+		o := int(binary.LittleEndian.Uint32(challenge[44:]))
+		if o+l > len(challenge) {
+			return nil, errInvalidNTLMChallenge
+		}
+		targetInfo = challenge[o : o+l]
+	}
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	ntHash := md4Sum(utf16LE(password))
+	ntlmV2Hash := hmacMD5(ntHash, utf16LE(strings.ToUpper(username)+domain))
+	// 100ns intervals since 1601-01-01
+	timestamp := uint64(time.Now().UnixNano()/100) + 116444736000000000
+	blob := make([]byte, 28, 28+len(targetInfo)+4)
+	blob[0], blob[1] = 1, 1
+	binary.LittleEndian.PutUint64(blob[8:], timestamp)
+	copy(blob[16:], clientChallenge)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+	ntProof := hmacMD5(ntlmV2Hash, serverChallenge, blob)
+	ntResponse := append(ntProof, blob...)
+	lmResponse := append(hmacMD5(ntlmV2Hash, serverChallenge, clientChallenge), clientChallenge...)
+
+	payloads := [][]byte{lmResponse, ntResponse, utf16LE(domain), utf16LE(username), nil, nil}
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerSize
+	for i, p := range payloads {
+		field := msg[12+i*8:]
+		binary.LittleEndian.PutUint16(field, uint16(len(p)))
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(field[4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], ntlmNegotiateFlags&flags|ntlmNegotiateUnicode)
+	for _, p := range payloads {
+		msg = append(msg, p...)
+	}
+	return msg, nil
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	m := hmac.New(md5.New, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+func utf16LE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// md4Sum returns the MD4 digest (RFC 1320) of data, which is required by
+// NTLM
+func md4Sum(data []byte) []byte {
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+	l := len(data)
+	msg := append(append([]byte(nil), data...), 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(l)*8)
+	msg = append(msg, length[:]...)
+
+	var x [16]uint32
+	for len(msg) > 0 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[i*4:])
+		}
+		aa, bb, cc, dd := a, b, c, d
+		f := func(x, y, z uint32) uint32 { return x&y | ^x&z }
+		g := func(x, y, z uint32) uint32 { return x&y | x&z | y&z }
+		h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+		for _, i := range []uint{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+f(b, c, d)+x[i], 3)
+			d = bits.RotateLeft32(d+f(a, b, c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+f(d, a, b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+f(c, d, a)+x[i+3], 19)
+		}
+		for _, i := range []uint{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+g(b, c, d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+g(a, b, c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+g(d, a, b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+g(c, d, a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []uint{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+h(b, c, d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+h(a, b, c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+h(d, a, b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+h(c, d, a)+x[i+12]+0x6ed9eba1, 15)
+		}
+		a, b, c, d = a+aa, b+bb, c+cc, d+dd
+		msg = msg[64:]
+	}
+	sum := make([]byte, 16)
+	binary.LittleEndian.PutUint32(sum, a)
+	binary.LittleEndian.PutUint32(sum[4:], b)
+	binary.LittleEndian.PutUint32(sum[8:], c)
+	binary.LittleEndian.PutUint32(sum[12:], d)
+	return sum
+}
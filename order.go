@@ -0,0 +1,158 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"sync"
+)
+
+// DeterministicOrder makes asynchronous crawls reproducible. The pages
+// are crawled level by level: the URLs found on the pages of a depth
+// are requested after every page of the depth is processed, in the
+// order of their pages and of the calls of Visit. The requests of a
+// level are sent in parallel, but the OnResponse, OnHTML, OnXML,
+// OnScraped and OnError callbacks are called in the order of the
+// requests, one response at a time. Synchronous crawls are always
+// deterministic.
+func DeterministicOrder() CollectorOption {
+	return func(c *Collector) {
+		c.DeterministicOrder = true
+	}
+}
+
+// crawlOrder schedules the requests of DeterministicOrder crawls
+type crawlOrder struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	levels map[int]*orderLevel
+}
+
+// orderLevel contains the requests of a depth
+type orderLevel struct {
+	// scheduled is the number of scheduled requests
+	scheduled int
+	// next is the sequence number of the next processed request
+	next int
+	done map[int]bool
+	// deferred are the requests waiting for the previous level
+	deferred []func()
+}
+
+// orderTurn is the position of a request in its level
+type orderTurn struct {
+	order *crawlOrder
+	level int
+	seq   int
+	once  sync.Once
+}
+
+type orderTurnKey struct{}
+
+func newCrawlOrder() *crawlOrder {
+	o := &crawlOrder{levels: make(map[int]*orderLevel)}
+	o.cond = sync.NewCond(&o.lock)
+	return o
+}
+
+// level returns the requests of a depth. o.lock must be held.
+func (o *crawlOrder) level(depth int) *orderLevel {
+	lv, ok := o.levels[depth]
+	if !ok {
+		lv = &orderLevel{done: make(map[int]bool)}
+		o.levels[depth] = lv
+	}
+	return lv
+}
+
+// complete returns true if the requests of the depth and of the lower
+// depths are processed. o.lock must be held.
+func (o *crawlOrder) complete(depth int) bool {
+	for d := depth; d > 0; d-- {
+		lv, ok := o.levels[d]
+		if ok && (lv.next != lv.scheduled || len(lv.deferred) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// postpone postpones the scheduling of a request until the previous level
+// is complete. It returns false if the request can be scheduled now.
+func (o *crawlOrder) postpone(depth int, schedule func()) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if depth <= 1 || o.complete(depth-1) {
+		return false
+	}
+	lv := o.level(depth)
+	lv.deferred = append(lv.deferred, schedule)
+	return true
+}
+
+// assign returns the turn of a new scheduled request
+func (o *crawlOrder) assign(depth int) *orderTurn {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	lv := o.level(depth)
+	t := &orderTurn{order: o, level: depth, seq: lv.scheduled}
+	lv.scheduled++
+	return t
+}
+
+// wait blocks until the requests before t are processed
+func (t *orderTurn) wait() {
+	o := t.order
+	o.lock.Lock()
+	lv := o.levels[t.level]
+	for lv.next != t.seq {
+		o.cond.Wait()
+	}
+	o.lock.Unlock()
+}
+
+// done marks the request processed and schedules the requests of the
+// next level if its level is complete
+func (t *orderTurn) done() {
+	t.once.Do(func() {
+		o := t.order
+		o.lock.Lock()
+		lv := o.levels[t.level]
+		lv.done[t.seq] = true
+		for lv.done[lv.next] {
+			delete(lv.done, lv.next)
+			lv.next++
+		}
+		o.cond.Broadcast()
+		var deferred []func()
+		if next, ok := o.levels[t.level+1]; ok && o.complete(t.level) {
+			deferred = next.deferred
+			next.deferred = nil
+		}
+		o.lock.Unlock()
+		for _, f := range deferred {
+			f()
+		}
+	})
+}
+
+func withOrderTurn(ctx context.Context, t *orderTurn) context.Context {
+	return context.WithValue(ctx, orderTurnKey{}, t)
+}
+
+func orderTurnFromContext(ctx context.Context) *orderTurn {
+	t, _ := ctx.Value(orderTurnKey{}).(*orderTurn)
+	return t
+}
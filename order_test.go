@@ -0,0 +1,69 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterministicOrder(t *testing.T) {
+	// every page links three child pages and the root page
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		p := strings.TrimSuffix(r.URL.Path, "/")
+		if strings.Count(p, "/") >= 3 {
+			w.Write([]byte(`<a href="/">root</a>`))
+			return
+		}
+		fmt.Fprintf(w, `<a href="%[1]s/a">a</a><a href="%[1]s/b">b</a><a href="/">root</a><a href="%[1]s/c">c</a>`, p)
+	}))
+	defer ts.Close()
+
+	crawl := func() []string {
+		c := NewCollector(Async(true), DeterministicOrder())
+		c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 4})
+		var order []string
+		c.OnHTML("a[href]", func(e *HTMLElement) {
+			e.Request.Visit(e.Attr("href"))
+		})
+		c.OnResponse(func(r *Response) {
+			order = append(order, r.Request.URL.Path)
+		})
+		c.Visit(ts.URL + "/")
+		c.Wait()
+		return order
+	}
+
+	expected := []string{"/", "/a", "/b", "/c"}
+	for _, p := range []string{"/a", "/b", "/c"} {
+		expected = append(expected, p+"/a", p+"/b", p+"/c")
+	}
+	for _, p := range expected[4:] {
+		expected = append(expected, p+"/a", p+"/b", p+"/c")
+	}
+	for i := 0; i < 3; i++ {
+		if order := crawl(); !reflect.DeepEqual(order, expected) {
+			t.Fatalf("Unexpected order:\n%v\nexpected:\n%v", order, expected)
+		}
+	}
+}
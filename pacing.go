@@ -0,0 +1,250 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// PacingProfile paces the requests of every identity like a human
+// visitor browsing a site. The pages of an identity are requested one by
+// one with a think time between them, the previous page of the identity
+// is sent as Referer and some assets of the pages are fetched like a
+// browser would. The pacing is applied on top of the LimitRules.
+//
+// The identity of a request is Request.Identity, which defaults to the
+// host of the URL.
+type PacingProfile struct {
+	// ThinkTime is the median pause between two pages of an identity
+	ThinkTime time.Duration
+	// Jitter is the standard deviation of the logarithm of the think
+	// time. Zero means constant think time.
+	Jitter float64
+	// LongPauseProbability is the probability of an additional
+	// LongPause before a page, e.g. reading an article
+	LongPauseProbability float64
+	// LongPause is the median of the long pauses
+	LongPause time.Duration
+	// AssetProbability is the probability of fetching the images,
+	// stylesheets and scripts of a HTML page of the same host after the
+	// page. The assets are checked like the other requests, e.g. the
+	// assets disallowed by robots.txt are skipped.
+	AssetProbability float64
+	// MaxAssets is the maximum number of fetched assets of a page
+	MaxAssets int
+}
+
+// PacingProfiles contains the built-in pacing profiles
+var PacingProfiles = map[string]*PacingProfile{
+	// reader reads the pages and loads most of their assets
+	"reader": {
+		ThinkTime:            8 * time.Second,
+		Jitter:               0.6,
+		LongPauseProbability: 0.1,
+		LongPause:            time.Minute,
+		AssetProbability:     0.8,
+		MaxAssets:            6,
+	},
+	// skimmer clicks through the pages quickly
+	"skimmer": {
+		ThinkTime:            2 * time.Second,
+		Jitter:               0.4,
+		LongPauseProbability: 0.02,
+		LongPause:            15 * time.Second,
+		AssetProbability:     0.3,
+		MaxAssets:            3,
+	},
+}
+
+// UsePacingProfile paces the requests of the Collector by the profile
+func UsePacingProfile(p *PacingProfile) CollectorOption {
+	return func(c *Collector) {
+		c.PacingProfile = p
+	}
+}
+
+// pacer keeps the state of the paced identities
+type pacer struct {
+	lock       sync.Mutex
+	identities map[string]*identityPace
+}
+
+// identityPace is the state of an identity. The lock channel allows one
+// page request of the identity at a time.
+type identityPace struct {
+	lock    chan struct{}
+	last    time.Time
+	lastURL string
+}
+
+// thinkTime returns a random pause before the next page
+func (p *PacingProfile) thinkTime() time.Duration {
+	d := float64(p.ThinkTime) * math.Exp(p.Jitter*rand.NormFloat64())
+	if p.LongPauseProbability > 0 && rand.Float64() < p.LongPauseProbability {
+		d += float64(p.LongPause) * (0.5 + rand.Float64())
+	}
+	return time.Duration(d)
+}
+
+// beginPace waits for the turn of the identity of the request and sets the
+// Referer of the request to the previous page of the identity
+func (c *Collector) beginPace(request *Request, req *http.Request) (*identityPace, error) {
+	identity := request.Identity
+	if identity == "" {
+		identity = req.URL.Hostname()
+	}
+	c.pacer.lock.Lock()
+	if c.pacer.identities == nil {
+		c.pacer.identities = make(map[string]*identityPace)
+	}
+	ip, ok := c.pacer.identities[identity]
+	if !ok {
+		ip = &identityPace{lock: make(chan struct{}, 1)}
+		c.pacer.identities[identity] = ip
+	}
+	c.pacer.lock.Unlock()
+	ctx := req.Context()
+	select {
+	case ip.lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !ip.last.IsZero() {
+		if wait := time.Until(ip.last.Add(c.PacingProfile.thinkTime())); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				<-ip.lock
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if ip.lastURL != "" && req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", ip.lastURL)
+	}
+	return ip, nil
+}
+
+// endPace releases the turn of the identity and fetches the assets of
+// the response. The turn is released first, because the assets wait for
+// slots of the frontier, which the next request of the identity may
+// hold.
+func (c *Collector) endPace(ip *identityPace, req *http.Request, depth int, response *Response) {
+	ip.last = time.Now()
+	ip.lastURL = req.URL.String()
+	<-ip.lock
+	p := c.PacingProfile
+	if response == nil || p.MaxAssets <= 0 || rand.Float64() >= p.AssetProbability {
+		return
+	}
+	if response.Headers == nil || !strings.Contains(strings.ToLower(response.Headers.Get("Content-Type")), "html") {
+		return
+	}
+	assets := pageAssets(response.Body)
+	rand.Shuffle(len(assets), func(i, j int) {
+		assets[i], assets[j] = assets[j], assets[i]
+	})
+	fetched := 0
+	for _, a := range assets {
+		if fetched >= p.MaxAssets {
+			return
+		}
+		u, err := req.URL.Parse(a)
+		if err != nil || u.Host != req.URL.Host {
+			continue
+		}
+		// assets forbidden by the checks of the Collector, e.g. by
+		// robots.txt, are skipped
+		if c.requestCheck(u.String(), u, "GET", nil, depth, true) != nil {
+			continue
+		}
+		fetched++
+		c.fetchAsset(u, req, depth)
+	}
+}
+
+// fetchAsset downloads an asset of a page in a slot of its LimitRule and
+// discards it. The asset is counted in the Stats of the Collector, but
+// the callbacks of the Collector are not called.
+func (c *Collector) fetchAsset(u *url.URL, page *http.Request, depth int) {
+	asset, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return
+	}
+	asset = asset.WithContext(c.Context)
+	asset.Header.Set("User-Agent", page.Header.Get("User-Agent"))
+	asset.Header.Set("Referer", page.URL.String())
+	asset.Header.Set("Accept", "*/*")
+	request := &Request{
+		URL:       asset.URL,
+		Headers:   &asset.Header,
+		Method:    "GET",
+		Depth:     depth,
+		ID:        atomic.AddUint32(&c.requestCount, 1),
+		collector: c,
+	}
+	c.stats.request(request)
+	start := time.Now()
+	res, err := c.backend.Do(asset, c.MaxBodySize, 0, func(*http.Request, int, http.Header) bool {
+		return true
+	})
+	c.stats.response(request, res, time.Since(start))
+	if err != nil {
+		c.stats.error(request)
+	}
+}
+
+// pageAssets returns the URLs of the images, stylesheets and scripts of
+// a HTML document
+func pageAssets(body []byte) []string {
+	var assets []string
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return assets
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = strings.TrimSpace(string(v))
+			}
+			switch string(name) {
+			case "img", "script":
+				if attrs["src"] != "" {
+					assets = append(assets, attrs["src"])
+				}
+			case "link":
+				if hasRel(attrs["rel"], "stylesheet") && attrs["href"] != "" {
+					assets = append(assets, attrs["href"])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPacingProfile(t *testing.T) {
+	lock := sync.Mutex{}
+	referers := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		referers[r.URL.Path] = r.Header.Get("Referer")
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/", "/a":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel="stylesheet" href="/style.css"><script src="/app.js"></script>
+<img src="http://example.com/external.png"><p>page</p>`))
+		default:
+			w.Write([]byte("asset"))
+		}
+	}))
+	defer ts.Close()
+
+	p := &PacingProfile{ThinkTime: 100 * time.Millisecond, AssetProbability: 1, MaxAssets: 5}
+	c := NewCollector(UsePacingProfile(p), AllowURLRevisit())
+	start := time.Now()
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/a")
+	if d := time.Since(start); d < p.ThinkTime {
+		t.Errorf("Pages were requested without think time in %v", d)
+	}
+	expected := map[string]string{
+		"/":          "",
+		"/a":         ts.URL + "/",
+		"/style.css": ts.URL + "/a",
+		"/app.js":    ts.URL + "/a",
+	}
+	if !reflect.DeepEqual(referers, expected) {
+		t.Errorf("Unexpected referers: %v", referers)
+	}
+
+	// identities are paced independently
+	c = NewCollector(UsePacingProfile(&PacingProfile{ThinkTime: time.Hour}), AllowURLRevisit(), Async(true))
+	var paths []string
+	c.OnRequest(func(r *Request) {
+		r.Identity = r.URL.Path
+	})
+	c.OnResponse(func(r *Response) {
+		lock.Lock()
+		paths = append(paths, r.Request.URL.Path)
+		lock.Unlock()
+	})
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/a")
+	c.Wait()
+	sort.Strings(paths)
+	if !reflect.DeepEqual(paths, []string{"/", "/a"}) {
+		t.Errorf("Unexpected responses: %v", paths)
+	}
+}
+
+func TestThinkTime(t *testing.T) {
+	p := &PacingProfile{ThinkTime: time.Second, LongPauseProbability: 1, LongPause: time.Minute}
+	for i := 0; i < 100; i++ {
+		if d := p.thinkTime(); d < 31*time.Second || d > 91*time.Second {
+			t.Fatalf("Think time %v is out of range", d)
+		}
+	}
+	p = &PacingProfile{ThinkTime: time.Second, Jitter: 0.5}
+	longer := 0
+	for i := 0; i < 1000; i++ {
+		if p.thinkTime() > time.Second {
+			longer++
+		}
+	}
+	if longer < 400 || longer > 600 {
+		t.Errorf("Think time median is off: %d of 1000 are longer", longer)
+	}
+}
+
+func TestPacingProfileAssetChecks(t *testing.T) {
+	lock := sync.Mutex{}
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+			return
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel="stylesheet" href="/style.css"><script src="/private/app.js"></script>
+<img src="/filtered.png"><p>page</p>`))
+		default:
+			w.Write([]byte("asset"))
+		}
+		lock.Lock()
+		requested = append(requested, r.URL.Path)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	p := &PacingProfile{AssetProbability: 1, MaxAssets: 5}
+	c := NewCollector(UsePacingProfile(p), DisallowedURLFilters(regexp.MustCompile(`filtered`)))
+	c.IgnoreRobotsTxt = false
+	responses := 0
+	c.OnResponse(func(r *Response) {
+		responses++
+	})
+	c.Visit(ts.URL + "/")
+	sort.Strings(requested)
+	if !reflect.DeepEqual(requested, []string{"/", "/style.css"}) {
+		t.Errorf("Unexpected requests: %v", requested)
+	}
+	if st := c.Stats(); st.Requests != 2 || responses != 1 {
+		t.Errorf("Invalid stats of the assets: %d requests, %d responses", st.Requests, responses)
+	}
+	// the fetched assets are visited
+	if err := c.Visit(ts.URL + "/style.css"); err != ErrAlreadyVisited {
+		t.Errorf("Expected ErrAlreadyVisited, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import "sync"
+
+// parsePool limits the number of concurrently parsed response bodies.
+// It is shared by a Collector and its clones.
+type parsePool struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+func newParsePool() *parsePool {
+	p := &parsePool{}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// acquire blocks until less than limit parses are running. The number
+// of parses is not limited if limit is not positive.
+func (p *parsePool) acquire(limit int) {
+	p.lock.Lock()
+	for limit > 0 && p.running >= limit {
+		p.cond.Wait()
+	}
+	p.running++
+	p.lock.Unlock()
+}
+
+func (p *parsePool) release() {
+	p.lock.Lock()
+	p.running--
+	p.lock.Unlock()
+	// waiters may have different limits
+	p.cond.Broadcast()
+}
+
+// MaxParseConcurrency limits the number of response bodies parsed at
+// the same time for the OnHTML and OnXML callbacks
+func MaxParseConcurrency(n int) CollectorOption {
+	return func(c *Collector) {
+		c.MaxParseConcurrency = n
+	}
+}
+
+// parse runs the parsing function f in a slot of the parse pool
+func (c *Collector) parse(f func() error) error {
+	if c.parsePool == nil {
+		return f()
+	}
+	c.parsePool.acquire(c.MaxParseConcurrency)
+	defer c.parsePool.release()
+	return f()
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePool(t *testing.T) {
+	p := newParsePool()
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.acquire(2)
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			p.release()
+		}()
+	}
+	wg.Wait()
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 concurrent parses, got %d", maxRunning)
+	}
+}
+
+func TestMaxParseConcurrency(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	// nested synchronous visits from callbacks must not deadlock
+	c := NewCollector(MaxParseConcurrency(1), AllowURLRevisit())
+	visits := 0
+	c.OnHTML("p", func(e *HTMLElement) {
+		if visits < 3 {
+			visits++
+			e.Request.Visit("/html")
+		}
+	})
+	c.OnXML("//p", func(e *XMLElement) {})
+	if err := c.Visit(ts.URL + "/html"); err != nil {
+		t.Fatal(err)
+	}
+	if visits != 3 {
+		t.Errorf("Expected 3 nested visits, got %d", visits)
+	}
+	if c.parsePool.running != 0 {
+		t.Error("Parse slots were not released")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+// Plugin is a stateful extension of a Collector registered by
+// Collector.Use. Init is called once when the plugin is registered,
+// OnRequest and OnResponse are called like the callbacks registered by
+// the Collector's OnRequest and OnResponse, and Close is called by
+// Collector.Close.
+//
+// Embed BasePlugin to implement only some of the methods.
+type Plugin interface {
+	Init(c *Collector) error
+	OnRequest(r *Request)
+	OnResponse(r *Response)
+	Close() error
+}
+
+// BasePlugin implements every method of Plugin without doing anything
+type BasePlugin struct{}
+
+// Init does nothing
+func (BasePlugin) Init(*Collector) error { return nil }
+
+// OnRequest does nothing
+func (BasePlugin) OnRequest(*Request) {}
+
+// OnResponse does nothing
+func (BasePlugin) OnResponse(*Response) {}
+
+// Close does nothing
+func (BasePlugin) Close() error { return nil }
+
+// PluginFunc is an adapter to use a function configuring a Collector,
+// e.g. extensions.RandomUserAgent, as a Plugin. The function is called
+// by Init.
+type PluginFunc func(c *Collector)
+
+// Init calls f(c)
+func (f PluginFunc) Init(c *Collector) error {
+	f(c)
+	return nil
+}
+
+// OnRequest does nothing
+func (PluginFunc) OnRequest(*Request) {}
+
+// OnResponse does nothing
+func (PluginFunc) OnResponse(*Response) {}
+
+// Close does nothing
+func (PluginFunc) Close() error { return nil }
+
+// Use registers plugins in the Collector. The plugins are initialized
+// in the order of the arguments and their callbacks are called after
+// the callbacks registered before them. If the Init of a plugin returns
+// an error, the remaining plugins are not registered.
+func (c *Collector) Use(plugins ...Plugin) error {
+	for _, p := range plugins {
+		if err := p.Init(c); err != nil {
+			return err
+		}
+		c.OnRequest(p.OnRequest)
+		c.OnResponse(p.OnResponse)
+		c.lock.Lock()
+		c.plugins = append(c.plugins, p)
+		c.lock.Unlock()
+	}
+	return nil
+}
+
+// Plugins returns the plugins registered by Use
+func (c *Collector) Plugins() []Plugin {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]Plugin(nil), c.plugins...)
+}
+
+// Close closes the plugins of the Collector in the reverse order of
+// their registration. It returns the first error returned by the
+// plugins. Close should be called after Wait.
+func (c *Collector) Close() error {
+	c.lock.Lock()
+	plugins := c.plugins
+	c.plugins = nil
+	c.lock.Unlock()
+	var err error
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if e := plugins[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type countingPlugin struct {
+	BasePlugin
+	name      string
+	log       *[]string
+	requests  int
+	responses int
+	initErr   error
+}
+
+func (p *countingPlugin) Init(c *Collector) error {
+	*p.log = append(*p.log, "init "+p.name)
+	return p.initErr
+}
+
+func (p *countingPlugin) OnRequest(r *Request) {
+	p.requests++
+}
+
+func (p *countingPlugin) OnResponse(r *Response) {
+	p.responses++
+}
+
+func (p *countingPlugin) Close() error {
+	*p.log = append(*p.log, "close "+p.name)
+	return nil
+}
+
+func TestPlugins(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	var log []string
+	a := &countingPlugin{name: "a", log: &log}
+	b := &countingPlugin{name: "b", log: &log}
+	c := NewCollector()
+	if err := c.Use(a, b, PluginFunc(func(c *Collector) {
+		c.UserAgent = "plugin"
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Plugins()) != 3 || c.UserAgent != "plugin" {
+		t.Error("Plugins were not registered")
+	}
+	c.Visit(ts.URL)
+	c.Visit(ts.URL + "/html")
+	if a.requests != 2 || a.responses != 2 || b.requests != 2 || b.responses != 2 {
+		t.Errorf("Unexpected plugin callback counts: %d %d %d %d", a.requests, a.responses, b.requests, b.responses)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"init a", "init b", "close b", "close a"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("Unexpected lifecycle: %v", log)
+	}
+	if len(c.Plugins()) != 0 {
+		t.Error("Plugins were not removed by Close")
+	}
+}
+
+func TestPluginInitError(t *testing.T) {
+	var log []string
+	initErr := errors.New("init failed")
+	a := &countingPlugin{name: "a", log: &log, initErr: initErr}
+	b := &countingPlugin{name: "b", log: &log}
+	c := NewCollector()
+	if err := c.Use(a, b); err != initErr {
+		t.Errorf("Expected init error, got %v", err)
+	}
+	if len(c.Plugins()) != 0 || len(log) != 1 {
+		t.Errorf("Failed plugins were registered: %v", log)
+	}
+}
@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// inflightRequest is a request taken from the storage which has not
+// been completed yet
+type inflightRequest struct {
+	data    []byte
+	started bool
+}
+
+// start marks the request as started. It returns false if the request
+// has been handed off.
+func (q *Queue) start(req *colly.Request) bool {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	r, ok := q.inflight[req]
+	if ok {
+		r.started = true
+	}
+	return ok
+}
+
+func (q *Queue) finish(req *colly.Request) {
+	q.mut.Lock()
+	delete(q.inflight, req)
+	q.mut.Unlock()
+	select {
+	case q.finished <- struct{}{}:
+	default:
+	}
+}
+
+// Handoff stops the queue and passes its state to a replacement worker,
+// e.g. when a pod is terminated during a rolling deploy:
+//
+//	signal.Notify(sigc, syscall.SIGTERM)
+//	<-sigc
+//	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+//	defer cancel()
+//	q.Handoff(ctx, sharedStorage)
+//
+// The requests taken from the storage but not started yet are handed
+// off immediately. The running requests are waited for until ctx is
+// done, then the unfinished ones are handed off as well; cancel the
+// Context of the Collector afterwards to abort them, otherwise their
+// callbacks may still run.
+//
+// The handed off requests and the requests left in the local storage
+// are moved to dst. If dst is nil or it is the storage of the queue
+// (e.g. a shared Redis queue), the handed off requests are put back to
+// the storage of the queue. The replacement worker adopts them with
+// Adopt or by consuming the shared storage. Handoff returns the number
+// of the handed off requests.
+func (q *Queue) Handoff(ctx context.Context, dst Storage) (int, error) {
+	q.Stop()
+	// the loop can take requests from the storage until it exits
+	q.mut.Lock()
+	loopDone := q.loopDone
+	q.mut.Unlock()
+	if loopDone != nil {
+		select {
+		case <-loopDone:
+		case <-ctx.Done():
+		}
+	}
+	if dst == nil {
+		dst = q.storage
+	}
+	var pending [][]byte
+	for {
+		q.mut.Lock()
+		for req, r := range q.inflight {
+			if !r.started || ctx.Err() != nil {
+				pending = append(pending, r.data)
+				delete(q.inflight, req)
+			}
+		}
+		n := len(q.inflight)
+		q.mut.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-q.finished:
+		case <-ctx.Done():
+		}
+	}
+	for i, data := range pending {
+		if err := dst.AddRequest(data); err != nil {
+			return i, err
+		}
+	}
+	handed := len(pending)
+	if dst == q.storage {
+		return handed, nil
+	}
+	n, err := move(q.storage, dst)
+	return handed + n, err
+}
+
+// Adopt moves the requests handed off by another worker from src to the
+// storage of the queue and returns their number
+func (q *Queue) Adopt(src Storage) (int, error) {
+	n, err := move(src, q.storage)
+	if err != nil {
+		return n, err
+	}
+	q.mut.Lock()
+	wake, quit := q.wake, q.quit
+	q.mut.Unlock()
+	if wake != nil && n > 0 {
+		select {
+		case wake <- struct{}{}:
+		case <-quit:
+		}
+	}
+	return n, nil
+}
+
+// move transfers every request of src to dst
+func move(src, dst Storage) (int, error) {
+	n := 0
+	for {
+		size, err := src.QueueSize()
+		if err != nil || size == 0 {
+			return n, err
+		}
+		data, err := src.GetRequest()
+		if err != nil {
+			return n, err
+		}
+		if data == nil {
+			return n, nil
+		}
+		if err := dst.AddRequest(data); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestHandoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serverHandler))
+	defer server.Close()
+
+	q, err := New(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		q.AddURL(server.URL + "/delay?t=200ms&i=" + strconv.Itoa(i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := colly.NewCollector(colly.StdlibContext(ctx))
+	started := make(chan struct{}, 5)
+	c.OnRequest(func(*colly.Request) {
+		started <- struct{}{}
+	})
+	c.OnResponse(func(r *colly.Response) {
+		t.Errorf("Handed off request %s was completed", r.Request.URL)
+	})
+	done := make(chan error)
+	go func() {
+		done <- q.Run(c)
+	}()
+	<-started
+
+	handoff := &InMemoryQueueStorage{}
+	handoff.Init()
+	hctx, hcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer hcancel()
+	n, err := q.Handoff(hctx, handoff)
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Invalid number of handed off requests %d", n)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	replacement, err := New(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := replacement.Adopt(handoff); err != nil || n != 5 {
+		t.Fatalf("Invalid number of adopted requests %d: %v", n, err)
+	}
+	var visited []string
+	lock := sync.Mutex{}
+	c2 := colly.NewCollector()
+	c2.OnResponse(func(r *colly.Response) {
+		lock.Lock()
+		visited = append(visited, r.Request.URL.Query().Get("i"))
+		lock.Unlock()
+	})
+	if err := replacement.Run(c2); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(visited)
+	if len(visited) != 5 || visited[0] != "0" || visited[4] != "4" {
+		t.Errorf("Invalid adopted requests %v", visited)
+	}
+}
+
+func TestHandoffLosesNoRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serverHandler))
+	defer server.Close()
+
+	for round := 0; round < 10; round++ {
+		q, err := New(4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 50; i++ {
+			q.AddURL(server.URL + "/delay?t=1ms&i=" + strconv.Itoa(i))
+		}
+		var lock sync.Mutex
+		completed := 0
+		c := colly.NewCollector()
+		c.OnResponse(func(r *colly.Response) {
+			lock.Lock()
+			completed++
+			lock.Unlock()
+		})
+		done := make(chan error)
+		go func() {
+			done <- q.Run(c)
+		}()
+		time.Sleep(time.Duration(round) * time.Millisecond)
+
+		handoff := &InMemoryQueueStorage{}
+		handoff.Init()
+		n, err := q.Handoff(context.Background(), handoff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		lock.Lock()
+		if completed+n != 50 {
+			t.Errorf("%d requests were completed and %d were handed off of 50", completed, n)
+		}
+		lock.Unlock()
+	}
+}
@@ -27,11 +27,15 @@ type Storage interface {
 // requests in multiple threads
 type Queue struct {
 	// Threads defines the number of consumer threads
-	Threads int
-	storage Storage
-	wake    chan struct{}
-	mut     sync.Mutex // guards wake and running
-	running bool
+	Threads  int
+	storage  Storage
+	wake     chan struct{}
+	mut      sync.Mutex // guards wake, running, quit, loopDone and inflight
+	running  bool
+	quit     chan struct{} // closed by Stop to terminate the loop of Run
+	loopDone chan struct{} // closed when the loop of Run exits
+	inflight map[*colly.Request]*inflightRequest
+	finished chan struct{}
 }
 
 // InMemoryQueueStorage is the default implementation of the Storage interface.
@@ -61,9 +65,11 @@ func New(threads int, s Storage) (*Queue, error) {
 		return nil, err
 	}
 	return &Queue{
-		Threads: threads,
-		storage: s,
-		running: true,
+		Threads:  threads,
+		storage:  s,
+		running:  true,
+		inflight: make(map[*colly.Request]*inflightRequest),
+		finished: make(chan struct{}, 1),
 	}, nil
 }
 
@@ -93,16 +99,19 @@ func (q *Queue) AddURL(URL string) error {
 // AddRequest adds a new Request to the queue
 func (q *Queue) AddRequest(r *colly.Request) error {
 	q.mut.Lock()
-	waken := q.wake != nil
+	wake, quit := q.wake, q.quit
 	q.mut.Unlock()
-	if !waken {
+	if wake == nil {
 		return q.storeRequest(r)
 	}
 	err := q.storeRequest(r)
 	if err != nil {
 		return err
 	}
-	q.wake <- struct{}{}
+	select {
+	case wake <- struct{}{}:
+	case <-quit:
+	}
 	return nil
 }
 
@@ -130,14 +139,21 @@ func (q *Queue) Run(c *colly.Collector) error {
 	}
 	q.wake = make(chan struct{})
 	q.running = true
+	q.quit = make(chan struct{})
+	q.loopDone = make(chan struct{})
+	wake, quit, loopDone := q.wake, q.quit, q.loopDone
 	q.mut.Unlock()
 
 	requestc := make(chan *colly.Request)
-	complete, errc := make(chan struct{}), make(chan error, 1)
+	// the runners finish their requests after the loop is stopped
+	complete, errc := make(chan struct{}, q.Threads), make(chan error, 1)
 	for i := 0; i < q.Threads; i++ {
-		go independentRunner(requestc, complete)
+		go q.runner(requestc, complete)
 	}
-	go q.loop(c, requestc, complete, errc)
+	go func() {
+		q.loop(c, requestc, complete, errc, wake, quit)
+		close(loopDone)
+	}()
 	defer close(requestc)
 	return <-errc
 }
@@ -146,18 +162,31 @@ func (q *Queue) Run(c *colly.Collector) error {
 func (q *Queue) Stop() {
 	q.mut.Lock()
 	q.running = false
+	if q.quit != nil {
+		select {
+		case <-q.quit:
+		default:
+			close(q.quit)
+		}
+	}
 	q.mut.Unlock()
 }
 
-func (q *Queue) loop(c *colly.Collector, requestc chan<- *colly.Request, complete <-chan struct{}, errc chan<- error) {
+func (q *Queue) loop(c *colly.Collector, requestc chan<- *colly.Request, complete <-chan struct{}, errc chan<- error, wake, quit <-chan struct{}) {
 	var active int
 	for {
+		select {
+		case <-quit:
+			errc <- nil
+			return
+		default:
+		}
 		size, err := q.storage.QueueSize()
 		if err != nil {
 			errc <- err
 			break
 		}
-		if size == 0 && active == 0 || !q.running {
+		if size == 0 && active == 0 {
 			// Terminate when
 			//   1. No active requests
 			//   2. Emtpy queue
@@ -182,7 +211,11 @@ func (q *Queue) loop(c *colly.Collector, requestc chan<- *colly.Request, complet
 			case sent <- req:
 				active++
 				break Sent
-			case <-q.wake:
+			case <-quit:
+				// the loaded request is handed off by Handoff
+				errc <- nil
+				return
+			case <-wake:
 				if sent == nil {
 					break Sent
 				}
@@ -196,9 +229,13 @@ func (q *Queue) loop(c *colly.Collector, requestc chan<- *colly.Request, complet
 	}
 }
 
-func independentRunner(requestc <-chan *colly.Request, complete chan<- struct{}) {
+func (q *Queue) runner(requestc <-chan *colly.Request, complete chan<- struct{}) {
 	for req := range requestc {
-		req.Do()
+		// requests handed off to another worker are skipped
+		if q.start(req) {
+			req.Do()
+			q.finish(req)
+		}
 		complete <- struct{}{}
 	}
 }
@@ -210,7 +247,14 @@ func (q *Queue) loadRequest(c *colly.Collector) (*colly.Request, error) {
 	}
 	copied := make([]byte, len(buf))
 	copy(copied, buf)
-	return c.UnmarshalRequest(copied)
+	req, err := c.UnmarshalRequest(copied)
+	if err != nil {
+		return nil, err
+	}
+	q.mut.Lock()
+	q.inflight[req] = &inflightRequest{data: copied}
+	q.mut.Unlock()
+	return req, nil
 }
 
 // Init implements Storage.Init() function
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -27,8 +28,15 @@ func TestQueue(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	// rng is used by the callbacks of concurrent requests too
+	var rngLock sync.Mutex
+	intn := func(n int) int {
+		rngLock.Lock()
+		defer rngLock.Unlock()
+		return rng.Intn(n)
+	}
 	put := func() {
-		t := time.Duration(rng.Intn(50)) * time.Microsecond
+		t := time.Duration(intn(50)) * time.Microsecond
 		url := server.URL + "/delay?t=" + t.String()
 		atomic.AddUint32(&items, 1)
 		q.AddURL(url)
@@ -49,7 +57,7 @@ func TestQueue(t *testing.T) {
 		} else {
 			atomic.AddUint32(&failure, 1)
 		}
-		toss := rng.Intn(2) == 0
+		toss := intn(2) == 0
 		if toss {
 			put()
 		}
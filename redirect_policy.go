@@ -0,0 +1,85 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy restricts the targets of the followed redirects. It
+// protects services fetching user submitted URLs from being redirected
+// to unexpected sites. Use SSRFGuard to block internal addresses.
+type RedirectPolicy struct {
+	// SameSite allows only redirects to the registrable domain
+	// (e.g. "example.co.uk") of the originally requested URL
+	SameSite bool
+	// NoDowngrade forbids redirects from HTTPS to HTTP URLs
+	NoDowngrade bool
+	// AllowedDomains are the domains which can be redirected to even if
+	// SameSite forbids them. Subdomains are matched by a leading "*.",
+	// e.g. "*.example.com".
+	AllowedDomains []string
+	// MaxRedirects is the maximum number of followed redirects of a
+	// request. 10 redirects are followed if it is 0.
+	MaxRedirects int
+}
+
+// UseRedirectPolicy restricts the targets of the redirects followed by
+// the Collector
+func UseRedirectPolicy(p *RedirectPolicy) CollectorOption {
+	return func(c *Collector) {
+		c.RedirectPolicy = p
+	}
+}
+
+// Check returns ErrRedirectForbidden if the policy forbids the redirect
+// to req. via contains the already sent requests, the oldest first.
+func (p *RedirectPolicy) Check(req *http.Request, via []*http.Request) error {
+	if len(via) == 0 {
+		return nil
+	}
+	max := p.MaxRedirects
+	if max <= 0 {
+		max = 10
+	}
+	if len(via) > max {
+		return ErrRedirectForbidden
+	}
+	if p.NoDowngrade && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return ErrRedirectForbidden
+	}
+	if !p.SameSite || p.allowedDomain(req.URL.Hostname()) {
+		return nil
+	}
+	if cookieSite(req.URL.Hostname()) != cookieSite(via[0].URL.Hostname()) {
+		return ErrRedirectForbidden
+	}
+	return nil
+}
+
+func (p *RedirectPolicy) allowedDomain(host string) bool {
+	for _, k := range domainKeys(host) {
+		if k == "" {
+			continue
+		}
+		for _, d := range p.AllowedDomains {
+			if strings.EqualFold(d, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
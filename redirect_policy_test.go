@@ -0,0 +1,92 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirectPolicyCheck(t *testing.T) {
+	p := &RedirectPolicy{
+		SameSite:       true,
+		NoDowngrade:    true,
+		AllowedDomains: []string{"*.cdn.net"},
+		MaxRedirects:   2,
+	}
+	newReq := func(u string) *http.Request {
+		req, _ := http.NewRequest("GET", u, nil)
+		return req
+	}
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"https://example.co.uk/", "https://www.example.co.uk/a", true},
+		{"https://example.co.uk/", "https://other.co.uk/", false},
+		{"https://example.co.uk/", "http://example.co.uk/", false},
+		{"http://example.co.uk/", "https://example.co.uk/", true},
+		{"https://example.co.uk/", "https://img.cdn.net/", true},
+		{"https://example.co.uk/", "https://cdn.net/", false},
+	}
+	for _, tt := range tests {
+		err := p.Check(newReq(tt.to), []*http.Request{newReq(tt.from)})
+		if (err == nil) != tt.allowed {
+			t.Errorf("Redirect from %s to %s: %v", tt.from, tt.to, err)
+		}
+	}
+	via := []*http.Request{newReq("https://example.com/"), newReq("https://example.com/1"), newReq("https://example.com/2")}
+	if err := p.Check(newReq("https://example.com/3"), via); err != ErrRedirectForbidden {
+		t.Error("MaxRedirects was not enforced")
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/external":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		case "/internal":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCollector(UseRedirectPolicy(&RedirectPolicy{SameSite: true}))
+	var visitErr error
+	c.OnError(func(r *Response, err error) {
+		visitErr = err
+	})
+	var visited []string
+	c.OnResponse(func(r *Response) {
+		visited = append(visited, r.Request.URL.Path)
+	})
+	c.Visit(ts.URL + "/external")
+	if visitErr == nil || !strings.Contains(visitErr.Error(), ErrRedirectForbidden.Error()) {
+		t.Errorf("Expected forbidden redirect, got %v", visitErr)
+	}
+	visitErr = nil
+	c.Visit(ts.URL + "/internal")
+	if visitErr != nil {
+		t.Fatal(visitErr)
+	}
+	if len(visited) != 1 || visited[0] != "/target" {
+		t.Errorf("Unexpected visited pages: %v", visited)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote delegates the downloads of a Collector to a remote
+// fetch service, e.g. a rendering or proxy farm, while parsing,
+// deduplication and callbacks stay local:
+//
+//	c := colly.NewCollector()
+//	c.SetFetcher(remote.New("http://fetcher.internal:8080/fetch"))
+//
+// The Fetcher sends every request as a JSON encoded FetchRequest in the
+// body of a POST request to the endpoint of the service, which answers
+// with a JSON encoded FetchResponse. Handler implements the service side
+// of the protocol with net/http.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// FetchRequest is a request sent to the fetch service
+type FetchRequest struct {
+	URL     string      `json:"url"`
+	Method  string      `json:"method"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+	// Options are service specific settings, e.g. {"render": true}
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// FetchResponse is the answer of the fetch service
+type FetchResponse struct {
+	// URL is the final URL of the request after redirects
+	URL        string      `json:"url,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	// Body is the decoded response body
+	Body []byte `json:"body,omitempty"`
+	// Error is the reason of the failed downloads
+	Error string `json:"error,omitempty"`
+}
+
+// Error is returned by the Fetcher if the fetch service fails or if the
+// download of the service fails
+type Error struct {
+	// StatusCode is the status code of the fetch service's response.
+	// It is 0 if the download of the service failed.
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("Fetch service error %d: %s", e.StatusCode, e.Message)
+	}
+	return "Remote fetch failed: " + e.Message
+}
+
+// Fetcher is a colly.Fetcher downloading through a remote fetch service
+type Fetcher struct {
+	// Endpoint is the URL of the fetch service
+	Endpoint string
+	// Client sends the requests to the fetch service.
+	// http.DefaultClient is used if it is nil.
+	Client *http.Client
+	// Headers are added to the requests of the fetch service,
+	// e.g. its API key
+	Headers http.Header
+	// Options are sent with every request to the fetch service
+	Options map[string]interface{}
+}
+
+// New creates a Fetcher of the fetch service of the endpoint
+func New(endpoint string) *Fetcher {
+	return &Fetcher{Endpoint: endpoint}
+}
+
+// Do implements colly.Fetcher
+func (f *Fetcher) Do(ctx context.Context, r *colly.Request) (*colly.Response, error) {
+	fr := &FetchRequest{
+		URL:     r.URL.String(),
+		Method:  r.Method,
+		Options: f.Options,
+	}
+	if r.Headers != nil {
+		fr.Headers = *r.Headers
+	}
+	if r.Body != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		fr.Body = body
+	}
+	data, err := json.Marshal(fr)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", f.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range f.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, &Error{StatusCode: res.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	resp := &FetchResponse{}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, &Error{Message: resp.Error}
+	}
+	if resp.URL != "" && resp.URL != fr.URL {
+		u, err := url.Parse(resp.URL)
+		if err != nil {
+			return nil, err
+		}
+		r.URL = u
+	}
+	if resp.Headers == nil {
+		resp.Headers = http.Header{}
+	}
+	return &colly.Response{
+		StatusCode: resp.StatusCode,
+		Body:       resp.Body,
+		Headers:    &resp.Headers,
+	}, nil
+}
+
+// Handler is a fetch service downloading the requests of Fetchers
+type Handler struct {
+	// Client downloads the requests. http.DefaultClient is used if it
+	// is nil.
+	Client *http.Client
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fr := &FetchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(fr); err != nil {
+		http.Error(w, "Invalid fetch request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.fetch(r.Context(), fr))
+}
+
+func (h *Handler) fetch(ctx context.Context, fr *FetchRequest) *FetchResponse {
+	method := fr.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequest(method, fr.URL, bytes.NewReader(fr.Body))
+	if err != nil {
+		return &FetchResponse{Error: err.Error()}
+	}
+	req = req.WithContext(ctx)
+	for k, v := range fr.Headers {
+		req.Header[k] = v
+	}
+	// the body is decoded by the transport
+	req.Header.Del("Accept-Encoding")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return &FetchResponse{Error: err.Error()}
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return &FetchResponse{Error: err.Error()}
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	return &FetchResponse{
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Headers:    res.Header,
+		Body:       body,
+	}
+}
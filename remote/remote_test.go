@@ -0,0 +1,124 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newOrigin() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><title>` + r.Header.Get("X-Test") + `</title></html>`))
+	})
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	return httptest.NewServer(mux)
+}
+
+// newService starts a fetch service recording the options of the
+// requests and checking the API key
+func newService(options *map[string]interface{}) *httptest.Server {
+	h := &Handler{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fr := &FetchRequest{}
+		json.Unmarshal(body, fr)
+		*options = fr.Options
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.ServeHTTP(w, r)
+	}))
+}
+
+func TestFetcher(t *testing.T) {
+	origin := newOrigin()
+	defer origin.Close()
+	var options map[string]interface{}
+	svc := newService(&options)
+	defer svc.Close()
+
+	f := New(svc.URL)
+	f.Headers = http.Header{"X-Api-Key": []string{"secret"}}
+	f.Options = map[string]interface{}{"render": true}
+	c := colly.NewCollector()
+	c.SetFetcher(f)
+	c.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("X-Test", "remote")
+	})
+	var title, finalURL string
+	c.OnHTML("title", func(e *colly.HTMLElement) {
+		title = e.Text
+		finalURL = e.Request.URL.String()
+	})
+	if err := c.Visit(origin.URL + "/old"); err != nil {
+		t.Fatal(err)
+	}
+	if title != "remote" {
+		t.Errorf("Invalid title %q", title)
+	}
+	if finalURL != origin.URL+"/page" {
+		t.Errorf("Invalid final URL %q", finalURL)
+	}
+	if options["render"] != true {
+		t.Errorf("Options were not sent: %v", options)
+	}
+
+	var body string
+	c.OnResponse(func(r *colly.Response) {
+		body = string(r.Body)
+	})
+	c.PostRaw(origin.URL+"/post", []byte("payload"))
+	if body != "payload" {
+		t.Errorf("Invalid POST response %q", body)
+	}
+}
+
+func TestFetcherErrors(t *testing.T) {
+	var options map[string]interface{}
+	svc := newService(&options)
+	defer svc.Close()
+
+	c := colly.NewCollector()
+	c.SetFetcher(New(svc.URL))
+	err := c.Visit("http://127.0.0.1:1/")
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected service error, got %v", err)
+	}
+
+	f := New(svc.URL)
+	f.Headers = http.Header{"X-Api-Key": []string{"secret"}}
+	c.SetFetcher(f)
+	err = c.Visit("http://127.0.0.1:1/x")
+	if e, ok := err.(*Error); !ok || e.StatusCode != 0 {
+		t.Errorf("Expected download error, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay serves the responses of recorded WARC and HAR archives
+// instead of the network, so the extraction logic of a scraper can be
+// run again on an archived crawl without fetching the pages:
+//
+//	t := replay.New()
+//	if err := t.Load("crawl.warc.gz", "session.har"); err != nil {
+//		log.Fatal(err)
+//	}
+//	c := colly.NewCollector()
+//	c.WithTransport(t)
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2/har"
+	"github.com/gocolly/colly/v2/warc"
+)
+
+// ErrNotArchived is returned for the requests missing from the archives
+// if the Transport has no Fallback
+var ErrNotArchived = errors.New("Request is not archived")
+
+// archivedResponse is a response of an archive
+type archivedResponse struct {
+	statusCode int
+	proto      string
+	headers    http.Header
+	body       []byte
+}
+
+// Transport is a http.RoundTripper serving archived responses. The
+// responses are matched by the method and the URL of the requests. If a
+// URL was archived more than once, its responses are served in the order
+// of the archives and the last one is repeated.
+type Transport struct {
+	// Fallback handles the requests missing from the archives. They
+	// fail with ErrNotArchived if it is nil.
+	Fallback  http.RoundTripper
+	responses map[string][]*archivedResponse
+	served    map[string]int
+	lock      sync.Mutex
+}
+
+// New creates an empty Transport
+func New() *Transport {
+	return &Transport{
+		responses: make(map[string][]*archivedResponse),
+		served:    make(map[string]int),
+	}
+}
+
+func key(method, u string) string {
+	return strings.ToUpper(method) + " " + u
+}
+
+func (t *Transport) add(method, u string, r *archivedResponse) {
+	t.lock.Lock()
+	k := key(method, u)
+	t.responses[k] = append(t.responses[k], r)
+	t.lock.Unlock()
+}
+
+// Load adds the archives of the files. Files with ".har" extension are
+// read as HAR archives, other files as WARC files.
+func (t *Transport) Load(fileNames ...string) error {
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(strings.ToLower(fileName), ".har") {
+			h, err := har.Load(fileName)
+			if err != nil {
+				return err
+			}
+			t.AddHAR(h)
+			continue
+		}
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		err = t.ReadWARC(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", fileName, err)
+		}
+	}
+	return nil
+}
+
+// ReadWARC adds the response records of a WARC file. The method of a
+// response is taken from its request record, GET is used if it has
+// none.
+func (t *Transport) ReadWARC(r io.Reader) error {
+	wr, err := warc.NewReader(r)
+	if err != nil {
+		return err
+	}
+	var responses []*warc.Record
+	methods := make(map[string]string)
+	for {
+		rec, err := wr.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(rec.ContentType, "application/http") {
+			continue
+		}
+		switch rec.Type {
+		case warc.TypeResponse:
+			responses = append(responses, rec)
+		case warc.TypeRequest:
+			if i := bytes.IndexByte(rec.Block, ' '); i > 0 && rec.ConcurrentTo != "" {
+				methods[rec.ConcurrentTo] = string(rec.Block[:i])
+			}
+		}
+	}
+	for _, rec := range responses {
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		// the body is dechunked by ReadResponse
+		res.Header.Del("Transfer-Encoding")
+		method := methods[rec.ID]
+		if method == "" {
+			method = "GET"
+		}
+		t.add(method, rec.TargetURI, &archivedResponse{
+			statusCode: res.StatusCode,
+			proto:      res.Proto,
+			headers:    res.Header,
+			body:       body,
+		})
+	}
+	return nil
+}
+
+// AddHAR adds the entries of a HAR archive. The entries without response
+// are skipped.
+func (t *Transport) AddHAR(h *har.HAR) {
+	for _, e := range h.Log.Entries {
+		if e.Request == nil || e.Response == nil || e.Response.Status == 0 {
+			continue
+		}
+		var body []byte
+		if c := e.Response.Content; c != nil {
+			body = []byte(c.Text)
+			if c.Encoding == "base64" {
+				if b, err := base64.StdEncoding.DecodeString(c.Text); err == nil {
+					body = b
+				}
+			}
+		}
+		headers := http.Header{}
+		for _, nv := range e.Response.Headers {
+			headers.Add(nv.Name, nv.Value)
+		}
+		// HAR contains decoded bodies
+		headers.Del("Content-Encoding")
+		headers.Del("Transfer-Encoding")
+		headers.Set("Content-Length", strconv.Itoa(len(body)))
+		t.add(e.Request.Method, e.Request.URL, &archivedResponse{
+			statusCode: e.Response.Status,
+			proto:      e.Response.HTTPVersion,
+			headers:    headers,
+			body:       body,
+		})
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	k := key(req.Method, req.URL.String())
+	t.lock.Lock()
+	responses := t.responses[k]
+	var r *archivedResponse
+	if len(responses) > 0 {
+		i := t.served[k]
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		r = responses[i]
+		t.served[k] = i + 1
+	}
+	t.lock.Unlock()
+	if r == nil {
+		if t.Fallback != nil {
+			return t.Fallback.RoundTrip(req)
+		}
+		return nil, ErrNotArchived
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	proto := r.proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	res := &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.statusCode, http.StatusText(r.statusCode)),
+		StatusCode:    r.statusCode,
+		Proto:         proto,
+		Header:        make(http.Header, len(r.headers)),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}
+	res.ProtoMajor, res.ProtoMinor, _ = http.ParseHTTPVersion(proto)
+	for k, v := range r.headers {
+		res.Header[k] = append([]string(nil), v...)
+	}
+	return res, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/har"
+	"github.com/gocolly/colly/v2/warc"
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<h1>Home</h1><a href="/page">page</a>`))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`<h1>Page</h1>`))
+		gz.Close()
+	})
+	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<h1>Posted</h1>`))
+	})
+	return httptest.NewServer(mux)
+}
+
+// crawl returns the headings of the site
+func crawl(c *colly.Collector, u string) []string {
+	var headings []string
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		headings = append(headings, e.Text)
+	})
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.Visit(u + "/")
+	c.Post(u+"/form", map[string]string{"a": "b"})
+	return headings
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colly-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := newTestServer()
+	c := colly.NewCollector()
+	w := warc.NewRecorder(c, dir)
+	w.Compress = true
+	h := har.NewRecorder(c)
+	expected := crawl(c, ts.URL)
+	ts.Close()
+	w.Close()
+	harFile := filepath.Join(dir, "crawl.har")
+	if err := h.Save(harFile); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, []string{"Home", "Page", "Posted"}) {
+		t.Fatalf("Unexpected live crawl: %v", expected)
+	}
+
+	for _, archive := range []string{w.Files()[0], harFile} {
+		tr := New()
+		if err := tr.Load(archive); err != nil {
+			t.Fatal(err)
+		}
+		c := colly.NewCollector()
+		c.WithTransport(tr)
+		if headings := crawl(c, ts.URL); !reflect.DeepEqual(headings, expected) {
+			t.Errorf("Unexpected headings replayed from %s: %v", filepath.Base(archive), headings)
+		}
+		if err := c.Visit(ts.URL + "/missing"); err == nil {
+			t.Error("Request missing from the archive succeeded")
+		}
+	}
+}
+
+func TestReadWARC(t *testing.T) {
+	// raw WARC records keep the compressed bodies of the responses
+	body := &bytes.Buffer{}
+	gz := gzip.NewWriter(body)
+	gz.Write([]byte(`<h1>Compressed</h1>`))
+	gz.Close()
+	block := append([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n\r\n"), chunked(body.Bytes())...)
+	buf := &bytes.Buffer{}
+	w := warc.NewWriter(buf)
+	w.WriteRecord(&warc.Record{Type: warc.TypeResponse, TargetURI: "http://example.com/", ContentType: "application/http; msgtype=response", Block: block})
+
+	tr := New()
+	if err := tr.ReadWARC(buf); err != nil {
+		t.Fatal(err)
+	}
+	c := colly.NewCollector()
+	c.WithTransport(tr)
+	var heading string
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		heading = e.Text
+	})
+	c.Visit("http://example.com/")
+	if heading != "Compressed" {
+		t.Errorf("Unexpected heading: %q", heading)
+	}
+}
+
+func chunked(b []byte) []byte {
+	buf := &bytes.Buffer{}
+	for len(b) > 0 {
+		n := len(b)
+		if n > 8 {
+			n = 8
+		}
+		fmt.Fprintf(buf, "%x\r\n", n)
+		buf.Write(b[:n])
+		buf.WriteString("\r\n")
+		b = b[n:]
+	}
+	buf.WriteString("0\r\n\r\n")
+	return buf.Bytes()
+}
@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // Request is the representation of a HTTP request made by a Collector
@@ -43,11 +44,34 @@ type Request struct {
 	// Leave it blank to allow automatic character encoding of the response body.
 	// It is empty by default and it can be set in OnRequest callback.
 	ResponseCharacterEncoding string
+	// HeaderProfile overrides the HeaderProfile of the Collector. It can
+	// be set in OnRequest callbacks.
+	HeaderProfile *HeaderProfile
+	// Tags attribute the request to logical parts of a crawl in the
+	// statistics of the Collector. They can be set in OnRequest
+	// callbacks. See Collector.Stats.
+	Tags []string
+	// Identity is the simulated visitor of the request paced by the
+	// PacingProfile of the Collector. The host of the URL is used if it
+	// is empty. It can be set in OnRequest callbacks.
+	Identity string
+	// Timeout overrides the request timeout of the Collector. It covers
+	// the whole request including the download of the body. It can be
+	// set in OnRequest callbacks.
+	Timeout time.Duration
+	// Capture requests screenshots or PDFs of the rendered page from
+	// the Fetcher of the request, e.g. a headless browser, which stores
+	// them in the Screenshot and PDF fields of the response. Fetchers
+	// without rendering and the built-in HTTP backend ignore it. It can
+	// be set in OnRequest callbacks.
+	Capture Capture
 	// ID is the Unique identifier of the request
-	ID        uint32
-	collector *Collector
-	abort     bool
-	baseURL   *url.URL
+	ID          uint32
+	collector   *Collector
+	abort       bool
+	noFollow    bool
+	baseURL     *url.URL
+	contentType string
 	// ProxyURL is the proxy address that handles the request
 	ProxyURL string
 }
@@ -84,6 +108,13 @@ func (r *Request) Abort() {
 	r.abort = true
 }
 
+// ForceContentType overrides the Content-Type header of the response.
+// Call it in OnRequest or OnResponseHeaders callbacks to process the
+// responses of misconfigured servers with OnHTML or OnXML callbacks.
+func (r *Request) ForceContentType(contentType string) {
+	r.contentType = contentType
+}
+
 // AbsoluteURL returns with the resolved absolute URL of an URL chunk.
 // AbsoluteURL returns empty string if the URL chunk is a fragment or
 // could not be parsed
@@ -112,6 +143,9 @@ func (r *Request) AbsoluteURL(u string) string {
 // request and preserves the Context of the previous request.
 // Visit also calls the previously provided callbacks
 func (r *Request) Visit(URL string) error {
+	if r.noFollow {
+		return ErrRobotsNoFollow
+	}
 	return r.collector.scrape(r.AbsoluteURL(URL), "GET", r.Depth+1, nil, r.Ctx, nil, true)
 }
 
@@ -145,15 +179,30 @@ func (r *Request) PostMultipart(URL string, requestData map[string][]byte) error
 	return r.collector.scrape(r.AbsoluteURL(URL), "POST", r.Depth+1, createMultipartReader(boundary, requestData), r.Ctx, hdr, true)
 }
 
+// PostFile starts a collector job by creating a multipart POST request
+// uploading the file of the path in the field, with the extra form
+// fields. The file is streamed from the disk. PostFile also calls the
+// previously provided callbacks.
+func (r *Request) PostFile(URL, field, path string, extraFields map[string]string) error {
+	body, contentType, err := newFileUpload(field, path, extraFields)
+	if err != nil {
+		return err
+	}
+	hdr := http.Header{}
+	hdr.Set("Content-Type", contentType)
+	hdr.Set("User-Agent", r.collector.UserAgent)
+	return r.collector.scrape(r.AbsoluteURL(URL), "POST", r.Depth+1, body, r.Ctx, hdr, false)
+}
+
 // Retry submits HTTP request again with the same parameters
 func (r *Request) Retry() error {
 	r.Headers.Del("Cookie")
-	return r.collector.scrape(r.URL.String(), r.Method, r.Depth, r.Body, r.Ctx, *r.Headers, false)
+	return r.collector.scrapeContext(withRequestTimeout(r.collector.Context, r.Timeout), r.URL.String(), r.Method, r.Depth, r.Body, r.Ctx, *r.Headers, false)
 }
 
 // Do submits the request
 func (r *Request) Do() error {
-	return r.collector.scrape(r.URL.String(), r.Method, r.Depth, r.Body, r.Ctx, *r.Headers, !r.collector.AllowURLRevisit)
+	return r.collector.scrapeContext(withRequestTimeout(r.collector.Context, r.Timeout), r.URL.String(), r.Method, r.Depth, r.Body, r.Ctx, *r.Headers, !r.collector.AllowURLRevisit)
 }
 
 // Marshal serializes the Request
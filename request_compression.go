@@ -0,0 +1,75 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// CompressRequestBody compresses the bodies of the requests by the
+// encoding, "gzip" or "deflate", and sets their Content-Encoding header.
+// Use it only for servers accepting compressed requests.
+func CompressRequestBody(encoding string) CollectorOption {
+	return func(c *Collector) {
+		c.RequestBodyEncoding = encoding
+	}
+}
+
+// compressRequestBody compresses the body of the request. Requests
+// without body and requests already having a Content-Encoding header
+// are not modified. The compressed body is kept in request.Body too, so
+// Fetchers send it with the Content-Encoding header.
+func compressRequestBody(req *http.Request, request *Request, encoding string) error {
+	encoding = strings.ToLower(encoding)
+	if encoding != "gzip" && encoding != "deflate" {
+		return ErrUnsupportedEncoding
+	}
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(buf)
+	} else {
+		w = zlib.NewWriter(buf)
+	}
+	w.Write(body)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	// redirects and retries of the transport resend the compressed body
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Header.Set("Content-Encoding", encoding)
+	req.Header.Del("Content-Length")
+	request.Body = bytes.NewReader(data)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newCompressedBodyServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			body, _ = gzip.NewReader(r.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(r.Body)
+		}
+		data, _ := ioutil.ReadAll(body)
+		w.Write([]byte(r.Header.Get("Content-Encoding") + ":" + string(data)))
+	}))
+}
+
+func TestCompressRequestBody(t *testing.T) {
+	ts := newCompressedBodyServer()
+	defer ts.Close()
+
+	payload := strings.Repeat(`{"key":"value"}`, 100)
+	for _, encoding := range []string{"gzip", "deflate"} {
+		c := NewCollector(CompressRequestBody(encoding), AllowURLRevisit())
+		var bodies []string
+		c.OnResponse(func(r *Response) {
+			bodies = append(bodies, string(r.Body))
+		})
+		c.PostRaw(ts.URL, []byte(payload))
+		// the body is sent again after the 307 redirect
+		c.PostRaw(ts.URL+"/redirect", []byte(payload))
+		c.Visit(ts.URL)
+		expected := []string{encoding + ":" + payload, encoding + ":" + payload, ":"}
+		if len(bodies) != 3 || bodies[0] != expected[0] || bodies[1] != expected[1] || bodies[2] != expected[2] {
+			t.Errorf("Unexpected %s responses: %q", encoding, bodies)
+		}
+	}
+}
+
+func TestCompressRequestBodyInvalidEncoding(t *testing.T) {
+	ts := newCompressedBodyServer()
+	defer ts.Close()
+
+	c := NewCollector(CompressRequestBody("lzma"))
+	if err := c.PostRaw(ts.URL, []byte("data")); err != ErrUnsupportedEncoding {
+		t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+	}
+}
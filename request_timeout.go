@@ -0,0 +1,73 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+type requestTimeoutKey struct{}
+
+// withRequestTimeout returns a context carrying the timeout of a request.
+// Non-positive timeouts return ctx.
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+func requestTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// VisitWithTimeout is like Visit but the request has its own timeout
+// instead of the timeout of the Collector, e.g. to download big exports
+// of slow endpoints
+func (c *Collector) VisitWithTimeout(URL string, timeout time.Duration) error {
+	ctx := withRequestTimeout(c.Context, timeout)
+	if c.CheckHead {
+		if check := c.scrapeContext(ctx, URL, "HEAD", 1, nil, nil, nil, true); check != nil {
+			return check
+		}
+	}
+	return c.scrapeContext(ctx, URL, "GET", 1, nil, nil, nil, true)
+}
+
+// RequestWithTimeout is like Request but the request has its own timeout
+// instead of the timeout of the Collector
+func (c *Collector) RequestWithTimeout(method, URL string, requestData io.Reader, ctx *Context, hdr http.Header, timeout time.Duration) error {
+	return c.scrapeContext(withRequestTimeout(c.Context, timeout), URL, method, 1, requestData, ctx, hdr, true)
+}
+
+// withTimeout returns the request with a context which is canceled
+// after the timeout of the request or of the client. The deadline
+// covers the redirects and the download of the body, like the timeout
+// of http.Client does.
+func (h *httpBackend) withTimeout(req *http.Request) (*http.Request, context.CancelFunc) {
+	timeout, ok := requestTimeoutFromContext(req.Context())
+	if !ok {
+		timeout = h.Client.Timeout
+	}
+	if timeout <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSlowServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the headers are sent immediately, the body slowly
+		w.Write([]byte("start "))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("end"))
+	}))
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := newSlowServer()
+	defer ts.Close()
+
+	c := NewCollector(AllowURLRevisit())
+	c.SetRequestTimeout(50 * time.Millisecond)
+	var bodies []string
+	c.OnResponse(func(r *Response) {
+		bodies = append(bodies, string(r.Body))
+	})
+	if err := c.Visit(ts.URL + "/"); err == nil {
+		t.Error("Slow download did not time out")
+	}
+	if err := c.VisitWithTimeout(ts.URL+"/", time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := c.RequestWithTimeout("GET", ts.URL+"/", nil, nil, nil, time.Second); err != nil {
+		t.Error(err)
+	}
+	if len(bodies) != 2 || bodies[0] != "start end" {
+		t.Errorf("Unexpected bodies: %q", bodies)
+	}
+
+	c = NewCollector()
+	c.OnRequest(func(r *Request) {
+		if strings.HasSuffix(r.URL.Path, "/export") {
+			r.Timeout = time.Second
+		}
+	})
+	c.SetRequestTimeout(50 * time.Millisecond)
+	if err := c.Visit(ts.URL + "/export"); err != nil {
+		t.Errorf("Request timeout was not applied: %v", err)
+	}
+	if err := c.Visit(ts.URL + "/other"); err == nil {
+		t.Error("Collector timeout was not applied")
+	}
+}
+
+func TestRequestTimeoutRetry(t *testing.T) {
+	ts := newSlowServer()
+	defer ts.Close()
+
+	c := NewCollector()
+	c.SetRequestTimeout(50 * time.Millisecond)
+	retried := false
+	var body string
+	c.OnError(func(r *Response, err error) {
+		if !retried {
+			retried = true
+			r.Request.Timeout = time.Second
+			r.Request.Retry()
+		}
+	})
+	c.OnResponse(func(r *Response) {
+		body = string(r.Body)
+		if r.Request.Timeout != time.Second {
+			t.Errorf("Invalid timeout of the retried request: %v", r.Request.Timeout)
+		}
+	})
+	c.Visit(ts.URL + "/")
+	if body != "start end" {
+		t.Errorf("Retry with a longer timeout failed: %q", body)
+	}
+}
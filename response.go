@@ -17,9 +17,11 @@ package colly
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/saintfish/chardet"
@@ -32,6 +34,10 @@ type Response struct {
 	StatusCode int
 	// Body is the content of the Response
 	Body []byte
+	// Truncated is true if the body was cut at the MaxBodySize of the
+	// Collector. Truncated responses are processed only if
+	// AllowTruncatedBody is enabled.
+	Truncated bool
 	// Ctx is a context between a Request and a Response
 	Ctx *Context
 	// Request is the Request object of the response
@@ -41,6 +47,31 @@ type Response struct {
 	// Trace contains the HTTPTrace for the request. Will only be set by the
 	// collector if Collector.TraceHTTP is set to true.
 	Trace *HTTPTrace
+	// Robots contains the robots directives of the X-Robots-Tag headers
+	// and the robots meta tags of the response. It is only set if the
+	// Collector honours them, i.e. IgnoreRobotsTxt is false and at least
+	// one of IgnoreRobotsNoIndex and IgnoreRobotsNoFollow is false.
+	Robots RobotsDirectives
+	// Alternates are the language variants of the page annotated by
+	// hreflang link tags and Link headers. They are only parsed if
+	// FollowAlternates, Languages or DetectLanguage is enabled.
+	Alternates []Alternate
+	// Variant is true if the page was detected to be served in
+	// different variants. See DetectVariants.
+	Variant bool
+	// Language is the ISO 639-1 code of the language of the response if
+	// the language detection is enabled and the language is known. See
+	// DetectLanguage.
+	Language string
+	// Screenshot is the full-page PNG screenshot of the rendered page
+	// if CaptureScreenshot was requested by Request.Capture and the
+	// Fetcher of the request renders pages
+	Screenshot []byte
+	// PDF is the rendered page printed to PDF if CapturePDF was
+	// requested by Request.Capture and the Fetcher of the request
+	// renders pages
+	PDF     []byte
+	failure error
 }
 
 // Save writes response body to disk
@@ -48,6 +79,12 @@ func (r *Response) Save(fileName string) error {
 	return ioutil.WriteFile(fileName, r.Body, 0644)
 }
 
+// SaveTo writes response body to w
+func (r *Response) SaveTo(w io.Writer) error {
+	_, err := io.Copy(w, bytes.NewReader(r.Body))
+	return err
+}
+
 // FileName returns the sanitized file name parsed from "Content-Disposition"
 // header or from URL
 func (r *Response) FileName() string {
@@ -61,8 +98,45 @@ func (r *Response) FileName() string {
 	return SanitizeFileName(strings.TrimPrefix(r.Request.URL.Path, "/"))
 }
 
-func (r *Response) fixCharset(detectCharset bool, defaultEncoding string) error {
+// fixContentType sets the forced content type of the request or the
+// sniffed content type of the body if the server sent a missing or
+// generic Content-Type
+func (r *Response) fixContentType(forced string) {
+	if r.Headers == nil {
+		r.Headers = &http.Header{}
+	}
+	if forced != "" {
+		r.Headers.Set("Content-Type", forced)
+		return
+	}
 	if len(r.Body) == 0 {
+		return
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/octet-stream" && mediaType != "text/plain" {
+		return
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(r.Body))
+	if sniffed == mediaType || sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		return
+	}
+	// plain texts are only promoted to markup
+	if mediaType == "text/plain" && sniffed != "text/html" && sniffed != "text/xml" {
+		return
+	}
+	if cs, ok := params["charset"]; ok {
+		sniffed += "; charset=" + cs
+	}
+	r.Headers.Set("Content-Type", sniffed)
+}
+
+// xmlDeclarationRe matches the encoding of XML declarations
+var xmlDeclarationRe = regexp.MustCompile(`^\x{feff}?\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:\-]+)["']`)
+
+func (r *Response) fixCharset(detectCharset bool, defaultEncoding string) error {
+	// partial contents are returned as is, because the boundaries
+	// of the parts can split multibyte characters
+	if len(r.Body) == 0 || r.StatusCode == http.StatusPartialContent {
 		return nil
 	}
 	if defaultEncoding != "" {
@@ -70,7 +144,7 @@ func (r *Response) fixCharset(detectCharset bool, defaultEncoding string) error
 		if err != nil {
 			return err
 		}
-		r.Body = tmpBody
+		r.Body = fixXMLDeclaration(tmpBody)
 		return nil
 	}
 	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
@@ -85,15 +159,21 @@ func (r *Response) fixCharset(detectCharset bool, defaultEncoding string) error
 	}
 
 	if !strings.Contains(contentType, "charset") {
-		if !detectCharset {
+		if _, name, certain := charset.DetermineEncoding(r.Body, ""); certain {
+			// byte order mark
+			contentType = "text/plain; charset=" + name
+		} else if m := xmlDeclarationRe.FindSubmatch(r.Body); m != nil {
+			contentType = "text/plain; charset=" + strings.ToLower(string(m[1]))
+		} else if !detectCharset {
 			return nil
+		} else {
+			d := chardet.NewTextDetector()
+			r, err := d.DetectBest(r.Body)
+			if err != nil {
+				return err
+			}
+			contentType = "text/plain; charset=" + r.Charset
 		}
-		d := chardet.NewTextDetector()
-		r, err := d.DetectBest(r.Body)
-		if err != nil {
-			return err
-		}
-		contentType = "text/plain; charset=" + r.Charset
 	}
 	if strings.Contains(contentType, "utf-8") || strings.Contains(contentType, "utf8") {
 		return nil
@@ -102,10 +182,23 @@ func (r *Response) fixCharset(detectCharset bool, defaultEncoding string) error
 	if err != nil {
 		return err
 	}
-	r.Body = tmpBody
+	r.Body = fixXMLDeclaration(tmpBody)
 	return nil
 }
 
+// fixXMLDeclaration sets the encoding of the XML declaration of a
+// transcoded body to UTF-8, so XML parsers do not decode it again
+func fixXMLDeclaration(b []byte) []byte {
+	m := xmlDeclarationRe.FindSubmatchIndex(b)
+	if m == nil {
+		return b
+	}
+	res := make([]byte, 0, len(b))
+	res = append(res, b[:m[2]]...)
+	res = append(res, "UTF-8"...)
+	return append(res, b[m[3]:]...)
+}
+
 func encodeBytes(b []byte, contentType string) ([]byte, error) {
 	r, err := charset.NewReader(bytes.NewReader(b), contentType)
 	if err != nil {
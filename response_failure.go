@@ -0,0 +1,81 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// Fail marks the response as failed logically, e.g. a soft 404 page or
+// an empty template served with status code 200. It can be called in
+// OnResponse, OnHTML, OnXML, OnJSON and OnScraped callbacks. The URL of
+// a failed response is removed from the visited URLs if the storage
+// implements storage.UnvisitStorage, so it can be visited again later.
+// The error is passed to the OnError callbacks after the OnScraped
+// callbacks. ErrResponseFailed is used if err is nil.
+func (r *Response) Fail(err error) {
+	if err == nil {
+		err = ErrResponseFailed
+	}
+	r.failure = err
+}
+
+// Failed returns the error of a response marked as failed by Fail or
+// nil
+func (r *Response) Failed() error {
+	return r.failure
+}
+
+type visitURLKey struct{}
+
+// withVisitURL returns a context carrying the URL of a request as it was
+// checked and stored as visited
+func withVisitURL(ctx context.Context, u string) context.Context {
+	return context.WithValue(ctx, visitURLKey{}, u)
+}
+
+// forgetVisit removes the request of the context from the visited
+// requests
+func (c *Collector) forgetVisit(ctx context.Context, method string, getBody func() (io.ReadCloser, error)) {
+	s, ok := c.store.(storage.UnvisitStorage)
+	if !ok {
+		return
+	}
+	u, ok := ctx.Value(visitURLKey{}).(string)
+	if !ok {
+		return
+	}
+	var body []byte
+	if method != "GET" {
+		if getBody == nil {
+			// requests without body are not stored as visited
+			return
+		}
+		rc, err := getBody()
+		if err != nil {
+			return
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return
+		}
+	}
+	s.Unvisit(requestHash(u, body))
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/missing" || r.Method == "POST" {
+			w.Write([]byte(`<html><h1>Page not found</h1></html>`))
+			return
+		}
+		w.Write([]byte(`<html><h1>Found</h1></html>`))
+	}))
+	defer ts.Close()
+
+	errSoft404 := errors.New("soft 404")
+	c := NewCollector()
+	c.OnHTML("h1", func(e *HTMLElement) {
+		if e.Text == "Page not found" {
+			e.Response.Fail(errSoft404)
+		}
+	})
+	var errs []error
+	c.OnError(func(r *Response, err error) {
+		if r.Failed() != err {
+			t.Errorf("Invalid failure of the response: %v", r.Failed())
+		}
+		errs = append(errs, err)
+	})
+	scraped := 0
+	c.OnScraped(func(r *Response) {
+		scraped++
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := c.Visit(ts.URL + "/missing"); err != errSoft404 {
+			t.Errorf("Expected the failure of the response, got %v", err)
+		}
+	}
+	if visited, _ := c.HasVisited(ts.URL + "/missing"); visited {
+		t.Error("Failed URL is visited")
+	}
+	if err := c.PostRaw(ts.URL+"/form", []byte("a=1")); err != errSoft404 {
+		t.Errorf("Expected the failure of the response, got %v", err)
+	}
+	if err := c.PostRaw(ts.URL+"/form", []byte("a=1")); err == ErrAlreadyVisited {
+		t.Error("Failed POST request is visited")
+	}
+	c.Visit(ts.URL + "/found")
+	if err := c.Visit(ts.URL + "/found"); err != ErrAlreadyVisited {
+		t.Errorf("Expected ErrAlreadyVisited, got %v", err)
+	}
+	if len(errs) != 4 || scraped != 5 {
+		t.Errorf("Unexpected callbacks: %d errors, %d scraped", len(errs), scraped)
+	}
+
+	c = NewCollector()
+	c.OnScraped(func(r *Response) {
+		r.Fail(nil)
+	})
+	if err := c.Visit(ts.URL + "/found"); err != ErrResponseFailed {
+		t.Errorf("Expected ErrResponseFailed, got %v", err)
+	}
+}
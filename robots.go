@@ -0,0 +1,245 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/temoto/robotstxt"
+	"golang.org/x/net/html"
+
+	"github.com/gocolly/colly/v2/storage"
+)
+
+// maxRobotsSize limits the size of the fetched robots.txt files
+const maxRobotsSize = 512 * 1024
+
+// robotsEntry is a parsed robots.txt file
+type robotsEntry struct {
+	data *robotstxt.RobotsData
+	file *storage.Robots
+}
+
+func (c *Collector) robotsExpired(fetched time.Time) bool {
+	return c.RobotsTTL > 0 && time.Since(fetched) >= c.RobotsTTL
+}
+
+// robots returns the robots.txt of the host of the URL. Expired files are
+// revalidated by conditional requests and fetched again if they have
+// been changed.
+func (c *Collector) robots(u *url.URL) (*robotstxt.RobotsData, error) {
+	c.lock.RLock()
+	e, ok := c.robotsMap[u.Host]
+	c.lock.RUnlock()
+	if ok && !c.robotsExpired(e.file.Fetched) {
+		return e.data, nil
+	}
+
+	rs, shared := c.store.(storage.RobotsStorage)
+	if shared {
+		r, err := rs.GetRobots(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && (e == nil || r.Fetched.After(e.file.Fetched)) {
+			data, err := robotstxt.FromStatusAndBytes(r.StatusCode, r.Body)
+			if err != nil {
+				return nil, err
+			}
+			e = &robotsEntry{data: data, file: r}
+			if !c.robotsExpired(r.Fetched) {
+				c.setRobots(u.Host, e)
+				return data, nil
+			}
+		}
+	}
+
+	req, err := http.NewRequest("GET", u.Scheme+"://"+u.Host+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	if e != nil {
+		if e.file.ETag != "" {
+			req.Header.Set("If-None-Match", e.file.ETag)
+		}
+		if e.file.LastModified != "" {
+			req.Header.Set("If-Modified-Since", e.file.LastModified)
+		}
+	}
+	c.identify(req.Header)
+	resp, err := c.backend.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data *robotstxt.RobotsData
+	var r *storage.Robots
+	if resp.StatusCode == http.StatusNotModified && e != nil {
+		data = e.data
+		r = &storage.Robots{
+			StatusCode:   e.file.StatusCode,
+			Body:         e.file.Body,
+			Fetched:      time.Now(),
+			ETag:         e.file.ETag,
+			LastModified: e.file.LastModified,
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			r.ETag = etag
+		}
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			r.LastModified = lastModified
+		}
+	} else {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = robotstxt.FromStatusAndBytes(resp.StatusCode, body); err != nil {
+			return nil, err
+		}
+		r = &storage.Robots{
+			StatusCode:   resp.StatusCode,
+			Body:         body,
+			Fetched:      time.Now(),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+	}
+	if shared {
+		if err := rs.SetRobots(u.Host, r); err != nil {
+			return nil, err
+		}
+	}
+	c.setRobots(u.Host, &robotsEntry{data: data, file: r})
+	return data, nil
+}
+
+func (c *Collector) setRobots(host string, e *robotsEntry) {
+	c.lock.Lock()
+	c.robotsMap[host] = e
+	c.lock.Unlock()
+}
+
+// RobotsDirectives are the indexing directives of a page set by its
+// X-Robots-Tag headers and robots meta tags
+type RobotsDirectives struct {
+	// NoIndex is set by the "noindex" and "none" directives
+	NoIndex bool
+	// NoFollow is set by the "nofollow" and "none" directives
+	NoFollow bool
+}
+
+func (d *RobotsDirectives) parse(directives string) {
+	for _, directive := range strings.Split(directives, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex = true
+			d.NoFollow = true
+		}
+	}
+}
+
+// robotsDirectivesWithValue are the directives having a "name: value"
+// form which can not be confused with a user agent prefix
+var robotsDirectivesWithValue = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// parseRobotsDirectives collects the robots directives of a response
+// which apply to every crawler or to the user agent
+func parseRobotsDirectives(r *Response, userAgent string) RobotsDirectives {
+	d := RobotsDirectives{}
+	if r.Headers != nil {
+		for _, h := range (*r.Headers)["X-Robots-Tag"] {
+			if i := strings.Index(h, ":"); i > 0 {
+				name := strings.ToLower(strings.TrimSpace(h[:i]))
+				if !robotsDirectivesWithValue[name] {
+					if !userAgentMatches(userAgent, name) {
+						continue
+					}
+					h = h[i+1:]
+				}
+			}
+			d.parse(h)
+		}
+		if !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+			return d
+		}
+	}
+	// robots meta tags are only searched in the head of the document
+	z := html.NewTokenizer(bytes.NewReader(r.Body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return d
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return d
+			case "meta":
+				var metaName, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "name":
+						metaName = strings.ToLower(strings.TrimSpace(string(v)))
+					case "content":
+						content = string(v)
+					}
+				}
+				if metaName == "robots" || userAgentMatches(userAgent, metaName) {
+					d.parse(content)
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				return d
+			}
+		}
+	}
+}
+
+// userAgentMatches checks whether the name is a product token of the
+// user agent, e.g. "googlebot" matches "Mozilla/5.0 (compatible; Googlebot/2.1)"
+func userAgentMatches(userAgent, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, token := range strings.FieldsFunc(userAgent, func(r rune) bool {
+		return r == ' ' || r == '/' || r == ';' || r == '(' || r == ')'
+	}) {
+		if strings.EqualFold(token, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule revisits URLs and seed lists of a collector
+// periodically, by fixed intervals or cron expressions:
+//
+//	c := colly.NewCollector(colly.WatchChanges("#content"))
+//	c.OnChange(func(r *colly.Response, oldHash, newHash string) {
+//		log.Println("changed:", r.Request.URL)
+//	})
+//	s := schedule.New(c)
+//	s.Add(schedule.Every(time.Hour), "https://example.com/news")
+//	s.Add(schedule.MustCron("0 6 * * 1-5"), "https://example.com/", "https://example.com/blog/")
+//	s.Run(ctx)
+//
+// The scheduled URLs are revisited even if AllowURLRevisit is disabled,
+// the URLs followed from them are checked as usual. Enable
+// AllowURLRevisit and set MaxDepth to recrawl the followed pages too.
+// Combined with WatchChanges, the OnChange callbacks are called when a
+// revisited page has changed.
+package schedule
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Schedule calculates the run times of an entry
+type Schedule interface {
+	// Next returns the first run time after t or the zero time if there
+	// are no more runs
+	Next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+// Every returns a Schedule running every d
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Entry is a scheduled job
+type Entry struct {
+	// Schedule calculates the run times of the entry
+	Schedule Schedule
+	// URLs are revisited at every run
+	URLs []string
+	// Func is called at every run if it is not nil
+	Func func(c *colly.Collector) error
+	// Prev is the start time of the last run
+	Prev time.Time
+	// Next is the time of the next run
+	Next time.Time
+}
+
+// Scheduler runs the scheduled entries
+type Scheduler struct {
+	// Collector visits the URLs of the entries
+	Collector *colly.Collector
+	// Location is the time zone of the cron expressions. Local time is
+	// used if it is nil.
+	Location *time.Location
+	// OnError is called with the errors of the runs if it is not nil
+	OnError func(e *Entry, err error)
+	lock    sync.Mutex
+	entries []*Entry
+	wake    chan struct{}
+}
+
+// New creates a Scheduler of a collector
+func New(c *colly.Collector) *Scheduler {
+	return &Scheduler{
+		Collector: c,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Add schedules revisiting the URLs
+func (s *Scheduler) Add(sched Schedule, urls ...string) *Entry {
+	return s.add(&Entry{Schedule: sched, URLs: urls})
+}
+
+// AddFunc schedules calling f with the collector, e.g. to load a seed
+// list and to visit its URLs
+func (s *Scheduler) AddFunc(sched Schedule, f func(c *colly.Collector) error) *Entry {
+	return s.add(&Entry{Schedule: sched, Func: f})
+}
+
+func (s *Scheduler) add(e *Entry) *Entry {
+	e.Next = e.Schedule.Next(s.now())
+	s.lock.Lock()
+	s.entries = append(s.entries, e)
+	s.lock.Unlock()
+	s.notify()
+	return e
+}
+
+// Remove removes an entry from the Scheduler
+func (s *Scheduler) Remove(e *Entry) {
+	s.lock.Lock()
+	for i, entry := range s.entries {
+		if entry == e {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+// Entries returns the scheduled entries ordered by their next run time
+func (s *Scheduler) Entries() []*Entry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if !e.Next.IsZero() {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Next.Before(entries[j].Next)
+	})
+	return entries
+}
+
+// Run runs the due entries until the context is done. The next run of
+// an entry is calculated after the end of its current run, so the runs
+// missed by a long crawl are skipped instead of being made up.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		var wait <-chan time.Time
+		var timer *time.Timer
+		if entries := s.Entries(); len(entries) > 0 {
+			timer = time.NewTimer(entries[0].Next.Sub(s.now()))
+			wait = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-wait:
+			s.runDue()
+		}
+	}
+}
+
+func (s *Scheduler) runDue() {
+	now := s.now()
+	for _, e := range s.Entries() {
+		if e.Next.After(now) {
+			break
+		}
+		s.run(e)
+		next := e.Schedule.Next(s.now())
+		s.lock.Lock()
+		e.Prev = now
+		e.Next = next
+		s.lock.Unlock()
+	}
+}
+
+func (s *Scheduler) run(e *Entry) {
+	c := s.Collector
+	for _, u := range e.URLs {
+		if err := c.Revisit(u); err != nil {
+			s.error(e, err)
+		}
+	}
+	if e.Func != nil {
+		if err := e.Func(c); err != nil {
+			s.error(e, err)
+		}
+	}
+	if c.Async {
+		c.Wait()
+	}
+}
+
+func (s *Scheduler) error(e *Entry, err error) {
+	if s.OnError != nil {
+		s.OnError(e, err)
+	}
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Location != nil {
+		return time.Now().In(s.Location)
+	}
+	return time.Now()
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestCron(t *testing.T) {
+	base := time.Date(2019, time.January, 30, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2019, time.January, 30, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, time.January, 30, 10, 30, 0, 0, time.UTC)},
+		{"0 6 * * *", time.Date(2019, time.January, 31, 6, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2019, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2019, time.January, 31, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2019, time.February, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2019, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"5,10 8-10/2 * * *", time.Date(2019, time.January, 31, 8, 5, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2019, time.January, 30, 11, 0, 0, 0, time.UTC)},
+		{"@every 1h30m", base.Add(90 * time.Minute)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Cron(tt.expr)
+		if err != nil {
+			t.Errorf("Cron(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if next := s.Next(base); !next.Equal(tt.next) {
+			t.Errorf("Cron(%q).Next() = %v, expected %v", tt.expr, next, tt.next)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every", "@every -1s"} {
+		if _, err := Cron(expr); err != ErrInvalidCron {
+			t.Errorf("Expected ErrInvalidCron for %q, got %v", expr, err)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	var lock sync.Mutex
+	version := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		version++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><p id="v">%d</p></body></html>`, version/2)
+	}))
+	defer ts.Close()
+
+	c := colly.NewCollector(colly.WatchChanges("#v"))
+	visits, changes := 0, 0
+	c.OnResponse(func(r *colly.Response) {
+		visits++
+	})
+	c.OnChange(func(r *colly.Response, oldHash, newHash string) {
+		changes++
+	})
+	funcRuns := 0
+
+	s := New(c)
+	s.OnError = func(e *Entry, err error) {
+		t.Error(err)
+	}
+	s.Add(Every(20*time.Millisecond), ts.URL+"/")
+	e := s.AddFunc(Every(time.Hour), func(*colly.Collector) error {
+		funcRuns++
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	time.Sleep(150 * time.Millisecond)
+	s.Remove(e)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if visits < 3 {
+		t.Errorf("Expected at least 3 visits, got %d", visits)
+	}
+	if changes == 0 || changes >= visits {
+		t.Errorf("Unexpected number of changes: %d of %d visits", changes, visits)
+	}
+	if funcRuns != 0 {
+		t.Errorf("Entry ran before its time")
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("Entry was not removed")
+	}
+}
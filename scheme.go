@@ -0,0 +1,59 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SchemeHandler fetches the resources of a URL scheme which is not
+// supported by net/http. The returned response must have a StatusCode
+// and a Body. LimitRules, MaxBodySize, content decoding and the
+// callbacks of the Collector are applied to it like to HTTP responses.
+type SchemeHandler interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// SchemeHandlerFunc is an adapter to use an ordinary function as
+// a SchemeHandler
+type SchemeHandlerFunc func(req *http.Request) (*http.Response, error)
+
+// Fetch calls f(req)
+func (f SchemeHandlerFunc) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RegisterScheme registers the handler of a non-HTTP URL scheme
+func (h *httpBackend) RegisterScheme(scheme string, handler SchemeHandler) error {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || scheme == "http" || scheme == "https" || handler == nil {
+		return ErrInvalidScheme
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.schemes == nil {
+		h.schemes = make(map[string]SchemeHandler)
+	}
+	h.schemes[scheme] = handler
+	return nil
+}
+
+// schemeHandler returns the registered handler of the scheme or nil
+func (h *httpBackend) schemeHandler(scheme string) SchemeHandler {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.schemes[strings.ToLower(scheme)]
+}
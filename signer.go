@@ -0,0 +1,130 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// RequestSigner signs requests right before they are sent, after the
+// OnRequest callbacks, header profiles and authentication modified
+// them. Every round trip is signed, including redirects and retries.
+type RequestSigner interface {
+	Sign(req *http.Request) error
+}
+
+// RequestSignerFunc is an adapter to use an ordinary function as
+// a RequestSigner
+type RequestSignerFunc func(req *http.Request) error
+
+// Sign calls f(req)
+func (f RequestSignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// SetRequestSigner sets the signer of the requests of a domain.
+// Subdomains are matched by a leading "*.", e.g. "*.amazonaws.com".
+// The signer of the empty domain signs the requests of every domain
+// without signer. Passing nil removes the signer of the domain.
+func (c *Collector) SetRequestSigner(domain string, s RequestSigner) {
+	c.backend.SetRequestSigner(domain, s)
+}
+
+// SetRequestSigner sets the signer of the requests of a domain
+func (h *httpBackend) SetRequestSigner(domain string, s RequestSigner) {
+	domain = strings.ToLower(domain)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if s == nil {
+		delete(h.signers, domain)
+		return
+	}
+	if h.signers == nil {
+		h.signers = make(map[string]RequestSigner)
+	}
+	h.signers[domain] = s
+}
+
+// signer returns the signer of a host or nil
+func (h *httpBackend) signer(host string) RequestSigner {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.signers) == 0 {
+		return nil
+	}
+	for _, d := range domainKeys(host) {
+		if s, ok := h.signers[d]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// signingTransport signs the requests by the signer of their host
+type signingTransport struct {
+	backend *httpBackend
+	base    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	s := t.backend.signer(req.URL.Hostname())
+	if s == nil {
+		return base.RoundTrip(req)
+	}
+	// round trippers must not modify the original request
+	signed := req.WithContext(req.Context())
+	signed.Header = cloneHeader(req.Header)
+	if err := s.Sign(signed); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return base.RoundTrip(signed)
+}
+
+// readRequestBody returns the body of a request without consuming it
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigV4Signer() *SigV4Signer {
+	return &SigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+		now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+}
+
+func TestSigV4Signer(t *testing.T) {
+	// test vectors of the AWS Signature Version 4 test suite
+	tests := map[string]string{
+		"/":                             "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"/?Param2=value2&Param1=value1": "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+	}
+	for path, signature := range tests {
+		req, _ := http.NewRequest("GET", "https://example.amazonaws.com"+path, nil)
+		if err := newTestSigV4Signer().Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if got := req.Header.Get("Authorization"); got != expected {
+			t.Errorf("Invalid signature of %s: %s", path, got)
+		}
+	}
+}
+
+func TestRequestSigner(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Amz-Content-Sha256")))
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	s := newTestSigV4Signer()
+	s.Service = "s3"
+	c.SetRequestSigner("127.0.0.1", s)
+	c.OnRequest(func(r *Request) {
+		r.Headers.Set("X-Amz-Meta-Test", "set by callback")
+	})
+	var body string
+	c.OnResponse(func(r *Response) {
+		body = string(r.Body)
+	})
+	c.Visit(ts.URL + "/redirect")
+	if !strings.Contains(body, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-meta-test,") {
+		t.Errorf("Invalid signed headers %q", body)
+	}
+	if !strings.HasSuffix(body, "|e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855") {
+		t.Errorf("Invalid payload hash %q", body)
+	}
+
+	body = ""
+	c.PostRaw(ts.URL+"/post", []byte("data"))
+	if !strings.HasSuffix(body, "|"+hexSHA256([]byte("data"))) {
+		t.Errorf("Invalid payload hash of POST %q", body)
+	}
+
+	c.SetRequestSigner("127.0.0.1", nil)
+	c.Visit(ts.URL + "/unsigned")
+	if body != "|" {
+		t.Errorf("Request was signed after removing the signer %q", body)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sitemap ingests the URLs of sitemaps during long crawls. The
+// sitemaps are revalidated periodically by conditional requests and the
+// URLs added to them are visited by the Collector:
+//
+//	w := sitemap.NewWatcher(c, "https://example.com/sitemap.xml")
+//	w.Interval = 6 * time.Hour
+//	go w.Run(ctx)
+//
+// The sitemaps of sitemap indexes are followed and revalidated too.
+// Combine it with Collector.RobotsTTL to respect the changes of the
+// robots.txt files as well.
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Watcher revalidates sitemaps periodically and visits their new URLs
+type Watcher struct {
+	// Interval is the time between the revalidations of the sitemaps.
+	// It is 1 hour by default.
+	Interval time.Duration
+	// OnURL is called with the new URLs of the sitemaps. The URLs are
+	// visited by the Collector if it is nil.
+	OnURL func(u string)
+	// OnError is called with the errors of the unavailable sitemaps
+	OnError   func(sitemapURL string, err error)
+	collector *colly.Collector
+	fetcher   colly.Fetcher
+	sitemaps  []string
+	lock      sync.Mutex
+	states    map[string]*state
+	seen      map[string]bool
+}
+
+// state is the last fetched version of a sitemap
+type state struct {
+	etag         string
+	lastModified string
+	urls         []string
+	sitemaps     []string
+}
+
+type document struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// NewWatcher creates a Watcher of the sitemaps which visits their URLs
+// by the Collector. The sitemaps are downloaded by the HTTP backend of
+// the Collector within its LimitRules.
+func NewWatcher(c *colly.Collector, sitemapURLs ...string) *Watcher {
+	return &Watcher{
+		Interval:  time.Hour,
+		collector: c,
+		fetcher:   c.HTTPFetcher(),
+		sitemaps:  sitemapURLs,
+		states:    make(map[string]*state),
+		seen:      make(map[string]bool),
+	}
+}
+
+// Run checks the sitemaps immediately and then in every Interval until
+// the context is canceled
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		w.Check(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check revalidates the sitemaps and passes their new URLs to OnURL.
+// It returns the number of the new URLs. The unchanged sitemaps are not
+// downloaded again.
+func (w *Watcher) Check(ctx context.Context) int {
+	queue := append([]string(nil), w.sitemaps...)
+	fetched := make(map[string]bool)
+	var added []string
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if fetched[u] {
+			continue
+		}
+		fetched[u] = true
+		s, err := w.fetch(ctx, u)
+		if err != nil && w.OnError != nil {
+			w.OnError(u, err)
+		}
+		if s == nil {
+			continue
+		}
+		queue = append(queue, s.sitemaps...)
+		w.lock.Lock()
+		for _, loc := range s.urls {
+			if !w.seen[loc] {
+				w.seen[loc] = true
+				added = append(added, loc)
+			}
+		}
+		w.lock.Unlock()
+	}
+	for _, u := range added {
+		if w.OnURL != nil {
+			w.OnURL(u)
+		} else {
+			w.collector.Visit(u)
+		}
+	}
+	return len(added)
+}
+
+// fetch revalidates a sitemap. The previous version of the sitemap is
+// returned if it is not modified or if it is unavailable.
+func (w *Watcher) fetch(ctx context.Context, sitemapURL string) (*state, error) {
+	w.lock.Lock()
+	prev := w.states[sitemapURL]
+	w.lock.Unlock()
+	u, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	hdr := http.Header{}
+	hdr.Set("User-Agent", w.collector.UserAgent)
+	// the sitemaps are not served from the CacheDir of the Collector
+	hdr.Set("Cache-Control", "no-cache")
+	if prev != nil {
+		if prev.etag != "" {
+			hdr.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			hdr.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+	req := &colly.Request{
+		URL:     u,
+		Method:  "GET",
+		Headers: &hdr,
+	}
+	resp, err := w.fetcher.Do(ctx, req)
+	if err != nil {
+		return prev, err
+	}
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return prev, fmt.Errorf("Sitemap returned status code %d", resp.StatusCode)
+	}
+	s := parse(req.URL, resp.Body)
+	s.etag = resp.Headers.Get("ETag")
+	s.lastModified = resp.Headers.Get("Last-Modified")
+	w.lock.Lock()
+	w.states[sitemapURL] = s
+	w.lock.Unlock()
+	return s, nil
+}
+
+// parse returns the absolute page and sitemap URLs of a XML or text
+// sitemap
+func parse(base *url.URL, body []byte) *state {
+	s := &state{}
+	add := func(list *[]string, loc string) {
+		if u, err := base.Parse(strings.TrimSpace(loc)); err == nil && u.Host != "" {
+			*list = append(*list, u.String())
+		}
+	}
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("<")) {
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				add(&s.urls, line)
+			}
+		}
+		return s
+	}
+	doc := &document{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return s
+	}
+	for _, u := range doc.URLs {
+		add(&s.urls, u.Loc)
+	}
+	for _, sm := range doc.Sitemaps {
+		add(&s.sitemaps, sm.Loc)
+	}
+	return s
+}
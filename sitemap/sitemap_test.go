@@ -0,0 +1,151 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sitemap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+type testSite struct {
+	lock        sync.Mutex
+	pages       []string
+	notModified map[string]int
+}
+
+func (s *testSite) handler(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch r.URL.Path {
+	case "/sitemap_index.xml":
+		if r.Header.Get("If-None-Match") == `"index"` {
+			s.notModified[r.URL.Path]++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"index"`)
+		fmt.Fprint(w, `<?xml version="1.0"?><sitemapindex><sitemap><loc>/pages.xml</loc></sitemap><sitemap><loc>/pages.txt</loc></sitemap></sitemapindex>`)
+	case "/pages.xml":
+		lastModified := fmt.Sprintf("Mon, 02 Jan 2006 15:04:%02d GMT", len(s.pages))
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			s.notModified[r.URL.Path]++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, `<?xml version="1.0"?><urlset>`)
+		for _, p := range s.pages {
+			fmt.Fprintf(w, "<url><loc>%s</loc></url>", p)
+		}
+		fmt.Fprint(w, `</urlset>`)
+	case "/pages.txt":
+		fmt.Fprint(w, "/text\n\n/page/1\n")
+	case "/missing.xml":
+		http.NotFound(w, r)
+	default:
+		w.Write([]byte("page"))
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	site := &testSite{pages: []string{"/page/1", "/page/2"}, notModified: map[string]int{}}
+	ts := httptest.NewServer(http.HandlerFunc(site.handler))
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	var visited []string
+	c.OnResponse(func(r *colly.Response) {
+		visited = append(visited, r.Request.URL.Path)
+	})
+	w := NewWatcher(c, ts.URL+"/sitemap_index.xml", ts.URL+"/missing.xml")
+	errs := map[string]error{}
+	w.OnError = func(u string, err error) {
+		errs[u] = err
+	}
+
+	if n := w.Check(context.Background()); n != 3 {
+		t.Errorf("Invalid number of new URLs: %d", n)
+	}
+	sort.Strings(visited)
+	if strings.Join(visited, ",") != "/page/1,/page/2,/text" {
+		t.Errorf("Invalid visited pages: %v", visited)
+	}
+	if _, ok := errs[ts.URL+"/missing.xml"]; !ok || len(errs) != 1 {
+		t.Errorf("Invalid errors: %v", errs)
+	}
+
+	if n := w.Check(context.Background()); n != 0 {
+		t.Errorf("Known URLs were ingested again: %d", n)
+	}
+	site.lock.Lock()
+	if site.notModified["/sitemap_index.xml"] != 1 || site.notModified["/pages.xml"] != 1 {
+		t.Errorf("Sitemaps were not revalidated: %v", site.notModified)
+	}
+	site.pages = append(site.pages, "/page/3")
+	site.lock.Unlock()
+
+	visited = nil
+	if n := w.Check(context.Background()); n != 1 {
+		t.Errorf("Invalid number of new URLs: %d", n)
+	}
+	if len(visited) != 1 || visited[0] != "/page/3" {
+		t.Errorf("Invalid visited pages: %v", visited)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	site := &testSite{pages: []string{"/page/1"}, notModified: map[string]int{}}
+	ts := httptest.NewServer(http.HandlerFunc(site.handler))
+	defer ts.Close()
+
+	w := NewWatcher(colly.NewCollector(), ts.URL+"/pages.xml")
+	w.Interval = 10 * time.Millisecond
+	urls := make(chan string, 10)
+	w.OnURL = func(u string) {
+		urls <- u
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	if u := <-urls; u != ts.URL+"/page/1" {
+		t.Errorf("Invalid URL: %s", u)
+	}
+	site.lock.Lock()
+	site.pages = append(site.pages, "/page/2")
+	site.lock.Unlock()
+	select {
+	case u := <-urls:
+		if u != ts.URL+"/page/2" {
+			t.Errorf("Invalid URL: %s", u)
+		}
+	case <-time.After(time.Second):
+		t.Error("Added URL was not ingested")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Invalid error: %v", err)
+	}
+}
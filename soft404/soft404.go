@@ -0,0 +1,219 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package soft404 detects "soft 404" pages, the error pages of missing
+// content served with status code 200. The detected pages are marked as
+// failed by Response.Fail, so they are passed to the OnError callbacks
+// with ErrSoft404, counted as errors by Collector.Stats and not kept as
+// visited:
+//
+//	c.Use(soft404.New())
+//	c.OnHTML("article", func(e *colly.HTMLElement) {
+//		if e.Response.Failed() != nil {
+//			return
+//		}
+//		...
+//	})
+//
+// The pages are detected by the phrases of their titles and headings
+// and by their similarity to the 404 page of the site, which is learned
+// by requesting a random nonexistent URL of every host.
+package soft404
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrSoft404 is the error of the detected soft 404 pages
+var ErrSoft404 = errors.New("Soft 404 page")
+
+// DefaultPatterns match the titles and headings of common error pages
+var DefaultPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(page|file|article|product|content)s? (was )?not (be )?found\b`),
+	regexp.MustCompile(`(?i)^\s*(error )?404( error| not found| page)?\s*($|[-:|])`),
+	regexp.MustCompile(`(?i)^\s*not found\s*($|[-:|])`),
+	regexp.MustCompile(`(?i)\b(does not|doesn't|no longer) exists?\b`),
+	regexp.MustCompile(`(?i)\bno longer available\b`),
+	regexp.MustCompile(`(?i)\bseite nicht gefunden\b`),
+	regexp.MustCompile(`(?i)\bpage introuvable\b`),
+	regexp.MustCompile(`(?i)\bp[aá]gina no encontrada\b`),
+}
+
+// Detector detects soft 404 pages. Register it by Collector.Use.
+type Detector struct {
+	colly.BasePlugin
+	// Patterns match the titles and the first headings of soft 404 pages
+	Patterns []*regexp.Regexp
+	// Probe requests a random nonexistent URL of every host to learn
+	// the template of its 404 page
+	Probe bool
+	// Similarity is the minimum similarity (0-1) of the words of a page
+	// and the 404 page of its host to detect the page as soft 404
+	Similarity float64
+	fetcher    colly.Fetcher
+	userAgent  string
+	lock       sync.Mutex
+	templates  map[string]*template
+	count      int
+}
+
+// template is the 404 page of a host
+type template struct {
+	once  sync.Once
+	words map[string]bool
+}
+
+// New creates a Detector with the default patterns and probing
+func New() *Detector {
+	return &Detector{
+		Patterns:   DefaultPatterns,
+		Probe:      true,
+		Similarity: 0.9,
+	}
+}
+
+// Init prepares the probing of the hosts of the Collector
+func (d *Detector) Init(c *colly.Collector) error {
+	d.fetcher = c.HTTPFetcher()
+	d.userAgent = c.UserAgent
+	return nil
+}
+
+// OnResponse marks the soft 404 responses as failed
+func (d *Detector) OnResponse(r *colly.Response) {
+	if d.IsSoft404(r) {
+		d.lock.Lock()
+		d.count++
+		d.lock.Unlock()
+		r.Fail(ErrSoft404)
+	}
+}
+
+// Count returns the number of the detected soft 404 pages
+func (d *Detector) Count() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.count
+}
+
+// IsSoft404 returns true if the response is a HTML page served with
+// status code 200 which looks like an error page
+func (d *Detector) IsSoft404(r *colly.Response) bool {
+	if r.StatusCode != http.StatusOK || r.Headers == nil || !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		return false
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+	if err != nil {
+		return false
+	}
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	heading := strings.TrimSpace(doc.Find("h1").First().Text())
+	for _, p := range d.Patterns {
+		if p.MatchString(title) || p.MatchString(heading) {
+			return true
+		}
+	}
+	if !d.Probe || d.fetcher == nil || r.Request == nil {
+		return false
+	}
+	t := d.template(r.Request.URL)
+	if t.words == nil {
+		return false
+	}
+	return similarity(t.words, words(doc.Text())) >= d.Similarity
+}
+
+// template returns the 404 template of the host of the URL
+func (d *Detector) template(u *url.URL) *template {
+	host := u.Scheme + "://" + u.Host
+	d.lock.Lock()
+	if d.templates == nil {
+		d.templates = make(map[string]*template)
+	}
+	t, ok := d.templates[host]
+	if !ok {
+		t = &template{}
+		d.templates[host] = t
+	}
+	d.lock.Unlock()
+	t.once.Do(func() {
+		t.words = d.probe(host)
+	})
+	return t
+}
+
+// probe requests a random nonexistent URL of the host and returns the
+// words of the response if it is a soft 404 page
+func (d *Detector) probe(host string) map[string]bool {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil
+	}
+	u, err := url.Parse(host + "/" + hex.EncodeToString(b))
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	req := &colly.Request{
+		URL:     u,
+		Method:  "GET",
+		Headers: &http.Header{"User-Agent": []string{d.userAgent}},
+	}
+	resp, err := d.fetcher.Do(context.Background(), req)
+	// redirects of the missing pages, e.g. to the home page, are not
+	// templates
+	if err != nil || resp.StatusCode != http.StatusOK || req.URL.Path != path {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil
+	}
+	return words(doc.Text())
+}
+
+// words returns the set of the lowercase words of a text
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		set[w] = true
+	}
+	return set
+}
+
+// similarity returns the Jaccard index of two word sets
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package soft404
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const template404 = `<html><head><title>Example shop</title></head><body>
+<nav>Home Products About</nav><p>Sorry, we could not find what you were looking for %s.</p></body></html>`
+
+func newServer(redirect bool, probes *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><title>Example shop</title></head><body><h1>Welcome</h1><p>Our products are the best ones.</p></body></html>`))
+		case "/product":
+			w.Write([]byte(`<html><head><title>Product 404 - the best</title></head><body><h1>Product</h1><p>Buy it now.</p></body></html>`))
+		case "/removed":
+			w.Write([]byte(`<html><head><title>Example shop</title></head><body><h1>Page not found</h1></body></html>`))
+		default:
+			if len(r.URL.Path) == 25 {
+				atomic.AddInt32(probes, 1)
+			}
+			if redirect {
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+			fmt.Fprintf(w, template404, "")
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDetector(t *testing.T) {
+	var probes int32
+	ts := newServer(false, &probes)
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	d := New()
+	c.Use(d)
+	failed := map[string]error{}
+	c.OnError(func(r *colly.Response, err error) {
+		failed[r.Request.URL.Path] = err
+	})
+	for _, path := range []string{"/", "/product", "/removed", "/old-link"} {
+		c.Visit(ts.URL + path)
+	}
+	if len(failed) != 2 || failed["/removed"] != ErrSoft404 || failed["/old-link"] != ErrSoft404 {
+		t.Errorf("Unexpected soft 404s: %v", failed)
+	}
+	if d.Count() != 2 || c.Stats().Errors != 2 {
+		t.Errorf("Invalid number of soft 404s: %d, errors: %d", d.Count(), c.Stats().Errors)
+	}
+	if probes != 1 {
+		t.Errorf("Unexpected number of probes: %d", probes)
+	}
+}
+
+func TestRedirectingSite(t *testing.T) {
+	var probes int32
+	ts := newServer(true, &probes)
+	defer ts.Close()
+
+	c := colly.NewCollector()
+	d := New()
+	c.Use(d)
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/product")
+	if d.Count() != 0 {
+		t.Error("Home page of a site redirecting missing pages was detected as soft 404")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// blockedNetworks are the private, loopback, link-local (including the
+// cloud metadata endpoints), multicast and reserved address ranges
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// SSRFGuard blocks the connections to private, loopback, link-local and
+// other internal addresses to protect services crawling user submitted
+// URLs against server-side request forgery. The addresses are checked
+// after DNS resolution when the connections are opened, so DNS names
+// resolving to internal addresses and redirects to them are blocked too.
+//
+// If the Collector uses a proxy, the address of the proxy is checked,
+// so it has to be allowed.
+type SSRFGuard struct {
+	// Allowed are the internal networks which can be reached anyway
+	Allowed []*net.IPNet
+	// Blocked are additional networks which can not be reached
+	Blocked []*net.IPNet
+	// Dialer opens the connections. Its Control function is replaced.
+	// A dialer with 30 seconds timeout is used if it is nil.
+	Dialer *net.Dialer
+}
+
+// NewSSRFGuard creates a SSRFGuard allowing the given networks in CIDR
+// notation or IP addresses, e.g. "10.1.0.0/16" or "192.168.1.5"
+func NewSSRFGuard(allowed ...string) (*SSRFGuard, error) {
+	g := &SSRFGuard{}
+	for _, a := range allowed {
+		n, err := parseNetwork(a)
+		if err != nil {
+			return nil, err
+		}
+		g.Allowed = append(g.Allowed, n)
+	}
+	return g, nil
+}
+
+// Allows returns true if connections to the IP address are allowed
+func (g *SSRFGuard) Allows(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range g.Allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	for _, n := range g.Blocked {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Control checks the resolved address of a connection. It can be used
+// as net.Dialer.Control.
+func (g *SSRFGuard) Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !g.Allows(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// DialContext opens connections to allowed addresses only
+func (g *SSRFGuard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if g.Dialer != nil {
+		d = *g.Dialer
+	}
+	d.Control = g.Control
+	return d.DialContext(ctx, network, address)
+}
+
+// checkHost returns ErrBlockedAddress if the host is a blocked IP
+// address. Host names are checked when they are resolved.
+func (g *SSRFGuard) checkHost(host string) error {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && !g.Allows(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// SSRFProtection blocks the requests to internal addresses. See
+// SSRFGuard.
+func SSRFProtection() CollectorOption {
+	return func(c *Collector) {
+		// the requests are refused if the transport can not be guarded
+		c.SetSSRFGuard(&SSRFGuard{})
+	}
+}
+
+// SetSSRFGuard blocks the requests to the addresses blocked by the
+// guard. It installs the guard in the transport of the Collector, which
+// must be a http.Transport or a HeaderOrderTransport wrapping a
+// http.Transport. It returns ErrUnguardedTransport for other transports.
+// If the transport is replaced later, the guard is installed in the new
+// transport before the next request.
+//
+// The guard fails closed: the requests are refused with
+// ErrUnguardedTransport while the transport can not be guarded, and
+// the requests of the URL schemes having a SchemeHandler are always
+// refused. Fetchers open their connections on their own, so only their
+// requests sent by HTTPFetcher are guarded.
+//
+// Passing nil removes the guard from the URL checks, but not from the
+// transport.
+func (c *Collector) SetSSRFGuard(g *SSRFGuard) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ssrfGuard = g
+	c.ssrfTransport = nil
+	if g == nil {
+		return nil
+	}
+	return c.guardTransport(g)
+}
+
+// guardTransport installs the guard in the transport of the Collector.
+// c.lock must be held.
+func (c *Collector) guardTransport(g *SSRFGuard) error {
+	switch t := c.backend.Client.Transport.(type) {
+	case nil:
+		c.backend.Client.Transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           g.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	case *http.Transport:
+		t.DialContext = g.DialContext
+	case *HeaderOrderTransport:
+		d := &net.Dialer{}
+		if t.Dialer != nil {
+			*d = *t.Dialer
+		}
+		d.Control = g.Control
+		t.Dialer = d
+		if inner, ok := t.Transport.(*http.Transport); ok {
+			inner.DialContext = g.DialContext
+		} else if t.Transport == nil {
+			t.Transport = &http.Transport{
+				Proxy:       http.ProxyFromEnvironment,
+				DialContext: g.DialContext,
+			}
+		} else {
+			return ErrUnguardedTransport
+		}
+	default:
+		return ErrUnguardedTransport
+	}
+	c.ssrfTransport = c.backend.Client.Transport
+	return nil
+}
+
+// checkSSRF checks the URL of a request against the SSRFGuard of the
+// Collector and installs the guard in the transport if it was replaced
+func (c *Collector) checkSSRF(u *url.URL) error {
+	c.lock.RLock()
+	g := c.ssrfGuard
+	guarded := c.ssrfTransport != nil && c.ssrfTransport == c.backend.Client.Transport
+	c.lock.RUnlock()
+	if g == nil {
+		return nil
+	}
+	if err := g.checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if c.backend.schemeHandler(u.Scheme) != nil {
+		return ErrUnguardedTransport
+	}
+	if guarded {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ssrfGuard != g {
+		return nil
+	}
+	return c.guardTransport(g)
+}
+
+// DisallowedNetworks blocks the requests to the given networks in CIDR
+// notation or IP addresses, e.g. "93.184.216.0/24" or "2001:db8::1",
+// in addition to the private, loopback and link-local ranges. Host
+// names are resolved and checked before dialing. It installs a
+// SSRFGuard if the Collector has none. See SetSSRFGuard.
+func (c *Collector) DisallowedNetworks(cidrs ...string) error {
+	g := &SSRFGuard{}
+	if c.ssrfGuard != nil {
+		*g = *c.ssrfGuard
+	}
+	blocked := make([]*net.IPNet, len(g.Blocked), len(g.Blocked)+len(cidrs))
+	copy(blocked, g.Blocked)
+	for _, cidr := range cidrs {
+		n, err := parseNetwork(cidr)
+		if err != nil {
+			return err
+		}
+		blocked = append(blocked, n)
+	}
+	g.Blocked = blocked
+	return c.SetSSRFGuard(g)
+}
+
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		if strings.Contains(s, ":") {
+			s += "/128"
+		} else {
+			s += "/32"
+		}
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+func parseNetworks(networks ...string) []*net.IPNet {
+	res := make([]*net.IPNet, len(networks))
+	for i, s := range networks {
+		n, err := parseNetwork(s)
+		if err != nil {
+			panic(err)
+		}
+		res[i] = n
+	}
+	return res
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSRFGuardAllows(t *testing.T) {
+	g, err := NewSSRFGuard("10.1.0.0/16", "192.168.1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800:220::1": true,
+		"127.0.0.1":        false,
+		"10.0.0.1":         false,
+		"10.1.2.3":         true,
+		"192.168.1.5":      true,
+		"192.168.1.6":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"fd00:ec2::254":    false,
+		"fe80::1":          false,
+	}
+	for ip, allowed := range tests {
+		if g.Allows(net.ParseIP(ip)) != allowed {
+			t.Errorf("Allows(%s) != %v", ip, allowed)
+		}
+	}
+	if _, err := NewSSRFGuard("10.0.0.0/33"); err == nil {
+		t.Error("Invalid network was accepted")
+	}
+}
+
+func TestSSRFProtection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://127.0.0.2:1/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := NewCollector(SSRFProtection())
+	if err := c.Visit(ts.URL); err != ErrBlockedAddress {
+		t.Errorf("Expected ErrBlockedAddress, got %v", err)
+	}
+
+	// host names are checked after resolution
+	c = NewCollector(SSRFProtection())
+	var visitErr error
+	c.OnError(func(r *Response, err error) {
+		visitErr = err
+	})
+	c.Visit(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1))
+	if visitErr == nil || !strings.Contains(visitErr.Error(), ErrBlockedAddress.Error()) {
+		t.Errorf("Expected blocked address error, got %v", visitErr)
+	}
+
+	g, err := NewSSRFGuard("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewCollector()
+	c.SetSSRFGuard(g)
+	visited := false
+	c.OnResponse(func(r *Response) {
+		visited = true
+	})
+	if err := c.Visit(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if !visited {
+		t.Error("Allowed address was not visited")
+	}
+
+	// redirects are checked when they are followed
+	c = NewCollector()
+	c.WithTransport(&http.Transport{})
+	c.SetSSRFGuard(g)
+	visitErr = nil
+	c.OnError(func(r *Response, err error) {
+		visitErr = err
+	})
+	c.Visit(ts.URL + "/redirect")
+	if visitErr == nil || !strings.Contains(visitErr.Error(), ErrBlockedAddress.Error()) {
+		t.Errorf("Expected blocked redirect, got %v", visitErr)
+	}
+}
+
+func TestDisallowedNetworks(t *testing.T) {
+	c := NewCollector()
+	if err := c.DisallowedNetworks("93.184.216.0/24", "2001:4860::1"); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"93.184.216.34":    false,
+		"93.184.217.1":     true,
+		"2001:4860::1":     false,
+		"2001:4860::2":     true,
+		"10.0.0.1":         false,
+		"169.254.169.254":  false,
+		"::ffff:127.0.0.1": false,
+	}
+	for ip, allowed := range tests {
+		if c.ssrfGuard.Allows(net.ParseIP(ip)) != allowed {
+			t.Errorf("Allows(%s) != %v", ip, allowed)
+		}
+	}
+	if err := c.Visit("http://93.184.216.34/"); err != ErrBlockedAddress {
+		t.Errorf("Expected ErrBlockedAddress, got %v", err)
+	}
+	if err := c.DisallowedNetworks("300.0.0.0/8"); err == nil {
+		t.Error("Invalid network was accepted")
+	}
+
+	// networks are added to the existing guard
+	g, err := NewSSRFGuard("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewCollector()
+	c.SetSSRFGuard(g)
+	if err := c.DisallowedNetworks("203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.ssrfGuard.Allows(net.ParseIP("127.0.0.1")) || c.ssrfGuard.Allows(net.ParseIP("203.0.113.7")) {
+		t.Error("Networks of the guard were not preserved")
+	}
+	if len(g.Blocked) != 0 {
+		t.Error("Original guard was modified")
+	}
+
+	// host names are resolved before dialing
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	c = NewCollector()
+	if err := c.DisallowedNetworks(); err != nil {
+		t.Fatal(err)
+	}
+	var visitErr error
+	c.OnError(func(r *Response, err error) {
+		visitErr = err
+	})
+	c.Visit(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1))
+	if visitErr == nil || !strings.Contains(visitErr.Error(), ErrBlockedAddress.Error()) {
+		t.Errorf("Expected blocked address error, got %v", visitErr)
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSSRFGuardUnsupportedTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	transport := &countingTransport{}
+	c := NewCollector()
+	c.WithTransport(transport)
+	if err := c.SetSSRFGuard(&SSRFGuard{}); err != ErrUnguardedTransport {
+		t.Errorf("Expected ErrUnguardedTransport, got %v", err)
+	}
+	if err := c.Visit("http://93.184.216.34/"); err != ErrUnguardedTransport {
+		t.Errorf("Expected ErrUnguardedTransport, got %v", err)
+	}
+	if transport.requests != 0 {
+		t.Error("Request was sent by an unguarded transport")
+	}
+
+	// the guard is installed in the replaced transports
+	g, err := NewSSRFGuard("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewCollector(AllowURLRevisit())
+	if err := c.SetSSRFGuard(g); err != nil {
+		t.Fatal(err)
+	}
+	c.WithTransport(transport)
+	if err := c.Visit(ts.URL); err != ErrUnguardedTransport {
+		t.Errorf("Expected ErrUnguardedTransport, got %v", err)
+	}
+	c.WithTransport(&http.Transport{})
+	if err := c.Visit(ts.URL); err != nil {
+		t.Errorf("Request of a guarded transport failed: %v", err)
+	}
+	c.SetSSRFGuard(&SSRFGuard{})
+	c.WithTransport(&http.Transport{})
+	if err := c.Visit(ts.URL); err == nil || !strings.Contains(err.Error(), ErrBlockedAddress.Error()) {
+		t.Errorf("Expected blocked address, got %v", err)
+	}
+
+	// the connections of scheme handlers can not be guarded
+	c.RegisterScheme("custom", SchemeHandlerFunc(func(req *http.Request) (*http.Response, error) {
+		t.Error("Request of a scheme handler was sent")
+		return nil, ErrNoResponse
+	}))
+	if err := c.Visit("custom://example.com/"); err != ErrUnguardedTransport {
+		t.Errorf("Expected ErrUnguardedTransport, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of a Collector
+type Stats struct {
+	// Requests is the number of sent requests
+	Requests int
+	// Responses is the number of received responses, including the
+	// responses with error status codes
+	Responses int
+	// Errors is the number of errors passed to OnError callbacks
+	Errors int
+	// StatusCodes contains the number of responses by status code
+	StatusCodes map[int]int
+	// Bytes is the size of the downloaded response bodies
+	Bytes int64
+	// QueueDepth is the number of asynchronous requests waiting for the
+	// LimitRules of their domains
+	QueueDepth int
+	// Active is the number of requests in progress, including the
+	// processing of their responses
+	Active int
+	// Goroutines is the number of goroutines of the process
+	Goroutines int
+	// Tags contains the statistics of the requests by their tags
+	Tags map[string]TagStats
+	// Hosts contains the health of the requested hosts by host name.
+	// It is shared by the clones of the Collector.
+	Hosts map[string]HostHealth
+}
+
+// TagStats contains the statistics of the requests having a tag.
+// Requests are tagged by setting Request.Tags in OnRequest callbacks.
+type TagStats struct {
+	// Requests is the number of sent requests
+	Requests int
+	// Errors is the number of errors passed to OnError callbacks
+	Errors int
+	// Bytes is the size of the downloaded response bodies
+	Bytes int64
+	// Latency is the average time of the round trips
+	Latency time.Duration
+}
+
+type tagCounters struct {
+	requests     int
+	errors       int
+	bytes        int64
+	latencyTotal time.Duration
+	latencyCount int
+}
+
+// statsCounter collects the statistics of a Collector
+type statsCounter struct {
+	lock        sync.Mutex
+	requests    int
+	responses   int
+	errors      int
+	statusCodes map[int]int
+	bytes       int64
+	active      int32
+	tags        map[string]*tagCounters
+}
+
+// Stats returns a snapshot of the statistics of the Collector. It is
+// safe to call while the Collector is running.
+func (c *Collector) Stats() Stats {
+	st := c.stats.snapshot()
+	st.QueueDepth = c.backend.frontier.queueDepth()
+	st.Goroutines = runtime.NumGoroutine()
+	st.Hosts = c.backend.health.snapshot()
+	return st
+}
+
+func (s *statsCounter) snapshot() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st := Stats{
+		Requests:    s.requests,
+		Responses:   s.responses,
+		Errors:      s.errors,
+		StatusCodes: make(map[int]int, len(s.statusCodes)),
+		Bytes:       s.bytes,
+		Active:      int(atomic.LoadInt32(&s.active)),
+		Tags:        make(map[string]TagStats, len(s.tags)),
+	}
+	for code, n := range s.statusCodes {
+		st.StatusCodes[code] = n
+	}
+	for tag, t := range s.tags {
+		ts := TagStats{
+			Requests: t.requests,
+			Errors:   t.errors,
+			Bytes:    t.bytes,
+		}
+		if t.latencyCount > 0 {
+			ts.Latency = t.latencyTotal / time.Duration(t.latencyCount)
+		}
+		st.Tags[tag] = ts
+	}
+	return st
+}
+
+// tag calls f with the counters of every tag. s.lock must be held.
+func (s *statsCounter) tag(tags []string, f func(*tagCounters)) {
+	if s.tags == nil {
+		s.tags = make(map[string]*tagCounters)
+	}
+	for _, tag := range tags {
+		t, ok := s.tags[tag]
+		if !ok {
+			t = &tagCounters{}
+			s.tags[tag] = t
+		}
+		f(t)
+	}
+}
+
+func (s *statsCounter) request(r *Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests++
+	s.tag(r.Tags, func(t *tagCounters) {
+		t.requests++
+	})
+}
+
+// response records a round trip. res is nil if it failed.
+func (s *statsCounter) response(r *Request, res *Response, latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	size := 0
+	if res != nil {
+		size = len(res.Body)
+		s.responses++
+		s.bytes += int64(size)
+		if s.statusCodes == nil {
+			s.statusCodes = make(map[int]int)
+		}
+		s.statusCodes[res.StatusCode]++
+	}
+	s.tag(r.Tags, func(t *tagCounters) {
+		t.bytes += int64(size)
+		t.latencyTotal += latency
+		t.latencyCount++
+	})
+}
+
+func (s *statsCounter) error(r *Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.errors++
+	s.tag(r.Tags, func(t *tagCounters) {
+		t.errors++
+	})
+}
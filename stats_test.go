@@ -0,0 +1,80 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagStats(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := NewCollector()
+	c.OnRequest(func(r *Request) {
+		if strings.HasPrefix(r.URL.Path, "/html") {
+			r.Tags = []string{"pages", "html"}
+		} else {
+			r.Tags = []string{"pages"}
+		}
+	})
+	c.Visit(ts.URL + "/html")
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/500")
+
+	stats := c.Stats()
+	pages, html := stats.Tags["pages"], stats.Tags["html"]
+	if pages.Requests != 3 || pages.Errors != 1 {
+		t.Errorf("Unexpected pages stats: %+v", pages)
+	}
+	if html.Requests != 1 || html.Errors != 0 || html.Bytes == 0 {
+		t.Errorf("Unexpected html stats: %+v", html)
+	}
+	if pages.Bytes <= html.Bytes || pages.Latency <= 0 {
+		t.Errorf("Unexpected pages stats: %+v", pages)
+	}
+	if _, ok := stats.Tags["other"]; ok {
+		t.Error("Unused tag in stats")
+	}
+}
+
+func TestStats(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	c := NewCollector(Async(true))
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 1})
+	c.OnRequest(func(r *Request) {
+		if st := c.Stats(); st.Active == 0 {
+			t.Error("Active request is not counted")
+		}
+	})
+	c.Visit(ts.URL + "/html")
+	c.Visit(ts.URL + "/")
+	c.Visit(ts.URL + "/500")
+	c.Wait()
+
+	st := c.Stats()
+	if st.Requests != 3 || st.Responses != 3 || st.Errors != 1 {
+		t.Errorf("Unexpected counts: %+v", st)
+	}
+	if st.StatusCodes[200] != 2 || st.StatusCodes[500] != 1 {
+		t.Errorf("Unexpected status codes: %v", st.StatusCodes)
+	}
+	if st.Bytes == 0 || st.Active != 0 || st.QueueDepth != 0 || st.Goroutines == 0 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+}
@@ -15,11 +15,13 @@
 package storage
 
 import (
+	"math/bits"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Storage is an interface which handles Collector's internal data,
@@ -41,13 +43,92 @@ type Storage interface {
 	SetCookies(u *url.URL, cookies string)
 }
 
+// FingerprintStorage is an optional interface of storages which can keep
+// the content fingerprints of the responses to detect duplicate pages
+type FingerprintStorage interface {
+	// AddFingerprint stores the content fingerprint of a URL unless a
+	// fingerprint differing at most in maxDistance bits is already stored.
+	// It returns the URL of the stored similar fingerprint or an empty
+	// string if the fingerprint was added.
+	AddFingerprint(fingerprint uint64, maxDistance int, URL string) (string, error)
+}
+
+// Robots is a robots.txt file kept by a RobotsStorage
+type Robots struct {
+	// StatusCode is the status code of the robots.txt response
+	StatusCode int
+	// Body is the content of the robots.txt file
+	Body []byte
+	// Fetched is the time when the file was downloaded or revalidated
+	Fetched time.Time
+	// ETag and LastModified are the validators of the response used to
+	// revalidate the expired file by a conditional request
+	ETag         string
+	LastModified string
+}
+
+// RobotsStorage is an optional interface of storages which can keep the
+// robots.txt files of the hosts. Collectors using the same RobotsStorage
+// share the robots.txt files.
+type RobotsStorage interface {
+	// GetRobots returns the robots.txt of a host or nil if it is not
+	// stored
+	GetRobots(host string) (*Robots, error)
+	// SetRobots stores the robots.txt of a host
+	SetRobots(host string, r *Robots) error
+}
+
+// ErrorHistory contains the past failures of a URL
+type ErrorHistory struct {
+	// Counts contains the number of failures by error class,
+	// e.g. "404" or "timeout"
+	Counts map[string]int
+	// LastClass is the class of the last failure
+	LastClass string
+	// LastAttempt is the time of the last failure
+	LastAttempt time.Time
+}
+
+// ErrorHistoryStorage is an optional interface of storages which can keep
+// the failures of the URLs across crawls
+type ErrorHistoryStorage interface {
+	// AddError records a failure of a URL
+	AddError(URL, class string, t time.Time) error
+	// GetErrorHistory returns the failures of a URL or nil if it has
+	// not failed
+	GetErrorHistory(URL string) (*ErrorHistory, error)
+	// ClearErrorHistory removes the failures of a URL
+	ClearErrorHistory(URL string) error
+}
+
+// UnvisitStorage is an optional interface of storages which can remove
+// visited request IDs, e.g. of the responses marked as failed
+type UnvisitStorage interface {
+	// Unvisit removes a visited request ID
+	Unvisit(requestID uint64) error
+}
+
+// ContentHashStorage is an optional interface of storages which can keep
+// the content hashes of the watched URLs to detect their changes
+type ContentHashStorage interface {
+	// GetContentHash returns the content hash of a URL or an empty
+	// string if it is not stored
+	GetContentHash(URL string) (string, error)
+	// SetContentHash stores the content hash of a URL
+	SetContentHash(URL, hash string) error
+}
+
 // InMemoryStorage is the default storage backend of colly.
 // InMemoryStorage keeps cookies and visited urls in memory
 // without persisting data on the disk.
 type InMemoryStorage struct {
-	visitedURLs map[uint64]bool
-	lock        *sync.RWMutex
-	jar         *cookiejar.Jar
+	visitedURLs  map[uint64]bool
+	fingerprints map[uint64]string
+	robots       map[string]*Robots
+	errors       map[string]*ErrorHistory
+	hashes       map[string]string
+	lock         *sync.RWMutex
+	jar          *cookiejar.Jar
 }
 
 // Init initializes InMemoryStorage
@@ -55,6 +136,18 @@ func (s *InMemoryStorage) Init() error {
 	if s.visitedURLs == nil {
 		s.visitedURLs = make(map[uint64]bool)
 	}
+	if s.fingerprints == nil {
+		s.fingerprints = make(map[uint64]string)
+	}
+	if s.robots == nil {
+		s.robots = make(map[string]*Robots)
+	}
+	if s.errors == nil {
+		s.errors = make(map[string]*ErrorHistory)
+	}
+	if s.hashes == nil {
+		s.hashes = make(map[string]string)
+	}
 	if s.lock == nil {
 		s.lock = &sync.RWMutex{}
 	}
@@ -74,6 +167,14 @@ func (s *InMemoryStorage) Visited(requestID uint64) error {
 	return nil
 }
 
+// Unvisit implements UnvisitStorage.Unvisit()
+func (s *InMemoryStorage) Unvisit(requestID uint64) error {
+	s.lock.Lock()
+	delete(s.visitedURLs, requestID)
+	s.lock.Unlock()
+	return nil
+}
+
 // IsVisited implements Storage.IsVisited()
 func (s *InMemoryStorage) IsVisited(requestID uint64) (bool, error) {
 	s.lock.RLock()
@@ -82,6 +183,96 @@ func (s *InMemoryStorage) IsVisited(requestID uint64) (bool, error) {
 	return visited, nil
 }
 
+// AddFingerprint implements FingerprintStorage.AddFingerprint()
+func (s *InMemoryStorage) AddFingerprint(fingerprint uint64, maxDistance int, URL string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if u, ok := s.fingerprints[fingerprint]; ok {
+		return u, nil
+	}
+	if maxDistance > 0 {
+		for f, u := range s.fingerprints {
+			if bits.OnesCount64(f^fingerprint) <= maxDistance {
+				return u, nil
+			}
+		}
+	}
+	s.fingerprints[fingerprint] = URL
+	return "", nil
+}
+
+// GetRobots implements RobotsStorage.GetRobots()
+func (s *InMemoryStorage) GetRobots(host string) (*Robots, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.robots[host], nil
+}
+
+// SetRobots implements RobotsStorage.SetRobots()
+func (s *InMemoryStorage) SetRobots(host string, r *Robots) error {
+	s.lock.Lock()
+	s.robots[host] = r
+	s.lock.Unlock()
+	return nil
+}
+
+// GetContentHash implements ContentHashStorage.GetContentHash()
+func (s *InMemoryStorage) GetContentHash(URL string) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.hashes[URL], nil
+}
+
+// SetContentHash implements ContentHashStorage.SetContentHash()
+func (s *InMemoryStorage) SetContentHash(URL, hash string) error {
+	s.lock.Lock()
+	s.hashes[URL] = hash
+	s.lock.Unlock()
+	return nil
+}
+
+// AddError implements ErrorHistoryStorage.AddError()
+func (s *InMemoryStorage) AddError(URL, class string, t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, ok := s.errors[URL]
+	if !ok {
+		h = &ErrorHistory{Counts: make(map[string]int)}
+		s.errors[URL] = h
+	}
+	h.Counts[class]++
+	h.LastClass = class
+	h.LastAttempt = t
+	return nil
+}
+
+// GetErrorHistory implements ErrorHistoryStorage.GetErrorHistory()
+func (s *InMemoryStorage) GetErrorHistory(URL string) (*ErrorHistory, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	h, ok := s.errors[URL]
+	if !ok {
+		return nil, nil
+	}
+	c := &ErrorHistory{
+		Counts:      make(map[string]int, len(h.Counts)),
+		LastClass:   h.LastClass,
+		LastAttempt: h.LastAttempt,
+	}
+	for k, v := range h.Counts {
+		c.Counts[k] = v
+	}
+	return c, nil
+}
+
+// ClearErrorHistory implements ErrorHistoryStorage.ClearErrorHistory()
+func (s *InMemoryStorage) ClearErrorHistory(URL string) error {
+	s.lock.Lock()
+	delete(s.errors, URL)
+	s.lock.Unlock()
+	return nil
+}
+
 // Cookies implements Storage.Cookies()
 func (s *InMemoryStorage) Cookies(u *url.URL) string {
 	return StringifyCookies(s.jar.Cookies(u))
@@ -0,0 +1,126 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderError is the error of a request header which can not be sent
+// safely, e.g. because its value contains a line break
+type HeaderError struct {
+	// Name is the name of the header
+	Name string
+	// Reason describes the problem of the header
+	Reason string
+}
+
+// Error implements error
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("Invalid request header %q: %s", e.Name, e.Reason)
+}
+
+// StrictHeaders enables the strict header mode of the Collector. See
+// Collector.StrictHeaders.
+func StrictHeaders() CollectorOption {
+	return func(c *Collector) {
+		c.StrictHeaders = true
+	}
+}
+
+// validHeaderName returns true if the name is a HTTP token (RFC 7230)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue returns true if the value contains no control
+// characters other than horizontal tabs
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHeaders returns an error if a header would break the request
+// line structure, e.g. by injecting line breaks
+func checkHeaders(h http.Header) error {
+	for name, values := range h {
+		if !validHeaderName(name) {
+			return &HeaderError{Name: name, Reason: "invalid header name"}
+		}
+		for _, v := range values {
+			if !validHeaderValue(v) {
+				return &HeaderError{Name: name, Reason: "control character in header value"}
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeHeaders validates and normalizes the headers of a request in
+// strict header mode. Header names are canonicalized, values are trimmed
+// and the headers which make the framing of the request ambiguous are
+// rejected.
+func normalizeHeaders(req *http.Request) error {
+	if err := checkHeaders(req.Header); err != nil {
+		return err
+	}
+	normalized := make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		k := http.CanonicalHeaderKey(name)
+		for _, v := range values {
+			normalized[k] = append(normalized[k], strings.Trim(v, " \t"))
+		}
+	}
+	if _, ok := normalized["Transfer-Encoding"]; ok {
+		return &HeaderError{Name: "Transfer-Encoding", Reason: "message framing is set by the client"}
+	}
+	if values, ok := normalized["Content-Length"]; ok {
+		for _, v := range values {
+			if v != values[0] || v == "" || strings.Trim(v, "0123456789") != "" {
+				return &HeaderError{Name: "Content-Length", Reason: "ambiguous content length"}
+			}
+		}
+		if req.ContentLength > 0 && values[0] != fmt.Sprint(req.ContentLength) {
+			return &HeaderError{Name: "Content-Length", Reason: "content length differs from body size"}
+		}
+		delete(normalized, "Content-Length")
+	}
+	if values := normalized["Host"]; len(values) > 1 {
+		return &HeaderError{Name: "Host", Reason: "multiple hosts"}
+	}
+	for k := range req.Header {
+		delete(req.Header, k)
+	}
+	for k, v := range normalized {
+		req.Header[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStrictHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Scraped")))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name, value string
+		err         string
+	}{
+		{"x-scraped", "  value\t", ""},
+		{"X-Scraped", "value\r\nX-Injected: 1", "control character"},
+		{"X-Scraped", "value\nX-Injected: 1", "control character"},
+		{"X-Bad Name", "value", "invalid header name"},
+		{"X-Bad\r\nName", "value", "invalid header name"},
+		{"Transfer-Encoding", "chunked", "message framing"},
+		{"Content-Length", "10, 20", "ambiguous content length"},
+	}
+	for _, tt := range tests {
+		c := NewCollector(StrictHeaders())
+		c.OnRequest(func(r *Request) {
+			(*r.Headers)[tt.name] = []string{tt.value}
+		})
+		var body string
+		c.OnResponse(func(r *Response) {
+			body = string(r.Body)
+		})
+		var errs []error
+		c.OnError(func(r *Response, err error) {
+			errs = append(errs, err)
+		})
+		err := c.Visit(ts.URL)
+		if tt.err == "" {
+			if err != nil || body != "value" {
+				t.Errorf("Invalid response %q of normalized header: %v", body, err)
+			}
+			continue
+		}
+		if _, ok := err.(*HeaderError); !ok || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Invalid error of header %q: %v", tt.name, err)
+		}
+		if len(errs) != 1 {
+			t.Errorf("OnError was not called for header %q", tt.name)
+		}
+	}
+
+	// the header order transport rejects line breaks without strict mode
+	c := NewCollector(UseHeaderProfile(HeaderProfiles["firefox-esr"]))
+	c.OnRequest(func(r *Request) {
+		r.Headers.Set("X-Scraped", "value\r\nX-Injected: 1")
+	})
+	if err := c.Visit(ts.URL); err == nil {
+		t.Error("Header with line break was sent")
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testproxy implements a local forward proxy to inspect and
+// modify the traffic of a Collector without external tools:
+//
+//	p := testproxy.New()
+//	p.Logger = log.New(os.Stderr, "proxy ", log.LstdFlags)
+//	p.OnRequest = func(r *http.Request) *http.Response {
+//		r.Header.Set("X-Debug", "1")
+//		return nil
+//	}
+//	if err := p.Attach(c); err != nil {
+//		...
+//	}
+//	defer p.Close()
+//	c.Visit("http://example.com/")
+//	for _, ex := range p.Exchanges() {
+//		fmt.Println(ex.Method, ex.URL, ex.RequestHeader, ex.StatusCode)
+//	}
+//
+// Plain HTTP requests are recorded with their headers and bodies and
+// can be modified. HTTPS requests are tunneled by CONNECT, so only the
+// target address and the size of the transferred data are recorded.
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Exchange is a request forwarded by the Proxy
+type Exchange struct {
+	// Method is the method of the request. It is "CONNECT" for tunnels.
+	Method string
+	// URL is the URL of the request or the address of the tunnel
+	URL string
+	// RequestHeader contains the forwarded request headers
+	RequestHeader http.Header
+	// RequestBody is the forwarded request body
+	RequestBody []byte
+	// StatusCode is the status code of the response
+	StatusCode int
+	// ResponseHeader contains the returned response headers
+	ResponseHeader http.Header
+	// ResponseBody is the returned response body as sent by the
+	// server, e.g. compressed
+	ResponseBody []byte
+	// Tunnel is true for CONNECT requests
+	Tunnel bool
+	// BytesSent is the number of the bytes sent through the tunnel
+	BytesSent int64
+	// BytesReceived is the number of the bytes received through the
+	// tunnel
+	BytesReceived int64
+	// Started is the time when the request was received
+	Started time.Time
+	// Duration is the time of the exchange or of the tunnel
+	Duration time.Duration
+	// Err is the error of the forwarding if any
+	Err error
+}
+
+// Proxy is a forward proxy recording the exchanges passing through it
+type Proxy struct {
+	// OnRequest is called with the plain HTTP requests before they are
+	// forwarded and it can modify them. If it returns a response, the
+	// response is returned without forwarding the request.
+	OnRequest func(r *http.Request) *http.Response
+	// OnResponse is called with the responses of the plain HTTP
+	// requests and it can modify them, including their bodies
+	OnResponse func(r *http.Response)
+	// OnExchange is called after every exchange
+	OnExchange func(ex *Exchange)
+	// Logger logs the exchanges if it is set
+	Logger *log.Logger
+	// Transport forwards the plain HTTP requests. A transport without
+	// proxy and compression is used if it is nil.
+	Transport http.RoundTripper
+	// Dialer opens the tunnels. A dialer with 30 seconds timeout is used
+	// if it is nil.
+	Dialer    *net.Dialer
+	lock      sync.Mutex
+	exchanges []*Exchange
+	listener  net.Listener
+	server    *http.Server
+}
+
+// hopHeaders are the hop-by-hop headers which are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// New creates a Proxy
+func New() *Proxy {
+	return &Proxy{}
+}
+
+// Start starts the proxy on a random local port
+func (p *Proxy) Start() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.listener != nil {
+		return nil
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	p.listener = l
+	p.server = &http.Server{Handler: p}
+	go p.server.Serve(l)
+	return nil
+}
+
+// URL returns the URL of the started proxy or an empty string
+func (p *Proxy) URL() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.listener == nil {
+		return ""
+	}
+	return "http://" + p.listener.Addr().String()
+}
+
+// Attach starts the proxy if it is not running and routes the requests
+// of the Collector through it
+func (p *Proxy) Attach(c *colly.Collector) error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	return c.SetProxy(p.URL())
+}
+
+// Close stops the proxy
+func (p *Proxy) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.server == nil {
+		return nil
+	}
+	err := p.server.Close()
+	p.server, p.listener = nil, nil
+	return err
+}
+
+// Exchanges returns the recorded exchanges in the order of their
+// completion
+func (p *Proxy) Exchanges() []*Exchange {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*Exchange(nil), p.exchanges...)
+}
+
+// Reset forgets the recorded exchanges
+func (p *Proxy) Reset() {
+	p.lock.Lock()
+	p.exchanges = nil
+	p.lock.Unlock()
+}
+
+// ServeHTTP forwards a proxy request
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ex := &Exchange{
+		Method:        r.Method,
+		URL:           r.URL.String(),
+		RequestHeader: r.Header,
+		Started:       time.Now(),
+	}
+	if r.Method == http.MethodConnect {
+		ex.URL = r.Host
+		ex.Tunnel = true
+		p.tunnel(w, r, ex)
+	} else {
+		p.forward(w, r, ex)
+	}
+	ex.Duration = time.Since(ex.Started)
+	p.record(ex)
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, ex *Exchange) {
+	if !r.URL.IsAbs() {
+		ex.StatusCode = http.StatusBadRequest
+		ex.Err = fmt.Errorf("Request URL is not absolute: %s", r.URL)
+		http.Error(w, ex.Err.Error(), ex.StatusCode)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		ex.StatusCode = http.StatusBadRequest
+		ex.Err = err
+		http.Error(w, err.Error(), ex.StatusCode)
+		return
+	}
+	req, err := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		ex.StatusCode = http.StatusBadRequest
+		ex.Err = err
+		http.Error(w, err.Error(), ex.StatusCode)
+		return
+	}
+	req = req.WithContext(r.Context())
+	req.Host = r.Host
+	req.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	removeHopHeaders(req.Header)
+
+	var res *http.Response
+	if p.OnRequest != nil {
+		res = p.OnRequest(req)
+	}
+	if req.Body != nil {
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			ex.StatusCode = http.StatusBadRequest
+			ex.Err = err
+			http.Error(w, err.Error(), ex.StatusCode)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	ex.Method, ex.URL, ex.RequestHeader, ex.RequestBody = req.Method, req.URL.String(), req.Header, body
+	if res == nil {
+		if res, err = p.transport().RoundTrip(req); err != nil {
+			ex.StatusCode = http.StatusBadGateway
+			ex.Err = err
+			http.Error(w, err.Error(), ex.StatusCode)
+			return
+		}
+	}
+	if res.Body == nil {
+		res.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		ex.StatusCode = http.StatusBadGateway
+		ex.Err = err
+		http.Error(w, err.Error(), ex.StatusCode)
+		return
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+	if p.OnResponse != nil {
+		p.OnResponse(res)
+		resBody, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			ex.StatusCode = http.StatusBadGateway
+			ex.Err = err
+			http.Error(w, err.Error(), ex.StatusCode)
+			return
+		}
+	}
+	removeHopHeaders(res.Header)
+	res.Header.Set("Content-Length", strconv.Itoa(len(resBody)))
+	ex.StatusCode, ex.ResponseHeader, ex.ResponseBody = res.StatusCode, res.Header, resBody
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	w.Write(resBody)
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request, ex *Exchange) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		ex.StatusCode = http.StatusInternalServerError
+		ex.Err = fmt.Errorf("Connection can not be hijacked")
+		http.Error(w, ex.Err.Error(), ex.StatusCode)
+		return
+	}
+	d := p.Dialer
+	if d == nil {
+		d = &net.Dialer{Timeout: 30 * time.Second}
+	}
+	target, err := d.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		ex.StatusCode = http.StatusBadGateway
+		ex.Err = err
+		http.Error(w, err.Error(), ex.StatusCode)
+		return
+	}
+	defer target.Close()
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		ex.StatusCode = http.StatusInternalServerError
+		ex.Err = err
+		return
+	}
+	defer conn.Close()
+	ex.StatusCode = http.StatusOK
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		ex.Err = err
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		// buf contains the data read by the server before hijacking
+		ex.BytesSent, _ = io.Copy(target, buf)
+		if c, ok := target.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		close(done)
+	}()
+	ex.BytesReceived, _ = io.Copy(conn, target)
+	conn.Close()
+	<-done
+}
+
+func (p *Proxy) transport() http.RoundTripper {
+	if p.Transport != nil {
+		return p.Transport
+	}
+	return defaultTransport
+}
+
+// defaultTransport forwards the requests as they are received
+var defaultTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:       100,
+	IdleConnTimeout:    90 * time.Second,
+	DisableCompression: true,
+}
+
+func (p *Proxy) record(ex *Exchange) {
+	p.lock.Lock()
+	p.exchanges = append(p.exchanges, ex)
+	p.lock.Unlock()
+	if p.Logger != nil {
+		if ex.Tunnel {
+			p.Logger.Printf("CONNECT %s %d sent=%dB received=%dB %v", ex.URL, ex.StatusCode, ex.BytesSent, ex.BytesReceived, ex.Duration)
+		} else {
+			p.Logger.Printf("%s %s %d %dB %v", ex.Method, ex.URL, ex.StatusCode, len(ex.ResponseBody), ex.Duration)
+		}
+		if ex.Err != nil {
+			p.Logger.Printf("%s %s error: %v", ex.Method, ex.URL, ex.Err)
+		}
+	}
+	if p.OnExchange != nil {
+		p.OnExchange(ex)
+	}
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
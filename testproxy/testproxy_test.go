@@ -0,0 +1,163 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func newServer() *httptest.Server {
+	return httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Server", "test")
+		w.Write([]byte(r.Method + " " + r.Header.Get("X-Injected") + " " + string(body)))
+	}))
+}
+
+func TestProxy(t *testing.T) {
+	ts := newServer()
+	ts.Start()
+	defer ts.Close()
+
+	p := New()
+	var logs bytes.Buffer
+	p.Logger = log.New(&logs, "", 0)
+	p.OnRequest = func(r *http.Request) *http.Response {
+		r.Header.Set("X-Injected", "injected")
+		if strings.HasSuffix(r.URL.Path, "/local") {
+			return &http.Response{StatusCode: http.StatusTeapot, Body: ioutil.NopCloser(strings.NewReader("local"))}
+		}
+		return nil
+	}
+	p.OnResponse = func(r *http.Response) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(append(body, " modified"...)))
+	}
+	var notified int
+	p.OnExchange = func(ex *Exchange) {
+		notified++
+	}
+	c := colly.NewCollector(colly.ParseHTTPErrorResponse())
+	if err := p.Attach(c); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.URL() == "" {
+		t.Fatal("Proxy is not started")
+	}
+
+	bodies := map[string]string{}
+	c.OnResponse(func(r *colly.Response) {
+		bodies[r.Request.URL.Path] = string(r.Body)
+	})
+	c.PostRaw(ts.URL+"/post", []byte("data"))
+	c.Visit(ts.URL + "/local")
+	if bodies["/post"] != "POST injected data modified" || bodies["/local"] != "local modified" {
+		t.Errorf("Unexpected bodies: %q", bodies)
+	}
+
+	exs := p.Exchanges()
+	if len(exs) != 2 || notified != 2 {
+		t.Fatalf("Invalid number of exchanges: %d, notified: %d", len(exs), notified)
+	}
+	ex := exs[0]
+	if ex.Method != "POST" || ex.URL != ts.URL+"/post" || ex.StatusCode != 200 || string(ex.RequestBody) != "data" {
+		t.Errorf("Invalid exchange: %+v", ex)
+	}
+	if ex.RequestHeader.Get("User-Agent") != c.UserAgent || ex.RequestHeader.Get("X-Injected") != "injected" || ex.RequestHeader.Get("Proxy-Connection") != "" {
+		t.Errorf("Invalid request headers: %v", ex.RequestHeader)
+	}
+	if ex.ResponseHeader.Get("X-Server") != "test" || string(ex.ResponseBody) != "POST injected data modified" {
+		t.Errorf("Invalid response: %v %q", ex.ResponseHeader, ex.ResponseBody)
+	}
+	if exs[1].StatusCode != http.StatusTeapot {
+		t.Errorf("Invalid status of the local response: %d", exs[1].StatusCode)
+	}
+	if !strings.Contains(logs.String(), "POST "+ts.URL+"/post 200") {
+		t.Errorf("Exchange was not logged: %q", logs.String())
+	}
+
+	p.Reset()
+	if len(p.Exchanges()) != 0 {
+		t.Error("Exchanges were not reset")
+	}
+}
+
+func TestProxyTunnel(t *testing.T) {
+	ts := newServer()
+	ts.StartTLS()
+	defer ts.Close()
+
+	p := New()
+	defer p.Close()
+	// tunnels are recorded when they are closed
+	exchanges := make(chan *Exchange, 1)
+	p.OnExchange = func(ex *Exchange) {
+		exchanges <- ex
+	}
+	c := colly.NewCollector()
+	c.WithTransport(&http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}})
+	if err := p.Attach(c); err != nil {
+		t.Fatal(err)
+	}
+	var body string
+	c.OnResponse(func(r *colly.Response) {
+		body = string(r.Body)
+	})
+	if err := c.Visit(ts.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	// the tunneled requests are not modified
+	if body != "GET  " {
+		t.Errorf("Unexpected body: %q", body)
+	}
+	var ex *Exchange
+	select {
+	case ex = <-exchanges:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Tunnel was not recorded")
+	}
+	if !ex.Tunnel || ex.Method != "CONNECT" || ex.URL != strings.TrimPrefix(ts.URL, "https://") || ex.StatusCode != 200 {
+		t.Errorf("Invalid tunnel: %+v", ex)
+	}
+	if ex.BytesSent == 0 || ex.BytesReceived == 0 {
+		t.Errorf("Tunneled bytes were not counted: %d %d", ex.BytesSent, ex.BytesReceived)
+	}
+}
+
+func TestProxyBadGateway(t *testing.T) {
+	p := New()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	c := colly.NewCollector(colly.ParseHTTPErrorResponse())
+	c.SetProxy(p.URL())
+	c.Visit("http://127.0.0.1:1/")
+	exs := p.Exchanges()
+	if len(exs) != 1 || exs[0].StatusCode != http.StatusBadGateway || exs[0].Err == nil {
+		t.Errorf("Invalid exchanges: %+v", exs)
+	}
+}
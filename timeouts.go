@@ -0,0 +1,238 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timeouts limit the phases of the requests separately. Unlike the
+// request timeout set by SetRequestTimeout, which limits the whole
+// request, they let hung connections fail fast without killing long
+// downloads. Set the request timeout to 0 to allow downloads of any
+// length. Zero values mean no limit.
+//
+// The timeouts are applied to every transport, including the
+// transports of TLS profiles and the SSRFGuard.
+type Timeouts struct {
+	// Dial limits resolving the host and connecting to it
+	Dial time.Duration
+	// TLSHandshake limits the TLS handshake
+	TLSHandshake time.Duration
+	// ResponseHeader limits the time between sending the request and
+	// receiving the first byte of the response
+	ResponseHeader time.Duration
+	// IdleRead limits the time between receiving two parts of the
+	// response body
+	IdleRead time.Duration
+}
+
+// DialTimeout limits resolving the host and connecting to it. See
+// Timeouts.
+func DialTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.backend.updateTimeouts(func(t *Timeouts) { t.Dial = d })
+	}
+}
+
+// TLSHandshakeTimeout limits the TLS handshakes. See Timeouts.
+func TLSHandshakeTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.backend.updateTimeouts(func(t *Timeouts) { t.TLSHandshake = d })
+	}
+}
+
+// ResponseHeaderTimeout limits waiting for the response headers after
+// sending the requests. See Timeouts.
+func ResponseHeaderTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.backend.updateTimeouts(func(t *Timeouts) { t.ResponseHeader = d })
+	}
+}
+
+// IdleReadTimeout limits the time without receiving data while reading
+// the response bodies. See Timeouts.
+func IdleReadTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.backend.updateTimeouts(func(t *Timeouts) { t.IdleRead = d })
+	}
+}
+
+// SetTimeouts sets the phase timeouts of the requests
+func (c *Collector) SetTimeouts(t Timeouts) {
+	c.backend.updateTimeouts(func(old *Timeouts) { *old = t })
+}
+
+// Timeouts returns the phase timeouts of the requests
+func (c *Collector) Timeouts() Timeouts {
+	c.backend.lock.RLock()
+	defer c.backend.lock.RUnlock()
+	return c.backend.timeouts
+}
+
+func (h *httpBackend) updateTimeouts(f func(*Timeouts)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	f(&h.timeouts)
+}
+
+// phaseTimer cancels a request if one of its phases exceeds its timeout
+type phaseTimer struct {
+	timeouts Timeouts
+	cancel   context.CancelFunc
+	lock     sync.Mutex
+	timer    *time.Timer
+	phase    error
+	expired  error
+}
+
+// withPhaseTimeouts returns the request with a context which is
+// canceled by the phase timeouts. The returned phaseTimer must be
+// stopped after reading the response body.
+func (h *httpBackend) withPhaseTimeouts(req *http.Request) (*http.Request, *phaseTimer) {
+	h.lock.RLock()
+	timeouts := h.timeouts
+	h.lock.RUnlock()
+	if timeouts == (Timeouts{}) {
+		return req, nil
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	p := &phaseTimer{timeouts: timeouts, cancel: cancel}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.start(timeouts.Dial, ErrDialTimeout, false)
+		},
+		ConnectStart: func(network, addr string) {
+			// parallel dials and the dials after the DNS lookup are
+			// limited by the same timer
+			p.start(timeouts.Dial, ErrDialTimeout, false)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				p.stop(ErrDialTimeout)
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.start(timeouts.TLSHandshake, ErrTLSHandshakeTimeout, true)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.stop(ErrTLSHandshakeTimeout)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.start(timeouts.ResponseHeader, ErrResponseHeaderTimeout, true)
+		},
+		GotFirstResponseByte: func() {
+			p.stop(ErrResponseHeaderTimeout)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace)), p
+}
+
+// start starts the timer of a phase. The running timer of the same
+// phase is restarted only if restart is true.
+func (p *phaseTimer) start(d time.Duration, phase error, restart bool) {
+	if d <= 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.expired != nil || (p.phase == phase && p.timer != nil && !restart) {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		p.lock.Lock()
+		if p.timer != t {
+			// the phase was stopped or restarted meanwhile
+			p.lock.Unlock()
+			return
+		}
+		p.expired = phase
+		p.lock.Unlock()
+		p.cancel()
+	})
+	p.phase = phase
+	p.timer = t
+}
+
+// stop stops the timer of a phase
+func (p *phaseTimer) stop(phase error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.phase == phase && p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+		p.phase = nil
+	}
+}
+
+// err returns the error of the expired phase or err
+func (p *phaseTimer) err(err error) error {
+	if p == nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.expired != nil {
+		return p.expired
+	}
+	return err
+}
+
+// close stops the timers and releases the context of the request
+func (p *phaseTimer) close() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.lock.Unlock()
+	p.cancel()
+}
+
+// body returns a reader of the response body limited by the idle read
+// timeout
+func (p *phaseTimer) body(r io.Reader) io.Reader {
+	if p == nil || p.timeouts.IdleRead <= 0 {
+		return r
+	}
+	return &idleReader{r: r, p: p}
+}
+
+type idleReader struct {
+	r io.Reader
+	p *phaseTimer
+}
+
+func (r *idleReader) Read(b []byte) (int, error) {
+	r.p.start(r.p.timeouts.IdleRead, ErrIdleReadTimeout, true)
+	n, err := r.r.Read(b)
+	r.p.stop(ErrIdleReadTimeout)
+	if err != nil && err != io.EOF {
+		err = r.p.err(err)
+	}
+	return n, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTimeoutServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow_headers", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/stalled", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("start"))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("end"))
+	})
+	mux.HandleFunc("/trickle", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 8; i++ {
+			w.Write([]byte("."))
+			w.(http.Flusher).Flush()
+			time.Sleep(25 * time.Millisecond)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestPhaseTimeouts(t *testing.T) {
+	ts := newTimeoutServer()
+	defer ts.Close()
+
+	c := NewCollector(
+		ResponseHeaderTimeout(50*time.Millisecond),
+		IdleReadTimeout(100*time.Millisecond),
+	)
+	// the downloads are limited by the phase timeouts only
+	c.SetRequestTimeout(0)
+	if err := c.Visit(ts.URL + "/slow_headers"); err != ErrResponseHeaderTimeout {
+		t.Errorf("Expected ErrResponseHeaderTimeout, got %v", err)
+	}
+	if err := c.Visit(ts.URL + "/stalled"); err != ErrIdleReadTimeout {
+		t.Errorf("Expected ErrIdleReadTimeout, got %v", err)
+	}
+	var body string
+	c.OnResponse(func(r *Response) {
+		body = string(r.Body)
+	})
+	if err := c.Visit(ts.URL + "/trickle"); err != nil {
+		t.Errorf("Slow download was aborted: %v", err)
+	}
+	if body != "........" {
+		t.Errorf("Invalid body: %q", body)
+	}
+
+	c.SetTimeouts(Timeouts{})
+	if err := c.Revisit(ts.URL + "/stalled"); err != nil {
+		t.Error(err)
+	}
+	if c.Timeouts() != (Timeouts{}) {
+		t.Error("Timeouts were not reset")
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// the listener accepts the connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := NewCollector(TLSHandshakeTimeout(50 * time.Millisecond))
+	start := time.Now()
+	if err := c.Visit("https://" + ln.Addr().String() + "/"); err != ErrTLSHandshakeTimeout {
+		t.Errorf("Expected ErrTLSHandshakeTimeout, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("TLS handshake timeout was not applied: %v", d)
+	}
+}
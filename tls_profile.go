@@ -0,0 +1,227 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// TLSProfile configures the TLS handshakes with the hosts of a domain.
+// The profile is applied on top of the TLS configuration of the
+// transport of the Collector.
+type TLSProfile struct {
+	// ServerName is sent as SNI instead of the host name of the URL.
+	// The certificate of the server is verified against ServerName.
+	ServerName string
+	// NextProtos is the list of ALPN protocols in order of preference,
+	// e.g. []string{"h2", "http/1.1"}. HTTP/2 is used only if it
+	// contains "h2".
+	NextProtos []string
+	// ECHConfigList is the Encrypted ClientHello configuration list of
+	// the server, e.g. from its HTTPS DNS record. The handshake fails
+	// if the server does not accept ECH. ECH requires Go 1.23.
+	ECHConfigList []byte
+	// MinVersion and MaxVersion restrict the TLS versions, e.g.
+	// tls.VersionTLS12
+	MinVersion uint16
+	MaxVersion uint16
+	// CipherSuites restricts the TLS 1.0-1.2 cipher suites
+	CipherSuites []uint16
+}
+
+// config applies the profile to a copy of the TLS configuration
+func (p *TLSProfile) config(base *tls.Config) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if p.ServerName != "" {
+		cfg.ServerName = p.ServerName
+	}
+	if p.NextProtos != nil {
+		cfg.NextProtos = append([]string(nil), p.NextProtos...)
+	}
+	if p.MinVersion != 0 {
+		cfg.MinVersion = p.MinVersion
+	}
+	if p.MaxVersion != 0 {
+		cfg.MaxVersion = p.MaxVersion
+	}
+	if p.CipherSuites != nil {
+		cfg.CipherSuites = p.CipherSuites
+	}
+	if len(p.ECHConfigList) > 0 {
+		if err := setECHConfigList(cfg, p.ECHConfigList); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// SetTLSProfile sets the TLS profile of a domain. Subdomains are matched
+// by a leading "*.", e.g. "*.example.com". The profile of the empty
+// domain is used for every domain without profile. Passing nil removes
+// the profile of the domain.
+//
+// The profiles are applied if the transport of the Collector is a
+// http.Transport or a HeaderOrderTransport wrapping one. Requests sent
+// by other transports fail with ErrTLSProfileUnsupported.
+func (c *Collector) SetTLSProfile(domain string, p *TLSProfile) {
+	c.backend.SetTLSProfile(domain, p)
+}
+
+// SetTLSProfile sets the TLS profile of a domain
+func (h *httpBackend) SetTLSProfile(domain string, p *TLSProfile) {
+	domain = strings.ToLower(domain)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if p == nil {
+		delete(h.tlsProfiles, domain)
+		return
+	}
+	if h.tlsProfiles == nil {
+		h.tlsProfiles = make(map[string]*TLSProfile)
+	}
+	h.tlsProfiles[domain] = p
+	// the transports of the replaced profile are created again
+	h.tlsTransports = nil
+}
+
+// tlsProfile returns the TLS profile of a host or nil
+func (h *httpBackend) tlsProfile(host string) *TLSProfile {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.tlsProfiles) == 0 {
+		return nil
+	}
+	for _, d := range domainKeys(host) {
+		if p, ok := h.tlsProfiles[d]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// tlsTransportKey identifies the transport of a profile created from
+// a base transport
+type tlsTransportKey struct {
+	profile *TLSProfile
+	base    http.RoundTripper
+}
+
+// tlsProfileTransport sends the requests by the transport of the TLS
+// profile of their host
+type tlsProfileTransport struct {
+	backend *httpBackend
+	base    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tlsProfileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	p := t.backend.tlsProfile(req.URL.Hostname())
+	if p == nil || req.URL.Scheme != "https" {
+		return base.RoundTrip(req)
+	}
+	transport, err := t.backend.tlsTransport(p, base)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// tlsTransport returns the cached transport of a profile
+func (h *httpBackend) tlsTransport(p *TLSProfile, base http.RoundTripper) (http.RoundTripper, error) {
+	key := tlsTransportKey{p, base}
+	h.lock.RLock()
+	transport, ok := h.tlsTransports[key]
+	h.lock.RUnlock()
+	if ok {
+		return transport, nil
+	}
+	transport, err := profileTransport(p, base)
+	if err != nil {
+		return nil, err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.tlsTransports == nil {
+		h.tlsTransports = make(map[tlsTransportKey]http.RoundTripper)
+	}
+	if t, ok := h.tlsTransports[key]; ok {
+		return t, nil
+	}
+	h.tlsTransports[key] = transport
+	return transport, nil
+}
+
+// profileTransport creates a copy of the base transport using the TLS
+// profile
+func profileTransport(p *TLSProfile, base http.RoundTripper) (http.RoundTripper, error) {
+	switch t := base.(type) {
+	case *HeaderOrderTransport:
+		cfg, err := p.config(t.TLSClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		inner := t.Transport
+		if inner == nil {
+			inner = http.DefaultTransport
+		}
+		if inner, err = profileTransport(p, inner); err != nil {
+			return nil, err
+		}
+		return &HeaderOrderTransport{Transport: inner, TLSClientConfig: cfg, Dialer: t.Dialer}, nil
+	case *http.Transport:
+		cfg, err := p.config(t.TLSClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		pt := &http.Transport{
+			Proxy:                  t.Proxy,
+			DialContext:            t.DialContext,
+			Dial:                   t.Dial,
+			TLSClientConfig:        cfg,
+			TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+			DisableKeepAlives:      t.DisableKeepAlives,
+			DisableCompression:     t.DisableCompression,
+			MaxIdleConns:           t.MaxIdleConns,
+			MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+			MaxConnsPerHost:        t.MaxConnsPerHost,
+			IdleConnTimeout:        t.IdleConnTimeout,
+			ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+			ExpectContinueTimeout:  t.ExpectContinueTimeout,
+			ProxyConnectHeader:     t.ProxyConnectHeader,
+			MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+		}
+		for _, proto := range cfg.NextProtos {
+			if proto == "h2" {
+				if err := http2.ConfigureTransport(pt); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		return pt, nil
+	}
+	return nil, ErrTLSProfileUnsupported
+}
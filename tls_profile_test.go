@@ -0,0 +1,68 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSProfile(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName + " " + r.Proto))
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	c := NewCollector(AllowURLRevisit())
+	c.WithTransport(&http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}})
+	var body string
+	c.OnResponse(func(r *Response) {
+		body = string(r.Body)
+	})
+	c.OnError(func(r *Response, err error) {
+		t.Error(err)
+	})
+
+	c.Visit(ts.URL)
+	if body != " HTTP/1.1" {
+		t.Errorf("Invalid response without profile %q", body)
+	}
+
+	c.SetTLSProfile("127.0.0.1", &TLSProfile{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}})
+	c.Visit(ts.URL)
+	if body != "example.com HTTP/2.0" {
+		t.Errorf("Invalid response with profile %q", body)
+	}
+
+	c.SetTLSProfile("127.0.0.1", &TLSProfile{ServerName: "www.example.com", NextProtos: []string{"http/1.1"}})
+	c.Visit(ts.URL)
+	if body != "www.example.com HTTP/1.1" {
+		t.Errorf("Invalid response with replaced profile %q", body)
+	}
+
+	c.SetTLSProfile("127.0.0.1", nil)
+	c.SetTLSProfile("*.0.0.1", &TLSProfile{ServerName: "example.com"})
+	c.Visit(ts.URL)
+	if body != "example.com HTTP/1.1" {
+		t.Errorf("Invalid response with wildcard profile %q", body)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	templateNumber   = "{num}"
+	templateID       = "{id}"
+	templateSlug     = "{slug}"
+	templateWildcard = "{*}"
+)
+
+var (
+	numberSegmentRe = regexp.MustCompile(`^[0-9]+$`)
+	idSegmentRe     = regexp.MustCompile(`^(?:[0-9a-fA-F]{8,}|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+	slugSegmentRe   = regexp.MustCompile(`^[\w.~%]+(?:[-_][\w.~%]+){3,}$`)
+	digitRe         = regexp.MustCompile(`[0-9]`)
+)
+
+// TemplateBinding is a named set of callbacks which are only executed
+// for URLs sharing the template of the example URLs the binding was
+// created with. It allows routing callbacks to page types like
+// "product pages" or "category pages" without hand-written regexes.
+type TemplateBinding struct {
+	// Name is the name of the page type, e.g. "product"
+	Name      string
+	templates [][]string
+	collector *Collector
+	lock      *sync.RWMutex
+}
+
+// URLTemplate returns the structural template of a URL. Path segments
+// which look like identifiers are replaced with placeholders, so
+// "http://example.com/item/1234" and "http://example.com/item/98" share
+// the template "example.com/item/{num}". Query and fragment are ignored.
+func URLTemplate(u *url.URL) string {
+	return strings.Join(templateSegments(u), "/")
+}
+
+// BindTemplate creates a TemplateBinding which matches every URL having
+// the same template as one of the example URLs. If two examples only
+// differ in a single path segment, that segment is treated as a wildcard,
+// so "/category/shoes" and "/category/hats" also match "/category/bags".
+func (c *Collector) BindTemplate(name string, exampleURLs ...string) (*TemplateBinding, error) {
+	t := &TemplateBinding{
+		Name:      name,
+		collector: c,
+		lock:      &sync.RWMutex{},
+	}
+	if err := t.AddExamples(exampleURLs...); err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.templateBindings = append(c.templateBindings, t)
+	c.lock.Unlock()
+	return t, nil
+}
+
+// TemplateName returns the name of the first TemplateBinding which
+// matches the URL or empty string if no binding matches.
+func (c *Collector) TemplateName(u *url.URL) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, t := range c.templateBindings {
+		if t.Match(u) {
+			return t.Name
+		}
+	}
+	return ""
+}
+
+// AddExamples extends the binding with additional example URLs
+func (t *TemplateBinding) AddExamples(exampleURLs ...string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, e := range exampleURLs {
+		u, err := url.Parse(e)
+		if err != nil {
+			return err
+		}
+		t.addTemplate(templateSegments(u))
+	}
+	return nil
+}
+
+// Match returns true if the URL shares the template of the binding
+func (t *TemplateBinding) Match(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	segments := templateSegments(u)
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, tpl := range t.templates {
+		if matchTemplate(tpl, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnRequest registers a RequestCallback which is only executed
+// for requests matching the template
+func (t *TemplateBinding) OnRequest(f RequestCallback) {
+	t.collector.OnRequest(func(r *Request) {
+		if t.Match(r.URL) {
+			f(r)
+		}
+	})
+}
+
+// OnResponse registers a ResponseCallback which is only executed
+// for responses matching the template
+func (t *TemplateBinding) OnResponse(f ResponseCallback) {
+	t.collector.OnResponse(func(r *Response) {
+		if t.Match(r.Request.URL) {
+			f(r)
+		}
+	})
+}
+
+// OnHTML registers an HTMLCallback which is only executed
+// for documents matching the template
+func (t *TemplateBinding) OnHTML(goquerySelector string, f HTMLCallback) {
+	t.collector.OnHTML(goquerySelector, func(e *HTMLElement) {
+		if t.Match(e.Request.URL) {
+			f(e)
+		}
+	})
+}
+
+// OnXML registers an XMLCallback which is only executed
+// for documents matching the template
+func (t *TemplateBinding) OnXML(xpathQuery string, f XMLCallback) {
+	t.collector.OnXML(xpathQuery, func(e *XMLElement) {
+		if t.Match(e.Request.URL) {
+			f(e)
+		}
+	})
+}
+
+// OnScraped registers a ScrapedCallback which is only executed
+// for responses matching the template
+func (t *TemplateBinding) OnScraped(f ScrapedCallback) {
+	t.collector.OnScraped(func(r *Response) {
+		if t.Match(r.Request.URL) {
+			f(r)
+		}
+	})
+}
+
+func (t *TemplateBinding) addTemplate(segments []string) {
+	for i, tpl := range t.templates {
+		if len(tpl) != len(segments) {
+			continue
+		}
+		diff := -1
+		for j := range tpl {
+			if tpl[j] == segments[j] || tpl[j] == templateWildcard {
+				continue
+			}
+			if diff != -1 {
+				diff = -2
+				break
+			}
+			diff = j
+		}
+		if diff == -1 {
+			return
+		}
+		// host (the first segment) is never generalized
+		if diff > 0 {
+			t.templates[i][diff] = templateWildcard
+			return
+		}
+	}
+	t.templates = append(t.templates, segments)
+}
+
+func matchTemplate(tpl, segments []string) bool {
+	if len(tpl) != len(segments) {
+		return false
+	}
+	for i := range tpl {
+		if tpl[i] != templateWildcard && tpl[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func templateSegments(u *url.URL) []string {
+	p := strings.Trim(u.EscapedPath(), "/")
+	segments := []string{strings.ToLower(u.Hostname())}
+	if p == "" {
+		return segments
+	}
+	for _, s := range strings.Split(p, "/") {
+		segments = append(segments, templateSegment(s))
+	}
+	return segments
+}
+
+func templateSegment(s string) string {
+	ext := path.Ext(s)
+	if ext == s || digitRe.MatchString(ext) {
+		ext = ""
+	}
+	base := s[:len(s)-len(ext)]
+	switch {
+	case numberSegmentRe.MatchString(base):
+		base = templateNumber
+	case idSegmentRe.MatchString(base) && digitRe.MatchString(base):
+		base = templateID
+	case slugSegmentRe.MatchString(base):
+		base = templateSlug
+	case digitRe.MatchString(base) && strings.ContainsAny(base, "-_"):
+		base = templateSlug
+	}
+	return base + ext
+}
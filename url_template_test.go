@@ -0,0 +1,85 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestURLTemplate(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://example.com/":                                       "example.com",
+		"http://example.com/item/1234":                              "example.com/item/{num}",
+		"http://example.com/item/1234.html":                         "example.com/item/{num}.html",
+		"http://Example.com:8080/user/5f2b8c9e1a":                   "example.com/user/{id}",
+		"http://example.com/p/blue-shoe-42?ref=x":                   "example.com/p/{slug}",
+		"http://example.com/blog/how-to-write-a-scraper/":           "example.com/blog/{slug}",
+		"http://example.com/category/shoes":                         "example.com/category/shoes",
+		"http://example.com/v1.2/docs":                              "example.com/v1.2/docs",
+		"http://example.com/a/b7c3e1f0-2a4b-4c5d-8e9f-0123456789ab": "example.com/a/{id}",
+	} {
+		u, _ := url.Parse(in)
+		if got := URLTemplate(u); got != want {
+			t.Errorf("URLTemplate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTemplateBinding(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><h1>` + r.URL.Path + `</h1></body></html>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewCollector()
+	products, err := c.BindTemplate("product", ts.URL+"/product/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories, err := c.BindTemplate("category", ts.URL+"/category/shoes", ts.URL+"/category/hats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var productPages, categoryPages []string
+	products.OnHTML("h1", func(e *HTMLElement) {
+		productPages = append(productPages, e.Text)
+	})
+	categories.OnHTML("h1", func(e *HTMLElement) {
+		categoryPages = append(categoryPages, e.Text)
+	})
+
+	for _, p := range []string{"/product/42", "/category/bags", "/about", "/product/42/reviews"} {
+		c.Visit(ts.URL + p)
+	}
+
+	if len(productPages) != 1 || productPages[0] != "/product/42" {
+		t.Errorf("Invalid product pages: %v", productPages)
+	}
+	if len(categoryPages) != 1 || categoryPages[0] != "/category/bags" {
+		t.Errorf("Invalid category pages: %v", categoryPages)
+	}
+
+	u, _ := url.Parse(ts.URL + "/category/toys")
+	if name := c.TemplateName(u); name != "category" {
+		t.Errorf("TemplateName() = %q, want %q", name, "category")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// VariantDetection detects the URLs serving materially different pages
+// to different visitors, e.g. A/B tests or geographic variants, by
+// fetching sampled pages again without cookies and comparing the
+// structure of their documents
+type VariantDetection struct {
+	// SampleRate is the ratio of the checked HTML responses between 0
+	// and 1
+	SampleRate float64
+	// Refetches is the number of additional requests of a sampled page.
+	// The default is 2.
+	Refetches int
+	// MaxDistance is the number of bits the structural SimHashes of the
+	// same page can differ in. The default is 3.
+	MaxDistance int
+}
+
+// DetectVariants enables the detection of pages with variants. The
+// sampled responses having variants are flagged by Response.Variant
+// before the OnResponse callbacks and listed by Collector.Variants.
+func DetectVariants(d VariantDetection) CollectorOption {
+	return func(c *Collector) {
+		c.VariantDetection = &d
+	}
+}
+
+// variantURLs contains the URLs having variants
+type variantURLs struct {
+	lock sync.Mutex
+	urls map[string]bool
+}
+
+// Variants returns the URLs detected to have variants
+func (c *Collector) Variants() []string {
+	c.variants.lock.Lock()
+	defer c.variants.lock.Unlock()
+	urls := make([]string, 0, len(c.variants.urls))
+	for u := range c.variants.urls {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// checkVariants fetches a sampled response again and reports whether
+// the page has variants
+func (c *Collector) checkVariants(req *http.Request, r *Response) bool {
+	d := c.VariantDetection
+	if req.Method != "GET" || r.StatusCode != http.StatusOK || !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		return false
+	}
+	if rand.Float64() >= d.SampleRate {
+		return false
+	}
+	refetches, maxDistance := d.Refetches, d.MaxDistance
+	if refetches <= 0 {
+		refetches = 2
+	}
+	if maxDistance <= 0 {
+		maxDistance = 3
+	}
+	fingerprint := structureHash(r.Body)
+	for i := 0; i < refetches; i++ {
+		body, err := c.refetch(req)
+		if err != nil {
+			return false
+		}
+		if HammingDistance(fingerprint, structureHash(body)) > maxDistance {
+			c.variants.lock.Lock()
+			if c.variants.urls == nil {
+				c.variants.urls = make(map[string]bool)
+			}
+			c.variants.urls[r.Request.URL.String()] = true
+			c.variants.lock.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// refetch downloads the page of a request without cookies in a slot of
+// its LimitRule
+func (c *Collector) refetch(req *http.Request) ([]byte, error) {
+	s, err := c.backend.frontier.acquire(c.Context, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release(true)
+	client := *c.backend.client()
+	client.Jar = nil
+	refetch, err := http.NewRequest("GET", req.URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	refetch, cancel := c.backend.withTimeout(refetch.WithContext(c.Context))
+	defer cancel()
+	for k, v := range req.Header {
+		switch k {
+		case "Cookie", "Accept-Encoding", "Range":
+		default:
+			refetch.Header[k] = v
+		}
+	}
+	res, err := client.Do(refetch)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var body io.Reader = res.Body
+	if c.MaxBodySize > 0 {
+		body = io.LimitReader(body, int64(c.MaxBodySize))
+	}
+	return ioutil.ReadAll(body)
+}
+
+// structureHash returns the SimHash of the elements of a HTML document
+// including their classes and IDs, but without their text
+func structureHash(body []byte) uint64 {
+	var words []string
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsNumber(r) {
+				return r
+			}
+			return -1
+		}, s)
+	}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return SimHash(strings.Join(words, " "))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			word := string(name)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				if string(k) == "class" || string(k) == "id" {
+					word += "x" + clean(string(v))
+				}
+			}
+			words = append(words, word)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+const variantA = `<html><body><div class="header"><ul class="nav"><li>a</li><li>b</li></ul></div>
+<div class="content"><h1>Title</h1><p>Text</p><p>Text</p></div>
+<div class="footer"><span>footer</span></div></body></html>`
+
+const variantB = `<html><body><section id="hero"><img src="/a.png"><button class="cta">Buy</button></section>
+<main><article><h2 class="title">Title</h2><table><tr><td>1</td><td>2</td></tr></table></article></main>
+<form><input name="q"><input type="submit"></form></body></html>`
+
+func TestDetectVariants(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/ab":
+			if atomic.AddInt32(&requests, 1)%2 == 1 {
+				w.Write([]byte(variantA))
+			} else {
+				w.Write([]byte(variantB))
+			}
+		default:
+			// the text changes, but the structure is the same
+			fmt.Fprintf(w, variantA+"<!-- %d -->", atomic.AddInt32(&requests, 1))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCollector(DetectVariants(VariantDetection{SampleRate: 1}))
+	flagged := map[string]bool{}
+	c.OnResponse(func(r *Response) {
+		flagged[r.Request.URL.Path] = r.Variant
+	})
+	c.Visit(ts.URL + "/ab")
+	c.Visit(ts.URL + "/static")
+	if !flagged["/ab"] {
+		t.Error("A/B page was not flagged")
+	}
+	if flagged["/static"] {
+		t.Error("Page without variants was flagged")
+	}
+	if variants := c.Variants(); !reflect.DeepEqual(variants, []string{ts.URL + "/ab"}) {
+		t.Errorf("Unexpected variants: %v", variants)
+	}
+
+	c = NewCollector(DetectVariants(VariantDetection{}))
+	c.OnResponse(func(r *Response) {
+		if r.Variant {
+			t.Error("Page was checked with zero sample rate")
+		}
+	})
+	c.Visit(ts.URL + "/ab")
+}
+
+func TestStructureHash(t *testing.T) {
+	a := structureHash([]byte(`<div class="a"><p>one</p></div>`))
+	b := structureHash([]byte(`<div class="a"><p>two</p></div>`))
+	if a != b {
+		t.Error("Text changed the structure hash")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vcr implements a recording HTTP transport which saves
+// responses to a cassette directory and replays them later without
+// network access. It makes tests of scrapers deterministic:
+//
+//	c := colly.NewCollector()
+//	c.WithTransport(vcr.New("testdata/cassette", vcr.ModeAuto, nil))
+package vcr
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Mode defines whether the transport records or replays interactions
+type Mode int
+
+const (
+	// ModeAuto replays recorded interactions and records the missing ones
+	ModeAuto Mode = iota
+	// ModeRecord performs every request and overwrites the recorded interactions
+	ModeRecord
+	// ModeReplay replays recorded interactions and never accesses the network
+	ModeReplay
+)
+
+// ErrInteractionNotFound is the error returned in ModeReplay if
+// a request has no recorded interaction
+var ErrInteractionNotFound = errors.New("No recorded interaction found")
+
+// Transport is a http.RoundTripper which records and replays
+// HTTP interactions. Interactions are keyed by method, URL and
+// request body and every interaction is stored in a separate file
+// of the cassette directory, so Transport is safe for concurrent use.
+type Transport struct {
+	// Dir is the cassette directory
+	Dir string
+	// Mode is the recording mode
+	Mode Mode
+	// Transport is used to perform the recorded requests.
+	// http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+}
+
+// Interaction is a recorded request-response pair
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the recorded part of a request
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the recorded part of a response
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Proto        string      `json:"proto"`
+	Headers      http.Header `json:"headers"`
+	Body         []byte      `json:"body"`
+	Uncompressed bool        `json:"uncompressed,omitempty"`
+}
+
+// New creates a recording Transport
+func New(dir string, mode Mode, transport http.RoundTripper) *Transport {
+	return &Transport{
+		Dir:       dir,
+		Mode:      mode,
+		Transport: transport,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	fileName := filepath.Join(t.Dir, Key(req.Method, req.URL.String(), body)+".json")
+	if t.Mode != ModeRecord {
+		if i, err := load(fileName); err == nil {
+			return i.Response.response(req), nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if t.Mode == ModeReplay {
+			return nil, ErrInteractionNotFound
+		}
+	}
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	i := &Interaction{
+		Request: &RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: req.Header,
+			Body:    body,
+		},
+		Response: &RecordedResponse{
+			StatusCode:   res.StatusCode,
+			Proto:        res.Proto,
+			Headers:      res.Header,
+			Body:         resBody,
+			Uncompressed: res.Uncompressed,
+		},
+	}
+	if err := save(fileName, i); err != nil {
+		return nil, err
+	}
+	return i.Response.response(req), nil
+}
+
+// Key returns the identifier of an interaction
+func Key(method, URL string, body []byte) string {
+	h := sha1.New()
+	io.WriteString(h, method+"\n"+URL+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (r *RecordedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         r.Proto,
+		Header:        cloneHeader(r.Headers),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Uncompressed:  r.Uncompressed,
+		Request:       req,
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return ioutil.ReadAll(req.Body)
+}
+
+func load(fileName string) (*Interaction, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	i := &Interaction{}
+	if err := json.NewDecoder(f).Decode(i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func save(fileName string, i *Interaction) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0750); err != nil {
+		return err
+	}
+	f, err := os.Create(fileName + "~")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(i); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fileName+"~", fileName)
+}
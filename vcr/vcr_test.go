@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vcr
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colly_vcr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Method + " " + r.FormValue("q") + "</p>"))
+	}))
+
+	crawl := func(mode Mode) []string {
+		var res []string
+		c := colly.NewCollector(colly.AllowURLRevisit())
+		c.WithTransport(New(dir, mode, nil))
+		c.OnHTML("p", func(e *colly.HTMLElement) {
+			res = append(res, e.Text)
+		})
+		c.Visit(ts.URL + "/?q=a")
+		c.Post(ts.URL+"/", map[string]string{"q": "b"})
+		c.Post(ts.URL+"/", map[string]string{"q": "c"})
+		return res
+	}
+
+	recorded := crawl(ModeAuto)
+	if requests != 3 || len(recorded) != 3 {
+		t.Fatalf("Invalid recording: %d requests, %v", requests, recorded)
+	}
+	ts.Close()
+
+	replayed := crawl(ModeReplay)
+	if len(replayed) != 3 {
+		t.Fatalf("Invalid replay: %v", replayed)
+	}
+	for i := range recorded {
+		if recorded[i] != replayed[i] {
+			t.Errorf("Replayed %q, want %q", replayed[i], recorded[i])
+		}
+	}
+
+	c := colly.NewCollector()
+	c.WithTransport(New(dir, ModeReplay, nil))
+	if err := c.Visit(ts.URL + "/missing"); err == nil {
+		t.Error("Replaying a missing interaction should fail")
+	}
+}
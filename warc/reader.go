@@ -0,0 +1,117 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRecord is returned by Reader if a record is malformed
+var ErrInvalidRecord = errors.New("Invalid WARC record")
+
+// Reader reads the records of a WARC file. Both uncompressed and gzip
+// compressed files are supported.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a Reader. Gzip compressed input is detected by its
+// magic number.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{r: br}, nil
+}
+
+// ReadRecord returns the next record or io.EOF at the end of the file.
+// The WARC headers without a field of Record are kept in its Headers.
+func (r *Reader) ReadRecord() (*Record, error) {
+	var line string
+	var err error
+	// records are separated by empty lines
+	for line == "" {
+		line, err = r.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("%s: unexpected version line %q", ErrInvalidRecord, line)
+	}
+	rec := &Record{Headers: http.Header{}}
+	length := -1
+	for {
+		line, err = r.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("%s: invalid header %q", ErrInvalidRecord, line)
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch strings.ToLower(name) {
+		case "warc-type":
+			rec.Type = value
+		case "warc-record-id":
+			rec.ID = value
+		case "warc-date":
+			rec.Date, _ = time.Parse(time.RFC3339Nano, value)
+		case "warc-target-uri":
+			// WARC 1.0 writers may enclose the URI in angle brackets
+			rec.TargetURI = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "warc-concurrent-to":
+			rec.ConcurrentTo = value
+		case "content-type":
+			rec.ContentType = value
+		case "content-length":
+			if length, err = strconv.Atoi(value); err != nil || length < 0 {
+				return nil, fmt.Errorf("%s: invalid Content-Length %q", ErrInvalidRecord, value)
+			}
+		default:
+			rec.Headers[name] = append(rec.Headers[name], value)
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("%s: missing Content-Length", ErrInvalidRecord)
+	}
+	rec.Block = make([]byte, length)
+	if _, err := io.ReadFull(r.r, rec.Block); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// DefaultMaxFileSize is the default size of the WARC files after which
+// a new file is started
+const DefaultMaxFileSize = 1 << 30
+
+// Recorder writes a request and a response record of every HTTP round
+// trip of a Collector to WARC files. The files are named
+// "<Prefix>-<timestamp>-<serial>.warc", or ".warc.gz" if Compress is
+// set, and every file starts with a warcinfo record.
+//
+// The response bodies are recorded decompressed, because the Collector
+// decodes them while downloading, so the Content-Encoding header is
+// removed from the recorded responses and Content-Length is set to the
+// length of the recorded body. Responses served from the CacheDir of the
+// Collector are not recorded.
+type Recorder struct {
+	// Dir is the directory of the WARC files
+	Dir string
+	// Prefix is the first part of the names of the WARC files. The
+	// default prefix is "colly".
+	Prefix string
+	// MaxFileSize is the size of a WARC file after which a new file is
+	// started. DefaultMaxFileSize is used if it is zero. Negative values
+	// disable rotation.
+	MaxFileSize int64
+	// Compress writes gzip compressed .warc.gz files
+	Compress bool
+	lock     *sync.Mutex
+	disabled bool
+	file     *os.File
+	written  int64
+	serial   int
+	files    []string
+	err      error
+}
+
+// NewRecorder creates a Recorder writing to the directory and attaches it
+// to the Collector. The files are created on the first recorded round
+// trip.
+func NewRecorder(c *colly.Collector, dir string) *Recorder {
+	r := &Recorder{Dir: dir, lock: &sync.Mutex{}}
+	c.OnHTTPExchange(r.record)
+	return r
+}
+
+// SetEnabled turns the recording on or off
+func (r *Recorder) SetEnabled(enabled bool) {
+	r.lock.Lock()
+	r.disabled = !enabled
+	r.lock.Unlock()
+}
+
+// Files returns the paths of the written WARC files
+func (r *Recorder) Files() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Err returns the first error of writing the WARC files
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Close closes the current WARC file. Recording continues in a new file
+// if the Collector sends more requests.
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.closeFile()
+}
+
+// closeFile must be called holding the lock
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// countingWriter counts the bytes written to the current file
+type countingWriter struct {
+	r *Recorder
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.r.file.Write(p)
+	w.r.written += int64(n)
+	return n, err
+}
+
+// nextFile starts a new WARC file. It must be called holding the lock.
+func (r *Recorder) nextFile() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.Dir, 0750); err != nil {
+		return err
+	}
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = "colly"
+	}
+	r.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc", prefix, time.Now().UTC().Format("20060102150405"), r.serial)
+	if r.Compress {
+		name += ".gz"
+	}
+	f, err := os.Create(filepath.Join(r.Dir, name))
+	if err != nil {
+		return err
+	}
+	r.file, r.written = f, 0
+	r.files = append(r.files, f.Name())
+	info := "software: colly\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	return r.writer().WriteRecord(&Record{
+		Type:        TypeWarcinfo,
+		ContentType: "application/warc-fields",
+		Headers:     http.Header{"WARC-Filename": {name}},
+		Block:       []byte(info),
+	})
+}
+
+func (r *Recorder) writer() *Writer {
+	w := NewWriter(countingWriter{r})
+	w.Compress = r.Compress
+	return w
+}
+
+func (r *Recorder) record(ex *colly.HTTPExchange) {
+	if ex.Err != nil || ex.StatusCode == 0 {
+		return
+	}
+	request := requestBlock(ex.Request)
+	response := responseBlock(ex)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.disabled || r.err != nil {
+		return
+	}
+	maxSize := r.MaxFileSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	if r.file == nil || (maxSize > 0 && r.written >= maxSize) {
+		if r.err = r.nextFile(); r.err != nil {
+			return
+		}
+	}
+	w := r.writer()
+	uri := ex.Request.URL.String()
+	responseID := NewRecordID()
+	if r.err = w.WriteRecord(&Record{
+		Type:         TypeRequest,
+		Date:         ex.Started,
+		TargetURI:    uri,
+		ContentType:  "application/http;msgtype=request",
+		ConcurrentTo: responseID,
+		Block:        request,
+	}); r.err != nil {
+		return
+	}
+	payload := ex.Body
+	if payload == nil {
+		payload = []byte{}
+	}
+	r.err = w.WriteRecord(&Record{
+		Type:        TypeResponse,
+		ID:          responseID,
+		Date:        ex.Started,
+		TargetURI:   uri,
+		ContentType: "application/http;msgtype=response",
+		Block:       response,
+		Payload:     payload,
+	})
+}
+
+// requestBlock returns the HTTP/1.1 message of a request
+func requestBlock(req *http.Request) []byte {
+	var body []byte
+	if req.GetBody != nil {
+		if b, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(b)
+			b.Close()
+		}
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(buf, "Host: %s\r\n", host)
+	h := req.Header
+	if len(body) > 0 {
+		h = cloneHeader(h)
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	writeHeaders(buf, h)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// responseBlock returns the HTTP message of a response with its decoded
+// body
+func responseBlock(ex *colly.HTTPExchange) []byte {
+	buf := &bytes.Buffer{}
+	proto := ex.Proto
+	if proto == "" || strings.HasPrefix(proto, "HTTP/2") {
+		// replay tools parse HTTP/1.x messages
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(buf, "%s %d %s\r\n", proto, ex.StatusCode, http.StatusText(ex.StatusCode))
+	h := cloneHeader(ex.Headers)
+	h.Del("Content-Encoding")
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(ex.Body)))
+	writeHeaders(buf, h)
+	buf.Write(ex.Body)
+	return buf.Bytes()
+}
+
+func writeHeaders(buf *bytes.Buffer, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package warc writes the traffic of a Collector to Web ARChive (WARC
+// 1.1) files, which can be replayed by tools like pywb. See
+// https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Version is the WARC version written by Writer
+const Version = "WARC/1.1"
+
+// Record types
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+)
+
+// Record is a WARC record
+type Record struct {
+	// Type is the WARC-Type of the record
+	Type string
+	// ID is the WARC-Record-ID of the record. A new ID is generated by
+	// Writer if it is empty.
+	ID string
+	// Date is the WARC-Date of the record. The time of writing is used
+	// if it is zero.
+	Date time.Time
+	// TargetURI is the WARC-Target-URI of the record
+	TargetURI string
+	// ContentType is the Content-Type of the block
+	ContentType string
+	// ConcurrentTo is the WARC-Concurrent-To of the record, the ID of
+	// a record of the same fetch
+	ConcurrentTo string
+	// Headers contains additional WARC headers
+	Headers http.Header
+	// Block is the content of the record
+	Block []byte
+	// Payload is the payload of the block, e.g. the body of a HTTP
+	// message. Its digest is written as WARC-Payload-Digest if it is
+	// not nil.
+	Payload []byte
+}
+
+// Writer writes WARC records to an io.Writer
+type Writer struct {
+	// Compress writes every record as a separate gzip member, which is
+	// the format of .warc.gz files
+	Compress bool
+	w        io.Writer
+}
+
+// NewWriter creates a Writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteRecord writes a record. It sets the ID and the Date of the record
+// if they are empty.
+func (w *Writer) WriteRecord(r *Record) error {
+	if r.ID == "" {
+		r.ID = NewRecordID()
+	}
+	if r.Date.IsZero() {
+		r.Date = time.Now()
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(Version + "\r\n")
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+		}
+	}
+	field("WARC-Type", r.Type)
+	field("WARC-Record-ID", r.ID)
+	field("WARC-Date", r.Date.UTC().Format(time.RFC3339Nano))
+	field("WARC-Target-URI", r.TargetURI)
+	field("WARC-Concurrent-To", r.ConcurrentTo)
+	field("WARC-Block-Digest", Digest(r.Block))
+	if r.Payload != nil {
+		field("WARC-Payload-Digest", Digest(r.Payload))
+	}
+	keys := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range r.Headers[k] {
+			field(k, v)
+		}
+	}
+	field("Content-Type", r.ContentType)
+	field("Content-Length", strconv.Itoa(len(r.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+	if !w.Compress {
+		_, err := w.w.Write(buf.Bytes())
+		return err
+	}
+	gz := gzip.NewWriter(w.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// NewRecordID returns a new random record ID
+func NewRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Digest returns the SHA-1 digest of the data in the labeled base32
+// format of WARC digests
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
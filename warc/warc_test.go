@@ -0,0 +1,194 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+type testRecord struct {
+	headers map[string]string
+	block   []byte
+}
+
+// readRecords parses the records of a WARC file
+func readRecords(t *testing.T, r io.Reader) []testRecord {
+	var records []testRecord
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return records
+		}
+		if line != Version+"\r\n" {
+			t.Fatalf("Unexpected version line: %q", line)
+		}
+		rec := testRecord{headers: make(map[string]string)}
+		for {
+			line, _ = br.ReadString('\n')
+			if line == "\r\n" {
+				break
+			}
+			kv := strings.SplitN(strings.TrimRight(line, "\r\n"), ": ", 2)
+			rec.headers[kv[0]] = kv[1]
+		}
+		n, _ := strconv.Atoi(rec.headers["Content-Length"])
+		rec.block = make([]byte, n)
+		io.ReadFull(br, rec.block)
+		if end, _ := br.Peek(4); string(end) != "\r\n\r\n" {
+			t.Fatalf("Record is not terminated: %q", end)
+		}
+		br.Discard(4)
+		records = append(records, rec)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		// the response is compressed by the server
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("<p>" + r.URL.Path + "</p>"))
+		gz.Close()
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "colly-warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := colly.NewCollector()
+	r := NewRecorder(c, dir)
+	r.MaxFileSize = 1
+	c.Visit(ts.URL + "/a")
+	r.SetEnabled(false)
+	c.Visit(ts.URL + "/skipped")
+	r.SetEnabled(true)
+	c.Post(ts.URL+"/b", map[string]string{"q": "x"})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	files := r.Files()
+	if len(files) != 2 {
+		t.Fatalf("Files were not rotated: %v", files)
+	}
+	f, _ := os.Open(files[1])
+	defer f.Close()
+	records := readRecords(t, f)
+	if len(records) != 3 {
+		t.Fatalf("Unexpected number of records: %d", len(records))
+	}
+	info, req, res := records[0], records[1], records[2]
+	if info.headers["WARC-Type"] != TypeWarcinfo || !strings.HasSuffix(files[1], info.headers["WARC-Filename"]) {
+		t.Errorf("Unexpected warcinfo record: %v", info.headers)
+	}
+	if req.headers["WARC-Type"] != TypeRequest || req.headers["WARC-Target-URI"] != ts.URL+"/b" ||
+		req.headers["WARC-Concurrent-To"] != res.headers["WARC-Record-ID"] {
+		t.Errorf("Unexpected request record: %v", req.headers)
+	}
+	if !bytes.HasPrefix(req.block, []byte("POST /b HTTP/1.1\r\n")) || !bytes.HasSuffix(req.block, []byte("\r\n\r\nq=x")) {
+		t.Errorf("Unexpected request block: %q", req.block)
+	}
+	httpRes, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(res.block)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(httpRes.Body)
+	if string(body) != "<p>/b</p>" || httpRes.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Unexpected response: %q %v", body, httpRes.Header)
+	}
+	if res.headers["WARC-Block-Digest"] != Digest(res.block) || res.headers["WARC-Payload-Digest"] != Digest(body) {
+		t.Errorf("Invalid digests: %v", res.headers)
+	}
+}
+
+func TestCompressedWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Compress = true
+	for _, uri := range []string{"http://example.com/1", "http://example.com/2"} {
+		if err := w.WriteRecord(&Record{Type: TypeResponse, TargetURI: uri, Block: []byte("HTTP/1.1 200 OK\r\n\r\n")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every record is a separate gzip member
+	gz, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Multistream(false)
+	first := readRecords(t, gz)
+	if len(first) != 1 || first[0].headers["WARC-Target-URI"] != "http://example.com/1" {
+		t.Errorf("Unexpected first member: %v", first)
+	}
+	gz.Reset(bytes.NewReader(buf.Bytes()))
+	if records := readRecords(t, gz); len(records) != 2 {
+		t.Errorf("Unexpected number of records: %d", len(records))
+	}
+	if Digest([]byte("abc")) != "sha1:VGMT4NSHA2AWVOR6EVYXQUGCNSONBWE5" {
+		t.Errorf("Unexpected digest: %s", Digest([]byte("abc")))
+	}
+}
+
+func TestReader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Compress = true
+	in := &Record{
+		Type:         TypeRequest,
+		TargetURI:    "http://example.com/",
+		ContentType:  "application/http;msgtype=request",
+		ConcurrentTo: NewRecordID(),
+		Headers:      http.Header{"WARC-IP-Address": {"127.0.0.1"}},
+		Block:        []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+	}
+	w.WriteRecord(in)
+	w.WriteRecord(&Record{Type: TypeResponse, Block: []byte("HTTP/1.1 204 No Content\r\n\r\n")})
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.ReadRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != in.ID || !out.Date.Equal(in.Date) || out.TargetURI != in.TargetURI || out.ConcurrentTo != in.ConcurrentTo ||
+		out.ContentType != in.ContentType || !bytes.Equal(out.Block, in.Block) || out.Headers["WARC-IP-Address"][0] != "127.0.0.1" {
+		t.Errorf("Unexpected record: %+v", out)
+	}
+	if out, err = r.ReadRecord(); err != nil || out.Type != TypeResponse {
+		t.Errorf("Unexpected second record: %+v %v", out, err)
+	}
+	if _, err = r.ReadRecord(); err != io.EOF {
+		t.Errorf("Unexpected error at the end: %v", err)
+	}
+}
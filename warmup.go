@@ -0,0 +1,157 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WarmUpConnections pre-establishes the connections to every host
+// before its first request. See Collector.WarmUp.
+func WarmUpConnections() CollectorOption {
+	return func(c *Collector) {
+		c.WarmUpConnections = true
+	}
+}
+
+// hostWarmUps contains the warm-ups of the hosts
+type hostWarmUps struct {
+	lock  sync.Mutex
+	hosts map[string]*hostWarmUp
+}
+
+type hostWarmUp struct {
+	once sync.Once
+	err  error
+}
+
+func (w *hostWarmUps) get(host string) *hostWarmUp {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.hosts == nil {
+		w.hosts = make(map[string]*hostWarmUp)
+	}
+	h, ok := w.hosts[host]
+	if !ok {
+		h = &hostWarmUp{}
+		w.hosts[host] = h
+	}
+	return h
+}
+
+// WarmUp pre-establishes as many connections to the hosts of the URLs
+// as the Parallelism of their LimitRules allows, so the first requests
+// of a crawl do not wait for the TCP and TLS handshakes. The connections
+// are opened by concurrent HEAD requests of the root URLs of the hosts.
+// Every HEAD request takes a slot of the LimitRule like the other
+// requests, so the Delay and the Schedule of the rule apply, and hosts
+// disallowing their root URL in robots.txt are not warmed up.
+// It returns the first error of the connections, e.g. a failed TLS
+// handshake. Every host is warmed up only once.
+//
+// The idle connections are kept by the transport, so its limit of idle
+// connections per host, e.g. http.Transport.MaxIdleConnsPerHost, must
+// not be lower than the Parallelism.
+func (c *Collector) WarmUp(urls ...string) error {
+	var err error
+	for _, u := range urls {
+		parsedURL, e := url.Parse(u)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		if e := c.warmUp(parsedURL); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// warmUp warms up the host of the URL once. Concurrent calls wait for
+// the warm-up. The failed warm-ups are reported to the debugger, because
+// the requests of the host do not fail with them.
+func (c *Collector) warmUp(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	h := c.warmUps.get(strings.ToLower(u.Host))
+	h.once.Do(func() {
+		h.err = c.openConnections(u)
+		if h.err != nil && c.debugger != nil {
+			c.debugger.Event(createEvent("warmUp", 0, c.ID, map[string]string{
+				"host":  u.Host,
+				"error": h.err.Error(),
+			}))
+		}
+	})
+	return h.err
+}
+
+func (c *Collector) openConnections(u *url.URL) error {
+	n := 1
+	if rule := c.backend.GetMatchingRule(u.Host); rule != nil {
+		n = rule.parallelism()
+	}
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	if !c.IgnoreRobotsTxt {
+		if err := c.checkRobots(root); err != nil {
+			return err
+		}
+	}
+	client := c.backend.client()
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			s, err := c.backend.frontier.acquire(c.Context, root)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer s.release(true)
+			req, err := http.NewRequest("HEAD", root.String(), nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			req, cancel := c.backend.withTimeout(req.WithContext(c.Context))
+			defer cancel()
+			req.Header.Set("User-Agent", c.UserAgent)
+			c.identify(req.Header)
+			res, err := client.Do(req)
+			if err != nil {
+				errs <- err
+				return
+			}
+			// the connection is reused only if the body is read
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			errs <- nil
+		}()
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colly
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2/debug"
+)
+
+type warmUpServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	methods  []string
+	newConns int
+}
+
+func newWarmUpServer() *warmUpServer {
+	s := &warmUpServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.methods = append(s.methods, r.Method)
+		s.lock.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.lock.Lock()
+			s.newConns++
+			s.lock.Unlock()
+		}
+	}
+	s.StartTLS()
+	return s
+}
+
+func TestWarmUp(t *testing.T) {
+	ts := newWarmUpServer()
+	defer ts.Close()
+
+	c := NewCollector(Async(true))
+	transport := ts.Client().Transport.(*http.Transport)
+	transport.MaxIdleConnsPerHost = 3
+	c.WithTransport(transport)
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 3})
+	if err := c.WarmUp(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WarmUp(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.methods) != 3 || ts.methods[0] != "HEAD" {
+		t.Fatalf("Unexpected warm-up requests: %v", ts.methods)
+	}
+	warmConns := ts.newConns
+	for _, p := range []string{"/1", "/2", "/3"} {
+		c.Visit(ts.URL + p)
+	}
+	c.Wait()
+	if ts.newConns != warmConns {
+		t.Errorf("Requests opened %d new connections after the warm-up", ts.newConns-warmConns)
+	}
+}
+
+func TestWarmUpConnections(t *testing.T) {
+	ts := newWarmUpServer()
+	defer ts.Close()
+
+	c := NewCollector(WarmUpConnections())
+	c.WithTransport(ts.Client().Transport)
+	c.Visit(ts.URL + "/1")
+	c.Visit(ts.URL + "/2")
+	expected := []string{"HEAD", "GET", "GET"}
+	if !reflect.DeepEqual(ts.methods, expected) {
+		t.Errorf("Unexpected requests: %v", ts.methods)
+	}
+
+	// the HEAD requests of the warm-up fail, but the requests do not
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer failing.Close()
+	d := &warmUpDebugger{}
+	c = NewCollector(WarmUpConnections(), Debugger(d))
+	c.OnError(func(r *Response, err error) {
+		t.Errorf("Failed warm-up failed the request: %v", err)
+	})
+	responses := 0
+	c.OnResponse(func(r *Response) {
+		responses++
+	})
+	if err := c.Visit(failing.URL + "/3"); err != nil {
+		t.Errorf("Failed warm-up failed the request: %v", err)
+	}
+	if responses != 1 {
+		t.Errorf("Unexpected number of responses: %d", responses)
+	}
+	if len(d.events) != 1 || d.events[0].Values["error"] == "" {
+		t.Errorf("Failed warm-up was not reported to the debugger: %v", d.events)
+	}
+}
+
+type warmUpDebugger struct {
+	lock   sync.Mutex
+	events []*debug.Event
+}
+
+func (d *warmUpDebugger) Init() error { return nil }
+
+func (d *warmUpDebugger) Event(e *debug.Event) {
+	if e.Type != "warmUp" {
+		return
+	}
+	d.lock.Lock()
+	d.events = append(d.events, e)
+	d.lock.Unlock()
+}
+
+func TestWarmUpDelay(t *testing.T) {
+	var lock sync.Mutex
+	times := map[string]time.Time{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		times[r.Method] = time.Now()
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCollector(WarmUpConnections(), Async(true))
+	delay := 200 * time.Millisecond
+	c.Limit(&LimitRule{DomainGlob: "*", Parallelism: 2, Delay: delay})
+	c.Visit(ts.URL + "/page")
+	c.Wait()
+	if times["HEAD"].IsZero() || times["GET"].IsZero() {
+		t.Fatalf("Missing requests: %v", times)
+	}
+	if d := times["GET"].Sub(times["HEAD"]); d < delay {
+		t.Errorf("Request was sent %v after the warm-up, expected at least %v", d, delay)
+	}
+}
+
+func TestWarmUpRobotsTxt(t *testing.T) {
+	var lock sync.Mutex
+	heads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /\n"))
+			return
+		}
+		if r.Method == "HEAD" {
+			lock.Lock()
+			heads++
+			lock.Unlock()
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCollector()
+	c.IgnoreRobotsTxt = false
+	if err := c.WarmUp(ts.URL); err != ErrRobotsTxtBlocked {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if heads != 0 {
+		t.Errorf("Disallowed host was warmed up by %d requests", heads)
+	}
+}
+
+func TestWarmUpTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c := NewCollector()
+	c.SetRequestTimeout(50 * time.Millisecond)
+	start := time.Now()
+	if err := c.WarmUp(ts.URL); err == nil {
+		t.Error("Timeout of the warm-up was not reported")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Warm-up exceeded the request timeout: %v", d)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wayback visits the historical snapshots of pages archived by
+// the Wayback Machine of the Internet Archive:
+//
+//	a := &wayback.Archive{From: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)}
+//	c.OnHTML("title", func(e *colly.HTMLElement) {
+//		fmt.Println(e.Request.Ctx.Get(wayback.TimestampKey), e.Text)
+//	})
+//	a.Visit(c, "https://example.com/")
+//
+// The snapshots are listed by the CDX API of the archive and they are
+// visited by the Collector, so they pass through its callbacks like any
+// other page. The Collector must allow the domain of the archive,
+// "web.archive.org".
+package wayback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// DefaultURL is the address of the Wayback Machine
+const DefaultURL = "https://web.archive.org"
+
+// TimestampKey is the Context key of the snapshot timestamp in
+// "20060102150405" format
+const TimestampKey = "wayback_timestamp"
+
+// OriginalKey is the Context key of the original URL of the snapshot
+const OriginalKey = "wayback_original"
+
+// timestampFormat is the format of the snapshot timestamps
+const timestampFormat = "20060102150405"
+
+// Snapshot is an archived capture of a page
+type Snapshot struct {
+	// Timestamp is the time of the capture
+	Timestamp time.Time
+	// Original is the captured URL
+	Original string
+	// MimeType is the content type of the capture
+	MimeType string
+	// StatusCode is the HTTP status code of the capture
+	StatusCode int
+	// Digest is the SHA-1 digest of the captured content
+	Digest string
+	// URL is the address of the archived content
+	URL string
+}
+
+// Archive lists and visits the snapshots of the Wayback Machine
+type Archive struct {
+	// URL is the address of the Wayback Machine. DefaultURL is used if
+	// it is empty.
+	URL string
+	// From and To restrict the time range of the snapshots if they are
+	// not zero
+	From, To time.Time
+	// Limit is the maximum number of snapshots of a URL. Zero means no
+	// limit.
+	Limit int
+	// AllStatusCodes includes the captures of redirects and errors.
+	// Only the captures of successful responses are listed by default.
+	AllStatusCodes bool
+	// KeepDuplicates includes the consecutive captures of unchanged
+	// content, which are collapsed by default
+	KeepDuplicates bool
+	// Rewrite visits the snapshots with the links rewritten by the
+	// archive to point to archived pages. The original content is
+	// visited by default.
+	Rewrite bool
+}
+
+// Snapshots lists the snapshots of a URL in chronological order. The
+// CDX API is queried by a clone of the Collector.
+func (a *Archive) Snapshots(c *colly.Collector, u string) ([]Snapshot, error) {
+	sc := c.Clone()
+	sc.Async = false
+	sc.AllowURLRevisit = true
+	sc.AllowedDomains = nil
+	sc.URLFilters = nil
+	sc.DisallowedURLFilters = nil
+	sc.MaxDepth = 0
+	var snapshots []Snapshot
+	var err error
+	sc.OnResponse(func(r *colly.Response) {
+		snapshots, err = a.parseCDX(r.Body)
+	})
+	if verr := sc.Visit(a.cdxURL(u)); verr != nil {
+		return nil, verr
+	}
+	return snapshots, err
+}
+
+// Visit visits the snapshots of the URLs by the Collector. The timestamp
+// and the original URL of the snapshots are stored in the Context of the
+// requests by TimestampKey and OriginalKey. The error of the first
+// failed CDX query is returned after visiting the snapshots of the
+// other URLs.
+func (a *Archive) Visit(c *colly.Collector, urls ...string) error {
+	var firstErr error
+	for _, u := range urls {
+		snapshots, err := a.Snapshots(c, u)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, s := range snapshots {
+			ctx := colly.NewContext()
+			ctx.Put(TimestampKey, s.Timestamp.Format(timestampFormat))
+			ctx.Put(OriginalKey, s.Original)
+			c.Request("GET", s.URL, nil, ctx, nil)
+		}
+	}
+	return firstErr
+}
+
+func (a *Archive) baseURL() string {
+	if a.URL != "" {
+		return a.URL
+	}
+	return DefaultURL
+}
+
+func (a *Archive) cdxURL(u string) string {
+	q := url.Values{}
+	q.Set("url", u)
+	q.Set("output", "json")
+	if !a.From.IsZero() {
+		q.Set("from", a.From.UTC().Format(timestampFormat))
+	}
+	if !a.To.IsZero() {
+		q.Set("to", a.To.UTC().Format(timestampFormat))
+	}
+	if a.Limit > 0 {
+		q.Set("limit", strconv.Itoa(a.Limit))
+	}
+	if !a.AllStatusCodes {
+		q.Set("filter", "statuscode:200")
+	}
+	if !a.KeepDuplicates {
+		q.Set("collapse", "digest")
+	}
+	return a.baseURL() + "/cdx/search/cdx?" + q.Encode()
+}
+
+// snapshotURL returns the address of the archived content
+func (a *Archive) snapshotURL(timestamp, original string) string {
+	modifier := "id_"
+	if a.Rewrite {
+		modifier = ""
+	}
+	return fmt.Sprintf("%s/web/%s%s/%s", a.baseURL(), timestamp, modifier, original)
+}
+
+// parseCDX parses the JSON output of the CDX API, whose first row
+// contains the field names
+func (a *Archive) parseCDX(body []byte) ([]Snapshot, error) {
+	var rows [][]string
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]int)
+	for i, name := range rows[0] {
+		fields[name] = i
+	}
+	get := func(row []string, name string) string {
+		if i, ok := fields[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	snapshots := make([]Snapshot, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		timestamp, original := get(row, "timestamp"), get(row, "original")
+		t, err := time.Parse(timestampFormat, timestamp)
+		if err != nil || original == "" {
+			continue
+		}
+		status, _ := strconv.Atoi(get(row, "statuscode"))
+		snapshots = append(snapshots, Snapshot{
+			Timestamp:  t,
+			Original:   original,
+			MimeType:   get(row, "mimetype"),
+			StatusCode: status,
+			Digest:     get(row, "digest"),
+			URL:        a.snapshotURL(timestamp, original),
+		})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Tauber
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayback
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const cdxResponse = `[["urlkey","timestamp","original","mimetype","statuscode","digest","length"],
+["com,example)/","20150101120000","http://example.com/","text/html","200","AAA","100"],
+["com,example)/","20200601000000","http://example.com/","text/html","200","BBB","120"]]`
+
+func newArchiveServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cdx/search/cdx" {
+			q := r.URL.Query()
+			if q.Get("url") != "example.com" || q.Get("from") != "20100101000000" || q.Get("collapse") != "digest" || q.Get("filter") != "statuscode:200" {
+				t.Errorf("Unexpected CDX query: %s", r.URL.RawQuery)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(cdxResponse))
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/web/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>" + strings.SplitN(r.URL.Path, "/", 4)[2] + "</title>"))
+	}))
+}
+
+func TestSnapshots(t *testing.T) {
+	ts := newArchiveServer(t)
+	defer ts.Close()
+
+	a := &Archive{URL: ts.URL, From: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)}
+	snapshots, err := a.Snapshots(colly.NewCollector(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Snapshot{
+		{
+			Timestamp:  time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC),
+			Original:   "http://example.com/",
+			MimeType:   "text/html",
+			StatusCode: 200,
+			Digest:     "AAA",
+			URL:        ts.URL + "/web/20150101120000id_/http://example.com/",
+		},
+		{
+			Timestamp:  time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+			Original:   "http://example.com/",
+			MimeType:   "text/html",
+			StatusCode: 200,
+			Digest:     "BBB",
+			URL:        ts.URL + "/web/20200601000000id_/http://example.com/",
+		},
+	}
+	if !reflect.DeepEqual(snapshots, expected) {
+		t.Errorf("Unexpected snapshots: %v", snapshots)
+	}
+}
+
+func TestVisit(t *testing.T) {
+	ts := newArchiveServer(t)
+	defer ts.Close()
+
+	a := &Archive{URL: ts.URL, From: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := colly.NewCollector()
+	var visited []string
+	c.OnHTML("title", func(e *colly.HTMLElement) {
+		if e.Request.Ctx.Get(OriginalKey) != "http://example.com/" {
+			t.Errorf("Unexpected original URL: %q", e.Request.Ctx.Get(OriginalKey))
+		}
+		if !strings.HasPrefix(e.Text, e.Request.Ctx.Get(TimestampKey)) {
+			t.Errorf("Timestamp %q does not match snapshot %q", e.Request.Ctx.Get(TimestampKey), e.Text)
+		}
+		visited = append(visited, e.Text)
+	})
+	if err := a.Visit(c, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"20150101120000id_", "20200601000000id_"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Unexpected visited snapshots: %v", visited)
+	}
+}